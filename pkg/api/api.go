@@ -21,12 +21,15 @@ import (
 	"github.com/grafana/dskit/server"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
 
 	"github.com/grafana/mimir/pkg/alertmanager"
 	"github.com/grafana/mimir/pkg/alertmanager/alertmanagerpb"
+	"github.com/grafana/mimir/pkg/api/audit"
 	bbschedulerpb "github.com/grafana/mimir/pkg/blockbuilder/schedulerpb"
 	"github.com/grafana/mimir/pkg/compactor"
 	"github.com/grafana/mimir/pkg/distributor"
+	"github.com/grafana/mimir/pkg/distributor/datadogpush"
 	"github.com/grafana/mimir/pkg/distributor/distributorpb"
 	frontendv1 "github.com/grafana/mimir/pkg/frontend/v1"
 	"github.com/grafana/mimir/pkg/frontend/v1/frontendv1pb"
@@ -41,6 +44,8 @@ import (
 	"github.com/grafana/mimir/pkg/scheduler/schedulerpb"
 	"github.com/grafana/mimir/pkg/storegateway"
 	"github.com/grafana/mimir/pkg/storegateway/storegatewaypb"
+	"github.com/grafana/mimir/pkg/tenantlimits"
+	"github.com/grafana/mimir/pkg/tenantusage"
 	"github.com/grafana/mimir/pkg/util/gziphandler"
 	util_log "github.com/grafana/mimir/pkg/util/log"
 	"github.com/grafana/mimir/pkg/util/validation"
@@ -56,6 +61,8 @@ type Config struct {
 	AlertmanagerHTTPPrefix string `yaml:"alertmanager_http_prefix" category:"advanced"`
 	PrometheusHTTPPrefix   string `yaml:"prometheus_http_prefix" category:"advanced"`
 
+	AuditLog audit.Config `yaml:"audit_log"`
+
 	// The following configs are injected by the upstream caller.
 	ServerPrefix       string               `yaml:"-"`
 	HTTPAuthMiddleware middleware.Interface `yaml:"-"`
@@ -65,6 +72,9 @@ type Config struct {
 	// initialized, the custom config handler will be used instead of
 	// DefaultConfigHandler.
 	CustomConfigHandler ConfigHandler `yaml:"-"`
+
+	// AuditLogger records the administrative and destructive API calls, if the audit log is enabled.
+	AuditLogger *audit.Logger `yaml:"-"`
 }
 
 // RegisterFlags adds the flags required to config this to the given FlagSet.
@@ -72,6 +82,7 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.BoolVar(&cfg.SkipLabelNameValidationHeader, "api.skip-label-name-validation-header-enabled", false, "Allows to skip label name validation via X-Mimir-SkipLabelNameValidation header on the http write path. Use with caution as it breaks PromQL. Allowing this for external clients allows any client to send invalid label names. After enabling it, requests with a specific HTTP header set to true will not have label names validated.")
 	f.BoolVar(&cfg.SkipLabelCountValidationHeader, "api.skip-label-count-validation-header-enabled", false, "Allows to disable enforcement of the label count limit \"max_label_names_per_series\" via X-Mimir-SkipLabelCountValidation header on the http write path. Allowing this for external clients allows any client to send invalid label counts. After enabling it, requests with a specific HTTP header set to true will not have label counts validated.")
 	cfg.RegisterFlagsWithPrefix("", f)
+	cfg.AuditLog.RegisterFlags(f)
 }
 
 // RegisterFlagsWithPrefix adds the flags required to config this to the given FlagSet with the set prefix.
@@ -88,6 +99,8 @@ type API struct {
 	logger    log.Logger
 	sourceIPs *middleware.SourceIPExtractor
 	indexPage *IndexPageContent
+
+	tenantSets *tenantSetsMiddleware
 }
 
 func New(cfg Config, federationCfg tenantfederation.Config, serverCfg server.Config, s *server.Server, logger log.Logger) (*API, error) {
@@ -111,6 +124,7 @@ func New(cfg Config, federationCfg tenantfederation.Config, serverCfg server.Con
 		logger:         logger,
 		sourceIPs:      sourceIPs,
 		indexPage:      newIndexPageContent(),
+		tenantSets:     newTenantSetsMiddleware(federationCfg.TenantSetsPrincipalHeader),
 	}
 
 	// If no authentication middleware is present in the config, use the default authentication middleware.
@@ -121,11 +135,19 @@ func New(cfg Config, federationCfg tenantfederation.Config, serverCfg server.Con
 	// Unconditionally add middleware that ensures we only accept requests with an expected number of tenants
 	// that is applied after any existing auth middleware has run. Only a single tenant is allowed when federation
 	// is disabled. If federation is enabled, there is optionally a max number of tenants that is supported.
-	api.AuthMiddleware = middleware.Merge(api.AuthMiddleware, newTenantValidationMiddleware(federationCfg.Enabled, federationCfg.MaxTenants))
+	// Tenant set references are expanded before the validation, so that the max number of tenants
+	// applies to the tenants the sets resolve to.
+	api.AuthMiddleware = middleware.Merge(api.AuthMiddleware, api.tenantSets, newTenantValidationMiddleware(federationCfg.Enabled, federationCfg.MaxTenants))
 
 	return api, nil
 }
 
+// RegisterTenantSets enables the expansion of tenant set references in the tenant IDs of requests
+// going through the AuthMiddleware. It must be called before the server starts serving requests.
+func (a *API) RegisterTenantSets(provider tenantfederation.TenantSetsProvider) {
+	a.tenantSets.provider = provider
+}
+
 // RegisterDeprecatedRoute behaves in a similar way to RegisterRoute. RegisterDeprecatedRoute also logs warnings on
 // invocations of the deprecated endpoints.
 func (a *API) RegisterDeprecatedRoute(path string, handler http.Handler, auth, gzipEnabled bool, method string, methods ...string) {
@@ -152,6 +174,15 @@ func (a *API) RegisterRoute(path string, handler http.Handler, auth, gzipEnabled
 	a.newRoute(path, handler, false, auth, gzipEnabled, methods...)
 }
 
+// RegisterAuditedRoute behaves in a similar way to RegisterRoute. RegisterAuditedRoute also records the requests
+// changing state in the audit log, if enabled. It must be used for the administrative and destructive endpoints.
+func (a *API) RegisterAuditedRoute(path string, handler http.Handler, auth, gzipEnabled bool, method string, methods ...string) {
+	if a.cfg.AuditLogger != nil {
+		handler = a.cfg.AuditLogger.Wrap(path, a.sourceIPs, handler)
+	}
+	a.RegisterRoute(path, handler, auth, gzipEnabled, method, methods...)
+}
+
 func (a *API) RegisterRoutesWithPrefix(prefix string, handler http.Handler, auth, gzipEnabled bool, methods ...string) {
 	level.Debug(a.logger).Log("msg", "api: registering route", "methods", strings.Join(methods, ","), "prefix", prefix, "auth", auth, "gzip", gzipEnabled)
 	a.newRoute(prefix, handler, true, auth, gzipEnabled, methods...)
@@ -195,8 +226,8 @@ func (a *API) RegisterAlertmanager(am *alertmanager.MultitenantAlertmanager, api
 	// Ensure this route is registered before the prefixed AM route
 	a.RegisterRoute("/multitenant_alertmanager/status", http.HandlerFunc(am.StatusHandler), false, true, "GET")
 	a.RegisterRoute("/multitenant_alertmanager/configs", http.HandlerFunc(am.ListAllConfigs), false, true, "GET")
-	a.RegisterRoute("/multitenant_alertmanager/ring", http.HandlerFunc(am.RingHandler), false, true, "GET", "POST")
-	a.RegisterRoute("/multitenant_alertmanager/delete_tenant_config", http.HandlerFunc(am.DeleteUserConfig), true, true, "POST")
+	a.RegisterAuditedRoute("/multitenant_alertmanager/ring", http.HandlerFunc(am.RingHandler), false, true, "GET", "POST")
+	a.RegisterAuditedRoute("/multitenant_alertmanager/delete_tenant_config", http.HandlerFunc(am.DeleteUserConfig), true, true, "POST")
 	a.RegisterRoute(path.Join(a.cfg.AlertmanagerHTTPPrefix, "/api/v1/status/buildinfo"), buildInfoHandler, false, true, "GET")
 
 	// UI components lead to a large number of routes to support, utilize a path prefix instead
@@ -206,19 +237,19 @@ func (a *API) RegisterAlertmanager(am *alertmanager.MultitenantAlertmanager, api
 	// MultiTenant Alertmanager API routes
 	if apiEnabled {
 		a.RegisterRoute("/api/v1/alerts", http.HandlerFunc(am.GetUserConfig), true, true, "GET")
-		a.RegisterRoute("/api/v1/alerts", http.HandlerFunc(am.SetUserConfig), true, true, "POST")
-		a.RegisterRoute("/api/v1/alerts", http.HandlerFunc(am.DeleteUserConfig), true, true, "DELETE")
+		a.RegisterAuditedRoute("/api/v1/alerts", http.HandlerFunc(am.SetUserConfig), true, true, "POST")
+		a.RegisterAuditedRoute("/api/v1/alerts", http.HandlerFunc(am.DeleteUserConfig), true, true, "DELETE")
 
 		if grafanaCompatEnabled {
 			level.Info(a.logger).Log("msg", "enabled experimental grafana routes")
 
 			a.RegisterRoute("/api/v1/grafana/config", http.HandlerFunc(am.GetUserGrafanaConfig), true, true, http.MethodGet)
-			a.RegisterRoute("/api/v1/grafana/config", http.HandlerFunc(am.SetUserGrafanaConfig), true, true, http.MethodPost)
-			a.RegisterRoute("/api/v1/grafana/config", http.HandlerFunc(am.DeleteUserGrafanaConfig), true, true, http.MethodDelete)
+			a.RegisterAuditedRoute("/api/v1/grafana/config", http.HandlerFunc(am.SetUserGrafanaConfig), true, true, http.MethodPost)
+			a.RegisterAuditedRoute("/api/v1/grafana/config", http.HandlerFunc(am.DeleteUserGrafanaConfig), true, true, http.MethodDelete)
 
 			a.RegisterRoute("/api/v1/grafana/state", http.HandlerFunc(am.GetUserGrafanaState), true, true, http.MethodGet)
-			a.RegisterRoute("/api/v1/grafana/state", http.HandlerFunc(am.SetUserGrafanaState), true, true, http.MethodPost)
-			a.RegisterRoute("/api/v1/grafana/state", http.HandlerFunc(am.DeleteUserGrafanaState), true, true, http.MethodDelete)
+			a.RegisterAuditedRoute("/api/v1/grafana/state", http.HandlerFunc(am.SetUserGrafanaState), true, true, http.MethodPost)
+			a.RegisterAuditedRoute("/api/v1/grafana/state", http.HandlerFunc(am.DeleteUserGrafanaState), true, true, http.MethodDelete)
 
 			// These APIs are handled by the per-tenant Alertmanager, so they are handled by the distributor.
 			a.RegisterRoute("/api/v1/grafana/full_state", am, true, true, http.MethodGet)
@@ -243,22 +274,43 @@ func (a *API) RegisterAPI(httpPathPrefix string, actualCfg interface{}, defaultC
 	a.RegisterRoute("/api/v1/status/buildinfo", buildInfoHandler, false, true, "GET")
 	a.RegisterRoute("/api/v1/status/config", a.cfg.statusConfigHandler(), false, true, "GET")
 	a.RegisterRoute("/api/v1/status/flags", a.cfg.statusFlagsHandler(), false, true, "GET")
+
+	if a.cfg.AuditLogger != nil {
+		a.RegisterRoute("/audit_log", http.HandlerFunc(a.cfg.AuditLogger.QueryHandler), false, true, "GET")
+	}
 }
 
 // RegisterRuntimeConfig registers the endpoints associates with the runtime configuration
-func (a *API) RegisterRuntimeConfig(runtimeConfigHandler http.HandlerFunc, userLimitsHandler http.HandlerFunc) {
+func (a *API) RegisterRuntimeConfig(runtimeConfigHandler http.HandlerFunc) {
 	a.indexPage.AddLinks(runtimeConfigWeight, "Current runtime config", []IndexPageLink{
 		{Desc: "Entire runtime config (including overrides)", Path: "/runtime_config"},
 		{Desc: "Only values that differ from the defaults", Path: "/runtime_config?mode=diff"},
 	})
 
 	a.RegisterRoute("/runtime_config", runtimeConfigHandler, false, true, "GET")
+}
+
+// RegisterUserLimits registers the endpoint serving the limits of the tenant.
+func (a *API) RegisterUserLimits(userLimitsHandler http.HandlerFunc) {
 	a.RegisterRoute("/api/v1/user_limits", userLimitsHandler, true, true, "GET")
 }
 
+// RegisterTenantLimitsStore registers the admin endpoints changing the per-tenant limits overrides of the tenant limits store.
+func (a *API) RegisterTenantLimitsStore(s *tenantlimits.Store) {
+	a.RegisterAuditedRoute("/tenant_limits/{tenant}", http.HandlerFunc(s.LimitsHandler), false, true, "GET", "PUT", "PATCH")
+	a.RegisterRoute("/tenant_limits/{tenant}/history", http.HandlerFunc(s.HistoryHandler), false, true, "GET")
+}
+
 const PrometheusPushEndpoint = "/api/v1/push"
 const OTLPPushEndpoint = "/otlp/v1/metrics"
 const InfluxPushEndpoint = "/api/v1/push/influx/write"
+const InfluxV2WriteEndpoint = "/api/v1/push/influx/api/v2/write"
+const DatadogSeriesV1Endpoint = "/datadog/api/v1/series"
+const DatadogSeriesV2Endpoint = "/datadog/api/v2/series"
+const GraphitePushEndpoint = "/api/v1/push/graphite"
+
+// The dry-run endpoints evaluate the requests of the push endpoints without ingesting them.
+const DryRunEndpointSuffix = "/dry-run"
 
 // RegisterDistributor registers the endpoints associated with the distributor.
 func (a *API) RegisterDistributor(d *distributor.Distributor, pushConfig distributor.Config, reg prometheus.Registerer, limits *validation.Overrides) {
@@ -274,20 +326,77 @@ func (a *API) RegisterDistributor(d *distributor.Distributor, pushConfig distrib
 		a.RegisterRoute(InfluxPushEndpoint, distributor.InfluxHandler(
 			pushConfig.MaxInfluxRequestSize, d.RequestBufferPool, a.sourceIPs, pushConfig.RetryConfig, d.PushWithMiddlewares, d.PushMetrics, a.logger,
 		), true, false, "POST")
+		// The organization or the bucket of the InfluxDB v2 write requests may be required to be the authenticated
+		// tenant, which is checked once they're authenticated, so the auth middleware is applied by InfluxV2AuthMiddleware.
+		a.RegisterRoute(InfluxV2WriteEndpoint, distributor.InfluxV2AuthMiddleware(pushConfig.InfluxV2TenantFrom, a.AuthMiddleware).Wrap(distributor.InfluxV2Handler(
+			pushConfig.MaxInfluxRequestSize, d.RequestBufferPool, a.sourceIPs, limits, pushConfig.RetryConfig, d.PushWithMiddlewares, d.PushMetrics, a.logger,
+		)), false, false, "POST")
+	}
+
+	if pushConfig.EnableDatadogEndpoint {
+		// The Datadog endpoints are experimental.
+		a.RegisterRoute(DatadogSeriesV1Endpoint, distributor.DatadogHandler(
+			datadogpush.V1, pushConfig.MaxDatadogRequestSize, d.RequestBufferPool, a.sourceIPs, limits, pushConfig.RetryConfig, d.PushWithMiddlewares, d.PushMetrics, a.logger,
+		), true, false, "POST")
+		a.RegisterRoute(DatadogSeriesV2Endpoint, distributor.DatadogHandler(
+			datadogpush.V2, pushConfig.MaxDatadogRequestSize, d.RequestBufferPool, a.sourceIPs, limits, pushConfig.RetryConfig, d.PushWithMiddlewares, d.PushMetrics, a.logger,
+		), true, false, "POST")
+	}
+
+	if pushConfig.EnableGraphiteEndpoint {
+		// The Graphite endpoint is experimental.
+		a.RegisterRoute(GraphitePushEndpoint, distributor.GraphiteHandler(
+			pushConfig.MaxGraphiteRequestSize, d.RequestBufferPool, a.sourceIPs, limits, d.GraphiteMappers, pushConfig.RetryConfig, d.PushWithMiddlewares, d.PushMetrics, a.logger,
+		), true, false, "POST")
 	}
 
 	a.RegisterRoute(OTLPPushEndpoint, distributor.OTLPHandler(
 		pushConfig.MaxOTLPRequestSize, d.RequestBufferPool, a.sourceIPs, limits, pushConfig.OTelResourceAttributePromotionConfig,
-		pushConfig.RetryConfig, pushConfig.EnableStartTimeQuietZero, d.PushWithMiddlewares, d.PushMetrics, reg, a.logger,
+		pushConfig.RetryConfig, pushConfig.EnableStartTimeQuietZero, d.OTLPDeltaToCumulative, d.PushWithMiddlewares, d.PushMetrics, reg, a.logger,
 	), true, false, "POST")
 
+	otlpGRPCHandler := distributor.NewOTLPGRPCHandler(
+		pushConfig.MaxOTLPRequestSize, d.RequestBufferPool, limits, pushConfig.OTelResourceAttributePromotionConfig,
+		pushConfig.EnableStartTimeQuietZero, d.OTLPDeltaToCumulative, d.PushWithMiddlewares, d.PushMetrics, reg, a.logger,
+	)
+	if pushConfig.EnableOTLPGRPCEndpoint {
+		// The OTLP gRPC endpoint is experimental.
+		pmetricotlp.RegisterGRPCServer(a.server.GRPC, otlpGRPCHandler)
+	}
+	// Internal gRPC service receiving the OTLP delta data points forwarded by the other distributors, for their
+	// conversion into cumulative ones by the distributor owning their streams.
+	distributor.RegisterOTLPDeltaForwardingServer(a.server.GRPC, otlpGRPCHandler)
+
+	if pushConfig.EnableDryRunEndpoints {
+		// The dry-run endpoints are experimental.
+		a.RegisterRoute(PrometheusPushEndpoint+DryRunEndpointSuffix, distributor.DryRunHandler(distributor.Handler(
+			pushConfig.MaxRecvMsgSize, d.RequestBufferPool, a.sourceIPs, a.cfg.SkipLabelNameValidationHeader,
+			a.cfg.SkipLabelCountValidationHeader, limits, pushConfig.RetryConfig, d.DryRunPush, d.DryRunPushMetrics, a.logger,
+		)), true, false, "POST")
+		a.RegisterRoute(OTLPPushEndpoint+DryRunEndpointSuffix, distributor.DryRunHandler(distributor.OTLPHandler(
+			pushConfig.MaxOTLPRequestSize, d.RequestBufferPool, a.sourceIPs, limits, pushConfig.OTelResourceAttributePromotionConfig,
+			pushConfig.RetryConfig, pushConfig.EnableStartTimeQuietZero, nil, d.DryRunPush, d.DryRunPushMetrics, nil, a.logger, // The stateful delta-to-cumulative conversion is skipped.
+		)), true, false, "POST")
+
+		if pushConfig.EnableInfluxEndpoint {
+			a.RegisterRoute(InfluxPushEndpoint+DryRunEndpointSuffix, distributor.DryRunHandler(distributor.InfluxHandler(
+				pushConfig.MaxInfluxRequestSize, d.RequestBufferPool, a.sourceIPs, pushConfig.RetryConfig, d.DryRunPush, d.DryRunPushMetrics, a.logger,
+			)), true, false, "POST")
+		}
+	}
+
+	if d.StreamingAggregator != nil {
+		// Internal gRPC service receiving the series forwarded by the other distributors for the streaming aggregation.
+		distributor.RegisterStreamingAggregationServer(a.server.GRPC, d.StreamingAggregator)
+	}
+
 	a.indexPage.AddLinks(defaultWeight, "Distributor", []IndexPageLink{
 		{Desc: "Ring status", Path: "/distributor/ring"},
 		{Desc: "Usage statistics", Path: "/distributor/all_user_stats"},
 		{Desc: "HA tracker status", Path: "/distributor/ha_tracker"},
 	})
 
-	a.RegisterRoute("/distributor/ring", d, false, true, "GET", "POST")
+	a.RegisterAuditedRoute("/distributor/ring", d, false, true, "GET", "POST")
 	a.RegisterRoute("/distributor/all_user_stats", http.HandlerFunc(d.AllUserStatsHandler), false, true, "GET")
 	a.RegisterRoute("/distributor/ha_tracker", d.HATracker, false, true, "GET")
 }
@@ -321,12 +430,12 @@ func (a *API) RegisterIngester(i Ingester) {
 		{Dangerous: true, Desc: "Trigger ingester shutdown", Path: "/ingester/shutdown"},
 	})
 
-	a.RegisterRoute("/ingester/flush", http.HandlerFunc(i.FlushHandler), false, true, "GET", "POST")
-	a.RegisterRoute("/ingester/prepare-shutdown", http.HandlerFunc(i.PrepareShutdownHandler), false, true, "GET", "POST", "DELETE")
-	a.RegisterRoute("/ingester/prepare-partition-downscale", http.HandlerFunc(i.PreparePartitionDownscaleHandler), false, true, "GET", "POST", "DELETE")
-	a.RegisterRoute("/ingester/prepare-instance-ring-downscale", http.HandlerFunc(i.PrepareInstanceRingDownscaleHandler), false, true, "GET", "POST", "DELETE")
-	a.RegisterRoute("/ingester/unregister-on-shutdown", http.HandlerFunc(i.PrepareUnregisterHandler), false, false, "GET", "PUT", "DELETE")
-	a.RegisterRoute("/ingester/shutdown", http.HandlerFunc(i.ShutdownHandler), false, true, "POST")
+	a.RegisterAuditedRoute("/ingester/flush", http.HandlerFunc(i.FlushHandler), false, true, "GET", "POST")
+	a.RegisterAuditedRoute("/ingester/prepare-shutdown", http.HandlerFunc(i.PrepareShutdownHandler), false, true, "GET", "POST", "DELETE")
+	a.RegisterAuditedRoute("/ingester/prepare-partition-downscale", http.HandlerFunc(i.PreparePartitionDownscaleHandler), false, true, "GET", "POST", "DELETE")
+	a.RegisterAuditedRoute("/ingester/prepare-instance-ring-downscale", http.HandlerFunc(i.PrepareInstanceRingDownscaleHandler), false, true, "GET", "POST", "DELETE")
+	a.RegisterAuditedRoute("/ingester/unregister-on-shutdown", http.HandlerFunc(i.PrepareUnregisterHandler), false, false, "GET", "PUT", "DELETE")
+	a.RegisterAuditedRoute("/ingester/shutdown", http.HandlerFunc(i.ShutdownHandler), false, true, "POST")
 	a.RegisterRoute("/ingester/tsdb_metrics", http.HandlerFunc(i.UserRegistryHandler), true, true, "GET")
 
 	a.indexPage.AddLinks(defaultWeight, "Ingester", []IndexPageLink{
@@ -343,10 +452,10 @@ func (a *API) RegisterRuler(r *ruler.Ruler) {
 		{Desc: "Ring status", Path: "/ruler/ring"},
 		{Desc: "Ruler tenants", Path: "/ruler/tenants"},
 	})
-	a.RegisterRoute("/ruler/ring", r, false, true, "GET", "POST")
+	a.RegisterAuditedRoute("/ruler/ring", r, false, true, "GET", "POST")
 
 	// Administrative API, uses authentication to inform which user's configuration to delete.
-	a.RegisterRoute("/ruler/delete_tenant_config", http.HandlerFunc(r.DeleteTenantConfiguration), true, true, "POST")
+	a.RegisterAuditedRoute("/ruler/delete_tenant_config", http.HandlerFunc(r.DeleteTenantConfiguration), true, true, "POST")
 
 	// List all user rule groups
 	a.RegisterRoute("/ruler/rule_groups", http.HandlerFunc(r.ListAllRules), false, true, "GET")
@@ -372,9 +481,9 @@ func (a *API) RegisterRulerAPI(r *ruler.API, configAPIEnabled bool, buildInfoHan
 		a.RegisterRoute(path.Join(a.cfg.PrometheusHTTPPrefix, "/config/v1/rules"), http.HandlerFunc(r.ListRules), true, true, "GET")
 		a.RegisterRoute(path.Join(a.cfg.PrometheusHTTPPrefix, "/config/v1/rules/{namespace}"), http.HandlerFunc(r.ListRules), true, true, "GET")
 		a.RegisterRoute(path.Join(a.cfg.PrometheusHTTPPrefix, "/config/v1/rules/{namespace}/{groupName}"), http.HandlerFunc(r.GetRuleGroup), true, true, "GET")
-		a.RegisterRoute(path.Join(a.cfg.PrometheusHTTPPrefix, "/config/v1/rules/{namespace}"), http.HandlerFunc(r.CreateRuleGroup), true, true, "POST")
-		a.RegisterRoute(path.Join(a.cfg.PrometheusHTTPPrefix, "/config/v1/rules/{namespace}/{groupName}"), http.HandlerFunc(r.DeleteRuleGroup), true, true, "DELETE")
-		a.RegisterRoute(path.Join(a.cfg.PrometheusHTTPPrefix, "/config/v1/rules/{namespace}"), http.HandlerFunc(r.DeleteNamespace), true, true, "DELETE")
+		a.RegisterAuditedRoute(path.Join(a.cfg.PrometheusHTTPPrefix, "/config/v1/rules/{namespace}"), http.HandlerFunc(r.CreateRuleGroup), true, true, "POST")
+		a.RegisterAuditedRoute(path.Join(a.cfg.PrometheusHTTPPrefix, "/config/v1/rules/{namespace}/{groupName}"), http.HandlerFunc(r.DeleteRuleGroup), true, true, "DELETE")
+		a.RegisterAuditedRoute(path.Join(a.cfg.PrometheusHTTPPrefix, "/config/v1/rules/{namespace}"), http.HandlerFunc(r.DeleteNamespace), true, true, "DELETE")
 	}
 }
 
@@ -383,7 +492,7 @@ func (a *API) RegisterIngesterRing(r http.Handler) {
 	a.indexPage.AddLinks(defaultWeight, "Ingester", []IndexPageLink{
 		{Desc: "Ring status", Path: "/ingester/ring"},
 	})
-	a.RegisterRoute("/ingester/ring", r, false, true, "GET", "POST")
+	a.RegisterAuditedRoute("/ingester/ring", r, false, true, "GET", "POST")
 }
 
 // RegisterIngesterPartitionRing registers the ring UI page associated with the ingester partitions ring.
@@ -391,7 +500,7 @@ func (a *API) RegisterIngesterPartitionRing(r http.Handler) {
 	a.indexPage.AddLinks(defaultWeight, "Ingester", []IndexPageLink{
 		{Desc: "Partition ring status", Path: "/ingester/partition-ring"},
 	})
-	a.RegisterRoute("/ingester/partition-ring", r, false, true, "GET", "POST")
+	a.RegisterAuditedRoute("/ingester/partition-ring", r, false, true, "GET", "POST")
 }
 
 // RegisterStoreGateway registers the ring UI page associated with the store-gateway.
@@ -402,10 +511,10 @@ func (a *API) RegisterStoreGateway(s *storegateway.StoreGateway) {
 		{Desc: "Ring status", Path: "/store-gateway/ring"},
 		{Desc: "Tenants & Blocks", Path: "/store-gateway/tenants"},
 	})
-	a.RegisterRoute("/store-gateway/ring", http.HandlerFunc(s.RingHandler), false, true, "GET", "POST")
+	a.RegisterAuditedRoute("/store-gateway/ring", http.HandlerFunc(s.RingHandler), false, true, "GET", "POST")
 	a.RegisterRoute("/store-gateway/tenants", http.HandlerFunc(s.TenantsHandler), false, true, "GET")
 	a.RegisterRoute("/store-gateway/tenant/{tenant}/blocks", http.HandlerFunc(s.BlocksHandler), false, true, "GET")
-	a.RegisterRoute("/store-gateway/prepare-shutdown", http.HandlerFunc(s.PrepareShutdownHandler), false, true, "GET", "POST", "DELETE")
+	a.RegisterAuditedRoute("/store-gateway/prepare-shutdown", http.HandlerFunc(s.PrepareShutdownHandler), false, true, "GET", "POST", "DELETE")
 }
 
 // RegisterCompactor registers routes associated with the compactor.
@@ -414,17 +523,25 @@ func (a *API) RegisterCompactor(c *compactor.MultitenantCompactor) {
 		{Desc: "Ring status", Path: "/compactor/ring"},
 		{Desc: "Tenants & compaction jobs", Path: "/compactor/tenants"},
 	})
-	a.RegisterRoute("/compactor/ring", http.HandlerFunc(c.RingHandler), false, true, "GET", "POST")
-	a.RegisterRoute("/api/v1/upload/block/{block}/start", http.HandlerFunc(c.StartBlockUpload), true, false, http.MethodPost)
-	a.RegisterRoute("/api/v1/upload/block/{block}/files", a.DisableServerHTTPTimeouts(http.HandlerFunc(c.UploadBlockFile)), true, false, http.MethodPost)
-	a.RegisterRoute("/api/v1/upload/block/{block}/finish", http.HandlerFunc(c.FinishBlockUpload), true, false, http.MethodPost)
+	a.RegisterAuditedRoute("/compactor/ring", http.HandlerFunc(c.RingHandler), false, true, "GET", "POST")
+	a.RegisterAuditedRoute("/api/v1/upload/block/{block}/start", http.HandlerFunc(c.StartBlockUpload), true, false, http.MethodPost)
+	a.RegisterAuditedRoute("/api/v1/upload/block/{block}/files", a.DisableServerHTTPTimeouts(http.HandlerFunc(c.UploadBlockFile)), true, false, http.MethodPost)
+	a.RegisterAuditedRoute("/api/v1/upload/block/{block}/finish", http.HandlerFunc(c.FinishBlockUpload), true, false, http.MethodPost)
 	a.RegisterRoute("/api/v1/upload/block/{block}/check", http.HandlerFunc(c.GetBlockUploadStateHandler), true, false, http.MethodGet)
-	a.RegisterRoute("/compactor/delete_tenant", http.HandlerFunc(c.DeleteTenant), true, true, "POST")
+	a.RegisterAuditedRoute("/compactor/delete_tenant", http.HandlerFunc(c.DeleteTenant), true, true, "POST")
 	a.RegisterRoute("/compactor/delete_tenant_status", http.HandlerFunc(c.DeleteTenantStatus), true, true, "GET")
 	a.RegisterRoute("/compactor/tenants", http.HandlerFunc(c.TenantsHandler), false, true, "GET")
 	a.RegisterRoute("/compactor/tenant/{tenant}/planned_jobs", http.HandlerFunc(c.PlannedJobsHandler), false, true, "GET")
 }
 
+// RegisterTenantUsage registers the routes of the tenant usage report, served by the compactor.
+func (a *API) RegisterTenantUsage(t *tenantusage.Tracker) {
+	a.indexPage.AddLinks(defaultWeight, "Compactor", []IndexPageLink{
+		{Desc: "Tenant usage report", Path: "/compactor/tenant_usage"},
+	})
+	a.RegisterRoute("/compactor/tenant_usage", http.HandlerFunc(t.ReportHandler), false, true, "GET")
+}
+
 func (a *API) DisableServerHTTPTimeouts(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		c := http.NewResponseController(w)
@@ -496,7 +613,7 @@ func (a *API) RegisterQueryScheduler(f *scheduler.Scheduler) {
 	a.indexPage.AddLinks(defaultWeight, "Query-scheduler", []IndexPageLink{
 		{Desc: "Ring status", Path: "/query-scheduler/ring"},
 	})
-	a.RegisterRoute("/query-scheduler/ring", http.HandlerFunc(f.RingHandler), false, true, "GET", "POST")
+	a.RegisterAuditedRoute("/query-scheduler/ring", http.HandlerFunc(f.RingHandler), false, true, "GET", "POST")
 
 	schedulerpb.RegisterSchedulerForFrontendServer(a.server.GRPC, f)
 	schedulerpb.RegisterSchedulerForQuerierServer(a.server.GRPC, f)
@@ -506,7 +623,7 @@ func (a *API) RegisterOverridesExporter(oe *exporter.OverridesExporter) {
 	a.indexPage.AddLinks(defaultWeight, "Overrides-exporter", []IndexPageLink{
 		{Desc: "Ring status", Path: "/overrides-exporter/ring"},
 	})
-	a.RegisterRoute("/overrides-exporter/ring", http.HandlerFunc(oe.RingHandler), false, true, "GET", "POST")
+	a.RegisterAuditedRoute("/overrides-exporter/ring", http.HandlerFunc(oe.RingHandler), false, true, "GET", "POST")
 }
 
 // RegisterServiceMapHandler registers the Mimir structs service handler
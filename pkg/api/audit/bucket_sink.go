@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+)
+
+const (
+	// auditPrefix is the prefix of the audit log objects in the bucket, under bucket.MimirInternalsPrefix.
+	auditPrefix = "audit"
+
+	dayFormat = "2006-01-02"
+)
+
+// bucketSink writes each batch of events as JSON lines to the bucket, in <day>/<ULID>.json, with one object per
+// day of the events of the batch.
+type bucketSink struct {
+	bkt objstore.Bucket
+}
+
+func newBucketSink(bkt objstore.Bucket) *bucketSink {
+	return &bucketSink{bkt: bucket.NewPrefixedBucketClient(bkt, path.Join(bucket.MimirInternalsPrefix, auditPrefix))}
+}
+
+func (s *bucketSink) write(ctx context.Context, events []Event) error {
+	var days []string
+	byDay := map[string][]Event{}
+	for _, e := range events {
+		day := e.Timestamp.UTC().Format(dayFormat)
+		if _, ok := byDay[day]; !ok {
+			days = append(days, day)
+		}
+		byDay[day] = append(byDay[day], e)
+	}
+
+	for _, day := range days {
+		data, err := encodeEvents(byDay[day])
+		if err != nil {
+			return err
+		}
+		name := path.Join(day, ulid.Make().String()+".json")
+		if err := s.bkt.Upload(ctx, name, bytes.NewReader(data)); err != nil {
+			return errors.Wrap(err, "upload audit log batch")
+		}
+	}
+	return nil
+}
+
+func (s *bucketSink) scan(ctx context.Context, start, end time.Time, fn func(Event)) error {
+	for day := start.UTC().Truncate(24 * time.Hour); !day.After(end); day = day.AddDate(0, 0, 1) {
+		var names []string
+		err := s.bkt.Iter(ctx, day.Format(dayFormat)+objstore.DirDelim, func(name string) error {
+			if strings.HasSuffix(name, ".json") {
+				names = append(names, name)
+			}
+			return nil
+		})
+		if err != nil {
+			return errors.Wrap(err, "list audit log batches")
+		}
+
+		for _, name := range names {
+			if err := s.read(ctx, name, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *bucketSink) read(ctx context.Context, name string, fn func(Event)) error {
+	reader, err := s.bkt.Get(ctx, name)
+	if err != nil {
+		if s.bkt.IsObjNotFoundErr(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "read audit log batch %s", name)
+	}
+	defer func() { _ = reader.Close() }()
+
+	return errors.Wrapf(decodeEvents(reader, fn), "read audit log batch %s", name)
+}
+
+func (s *bucketSink) close() error {
+	return nil
+}
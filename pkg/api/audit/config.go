@@ -0,0 +1,86 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package audit
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/grafana/dskit/flagext"
+)
+
+const (
+	// SinkFile writes the audit log to a local file, rotated by size.
+	SinkFile = "file"
+	// SinkBucket writes the audit log in batches to the blocks storage bucket.
+	SinkBucket = "bucket"
+)
+
+var (
+	errInvalidSink          = fmt.Errorf("unsupported audit log sink, supported sinks are %s and %s", SinkFile, SinkBucket)
+	errMissingFilePath      = errors.New("the audit log file path is required when the file sink is used")
+	errInvalidFileMaxSize   = errors.New("the audit log file max size must be greater than 0")
+	errInvalidFileMaxFiles  = errors.New("the audit log file max files must not be negative")
+	errInvalidFlushInterval = errors.New("the audit log flush interval must be greater than 0")
+	errInvalidMaxBatchSize  = errors.New("the audit log max batch size must be greater than 0")
+)
+
+type Config struct {
+	Enabled       bool                   `yaml:"enabled" category:"experimental"`
+	Sink          string                 `yaml:"sink" category:"experimental"`
+	ActorHeaders  flagext.StringSliceCSV `yaml:"actor_headers" category:"experimental"`
+	FlushInterval time.Duration          `yaml:"flush_interval" category:"experimental"`
+	MaxBatchSize  int                    `yaml:"max_batch_size" category:"experimental"`
+	File          FileConfig             `yaml:"file"`
+}
+
+type FileConfig struct {
+	Path         string `yaml:"path" category:"experimental"`
+	MaxSizeBytes int    `yaml:"max_size_bytes" category:"experimental"`
+	MaxFiles     int    `yaml:"max_files" category:"experimental"`
+}
+
+// RegisterFlags adds the flags required to config this to the given FlagSet.
+func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
+	cfg.ActorHeaders = []string{"X-Grafana-User", "X-Forwarded-User"}
+
+	f.BoolVar(&cfg.Enabled, "api.audit-log.enabled", false, "Enable the audit log of the administrative and destructive API calls, such as the tenant deletions, the changes of the rule groups, of the Alertmanager configurations and of the tenant limits, the block uploads, and the shutdown and ring management endpoints.")
+	f.StringVar(&cfg.Sink, "api.audit-log.sink", SinkFile, fmt.Sprintf("Where the audit log is written. Supported values are: %s, %s. The %s sink writes the audit log of this instance to a local file, rotated by size. The %s sink writes the audit log of all the instances in the blocks storage bucket.", SinkFile, SinkBucket, SinkFile, SinkBucket))
+	f.Var(&cfg.ActorHeaders, "api.audit-log.actor-headers", "Comma-separated list of HTTP headers the actor of an API call is read from. The first header set in the request is used.")
+	f.DurationVar(&cfg.FlushInterval, "api.audit-log.flush-interval", 10*time.Second, "Interval at which the recorded API calls are written to the sink. The API calls are written earlier when there are -api.audit-log.max-batch-size of them.")
+	f.IntVar(&cfg.MaxBatchSize, "api.audit-log.max-batch-size", 1000, "Maximum number of API calls written to the sink at once.")
+	f.StringVar(&cfg.File.Path, "api.audit-log.file.path", "./audit/audit.log", "Path of the audit log file, when the file sink is used.")
+	f.IntVar(&cfg.File.MaxSizeBytes, "api.audit-log.file.max-size-bytes", 100<<20, "Size after which the audit log file is rotated.")
+	f.IntVar(&cfg.File.MaxFiles, "api.audit-log.file.max-files", 5, "Number of rotated audit log files kept, in addition to the current one.")
+}
+
+func (cfg *Config) Validate() error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.FlushInterval <= 0 {
+		return errInvalidFlushInterval
+	}
+	if cfg.MaxBatchSize <= 0 {
+		return errInvalidMaxBatchSize
+	}
+
+	switch cfg.Sink {
+	case SinkFile:
+		if cfg.File.Path == "" {
+			return errMissingFilePath
+		}
+		if cfg.File.MaxSizeBytes <= 0 {
+			return errInvalidFileMaxSize
+		}
+		if cfg.File.MaxFiles < 0 {
+			return errInvalidFileMaxFiles
+		}
+	case SinkBucket:
+	default:
+		return errInvalidSink
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// fileSink writes the events as JSON lines to a local file. The file is rotated when it grows above the max
+// size: the rotated files are named <path>.1 to <path>.<max files>, <path>.1 being the most recent one.
+type fileSink struct {
+	cfg FileConfig
+
+	mtx  sync.Mutex
+	file *os.File
+	size int64
+}
+
+func newFileSink(cfg FileConfig) (*fileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0o750); err != nil {
+		return nil, errors.Wrap(err, "create audit log directory")
+	}
+
+	s := &fileSink{cfg: cfg}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileSink) open() error {
+	file, err := os.OpenFile(s.cfg.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return errors.Wrap(err, "open audit log file")
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return errors.Wrap(err, "stat audit log file")
+	}
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+func (s *fileSink) rotatedPath(i int) string {
+	return fmt.Sprintf("%s.%d", s.cfg.Path, i)
+}
+
+// rotate moves the current file to <path>.1, shifting the rotated files and removing the oldest one.
+func (s *fileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return errors.Wrap(err, "close audit log file")
+	}
+
+	if s.cfg.MaxFiles == 0 {
+		if err := os.Remove(s.cfg.Path); err != nil {
+			return errors.Wrap(err, "remove audit log file")
+		}
+		return s.open()
+	}
+
+	if err := os.Remove(s.rotatedPath(s.cfg.MaxFiles)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "remove oldest audit log file")
+	}
+	for i := s.cfg.MaxFiles - 1; i >= 1; i-- {
+		if err := os.Rename(s.rotatedPath(i), s.rotatedPath(i+1)); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "rotate audit log file")
+		}
+	}
+	if err := os.Rename(s.cfg.Path, s.rotatedPath(1)); err != nil {
+		return errors.Wrap(err, "rotate audit log file")
+	}
+	return s.open()
+}
+
+func (s *fileSink) write(_ context.Context, events []Event) error {
+	data, err := encodeEvents(events)
+	if err != nil {
+		return err
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.file == nil {
+		// The previous rotation failed half-way.
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+	if s.size > 0 && s.size+int64(len(data)) > int64(s.cfg.MaxSizeBytes) {
+		if err := s.rotate(); err != nil {
+			s.file = nil
+			return err
+		}
+	}
+
+	n, err := s.file.Write(data)
+	s.size += int64(n)
+	if err != nil {
+		return errors.Wrap(err, "write audit log file")
+	}
+	return errors.Wrap(s.file.Sync(), "sync audit log file")
+}
+
+func (s *fileSink) scan(ctx context.Context, _, _ time.Time, fn func(Event)) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	// The rotated files are scanned from the oldest to the most recent one.
+	paths := make([]string, 0, s.cfg.MaxFiles+1)
+	for i := s.cfg.MaxFiles; i >= 1; i-- {
+		paths = append(paths, s.rotatedPath(i))
+	}
+	paths = append(paths, s.cfg.Path)
+
+	for _, p := range paths {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		file, err := os.Open(p)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return errors.Wrap(err, "open audit log file")
+		}
+		err = decodeEvents(file, fn)
+		_ = file.Close()
+		if err != nil {
+			return errors.Wrapf(err, "read audit log file %s", p)
+		}
+	}
+	return nil
+}
+
+func (s *fileSink) close() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// encodeEvents encodes the events as JSON lines.
+func encodeEvents(events []Event) ([]byte, error) {
+	buf := bytes.Buffer{}
+	enc := json.NewEncoder(&buf)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return nil, errors.Wrap(err, "encode audit log event")
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeEvents calls fn with the events of the JSON lines. The malformed lines, such as a line partially
+// written before a crash, are skipped.
+func decodeEvents(r io.Reader, fn func(Event)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		fn(e)
+	}
+	return scanner.Err()
+}
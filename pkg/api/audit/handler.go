@@ -0,0 +1,214 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package audit
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/gorilla/mux"
+	"github.com/grafana/dskit/middleware"
+	"github.com/grafana/dskit/tenant"
+	"github.com/grafana/dskit/user"
+
+	"github.com/grafana/mimir/pkg/util"
+)
+
+const (
+	defaultQueryLimit = 1000
+	maxQueryLimit     = 10000
+	defaultQueryRange = 24 * time.Hour
+	// maxQueryRange is the maximum time range of a query of the audit log.
+	maxQueryRange = 31 * 24 * time.Hour
+)
+
+type queryResponse struct {
+	Events []Event `json:"events"`
+}
+
+// isMutating returns whether the HTTP method changes state.
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// Wrap returns a handler recording in the audit log the requests to the endpoint which change state, that is with
+// a POST, PUT, PATCH or DELETE method. The source IPs of the requests are read with sourceIPs, if not nil.
+func (l *Logger) Wrap(endpoint string, sourceIPs *middleware.SourceIPExtractor, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isMutating(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		e := Event{
+			Timestamp:  start,
+			Actor:      l.actor(r),
+			Tenant:     requestTenant(r),
+			Method:     r.Method,
+			Endpoint:   endpoint,
+			Path:       r.URL.Path,
+			Parameters: requestParameters(r),
+			SourceIPs:  r.RemoteAddr,
+		}
+		if sourceIPs != nil {
+			e.SourceIPs = sourceIPs.Get(r)
+		}
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		e.StatusCode = rec.statusCode()
+		e.Outcome = OutcomeSuccess
+		if e.StatusCode >= http.StatusBadRequest {
+			e.Outcome = OutcomeFailure
+		}
+		e.DurationSeconds = time.Since(start).Seconds()
+		l.Record(e)
+	})
+}
+
+// actor returns the value of the first actor header set in the request.
+func (l *Logger) actor(r *http.Request) string {
+	for _, header := range l.cfg.ActorHeaders {
+		if v := r.Header.Get(header); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// requestTenant returns the tenant ID of the authenticated request, or the tenant the request applies to for the
+// admin endpoints, given either by the tenant path variable or by the tenant ID header.
+func requestTenant(r *http.Request) string {
+	if orgID, err := user.ExtractOrgID(r.Context()); err == nil {
+		return orgID
+	}
+	if v := mux.Vars(r)["tenant"]; v != "" {
+		return v
+	}
+	return r.Header.Get(user.OrgIDHeaderName)
+}
+
+// requestParameters returns the path variables and the query parameters. The request body isn't read, so that it's
+// left untouched for the handler.
+func requestParameters(r *http.Request) map[string][]string {
+	params := map[string][]string{}
+	for k, v := range mux.Vars(r) {
+		params[k] = []string{v}
+	}
+	for k, v := range r.URL.Query() {
+		params[k] = append(params[k], v...)
+	}
+
+	if len(params) == 0 {
+		return nil
+	}
+	return params
+}
+
+// statusRecorder is a http.ResponseWriter recording the status code of the response.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap allows http.ResponseController to access the wrapped http.ResponseWriter.
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *statusRecorder) statusCode() int {
+	if w.code == 0 {
+		return http.StatusOK
+	}
+	return w.code
+}
+
+// QueryHandler serves the API calls recorded between the start and end parameters, which default to the last 24 hours,
+// from the newest to the oldest. If the tenant parameter is set, only the API calls of the tenant are served. At most
+// limit API calls are served. With the file sink, only the API calls recorded by this instance are served.
+func (l *Logger) QueryHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID := r.Form.Get("tenant")
+	if userID != "" {
+		if err := tenant.ValidTenantID(userID); err != nil {
+			http.Error(w, fmt.Sprintf("invalid tenant: %s", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	end, err := parseQueryTime(r.Form.Get("end"), time.Now())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid end: %s", err), http.StatusBadRequest)
+		return
+	}
+	start, err := parseQueryTime(r.Form.Get("start"), end.Add(-defaultQueryRange))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid start: %s", err), http.StatusBadRequest)
+		return
+	}
+	if end.Before(start) {
+		http.Error(w, "end must not be before start", http.StatusBadRequest)
+		return
+	}
+	if end.Sub(start) > maxQueryRange {
+		http.Error(w, fmt.Sprintf("the query can't span more than %s", maxQueryRange), http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultQueryLimit
+	if v := r.Form.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 || limit > maxQueryLimit {
+			http.Error(w, fmt.Sprintf("invalid limit %q, it must be between 1 and %d", v, maxQueryLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	events, err := l.Query(r.Context(), userID, start, end, limit)
+	if err != nil {
+		level.Error(l.logger).Log("msg", "failed to query the audit log", "user", userID, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if events == nil {
+		events = []Event{}
+	}
+	util.WriteJSONResponse(w, queryResponse{Events: events})
+}
+
+func parseQueryTime(value string, defaultTime time.Time) (time.Time, error) {
+	if value == "" {
+		return defaultTime, nil
+	}
+	ms, err := util.ParseTime(value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return util.TimeFromMillis(ms), nil
+}
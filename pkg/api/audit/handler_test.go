@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/gorilla/mux"
+	"github.com/grafana/dskit/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+)
+
+func TestLogger_Handlers(t *testing.T) {
+	ctx := context.Background()
+	cfg := Config{FlushInterval: time.Minute, MaxBatchSize: 100, ActorHeaders: []string{"X-Grafana-User", "X-Forwarded-User"}}
+	l := newLogger(cfg, newBucketSink(objstore.NewInMemBucket()), log.NewNopLogger(), prometheus.NewPedanticRegistry())
+
+	router := mux.NewRouter()
+	deleteTenant := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+	router.Path("/compactor/delete_tenant").Methods(http.MethodPost).Handler(middleware.AuthenticateUser.Wrap(l.Wrap("/compactor/delete_tenant", nil, deleteTenant)))
+	ring := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("forget") == "" {
+			http.Error(w, "missing instance", http.StatusBadRequest)
+		}
+	})
+	router.Path("/ingester/ring").Methods(http.MethodGet, http.MethodPost).Handler(l.Wrap("/ingester/ring", nil, ring))
+	limits := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("{}"))
+	})
+	router.Path("/tenant_limits/{tenant}").Methods(http.MethodGet, http.MethodPut).Handler(l.Wrap("/tenant_limits/{tenant}", nil, limits))
+	router.Path("/audit_log").Methods(http.MethodGet).HandlerFunc(l.QueryHandler)
+
+	do := func(method, url string, header http.Header, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := do(http.MethodPost, "/compactor/delete_tenant", http.Header{"X-Scope-Orgid": {"user-1"}, "X-Forwarded-User": {"alice"}}, "")
+	require.Equal(t, http.StatusAccepted, resp.Code)
+
+	// The form parameters aren't recorded, and are still available to the handler.
+	form := url.Values{"forget": {"ingester-1"}}
+	resp = do(http.MethodPost, "/ingester/ring", http.Header{"Content-Type": {"application/x-www-form-urlencoded"}, "X-Grafana-User": {"bob"}}, form.Encode())
+	require.Equal(t, http.StatusOK, resp.Code)
+	resp = do(http.MethodPost, "/ingester/ring", nil, "")
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+
+	resp = do(http.MethodPut, "/tenant_limits/user-1?author=carol", nil, "ingestion_rate: 100")
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	// The requests which don't change state aren't recorded.
+	resp = do(http.MethodGet, "/tenant_limits/user-1", nil, "")
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	require.Len(t, l.pending, 4)
+	l.flush(ctx)
+
+	query := func(params string) []Event {
+		resp := do(http.MethodGet, "/audit_log?"+params, nil, "")
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		var result queryResponse
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &result))
+		return result.Events
+	}
+
+	events := query("tenant=user-1")
+	require.Len(t, events, 2)
+	assert.Equal(t, "/tenant_limits/{tenant}", events[0].Endpoint)
+	assert.Equal(t, "/tenant_limits/user-1", events[0].Path)
+	assert.Equal(t, http.MethodPut, events[0].Method)
+	assert.Equal(t, map[string][]string{"tenant": {"user-1"}, "author": {"carol"}}, events[0].Parameters)
+	assert.Equal(t, "/compactor/delete_tenant", events[1].Endpoint)
+	assert.Equal(t, "alice", events[1].Actor)
+	assert.Equal(t, "user-1", events[1].Tenant)
+	assert.Equal(t, http.StatusAccepted, events[1].StatusCode)
+	assert.Equal(t, OutcomeSuccess, events[1].Outcome)
+	assert.NotEmpty(t, events[1].SourceIPs)
+
+	assert.Len(t, query("tenant=user-1&limit=1"), 1)
+	assert.Empty(t, query("tenant=user-2"))
+	assert.Empty(t, query("tenant=user-1&end="+time.Now().Add(-time.Hour).Format(time.RFC3339)))
+
+	// The events of all the tenants, and the ones without tenant, are served when no tenant is given.
+	events = query("")
+	require.Len(t, events, 4)
+	ringEvents := events[1:3]
+	for _, e := range ringEvents {
+		assert.Equal(t, "/ingester/ring", e.Endpoint)
+		assert.Empty(t, e.Tenant)
+		if e.Outcome == OutcomeSuccess {
+			assert.Equal(t, "bob", e.Actor)
+			assert.Empty(t, e.Parameters)
+		} else {
+			assert.Equal(t, OutcomeFailure, e.Outcome)
+			assert.Equal(t, http.StatusBadRequest, e.StatusCode)
+		}
+	}
+
+	for name, params := range map[string]string{
+		"invalid tenant": "tenant=user$1",
+		"invalid start":  "tenant=user-1&start=yesterday",
+		"invalid range":  "tenant=user-1&start=2026-01-02T00:00:00Z&end=2026-01-01T00:00:00Z",
+		"too long range": "tenant=user-1&start=2026-01-01T00:00:00Z&end=2026-03-01T00:00:00Z",
+		"invalid limit":  "tenant=user-1&limit=0",
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp := do(http.MethodGet, "/audit_log?"+params, nil, "")
+			assert.Equal(t, http.StatusBadRequest, resp.Code, resp.Body.String())
+		})
+	}
+}
@@ -0,0 +1,242 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package audit
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/services"
+	"github.com/grafana/dskit/tenant"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/thanos-io/objstore"
+)
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+
+	// maxPendingBatches is the number of batches of API calls kept while the sink is failing. The oldest
+	// API calls are dropped above it.
+	maxPendingBatches = 10
+)
+
+// Event is an API call recorded in the audit log.
+type Event struct {
+	Timestamp time.Time `json:"timestamp"`
+	// Actor is who made the API call, read from the actor headers.
+	Actor string `json:"actor,omitempty"`
+	// Tenant is the tenant ID of the request, or the tenant the API call applies to.
+	Tenant string `json:"tenant,omitempty"`
+	Method string `json:"method"`
+	// Endpoint is the path template of the route, such as /tenant_limits/{tenant}.
+	Endpoint string `json:"endpoint"`
+	Path     string `json:"path"`
+	// Parameters holds the path variables and the query parameters of the request.
+	// The request body is never recorded.
+	Parameters      map[string][]string `json:"parameters,omitempty"`
+	SourceIPs       string              `json:"source_ips,omitempty"`
+	StatusCode      int                 `json:"status_code"`
+	Outcome         string              `json:"outcome"`
+	DurationSeconds float64             `json:"duration_seconds"`
+}
+
+// hasTenant returns whether the API call applies to the tenant.
+func (e Event) hasTenant(userID string) bool {
+	if e.Tenant == userID {
+		return true
+	}
+	tenants, err := tenant.TenantIDsFromOrgID(e.Tenant)
+	return err == nil && slices.Contains(tenants, userID)
+}
+
+// sink stores the audit log.
+type sink interface {
+	// write stores the events.
+	write(ctx context.Context, events []Event) error
+	// scan calls fn with the stored events which may be between start and end.
+	scan(ctx context.Context, start, end time.Time, fn func(Event)) error
+	close() error
+}
+
+// Logger records the API calls in the audit log. The API calls are written to the sink in batches, every flush
+// interval or when there are enough of them.
+type Logger struct {
+	services.Service
+
+	cfg    Config
+	sink   sink
+	logger log.Logger
+
+	mtx     sync.Mutex
+	pending []Event
+	stopped bool
+	flushCh chan struct{}
+
+	events        *prometheus.CounterVec
+	dropped       prometheus.Counter
+	flushFailures prometheus.Counter
+}
+
+// NewLogger creates a Logger writing to the sink of the config. The bucket is only used by the bucket sink.
+func NewLogger(cfg Config, bkt objstore.Bucket, logger log.Logger, reg prometheus.Registerer) (*Logger, error) {
+	var s sink
+	switch cfg.Sink {
+	case SinkFile:
+		var err error
+		if s, err = newFileSink(cfg.File); err != nil {
+			return nil, err
+		}
+	case SinkBucket:
+		s = newBucketSink(bkt)
+	default:
+		return nil, fmt.Errorf("%w: %q", errInvalidSink, cfg.Sink)
+	}
+	return newLogger(cfg, s, logger, reg), nil
+}
+
+func newLogger(cfg Config, s sink, logger log.Logger, reg prometheus.Registerer) *Logger {
+	l := &Logger{
+		cfg:     cfg,
+		sink:    s,
+		logger:  log.With(logger, "component", "audit-log"),
+		flushCh: make(chan struct{}, 1),
+
+		events: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_audit_log_events_total",
+			Help: "Total number of API calls recorded in the audit log.",
+		}, []string{"outcome"}),
+		dropped: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_audit_log_events_dropped_total",
+			Help: "Total number of API calls recorded in the audit log which have been dropped before being written to the sink.",
+		}),
+		flushFailures: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_audit_log_flush_failures_total",
+			Help: "Total number of failures writing the audit log to the sink.",
+		}),
+	}
+
+	l.Service = services.NewBasicService(nil, l.running, l.stopping)
+	return l
+}
+
+func (l *Logger) running(ctx context.Context) error {
+	ticker := time.NewTicker(l.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			l.flush(ctx)
+		case <-l.flushCh:
+			l.flush(ctx)
+		}
+	}
+}
+
+func (l *Logger) stopping(_ error) error {
+	l.mtx.Lock()
+	l.stopped = true
+	l.mtx.Unlock()
+
+	// Write the remaining API calls before stopping.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	l.flush(ctx)
+
+	l.mtx.Lock()
+	if len(l.pending) > 0 {
+		level.Warn(l.logger).Log("msg", "dropped audit log events which couldn't be written before stopping", "events", len(l.pending))
+		l.dropped.Add(float64(len(l.pending)))
+		l.pending = nil
+	}
+	l.mtx.Unlock()
+	return l.sink.close()
+}
+
+// Record records the API call in the audit log.
+func (l *Logger) Record(e Event) {
+	l.events.WithLabelValues(e.Outcome).Inc()
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if l.stopped {
+		level.Warn(l.logger).Log("msg", "dropped audit log event recorded after the audit log has stopped", "method", e.Method, "path", e.Path, "tenant", e.Tenant, "actor", e.Actor)
+		l.dropped.Inc()
+		return
+	}
+
+	l.pending = append(l.pending, e)
+	l.dropOldest()
+	if len(l.pending) >= l.cfg.MaxBatchSize {
+		select {
+		case l.flushCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// dropOldest drops the oldest pending API calls above maxPendingBatches batches. It must be called with the mutex held.
+func (l *Logger) dropOldest() {
+	if excess := len(l.pending) - maxPendingBatches*l.cfg.MaxBatchSize; excess > 0 {
+		l.dropped.Add(float64(excess))
+		l.pending = slices.Delete(l.pending, 0, excess)
+	}
+}
+
+// flush writes the pending API calls to the sink, in batches of at most MaxBatchSize. If a batch fails to be
+// written, it's retried at the next flush.
+func (l *Logger) flush(ctx context.Context) {
+	l.mtx.Lock()
+	pending := l.pending
+	l.pending = nil
+	l.mtx.Unlock()
+
+	for len(pending) > 0 {
+		batch := pending[:min(len(pending), l.cfg.MaxBatchSize)]
+		if err := l.sink.write(ctx, batch); err != nil {
+			level.Error(l.logger).Log("msg", "failed to write the audit log", "err", err)
+			l.flushFailures.Inc()
+
+			l.mtx.Lock()
+			l.pending = append(pending, l.pending...)
+			l.dropOldest()
+			l.mtx.Unlock()
+			return
+		}
+		pending = pending[len(batch):]
+	}
+}
+
+// Query returns the most recent API calls of the tenant written to the sink between start and end, from the newest
+// to the oldest. If the tenant is empty, the API calls of all the tenants and the ones not applying to any tenant,
+// such as the ring changes, are returned. At most limit API calls are returned.
+func (l *Logger) Query(ctx context.Context, userID string, start, end time.Time, limit int) ([]Event, error) {
+	var events []Event
+	err := l.sink.scan(ctx, start, end, func(e Event) {
+		if e.Timestamp.Before(start) || e.Timestamp.After(end) || (userID != "" && !e.hasTenant(userID)) {
+			return
+		}
+		events = append(events, e)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortStableFunc(events, func(a, b Event) int {
+		return b.Timestamp.Compare(a.Timestamp)
+	})
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
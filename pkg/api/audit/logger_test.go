@@ -0,0 +1,240 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package audit
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	tests := map[string]struct {
+		setup    func(cfg *Config)
+		expected error
+	}{
+		"default config": {
+			setup: func(*Config) {},
+		},
+		"disabled config isn't validated": {
+			setup: func(cfg *Config) {
+				cfg.Sink = "unknown"
+			},
+		},
+		"file sink": {
+			setup: func(cfg *Config) {
+				cfg.Enabled = true
+			},
+		},
+		"bucket sink": {
+			setup: func(cfg *Config) {
+				cfg.Enabled = true
+				cfg.Sink = SinkBucket
+				cfg.File.Path = ""
+			},
+		},
+		"unsupported sink": {
+			setup: func(cfg *Config) {
+				cfg.Enabled = true
+				cfg.Sink = "unknown"
+			},
+			expected: errInvalidSink,
+		},
+		"invalid flush interval": {
+			setup: func(cfg *Config) {
+				cfg.Enabled = true
+				cfg.FlushInterval = 0
+			},
+			expected: errInvalidFlushInterval,
+		},
+		"invalid max batch size": {
+			setup: func(cfg *Config) {
+				cfg.Enabled = true
+				cfg.MaxBatchSize = 0
+			},
+			expected: errInvalidMaxBatchSize,
+		},
+		"missing file path": {
+			setup: func(cfg *Config) {
+				cfg.Enabled = true
+				cfg.File.Path = ""
+			},
+			expected: errMissingFilePath,
+		},
+		"invalid file max size": {
+			setup: func(cfg *Config) {
+				cfg.Enabled = true
+				cfg.File.MaxSizeBytes = 0
+			},
+			expected: errInvalidFileMaxSize,
+		},
+		"invalid file max files": {
+			setup: func(cfg *Config) {
+				cfg.Enabled = true
+				cfg.File.MaxFiles = -1
+			},
+			expected: errInvalidFileMaxFiles,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := Config{}
+			flagext.DefaultValues(&cfg)
+			tc.setup(&cfg)
+			assert.Equal(t, tc.expected, cfg.Validate())
+		})
+	}
+}
+
+func newEvent(ts time.Time, tenant, endpoint string) Event {
+	return Event{Timestamp: ts, Tenant: tenant, Method: "POST", Endpoint: endpoint, Path: endpoint, StatusCode: 200, Outcome: OutcomeSuccess}
+}
+
+func TestLogger_Sinks(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	sinks := map[string]func(t *testing.T) sink{
+		SinkFile: func(t *testing.T) sink {
+			s, err := newFileSink(FileConfig{Path: filepath.Join(t.TempDir(), "audit", "audit.log"), MaxSizeBytes: 1 << 20, MaxFiles: 2})
+			require.NoError(t, err)
+			return s
+		},
+		SinkBucket: func(*testing.T) sink {
+			return newBucketSink(objstore.NewInMemBucket())
+		},
+	}
+
+	for name, newSink := range sinks {
+		t.Run(name, func(t *testing.T) {
+			cfg := Config{FlushInterval: time.Minute, MaxBatchSize: 2}
+			l := newLogger(cfg, newSink(t), log.NewNopLogger(), prometheus.NewPedanticRegistry())
+
+			// The events span two days.
+			l.Record(newEvent(now.Add(-25*time.Hour), "user-1", "/compactor/delete_tenant"))
+			l.Record(newEvent(now.Add(-time.Hour), "user-2", "/ruler/delete_tenant_config"))
+			l.Record(newEvent(now.Add(-time.Minute), "user-1", "/tenant_limits/{tenant}"))
+			l.Record(newEvent(now, "user-1|user-2", "/api/v1/upload/block/{block}/start"))
+			l.flush(ctx)
+
+			events, err := l.Query(ctx, "user-1", now.Add(-48*time.Hour), now, 10)
+			require.NoError(t, err)
+			require.Len(t, events, 3)
+			assert.Equal(t, "/api/v1/upload/block/{block}/start", events[0].Endpoint)
+			assert.Equal(t, "/tenant_limits/{tenant}", events[1].Endpoint)
+			assert.Equal(t, "/compactor/delete_tenant", events[2].Endpoint)
+			assert.True(t, now.Equal(events[0].Timestamp))
+
+			// The events are filtered by time range, and limited to the most recent ones.
+			events, err = l.Query(ctx, "user-1", now.Add(-2*time.Hour), now, 1)
+			require.NoError(t, err)
+			require.Len(t, events, 1)
+			assert.Equal(t, "/api/v1/upload/block/{block}/start", events[0].Endpoint)
+
+			events, err = l.Query(ctx, "user-2", now.Add(-2*time.Hour), now.Add(-time.Minute), 10)
+			require.NoError(t, err)
+			require.Len(t, events, 1)
+			assert.Equal(t, "/ruler/delete_tenant_config", events[0].Endpoint)
+
+			require.NoError(t, l.sink.close())
+		})
+	}
+}
+
+func TestFileSink_Rotation(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "audit.log")
+	now := time.Now()
+
+	event := newEvent(now, "user-1", "/compactor/delete_tenant")
+	data, err := encodeEvents([]Event{event})
+	require.NoError(t, err)
+
+	// Each file holds two events.
+	s, err := newFileSink(FileConfig{Path: path, MaxSizeBytes: 2 * len(data), MaxFiles: 2})
+	require.NoError(t, err)
+	for i := 0; i < 7; i++ {
+		require.NoError(t, s.write(ctx, []Event{event}))
+	}
+
+	for _, p := range []string{path, path + ".1", path + ".2"} {
+		require.FileExists(t, p)
+	}
+	assert.NoFileExists(t, path+".3")
+
+	count := 0
+	require.NoError(t, s.scan(ctx, now, now, func(Event) { count++ }))
+	assert.Equal(t, 5, count)
+
+	// The current file is appended to after a restart.
+	require.NoError(t, s.close())
+	s, err = newFileSink(FileConfig{Path: path, MaxSizeBytes: 2 * len(data), MaxFiles: 2})
+	require.NoError(t, err)
+	require.NoError(t, s.write(ctx, []Event{event}))
+	count = 0
+	require.NoError(t, s.scan(ctx, now, now, func(Event) { count++ }))
+	assert.Equal(t, 6, count)
+
+	// The malformed lines are skipped.
+	require.NoError(t, s.close())
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	require.NoError(t, err)
+	_, err = f.WriteString("{\"timestamp\":\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	count = 0
+	require.NoError(t, s.scan(ctx, now, now, func(Event) { count++ }))
+	assert.Equal(t, 6, count)
+}
+
+type failingSink struct {
+	sink
+	err error
+}
+
+func (s *failingSink) write(ctx context.Context, events []Event) error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.sink.write(ctx, events)
+}
+
+func TestLogger_FlushFailures(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	s := &failingSink{sink: newBucketSink(objstore.NewInMemBucket()), err: errors.New("unavailable")}
+	cfg := Config{FlushInterval: time.Minute, MaxBatchSize: 2}
+	l := newLogger(cfg, s, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+
+	// The events are kept while the sink is failing, up to maxPendingBatches batches.
+	for i := 0; i < maxPendingBatches*cfg.MaxBatchSize+3; i++ {
+		l.Record(newEvent(now.Add(time.Duration(i)*time.Millisecond), "user-1", "/ingester/shutdown"))
+	}
+	l.flush(ctx)
+	assert.Equal(t, float64(1), testutil.ToFloat64(l.flushFailures))
+	assert.Equal(t, float64(3), testutil.ToFloat64(l.dropped))
+	assert.Len(t, l.pending, maxPendingBatches*cfg.MaxBatchSize)
+
+	s.err = nil
+	l.flush(ctx)
+	assert.Empty(t, l.pending)
+
+	events, err := l.Query(ctx, "user-1", now, now.Add(time.Minute), 100)
+	require.NoError(t, err)
+	require.Len(t, events, maxPendingBatches*cfg.MaxBatchSize)
+	// The oldest events have been dropped.
+	assert.True(t, now.Add(3*time.Millisecond).Equal(events[len(events)-1].Timestamp))
+}
@@ -3,11 +3,16 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 
 	"github.com/grafana/dskit/middleware"
 	"github.com/grafana/dskit/tenant"
+	"github.com/grafana/dskit/user"
+
+	"github.com/grafana/mimir/pkg/querier/tenantfederation"
 )
 
 const (
@@ -44,3 +49,58 @@ func newTenantValidationMiddleware(federation bool, maxTenants int) middleware.I
 		})
 	})
 }
+
+// tenantSetsMiddleware expands tenant set references in the tenant IDs of a request, rewriting
+// the tenant ID on both the request context and the request header. The principal issuing the
+// request is read from principalHeader and injected into the request context. The principal header isn't
+// authenticated, so it must be set by a trusted proxy.
+// The middleware is a no-op until a tenantfederation.TenantSetsProvider is set.
+type tenantSetsMiddleware struct {
+	principalHeader string
+	provider        tenantfederation.TenantSetsProvider
+}
+
+func newTenantSetsMiddleware(principalHeader string) *tenantSetsMiddleware {
+	return &tenantSetsMiddleware{principalHeader: principalHeader}
+}
+
+func (m *tenantSetsMiddleware) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.provider == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := r.Context()
+
+		var principal string
+		if m.principalHeader != "" {
+			principal = r.Header.Get(m.principalHeader)
+			ctx = tenantfederation.InjectPrincipal(ctx, principal)
+		}
+
+		ids, err := tenant.TenantIDs(ctx)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		expanded, err := tenantfederation.ExpandTenantSets(ids, principal, m.provider)
+		switch {
+		case errors.Is(err, tenantfederation.ErrTenantSetNotAllowed):
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+
+		if !slices.Equal(expanded, ids) {
+			orgID := tenant.JoinTenantIDs(expanded)
+			ctx = user.InjectOrgID(ctx, orgID)
+			r.Header.Set(user.OrgIDHeaderName, orgID)
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
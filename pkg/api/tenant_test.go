@@ -13,6 +13,9 @@ import (
 	"github.com/grafana/dskit/tenant"
 	"github.com/grafana/dskit/user"
 	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/grafana/mimir/pkg/querier/tenantfederation"
 )
 
 func TestNewTenantValidationMiddleware(t *testing.T) {
@@ -111,3 +114,90 @@ func TestNewTenantValidationMiddleware(t *testing.T) {
 		})
 	}
 }
+
+type staticTenantSets map[string]*tenantfederation.TenantSet
+
+func (s staticTenantSets) TenantSets() map[string]*tenantfederation.TenantSet { return s }
+func (s staticTenantSets) KnownTenants() []string                             { return nil }
+
+func TestTenantSetsMiddleware(t *testing.T) {
+	var sets staticTenantSets
+	require.NoError(t, yaml.Unmarshal([]byte(`
+prod:
+  tenants: [prod-a, prod-b, prod-c]
+  allowed_principals: [sre]
+`), &sets))
+
+	for _, tc := range []struct {
+		name               string
+		header             string
+		principal          string
+		maxTenants         int
+		expectedHTTPStatus int
+		expectedBodyText   string
+		expectedOrgID      string
+	}{
+		{
+			name:               "no tenant set reference",
+			header:             "tenant-a|tenant-b",
+			expectedHTTPStatus: 200,
+			expectedOrgID:      "tenant-a|tenant-b",
+		},
+		{
+			name:               "tenant set reference",
+			header:             "tenant-a|set(prod)",
+			principal:          "sre",
+			expectedHTTPStatus: 200,
+			expectedOrgID:      "prod-a|prod-b|prod-c|tenant-a",
+		},
+		{
+			name:               "tenant set reference over max tenants limit",
+			header:             "set(prod)",
+			principal:          "sre",
+			maxTenants:         2,
+			expectedHTTPStatus: 422,
+			expectedBodyText:   "too many tenant IDs present",
+		},
+		{
+			name:               "principal not allowed",
+			header:             "set(prod)",
+			principal:          "dev",
+			expectedHTTPStatus: 403,
+			expectedBodyText:   "principal is not allowed to query tenant set",
+		},
+		{
+			name:               "unknown tenant set",
+			header:             "set(dev)",
+			expectedHTTPStatus: 422,
+			expectedBodyText:   "unknown tenant set",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var orgID, headerOrgID string
+			next := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				orgID, _ = user.ExtractOrgID(r.Context())
+				headerOrgID = r.Header.Get(user.OrgIDHeaderName)
+			})
+
+			tenantSets := newTenantSetsMiddleware("X-Principal")
+			tenantSets.provider = sets
+			handler := middleware.Merge(middleware.AuthenticateUser, tenantSets, newTenantValidationMiddleware(true, tc.maxTenants)).Wrap(next)
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set(user.OrgIDHeaderName, tc.header)
+			req.Header.Set("X-Principal", tc.principal)
+			resp := httptest.NewRecorder()
+
+			handler.ServeHTTP(resp, req)
+			require.Equal(t, tc.expectedHTTPStatus, resp.Code)
+
+			if tc.expectedBodyText != "" {
+				require.Contains(t, resp.Body.String(), tc.expectedBodyText)
+			}
+			if tc.expectedOrgID != "" {
+				require.Equal(t, tc.expectedOrgID, orgID)
+				require.Equal(t, tc.expectedOrgID, headerOrgID)
+			}
+		})
+	}
+}
@@ -49,6 +49,7 @@ type BlocksCleanerConfig struct {
 	GetDeletionMarkersConcurrency int
 	NoBlocksFileCleanupEnabled    bool
 	CompactionBlockRanges         mimir_tsdb.DurationList // Used for estimating compaction jobs.
+	TenantUsageRecorder           TenantUsageRecorder     // Optional, records the size of the blocks of each tenant.
 }
 
 type BlocksCleaner struct {
@@ -497,6 +498,9 @@ func (c *BlocksCleaner) cleanUser(ctx context.Context, userID string, userLogger
 	c.tenantMarkedBlocks.WithLabelValues(userID).Set(float64(len(idx.BlockDeletionMarks)))
 	c.tenantPartialBlocks.WithLabelValues(userID).Set(float64(len(partials)))
 	c.tenantBucketIndexLastUpdate.WithLabelValues(userID).Set(float64(idx.UpdatedAt))
+	if c.cfg.TenantUsageRecorder != nil {
+		c.cfg.TenantUsageRecorder.RecordTenantStorage(ctx, userID, idx.Blocks.SizeBytes())
+	}
 
 	// Compute pending compaction jobs based on current index.
 	jobs, err := estimateCompactionJobsFromBucketIndex(ctx, userID, userBucket, idx, c.cfg.CompactionBlockRanges, c.cfgProvider.CompactorSplitAndMergeShards(userID), c.cfgProvider.CompactorSplitGroups(userID))
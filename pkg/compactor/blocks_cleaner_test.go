@@ -6,8 +6,10 @@
 package compactor
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -1627,6 +1629,53 @@ func TestBlocksCleaner_instrumentBucketIndexUpdate(t *testing.T) {
 		"cortex_bucket_index_last_successful_update_timestamp_seconds"))
 }
 
+func TestBlocksCleaner_ShouldRecordTenantStorage(t *testing.T) {
+	ctx := context.Background()
+	bucketClient, _ := mimir_testutil.PrepareFilesystemBucket(t)
+	bucketClient = block.BucketWithGlobalMarkers(bucketClient)
+
+	// The size of the blocks is taken from the files listed in their meta.json.
+	uploadBlockWithFiles := func(userID string, files ...block.File) {
+		meta := block.Meta{
+			BlockMeta: prom_tsdb.BlockMeta{ULID: ulid.MustNew(ulid.Now(), rand.Reader), MinTime: 10, MaxTime: 20, Version: block.TSDBVersion1},
+			Thanos:    block.ThanosMeta{Version: block.ThanosVersion1, Files: files},
+		}
+		data, err := json.Marshal(meta)
+		require.NoError(t, err)
+		require.NoError(t, bucketClient.Upload(ctx, path.Join(userID, meta.ULID.String(), block.MetaFilename), bytes.NewReader(data)))
+	}
+	uploadBlockWithFiles("user-1", block.File{RelPath: "index", SizeBytes: 100}, block.File{RelPath: "chunks/000001", SizeBytes: 1000})
+	uploadBlockWithFiles("user-1", block.File{RelPath: "index", SizeBytes: 50})
+	uploadBlockWithFiles("user-2", block.File{RelPath: "index", SizeBytes: 10})
+
+	recorder := &mockTenantUsageRecorder{storedBytes: map[string]int64{}}
+	cfg := BlocksCleanerConfig{
+		DeletionDelay:                 time.Hour,
+		CleanupInterval:               time.Minute,
+		CleanupConcurrency:            1,
+		DeleteBlocksConcurrency:       1,
+		GetDeletionMarkersConcurrency: 1,
+		TenantUsageRecorder:           recorder,
+	}
+
+	cfgProvider := newMockConfigProvider()
+	cleaner := NewBlocksCleaner(cfg, bucketClient, tsdb.AllUsers, cfgProvider, log.NewNopLogger(), nil)
+	require.NoError(t, cleaner.runCleanupWithErr(ctx))
+
+	assert.Equal(t, map[string]int64{"user-1": 1150, "user-2": 10}, recorder.storedBytes)
+}
+
+type mockTenantUsageRecorder struct {
+	mtx         sync.Mutex
+	storedBytes map[string]int64
+}
+
+func (m *mockTenantUsageRecorder) RecordTenantStorage(_ context.Context, userID string, storedBytes int64) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.storedBytes[userID] = storedBytes
+}
+
 func tsOffset(dt time.Time, hours int) int64 {
 	return dt.Add(time.Duration(hours)*time.Hour).Unix() * 1000
 }
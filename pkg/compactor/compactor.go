@@ -131,6 +131,9 @@ type Config struct {
 	UploadSparseIndexHeaders       bool               `yaml:"upload_sparse_index_headers" category:"experimental"`
 	SparseIndexHeadersSamplingRate int                `yaml:"-"`
 	SparseIndexHeadersConfig       indexheader.Config `yaml:"-"`
+
+	// Allow to record the storage usage of the tenants, observed by the blocks cleaner.
+	TenantUsageRecorder TenantUsageRecorder `yaml:"-"`
 }
 
 // RegisterFlags registers the MultitenantCompactor flags.
@@ -206,6 +209,12 @@ func (cfg *Config) Validate(logger log.Logger) error {
 	return nil
 }
 
+// TenantUsageRecorder records the storage usage of the tenants.
+type TenantUsageRecorder interface {
+	// RecordTenantStorage records the size of the blocks of the tenant in the bucket.
+	RecordTenantStorage(ctx context.Context, userID string, storedBytes int64)
+}
+
 // ConfigProvider defines the per-tenant config provider for the MultitenantCompactor.
 type ConfigProvider interface {
 	bucket.TenantConfigProvider
@@ -540,6 +549,7 @@ func (c *MultitenantCompactor) starting(ctx context.Context) error {
 		GetDeletionMarkersConcurrency: defaultGetDeletionMarkersConcurrency,
 		NoBlocksFileCleanupEnabled:    c.compactorCfg.NoBlocksFileCleanupEnabled,
 		CompactionBlockRanges:         c.compactorCfg.BlockRanges,
+		TenantUsageRecorder:           c.compactorCfg.TenantUsageRecorder,
 	}, c.bucketClient, c.shardingStrategy.blocksCleanerOwnsUser, c.cfgProvider, c.parentLogger, c.registerer)
 
 	// Start blocks cleaner asynchronously, don't wait until initial cleanup is finished.
@@ -2,6 +2,13 @@
 
 package costattributionmodel
 
+import (
+	"fmt"
+	"slices"
+
+	"github.com/prometheus/common/model"
+)
+
 // Label represents a label for cost attribution.
 type Label struct {
 	// Input is the source label name that exists in the input metrics.
@@ -31,3 +38,38 @@ func ParseCostAttributionLabels(labelStrings []string) []Label {
 
 	return output
 }
+
+// QueryLabel represents a label the costs of the queries are attributed to.
+// The label value is taken either from a request header or from the matchers of the query.
+type QueryLabel struct {
+	// Output is the label name used at the output of the cost attribution.
+	Output string `yaml:"output" json:"output"`
+	// Header is the name of the request header the label value is taken from.
+	Header string `yaml:"header,omitempty" json:"header,omitempty"`
+	// Matcher is the name of the label whose equality matchers in the query the label value is taken from.
+	Matcher string `yaml:"matcher,omitempty" json:"matcher,omitempty"`
+}
+
+// ValidateQueryLabels returns an error if the query labels are invalid.
+func ValidateQueryLabels(labels []QueryLabel) error {
+	seen := make(map[string]struct{}, len(labels))
+	for _, l := range labels {
+		if !model.LabelName(l.Output).IsValid() {
+			return fmt.Errorf("invalid output label name %q", l.Output)
+		}
+		if slices.Contains(reservedOutputLabels, l.Output) {
+			return fmt.Errorf("reserved output label name %q", l.Output)
+		}
+		if _, ok := seen[l.Output]; ok {
+			return fmt.Errorf("duplicate output label name %q", l.Output)
+		}
+		seen[l.Output] = struct{}{}
+		if (l.Header == "") == (l.Matcher == "") {
+			return fmt.Errorf("exactly one of header and matcher must be set for output label %q", l.Output)
+		}
+	}
+	return nil
+}
+
+// reservedOutputLabels are the label names of the cost attribution metrics which can't be used as output labels.
+var reservedOutputLabels = []string{"tenant", "tracker"}
@@ -57,3 +57,46 @@ func TestLabel_OutputLabel(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateQueryLabels(t *testing.T) {
+	tc := map[string]struct {
+		input       []QueryLabel
+		expectedErr string
+	}{
+		"no labels": {},
+		"valid labels": {
+			input: []QueryLabel{{Output: "dashboard", Header: "X-Dashboard-Uid"}, {Output: "team", Matcher: "team"}},
+		},
+		"invalid output label": {
+			input:       []QueryLabel{{Header: "X-Dashboard-Uid"}},
+			expectedErr: `invalid output label name ""`,
+		},
+		"reserved output label": {
+			input:       []QueryLabel{{Output: "tenant", Matcher: "tenant"}},
+			expectedErr: `reserved output label name "tenant"`,
+		},
+		"duplicate output label": {
+			input:       []QueryLabel{{Output: "team", Header: "X-Team"}, {Output: "team", Matcher: "team"}},
+			expectedErr: `duplicate output label name "team"`,
+		},
+		"both header and matcher": {
+			input:       []QueryLabel{{Output: "team", Header: "X-Team", Matcher: "team"}},
+			expectedErr: `exactly one of header and matcher must be set for output label "team"`,
+		},
+		"neither header nor matcher": {
+			input:       []QueryLabel{{Output: "team"}},
+			expectedErr: `exactly one of header and matcher must be set for output label "team"`,
+		},
+	}
+
+	for name, tt := range tc {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateQueryLabels(tt.input)
+			if tt.expectedErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tt.expectedErr)
+			}
+		})
+	}
+}
@@ -36,6 +36,8 @@ type Manager struct {
 	sampleTrackerOverflowDesc          *prometheus.Desc
 	activeSeriesTrackerCardinalityDesc *prometheus.Desc
 	activeSeriesTrackerOverflowDesc    *prometheus.Desc
+	queryTrackerCardinalityDesc        *prometheus.Desc
+	queryTrackerOverflowDesc           *prometheus.Desc
 
 	inactiveTimeout time.Duration
 	cleanupInterval time.Duration
@@ -45,6 +47,9 @@ type Manager struct {
 
 	atmtx                  sync.RWMutex
 	activeTrackersByUserID map[string]*ActiveSeriesTracker
+
+	qtmtx                 sync.RWMutex
+	queryTrackersByUserID map[string]*QueryTracker
 }
 
 func NewManager(cleanupInterval, inactiveTimeout time.Duration, logger log.Logger, limits *validation.Overrides, reg, costAttributionReg prometheus.Registerer) (*Manager, error) {
@@ -55,6 +60,9 @@ func NewManager(cleanupInterval, inactiveTimeout time.Duration, logger log.Logge
 		atmtx:                  sync.RWMutex{},
 		activeTrackersByUserID: make(map[string]*ActiveSeriesTracker),
 
+		qtmtx:                 sync.RWMutex{},
+		queryTrackersByUserID: make(map[string]*QueryTracker),
+
 		sampleTrackerCardinalityDesc: prometheus.NewDesc("cortex_cost_attribution_sample_tracker_cardinality",
 			"The cardinality of a cost attribution sample tracker for each user.",
 			[]string{"user"},
@@ -75,6 +83,16 @@ func NewManager(cleanupInterval, inactiveTimeout time.Duration, logger log.Logge
 			[]string{"user"},
 			prometheus.Labels{trackerLabel: defaultTrackerName},
 		),
+		queryTrackerCardinalityDesc: prometheus.NewDesc("cortex_cost_attribution_query_tracker_cardinality",
+			"The cardinality of a cost attribution query tracker for each user.",
+			[]string{"user"},
+			prometheus.Labels{trackerLabel: defaultTrackerName},
+		),
+		queryTrackerOverflowDesc: prometheus.NewDesc("cortex_cost_attribution_query_tracker_overflown",
+			"This metric is exported with value 1 when a query tracker for a user is overflown. It's not exported otherwise.",
+			[]string{"user"},
+			prometheus.Labels{trackerLabel: defaultTrackerName},
+		),
 
 		limits:          limits,
 		inactiveTimeout: inactiveTimeout,
@@ -104,6 +122,14 @@ func (m *Manager) enabledForUser(userID string) bool {
 	return len(m.limits.CostAttributionLabels(userID)) > 0 || len(m.limits.CostAttributionLabelsStructured(userID)) > 0
 }
 
+func (m *Manager) queryEnabledForUser(userID string) bool {
+	if m == nil {
+		return false
+	}
+
+	return len(m.limits.CostAttributionQueryLabels(userID)) > 0
+}
+
 func (m *Manager) labels(userID string) []costattributionmodel.Label {
 	// We prefer the structured labels over the string labels, if provided.
 	if s := m.limits.CostAttributionLabelsStructured(userID); len(s) > 0 {
@@ -180,6 +206,46 @@ func (m *Manager) ActiveSeriesTracker(userID string) *ActiveSeriesTracker {
 	return tracker
 }
 
+// queryLabels returns the query labels of the user, sorted to ensure the order is consistent.
+func (m *Manager) queryLabels(userID string) []costattributionmodel.QueryLabel {
+	labels := slices.Clone(m.limits.CostAttributionQueryLabels(userID))
+	slices.SortFunc(labels, func(a, b costattributionmodel.QueryLabel) int {
+		return strings.Compare(a.Output, b.Output)
+	})
+	return labels
+}
+
+// QueryTracker returns the tracker of the query costs of the user, or nil if the query cost attribution
+// isn't enabled for the user.
+func (m *Manager) QueryTracker(userID string) *QueryTracker {
+	if !m.queryEnabledForUser(userID) {
+		return nil
+	}
+
+	// Check if the tracker already exists, if exists return it. Otherwise lock and create a new tracker.
+	m.qtmtx.RLock()
+	tracker, exists := m.queryTrackersByUserID[userID]
+	m.qtmtx.RUnlock()
+	if exists {
+		return tracker
+	}
+
+	// We need to create a new tracker, get all the necessary information from the limits before locking and creating the tracker.
+	labels := m.queryLabels(userID)
+	maxCardinality := m.limits.MaxCostAttributionCardinality(userID)
+	cooldownDuration := m.limits.CostAttributionCooldown(userID)
+
+	m.qtmtx.Lock()
+	defer m.qtmtx.Unlock()
+	if tracker, exists = m.queryTrackersByUserID[userID]; exists {
+		return tracker
+	}
+
+	tracker = newQueryTracker(userID, labels, maxCardinality, cooldownDuration, m.logger)
+	m.queryTrackersByUserID[userID] = tracker
+	return tracker
+}
+
 func (m *Manager) Collect(out chan<- prometheus.Metric) {
 	// Clone both maps to avoid holding the locks while collecting metrics.
 	m.stmtx.RLock()
@@ -190,6 +256,10 @@ func (m *Manager) Collect(out chan<- prometheus.Metric) {
 	activeTrackersByUserID := maps.Clone(m.activeTrackersByUserID)
 	m.atmtx.RUnlock()
 
+	m.qtmtx.RLock()
+	queryTrackersByUserID := maps.Clone(m.queryTrackersByUserID)
+	m.qtmtx.RUnlock()
+
 	for _, tracker := range sampleTrackersByUserID {
 		cardinality, overflown := tracker.cardinality()
 
@@ -227,6 +297,25 @@ func (m *Manager) Collect(out chan<- prometheus.Metric) {
 			)
 		}
 	}
+
+	for _, tracker := range queryTrackersByUserID {
+		cardinality, overflown := tracker.cardinality()
+
+		out <- prometheus.MustNewConstMetric(
+			m.queryTrackerCardinalityDesc,
+			prometheus.GaugeValue,
+			float64(cardinality),
+			tracker.userID,
+		)
+		if overflown {
+			out <- prometheus.MustNewConstMetric(
+				m.queryTrackerOverflowDesc,
+				prometheus.GaugeValue,
+				1,
+				tracker.userID,
+			)
+		}
+	}
 }
 
 func (m *Manager) Describe(chan<- *prometheus.Desc) {
@@ -244,6 +333,10 @@ func (m *Manager) collectCostAttribution(out chan<- prometheus.Metric) {
 	activeTrackersByUserID := maps.Clone(m.activeTrackersByUserID)
 	m.atmtx.RUnlock()
 
+	m.qtmtx.RLock()
+	queryTrackersByUserID := maps.Clone(m.queryTrackersByUserID)
+	m.qtmtx.RUnlock()
+
 	for _, tracker := range sampleTrackersByUserID {
 		tracker.collectCostAttribution(out)
 	}
@@ -251,6 +344,10 @@ func (m *Manager) collectCostAttribution(out chan<- prometheus.Metric) {
 	for _, tracker := range activeTrackersByUserID {
 		tracker.Collect(out)
 	}
+
+	for _, tracker := range queryTrackersByUserID {
+		tracker.collectCostAttribution(out)
+	}
 }
 
 func (m *Manager) describeCostAttribution(chan<- *prometheus.Desc) {
@@ -270,6 +367,12 @@ func (m *Manager) deleteActiveTracker(userID string) {
 	m.atmtx.Unlock()
 }
 
+func (m *Manager) deleteQueryTracker(userID string) {
+	m.qtmtx.Lock()
+	delete(m.queryTrackersByUserID, userID)
+	m.qtmtx.Unlock()
+}
+
 func (m *Manager) updateTracker(userID string) (*SampleTracker, *ActiveSeriesTracker) {
 	if !m.enabledForUser(userID) {
 		m.deleteSampleTracker(userID)
@@ -307,6 +410,28 @@ func (m *Manager) updateTracker(userID string) (*SampleTracker, *ActiveSeriesTra
 	return st, at
 }
 
+// updateQueryTracker recreates the query tracker of the user if its configuration has changed, and deletes it if
+// the query cost attribution has been disabled for the user.
+func (m *Manager) updateQueryTracker(userID string) *QueryTracker {
+	if !m.queryEnabledForUser(userID) {
+		m.deleteQueryTracker(userID)
+		return nil
+	}
+
+	qt := m.QueryTracker(userID)
+	labels := m.queryLabels(userID)
+	newMaxCardinality := m.limits.MaxCostAttributionCardinality(userID)
+	newCooldownDuration := m.limits.CostAttributionCooldown(userID)
+
+	if !qt.hasSameLabels(labels) || qt.maxCardinality != newMaxCardinality || qt.cooldownDuration != newCooldownDuration {
+		m.qtmtx.Lock()
+		qt = newQueryTracker(userID, labels, newMaxCardinality, newCooldownDuration, m.logger)
+		m.queryTrackersByUserID[userID] = qt
+		m.qtmtx.Unlock()
+	}
+	return qt
+}
+
 func (m *Manager) purgeInactiveAttributionsUntil(deadline time.Time) error {
 	m.stmtx.RLock()
 	userIDs := make([]string, 0, len(m.sampleTrackersByUserID))
@@ -337,6 +462,25 @@ func (m *Manager) purgeInactiveAttributionsUntil(deadline time.Time) error {
 			at.observedMtx.RUnlock()
 		}
 	}
+
+	m.qtmtx.RLock()
+	queryUserIDs := make([]string, 0, len(m.queryTrackersByUserID))
+	for userID := range m.queryTrackersByUserID {
+		queryUserIDs = append(queryUserIDs, userID)
+	}
+	m.qtmtx.RUnlock()
+
+	for _, userID := range queryUserIDs {
+		qt := m.updateQueryTracker(userID)
+		if qt == nil {
+			continue
+		}
+
+		qt.cleanupInactiveObservations(deadline)
+		if qt.recoveredFromOverflow(deadline) {
+			m.deleteQueryTracker(userID)
+		}
+	}
 	return nil
 }
 
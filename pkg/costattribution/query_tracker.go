@@ -0,0 +1,290 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package costattribution
+
+import (
+	"bytes"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/model/labels"
+	"go.uber.org/atomic"
+
+	"github.com/grafana/mimir/pkg/costattribution/costattributionmodel"
+)
+
+// QueryCosts are the costs of a query attributed by the QueryTracker.
+type QueryCosts struct {
+	FetchedSeries     uint64
+	FetchedChunkBytes uint64
+	SamplesProcessed  uint64
+	WallTime          time.Duration
+}
+
+type queryObservation struct {
+	lastUpdate        atomic.Int64
+	queries           atomic.Float64
+	fetchedSeries     atomic.Float64
+	fetchedChunkBytes atomic.Float64
+	samplesProcessed  atomic.Float64
+	wallTimeSeconds   atomic.Float64
+}
+
+func (o *queryObservation) add(costs QueryCosts) {
+	o.queries.Add(1)
+	o.fetchedSeries.Add(float64(costs.FetchedSeries))
+	o.fetchedChunkBytes.Add(float64(costs.FetchedChunkBytes))
+	o.samplesProcessed.Add(float64(costs.SamplesProcessed))
+	o.wallTimeSeconds.Add(costs.WallTime.Seconds())
+}
+
+// QueryTracker attributes the costs of the queries of a tenant to the values of the cost attribution labels
+// taken from the request headers or from the matchers of the queries.
+//
+// It's only used by the query-frontend, which receives the stats of the queriers executing each query: the
+// queriers don't attribute the costs themselves, otherwise the queries received through the query-frontend
+// would be counted twice. The queries sent to the queriers directly, bypassing the query-frontend, aren't
+// attributed.
+type QueryTracker struct {
+	userID string
+	logger log.Logger
+
+	queriesAttribution           *prometheus.Desc
+	fetchedSeriesAttribution     *prometheus.Desc
+	fetchedChunkBytesAttribution *prometheus.Desc
+	samplesProcessedAttribution  *prometheus.Desc
+	wallTimeAttribution          *prometheus.Desc
+
+	labels         []costattributionmodel.QueryLabel
+	overflowLabels []string
+
+	maxCardinality   int
+	cooldownDuration time.Duration
+
+	observedMtx   sync.RWMutex
+	observed      map[string]*queryObservation
+	overflowSince time.Time
+
+	overflowCounter queryObservation
+}
+
+func newQueryTracker(userID string, trackedLabels []costattributionmodel.QueryLabel, limit int, cooldown time.Duration, logger log.Logger) *QueryTracker {
+	// Create a map for overflow labels to export when overflow happens
+	overflowLabels := make([]string, len(trackedLabels)+1)
+	for i := range trackedLabels {
+		overflowLabels[i] = overflowValue
+	}
+	overflowLabels[len(trackedLabels)] = userID
+
+	tracker := &QueryTracker{
+		userID:           userID,
+		logger:           logger,
+		labels:           trackedLabels,
+		overflowLabels:   overflowLabels,
+		maxCardinality:   limit,
+		cooldownDuration: cooldown,
+		observed:         make(map[string]*queryObservation),
+	}
+
+	variableLabels := make([]string, 0, len(trackedLabels)+1)
+	for _, label := range trackedLabels {
+		variableLabels = append(variableLabels, label.Output)
+	}
+	variableLabels = append(variableLabels, tenantLabel)
+
+	constLabels := prometheus.Labels{trackerLabel: defaultTrackerName}
+	tracker.queriesAttribution = prometheus.NewDesc("cortex_query_frontend_attributed_queries_total",
+		"The total number of queries per attribution.",
+		variableLabels, constLabels)
+	tracker.fetchedSeriesAttribution = prometheus.NewDesc("cortex_query_frontend_attributed_fetched_series_total",
+		"The total number of series fetched to execute the queries per attribution.",
+		variableLabels, constLabels)
+	tracker.fetchedChunkBytesAttribution = prometheus.NewDesc("cortex_query_frontend_attributed_fetched_chunk_bytes_total",
+		"The total number of chunk bytes fetched to execute the queries per attribution.",
+		variableLabels, constLabels)
+	tracker.samplesProcessedAttribution = prometheus.NewDesc("cortex_query_frontend_attributed_samples_processed_total",
+		"The total number of samples processed to execute the queries per attribution.",
+		variableLabels, constLabels)
+	tracker.wallTimeAttribution = prometheus.NewDesc("cortex_query_frontend_attributed_querier_wall_time_seconds_total",
+		"The total wall clock time spent by the queriers processing the queries per attribution.",
+		variableLabels, constLabels)
+	return tracker
+}
+
+func (qt *QueryTracker) hasSameLabels(labels []costattributionmodel.QueryLabel) bool {
+	return slices.Equal(qt.labels, labels)
+}
+
+// UsesQueryMatchers returns whether the value of a label is taken from the matchers of the queries.
+func (qt *QueryTracker) UsesQueryMatchers() bool {
+	if qt == nil {
+		return false
+	}
+	for _, l := range qt.labels {
+		if l.Matcher != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// IncrementQueryCosts attributes the costs of a query to the values of the labels taken from the request header
+// and from the selectors of the query.
+func (qt *QueryTracker) IncrementQueryCosts(header http.Header, selectors [][]*labels.Matcher, costs QueryCosts, now time.Time) {
+	if qt == nil {
+		return
+	}
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer bufferPool.Put(buf)
+	qt.fillKey(header, selectors, buf)
+	qt.updateObservations(buf.String(), now, costs)
+}
+
+func (qt *QueryTracker) fillKey(header http.Header, selectors [][]*labels.Matcher, buf *bytes.Buffer) {
+	buf.Reset()
+	for idx, l := range qt.labels {
+		if idx > 0 {
+			buf.WriteRune(sep)
+		}
+		var value string
+		if l.Header != "" {
+			value = header.Get(l.Header)
+		} else {
+			value = matcherValue(selectors, l.Matcher)
+		}
+		// The values come from the requests, so drop the invalid UTF-8 and the separator, which would break the metrics.
+		value = strings.ReplaceAll(strings.ToValidUTF8(value, ""), string(sep), "")
+		if value == "" {
+			value = missingValue
+		}
+		buf.WriteString(value)
+	}
+}
+
+// matcherValue returns the value of the first equality matcher of the label in the selectors.
+func matcherValue(selectors [][]*labels.Matcher, name string) string {
+	for _, matchers := range selectors {
+		for _, m := range matchers {
+			if m.Name == name && m.Type == labels.MatchEqual && m.Value != "" {
+				return m.Value
+			}
+		}
+	}
+	return ""
+}
+
+// updateObservations updates or creates a new observation in the 'observed' map.
+func (qt *QueryTracker) updateObservations(key string, ts time.Time, costs QueryCosts) {
+	qt.observedMtx.RLock()
+	// overflowSince can only be set when holding the write lock, so checking it after taking the read lock
+	// doesn't miss any update.
+	if !qt.overflowSince.IsZero() {
+		qt.overflowCounter.add(costs)
+		qt.observedMtx.RUnlock()
+		return
+	}
+	if o, known := qt.observed[key]; known {
+		o.lastUpdate.Store(ts.Unix())
+		o.add(costs)
+		qt.observedMtx.RUnlock()
+		return
+	}
+	qt.observedMtx.RUnlock()
+
+	// If it is not known, we take the write lock, but still check whether the key is added in the meantime.
+	qt.observedMtx.Lock()
+	defer qt.observedMtx.Unlock()
+	if qt.overflowSince.IsZero() {
+		if o, known := qt.observed[key]; known {
+			o.lastUpdate.Store(ts.Unix())
+			o.add(costs)
+			return
+		}
+		if len(qt.observed) >= qt.maxCardinality {
+			qt.overflowSince = ts
+		}
+	}
+
+	if !qt.overflowSince.IsZero() {
+		qt.overflowCounter.add(costs)
+		return
+	}
+
+	o := &queryObservation{}
+	o.lastUpdate.Store(ts.Unix())
+	o.add(costs)
+	qt.observed[key] = o
+}
+
+func (qt *QueryTracker) collectCostAttribution(out chan<- prometheus.Metric) {
+	// We don't know the performance of out receiver, so we don't want to hold the lock for too long
+	var prometheusMetrics []prometheus.Metric
+	qt.observedMtx.RLock()
+
+	if !qt.overflowSince.IsZero() {
+		qt.observedMtx.RUnlock()
+		for _, m := range qt.observationMetrics(&qt.overflowCounter, qt.overflowLabels) {
+			out <- m
+		}
+		return
+	}
+
+	for key, o := range qt.observed {
+		keys := strings.Split(key, string(sep))
+		keys = append(keys, qt.userID)
+		prometheusMetrics = append(prometheusMetrics, qt.observationMetrics(o, keys)...)
+	}
+	qt.observedMtx.RUnlock()
+
+	for _, m := range prometheusMetrics {
+		out <- m
+	}
+}
+
+func (qt *QueryTracker) observationMetrics(o *queryObservation, labelValues []string) []prometheus.Metric {
+	return []prometheus.Metric{
+		prometheus.MustNewConstMetric(qt.queriesAttribution, prometheus.CounterValue, o.queries.Load(), labelValues...),
+		prometheus.MustNewConstMetric(qt.fetchedSeriesAttribution, prometheus.CounterValue, o.fetchedSeries.Load(), labelValues...),
+		prometheus.MustNewConstMetric(qt.fetchedChunkBytesAttribution, prometheus.CounterValue, o.fetchedChunkBytes.Load(), labelValues...),
+		prometheus.MustNewConstMetric(qt.samplesProcessedAttribution, prometheus.CounterValue, o.samplesProcessed.Load(), labelValues...),
+		prometheus.MustNewConstMetric(qt.wallTimeAttribution, prometheus.CounterValue, o.wallTimeSeconds.Load(), labelValues...),
+	}
+}
+
+func (qt *QueryTracker) recoveredFromOverflow(deadline time.Time) bool {
+	qt.observedMtx.Lock()
+	defer qt.observedMtx.Unlock()
+
+	if qt.overflowSince.IsZero() || !qt.overflowSince.Add(qt.cooldownDuration).Before(deadline) {
+		return false
+	}
+	if len(qt.observed) < qt.maxCardinality {
+		return true
+	}
+	// Increase the cooldown duration if the number of observations is still above the max cardinality
+	qt.overflowSince = deadline
+	return false
+}
+
+func (qt *QueryTracker) cleanupInactiveObservations(deadline time.Time) {
+	qt.observedMtx.Lock()
+	defer qt.observedMtx.Unlock()
+
+	for key, o := range qt.observed {
+		if o.lastUpdate.Load() <= deadline.Unix() {
+			delete(qt.observed, key)
+		}
+	}
+}
+
+func (qt *QueryTracker) cardinality() (cardinality int, overflown bool) {
+	qt.observedMtx.RLock()
+	defer qt.observedMtx.RUnlock()
+	return len(qt.observed), !qt.overflowSince.IsZero()
+}
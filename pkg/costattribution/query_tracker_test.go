@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package costattribution
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryTracker_IncrementQueryCosts(t *testing.T) {
+	manager, _, costAttributionReg := newTestManager()
+	require.Nil(t, manager.QueryTracker("user1"))
+
+	qt := manager.QueryTracker("user7")
+	require.NotNil(t, qt)
+	assert.True(t, qt.UsesQueryMatchers())
+
+	header := http.Header{}
+	header.Set("X-Dashboard-Uid", "abc")
+	selectors := [][]*labels.Matcher{
+		{labels.MustNewMatcher(labels.MatchRegexp, "team", "ignored.*"), labels.MustNewMatcher(labels.MatchEqual, "__name__", "up")},
+		{labels.MustNewMatcher(labels.MatchEqual, "team", "foo")},
+	}
+	costs := QueryCosts{FetchedSeries: 10, FetchedChunkBytes: 1000, SamplesProcessed: 100, WallTime: 2 * time.Second}
+	qt.IncrementQueryCosts(header, selectors, costs, time.Unix(10, 0))
+	qt.IncrementQueryCosts(header, selectors, costs, time.Unix(11, 0))
+	// The values missing from the request and the invalid values are attributed to __missing__.
+	qt.IncrementQueryCosts(http.Header{"X-Dashboard-Uid": []string{"\xff"}}, nil, costs, time.Unix(12, 0))
+
+	expectedMetrics := `
+	# HELP cortex_query_frontend_attributed_fetched_chunk_bytes_total The total number of chunk bytes fetched to execute the queries per attribution.
+	# TYPE cortex_query_frontend_attributed_fetched_chunk_bytes_total counter
+	cortex_query_frontend_attributed_fetched_chunk_bytes_total{dashboard="abc",team="foo",tenant="user7",tracker="cost-attribution"} 2000
+	cortex_query_frontend_attributed_fetched_chunk_bytes_total{dashboard="__missing__",team="__missing__",tenant="user7",tracker="cost-attribution"} 1000
+	# HELP cortex_query_frontend_attributed_fetched_series_total The total number of series fetched to execute the queries per attribution.
+	# TYPE cortex_query_frontend_attributed_fetched_series_total counter
+	cortex_query_frontend_attributed_fetched_series_total{dashboard="abc",team="foo",tenant="user7",tracker="cost-attribution"} 20
+	cortex_query_frontend_attributed_fetched_series_total{dashboard="__missing__",team="__missing__",tenant="user7",tracker="cost-attribution"} 10
+	# HELP cortex_query_frontend_attributed_querier_wall_time_seconds_total The total wall clock time spent by the queriers processing the queries per attribution.
+	# TYPE cortex_query_frontend_attributed_querier_wall_time_seconds_total counter
+	cortex_query_frontend_attributed_querier_wall_time_seconds_total{dashboard="abc",team="foo",tenant="user7",tracker="cost-attribution"} 4
+	cortex_query_frontend_attributed_querier_wall_time_seconds_total{dashboard="__missing__",team="__missing__",tenant="user7",tracker="cost-attribution"} 2
+	# HELP cortex_query_frontend_attributed_queries_total The total number of queries per attribution.
+	# TYPE cortex_query_frontend_attributed_queries_total counter
+	cortex_query_frontend_attributed_queries_total{dashboard="abc",team="foo",tenant="user7",tracker="cost-attribution"} 2
+	cortex_query_frontend_attributed_queries_total{dashboard="__missing__",team="__missing__",tenant="user7",tracker="cost-attribution"} 1
+	# HELP cortex_query_frontend_attributed_samples_processed_total The total number of samples processed to execute the queries per attribution.
+	# TYPE cortex_query_frontend_attributed_samples_processed_total counter
+	cortex_query_frontend_attributed_samples_processed_total{dashboard="abc",team="foo",tenant="user7",tracker="cost-attribution"} 200
+	cortex_query_frontend_attributed_samples_processed_total{dashboard="__missing__",team="__missing__",tenant="user7",tracker="cost-attribution"} 100
+	`
+	assert.NoError(t, testutil.GatherAndCompare(costAttributionReg, strings.NewReader(expectedMetrics),
+		"cortex_query_frontend_attributed_queries_total",
+		"cortex_query_frontend_attributed_fetched_series_total",
+		"cortex_query_frontend_attributed_fetched_chunk_bytes_total",
+		"cortex_query_frontend_attributed_samples_processed_total",
+		"cortex_query_frontend_attributed_querier_wall_time_seconds_total",
+	))
+}
+
+func TestQueryTracker_Overflow(t *testing.T) {
+	manager, reg, costAttributionReg := newTestManager()
+	qt := manager.QueryTracker("user7")
+
+	costs := QueryCosts{FetchedSeries: 1}
+	for _, dashboard := range []string{"a", "b", "c", "a"} {
+		qt.IncrementQueryCosts(http.Header{"X-Dashboard-Uid": []string{dashboard}}, nil, costs, time.Unix(10, 0))
+	}
+
+	// The costs after the overflow are attributed to __overflow__.
+	expectedMetrics := `
+	# HELP cortex_query_frontend_attributed_fetched_series_total The total number of series fetched to execute the queries per attribution.
+	# TYPE cortex_query_frontend_attributed_fetched_series_total counter
+	cortex_query_frontend_attributed_fetched_series_total{dashboard="__overflow__",team="__overflow__",tenant="user7",tracker="cost-attribution"} 2
+	`
+	assert.NoError(t, testutil.GatherAndCompare(costAttributionReg, strings.NewReader(expectedMetrics), "cortex_query_frontend_attributed_fetched_series_total"))
+
+	expectedMetrics = `
+	# HELP cortex_cost_attribution_query_tracker_cardinality The cardinality of a cost attribution query tracker for each user.
+	# TYPE cortex_cost_attribution_query_tracker_cardinality gauge
+	cortex_cost_attribution_query_tracker_cardinality{tracker="cost-attribution",user="user7"} 2
+	# HELP cortex_cost_attribution_query_tracker_overflown This metric is exported with value 1 when a query tracker for a user is overflown. It's not exported otherwise.
+	# TYPE cortex_cost_attribution_query_tracker_overflown gauge
+	cortex_cost_attribution_query_tracker_overflown{tracker="cost-attribution",user="user7"} 1
+	`
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expectedMetrics), "cortex_cost_attribution_query_tracker_cardinality", "cortex_cost_attribution_query_tracker_overflown"))
+
+	// The tracker is deleted once the observations are inactive and the cooldown has elapsed.
+	require.NoError(t, manager.purgeInactiveAttributionsUntil(time.Unix(20, 0)))
+	assert.NoError(t, testutil.GatherAndCompare(costAttributionReg, strings.NewReader(""), "cortex_query_frontend_attributed_fetched_series_total"))
+	assert.NotSame(t, qt, manager.QueryTracker("user7"))
+}
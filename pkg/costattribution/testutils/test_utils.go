@@ -17,6 +17,8 @@ func NewMockCostAttributionLimits(idx int, lvs ...string) *validation.Overrides
 		"user5": {MaxCostAttributionCardinality: 10, CostAttributionLabels: []string{"a"}},
 		// user6 has opted to rename team to eng_team.
 		"user6": {MaxCostAttributionCardinality: 5, CostAttributionLabelsStructured: []costattributionmodel.Label{{Input: "team", Output: "eng_team"}}},
+		// user7 only attributes the costs of the queries, to the dashboard header and to the team matchers.
+		"user7": {MaxCostAttributionCardinality: 2, CostAttributionQueryLabels: []costattributionmodel.QueryLabel{{Output: "team", Matcher: "team"}, {Output: "dashboard", Header: "X-Dashboard-Uid"}}},
 	}
 	if len(lvs) > 0 {
 		baseLimits[lvs[0]] = &validation.Limits{
@@ -0,0 +1,237 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/util/convertnhcb"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util"
+)
+
+// classicHistogram groups the indexes of the series of a classic histogram within a write request.
+type classicHistogram struct {
+	name     string
+	countIdx int
+	sumIdx   int
+	buckets  []classicHistogramBucket
+	// invalid is set when the series of the histogram can't be grouped unambiguously, for example because a series
+	// is duplicated or a bucket has an invalid le label.
+	invalid bool
+}
+
+type classicHistogramBucket struct {
+	le  float64
+	idx int
+}
+
+// convertClassicHistogramsToNHCB replaces the _bucket, _sum and _count float series of the classic histograms of
+// the request by native histograms with custom buckets. The series of a histogram are identified by the histogram
+// type of their metric metadata when available, or by their naming otherwise. A histogram is converted only if the
+// request carries its _sum and _count series and all its buckets, including the +Inf one, with samples at the same
+// timestamps: the series of the other histograms are left unchanged.
+// It returns the number of converted histograms and the number of histograms left unchanged.
+func convertClassicHistogramsToNHCB(req *mimirpb.WriteRequest) (converted, notConverted int) {
+	metricTypes := make(map[string]mimirpb.MetricMetadata_MetricType, len(req.Metadata))
+	for _, m := range req.Metadata {
+		if m != nil {
+			metricTypes[m.MetricFamilyName] = m.Type
+		}
+	}
+
+	var (
+		histograms []*classicHistogram
+		byKey      map[string]*classicHistogram
+		keyBuilder strings.Builder
+	)
+
+	for idx, ts := range req.Timeseries {
+		if len(ts.Samples) == 0 || len(ts.Histograms) > 0 {
+			continue
+		}
+
+		name, le, hasLe := classicHistogramSeriesLabels(ts.Labels)
+		suffix, baseName := convertnhcb.GetHistogramMetricBaseName(name)
+		if suffix == convertnhcb.SuffixNone {
+			continue
+		}
+		if t, ok := metricTypes[name]; ok && t != mimirpb.HISTOGRAM {
+			// The series is a metric family of its own, such as a counter named after the _count suffix.
+			continue
+		}
+		if t, ok := metricTypes[baseName]; ok && t != mimirpb.HISTOGRAM {
+			continue
+		}
+
+		keyBuilder.Reset()
+		keyBuilder.WriteString(baseName)
+		for _, l := range ts.Labels {
+			if l.Name == labels.MetricName || (suffix == convertnhcb.SuffixBucket && l.Name == labels.BucketLabel) {
+				continue
+			}
+			keyBuilder.WriteByte(0xff)
+			keyBuilder.WriteString(l.Name)
+			keyBuilder.WriteByte(0xff)
+			keyBuilder.WriteString(l.Value)
+		}
+
+		if byKey == nil {
+			byKey = map[string]*classicHistogram{}
+		}
+		h, ok := byKey[keyBuilder.String()]
+		if !ok {
+			h = &classicHistogram{name: baseName, countIdx: -1, sumIdx: -1}
+			byKey[keyBuilder.String()] = h
+			histograms = append(histograms, h)
+		}
+
+		switch suffix {
+		case convertnhcb.SuffixBucket:
+			bound, err := strconv.ParseFloat(le, 64)
+			if !hasLe || err != nil {
+				h.invalid = true
+				continue
+			}
+			h.buckets = append(h.buckets, classicHistogramBucket{le: bound, idx: idx})
+		case convertnhcb.SuffixSum:
+			h.invalid = h.invalid || h.sumIdx >= 0
+			h.sumIdx = idx
+		case convertnhcb.SuffixCount:
+			h.invalid = h.invalid || h.countIdx >= 0
+			h.countIdx = idx
+		}
+	}
+
+	var removeTsIndexes []int
+	for _, h := range histograms {
+		isHistogram := len(h.buckets) > 0 || metricTypes[h.name] == mimirpb.HISTOGRAM
+		if !isHistogram {
+			// Series named after the suffixes of the classic histograms, without buckets nor histogram metadata.
+			continue
+		}
+
+		nhcbs, ok := classicHistogramToNHCB(req.Timeseries, h)
+		if !ok {
+			notConverted++
+			continue
+		}
+
+		// The _count series is reused as the native histogram series, the other ones are removed from the request.
+		out := &req.Timeseries[h.countIdx]
+		for i := range out.Labels {
+			if out.Labels[i].Name == labels.MetricName {
+				out.Labels[i].Value = h.name
+			}
+		}
+		out.Samples = out.Samples[:0]
+		out.Histograms = append(out.Histograms[:0], nhcbs...)
+
+		removeTsIndexes = append(removeTsIndexes, h.sumIdx)
+		for _, b := range h.buckets {
+			for _, e := range req.Timeseries[b.idx].Exemplars {
+				// The labels are copied, because they're cleared when the bucket series is returned to the pool.
+				e.Labels = slices.Clone(e.Labels)
+				out.Exemplars = append(out.Exemplars, e)
+			}
+			removeTsIndexes = append(removeTsIndexes, b.idx)
+		}
+		sort.SliceStable(out.Exemplars, func(i, j int) bool {
+			return out.Exemplars[i].TimestampMs < out.Exemplars[j].TimestampMs
+		})
+		out.SamplesUpdated()
+		out.HistogramsUpdated()
+		converted++
+	}
+
+	if len(removeTsIndexes) > 0 {
+		slices.Sort(removeTsIndexes)
+		for _, removeTsIndex := range removeTsIndexes {
+			mimirpb.ReusePreallocTimeseries(&req.Timeseries[removeTsIndex])
+		}
+		req.Timeseries = util.RemoveSliceIndexes(req.Timeseries, removeTsIndexes)
+	}
+
+	return converted, notConverted
+}
+
+// classicHistogramToNHCB returns the native histogram samples of the classic histogram, or false if its series
+// are incomplete or inconsistent.
+func classicHistogramToNHCB(timeseries []mimirpb.PreallocTimeseries, h *classicHistogram) ([]mimirpb.Histogram, bool) {
+	if h.invalid || h.countIdx < 0 || h.sumIdx < 0 || len(h.buckets) == 0 {
+		return nil, false
+	}
+
+	sort.Slice(h.buckets, func(i, j int) bool { return h.buckets[i].le < h.buckets[j].le })
+	if !math.IsInf(h.buckets[len(h.buckets)-1].le, 1) {
+		return nil, false
+	}
+
+	count := timeseries[h.countIdx].Samples
+	sameTimestamps := func(samples []mimirpb.Sample) bool {
+		if len(samples) != len(count) {
+			return false
+		}
+		for i := range samples {
+			// Staleness markers are kept on the classic histogram series.
+			if samples[i].TimestampMs != count[i].TimestampMs || value.IsStaleNaN(samples[i].Value) || value.IsStaleNaN(count[i].Value) {
+				return false
+			}
+		}
+		return true
+	}
+	if !sameTimestamps(timeseries[h.sumIdx].Samples) {
+		return nil, false
+	}
+	for i, b := range h.buckets {
+		if i > 0 && b.le == h.buckets[i-1].le {
+			// Duplicated bucket.
+			return nil, false
+		}
+		if !sameTimestamps(timeseries[b.idx].Samples) {
+			return nil, false
+		}
+	}
+
+	nhcbs := make([]mimirpb.Histogram, 0, len(count))
+	temp := convertnhcb.NewTempHistogram()
+	for i, s := range count {
+		temp.Reset()
+		for _, b := range h.buckets {
+			_ = temp.SetBucketCount(b.le, timeseries[b.idx].Samples[i].Value)
+		}
+		_ = temp.SetCount(s.Value)
+		_ = temp.SetSum(timeseries[h.sumIdx].Samples[i].Value)
+
+		ih, fh, err := temp.Convert()
+		if err != nil {
+			return nil, false
+		}
+		if ih != nil {
+			nhcbs = append(nhcbs, mimirpb.FromHistogramToHistogramProto(s.TimestampMs, ih))
+		} else {
+			nhcbs = append(nhcbs, mimirpb.FromFloatHistogramToHistogramProto(s.TimestampMs, fh))
+		}
+	}
+	return nhcbs, true
+}
+
+// classicHistogramSeriesLabels returns the metric name and the le label of the series.
+func classicHistogramSeriesLabels(lbls []mimirpb.LabelAdapter) (name, le string, hasLe bool) {
+	for _, l := range lbls {
+		switch l.Name {
+		case labels.MetricName:
+			name = l.Value
+		case labels.BucketLabel:
+			le, hasLe = l.Value, true
+		}
+	}
+	return name, le, hasLe
+}
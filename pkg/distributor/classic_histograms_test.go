@@ -0,0 +1,182 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"math"
+	"testing"
+
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+)
+
+func TestConvertClassicHistogramsToNHCB(t *testing.T) {
+	const ts = int64(1000)
+
+	classicHistogram := func(name string, extraLabels ...string) []mimirpb.PreallocTimeseries {
+		lbls := func(metricName string, l ...string) []string {
+			return append(append([]string{"__name__", metricName}, extraLabels...), l...)
+		}
+		return []mimirpb.PreallocTimeseries{
+			makeTimeseries(lbls(name+"_bucket", "le", "1"), makeSamples(ts, 1), nil, nil),
+			makeTimeseries(lbls(name+"_bucket", "le", "2"), makeSamples(ts, 3), nil, makeExemplars([]string{"trace_id", "abc"}, ts, 1.5)),
+			makeTimeseries(lbls(name+"_bucket", "le", "+Inf"), makeSamples(ts, 4), nil, nil),
+			makeTimeseries(lbls(name+"_sum"), makeSamples(ts, 5), nil, nil),
+			makeTimeseries(lbls(name+"_count"), makeSamples(ts, 4), nil, nil),
+		}
+	}
+	expectedNHCB := func(name string, extraLabels ...string) mimirpb.PreallocTimeseries {
+		return makeTimeseries(append([]string{"__name__", name}, extraLabels...), []mimirpb.Sample{}, makeHistograms(ts, &histogram.Histogram{
+			Schema:          histogram.CustomBucketsSchema,
+			Count:           4,
+			Sum:             5,
+			PositiveSpans:   []histogram.Span{{Offset: 0, Length: 3}},
+			PositiveBuckets: []int64{1, 1, -1},
+			CustomValues:    []float64{1, 2},
+		}), makeExemplars([]string{"trace_id", "abc"}, ts, 1.5))
+	}
+	histogramMetadata := func(name string) *mimirpb.MetricMetadata {
+		return &mimirpb.MetricMetadata{MetricFamilyName: name, Type: mimirpb.HISTOGRAM}
+	}
+	otherSeries := makeTimeseries([]string{"__name__", "up", "job", "test"}, makeSamples(ts, 1), nil, nil)
+
+	tests := map[string]struct {
+		timeseries           []mimirpb.PreallocTimeseries
+		metadata             []*mimirpb.MetricMetadata
+		expectedTimeseries   []mimirpb.PreallocTimeseries
+		expectedConverted    int
+		expectedNotConverted int
+	}{
+		"should convert a classic histogram with histogram metadata": {
+			timeseries:         append(classicHistogram("latency", "job", "test"), otherSeries),
+			metadata:           []*mimirpb.MetricMetadata{histogramMetadata("latency")},
+			expectedTimeseries: []mimirpb.PreallocTimeseries{expectedNHCB("latency", "job", "test"), otherSeries},
+			expectedConverted:  1,
+		},
+		"should convert a classic histogram identified by its naming": {
+			timeseries:         append([]mimirpb.PreallocTimeseries{otherSeries}, classicHistogram("latency", "job", "test")...),
+			expectedTimeseries: []mimirpb.PreallocTimeseries{otherSeries, expectedNHCB("latency", "job", "test")},
+			expectedConverted:  1,
+		},
+		"should convert each classic histogram separately": {
+			timeseries:         append(classicHistogram("latency", "job", "a"), classicHistogram("latency", "job", "b")...),
+			expectedTimeseries: []mimirpb.PreallocTimeseries{expectedNHCB("latency", "job", "a"), expectedNHCB("latency", "job", "b")},
+			expectedConverted:  2,
+		},
+		"should convert non-integer counts into a float histogram": {
+			timeseries: []mimirpb.PreallocTimeseries{
+				makeTimeseries([]string{"__name__", "latency_bucket", "le", "1"}, makeSamples(ts, 0.5), nil, nil),
+				makeTimeseries([]string{"__name__", "latency_bucket", "le", "+Inf"}, makeSamples(ts, 1.5), nil, nil),
+				makeTimeseries([]string{"__name__", "latency_sum"}, makeSamples(ts, 2), nil, nil),
+				makeTimeseries([]string{"__name__", "latency_count"}, makeSamples(ts, 1.5), nil, nil),
+			},
+			expectedTimeseries: []mimirpb.PreallocTimeseries{
+				makeTimeseries([]string{"__name__", "latency"}, []mimirpb.Sample{}, makeFloatHistograms(ts, &histogram.FloatHistogram{
+					Schema:          histogram.CustomBucketsSchema,
+					Count:           1.5,
+					Sum:             2,
+					PositiveSpans:   []histogram.Span{{Offset: 0, Length: 2}},
+					PositiveBuckets: []float64{0.5, 1},
+					CustomValues:    []float64{1},
+				}), nil),
+			},
+			expectedConverted: 1,
+		},
+		"should not convert a classic histogram without the +Inf bucket": {
+			timeseries:           classicHistogram("latency")[1:2],
+			expectedTimeseries:   classicHistogram("latency")[1:2],
+			expectedNotConverted: 1,
+		},
+		"should not convert a classic histogram without the _sum series": {
+			timeseries:           append(classicHistogram("latency")[:3], classicHistogram("latency")[4]),
+			expectedTimeseries:   append(classicHistogram("latency")[:3], classicHistogram("latency")[4]),
+			expectedNotConverted: 1,
+		},
+		"should not convert a classic histogram with histogram metadata but without buckets": {
+			timeseries:           classicHistogram("latency")[3:],
+			metadata:             []*mimirpb.MetricMetadata{histogramMetadata("latency")},
+			expectedTimeseries:   classicHistogram("latency")[3:],
+			expectedNotConverted: 1,
+		},
+		"should not convert a classic histogram whose series have different timestamps": {
+			timeseries: func() []mimirpb.PreallocTimeseries {
+				series := classicHistogram("latency")
+				series[0].Samples = makeSamples(ts+1, 1)
+				return series
+			}(),
+			expectedTimeseries: func() []mimirpb.PreallocTimeseries {
+				series := classicHistogram("latency")
+				series[0].Samples = makeSamples(ts+1, 1)
+				return series
+			}(),
+			expectedNotConverted: 1,
+		},
+		"should not convert a classic histogram whose buckets aren't cumulative": {
+			timeseries: func() []mimirpb.PreallocTimeseries {
+				series := classicHistogram("latency")
+				series[1].Samples = makeSamples(ts, 0)
+				return series
+			}(),
+			expectedTimeseries: func() []mimirpb.PreallocTimeseries {
+				series := classicHistogram("latency")
+				series[1].Samples = makeSamples(ts, 0)
+				return series
+			}(),
+			expectedNotConverted: 1,
+		},
+		"should not convert a classic histogram with staleness markers": {
+			timeseries: func() []mimirpb.PreallocTimeseries {
+				series := classicHistogram("latency")
+				series[4].Samples = makeSamples(ts, math.Float64frombits(value.StaleNaN))
+				return series
+			}(),
+			expectedTimeseries: func() []mimirpb.PreallocTimeseries {
+				series := classicHistogram("latency")
+				series[4].Samples = makeSamples(ts, math.Float64frombits(value.StaleNaN))
+				return series
+			}(),
+			expectedNotConverted: 1,
+		},
+		"should not convert series whose metadata isn't a histogram": {
+			timeseries:         classicHistogram("latency"),
+			metadata:           []*mimirpb.MetricMetadata{{MetricFamilyName: "latency", Type: mimirpb.SUMMARY}},
+			expectedTimeseries: classicHistogram("latency"),
+		},
+		"should ignore series named after the classic histogram suffixes without buckets": {
+			timeseries: []mimirpb.PreallocTimeseries{
+				makeTimeseries([]string{"__name__", "requests_count"}, makeSamples(ts, 1), nil, nil),
+				makeTimeseries([]string{"__name__", "requests_sum"}, makeSamples(ts, 1), nil, nil),
+			},
+			expectedTimeseries: []mimirpb.PreallocTimeseries{
+				makeTimeseries([]string{"__name__", "requests_count"}, makeSamples(ts, 1), nil, nil),
+				makeTimeseries([]string{"__name__", "requests_sum"}, makeSamples(ts, 1), nil, nil),
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := &mimirpb.WriteRequest{Timeseries: tc.timeseries, Metadata: tc.metadata}
+
+			converted, notConverted := convertClassicHistogramsToNHCB(req)
+			assert.Equal(t, tc.expectedConverted, converted)
+			assert.Equal(t, tc.expectedNotConverted, notConverted)
+
+			require.Len(t, req.Timeseries, len(tc.expectedTimeseries))
+			for i, expected := range tc.expectedTimeseries {
+				assert.Equal(t, expected.Labels, req.Timeseries[i].Labels)
+				assert.Equal(t, len(expected.Samples), len(req.Timeseries[i].Samples))
+				for j := range expected.Samples {
+					assert.Equal(t, expected.Samples[j].TimestampMs, req.Timeseries[i].Samples[j].TimestampMs)
+					assert.Equal(t, math.Float64bits(expected.Samples[j].Value), math.Float64bits(req.Timeseries[i].Samples[j].Value))
+				}
+				assert.Equal(t, expected.Histograms, req.Timeseries[i].Histograms)
+				assert.Equal(t, expected.Exemplars, req.Timeseries[i].Exemplars)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/httpgrpc"
+	"github.com/grafana/dskit/middleware"
+	"github.com/grafana/dskit/tenant"
+	"github.com/pkg/errors"
+
+	"github.com/grafana/mimir/pkg/distributor/datadogpush"
+	"github.com/grafana/mimir/pkg/distributor/pushutil"
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util"
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+type distributorMaxDatadogRequestSizeErr struct {
+	limit int
+}
+
+func (e distributorMaxDatadogRequestSizeErr) Error() string {
+	return fmt.Sprintf("the incoming Datadog request has been rejected because its message size is larger than the allowed limit of %d bytes (configured via -%s)", e.limit, maxDatadogRequestSizeFlag)
+}
+
+// DatadogHandler is a http.Handler which accepts Datadog series API requests of the given version and converts them to WriteRequests.
+func DatadogHandler(
+	version datadogpush.APIVersion,
+	maxRecvMsgSize int,
+	requestBufferPool util.Pool,
+	sourceIPs *middleware.SourceIPExtractor,
+	limits *validation.Overrides,
+	retryCfg RetryConfig,
+	push PushFunc,
+	pushMetrics *PushMetrics,
+	logger log.Logger,
+) http.Handler {
+	return handler(maxRecvMsgSize, requestBufferPool, sourceIPs, false, false, limits, retryCfg, push, logger, func(ctx context.Context, r *http.Request, maxRecvMsgSize int, _ *util.RequestBuffers, req *mimirpb.PreallocWriteRequest, logger log.Logger) error {
+		spanLogger, ctx := spanlogger.New(ctx, logger, tracer, "Distributor.DatadogHandler.decodeAndConvert")
+		defer spanLogger.Finish()
+
+		spanLogger.SetTag("content_type", r.Header.Get("Content-Type"))
+		spanLogger.SetTag("content_encoding", r.Header.Get("Content-Encoding"))
+		spanLogger.SetTag("content_length", r.ContentLength)
+
+		tenantID, err := tenant.TenantID(ctx)
+		if err != nil {
+			return err
+		}
+		pushMetrics.IncDatadogRequest(tenantID)
+
+		timeseries, metadata, bytesRead, err := datadogpush.ParseSeriesRequest(r, version, maxRecvMsgSize)
+		level.Debug(spanLogger).Log("msg", "decodeAndConvert complete", "bytesRead", bytesRead, "metric_count", len(timeseries), "err", err)
+		pushMetrics.ObserveDatadogUncompressedBodySize(tenantID, float64(bytesRead))
+		if errors.Is(err, pushutil.ErrRequestTooLarge) {
+			return httpgrpc.Error(http.StatusRequestEntityTooLarge, distributorMaxDatadogRequestSizeErr{limit: maxRecvMsgSize}.Error())
+		}
+		if err != nil {
+			return err
+		}
+
+		req.Timeseries = timeseries
+		req.Metadata = metadata
+		return nil
+	})
+}
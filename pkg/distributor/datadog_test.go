@@ -0,0 +1,148 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/user"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/distributor/datadogpush"
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+func TestDatadogHandleSeriesPush(t *testing.T) {
+	defaultExpectedWriteRequest := &mimirpb.WriteRequest{
+		Timeseries: []mimirpb.PreallocTimeseries{
+			{
+				TimeSeries: &mimirpb.TimeSeries{
+					Labels: []mimirpb.LabelAdapter{
+						{Name: "__name__", Value: "system_load_1"},
+						{Name: "env", Value: "prod"},
+						{Name: "host", Value: "host-1"},
+					},
+					Samples: []mimirpb.Sample{
+						{Value: 0.5, TimestampMs: 1700000000000},
+					},
+				},
+			},
+		},
+		Metadata: []*mimirpb.MetricMetadata{
+			{Type: mimirpb.GAUGE, MetricFamilyName: "system_load_1"},
+		},
+	}
+
+	tests := []struct {
+		name                string
+		version             datadogpush.APIVersion
+		data                string
+		expectedCode        int
+		push                func(t *testing.T) PushFunc
+		maxRequestSizeBytes int
+	}{
+		{
+			name:         "v1",
+			version:      datadogpush.V1,
+			data:         `{"series":[{"metric":"system.load.1","points":[[1700000000,0.5]],"tags":["env:prod"],"host":"host-1"}]}`,
+			expectedCode: http.StatusOK,
+			push: func(t *testing.T) PushFunc {
+				return func(_ context.Context, pushReq *Request) error {
+					req, err := pushReq.WriteRequest()
+					assert.Equal(t, defaultExpectedWriteRequest, req)
+					assert.Nil(t, err)
+					return err
+				}
+			},
+			maxRequestSizeBytes: 1 << 20,
+		},
+		{
+			name:         "v2",
+			version:      datadogpush.V2,
+			data:         `{"series":[{"metric":"system.load.1","type":3,"points":[{"timestamp":1700000000,"value":0.5}],"tags":["env:prod"],"resources":[{"type":"host","name":"host-1"}]}]}`,
+			expectedCode: http.StatusOK,
+			push: func(t *testing.T) PushFunc {
+				return func(_ context.Context, pushReq *Request) error {
+					req, err := pushReq.WriteRequest()
+					assert.Equal(t, defaultExpectedWriteRequest, req)
+					assert.Nil(t, err)
+					return err
+				}
+			},
+			maxRequestSizeBytes: 1 << 20,
+		},
+		{
+			name:         "invalid parsing error handling",
+			version:      datadogpush.V1,
+			data:         `{"series":[`,
+			expectedCode: http.StatusBadRequest,
+			push: func(t *testing.T) PushFunc {
+				return func(_ context.Context, pushReq *Request) error {
+					req, err := pushReq.WriteRequest()
+					assert.Nil(t, req)
+					assert.ErrorContains(t, err, "can't parse Datadog series")
+					return err
+				}
+			},
+			maxRequestSizeBytes: 1 << 20,
+		},
+		{
+			name:         "internal server error",
+			version:      datadogpush.V1,
+			data:         `{"series":[{"metric":"system.load.1","points":[[1700000000,0.5]]}]}`,
+			expectedCode: http.StatusInternalServerError,
+			push: func(t *testing.T) PushFunc {
+				return func(_ context.Context, pushReq *Request) error {
+					_, err := pushReq.WriteRequest()
+					assert.Nil(t, err)
+					return context.DeadlineExceeded
+				}
+			},
+			maxRequestSizeBytes: 1 << 20,
+		},
+		{
+			name:         "max request size violated",
+			version:      datadogpush.V1,
+			data:         `{"series":[{"metric":"system.load.1","points":[[1700000000,0.5]]}]}`,
+			expectedCode: http.StatusRequestEntityTooLarge,
+			push: func(t *testing.T) PushFunc {
+				return func(_ context.Context, pushReq *Request) error {
+					req, err := pushReq.WriteRequest()
+					assert.Nil(t, req)
+					assert.ErrorContains(t, err, "-distributor.max-datadog-request-size")
+					return err
+				}
+			},
+			maxRequestSizeBytes: 10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewPedanticRegistry()
+			pushMetrics := newPushMetrics(reg)
+
+			handler := DatadogHandler(tt.version, tt.maxRequestSizeBytes, nil, nil, validation.MockDefaultOverrides(), RetryConfig{}, tt.push(t), pushMetrics, log.NewNopLogger())
+			req := httptest.NewRequest("POST", "/datadog/api/v1/series", bytes.NewReader([]byte(tt.data)))
+			req.Header.Set("Content-Type", "application/json")
+			const tenantID = "test"
+			req.Header.Set("X-Scope-OrgID", tenantID)
+			ctx := user.InjectOrgID(context.Background(), tenantID)
+			req = req.WithContext(ctx)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			assert.Equal(t, tt.expectedCode, rec.Code)
+
+			require.Equal(t, float64(1), testutil.ToFloat64(pushMetrics.datadogRequestCounter.WithLabelValues(tenantID)))
+		})
+	}
+}
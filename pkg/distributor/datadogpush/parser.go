@@ -0,0 +1,286 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package datadogpush
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+
+	"github.com/grafana/mimir/pkg/distributor/pushutil"
+	"github.com/grafana/mimir/pkg/mimirpb"
+)
+
+// APIVersion is the version of the Datadog series API.
+type APIVersion int
+
+const (
+	// V1 is the Datadog /api/v1/series API, accepting JSON payloads.
+	V1 APIVersion = 1
+
+	// V2 is the Datadog /api/v2/series API, accepting JSON and protobuf payloads.
+	V2 APIVersion = 2
+)
+
+// Metric types of the Datadog series API. The v1 API uses their string representation.
+const (
+	metricTypeUnspecified int32 = 0
+	metricTypeCount       int32 = 1
+	metricTypeRate        int32 = 2
+	metricTypeGauge       int32 = 3
+)
+
+// bareTagValue is the label value of the tags without value, like "production".
+const bareTagValue = "true"
+
+// series is the version independent representation of a Datadog series.
+type series struct {
+	metric    string
+	typ       int32
+	points    []point
+	tags      []string
+	resources []resource
+	host      string
+	device    string
+	interval  int64
+	unit      string
+}
+
+type point struct {
+	timestampMs int64
+	value       float64
+}
+
+type resource struct {
+	typ  string
+	name string
+}
+
+// ParseSeriesRequest parses a Datadog series request of the given API version, and converts it into time series
+// and metadata. It returns the number of bytes of the uncompressed request body.
+//
+// The metric name and the tags are converted into labels, replacing the characters not allowed in
+// label names with "_". Tags without value get the "true" value, and when a tag key is repeated the
+// first value is kept. Counts and rates are ingested with their value as is, timestamped at the end
+// of their interval, since Datadog timestamps them at the start of the interval. A count is the number
+// of events in its interval, that is a delta, and is not converted into a cumulative counter: it's
+// queried with sum_over_time() rather than rate() or increase().
+func ParseSeriesRequest(r *http.Request, version APIVersion, maxSize int) ([]mimirpb.PreallocTimeseries, []*mimirpb.MetricMetadata, int, error) {
+	body, err := pushutil.ReadBody(r, maxSize, pushutil.Gzip, pushutil.Deflate, pushutil.Zstd)
+	if err != nil {
+		return nil, nil, len(body), err
+	}
+
+	var ss []series
+	switch version {
+	case V1:
+		ss, err = unmarshalV1JSON(body)
+	case V2:
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-protobuf") {
+			ss, err = unmarshalV2Proto(body)
+		} else {
+			ss, err = unmarshalV2JSON(body)
+		}
+	default:
+		err = fmt.Errorf("unsupported Datadog API version %d", version)
+	}
+	if err != nil {
+		return nil, nil, len(body), err
+	}
+
+	ts, metadata := seriesToTimeseries(ss)
+	return ts, metadata, len(body), nil
+}
+
+type v1Payload struct {
+	Series []struct {
+		Metric   string       `json:"metric"`
+		Points   [][2]float64 `json:"points"`
+		Tags     []string     `json:"tags"`
+		Host     string       `json:"host"`
+		Device   string       `json:"device"`
+		Type     string       `json:"type"`
+		Interval int64        `json:"interval"`
+	} `json:"series"`
+}
+
+func unmarshalV1JSON(body []byte) ([]series, error) {
+	var payload v1Payload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, errors.Wrap(err, "can't parse Datadog series")
+	}
+
+	ss := make([]series, 0, len(payload.Series))
+	for _, in := range payload.Series {
+		s := series{
+			metric:   in.Metric,
+			tags:     in.Tags,
+			host:     in.Host,
+			device:   in.Device,
+			interval: in.Interval,
+			points:   make([]point, 0, len(in.Points)),
+		}
+
+		switch in.Type {
+		case "", "gauge":
+			s.typ = metricTypeGauge
+		case "count":
+			s.typ = metricTypeCount
+		case "rate":
+			s.typ = metricTypeRate
+		default:
+			return nil, fmt.Errorf("unsupported type %q for metric %q", in.Type, in.Metric)
+		}
+
+		for _, p := range in.Points {
+			// The v1 API timestamps are in seconds, and may have a fractional part.
+			s.points = append(s.points, point{timestampMs: int64(math.Round(p[0] * 1000)), value: p[1]})
+		}
+		ss = append(ss, s)
+	}
+	return ss, nil
+}
+
+type v2Payload struct {
+	Series []struct {
+		Metric string `json:"metric"`
+		Type   int32  `json:"type"`
+		Points []struct {
+			Timestamp int64   `json:"timestamp"`
+			Value     float64 `json:"value"`
+		} `json:"points"`
+		Tags      []string `json:"tags"`
+		Resources []struct {
+			Name string `json:"name"`
+			Type string `json:"type"`
+		} `json:"resources"`
+		Interval int64  `json:"interval"`
+		Unit     string `json:"unit"`
+	} `json:"series"`
+}
+
+func unmarshalV2JSON(body []byte) ([]series, error) {
+	var payload v2Payload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, errors.Wrap(err, "can't parse Datadog series")
+	}
+
+	ss := make([]series, 0, len(payload.Series))
+	for _, in := range payload.Series {
+		s := series{
+			metric:   in.Metric,
+			typ:      in.Type,
+			tags:     in.Tags,
+			interval: in.Interval,
+			unit:     in.Unit,
+			points:   make([]point, 0, len(in.Points)),
+		}
+		for _, r := range in.Resources {
+			s.resources = append(s.resources, resource{typ: r.Type, name: r.Name})
+		}
+		for _, p := range in.Points {
+			s.points = append(s.points, point{timestampMs: p.Timestamp * 1000, value: p.Value})
+		}
+		ss = append(ss, s)
+	}
+	return ss, nil
+}
+
+// seriesToTimeseries converts the Datadog series into time series, and the metadata of their metrics.
+func seriesToTimeseries(ss []series) ([]mimirpb.PreallocTimeseries, []*mimirpb.MetricMetadata) {
+	timeseries := mimirpb.PreallocTimeseriesSliceFromPool()[:0]
+	if cap(timeseries) < len(ss) {
+		timeseries = make([]mimirpb.PreallocTimeseries, 0, len(ss))
+	}
+
+	var metadata []*mimirpb.MetricMetadata
+	seenMetadata := map[string]struct{}{}
+
+	for _, s := range ss {
+		if len(s.points) == 0 {
+			continue
+		}
+
+		name := pushutil.SanitizeName(s.metric)
+
+		samples := make([]mimirpb.Sample, 0, len(s.points))
+		for _, p := range s.points {
+			ts := p.timestampMs
+			if s.typ == metricTypeCount || s.typ == metricTypeRate {
+				ts += s.interval * 1000
+			}
+			samples = append(samples, mimirpb.Sample{TimestampMs: ts, Value: p.value})
+		}
+		slices.SortFunc(samples, func(a, b mimirpb.Sample) int {
+			return cmp.Compare(a.TimestampMs, b.TimestampMs)
+		})
+
+		timeseries = append(timeseries, mimirpb.PreallocTimeseries{TimeSeries: &mimirpb.TimeSeries{
+			Labels:  seriesLabels(name, s),
+			Samples: samples,
+		}})
+
+		if _, ok := seenMetadata[name]; !ok {
+			seenMetadata[name] = struct{}{}
+			metadata = append(metadata, &mimirpb.MetricMetadata{
+				Type:             metricTypeToMetadataType(s.typ),
+				MetricFamilyName: name,
+				Unit:             s.unit,
+			})
+		}
+	}
+
+	return timeseries, metadata
+}
+
+func seriesLabels(name string, s series) []mimirpb.LabelAdapter {
+	lbls := make([]mimirpb.LabelAdapter, 0, len(s.tags)+len(s.resources)+3)
+	lbls = append(lbls, mimirpb.LabelAdapter{Name: labels.MetricName, Value: name})
+
+	seen := map[string]struct{}{labels.MetricName: {}}
+	add := func(name, value string) {
+		if _, ok := seen[name]; ok || name == "" || value == "" {
+			return
+		}
+		seen[name] = struct{}{}
+		lbls = append(lbls, mimirpb.LabelAdapter{Name: name, Value: value})
+	}
+
+	add("host", s.host)
+	add("device", s.device)
+	for _, r := range s.resources {
+		add(pushutil.SanitizeName(r.typ), r.name)
+	}
+	for _, tag := range s.tags {
+		key, value, ok := strings.Cut(tag, ":")
+		if !ok {
+			value = bareTagValue
+		}
+		add(pushutil.SanitizeName(key), value)
+	}
+
+	slices.SortFunc(lbls, func(a, b mimirpb.LabelAdapter) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return lbls
+}
+
+// metricTypeToMetadataType returns the metadata type of the Datadog metric type. Datadog rates are the
+// per-second rate over the interval, so they're gauges. Datadog counts are the number of events in the
+// interval, that is deltas, which can't be flagged in the metadata: like the OTLP delta sums, they're
+// marked as unknown rather than as counters, which are cumulative.
+func metricTypeToMetadataType(typ int32) mimirpb.MetricMetadata_MetricType {
+	switch typ {
+	case metricTypeRate, metricTypeGauge:
+		return mimirpb.GAUGE
+	default:
+		return mimirpb.UNKNOWN
+	}
+}
@@ -0,0 +1,280 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package datadogpush
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/grafana/mimir/pkg/distributor/pushutil"
+	"github.com/grafana/mimir/pkg/mimirpb"
+)
+
+func TestParseSeriesRequest(t *testing.T) {
+	tests := map[string]struct {
+		version          APIVersion
+		contentType      string
+		body             []byte
+		expectedSeries   []mimirpb.PreallocTimeseries
+		expectedMetadata []*mimirpb.MetricMetadata
+		expectedErr      string
+	}{
+		"v1 gauge": {
+			version: V1,
+			body:    []byte(`{"series":[{"metric":"system.load.1","points":[[1700000000,0.5],[1700000010.5,0.7]],"tags":["env:prod","role:db","production"],"host":"host-1","type":"gauge"}]}`),
+			expectedSeries: []mimirpb.PreallocTimeseries{
+				makeTimeseries(
+					[]mimirpb.LabelAdapter{
+						{Name: "__name__", Value: "system_load_1"},
+						{Name: "env", Value: "prod"},
+						{Name: "host", Value: "host-1"},
+						{Name: "production", Value: "true"},
+						{Name: "role", Value: "db"},
+					},
+					mimirpb.Sample{TimestampMs: 1700000000000, Value: 0.5},
+					mimirpb.Sample{TimestampMs: 1700000010500, Value: 0.7},
+				),
+			},
+			expectedMetadata: []*mimirpb.MetricMetadata{{Type: mimirpb.GAUGE, MetricFamilyName: "system_load_1"}},
+		},
+		"v1 count is timestamped at the end of the interval": {
+			version: V1,
+			body:    []byte(`{"series":[{"metric":"requests","points":[[1700000000,3]],"device":"sda","type":"count","interval":10}]}`),
+			expectedSeries: []mimirpb.PreallocTimeseries{
+				makeTimeseries(
+					[]mimirpb.LabelAdapter{
+						{Name: "__name__", Value: "requests"},
+						{Name: "device", Value: "sda"},
+					},
+					mimirpb.Sample{TimestampMs: 1700000010000, Value: 3},
+				),
+			},
+			expectedMetadata: []*mimirpb.MetricMetadata{{Type: mimirpb.UNKNOWN, MetricFamilyName: "requests"}},
+		},
+		"v1 unsupported type": {
+			version:     V1,
+			body:        []byte(`{"series":[{"metric":"requests","points":[[1700000000,3]],"type":"distribution"}]}`),
+			expectedErr: `unsupported type "distribution" for metric "requests"`,
+		},
+		"v1 invalid JSON": {
+			version:     V1,
+			body:        []byte(`{"series":[`),
+			expectedErr: "can't parse Datadog series",
+		},
+		"v2 JSON rate": {
+			version: V2,
+			body:    []byte(`{"series":[{"metric":"net.bytes_rcvd","type":2,"interval":15,"unit":"byte","points":[{"timestamp":1700000000,"value":1.5}],"resources":[{"name":"host-1","type":"host"}],"tags":["env:prod","env:dev","1st:yes"]}]}`),
+			expectedSeries: []mimirpb.PreallocTimeseries{
+				makeTimeseries(
+					[]mimirpb.LabelAdapter{
+						{Name: "_1st", Value: "yes"},
+						{Name: "__name__", Value: "net_bytes_rcvd"},
+						{Name: "env", Value: "prod"},
+						{Name: "host", Value: "host-1"},
+					},
+					mimirpb.Sample{TimestampMs: 1700000015000, Value: 1.5},
+				),
+			},
+			expectedMetadata: []*mimirpb.MetricMetadata{{Type: mimirpb.GAUGE, MetricFamilyName: "net_bytes_rcvd", Unit: "byte"}},
+		},
+		"v2 JSON series without points are skipped": {
+			version:        V2,
+			body:           []byte(`{"series":[{"metric":"empty","type":3}]}`),
+			expectedSeries: []mimirpb.PreallocTimeseries{},
+		},
+		"v2 protobuf": {
+			version:     V2,
+			contentType: "application/x-protobuf",
+			body: v2ProtoPayload(
+				v2ProtoSeries("system.cpu.user", metricTypeGauge, 0, "percent", []string{"env:prod"}, [][2]string{{"host", "host-1"}}, []point{{timestampMs: 1700000010000, value: 2}, {timestampMs: 1700000000000, value: 1}}),
+				v2ProtoSeries("system.cpu.user", metricTypeGauge, 0, "percent", []string{"env:dev"}, nil, []point{{timestampMs: 1700000000000, value: 3}}),
+			),
+			expectedSeries: []mimirpb.PreallocTimeseries{
+				makeTimeseries(
+					[]mimirpb.LabelAdapter{
+						{Name: "__name__", Value: "system_cpu_user"},
+						{Name: "env", Value: "prod"},
+						{Name: "host", Value: "host-1"},
+					},
+					mimirpb.Sample{TimestampMs: 1700000000000, Value: 1},
+					mimirpb.Sample{TimestampMs: 1700000010000, Value: 2},
+				),
+				makeTimeseries(
+					[]mimirpb.LabelAdapter{
+						{Name: "__name__", Value: "system_cpu_user"},
+						{Name: "env", Value: "dev"},
+					},
+					mimirpb.Sample{TimestampMs: 1700000000000, Value: 3},
+				),
+			},
+			expectedMetadata: []*mimirpb.MetricMetadata{{Type: mimirpb.GAUGE, MetricFamilyName: "system_cpu_user", Unit: "percent"}},
+		},
+		"v2 invalid protobuf": {
+			version:     V2,
+			contentType: "application/x-protobuf",
+			body:        []byte{0x0a, 0x10, 0x01},
+			expectedErr: "can't parse Datadog series",
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "/", bytes.NewReader(testData.body))
+			require.NoError(t, err)
+			contentType := testData.contentType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			req.Header.Set("Content-Type", contentType)
+
+			timeseries, metadata, bytesRead, err := ParseSeriesRequest(req, testData.version, 1<<20)
+			assert.Equal(t, len(testData.body), bytesRead)
+			if testData.expectedErr != "" {
+				require.ErrorContains(t, err, testData.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, testData.expectedSeries, timeseries)
+			assert.Equal(t, testData.expectedMetadata, metadata)
+		})
+	}
+}
+
+func TestParseSeriesRequest_Compression(t *testing.T) {
+	body := []byte(`{"series":[{"metric":"up","points":[[1700000000,1]]}]}`)
+
+	compress := map[string]func([]byte) []byte{
+		"": func(b []byte) []byte { return b },
+		"gzip": func(b []byte) []byte {
+			var buf bytes.Buffer
+			w := gzip.NewWriter(&buf)
+			_, _ = w.Write(b)
+			_ = w.Close()
+			return buf.Bytes()
+		},
+		"deflate": func(b []byte) []byte {
+			var buf bytes.Buffer
+			w := zlib.NewWriter(&buf)
+			_, _ = w.Write(b)
+			_ = w.Close()
+			return buf.Bytes()
+		},
+		"zstd": func(b []byte) []byte {
+			w, _ := zstd.NewWriter(nil)
+			defer w.Close()
+			return w.EncodeAll(b, nil)
+		},
+	}
+
+	for encoding, fn := range compress {
+		t.Run(encoding, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "/", bytes.NewReader(fn(body)))
+			require.NoError(t, err)
+			req.Header.Set("Content-Encoding", encoding)
+
+			timeseries, _, bytesRead, err := ParseSeriesRequest(req, V1, 1<<20)
+			require.NoError(t, err)
+			assert.Equal(t, len(body), bytesRead)
+			require.Len(t, timeseries, 1)
+			assert.Equal(t, []mimirpb.Sample{{TimestampMs: 1700000000000, Value: 1}}, timeseries[0].Samples)
+		})
+	}
+
+	t.Run("unsupported", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Encoding", "br")
+
+		_, _, _, err = ParseSeriesRequest(req, V1, 1<<20)
+		require.ErrorContains(t, err, "unsupported compression: br")
+	})
+}
+
+func TestParseSeriesRequest_RequestTooLarge(t *testing.T) {
+	body := `{"series":[{"metric":"up","points":[[1700000000,1]]}]}`
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, _ = w.Write([]byte(strings.Repeat(" ", 100) + body))
+	require.NoError(t, w.Close())
+
+	req, err := http.NewRequest(http.MethodPost, "/", &buf)
+	require.NoError(t, err)
+	req.Header.Set("Content-Encoding", "gzip")
+
+	// The limit applies to the uncompressed body.
+	_, _, _, err = ParseSeriesRequest(req, V1, 100)
+	require.ErrorIs(t, err, pushutil.ErrRequestTooLarge)
+}
+
+func makeTimeseries(lbls []mimirpb.LabelAdapter, samples ...mimirpb.Sample) mimirpb.PreallocTimeseries {
+	return mimirpb.PreallocTimeseries{TimeSeries: &mimirpb.TimeSeries{Labels: lbls, Samples: samples}}
+}
+
+func v2ProtoPayload(series ...[]byte) []byte {
+	var b []byte
+	for _, s := range series {
+		b = protowire.AppendTag(b, payloadSeriesField, protowire.BytesType)
+		b = protowire.AppendBytes(b, s)
+	}
+	return b
+}
+
+func v2ProtoSeries(metric string, typ int32, interval int64, unit string, tags []string, resources [][2]string, points []point) []byte {
+	var b []byte
+	for _, r := range resources {
+		var rb []byte
+		rb = protowire.AppendTag(rb, resourceTypeField, protowire.BytesType)
+		rb = protowire.AppendString(rb, r[0])
+		rb = protowire.AppendTag(rb, resourceNameField, protowire.BytesType)
+		rb = protowire.AppendString(rb, r[1])
+
+		b = protowire.AppendTag(b, seriesResourcesField, protowire.BytesType)
+		b = protowire.AppendBytes(b, rb)
+	}
+
+	b = protowire.AppendTag(b, seriesMetricField, protowire.BytesType)
+	b = protowire.AppendString(b, metric)
+
+	for _, tag := range tags {
+		b = protowire.AppendTag(b, seriesTagsField, protowire.BytesType)
+		b = protowire.AppendString(b, tag)
+	}
+
+	for _, p := range points {
+		var pb []byte
+		pb = protowire.AppendTag(pb, pointValueField, protowire.Fixed64Type)
+		pb = protowire.AppendFixed64(pb, math.Float64bits(p.value))
+		pb = protowire.AppendTag(pb, pointTimestampField, protowire.VarintType)
+		pb = protowire.AppendVarint(pb, uint64(p.timestampMs/1000))
+
+		b = protowire.AppendTag(b, seriesPointsField, protowire.BytesType)
+		b = protowire.AppendBytes(b, pb)
+	}
+
+	b = protowire.AppendTag(b, seriesTypeField, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(typ))
+
+	b = protowire.AppendTag(b, seriesUnitField, protowire.BytesType)
+	b = protowire.AppendString(b, unit)
+
+	b = protowire.AppendTag(b, seriesIntervalField, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(interval))
+
+	// A field which isn't used by the conversion, and must be skipped.
+	b = protowire.AppendTag(b, 7, protowire.BytesType)
+	b = protowire.AppendString(b, "source")
+
+	return b
+}
@@ -0,0 +1,184 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package datadogpush
+
+import (
+	"fmt"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Field numbers of the MetricPayload message of the Datadog agent payload protobuf definition
+// (https://github.com/DataDog/agent-payload/blob/master/proto/metrics/agent_payload.proto).
+const (
+	payloadSeriesField = 1
+
+	seriesResourcesField = 1
+	seriesMetricField    = 2
+	seriesTagsField      = 3
+	seriesPointsField    = 4
+	seriesTypeField      = 5
+	seriesUnitField      = 6
+	seriesIntervalField  = 8
+
+	resourceTypeField = 1
+	resourceNameField = 2
+
+	pointValueField     = 1
+	pointTimestampField = 2
+)
+
+// unmarshalV2Proto decodes the protobuf MetricPayload sent to the v2 series API. Only the fields used by the
+// conversion are decoded, the others are skipped.
+func unmarshalV2Proto(b []byte) ([]series, error) {
+	var ss []series
+
+	err := consumeMessage(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if num != payloadSeriesField || typ != protowire.BytesType {
+			return 0, nil
+		}
+
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		s, err := unmarshalV2ProtoSeries(v)
+		if err != nil {
+			return 0, err
+		}
+		ss = append(ss, s)
+		return n, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can't parse Datadog series: %w", err)
+	}
+	return ss, nil
+}
+
+func unmarshalV2ProtoSeries(b []byte) (series, error) {
+	var s series
+
+	err := consumeMessage(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == seriesResourcesField && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return 0, protowire.ParseError(n)
+			}
+			r, err := unmarshalV2ProtoResource(v)
+			if err != nil {
+				return 0, err
+			}
+			s.resources = append(s.resources, r)
+			return n, nil
+
+		case num == seriesMetricField && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			s.metric = v
+			return n, nil
+
+		case num == seriesTagsField && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			s.tags = append(s.tags, v)
+			return n, nil
+
+		case num == seriesPointsField && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return 0, protowire.ParseError(n)
+			}
+			p, err := unmarshalV2ProtoPoint(v)
+			if err != nil {
+				return 0, err
+			}
+			s.points = append(s.points, p)
+			return n, nil
+
+		case num == seriesTypeField && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			s.typ = int32(v)
+			return n, nil
+
+		case num == seriesUnitField && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			s.unit = v
+			return n, nil
+
+		case num == seriesIntervalField && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			s.interval = int64(v)
+			return n, nil
+		}
+		return 0, nil
+	})
+	return s, err
+}
+
+func unmarshalV2ProtoResource(b []byte) (resource, error) {
+	var r resource
+
+	err := consumeMessage(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if typ != protowire.BytesType {
+			return 0, nil
+		}
+
+		switch num {
+		case resourceTypeField:
+			v, n := protowire.ConsumeString(b)
+			r.typ = v
+			return n, nil
+		case resourceNameField:
+			v, n := protowire.ConsumeString(b)
+			r.name = v
+			return n, nil
+		}
+		return 0, nil
+	})
+	return r, err
+}
+
+func unmarshalV2ProtoPoint(b []byte) (point, error) {
+	var p point
+
+	err := consumeMessage(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == pointValueField && typ == protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(b)
+			p.value = math.Float64frombits(v)
+			return n, nil
+		case num == pointTimestampField && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			p.timestampMs = int64(v) * 1000
+			return n, nil
+		}
+		return 0, nil
+	})
+	return p, err
+}
+
+// consumeMessage iterates over the fields of the protobuf message b, calling consumeField for each field with
+// the bytes following the field tag. consumeField returns the number of bytes of the field value it consumed,
+// or 0 to skip the field, or a negative number on error.
+func consumeMessage(b []byte, consumeField func(num protowire.Number, typ protowire.Type, b []byte) (int, error)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		n, err := consumeField(num, typ, b)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return nil
+}
@@ -0,0 +1,489 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/golang/snappy"
+	"github.com/grafana/dskit/services"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/atomic"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+)
+
+const (
+	// WriteBufferedHeader is set on the responses to the write requests which have been buffered on disk, because
+	// the ingesters were unavailable, instead of being ingested.
+	WriteBufferedHeader = "X-Mimir-Write-Buffered"
+
+	diskBufferFileExtension    = ".snappy"
+	diskBufferTmpFileExtension = ".tmp"
+
+	reasonDiskBufferFull                = "buffer_full"
+	reasonDiskBufferTenantQuotaExceeded = "tenant_quota_exceeded"
+	reasonDiskBufferWriteFailed         = "write_failed"
+	reasonDiskBufferCorrupted           = "corrupted"
+	reasonDiskBufferReplayRejected      = "rejected"
+)
+
+var (
+	errDiskBufferDirectoryRequired     = errors.New("the disk buffer directory is required when the disk buffer is enabled")
+	errInvalidDiskBufferMaxSizeBytes   = errors.New("invalid disk buffer max size, the value must be greater than zero")
+	errInvalidDiskBufferReplayInterval = errors.New("invalid disk buffer replay interval, the value must be greater than zero")
+
+	errDiskBufferFull                = errors.New("the disk buffer is full")
+	errDiskBufferTenantQuotaExceeded = errors.New("the disk buffer quota of the tenant is exceeded")
+)
+
+// DiskBufferConfig configures the buffering on disk of the write requests failed because the ingesters were unavailable.
+type DiskBufferConfig struct {
+	Enabled        bool          `yaml:"enabled" category:"experimental"`
+	Directory      string        `yaml:"directory" category:"experimental"`
+	MaxSizeBytes   int64         `yaml:"max_size_bytes" category:"experimental"`
+	ReplayInterval time.Duration `yaml:"replay_interval" category:"experimental"`
+}
+
+// RegisterFlags adds the flags required to config this to the given FlagSet.
+func (cfg *DiskBufferConfig) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.Enabled, "distributor.disk-buffer.enabled", false, "Enable buffering on the local disk the write requests which fail because the ingesters are unavailable. The buffered write requests are acknowledged with the 202 status code and the "+WriteBufferedHeader+" header, and replayed in order for each tenant once the ingesters are available again. The write requests received for a tenant while some of its write requests are buffered are buffered too. Not supported with the ingest storage.")
+	f.StringVar(&cfg.Directory, "distributor.disk-buffer.directory", "./data-distributor-buffer/", "Directory to store the buffered write requests in. This directory is required to be persisted between restarts, otherwise the buffered write requests are lost.")
+	f.Int64Var(&cfg.MaxSizeBytes, "distributor.disk-buffer.max-size-bytes", 1<<30, "Maximum size of the write requests buffered on disk, across all tenants. The write requests failing while the buffer is full aren't buffered, and fail.")
+	f.DurationVar(&cfg.ReplayInterval, "distributor.disk-buffer.replay-interval", 10*time.Second, "Interval at which the replay of the buffered write requests is attempted. The replay of the write requests of a tenant stops at the first one failing because the ingesters are still unavailable, and is retried at the next interval.")
+}
+
+func (cfg *DiskBufferConfig) Validate() error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.Directory == "" {
+		return errDiskBufferDirectoryRequired
+	}
+	if cfg.MaxSizeBytes <= 0 {
+		return errInvalidDiskBufferMaxSizeBytes
+	}
+	if cfg.ReplayInterval <= 0 {
+		return errInvalidDiskBufferReplayInterval
+	}
+	return nil
+}
+
+type diskBufferLimits interface {
+	DiskBufferMaxSizeBytes(userID string) int64
+}
+
+// diskBufferReplayFunc sends a buffered write request of the tenant to the ingesters.
+type diskBufferReplayFunc func(ctx context.Context, userID string, req *mimirpb.WriteRequest) error
+
+// DiskBuffer buffers on the local disk the write requests which couldn't be sent to the ingesters because they were
+// unavailable, and replays them in order, for each tenant, once the ingesters are available again. Each write request
+// is stored in its own file, under the directory of its tenant, so that the buffered write requests survive a restart.
+type DiskBuffer struct {
+	services.Service
+
+	cfg    DiskBufferConfig
+	limits diskBufferLimits
+	replay diskBufferReplayFunc
+	logger log.Logger
+
+	tenantsMtx sync.Mutex
+	tenants    map[string]*diskBufferTenant
+
+	// totalBytes is the size of the write requests buffered for all tenants.
+	totalBytes atomic.Int64
+
+	bufferedRequests *prometheus.CounterVec
+	rejectedRequests *prometheus.CounterVec
+	replayedRequests *prometheus.CounterVec
+	droppedRequests  *prometheus.CounterVec
+	bufferedBytes    *prometheus.GaugeVec
+	replayLag        *prometheus.GaugeVec
+}
+
+// diskBufferTenant holds the write requests buffered for a tenant.
+type diskBufferTenant struct {
+	dir string
+
+	mtx sync.Mutex
+	// entries are the buffered write requests, in the order they have been buffered.
+	entries []diskBufferEntry
+	bytes   int64
+	nextSeq uint64
+}
+
+type diskBufferEntry struct {
+	path       string
+	size       int64
+	bufferedAt time.Time
+}
+
+// NewDiskBuffer returns a new DiskBuffer, replaying the buffered write requests with the replay function.
+func NewDiskBuffer(cfg DiskBufferConfig, limits diskBufferLimits, replay diskBufferReplayFunc, logger log.Logger, reg prometheus.Registerer) *DiskBuffer {
+	b := &DiskBuffer{
+		cfg:     cfg,
+		limits:  limits,
+		replay:  replay,
+		logger:  logger,
+		tenants: map[string]*diskBufferTenant{},
+		bufferedRequests: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_distributor_disk_buffer_buffered_requests_total",
+			Help: "The total number of write requests buffered on disk because the ingesters were unavailable.",
+		}, []string{"user"}),
+		rejectedRequests: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_distributor_disk_buffer_rejected_requests_total",
+			Help: "The total number of write requests which couldn't be buffered on disk.",
+		}, []string{"user", "reason"}),
+		replayedRequests: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_distributor_disk_buffer_replayed_requests_total",
+			Help: "The total number of buffered write requests successfully replayed to the ingesters.",
+		}, []string{"user"}),
+		droppedRequests: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_distributor_disk_buffer_dropped_requests_total",
+			Help: "The total number of buffered write requests dropped, because they were corrupted or rejected by the ingesters when replayed.",
+		}, []string{"user", "reason"}),
+		bufferedBytes: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "cortex_distributor_disk_buffer_bytes",
+			Help: "The size of the write requests buffered on disk.",
+		}, []string{"user"}),
+		replayLag: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "cortex_distributor_disk_buffer_replay_lag_seconds",
+			Help: "How long ago the oldest write request buffered on disk was buffered, or 0 if there's no buffered write request.",
+		}, []string{"user"}),
+	}
+
+	b.Service = services.NewTimerService(cfg.ReplayInterval, b.starting, b.iteration, nil).WithName("distributor disk buffer")
+	return b
+}
+
+// starting loads the write requests buffered before the last restart.
+func (b *DiskBuffer) starting(_ context.Context) error {
+	if err := os.MkdirAll(b.cfg.Directory, 0o750); err != nil {
+		return errors.Wrap(err, "create disk buffer directory")
+	}
+
+	dirs, err := os.ReadDir(b.cfg.Directory)
+	if err != nil {
+		return errors.Wrap(err, "read disk buffer directory")
+	}
+
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+
+		userID := dir.Name()
+		t, err := loadDiskBufferTenant(filepath.Join(b.cfg.Directory, userID))
+		if err != nil {
+			return errors.Wrapf(err, "load the write requests buffered for tenant %s", userID)
+		}
+
+		b.tenants[userID] = t
+		b.totalBytes.Add(t.bytes)
+		b.updateTenantMetrics(userID, t)
+
+		if len(t.entries) > 0 {
+			level.Info(b.logger).Log("msg", "loaded buffered write requests", "user", userID, "requests", len(t.entries), "bytes", t.bytes)
+		}
+	}
+	return nil
+}
+
+func loadDiskBufferTenant(dir string) (*diskBufferTenant, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &diskBufferTenant{dir: dir}
+	for _, file := range files {
+		name := file.Name()
+		path := filepath.Join(dir, name)
+
+		if strings.HasSuffix(name, diskBufferTmpFileExtension) {
+			// The distributor stopped while writing the file.
+			if err := os.Remove(path); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, diskBufferFileExtension), 10, 64)
+		if file.IsDir() || !strings.HasSuffix(name, diskBufferFileExtension) || err != nil {
+			continue
+		}
+
+		info, err := file.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		t.entries = append(t.entries, diskBufferEntry{path: path, size: info.Size(), bufferedAt: info.ModTime()})
+		t.bytes += info.Size()
+		t.nextSeq = max(t.nextSeq, seq+1)
+	}
+
+	// The files are named after their zero-padded sequence number, so they're sorted in the order they've been buffered.
+	slices.SortFunc(t.entries, func(a, b diskBufferEntry) int { return strings.Compare(a.path, b.path) })
+	return t, nil
+}
+
+func (b *DiskBuffer) iteration(ctx context.Context) error {
+	b.tenantsMtx.Lock()
+	userIDs := make([]string, 0, len(b.tenants))
+	for userID := range b.tenants {
+		userIDs = append(userIDs, userID)
+	}
+	b.tenantsMtx.Unlock()
+	slices.Sort(userIDs)
+
+	for _, userID := range userIDs {
+		if ctx.Err() != nil {
+			return nil
+		}
+		b.replayTenant(ctx, userID)
+	}
+	return nil
+}
+
+// replayTenant replays the write requests buffered for the tenant, in order, until one of them fails because the
+// ingesters are still unavailable. The write requests failing for other reasons are dropped.
+func (b *DiskBuffer) replayTenant(ctx context.Context, userID string) {
+	t := b.getTenant(userID)
+	defer func() {
+		t.mtx.Lock()
+		b.updateTenantMetrics(userID, t)
+		t.mtx.Unlock()
+	}()
+
+	for ctx.Err() == nil {
+		t.mtx.Lock()
+		if len(t.entries) == 0 {
+			t.mtx.Unlock()
+			return
+		}
+		// New write requests are only appended, so the oldest one can be read without holding the lock.
+		entry := t.entries[0]
+		t.mtx.Unlock()
+
+		req, err := readDiskBufferEntry(entry.path)
+		if err != nil {
+			level.Warn(b.logger).Log("msg", "dropping corrupted buffered write request", "user", userID, "path", entry.path, "err", err)
+			b.droppedRequests.WithLabelValues(userID, reasonDiskBufferCorrupted).Inc()
+			b.removeOldest(t)
+			continue
+		}
+
+		err = b.replay(ctx, userID, req)
+		if ctx.Err() != nil {
+			return
+		}
+		if isIngesterAvailabilityError(err) {
+			level.Debug(b.logger).Log("msg", "failed to replay buffered write request, the ingesters are still unavailable", "user", userID, "err", err)
+			return
+		}
+		if err != nil {
+			level.Warn(b.logger).Log("msg", "dropping buffered write request rejected by the ingesters", "user", userID, "err", err)
+			b.droppedRequests.WithLabelValues(userID, reasonDiskBufferReplayRejected).Inc()
+		} else {
+			b.replayedRequests.WithLabelValues(userID).Inc()
+		}
+		b.removeOldest(t)
+	}
+}
+
+func readDiskBufferEntry(path string) (*mimirpb.WriteRequest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err = snappy.Decode(nil, data)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &mimirpb.WriteRequest{}
+	if err := req.Unmarshal(data); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// removeOldest removes the oldest write request buffered for the tenant.
+func (b *DiskBuffer) removeOldest(t *diskBufferTenant) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	entry := t.entries[0]
+	if err := os.Remove(entry.path); err != nil && !os.IsNotExist(err) {
+		level.Warn(b.logger).Log("msg", "failed to remove buffered write request", "path", entry.path, "err", err)
+	}
+
+	t.entries = t.entries[1:]
+	t.bytes -= entry.size
+	b.totalBytes.Sub(entry.size)
+}
+
+// Buffer writes the write request to the disk buffer of the tenant. The write request is copied, so it can be
+// reused once the function returns.
+func (b *DiskBuffer) Buffer(userID string, req *mimirpb.WriteRequest) error {
+	data, err := req.Marshal()
+	if err != nil {
+		return err
+	}
+	data = snappy.Encode(nil, data)
+	size := int64(len(data))
+
+	t := b.getTenant(userID)
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if limit := b.limits.DiskBufferMaxSizeBytes(userID); limit > 0 && t.bytes+size > limit {
+		b.rejectedRequests.WithLabelValues(userID, reasonDiskBufferTenantQuotaExceeded).Inc()
+		return errDiskBufferTenantQuotaExceeded
+	}
+	if b.totalBytes.Add(size) > b.cfg.MaxSizeBytes {
+		b.totalBytes.Sub(size)
+		b.rejectedRequests.WithLabelValues(userID, reasonDiskBufferFull).Inc()
+		return errDiskBufferFull
+	}
+
+	path := filepath.Join(t.dir, fmt.Sprintf("%020d%s", t.nextSeq, diskBufferFileExtension))
+	if err := writeDiskBufferEntry(path, data); err != nil {
+		b.totalBytes.Sub(size)
+		b.rejectedRequests.WithLabelValues(userID, reasonDiskBufferWriteFailed).Inc()
+		return errors.Wrap(err, "write buffered write request")
+	}
+
+	t.entries = append(t.entries, diskBufferEntry{path: path, size: size, bufferedAt: time.Now()})
+	t.bytes += size
+	t.nextSeq++
+
+	b.bufferedRequests.WithLabelValues(userID).Inc()
+	b.updateTenantMetrics(userID, t)
+	return nil
+}
+
+// writeDiskBufferEntry writes the data to a temporary file, which is renamed once synced, so that a partially
+// written file is never replayed.
+func writeDiskBufferEntry(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+
+	tmpPath := path + diskBufferTmpFileExtension
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// Buffered returns whether the tenant has write requests buffered, not replayed yet.
+func (b *DiskBuffer) Buffered(userID string) bool {
+	b.tenantsMtx.Lock()
+	t, ok := b.tenants[userID]
+	b.tenantsMtx.Unlock()
+	if !ok {
+		return false
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return len(t.entries) > 0
+}
+
+func (b *DiskBuffer) getTenant(userID string) *diskBufferTenant {
+	b.tenantsMtx.Lock()
+	defer b.tenantsMtx.Unlock()
+
+	t, ok := b.tenants[userID]
+	if !ok {
+		t = &diskBufferTenant{dir: filepath.Join(b.cfg.Directory, userID)}
+		b.tenants[userID] = t
+	}
+	return t
+}
+
+// updateTenantMetrics updates the metrics of the tenant. It must be called with the tenant lock held.
+func (b *DiskBuffer) updateTenantMetrics(userID string, t *diskBufferTenant) {
+	b.bufferedBytes.WithLabelValues(userID).Set(float64(t.bytes))
+
+	lag := 0.0
+	if len(t.entries) > 0 {
+		lag = time.Since(t.entries[0].bufferedAt).Seconds()
+	}
+	b.replayLag.WithLabelValues(userID).Set(lag)
+}
+
+// cleanupTenantMetrics deletes the metrics of the tenant, once it's inactive.
+func (b *DiskBuffer) cleanupTenantMetrics(userID string) {
+	if b.Buffered(userID) {
+		// The tenant's buffered write requests are still being replayed.
+		return
+	}
+
+	b.bufferedRequests.DeleteLabelValues(userID)
+	b.rejectedRequests.DeletePartialMatch(prometheus.Labels{"user": userID})
+	b.replayedRequests.DeleteLabelValues(userID)
+	b.droppedRequests.DeletePartialMatch(prometheus.Labels{"user": userID})
+	b.bufferedBytes.DeleteLabelValues(userID)
+	b.replayLag.DeleteLabelValues(userID)
+}
+
+type writeBufferedContextKey struct{}
+
+// contextWithWriteBufferedMarker returns a context in which the push function records whether the write request
+// has been buffered on disk instead of being ingested.
+func contextWithWriteBufferedMarker(ctx context.Context) context.Context {
+	return context.WithValue(ctx, writeBufferedContextKey{}, atomic.NewBool(false))
+}
+
+func markWriteBuffered(ctx context.Context) {
+	if marker, ok := ctx.Value(writeBufferedContextKey{}).(*atomic.Bool); ok {
+		marker.Store(true)
+	}
+}
+
+func isWriteBuffered(ctx context.Context) bool {
+	marker, ok := ctx.Value(writeBufferedContextKey{}).(*atomic.Bool)
+	return ok && marker.Load()
+}
+
+// successStatusCode returns the status code of the response to a successful write request: http.StatusAccepted
+// if the write request has been buffered on disk, or defaultCode otherwise.
+func successStatusCode(ctx context.Context, w http.ResponseWriter, defaultCode int) int {
+	if !isWriteBuffered(ctx) {
+		return defaultCode
+	}
+	w.Header().Set(WriteBufferedHeader, "true")
+	return http.StatusAccepted
+}
@@ -0,0 +1,347 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/golang/snappy"
+	"github.com/grafana/dskit/httpgrpc"
+	"github.com/grafana/dskit/services"
+	"github.com/grafana/dskit/user"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+type diskBufferLimitsMock map[string]int64
+
+func (m diskBufferLimitsMock) DiskBufferMaxSizeBytes(userID string) int64 {
+	return m[userID]
+}
+
+func TestDiskBuffer_BufferAndReplay(t *testing.T) {
+	var (
+		replayed  []string
+		replayErr error
+	)
+	replay := func(_ context.Context, userID string, req *mimirpb.WriteRequest) error {
+		if replayErr != nil {
+			return replayErr
+		}
+		replayed = append(replayed, userID+":"+req.Timeseries[0].Labels[0].Value)
+		return nil
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	b := NewDiskBuffer(testDiskBufferConfig(t), diskBufferLimitsMock{}, replay, log.NewNopLogger(), reg)
+	require.NoError(t, b.starting(context.Background()))
+
+	assert.False(t, b.Buffered("user-1"))
+	require.NoError(t, b.Buffer("user-1", makeDiskBufferWriteRequest("a")))
+	require.NoError(t, b.Buffer("user-2", makeDiskBufferWriteRequest("b")))
+	require.NoError(t, b.Buffer("user-1", makeDiskBufferWriteRequest("c")))
+	assert.True(t, b.Buffered("user-1"))
+	assert.True(t, b.Buffered("user-2"))
+
+	// The buffered write requests are kept while the ingesters are unavailable.
+	replayErr = errors.New("too many unhealthy instances in the ring")
+	require.NoError(t, b.iteration(context.Background()))
+	assert.Empty(t, replayed)
+	assert.True(t, b.Buffered("user-1"))
+
+	// The buffered write requests are replayed in order once the ingesters are available.
+	replayErr = nil
+	require.NoError(t, b.iteration(context.Background()))
+	assert.Equal(t, []string{"user-1:a", "user-1:c", "user-2:b"}, replayed)
+	assert.False(t, b.Buffered("user-1"))
+	assert.False(t, b.Buffered("user-2"))
+	assert.Equal(t, int64(0), b.totalBytes.Load())
+
+	// The buffered write requests rejected by the ingesters are dropped.
+	require.NoError(t, b.Buffer("user-1", makeDiskBufferWriteRequest("d")))
+	replayErr = httpgrpc.Errorf(http.StatusBadRequest, "out of bounds")
+	require.NoError(t, b.iteration(context.Background()))
+	assert.False(t, b.Buffered("user-1"))
+
+	files, err := os.ReadDir(filepath.Join(b.cfg.Directory, "user-1"))
+	require.NoError(t, err)
+	assert.Empty(t, files)
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_distributor_disk_buffer_buffered_requests_total The total number of write requests buffered on disk because the ingesters were unavailable.
+		# TYPE cortex_distributor_disk_buffer_buffered_requests_total counter
+		cortex_distributor_disk_buffer_buffered_requests_total{user="user-1"} 3
+		cortex_distributor_disk_buffer_buffered_requests_total{user="user-2"} 1
+		# HELP cortex_distributor_disk_buffer_replayed_requests_total The total number of buffered write requests successfully replayed to the ingesters.
+		# TYPE cortex_distributor_disk_buffer_replayed_requests_total counter
+		cortex_distributor_disk_buffer_replayed_requests_total{user="user-1"} 2
+		cortex_distributor_disk_buffer_replayed_requests_total{user="user-2"} 1
+		# HELP cortex_distributor_disk_buffer_dropped_requests_total The total number of buffered write requests dropped, because they were corrupted or rejected by the ingesters when replayed.
+		# TYPE cortex_distributor_disk_buffer_dropped_requests_total counter
+		cortex_distributor_disk_buffer_dropped_requests_total{reason="rejected",user="user-1"} 1
+		# HELP cortex_distributor_disk_buffer_bytes The size of the write requests buffered on disk.
+		# TYPE cortex_distributor_disk_buffer_bytes gauge
+		cortex_distributor_disk_buffer_bytes{user="user-1"} 0
+		cortex_distributor_disk_buffer_bytes{user="user-2"} 0
+		# HELP cortex_distributor_disk_buffer_replay_lag_seconds How long ago the oldest write request buffered on disk was buffered, or 0 if there's no buffered write request.
+		# TYPE cortex_distributor_disk_buffer_replay_lag_seconds gauge
+		cortex_distributor_disk_buffer_replay_lag_seconds{user="user-1"} 0
+		cortex_distributor_disk_buffer_replay_lag_seconds{user="user-2"} 0
+	`),
+		"cortex_distributor_disk_buffer_buffered_requests_total",
+		"cortex_distributor_disk_buffer_replayed_requests_total",
+		"cortex_distributor_disk_buffer_dropped_requests_total",
+		"cortex_distributor_disk_buffer_bytes",
+		"cortex_distributor_disk_buffer_replay_lag_seconds",
+	))
+}
+
+func TestDiskBuffer_Limits(t *testing.T) {
+	size := int64(len(mustMarshalDiskBufferEntry(t, makeDiskBufferWriteRequest("a"))))
+
+	cfg := testDiskBufferConfig(t)
+	cfg.MaxSizeBytes = 3 * size
+	reg := prometheus.NewPedanticRegistry()
+	b := NewDiskBuffer(cfg, diskBufferLimitsMock{"user-1": 2 * size}, nil, log.NewNopLogger(), reg)
+	require.NoError(t, b.starting(context.Background()))
+
+	require.NoError(t, b.Buffer("user-1", makeDiskBufferWriteRequest("a")))
+	require.NoError(t, b.Buffer("user-1", makeDiskBufferWriteRequest("b")))
+	require.ErrorIs(t, b.Buffer("user-1", makeDiskBufferWriteRequest("c")), errDiskBufferTenantQuotaExceeded)
+
+	require.NoError(t, b.Buffer("user-2", makeDiskBufferWriteRequest("d")))
+	require.ErrorIs(t, b.Buffer("user-2", makeDiskBufferWriteRequest("e")), errDiskBufferFull)
+	assert.Equal(t, 3*size, b.totalBytes.Load())
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_distributor_disk_buffer_rejected_requests_total The total number of write requests which couldn't be buffered on disk.
+		# TYPE cortex_distributor_disk_buffer_rejected_requests_total counter
+		cortex_distributor_disk_buffer_rejected_requests_total{reason="buffer_full",user="user-2"} 1
+		cortex_distributor_disk_buffer_rejected_requests_total{reason="tenant_quota_exceeded",user="user-1"} 1
+	`), "cortex_distributor_disk_buffer_rejected_requests_total"))
+}
+
+func TestDiskBuffer_LoadsBufferedWriteRequestsOnStartup(t *testing.T) {
+	cfg := testDiskBufferConfig(t)
+
+	b := NewDiskBuffer(cfg, diskBufferLimitsMock{}, nil, log.NewNopLogger(), nil)
+	require.NoError(t, b.starting(context.Background()))
+	for _, name := range []string{"a", "b", "c"} {
+		require.NoError(t, b.Buffer("user-1", makeDiskBufferWriteRequest(name)))
+	}
+
+	// A file partially written when the distributor stopped is removed, and a corrupted file is dropped.
+	tmpFile := filepath.Join(cfg.Directory, "user-1", "00000000000000000003"+diskBufferFileExtension+diskBufferTmpFileExtension)
+	require.NoError(t, os.WriteFile(tmpFile, []byte("partial"), 0o640))
+	require.NoError(t, os.WriteFile(filepath.Join(cfg.Directory, "user-1", "00000000000000000001"+diskBufferFileExtension), []byte("corrupted"), 0o640))
+
+	var replayed []string
+	replay := func(_ context.Context, _ string, req *mimirpb.WriteRequest) error {
+		replayed = append(replayed, req.Timeseries[0].Labels[0].Value)
+		return nil
+	}
+	reg := prometheus.NewPedanticRegistry()
+	b = NewDiskBuffer(cfg, diskBufferLimitsMock{}, replay, log.NewNopLogger(), reg)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), b))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(context.Background(), b))
+	})
+
+	assert.True(t, b.Buffered("user-1"))
+	assert.NoFileExists(t, tmpFile)
+
+	require.NoError(t, b.Buffer("user-1", makeDiskBufferWriteRequest("d")))
+	require.Eventually(t, func() bool {
+		return !b.Buffered("user-1")
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"a", "c", "d"}, replayed)
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_distributor_disk_buffer_dropped_requests_total The total number of buffered write requests dropped, because they were corrupted or rejected by the ingesters when replayed.
+		# TYPE cortex_distributor_disk_buffer_dropped_requests_total counter
+		cortex_distributor_disk_buffer_dropped_requests_total{reason="corrupted",user="user-1"} 1
+	`), "cortex_distributor_disk_buffer_dropped_requests_total"))
+}
+
+func TestDistributor_DiskBuffer(t *testing.T) {
+	const userID = "user"
+
+	distributors, ingesters, _, _ := prepare(t, prepConfig{
+		numIngesters:      3,
+		happyIngesters:    3,
+		numDistributors:   1,
+		replicationFactor: 3,
+		configure: func(cfg *Config) {
+			cfg.DiskBufferConfig = testDiskBufferConfig(t)
+			// The replay is triggered by the test.
+			cfg.DiskBufferConfig.ReplayInterval = time.Hour
+		},
+	})
+	d := distributors[0]
+	require.NotNil(t, d.DiskBuffer)
+
+	pushErr := atomic.NewError(nil)
+	for _, ing := range ingesters {
+		ing.registerBeforePushHook(func(context.Context, *mimirpb.WriteRequest) (*mimirpb.WriteResponse, error, bool) {
+			err := pushErr.Load()
+			return nil, err, err != nil
+		})
+	}
+
+	push := func(metric string) (bool, error) {
+		ctx := contextWithWriteBufferedMarker(user.InjectOrgID(context.Background(), userID))
+		req := makeWriteRequest(time.Now().UnixMilli(), 1, 0, false, false, metric)
+		_, err := d.Push(ctx, req)
+		return isWriteBuffered(ctx), err
+	}
+
+	// The write requests rejected by the ingesters aren't buffered.
+	pushErr.Store(httpgrpc.Errorf(http.StatusBadRequest, "out of bounds"))
+	buffered, err := push("rejected")
+	require.Error(t, err)
+	assert.False(t, buffered)
+	assert.False(t, d.DiskBuffer.Buffered(userID))
+
+	// The write requests failed because the ingesters are unavailable are buffered.
+	pushErr.Store(errors.New("ingester unavailable"))
+	buffered, err = push("first")
+	require.NoError(t, err)
+	assert.True(t, buffered)
+	assert.True(t, d.DiskBuffer.Buffered(userID))
+
+	// The write requests of a tenant having write requests buffered are buffered, even if the ingesters are available.
+	pushErr.Store(nil)
+	buffered, err = push("second")
+	require.NoError(t, err)
+	assert.True(t, buffered)
+
+	for _, ing := range ingesters {
+		assert.Empty(t, ing.series())
+	}
+
+	// The buffered write requests are replayed once the ingesters are available.
+	require.NoError(t, d.DiskBuffer.iteration(context.Background()))
+	assert.False(t, d.DiskBuffer.Buffered(userID))
+
+	// The replay returns once a quorum of ingesters succeeded.
+	for _, ing := range ingesters {
+		require.EventuallyWithT(t, func(c *assert.CollectT) {
+			var metrics []string
+			for _, series := range ing.series() {
+				metrics = append(metrics, mimirpb.FromLabelAdaptersToLabels(series.Labels).Get(model.MetricNameLabel))
+			}
+			assert.ElementsMatch(c, []string{"first", "second"}, metrics)
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+
+	buffered, err = push("third")
+	require.NoError(t, err)
+	assert.False(t, buffered)
+}
+
+func TestHandler_WriteBuffered(t *testing.T) {
+	pushFunc := func(ctx context.Context, req *Request) error {
+		defer req.CleanUp()
+		if _, err := req.WriteRequest(); err != nil {
+			return err
+		}
+		markWriteBuffered(ctx)
+		return nil
+	}
+
+	handler := Handler(100000, nil, nil, false, false, validation.MockDefaultOverrides(), RetryConfig{}, pushFunc, nil, log.NewNopLogger())
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, createRequest(t, createPrometheusRemoteWriteProtobuf(t)))
+
+	assert.Equal(t, http.StatusAccepted, resp.Code)
+	assert.Equal(t, "true", resp.Header().Get(WriteBufferedHeader))
+}
+
+func TestIsIngesterAvailabilityError(t *testing.T) {
+	tests := map[string]struct {
+		err      error
+		expected bool
+	}{
+		"nil": {
+			err:      nil,
+			expected: false,
+		},
+		"context canceled": {
+			err:      context.Canceled,
+			expected: false,
+		},
+		"generic error": {
+			err:      errors.New("at least 2 live replicas required, could only find 1"),
+			expected: true,
+		},
+		"HTTP 4xx error": {
+			err:      httpgrpc.Errorf(http.StatusBadRequest, "bad data"),
+			expected: false,
+		},
+		"HTTP 5xx error": {
+			err:      httpgrpc.Errorf(http.StatusServiceUnavailable, "unavailable"),
+			expected: true,
+		},
+		"bad data": {
+			err:      ingesterPushError{cause: mimirpb.BAD_DATA},
+			expected: false,
+		},
+		"tenant limit": {
+			err:      ingesterPushError{cause: mimirpb.TENANT_LIMIT},
+			expected: false,
+		},
+		"TSDB unavailable": {
+			err:      ingesterPushError{cause: mimirpb.TSDB_UNAVAILABLE},
+			expected: true,
+		},
+		"circuit breaker open": {
+			err:      ingesterPushError{cause: mimirpb.CIRCUIT_BREAKER_OPEN},
+			expected: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, isIngesterAvailabilityError(tc.err))
+		})
+	}
+}
+
+func testDiskBufferConfig(t *testing.T) DiskBufferConfig {
+	return DiskBufferConfig{
+		Enabled:        true,
+		Directory:      t.TempDir(),
+		MaxSizeBytes:   1 << 20,
+		ReplayInterval: 10 * time.Millisecond,
+	}
+}
+
+func makeDiskBufferWriteRequest(metric string) *mimirpb.WriteRequest {
+	return &mimirpb.WriteRequest{
+		Timeseries: []mimirpb.PreallocTimeseries{
+			makeTimeseries([]string{model.MetricNameLabel, metric}, makeSamples(1000, 1), nil, nil),
+		},
+	}
+}
+
+func mustMarshalDiskBufferEntry(t *testing.T, req *mimirpb.WriteRequest) []byte {
+	data, err := req.Marshal()
+	require.NoError(t, err)
+	return snappy.Encode(nil, data)
+}
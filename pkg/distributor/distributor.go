@@ -23,6 +23,7 @@ import (
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/grafana/dskit/concurrency"
+	"github.com/grafana/dskit/grpcclient"
 	"github.com/grafana/dskit/grpcutil"
 	"github.com/grafana/dskit/httpgrpc"
 	"github.com/grafana/dskit/instrument"
@@ -51,13 +52,16 @@ import (
 
 	"github.com/grafana/mimir/pkg/cardinality"
 	"github.com/grafana/mimir/pkg/costattribution"
+	"github.com/grafana/mimir/pkg/distributor/graphitepush"
 	ingester_client "github.com/grafana/mimir/pkg/ingester/client"
 	"github.com/grafana/mimir/pkg/mimirpb"
 	"github.com/grafana/mimir/pkg/querier/stats"
 	"github.com/grafana/mimir/pkg/storage/ingest"
+	"github.com/grafana/mimir/pkg/tenantusage"
 	"github.com/grafana/mimir/pkg/util"
 	"github.com/grafana/mimir/pkg/util/extract"
 	"github.com/grafana/mimir/pkg/util/globalerror"
+	"github.com/grafana/mimir/pkg/util/grpcencoding/s2"
 	mimir_limiter "github.com/grafana/mimir/pkg/util/limiter"
 	util_math "github.com/grafana/mimir/pkg/util/math"
 	"github.com/grafana/mimir/pkg/util/pool"
@@ -75,7 +79,10 @@ func init() {
 
 var (
 	// Validation errors.
-	errInvalidTenantShardSize = errors.New("invalid tenant shard size, the value must be greater than or equal to zero")
+	errInvalidTenantShardSize                        = errors.New("invalid tenant shard size, the value must be greater than or equal to zero")
+	errInvalidOTelDeltaToCumulativeStreamIdleTimeout = errors.New("invalid OTLP delta-to-cumulative stream idle timeout, the value must be greater than zero")
+	errInvalidOTelDeltaToCumulativeForwardTimeout    = errors.New("invalid OTLP delta-to-cumulative forward timeout, the value must be greater than zero")
+	errInvalidInfluxV2TenantFrom                     = fmt.Errorf("invalid InfluxDB v2 tenant source, supported values are: %s", strings.Join(influxV2TenantFromValues, ", "))
 
 	reasonDistributorMaxIngestionRate             = globalerror.DistributorMaxIngestionRate.LabelValue()
 	reasonDistributorMaxInflightPushRequests      = globalerror.DistributorMaxInflightPushRequests.LabelValue()
@@ -89,8 +96,10 @@ const (
 	// metaLabelTenantID is the name of the metric_relabel_configs label with tenant ID.
 	metaLabelTenantID = model.MetaLabelPrefix + "tenant_id"
 
-	maxOTLPRequestSizeFlag   = "distributor.max-otlp-request-size"
-	maxInfluxRequestSizeFlag = "distributor.max-influx-request-size"
+	maxOTLPRequestSizeFlag     = "distributor.max-otlp-request-size"
+	maxInfluxRequestSizeFlag   = "distributor.max-influx-request-size"
+	maxDatadogRequestSizeFlag  = "distributor.max-datadog-request-size"
+	maxGraphiteRequestSizeFlag = "distributor.max-graphite-request-size"
 
 	instanceIngestionRateTickInterval = time.Second
 
@@ -128,6 +137,19 @@ type Distributor struct {
 	requestRateLimiter   *limiter.RateLimiter
 	ingestionRateLimiter *limiter.RateLimiter
 
+	// Rate limiter of the per-tenant metric limits, and the matcher finding the metric limit applied to a series.
+	metricIngestionRateLimiter *limiter.RateLimiter
+	metricLimitMatcher         *validation.MetricLimitMatcher
+
+	// Sampling and prioritisation of the exemplars by the per-tenant exemplar policies.
+	exemplarPolicies *exemplarPolicies
+
+	// Per-tenant index of the metric schemas, by metric name.
+	metricSchemaIndexes *metricSchemaIndexCache
+
+	// dryRun evaluates the dry-run pushes with the push middlewares, if the dry-run endpoints are enabled.
+	dryRun *Distributor
+
 	// Manager for subservices (HA Tracker, distributor ring and client pool)
 	subservices        *services.Manager
 	subservicesWatcher *services.FailureWatcher
@@ -169,6 +191,7 @@ type Distributor struct {
 	discardedRequestsRateLimited      *prometheus.CounterVec
 	discardedExemplarsRateLimited     *prometheus.CounterVec
 	discardedMetadataRateLimited      *prometheus.CounterVec
+	discardedSamplesMetricRateLimited *validation.DiscardedSamplesCounters
 
 	// Metrics for data rejected for hitting per-instance limits
 	rejectedRequests *prometheus.CounterVec
@@ -180,10 +203,28 @@ type Distributor struct {
 	// Metrics to be passed to distributor push handlers
 	PushMetrics *PushMetrics
 
+	// Metrics to be passed to the push handlers of the dry-run endpoints. They aren't registered.
+	DryRunPushMetrics *PushMetrics
+
 	PushWithMiddlewares PushFunc
 
 	RequestBufferPool util.Pool
 
+	// GraphiteMappers caches the compiled Graphite mapping rules of each tenant.
+	GraphiteMappers *graphitepush.MapperCache
+
+	// OTLPDeltaToCumulative converts OTLP delta metrics into cumulative ones, for the tenants enabling it.
+	OTLPDeltaToCumulative *DeltaToCumulativeConverter
+
+	// StreamingAggregator aggregates series at ingestion, if the streaming aggregation is enabled.
+	StreamingAggregator *StreamingAggregator
+
+	// RemoteWriteForwarder forwards series to remote write endpoints, if the remote write forwarding is enabled.
+	RemoteWriteForwarder *RemoteWriteForwarder
+
+	// DiskBuffer buffers on disk the write requests failed because the ingesters were unavailable, if the disk buffer is enabled.
+	DiskBuffer *DiskBuffer
+
 	// Pool of []byte used when marshalling write requests.
 	writeRequestBytePool sync.Pool
 
@@ -220,9 +261,15 @@ type Config struct {
 	RetryConfig     RetryConfig     `yaml:"retry_after_header"`
 	HATrackerConfig HATrackerConfig `yaml:"ha_tracker"`
 
+	StreamingAggregationConfig  StreamingAggregationConfig  `yaml:"streaming_aggregation"`
+	RemoteWriteForwardingConfig RemoteWriteForwardingConfig `yaml:"remote_write_forwarding"`
+	DiskBufferConfig            DiskBufferConfig            `yaml:"disk_buffer"`
+
 	MaxRecvMsgSize           int           `yaml:"max_recv_msg_size" category:"advanced"`
 	MaxOTLPRequestSize       int           `yaml:"max_otlp_request_size" category:"experimental"`
 	MaxInfluxRequestSize     int           `yaml:"max_influx_request_size" category:"experimental" doc:"hidden"`
+	MaxDatadogRequestSize    int           `yaml:"max_datadog_request_size" category:"experimental"`
+	MaxGraphiteRequestSize   int           `yaml:"max_graphite_request_size" category:"experimental"`
 	MaxRequestPoolBufferSize int           `yaml:"max_request_pool_buffer_size" category:"experimental"`
 	RemoteTimeout            time.Duration `yaml:"remote_timeout" category:"advanced"`
 
@@ -265,11 +312,31 @@ type Config struct {
 	// OTelResourceAttributePromotionConfig allows for specializing OTel resource attribute promotion.
 	OTelResourceAttributePromotionConfig OTelResourceAttributePromotionConfig `yaml:"-"`
 
+	// TenantUsageTracker is dynamically injected when the tenant usage tracking is enabled.
+	TenantUsageTracker *tenantusage.Tracker `yaml:"-"`
+
 	// Influx endpoint disabled by default
-	EnableInfluxEndpoint bool `yaml:"influx_endpoint_enabled" category:"experimental" doc:"hidden"`
+	EnableInfluxEndpoint bool   `yaml:"influx_endpoint_enabled" category:"experimental" doc:"hidden"`
+	InfluxV2TenantFrom   string `yaml:"influx_v2_tenant_from" category:"experimental"`
+
+	// Datadog endpoint disabled by default
+	EnableDatadogEndpoint bool `yaml:"datadog_endpoint_enabled" category:"experimental"`
+
+	// Graphite endpoint disabled by default
+	EnableGraphiteEndpoint bool `yaml:"graphite_endpoint_enabled" category:"experimental"`
+
+	// OTLP gRPC endpoint disabled by default
+	EnableOTLPGRPCEndpoint bool `yaml:"otlp_grpc_endpoint_enabled" category:"experimental"`
+
+	// Dry-run endpoints disabled by default
+	EnableDryRunEndpoints bool `yaml:"dry_run_endpoints_enabled" category:"experimental"`
 
 	// Change the implementation of OTel startTime from a real zero to a special NaN value.
 	EnableStartTimeQuietZero bool `yaml:"start_time_quiet_zero" category:"advanced" doc:"hidden"`
+
+	OTelDeltaToCumulativeStreamIdleTimeout time.Duration     `yaml:"otel_delta_to_cumulative_stream_idle_timeout" category:"experimental"`
+	OTelDeltaToCumulativeForwardTimeout    time.Duration     `yaml:"otel_delta_to_cumulative_forward_timeout" category:"experimental"`
+	OTelDeltaToCumulativeGRPCClientConfig  grpcclient.Config `yaml:"otel_delta_to_cumulative_grpc_client_config" doc:"description=Configures the gRPC client used to forward the OTLP delta data points to the distributor owning their stream."`
 }
 
 // PushWrapper wraps around a push. It is similar to middleware.Interface.
@@ -281,16 +348,31 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet, logger log.Logger) {
 	cfg.HATrackerConfig.RegisterFlags(f)
 	cfg.DistributorRing.RegisterFlags(f, logger)
 	cfg.RetryConfig.RegisterFlags(f)
+	cfg.StreamingAggregationConfig.RegisterFlags(f)
+	cfg.RemoteWriteForwardingConfig.RegisterFlags(f)
+	cfg.DiskBufferConfig.RegisterFlags(f)
 
 	f.IntVar(&cfg.MaxRecvMsgSize, "distributor.max-recv-msg-size", 100<<20, "Max message size in bytes that the distributors will accept for incoming push requests to the remote write API. If exceeded, the request will be rejected.")
 	f.IntVar(&cfg.MaxOTLPRequestSize, maxOTLPRequestSizeFlag, 100<<20, "Maximum OTLP request size in bytes that the distributors accept. Requests exceeding this limit are rejected.")
 	f.IntVar(&cfg.MaxInfluxRequestSize, maxInfluxRequestSizeFlag, 100<<20, "Maximum Influx request size in bytes that the distributors accept. Requests exceeding this limit are rejected.")
+	f.IntVar(&cfg.MaxDatadogRequestSize, maxDatadogRequestSizeFlag, 100<<20, "Maximum uncompressed Datadog request size in bytes that the distributors accept. Requests exceeding this limit are rejected.")
+	f.IntVar(&cfg.MaxGraphiteRequestSize, maxGraphiteRequestSizeFlag, 100<<20, "Maximum uncompressed Graphite request size in bytes that the distributors accept. Requests exceeding this limit are rejected.")
 	f.IntVar(&cfg.MaxRequestPoolBufferSize, "distributor.max-request-pool-buffer-size", 0, "Max size of the pooled buffers used for marshaling write requests. If 0, no max size is enforced.")
 	f.DurationVar(&cfg.RemoteTimeout, "distributor.remote-timeout", 2*time.Second, "Timeout for downstream ingesters.")
 	f.BoolVar(&cfg.WriteRequestsBufferPoolingEnabled, "distributor.write-requests-buffer-pooling-enabled", true, "Enable pooling of buffers used for marshaling write requests.")
 	f.BoolVar(&cfg.EnableInfluxEndpoint, "distributor.influx-endpoint-enabled", false, "Enable Influx endpoint.")
+	f.StringVar(&cfg.InfluxV2TenantFrom, "distributor.influx-v2-tenant-from", InfluxV2TenantFromAuth, fmt.Sprintf("Which parameter of the requests received on the InfluxDB v2 write API must match the tenant. Supported values are: %s. The tenant is always the one authenticated by the auth middleware, as for the other endpoints, and the Authorization header, holding the InfluxDB token, is forwarded to it. With %q, the organization and the bucket of the requests aren't checked. With %q or %q, the requests whose organization or bucket isn't the authenticated tenant are rejected. The organization and the bucket are set by the client, so they must never be used to select the tenant.", strings.Join(influxV2TenantFromValues, ", "), InfluxV2TenantFromAuth, InfluxV2TenantFromOrg, InfluxV2TenantFromBucket))
+	f.BoolVar(&cfg.EnableDatadogEndpoint, "distributor.datadog-endpoint-enabled", false, "Enable the Datadog series endpoints, accepting the payloads of the Datadog /api/v1/series and /api/v2/series APIs under the /datadog path prefix.")
+	f.BoolVar(&cfg.EnableGraphiteEndpoint, "distributor.graphite-endpoint-enabled", false, "Enable the Graphite endpoint, accepting the Graphite plaintext protocol, including tagged metrics. The metric paths are mapped to metric names and labels with the per-tenant Graphite mapping rules.")
+	f.BoolVar(&cfg.EnableOTLPGRPCEndpoint, "distributor.otlp-grpc-endpoint-enabled", false, "Enable the OTLP gRPC endpoint, exposing the OTLP MetricsService on the gRPC server. Requests are subject to the same limits as the OTLP HTTP endpoint, including -"+maxOTLPRequestSizeFlag+".")
+	f.BoolVar(&cfg.EnableDryRunEndpoints, "distributor.dry-run-endpoints-enabled", false, "Enable the dry-run endpoints, accepting the same requests as the remote write, OTLP and Influx endpoints under the /dry-run path suffix. The series are evaluated by the distributor middlewares, such as the HA deduplication, relabeling and validation, without being ingested, and the response reports whether each series would be accepted, modified or rejected, and why.")
 	f.IntVar(&cfg.ReusableIngesterPushWorkers, "distributor.reusable-ingester-push-workers", 2000, "Number of pre-allocated workers used to forward push requests to the ingesters. If 0, no workers will be used and a new goroutine will be spawned for each ingester push request. If not enough workers available, new goroutine will be spawned. (Note: this is a performance optimization, not a limiting feature.)")
 	f.BoolVar(&cfg.EnableStartTimeQuietZero, "distributor.otel-start-time-quiet-zero", false, "Change the implementation of OTel startTime from a real zero to a special NaN value.")
+	f.DurationVar(&cfg.OTelDeltaToCumulativeStreamIdleTimeout, "distributor.otel-delta-to-cumulative-stream-idle-timeout", 5*time.Minute, "How long the state of an OTLP delta stream is kept by the delta-to-cumulative conversion after its last data point. The next data point of an expired stream restarts the cumulative total from zero. Applies to the tenants with -distributor.otel-convert-delta-to-cumulative enabled.")
+	f.DurationVar(&cfg.OTelDeltaToCumulativeForwardTimeout, "distributor.otel-delta-to-cumulative-forward-timeout", 2*time.Second, "Timeout for forwarding the OTLP delta data points to the distributor owning their stream, when converting them into cumulative ones.")
+
+	cfg.OTelDeltaToCumulativeGRPCClientConfig.CustomCompressors = []string{s2.Name}
+	cfg.OTelDeltaToCumulativeGRPCClientConfig.RegisterFlagsWithPrefix("distributor.otel-delta-to-cumulative-grpc-client-config", f)
 
 	cfg.DefaultLimits.RegisterFlags(f)
 }
@@ -301,6 +383,34 @@ func (cfg *Config) Validate(limits validation.Limits) error {
 		return errInvalidTenantShardSize
 	}
 
+	if cfg.OTelDeltaToCumulativeStreamIdleTimeout <= 0 {
+		return errInvalidOTelDeltaToCumulativeStreamIdleTimeout
+	}
+
+	if cfg.OTelDeltaToCumulativeForwardTimeout <= 0 {
+		return errInvalidOTelDeltaToCumulativeForwardTimeout
+	}
+
+	if err := cfg.OTelDeltaToCumulativeGRPCClientConfig.Validate(); err != nil {
+		return err
+	}
+
+	if !slices.Contains(influxV2TenantFromValues, cfg.InfluxV2TenantFrom) {
+		return errInvalidInfluxV2TenantFrom
+	}
+
+	if err := cfg.StreamingAggregationConfig.Validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.RemoteWriteForwardingConfig.Validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.DiskBufferConfig.Validate(); err != nil {
+		return err
+	}
+
 	return cfg.RetryConfig.Validate()
 }
 
@@ -314,9 +424,20 @@ type PushMetrics struct {
 	// Influx metrics.
 	influxRequestCounter       *prometheus.CounterVec
 	influxUncompressedBodySize *prometheus.HistogramVec
+	// Datadog metrics.
+	datadogRequestCounter       *prometheus.CounterVec
+	datadogUncompressedBodySize *prometheus.HistogramVec
+	// Graphite metrics.
+	graphiteRequestCounter           *prometheus.CounterVec
+	graphiteUncompressedBodySize     *prometheus.HistogramVec
+	graphiteUnmappedDiscardedSamples *prometheus.CounterVec
+	graphiteInvalidDiscardedSamples  *prometheus.CounterVec
 	// OTLP metrics.
 	otlpRequestCounter   *prometheus.CounterVec
 	uncompressedBodySize *prometheus.HistogramVec
+	// Remote write metrics.
+	classicHistogramsConvertedToNHCB    *prometheus.CounterVec
+	classicHistogramsNotConvertedToNHCB *prometheus.CounterVec
 }
 
 func newPushMetrics(reg prometheus.Registerer) *PushMetrics {
@@ -332,6 +453,30 @@ func newPushMetrics(reg prometheus.Registerer) *PushMetrics {
 			NativeHistogramMinResetDuration: 1 * time.Hour,
 			NativeHistogramMaxBucketNumber:  100,
 		}, []string{"user"}),
+		datadogRequestCounter: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_distributor_datadog_requests_total",
+			Help: "The total number of Datadog requests that have come in to the distributor.",
+		}, []string{"user"}),
+		datadogUncompressedBodySize: promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+			Name:                            "cortex_distributor_datadog_uncompressed_request_body_size_bytes",
+			Help:                            "Size of uncompressed request body in bytes.",
+			NativeHistogramBucketFactor:     1.1,
+			NativeHistogramMinResetDuration: 1 * time.Hour,
+			NativeHistogramMaxBucketNumber:  100,
+		}, []string{"user"}),
+		graphiteRequestCounter: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_distributor_graphite_requests_total",
+			Help: "The total number of Graphite requests that have come in to the distributor.",
+		}, []string{"user"}),
+		graphiteUncompressedBodySize: promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+			Name:                            "cortex_distributor_graphite_uncompressed_request_body_size_bytes",
+			Help:                            "Size of uncompressed request body in bytes.",
+			NativeHistogramBucketFactor:     1.1,
+			NativeHistogramMinResetDuration: 1 * time.Hour,
+			NativeHistogramMaxBucketNumber:  100,
+		}, []string{"user"}),
+		graphiteUnmappedDiscardedSamples: validation.DiscardedSamplesCounter(reg, graphiteUnmapped),
+		graphiteInvalidDiscardedSamples:  validation.DiscardedSamplesCounter(reg, graphiteInvalid),
 		otlpRequestCounter: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
 			Name: "cortex_distributor_otlp_requests_total",
 			Help: "The total number of OTLP requests that have come in to the distributor.",
@@ -343,6 +488,14 @@ func newPushMetrics(reg prometheus.Registerer) *PushMetrics {
 			NativeHistogramMinResetDuration: 1 * time.Hour,
 			NativeHistogramMaxBucketNumber:  100,
 		}, []string{"user"}),
+		classicHistogramsConvertedToNHCB: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_distributor_classic_histograms_converted_to_nhcb_total",
+			Help: "The total number of classic histograms received through Prometheus remote write and converted into native histograms with custom buckets.",
+		}, []string{"user"}),
+		classicHistogramsNotConvertedToNHCB: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_distributor_classic_histograms_not_converted_to_nhcb_total",
+			Help: "The total number of classic histograms received through Prometheus remote write and not converted into native histograms with custom buckets, because their series were incomplete in the request.",
+		}, []string{"user"}),
 	}
 }
 
@@ -358,6 +511,42 @@ func (m *PushMetrics) ObserveInfluxUncompressedBodySize(user string, size float6
 	}
 }
 
+func (m *PushMetrics) IncDatadogRequest(user string) {
+	if m != nil {
+		m.datadogRequestCounter.WithLabelValues(user).Inc()
+	}
+}
+
+func (m *PushMetrics) ObserveDatadogUncompressedBodySize(user string, size float64) {
+	if m != nil {
+		m.datadogUncompressedBodySize.WithLabelValues(user).Observe(size)
+	}
+}
+
+func (m *PushMetrics) IncGraphiteRequest(user string) {
+	if m != nil {
+		m.graphiteRequestCounter.WithLabelValues(user).Inc()
+	}
+}
+
+func (m *PushMetrics) ObserveGraphiteUncompressedBodySize(user string, size float64) {
+	if m != nil {
+		m.graphiteUncompressedBodySize.WithLabelValues(user).Observe(size)
+	}
+}
+
+func (m *PushMetrics) IncGraphiteUnmappedDiscardedSamples(user string, count int) {
+	if m != nil {
+		m.graphiteUnmappedDiscardedSamples.WithLabelValues(user, "").Add(float64(count))
+	}
+}
+
+func (m *PushMetrics) IncGraphiteInvalidDiscardedSamples(user string, count int) {
+	if m != nil {
+		m.graphiteInvalidDiscardedSamples.WithLabelValues(user, "").Add(float64(count))
+	}
+}
+
 func (m *PushMetrics) IncOTLPRequest(user string) {
 	if m != nil {
 		m.otlpRequestCounter.WithLabelValues(user).Inc()
@@ -370,11 +559,30 @@ func (m *PushMetrics) ObserveUncompressedBodySize(user string, size float64) {
 	}
 }
 
+func (m *PushMetrics) AddClassicHistogramsConvertedToNHCB(user string, converted, notConverted int) {
+	if m != nil {
+		if converted > 0 {
+			m.classicHistogramsConvertedToNHCB.WithLabelValues(user).Add(float64(converted))
+		}
+		if notConverted > 0 {
+			m.classicHistogramsNotConvertedToNHCB.WithLabelValues(user).Add(float64(notConverted))
+		}
+	}
+}
+
 func (m *PushMetrics) deleteUserMetrics(user string) {
 	m.influxRequestCounter.DeleteLabelValues(user)
 	m.influxUncompressedBodySize.DeleteLabelValues(user)
+	m.datadogRequestCounter.DeleteLabelValues(user)
+	m.datadogUncompressedBodySize.DeleteLabelValues(user)
+	m.graphiteRequestCounter.DeleteLabelValues(user)
+	m.graphiteUncompressedBodySize.DeleteLabelValues(user)
+	m.graphiteUnmappedDiscardedSamples.DeletePartialMatch(prometheus.Labels{"user": user})
+	m.graphiteInvalidDiscardedSamples.DeletePartialMatch(prometheus.Labels{"user": user})
 	m.otlpRequestCounter.DeleteLabelValues(user)
 	m.uncompressedBodySize.DeleteLabelValues(user)
+	m.classicHistogramsConvertedToNHCB.DeleteLabelValues(user)
+	m.classicHistogramsNotConvertedToNHCB.DeleteLabelValues(user)
 }
 
 // New constructs a new Distributor
@@ -395,6 +603,7 @@ func New(cfg Config, clientConfig ingester_client.Config, limits *validation.Ove
 		log:                   log,
 		ingestersRing:         ingestersRing,
 		RequestBufferPool:     requestBufferPool,
+		GraphiteMappers:       graphitepush.NewMapperCache(),
 		partitionsRing:        partitionsRing,
 		ingesterPool:          NewPool(cfg.PoolConfig, ingestersRing, cfg.IngesterClientFactory, log),
 		healthyInstancesCount: atomic.NewUint32(0),
@@ -496,6 +705,7 @@ func New(cfg Config, clientConfig ingester_client.Config, limits *validation.Ove
 		discardedRequestsRateLimited:      validation.DiscardedRequestsCounter(reg, reasonRateLimited),
 		discardedExemplarsRateLimited:     validation.DiscardedExemplarsCounter(reg, reasonRateLimited),
 		discardedMetadataRateLimited:      validation.DiscardedMetadataCounter(reg, reasonRateLimited),
+		discardedSamplesMetricRateLimited: validation.NewDiscardedSamplesCounters(reg),
 
 		rejectedRequests: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
 			Name: "cortex_distributor_instance_rejected_requests_total",
@@ -511,9 +721,10 @@ func New(cfg Config, clientConfig ingester_client.Config, limits *validation.Ove
 			Help: "Number of times a hash collision was detected when de-duplicating samples.",
 		}),
 
-		PushMetrics: newPushMetrics(reg),
-		now:         defaultNow,
-		sleep:       defaultSleep,
+		PushMetrics:       newPushMetrics(reg),
+		DryRunPushMetrics: newPushMetrics(nil),
+		now:               defaultNow,
+		sleep:             defaultSleep,
 	}
 
 	// Initialize expected rejected request labels
@@ -568,7 +779,7 @@ func New(cfg Config, clientConfig ingester_client.Config, limits *validation.Ove
 	// Create the configured ingestion rate limit strategy (local or global). In case
 	// it's an internal dependency and we can't join the distributors ring, we skip rate
 	// limiting.
-	var ingestionRateStrategy, requestRateStrategy limiter.RateLimiterStrategy
+	var ingestionRateStrategy, requestRateStrategy, metricIngestionRateStrategy limiter.RateLimiterStrategy
 	var distributorsLifecycler *ring.BasicLifecycler
 	var distributorsRing *ring.Ring
 	var err error
@@ -576,6 +787,7 @@ func New(cfg Config, clientConfig ingester_client.Config, limits *validation.Ove
 	if !canJoinDistributorsRing {
 		requestRateStrategy = newInfiniteRateStrategy()
 		ingestionRateStrategy = newInfiniteRateStrategy()
+		metricIngestionRateStrategy = newInfiniteRateStrategy()
 	} else {
 		distributorsRing, distributorsLifecycler, err = newRingAndLifecycler(cfg.DistributorRing, d.healthyInstancesCount, log, reg)
 		if err != nil {
@@ -585,6 +797,7 @@ func New(cfg Config, clientConfig ingester_client.Config, limits *validation.Ove
 		subservices = append(subservices, distributorsLifecycler, distributorsRing)
 		requestRateStrategy = newGlobalRateStrategy(newRequestRateStrategy(limits), d)
 		ingestionRateStrategy = newGlobalRateStrategyWithBurstFactor(limits, d)
+		metricIngestionRateStrategy = newGlobalRateStrategy(newMetricIngestionRateStrategy(limits), d)
 	}
 
 	// If this isn't a real distributor that will be accepting writes or if the HA tracker is
@@ -606,6 +819,10 @@ func New(cfg Config, clientConfig ingester_client.Config, limits *validation.Ove
 
 	d.requestRateLimiter = limiter.NewRateLimiter(requestRateStrategy, 10*time.Second)
 	d.ingestionRateLimiter = limiter.NewRateLimiter(ingestionRateStrategy, 10*time.Second)
+	d.metricIngestionRateLimiter = limiter.NewRateLimiter(metricIngestionRateStrategy, 10*time.Second)
+	d.metricLimitMatcher = validation.NewMetricLimitMatcher()
+	d.exemplarPolicies = newExemplarPolicies(limits)
+	d.metricSchemaIndexes = newMetricSchemaIndexCache()
 	d.distributorsLifecycler = distributorsLifecycler
 	d.distributorsRing = distributorsRing
 	d.HATracker = haTrackerImpl
@@ -615,7 +832,42 @@ func New(cfg Config, clientConfig ingester_client.Config, limits *validation.Ove
 
 	d.PushWithMiddlewares = d.wrapPushWithMiddlewares(d.push)
 
-	subservices = append(subservices, d.ingesterPool, d.activeUsers)
+	var instanceID string
+	if distributorsLifecycler != nil {
+		instanceID = distributorsLifecycler.GetInstanceID()
+	}
+	// The state of the OTLP delta streams and of the streaming aggregation output series is owned by the
+	// healthy distributors of the ring, if any.
+	var ownersRing ring.ReadRing
+	if distributorsRing != nil {
+		ownersRing = distributorsRing
+	}
+	d.OTLPDeltaToCumulative = NewDeltaToCumulativeConverter(cfg.OTelDeltaToCumulativeStreamIdleTimeout, cfg.OTelDeltaToCumulativeForwardTimeout, cfg.OTelDeltaToCumulativeGRPCClientConfig, ownersRing, instanceID, log, reg)
+
+	subservices = append(subservices, d.ingesterPool, d.activeUsers, d.OTLPDeltaToCumulative)
+
+	if cfg.StreamingAggregationConfig.Enabled {
+		d.StreamingAggregator = NewStreamingAggregator(cfg.StreamingAggregationConfig, limits, d.PushWithMiddlewares, ownersRing, instanceID, log, reg)
+		subservices = append(subservices, d.StreamingAggregator)
+	}
+
+	if cfg.RemoteWriteForwardingConfig.Enabled {
+		d.RemoteWriteForwarder = NewRemoteWriteForwarder(cfg.RemoteWriteForwardingConfig, limits, log, reg)
+		subservices = append(subservices, d.RemoteWriteForwarder)
+	}
+
+	if cfg.EnableDryRunEndpoints && canJoinDistributorsRing {
+		d.dryRun, err = newDryRunDistributor(cfg, clientConfig, limits, haTrackerImpl, ingestersRing, partitionsRing, log)
+		if err != nil {
+			return nil, err
+		}
+		subservices = append(subservices, d.dryRun)
+	}
+
+	if cfg.DiskBufferConfig.Enabled {
+		d.DiskBuffer = NewDiskBuffer(cfg.DiskBufferConfig, limits, d.replayBufferedWriteRequest, log, reg)
+		subservices = append(subservices, d.DiskBuffer)
+	}
 
 	if cfg.ReusableIngesterPushWorkers > 0 {
 		wp := concurrency.NewReusableGoroutinesPool(cfg.ReusableIngesterPushWorkers)
@@ -756,6 +1008,24 @@ func (d *Distributor) cleanupInactiveUser(userID string) {
 	d.latestSeenSampleTimestampPerUser.DeleteLabelValues(userID)
 
 	d.PushMetrics.deleteUserMetrics(userID)
+	d.DryRunPushMetrics.deleteUserMetrics(userID)
+	d.OTLPDeltaToCumulative.cleanupTenantMetrics(userID)
+	d.GraphiteMappers.Delete(userID)
+	if d.StreamingAggregator != nil {
+		d.StreamingAggregator.cleanupTenantMetrics(userID)
+	}
+	if d.RemoteWriteForwarder != nil {
+		d.RemoteWriteForwarder.cleanupTenantMetrics(userID)
+	}
+	if d.DiskBuffer != nil {
+		d.DiskBuffer.cleanupTenantMetrics(userID)
+	}
+	if d.exemplarPolicies != nil {
+		d.exemplarPolicies.cleanupTenant(userID)
+	}
+	if d.metricSchemaIndexes != nil {
+		d.metricSchemaIndexes.cleanupTenant(userID)
+	}
 
 	d.droppedNativeHistograms.DeleteLabelValues(userID)
 
@@ -767,6 +1037,7 @@ func (d *Distributor) cleanupInactiveUser(userID string) {
 	d.discardedRequestsRateLimited.DeleteLabelValues(userID)
 	d.discardedExemplarsRateLimited.DeleteLabelValues(userID)
 	d.discardedMetadataRateLimited.DeleteLabelValues(userID)
+	d.discardedSamplesMetricRateLimited.DeletePartialMatch(filter)
 
 	d.sampleValidationMetrics.deleteUserMetrics(userID)
 	d.exemplarValidationMetrics.deleteUserMetrics(userID)
@@ -777,6 +1048,7 @@ func (d *Distributor) RemoveGroupMetricsForUser(userID, group string) {
 	d.dedupedSamples.DeleteLabelValues(userID, group)
 	d.discardedSamplesTooManyHaClusters.DeleteLabelValues(userID, group)
 	d.discardedSamplesRateLimited.DeleteLabelValues(userID, group)
+	d.discardedSamplesMetricRateLimited.DeletePartialMatch(prometheus.Labels{"user": userID, "group": group})
 	d.sampleValidationMetrics.deleteUserMetricsForGroup(userID, group)
 }
 
@@ -917,19 +1189,11 @@ func (d *Distributor) validateHistograms(now model.Time, ts *mimirpb.PreallocTim
 
 // validateExemplars validates exemplars of a single timeseries.
 // May alter timeseries data in-place.
-func (d *Distributor) validateExemplars(ts *mimirpb.PreallocTimeseries, userID string, minExemplarTS, maxExemplarTS int64) {
+func (d *Distributor) validateExemplars(now time.Time, ts *mimirpb.PreallocTimeseries, userID string, minExemplarTS, maxExemplarTS int64) {
 	if d.limits.MaxGlobalExemplarsPerUser(userID) == 0 {
 		ts.ClearExemplars()
 		return
 	}
-	allowedExemplars := d.limits.MaxExemplarsPerSeriesPerRequest(userID)
-	if allowedExemplars > 0 && len(ts.Exemplars) > allowedExemplars {
-		d.exemplarValidationMetrics.tooManyExemplars.WithLabelValues(userID).Add(float64(len(ts.Exemplars) - allowedExemplars))
-		ts.ResizeExemplars(allowedExemplars)
-	}
-
-	var previousExemplarTS int64 = math.MinInt64
-	isInOrder := true
 	for i := 0; i < len(ts.Exemplars); {
 		e := ts.Exemplars[i]
 		if err := validateExemplar(d.exemplarValidationMetrics, userID, ts.Labels, e); err != nil {
@@ -943,15 +1207,34 @@ func (d *Distributor) validateExemplars(ts *mimirpb.PreallocTimeseries, userID s
 			// Don't increase index i. After moving the last exemplar to this index, we want to check it again.
 			continue
 		}
-		// We want to check if exemplars are in order. If they are not, we will sort them and invalidate the cache.
-		if isInOrder && previousExemplarTS > e.TimestampMs {
-			isInOrder = false
-		}
-		previousExemplarTS = e.TimestampMs
 		i++
 	}
-	if !isInOrder {
-		ts.SortExemplars()
+
+	// The exemplar policies are applied to the valid exemplars only, so that the invalid ones don't use the rate of the policies.
+	if d.exemplarPolicies != nil {
+		sampledOut, quotaExceeded := d.exemplarPolicies.apply(now, userID, ts)
+		if sampledOut > 0 {
+			d.exemplarValidationMetrics.sampledOut.WithLabelValues(userID).Add(float64(sampledOut))
+		}
+		if quotaExceeded > 0 {
+			d.exemplarValidationMetrics.quotaExceeded.WithLabelValues(userID).Add(float64(quotaExceeded))
+		}
+	}
+	// The exemplars prioritised by the exemplar policies have been moved first, so they're kept.
+	allowedExemplars := d.limits.MaxExemplarsPerSeriesPerRequest(userID)
+	if allowedExemplars > 0 && len(ts.Exemplars) > allowedExemplars {
+		d.exemplarValidationMetrics.tooManyExemplars.WithLabelValues(userID).Add(float64(len(ts.Exemplars) - allowedExemplars))
+		ts.ResizeExemplars(allowedExemplars)
+	}
+
+	// We want to check if exemplars are in order. If they are not, we will sort them and invalidate the cache.
+	var previousExemplarTS int64 = math.MinInt64
+	for _, e := range ts.Exemplars {
+		if previousExemplarTS > e.TimestampMs {
+			ts.SortExemplars()
+			break
+		}
+		previousExemplarTS = e.TimestampMs
 	}
 }
 
@@ -977,7 +1260,7 @@ func (d *Distributor) validateSeries(nowt time.Time, ts *mimirpb.PreallocTimeser
 		return err
 	}
 
-	d.validateExemplars(ts, userID, minExemplarTS, maxExemplarTS)
+	d.validateExemplars(nowt, ts, userID, minExemplarTS, maxExemplarTS)
 
 	deduplicatedSamplesAndHistograms := totalSamplesAndHistograms - len(ts.Samples) - len(ts.Histograms)
 	if deduplicatedSamplesAndHistograms > 0 {
@@ -1001,6 +1284,8 @@ func (d *Distributor) wrapPushWithMiddlewares(next PushFunc) PushFunc {
 	middlewares = append(middlewares, d.prePushRelabelMiddleware)
 	middlewares = append(middlewares, d.prePushSortAndFilterMiddleware)
 	middlewares = append(middlewares, d.prePushValidationMiddleware)
+	middlewares = append(middlewares, d.prePushStreamingAggregationMiddleware) // Only aggregates the series which passed the validation.
+	middlewares = append(middlewares, d.prePushRemoteWriteForwardingMiddleware)
 	middlewares = append(middlewares, d.cfg.PushWrappers...)
 
 	for ix := len(middlewares) - 1; ix >= 0; ix-- {
@@ -1032,51 +1317,109 @@ func (d *Distributor) prePushHaDedupeMiddleware(next PushFunc) PushFunc {
 		}
 
 		haReplicaLabel := d.limits.HAReplicaLabel(userID)
-		cluster, replica := findHALabels(haReplicaLabel, d.limits.HAClusterLabel(userID), req.Timeseries[0].Labels)
-		// Make a copy of these, since they may be retained as labels on our metrics, e.g. dedupedSamples.
-		cluster, replica = strings.Clone(cluster), strings.Clone(replica)
+		// The series of a request may be sent by several HA groups, for example when an agent scrapes several
+		// clusters or jobs, so the replica of each group is checked and its series are kept or dropped.
+		groups := findHAReplicaGroups(haReplicaLabel, d.limits.HAClusterLabels(userID), req.Timeseries)
 
 		span := trace.SpanFromContext(ctx)
-		span.SetAttributes(
-			attribute.String("cluster", cluster),
-			attribute.String("replica", replica),
-		)
+		if len(groups) == 1 {
+			span.SetAttributes(
+				attribute.String("cluster", groups[0].cluster),
+				attribute.String("replica", groups[0].replica),
+			)
+		} else {
+			span.SetAttributes(attribute.Int("ha_groups", len(groups)))
+		}
 
-		numSamples := 0
 		now := time.Now()
 		group := d.activeGroups.UpdateActiveGroupTimestamp(userID, validation.GroupLabel(d.limits, userID, req.Timeseries), now)
-		for _, ts := range req.Timeseries {
-			numSamples += len(ts.Samples) + len(ts.Histograms)
-		}
 
-		removeReplica, err := d.checkSample(ctx, userID, cluster, replica)
-		if err != nil {
-			if errors.As(err, &replicasDidNotMatchError{}) {
-				// These samples have been deduped.
-				d.dedupedSamples.WithLabelValues(userID, cluster).Add(float64(numSamples))
+		var (
+			removeTsIndexes []int
+			rejectErr       error
+		)
+		for _, g := range groups {
+			numSamples := 0
+			forEachHAReplicaGroupSeries(g, len(req.Timeseries), func(tsIdx int) {
+				numSamples += len(req.Timeseries[tsIdx].Samples) + len(req.Timeseries[tsIdx].Histograms)
+			})
+
+			removeReplica, err := d.checkSample(ctx, userID, g.cluster, g.replica)
+			if err != nil {
+				if errors.As(err, &replicasDidNotMatchError{}) {
+					// These samples have been deduped.
+					d.dedupedSamples.WithLabelValues(userID, g.cluster).Add(float64(numSamples))
+				}
+
+				if errors.As(err, &tooManyClustersError{}) {
+					firstTsIdx := 0
+					if g.seriesIndexes != nil {
+						firstTsIdx = g.seriesIndexes[0]
+					}
+					d.discardedSamplesTooManyHaClusters.WithLabelValues(userID, group).Add(float64(numSamples))
+					d.costAttributionMgr.SampleTracker(userID).IncrementDiscardedSamples(req.Timeseries[firstTsIdx].Labels, float64(numSamples), reasonTooManyHAClusters, now)
+				}
+
+				// The error of a group which isn't only deduped takes precedence, since it's the one the client
+				// must act on.
+				if rejectErr == nil || errors.As(rejectErr, &replicasDidNotMatchError{}) {
+					rejectErr = err
+				}
+				forEachHAReplicaGroupSeries(g, len(req.Timeseries), func(tsIdx int) {
+					removeTsIndexes = append(removeTsIndexes, tsIdx)
+				})
+				continue
 			}
 
-			if errors.As(err, &tooManyClustersError{}) {
-				d.discardedSamplesTooManyHaClusters.WithLabelValues(userID, group).Add(float64(numSamples))
-				d.costAttributionMgr.SampleTracker(userID).IncrementDiscardedSamples(req.Timeseries[0].Labels, float64(numSamples), reasonTooManyHAClusters, now)
+			if removeReplica {
+				// If we found both the cluster and replica labels, we only want to include the cluster label when
+				// storing series in Mimir. If we kept the replica label we would end up with another series for the same
+				// series we're trying to dedupe when HA tracking moves over to a different replica.
+				forEachHAReplicaGroupSeries(g, len(req.Timeseries), func(tsIdx int) {
+					req.Timeseries[tsIdx].RemoveLabel(haReplicaLabel)
+				})
+			} else {
+				// If there wasn't an error but removeReplica is false that means we didn't find both HA labels.
+				d.nonHASamples.WithLabelValues(userID).Add(float64(numSamples))
 			}
+		}
 
-			return err
+		if rejectErr == nil {
+			return next(ctx, pushReq)
+		}
+		if len(removeTsIndexes) == len(req.Timeseries) {
+			return rejectErr
 		}
 
-		if removeReplica {
-			// If we found both the cluster and replica labels, we only want to include the cluster label when
-			// storing series in Mimir. If we kept the replica label we would end up with another series for the same
-			// series we're trying to dedupe when HA tracking moves over to a different replica.
-			for ix := range req.Timeseries {
-				req.Timeseries[ix].RemoveLabel(haReplicaLabel)
-			}
-		} else {
-			// If there wasn't an error but removeReplica is false that means we didn't find both HA labels.
-			d.nonHASamples.WithLabelValues(userID).Add(float64(numSamples))
+		// Only the series of the rejected groups are dropped, and the other series are pushed.
+		slices.Sort(removeTsIndexes)
+		for _, removeTsIndex := range removeTsIndexes {
+			mimirpb.ReusePreallocTimeseries(&req.Timeseries[removeTsIndex])
 		}
+		req.Timeseries = util.RemoveSliceIndexes(req.Timeseries, removeTsIndexes)
 
-		return next(ctx, pushReq)
+		if err := next(ctx, pushReq); err != nil {
+			return err
+		}
+		if errors.As(rejectErr, &replicasDidNotMatchError{}) {
+			// The deduped series are expected to be dropped, and the other series have been pushed.
+			return nil
+		}
+		return rejectErr
+	}
+}
+
+// forEachHAReplicaGroupSeries calls f with the index of each series of the group, out of the numSeries series
+// of the request.
+func forEachHAReplicaGroupSeries(g haReplicaGroup, numSeries int, f func(tsIdx int)) {
+	if g.seriesIndexes == nil {
+		for tsIdx := 0; tsIdx < numSeries; tsIdx++ {
+			f(tsIdx)
+		}
+		return
+	}
+	for _, tsIdx := range g.seriesIndexes {
+		f(tsIdx)
 	}
 }
 
@@ -1137,6 +1480,80 @@ func (d *Distributor) prePushRelabelMiddleware(next PushFunc) PushFunc {
 	}
 }
 
+// prePushStreamingAggregationMiddleware feeds the series matching the tenant's streaming aggregation rules
+// to the streaming aggregator, and removes the ones matching a rule dropping its input.
+func (d *Distributor) prePushStreamingAggregationMiddleware(next PushFunc) PushFunc {
+	return func(ctx context.Context, pushReq *Request) error {
+		next, maybeCleanup := NextOrCleanup(next, pushReq)
+		defer maybeCleanup()
+
+		// The output series pushed by the streaming aggregator aren't aggregated again.
+		if d.StreamingAggregator == nil || isStreamingAggregationOutput(ctx) {
+			return next(ctx, pushReq)
+		}
+
+		userID, err := tenant.TenantID(ctx)
+		if err != nil {
+			return err
+		}
+
+		if len(d.limits.StreamingAggregationRules(userID)) == 0 {
+			return next(ctx, pushReq)
+		}
+
+		req, err := pushReq.WriteRequest()
+		if err != nil {
+			return err
+		}
+
+		removeTsIndexes := d.StreamingAggregator.Aggregate(ctx, userID, req.Timeseries)
+		if len(removeTsIndexes) > 0 {
+			for _, removeTsIndex := range removeTsIndexes {
+				mimirpb.ReusePreallocTimeseries(&req.Timeseries[removeTsIndex])
+			}
+			req.Timeseries = util.RemoveSliceIndexes(req.Timeseries, removeTsIndexes)
+		}
+
+		return next(ctx, pushReq)
+	}
+}
+
+// prePushRemoteWriteForwardingMiddleware enqueues the series matching the tenant's remote write forwarding rules
+// to be forwarded asynchronously to their endpoints, once they've been successfully ingested.
+func (d *Distributor) prePushRemoteWriteForwardingMiddleware(next PushFunc) PushFunc {
+	return func(ctx context.Context, pushReq *Request) error {
+		next, maybeCleanup := NextOrCleanup(next, pushReq)
+		defer maybeCleanup()
+
+		if d.RemoteWriteForwarder == nil {
+			return next(ctx, pushReq)
+		}
+
+		userID, err := tenant.TenantID(ctx)
+		if err != nil {
+			return err
+		}
+
+		if len(d.limits.RemoteWriteForwardingRules(userID)) == 0 {
+			return next(ctx, pushReq)
+		}
+
+		req, err := pushReq.WriteRequest()
+		if err != nil {
+			return err
+		}
+
+		// The series are only forwarded once they've been successfully ingested.
+		pending := d.RemoteWriteForwarder.Prepare(userID, req.Timeseries)
+		if err := next(ctx, pushReq); err != nil {
+			d.RemoteWriteForwarder.Release(pending)
+			return err
+		}
+		d.RemoteWriteForwarder.Enqueue(pending)
+		return nil
+	}
+}
+
 // prePushSortAndFilterMiddleware is responsible for sorting labels and
 // filtering empty values. This is a protection mechanism for ingesters.
 func (d *Distributor) prePushSortAndFilterMiddleware(next PushFunc) PushFunc {
@@ -1225,25 +1642,16 @@ func (d *Distributor) prePushValidationMiddleware(next PushFunc) PushFunc {
 			d.latestSeenSampleTimestampPerUser.WithLabelValues(userID).Set(float64(latestSampleTimestampMs) / 1000)
 		}
 
-		// Exemplars are not expired by Prometheus client libraries, therefore we may receive old exemplars
-		// repeated on every scrape. Drop any that are more than 5 minutes older than samples in the same batch.
-		// (If we didn't find any samples this will be 0, and we won't reject any exemplars.)
-		var minExemplarTS int64
-		if earliestSampleTimestampMs != math.MaxInt64 {
-			minExemplarTS = earliestSampleTimestampMs - 5*time.Minute.Milliseconds()
-
-			if d.limits.PastGracePeriod(userID) > 0 {
-				minExemplarTS = max(minExemplarTS, now.Add(-d.limits.PastGracePeriod(userID)).Add(-d.limits.OutOfOrderTimeWindow(userID)).UnixMilli())
-			}
-		}
-
-		// Enforce the creation grace period on exemplars too.
-		maxExemplarTS := now.Add(d.limits.CreationGracePeriod(userID)).UnixMilli()
+		minExemplarTS, maxExemplarTS := d.exemplarTimestampRange(now, userID, earliestSampleTimestampMs)
 
 		// Are we going to drop native histograms? If yes, let's count and report them.
 		countDroppedNativeHistograms := !d.limits.NativeHistogramsIngestionEnabled(userID)
 		var droppedNativeHistograms int
 
+		// The index of the metric schemas of the tenant, if any, to enforce them on each series.
+		metricSchemas := d.metricSchemaIndexes.get(userID, d.limits.MetricSchemas(userID))
+		rejectMetricSchemaViolations := d.limits.MetricSchemaViolationStrategy(userID) == validation.MetricSchemaViolationStrategyReject
+
 		var firstPartialErr error
 		var removeIndexes []int
 		totalSamples, totalExemplars := 0, 0
@@ -1283,6 +1691,17 @@ func (d *Distributor) prePushValidationMiddleware(next PushFunc) PushFunc {
 				continue
 			}
 
+			if metricSchemas != nil {
+				cat := d.costAttributionMgr.SampleTracker(userID)
+				if schemaErr := validateMetricSchema(d.sampleValidationMetrics, metricSchemas, userID, group, &req.Timeseries[tsIdx], cat, now); schemaErr != nil {
+					if rejectMetricSchemaViolations && firstPartialErr == nil {
+						firstPartialErr = newValidationError(schemaErr)
+					}
+					removeIndexes = append(removeIndexes, tsIdx)
+					continue
+				}
+			}
+
 			dedupedSamplesAndHistograms := (rawSamples - len(ts.Samples)) + (rawHistograms - len(ts.Histograms))
 			if dedupedSamplesAndHistograms > 0 {
 				if dedupedPerUnsafeMetricName == nil {
@@ -1354,6 +1773,14 @@ func (d *Distributor) prePushValidationMiddleware(next PushFunc) PushFunc {
 			req.Metadata = util.RemoveSliceIndexes(req.Metadata, removeIndexes)
 		}
 
+		if droppedSamples, droppedExemplars, err := d.enforceMetricIngestionRateLimits(now, userID, group, req); err != nil {
+			validatedSamples -= droppedSamples
+			validatedExemplars -= droppedExemplars
+			if firstPartialErr == nil {
+				firstPartialErr = newValidationError(err)
+			}
+		}
+
 		if validatedSamples == 0 && validatedMetadata == 0 {
 			return firstPartialErr
 		}
@@ -1393,6 +1820,92 @@ func (d *Distributor) prePushValidationMiddleware(next PushFunc) PushFunc {
 	}
 }
 
+// exemplarTimestampRange returns the range of the timestamps of the exemplars accepted in a request, given the
+// earliest timestamp of its samples, which is math.MaxInt64 if the request has no samples.
+func (d *Distributor) exemplarTimestampRange(now time.Time, userID string, earliestSampleTimestampMs int64) (minExemplarTS, maxExemplarTS int64) {
+	// Exemplars are not expired by Prometheus client libraries, therefore we may receive old exemplars
+	// repeated on every scrape. Drop any that are more than 5 minutes older than samples in the same batch.
+	// (If we didn't find any samples this will be 0, and we won't reject any exemplars.)
+	if earliestSampleTimestampMs != math.MaxInt64 {
+		minExemplarTS = earliestSampleTimestampMs - 5*time.Minute.Milliseconds()
+
+		if d.limits.PastGracePeriod(userID) > 0 {
+			minExemplarTS = max(minExemplarTS, now.Add(-d.limits.PastGracePeriod(userID)).Add(-d.limits.OutOfOrderTimeWindow(userID)).UnixMilli())
+		}
+	}
+
+	// Enforce the creation grace period on exemplars too.
+	maxExemplarTS = now.Add(d.limits.CreationGracePeriod(userID)).UnixMilli()
+	return minExemplarTS, maxExemplarTS
+}
+
+// enforceMetricIngestionRateLimits removes the series exceeding the ingestion rate limit of the metric limit
+// applied to them from the request. It returns the number of removed samples and exemplars, and the error
+// of the first exceeded limit.
+func (d *Distributor) enforceMetricIngestionRateLimits(now time.Time, userID, group string, req *mimirpb.WriteRequest) (droppedSamples, droppedExemplars int, err error) {
+	limits := d.limits.MetricLimits(userID)
+	if len(limits) == 0 || len(req.Timeseries) == 0 {
+		return 0, 0, nil
+	}
+
+	// The index of the metric limit applied to each series, or -1.
+	seriesLimits := make([]int, len(req.Timeseries))
+	samplesPerLimit := make([]int, len(limits))
+	for i, ts := range req.Timeseries {
+		seriesLimits[i] = d.metricLimitMatcher.Match(limits, func(name string) string {
+			for _, l := range ts.Labels {
+				if l.Name == name {
+					return l.Value
+				}
+			}
+			return ""
+		})
+		if seriesLimits[i] >= 0 {
+			samplesPerLimit[seriesLimits[i]] += len(ts.Samples) + len(ts.Histograms)
+		}
+	}
+
+	exceeded := make([]bool, len(limits))
+	anyExceeded := false
+	for i, samples := range samplesPerLimit {
+		if samples == 0 || limits[i].IngestionRate <= 0 {
+			continue
+		}
+		if !d.metricIngestionRateLimiter.AllowN(now, metricLimitKey(userID, limits[i].Match), samples) {
+			exceeded[i] = true
+			anyExceeded = true
+			if err == nil {
+				err = fmt.Errorf(metricIngestionRateLimitedMsgFormat, limits[i].Match, limits[i].IngestionRate, limits[i].Burst())
+			}
+		}
+	}
+	if !anyExceeded {
+		return 0, 0, nil
+	}
+
+	var removeIndexes []int
+	for i, ts := range req.Timeseries {
+		if seriesLimits[i] < 0 || !exceeded[seriesLimits[i]] {
+			continue
+		}
+		samples := len(ts.Samples) + len(ts.Histograms)
+		reason := reasonMetricRateLimited + ":" + limits[seriesLimits[i]].Match
+		d.costAttributionMgr.SampleTracker(userID).IncrementDiscardedSamples(ts.Labels, float64(samples), reason, now)
+		d.discardedSamplesMetricRateLimited.WithReason(reason).WithLabelValues(userID, group).Add(float64(samples))
+		droppedSamples += samples
+		droppedExemplars += len(ts.Exemplars)
+		removeIndexes = append(removeIndexes, i)
+	}
+	d.discardedExemplarsRateLimited.WithLabelValues(userID).Add(float64(droppedExemplars))
+
+	for _, removeIndex := range removeIndexes {
+		mimirpb.ReusePreallocTimeseries(&req.Timeseries[removeIndex])
+	}
+	req.Timeseries = util.RemoveSliceIndexes(req.Timeseries, removeIndexes)
+
+	return droppedSamples, droppedExemplars, err
+}
+
 // metricsMiddleware updates metrics which are expected to account for all received data,
 // including data that later gets modified or dropped.
 func (d *Distributor) metricsMiddleware(next PushFunc) PushFunc {
@@ -1767,9 +2280,59 @@ func (d *Distributor) push(ctx context.Context, pushReq *Request) error {
 	// once all backend requests have completed (see cleanup function passed to sendWriteRequestToBackends()).
 	cleanupInDefer = false
 
+	if d.DiskBuffer != nil {
+		return d.sendWriteRequestToIngestersOrDiskBuffer(ctx, userID, req, keys, initialMetadataIndex, ingestersSubring, pushReq.CleanUp)
+	}
 	return d.sendWriteRequestToBackends(ctx, userID, req, keys, initialMetadataIndex, ingestersSubring, partitionsSubring, pushReq.CleanUp)
 }
 
+// sendWriteRequestToIngestersOrDiskBuffer sends the write request to the ingesters, and buffers it on disk if it
+// failed because the ingesters were unavailable. The write requests of a tenant having write requests buffered are
+// buffered directly, so that they're replayed in order, unless the disk buffer can't hold them.
+//
+// The input cleanup function is guaranteed to be called after all requests to the ingesters have completed and
+// the write request has been buffered.
+func (d *Distributor) sendWriteRequestToIngestersOrDiskBuffer(ctx context.Context, userID string, req *mimirpb.WriteRequest, keys []uint32, initialMetadataIndex int, ingestersSubring ring.DoBatchRing, cleanup func()) error {
+	if d.DiskBuffer.Buffered(userID) {
+		if err := d.DiskBuffer.Buffer(userID, req); err == nil {
+			cleanup()
+			markWriteBuffered(ctx)
+			return nil
+		}
+	}
+
+	// The write request may be buffered once the requests to the ingesters failed, which can happen before they've
+	// all completed, so it's cleaned up once both are done.
+	cleanupWait := atomic.NewInt64(2)
+	release := func() {
+		if cleanupWait.Dec() == 0 {
+			cleanup()
+		}
+	}
+	defer release()
+
+	err := d.sendWriteRequestToBackends(ctx, userID, req, keys, initialMetadataIndex, ingestersSubring, nil, release)
+	if !isIngesterAvailabilityError(err) {
+		return err
+	}
+
+	if bufferErr := d.DiskBuffer.Buffer(userID, req); bufferErr != nil {
+		level.Warn(d.log).Log("msg", "failed to buffer write request on disk", "user", userID, "err", bufferErr)
+		return err
+	}
+	markWriteBuffered(ctx)
+	return nil
+}
+
+// replayBufferedWriteRequest sends a write request buffered on disk to the ingesters.
+func (d *Distributor) replayBufferedWriteRequest(ctx context.Context, userID string, req *mimirpb.WriteRequest) error {
+	ctx = user.InjectOrgID(ctx, userID)
+	keys, initialMetadataIndex := getSeriesAndMetadataTokens(userID, req)
+	ingestersSubring := d.ingestersRing.ShuffleShard(userID, d.limits.IngestionTenantShardSize(userID))
+
+	return d.sendWriteRequestToBackends(ctx, userID, req, keys, initialMetadataIndex, ingestersSubring, nil, func() {})
+}
+
 // sendWriteRequestToBackends sends the input req data to backends. The backends could be:
 // - Ingesters, when ingestersSubring is not nil
 // - Ingest storage partitions, when partitionsSubring is not nil
@@ -1992,6 +2555,7 @@ func (d *Distributor) updateReceivedMetrics(ctx context.Context, req *mimirpb.Wr
 		}
 	}
 	d.costAttributionMgr.SampleTracker(userID).IncrementReceivedSamples(req, mtime.Now())
+	d.cfg.TenantUsageTracker.AddSamplesIngested(userID, receivedSamples+receivedHistograms, mtime.Now())
 	receivedMetadata = len(req.Metadata)
 
 	d.receivedSamples.WithLabelValues(userID).Add(float64(receivedSamples + receivedHistograms))
@@ -0,0 +1,119 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/grpcclient"
+	"github.com/grafana/dskit/middleware"
+	"github.com/grafana/dskit/ring"
+	ring_client "github.com/grafana/dskit/ring/client"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/grafana/mimir/pkg/util"
+)
+
+// distributorOwnerOp is the operation used to select the healthy distributors owning the state of the
+// streaming aggregation output series and of the OTLP delta streams.
+var distributorOwnerOp = ring.NewOp([]ring.InstanceState{ring.ACTIVE}, nil)
+
+// healthyDistributors returns the healthy distributors of the ring, or nil if the ring is disabled or
+// can't be read, in which case the distributor owns everything.
+func healthyDistributors(distributorsRing ring.ReadRing) []ring.InstanceDesc {
+	if distributorsRing == nil {
+		return nil
+	}
+	set, err := distributorsRing.GetAllHealthy(distributorOwnerOp)
+	if err != nil {
+		return nil
+	}
+	return set.Instances
+}
+
+// rendezvousOwner returns the address of the distributor owning the state identified by keys, chosen among the
+// instances by rendezvous hashing, and whether it's the distributor with the given instance ID. Without instances,
+// the state is owned by the distributor itself.
+func rendezvousOwner(instances []ring.InstanceDesc, instanceID string, keys ...string) (string, bool) {
+	var (
+		owner     *ring.InstanceDesc
+		ownerHash uint64
+	)
+	for i := range instances {
+		h := xxhash.New()
+		for _, key := range keys {
+			_, _ = h.WriteString(key)
+		}
+		_, _ = h.WriteString(instances[i].Id)
+		if sum := h.Sum64(); owner == nil || sum > ownerHash {
+			owner, ownerHash = &instances[i], sum
+		}
+	}
+
+	if owner == nil || owner.Id == instanceID {
+		return "", true
+	}
+	return owner.Addr, false
+}
+
+// newDistributorClientsPool returns a pool of clients of the internal gRPC services of the distributors of the ring.
+func newDistributorClientsPool(cfg grpcclient.Config, distributorsRing ring.ReadRing, component string, clientsCount prometheus.Gauge, logger log.Logger, reg prometheus.Registerer) *ring_client.Pool {
+	invalidClusterValidation := util.NewRequestInvalidClusterValidationLabelsTotalCounter(reg, component, util.GRPCProtocol)
+
+	factory := ring_client.PoolInstFunc(func(inst ring.InstanceDesc) (ring_client.PoolClient, error) {
+		opts, err := cfg.DialOption(
+			[]grpc.UnaryClientInterceptor{middleware.ClientUserHeaderInterceptor},
+			nil,
+			util.NewInvalidClusterValidationReporter(cfg.ClusterValidation.Label, invalidClusterValidation, logger),
+		)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.WithStatsHandler(otelgrpc.NewClientHandler()))
+
+		// nolint:staticcheck // grpc.Dial() has been deprecated; we'll address it before upgrading to gRPC 2.
+		conn, err := grpc.Dial(inst.Addr, opts...)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to dial distributor %s %s", inst.Id, inst.Addr)
+		}
+
+		return &distributorClient{
+			HealthClient: grpc_health_v1.NewHealthClient(conn),
+			conn:         conn,
+		}, nil
+	})
+
+	poolCfg := ring_client.PoolConfig{
+		CheckInterval:      10 * time.Second,
+		HealthCheckEnabled: true,
+		HealthCheckTimeout: 10 * time.Second,
+	}
+
+	var discovery ring_client.PoolServiceDiscovery
+	if distributorsRing != nil {
+		discovery = ring_client.NewRingServiceDiscovery(distributorsRing)
+	}
+	return ring_client.NewPool("distributor", poolCfg, discovery, factory, clientsCount, logger)
+}
+
+// distributorClient is a gRPC client of the internal gRPC services of a distributor.
+type distributorClient struct {
+	grpc_health_v1.HealthClient
+	conn *grpc.ClientConn
+}
+
+// Close closes the client's gRPC connection.
+func (c *distributorClient) Close() error {
+	return c.conn.Close()
+}
+
+// String returns the address of the distributor.
+func (c *distributorClient) String() string {
+	return c.conn.Target()
+}
@@ -83,6 +83,7 @@ var (
 
 func TestConfig_Validate(t *testing.T) {
 	tests := map[string]struct {
+		initConfig func(*Config)
 		initLimits func(*validation.Limits)
 		expected   error
 	}{
@@ -90,6 +91,13 @@ func TestConfig_Validate(t *testing.T) {
 			initLimits: func(_ *validation.Limits) {},
 			expected:   nil,
 		},
+		"should fail if the InfluxDB v2 tenant source is unsupported": {
+			initConfig: func(cfg *Config) {
+				cfg.InfluxV2TenantFrom = "token"
+			},
+			initLimits: func(_ *validation.Limits) {},
+			expected:   errInvalidInfluxV2TenantFrom,
+		},
 		"should fail if the default shard size is negative": {
 			initLimits: func(limits *validation.Limits) {
 				limits.IngestionTenantShardSize = -5
@@ -110,6 +118,9 @@ func TestConfig_Validate(t *testing.T) {
 			limits := validation.Limits{}
 			flagext.DefaultValues(&cfg, &limits)
 
+			if testData.initConfig != nil {
+				testData.initConfig(&cfg)
+			}
 			testData.initLimits(&limits)
 
 			assert.Equal(t, testData.expected, cfg.Validate(limits))
@@ -741,6 +752,89 @@ func TestDistributor_PushIngestionRateLimiter(t *testing.T) {
 	}
 }
 
+func TestDistributor_PushMetricIngestionRateLimiter(t *testing.T) {
+	ctx := user.InjectOrgID(context.Background(), "user")
+
+	limits := prepareDefaultLimits()
+	limits.MetricLimits = validation.MetricLimitsConfig{
+		// The rate and burst are 5 per distributor.
+		{Match: "foo", IngestionRate: 10, IngestionBurstSize: 5},
+		{Match: "bar", MaxGlobalSeries: 100},
+	}
+
+	distributors, _, regs, _ := prepare(t, prepConfig{
+		numIngesters:    3,
+		happyIngesters:  3,
+		numDistributors: 2,
+		limits:          limits,
+	})
+
+	// Both the metrics are within the limits.
+	response, err := distributors[0].Push(ctx, makeWriteRequest(0, 3, 0, false, false, "foo", "bar"))
+	require.NoError(t, err)
+	assert.Equal(t, emptyResponse, response)
+
+	// The samples of foo exceed the limit and are dropped, while the samples of bar are ingested.
+	response, err = distributors[0].Push(ctx, makeWriteRequest(0, 3, 0, false, false, "foo", "bar"))
+	assert.Nil(t, response)
+	checkGRPCError(t,
+		status.New(codes.InvalidArgument, fmt.Sprintf(metricIngestionRateLimitedMsgFormat, "foo", 10.0, 5)),
+		&mimirpb.ErrorDetails{Cause: mimirpb.BAD_DATA},
+		err,
+	)
+
+	assert.NoError(t, testutil.GatherAndCompare(regs[0], strings.NewReader(`
+		# HELP cortex_discarded_samples_total The total number of samples that were discarded.
+		# TYPE cortex_discarded_samples_total counter
+		cortex_discarded_samples_total{group="",reason="metric_rate_limited:foo",user="user"} 3
+	`), "cortex_discarded_samples_total"))
+	assert.Equal(t, 9.0, testutil.ToFloat64(distributors[0].receivedSamples.WithLabelValues("user")))
+}
+
+func TestDistributor_PushMetricSchemas(t *testing.T) {
+	ctx := user.InjectOrgID(context.Background(), "user")
+
+	for _, strategy := range validation.MetricSchemaViolationStrategies {
+		t.Run(strategy, func(t *testing.T) {
+			limits := prepareDefaultLimits()
+			limits.MetricSchemas = validation.MetricSchemasConfig{
+				{MetricName: "foo", LabelNames: []string{"bar", "sample"}},
+				{MetricName: "baz", LabelNames: []string{"bar"}},
+			}
+			limits.MetricSchemaViolationStrategy = strategy
+
+			distributors, _, regs, _ := prepare(t, prepConfig{
+				numIngesters:    3,
+				happyIngesters:  3,
+				numDistributors: 1,
+				limits:          limits,
+			})
+
+			// The series of foo conform to its schema, while the series of baz have a label not in its schema,
+			// and qux isn't in the schemas.
+			response, err := distributors[0].Push(ctx, makeWriteRequest(0, 2, 0, false, false, "foo", "baz", "qux"))
+			if strategy == validation.MetricSchemaViolationStrategyReject {
+				assert.Nil(t, response)
+				checkGRPCError(t,
+					status.New(codes.InvalidArgument, fmt.Sprintf(labelNotInSchemaMsgFormat, "sample", `baz{bar="baz", sample="0"}`)),
+					&mimirpb.ErrorDetails{Cause: mimirpb.BAD_DATA},
+					err,
+				)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, emptyResponse, response)
+			}
+
+			assert.NoError(t, testutil.GatherAndCompare(regs[0], strings.NewReader(`
+				# HELP cortex_discarded_samples_total The total number of samples that were discarded.
+				# TYPE cortex_discarded_samples_total counter
+				cortex_discarded_samples_total{group="",reason="label_not_in_schema",user="user"} 2
+				cortex_discarded_samples_total{group="",reason="metric_not_in_schema",user="user"} 2
+			`), "cortex_discarded_samples_total"))
+		})
+	}
+}
+
 func TestDistributor_PushInstanceLimits(t *testing.T) {
 	type testPush struct {
 		samples       int
@@ -1013,6 +1107,104 @@ func TestDistributor_PushHAInstances(t *testing.T) {
 	}
 }
 
+func TestDistributor_PushHAInstancesWithClusterLabels(t *testing.T) {
+	ctx := user.InjectOrgID(context.Background(), "user")
+
+	var limits validation.Limits
+	flagext.DefaultValues(&limits)
+	limits.AcceptHASamples = true
+	limits.HAClusterLabels = []string{"cluster", "job"}
+
+	ds, _, _, _ := prepare(t, prepConfig{
+		numIngesters:    3,
+		happyIngesters:  3,
+		numDistributors: 1,
+		limits:          &limits,
+		enableTracker:   true,
+	})
+	d := ds[0]
+
+	series := func(replica, job string) []mimirpb.LabelAdapter {
+		return []mimirpb.LabelAdapter{
+			{Name: "__name__", Value: "foo"},
+			{Name: "__replica__", Value: replica},
+			{Name: "cluster", Value: "cluster0"},
+			{Name: "job", Value: job},
+		}
+	}
+	now := time.Now().UnixMilli()
+
+	// The first replica is elected for the group of the api job.
+	_, err := d.Push(ctx, mockWriteRequest(series("replica0", "api"), 1, now))
+	require.NoError(t, err)
+
+	// The second replica is deduplicated for the same group.
+	_, err = d.Push(ctx, mockWriteRequest(series("replica1", "api"), 1, now))
+	checkGRPCError(t, status.New(codes.AlreadyExists, newReplicasDidNotMatchError("replica1", "replica0").Error()), &mimirpb.ErrorDetails{Cause: mimirpb.REPLICAS_DID_NOT_MATCH}, err)
+
+	// The second replica is elected for the group of another job of the same cluster.
+	_, err = d.Push(ctx, mockWriteRequest(series("replica1", "batch"), 1, now))
+	require.NoError(t, err)
+
+	// The samples missing any of the cluster labels are accepted without deduplication.
+	_, err = d.Push(ctx, mockWriteRequest([]mimirpb.LabelAdapter{{Name: "__name__", Value: "foo"}, {Name: "__replica__", Value: "replica2"}, {Name: "cluster", Value: "cluster0"}}, 1, now))
+	require.NoError(t, err)
+
+	tracker := d.HATracker.(*defaultHaTracker)
+	tracker.electedLock.RLock()
+	defer tracker.electedLock.RUnlock()
+	require.Len(t, tracker.clusters["user"], 2)
+	assert.Equal(t, "replica0", tracker.clusters["user"][`{cluster="cluster0", job="api"}`].elected.Replica)
+	assert.Equal(t, "replica1", tracker.clusters["user"][`{cluster="cluster0", job="batch"}`].elected.Replica)
+}
+
+func TestDistributor_PushHAInstancesWithSeveralGroupsPerRequest(t *testing.T) {
+	ctx := user.InjectOrgID(context.Background(), "user")
+
+	var limits validation.Limits
+	flagext.DefaultValues(&limits)
+	limits.AcceptHASamples = true
+	limits.HAClusterLabels = []string{"cluster", "job"}
+
+	ds, ingesters, _, _ := prepare(t, prepConfig{
+		numIngesters:    3,
+		happyIngesters:  3,
+		numDistributors: 1,
+		limits:          &limits,
+		enableTracker:   true,
+	})
+	d := ds[0]
+
+	// The replica sending the request is elected for the batch job only.
+	now := time.Now()
+	require.NoError(t, d.HATracker.checkReplica(ctx, "user", `{cluster="cluster0", job="api"}`, "replica0", now))
+	require.NoError(t, d.HATracker.checkReplica(ctx, "user", `{cluster="cluster0", job="batch"}`, "replica1", now))
+
+	series := func(name, job string) mimirpb.PreallocTimeseries {
+		return makeTimeseries([]string{"__name__", name, "__replica__", "replica1", "cluster", "cluster0", "job", job}, makeSamples(now.UnixMilli(), 1), nil, nil)
+	}
+	_, err := d.Push(ctx, makeWriteRequestWith(
+		series("foo", "api"),
+		series("foo", "batch"),
+		series("bar", "api"),
+		series("bar", "batch"),
+	))
+	require.NoError(t, err)
+
+	// Only the series of the group whose replica is elected are ingested, without the replica label.
+	var ingested []string
+	for _, ing := range ingesters {
+		for _, ts := range ing.series() {
+			lbls := mimirpb.FromLabelAdaptersToString(ts.Labels)
+			if !slices.Contains(ingested, lbls) {
+				ingested = append(ingested, lbls)
+			}
+		}
+	}
+	assert.ElementsMatch(t, []string{`bar{cluster="cluster0", job="batch"}`, `foo{cluster="cluster0", job="batch"}`}, ingested)
+	assert.Equal(t, float64(2), testutil.ToFloat64(d.dedupedSamples.WithLabelValues("user", `{cluster="cluster0", job="api"}`)))
+}
+
 func TestDistributor_PushQuery(t *testing.T) {
 	const metricName = "foo"
 	ctx := user.InjectOrgID(context.Background(), "user")
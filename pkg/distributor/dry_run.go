@@ -0,0 +1,399 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/ring"
+	"github.com/grafana/dskit/tenant"
+	"github.com/prometheus/prometheus/model/labels"
+
+	ingester_client "github.com/grafana/mimir/pkg/ingester/client"
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+// DryRunSeriesStatus is the outcome of the evaluation of a series by a dry-run push request.
+type DryRunSeriesStatus string
+
+const (
+	// DryRunSeriesAccepted means that the series would be ingested as received.
+	DryRunSeriesAccepted DryRunSeriesStatus = "accepted"
+	// DryRunSeriesModified means that the series would be ingested, but with different labels or data.
+	DryRunSeriesModified DryRunSeriesStatus = "modified"
+	// DryRunSeriesRejected means that the series would be discarded.
+	DryRunSeriesRejected DryRunSeriesStatus = "rejected"
+)
+
+// DryRunReport is the outcome of a dry-run push request.
+type DryRunReport struct {
+	Accepted int                  `json:"accepted"`
+	Modified int                  `json:"modified"`
+	Rejected int                  `json:"rejected"`
+	Series   []DryRunSeriesResult `json:"series"`
+
+	// RejectedMetadata lists the metric metadata of the request which would be discarded.
+	RejectedMetadata []DryRunMetadataResult `json:"rejected_metadata,omitempty"`
+
+	// evaluated is set once the write request has been evaluated, that is if it has been successfully parsed.
+	evaluated bool
+}
+
+// DryRunSeriesResult is the outcome of the evaluation of a series by a dry-run push request.
+type DryRunSeriesResult struct {
+	// Labels are the labels of the series as received.
+	Labels string `json:"labels"`
+	// IngestedLabels are the labels the series would be ingested with, if they differ from the received ones.
+	IngestedLabels string             `json:"ingested_labels,omitempty"`
+	Status         DryRunSeriesStatus `json:"status"`
+	// Reasons explains why the series would be modified or rejected.
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// DryRunMetadataResult is the reason why the metric metadata of a dry-run push request would be discarded.
+type DryRunMetadataResult struct {
+	MetricFamilyName string `json:"metric_family_name"`
+	Reason           string `json:"reason"`
+}
+
+type dryRunReportContextKey struct{}
+
+// DryRunHandler wraps a push handler built with Distributor.DryRunPush as push function, and replies with the
+// JSON dry-run report of the write requests. The requests which can't be parsed get the response of the push handler.
+func DryRunHandler(pushHandler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := &DryRunReport{}
+		r = r.WithContext(context.WithValue(r.Context(), dryRunReportContextKey{}, report))
+
+		// The response of the push handler is only used if the request hasn't been evaluated.
+		resp := &dryRunResponseWriter{header: http.Header{}}
+		pushHandler.ServeHTTP(resp, r)
+
+		if !report.evaluated {
+			for name, values := range resp.header {
+				w.Header()[name] = values
+			}
+			if resp.code == 0 {
+				resp.code = http.StatusOK
+			}
+			w.WriteHeader(resp.code)
+			_, _ = w.Write(resp.body.Bytes())
+			return
+		}
+
+		util.WriteJSONResponse(w, report)
+	})
+}
+
+// dryRunResponseWriter is a http.ResponseWriter buffering the response of the push handler wrapped by DryRunHandler.
+type dryRunResponseWriter struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (w *dryRunResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *dryRunResponseWriter) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.body.Write(b)
+}
+
+func (w *dryRunResponseWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+}
+
+// DryRunPush is a PushFunc evaluating the series of the write request with the push middlewares of a dry-run
+// distributor, without ingesting them. The outcome of each series is recorded in the DryRunReport of the context,
+// set by DryRunHandler.
+//
+// The dry-run distributor runs the same middlewares as the distributor, and has no side effect: the HA tracker
+// doesn't elect any replica, no rate limit is enforced and the distributor metrics aren't updated. The streaming
+// aggregation and the remote write forwarding aren't evaluated, nor the checks done by the ingesters, such as
+// out-of-order samples.
+func (d *Distributor) DryRunPush(ctx context.Context, pushReq *Request) error {
+	defer pushReq.CleanUp()
+
+	req, err := pushReq.WriteRequest()
+	if err != nil {
+		return err
+	}
+
+	userID, err := tenant.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	report, ok := ctx.Value(dryRunReportContextKey{}).(*DryRunReport)
+	if !ok || d.dryRun == nil {
+		return nil
+	}
+
+	d.dryRun.evaluateDryRun(ctx, userID, req, report)
+	return nil
+}
+
+// newDryRunDistributor returns the distributor evaluating the dry-run pushes. Its metrics aren't registered, it
+// doesn't enforce the rate limits since it doesn't join the distributors ring, and its HA tracker checks the replicas
+// with haTracker without electing any. The components with side effects, such as the streaming aggregation and the
+// remote write forwarding, and the push wrappers are disabled.
+func newDryRunDistributor(cfg Config, clientConfig ingester_client.Config, limits *validation.Overrides, haTracker haTracker, ingestersRing ring.ReadRing, partitionsRing *ring.PartitionInstanceRing, log log.Logger) (*Distributor, error) {
+	cfg.StreamingAggregationConfig.Enabled = false
+	cfg.RemoteWriteForwardingConfig.Enabled = false
+	cfg.DiskBufferConfig.Enabled = false
+	cfg.IngestStorageConfig.Enabled = false
+	cfg.ReusableIngesterPushWorkers = 0
+	cfg.PushWrappers = nil
+
+	// The groups only label the metrics, which aren't exported, so all the groups are tracked as the "other" group
+	// and the active groups don't need to be cleaned up.
+	activeGroups := util.NewActiveGroupsCleanupService(time.Minute, time.Minute, 0)
+
+	d, err := New(cfg, clientConfig, limits, activeGroups, nil, ingestersRing, partitionsRing, false, nil, log)
+	if err != nil {
+		return nil, err
+	}
+	d.HATracker = dryRunHATracker{haTracker: haTracker}
+	return d, nil
+}
+
+// dryRunHATracker is the HA tracker of the dry-run distributor, checking the replicas without electing any.
+type dryRunHATracker struct {
+	haTracker
+}
+
+func (t dryRunHATracker) checkReplica(_ context.Context, userID, cluster, replica string, _ time.Time) error {
+	return t.peekReplica(userID, cluster, replica)
+}
+
+// cleanupHATrackerMetricsForUser doesn't clean up the metrics of the HA tracker, which belong to the distributor.
+func (t dryRunHATracker) cleanupHATrackerMetricsForUser(string) {}
+
+// dryRunSeries is the state of a series of a dry-run push request before it's pushed through the middlewares.
+type dryRunSeries struct {
+	labels           []mimirpb.LabelAdapter
+	samples          int
+	histograms       int
+	exemplars        int
+	histogramSchemas map[int64]int32 // By timestamp.
+}
+
+func newDryRunSeries(ts *mimirpb.TimeSeries) dryRunSeries {
+	s := dryRunSeries{
+		labels:           mimirpb.FromLabelsToLabelAdapters(mimirpb.FromLabelAdaptersToLabels(ts.Labels).Copy()),
+		samples:          len(ts.Samples),
+		histograms:       len(ts.Histograms),
+		exemplars:        len(ts.Exemplars),
+		histogramSchemas: make(map[int64]int32, len(ts.Histograms)),
+	}
+	for _, h := range ts.Histograms {
+		if _, ok := s.histogramSchemas[h.Timestamp]; !ok {
+			s.histogramSchemas[h.Timestamp] = h.Schema
+		}
+	}
+	return s
+}
+
+// modifications returns the reasons why the series has been modified into ts by the middlewares.
+func (s dryRunSeries) modifications(ts *mimirpb.TimeSeries) []string {
+	var reasons []string
+
+	before, after := mimirpb.FromLabelAdaptersToLabels(s.labels), mimirpb.FromLabelAdaptersToLabels(ts.Labels)
+	before.Range(func(l labels.Label) {
+		switch value := after.Get(l.Name); {
+		case !after.Has(l.Name):
+			reasons = append(reasons, fmt.Sprintf("the label %q is removed", l.Name))
+		case value != l.Value:
+			reasons = append(reasons, fmt.Sprintf("the value of the label %q is changed", l.Name))
+		}
+	})
+	after.Range(func(l labels.Label) {
+		if !before.Has(l.Name) {
+			reasons = append(reasons, fmt.Sprintf("the label %q is added", l.Name))
+		}
+	})
+
+	if discarded := s.samples - len(ts.Samples); discarded > 0 {
+		reasons = append(reasons, fmt.Sprintf("%d samples are discarded", discarded))
+	}
+	if discarded := s.histograms - len(ts.Histograms); discarded > 0 {
+		reasons = append(reasons, fmt.Sprintf("%d native histograms are discarded", discarded))
+	}
+	reduced := 0
+	for _, h := range ts.Histograms {
+		if h.Schema < s.histogramSchemas[h.Timestamp] {
+			reduced++
+		}
+	}
+	if reduced > 0 {
+		reasons = append(reasons, fmt.Sprintf("the resolution of %d native histograms is reduced to fit the maximum number of buckets", reduced))
+	}
+	if discarded := s.exemplars - len(ts.Exemplars); discarded > 0 {
+		reasons = append(reasons, fmt.Sprintf("%d exemplars are discarded", discarded))
+	}
+	return reasons
+}
+
+// dryRunOutcome is the outcome of a write request pushed through the middlewares of the dry-run distributor.
+type dryRunOutcome struct {
+	// pushed is whether the request has been pushed by the middlewares.
+	pushed bool
+	// series are the labels and the reasons of the modifications of the pushed series, by index in the request.
+	series map[int]dryRunPushedSeries
+	// metadata are the indexes of the pushed metadata.
+	metadata map[int]struct{}
+	err      error
+}
+
+type dryRunPushedSeries struct {
+	labels  string
+	reasons []string
+}
+
+// pushDryRun pushes a copy of the series and metadata of req through the middlewares, and returns which ones
+// have been pushed.
+func (d *Distributor) pushDryRun(ctx context.Context, req *mimirpb.WriteRequest, series []dryRunSeries) dryRunOutcome {
+	evalReq := &mimirpb.WriteRequest{
+		Timeseries:               make([]mimirpb.PreallocTimeseries, 0, len(req.Timeseries)),
+		Source:                   req.Source,
+		Metadata:                 make([]*mimirpb.MetricMetadata, 0, len(req.Metadata)),
+		SkipLabelValidation:      req.SkipLabelValidation,
+		SkipLabelCountValidation: req.SkipLabelCountValidation,
+	}
+	// The series and metadata are tracked by their pointer, which the middlewares keep when they remove others.
+	seriesIdx := make(map[*mimirpb.TimeSeries]int, len(req.Timeseries))
+	for i, ts := range req.Timeseries {
+		c := mimirpb.DeepCopyTimeseries(mimirpb.PreallocTimeseries{}, ts, true, true)
+		seriesIdx[c.TimeSeries] = i
+		evalReq.Timeseries = append(evalReq.Timeseries, c)
+	}
+	metadataIdx := make(map[*mimirpb.MetricMetadata]int, len(req.Metadata))
+	for i, m := range req.Metadata {
+		c := *m
+		metadataIdx[&c] = i
+		evalReq.Metadata = append(evalReq.Metadata, &c)
+	}
+
+	evalPushReq := NewParsedRequest(evalReq)
+	evalPushReq.AddCleanup(func() {
+		mimirpb.ReuseSlice(evalReq.Timeseries)
+	})
+
+	outcome := dryRunOutcome{series: map[int]dryRunPushedSeries{}, metadata: map[int]struct{}{}}
+	push := d.wrapPushWithMiddlewares(func(_ context.Context, pushReq *Request) error {
+		defer pushReq.CleanUp()
+
+		pushed, err := pushReq.WriteRequest()
+		if err != nil {
+			return err
+		}
+		outcome.pushed = true
+		for _, ts := range pushed.Timeseries {
+			i := seriesIdx[ts.TimeSeries]
+			outcome.series[i] = dryRunPushedSeries{
+				labels:  mimirpb.FromLabelAdaptersToString(ts.Labels),
+				reasons: series[i].modifications(ts.TimeSeries),
+			}
+		}
+		for _, m := range pushed.Metadata {
+			outcome.metadata[metadataIdx[m]] = struct{}{}
+		}
+		return nil
+	})
+	outcome.err = push(ctx, evalPushReq)
+	return outcome
+}
+
+// evaluateDryRun pushes the write request through the middlewares, and reports the outcome of its series and metadata.
+func (d *Distributor) evaluateDryRun(ctx context.Context, userID string, req *mimirpb.WriteRequest, report *DryRunReport) {
+	series := make([]dryRunSeries, len(req.Timeseries))
+	for i, ts := range req.Timeseries {
+		series[i] = newDryRunSeries(ts.TimeSeries)
+	}
+
+	outcome := d.pushDryRun(ctx, req, series)
+	// The middlewares only return the first validation error of a request, so the series rejected along with others
+	// are pushed again alone to get their own error, unless the whole request has been rejected for another reason.
+	requestRejected := !outcome.pushed && outcome.err != nil && !errors.As(outcome.err, &validationError{})
+
+	report.Series = make([]DryRunSeriesResult, len(req.Timeseries))
+	for i := range req.Timeseries {
+		r := &report.Series[i]
+		r.Labels = mimirpb.FromLabelAdaptersToString(series[i].labels)
+
+		if pushed, ok := outcome.series[i]; ok {
+			r.Status = DryRunSeriesAccepted
+			if len(pushed.reasons) > 0 {
+				r.Status = DryRunSeriesModified
+				r.Reasons = pushed.reasons
+				if pushed.labels != r.Labels {
+					r.IngestedLabels = pushed.labels
+				}
+			}
+			continue
+		}
+
+		r.Status = DryRunSeriesRejected
+		if requestRejected {
+			r.Reasons = []string{outcome.err.Error()}
+			continue
+		}
+		alone := d.pushDryRun(ctx, &mimirpb.WriteRequest{
+			Timeseries:               req.Timeseries[i : i+1],
+			Source:                   req.Source,
+			SkipLabelValidation:      req.SkipLabelValidation,
+			SkipLabelCountValidation: req.SkipLabelCountValidation,
+		}, series[i:i+1])
+		switch {
+		case alone.err != nil:
+			r.Reasons = []string{alone.err.Error()}
+		case !alone.pushed || len(alone.series) == 0:
+			r.Reasons = []string{"the series is dropped, for example by the metric relabel configs"}
+		case outcome.err != nil:
+			r.Reasons = []string{outcome.err.Error()}
+		default:
+			r.Reasons = []string{"the series is dropped with the other series of the request"}
+		}
+	}
+
+	for _, r := range report.Series {
+		switch r.Status {
+		case DryRunSeriesAccepted:
+			report.Accepted++
+		case DryRunSeriesModified:
+			report.Modified++
+		case DryRunSeriesRejected:
+			report.Rejected++
+		}
+	}
+	report.evaluated = true
+
+	for i, m := range req.Metadata {
+		if _, ok := outcome.metadata[i]; ok {
+			continue
+		}
+		reason := outcome.err
+		if outcome.pushed || reason == nil {
+			// The metadata pushed along with series can only be rejected by their validation.
+			c := *m
+			reason = cleanAndValidateMetadata(newMetadataValidationMetrics(nil), d.limits, userID, &c)
+		}
+		if reason != nil {
+			report.RejectedMetadata = append(report.RejectedMetadata, DryRunMetadataResult{MetricFamilyName: m.GetMetricFamilyName(), Reason: reason.Error()})
+		}
+	}
+}
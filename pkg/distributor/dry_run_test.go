@@ -0,0 +1,314 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/grafana/dskit/user"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/relabel"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+func TestDistributor_DryRunPush(t *testing.T) {
+	now := time.Now().UnixMilli()
+
+	tests := map[string]struct {
+		limits         func(limits *validation.Limits)
+		series         []mimirpb.PreallocTimeseries
+		metadata       []*mimirpb.MetricMetadata
+		expectedReport DryRunReport
+	}{
+		"should accept valid series": {
+			series: []mimirpb.PreallocTimeseries{
+				makeTimeseries([]string{"__name__", "up", "job", "api"}, makeSamples(now, 1), nil, nil),
+			},
+			expectedReport: DryRunReport{
+				Accepted: 1,
+				Series:   []DryRunSeriesResult{{Labels: `up{job="api"}`, Status: DryRunSeriesAccepted}},
+			},
+		},
+		"should report the series rejected by the validation": {
+			limits: func(limits *validation.Limits) {
+				limits.MaxLabelNamesPerSeries = 2
+			},
+			series: []mimirpb.PreallocTimeseries{
+				makeTimeseries([]string{"__name__", "up", "job", "api", "pod", "a"}, makeSamples(now, 1), nil, nil),
+				makeTimeseries([]string{"__name__", "up", "job", "api"}, makeSamples(now+time.Hour.Milliseconds(), 1), nil, nil),
+				makeTimeseries([]string{"__name__", "up", "job", "api"}, makeSamples(now, 1), nil, nil),
+			},
+			expectedReport: DryRunReport{
+				Accepted: 1,
+				Rejected: 2,
+				Series: []DryRunSeriesResult{
+					{Labels: `up{job="api", pod="a"}`, Status: DryRunSeriesRejected, Reasons: []string{
+						`received a series whose number of labels exceeds the limit (actual: 3, limit: 2) series: 'up{job="api", pod="a"}' (err-mimir-max-label-names-per-series). To adjust the related per-tenant limit, configure -validation.max-label-names-per-series, or contact your service administrator.`,
+					}},
+					{Labels: `up{job="api"}`, Status: DryRunSeriesRejected, Reasons: []string{
+						fmt.Sprintf(`received a sample whose timestamp is too far in the future, timestamp: %d series: 'up' (err-mimir-too-far-in-future). To adjust the related per-tenant limit, configure -validation.create-grace-period, or contact your service administrator.`, now+time.Hour.Milliseconds()),
+					}},
+					{Labels: `up{job="api"}`, Status: DryRunSeriesAccepted},
+				},
+			},
+		},
+		"should report the series modified or dropped by the relabeling": {
+			limits: func(limits *validation.Limits) {
+				limits.DropLabels = []string{"pod"}
+				limits.MetricRelabelConfigs = []*relabel.Config{
+					{
+						SourceLabels: []model.LabelName{"job"},
+						Regex:        relabel.MustNewRegexp("debug"),
+						Action:       relabel.Drop,
+					},
+					{
+						SourceLabels: []model.LabelName{"job"},
+						Regex:        relabel.MustNewRegexp("api"),
+						TargetLabel:  "team",
+						Replacement:  "backend",
+						Action:       relabel.Replace,
+					},
+				}
+			},
+			series: []mimirpb.PreallocTimeseries{
+				makeTimeseries([]string{"__name__", "up", "job", "debug"}, makeSamples(now, 1), nil, nil),
+				makeTimeseries([]string{"__name__", "up", "job", "api", "pod", "a"}, makeSamples(now, 1), nil, nil),
+				makeTimeseries([]string{"__name__", "up", "job", "batch"}, makeSamples(now, 1), nil, nil),
+			},
+			expectedReport: DryRunReport{
+				Accepted: 1,
+				Modified: 1,
+				Rejected: 1,
+				Series: []DryRunSeriesResult{
+					{Labels: `up{job="debug"}`, Status: DryRunSeriesRejected, Reasons: []string{"the series is dropped, for example by the metric relabel configs"}},
+					{Labels: `up{job="api", pod="a"}`, IngestedLabels: `up{job="api", team="backend"}`, Status: DryRunSeriesModified, Reasons: []string{
+						`the label "pod" is removed`,
+						`the label "team" is added`,
+					}},
+					{Labels: `up{job="batch"}`, Status: DryRunSeriesAccepted},
+				},
+			},
+		},
+		"should report the data discarded from the series": {
+			series: []mimirpb.PreallocTimeseries{
+				makeTimeseries([]string{"__name__", "up", "job", "api", "pod", ""}, append(makeSamples(now, 1), makeSamples(now, 2)...), nil, nil),
+			},
+			expectedReport: DryRunReport{
+				Modified: 1,
+				Series: []DryRunSeriesResult{
+					{Labels: `up{job="api", pod=""}`, IngestedLabels: `up{job="api"}`, Status: DryRunSeriesModified, Reasons: []string{
+						`the label "pod" is removed`,
+						"1 samples are discarded",
+					}},
+				},
+			},
+		},
+		"should report the exemplars discarded by the exemplar policies": {
+			limits: func(limits *validation.Limits) {
+				limits.MaxGlobalExemplarsPerUser = 10
+				limits.ExemplarPolicies = validation.ExemplarPoliciesConfig{{Match: "up", MaxExemplarsPerSecond: 1}}
+			},
+			series: []mimirpb.PreallocTimeseries{
+				makeTimeseries([]string{"__name__", "up"}, makeSamples(now, 1), nil, append(makeExemplars([]string{"trace_id", "1"}, now-1, 1), makeExemplars([]string{"trace_id", "2"}, now, 1)...)),
+			},
+			expectedReport: DryRunReport{
+				Modified: 1,
+				Series:   []DryRunSeriesResult{{Labels: `up`, Status: DryRunSeriesModified, Reasons: []string{"1 exemplars are discarded"}}},
+			},
+		},
+		"should report the rejected metadata": {
+			series: []mimirpb.PreallocTimeseries{
+				makeTimeseries([]string{"__name__", "up"}, makeSamples(now, 1), nil, nil),
+			},
+			metadata: []*mimirpb.MetricMetadata{
+				{MetricFamilyName: "up", Type: mimirpb.GAUGE, Help: "Up."},
+				{MetricFamilyName: "", Type: mimirpb.GAUGE, Help: "Missing name."},
+			},
+			expectedReport: DryRunReport{
+				Accepted: 1,
+				Series:   []DryRunSeriesResult{{Labels: `up`, Status: DryRunSeriesAccepted}},
+				RejectedMetadata: []DryRunMetadataResult{
+					{MetricFamilyName: "", Reason: "received a metric metadata with no metric name (err-mimir-metadata-missing-metric-name)"},
+				},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var limits validation.Limits
+			flagext.DefaultValues(&limits)
+			if tc.limits != nil {
+				tc.limits(&limits)
+			}
+
+			ds, ingesters, regs, _ := prepare(t, prepConfig{
+				numIngesters:    3,
+				happyIngesters:  3,
+				numDistributors: 1,
+				limits:          &limits,
+				configure:       enableDryRunEndpoints,
+			})
+
+			report := &DryRunReport{}
+			ctx := context.WithValue(user.InjectOrgID(context.Background(), "user"), dryRunReportContextKey{}, report)
+			req := &mimirpb.WriteRequest{Timeseries: tc.series, Metadata: tc.metadata}
+			require.NoError(t, ds[0].DryRunPush(ctx, NewParsedRequest(req)))
+
+			tc.expectedReport.evaluated = true
+			assert.Equal(t, tc.expectedReport, *report)
+
+			// Nothing has been ingested, and the distributor metrics aren't updated.
+			for _, ing := range ingesters {
+				assert.Empty(t, ing.series())
+			}
+			count, err := testutil.GatherAndCount(regs[0], "cortex_discarded_samples_total", "cortex_distributor_received_requests_total", "cortex_distributor_samples_in_total")
+			require.NoError(t, err)
+			assert.Zero(t, count)
+		})
+	}
+}
+
+func TestDistributor_DryRunPushHADedupe(t *testing.T) {
+	ctx := user.InjectOrgID(context.Background(), "user")
+
+	var limits validation.Limits
+	flagext.DefaultValues(&limits)
+	limits.AcceptHASamples = true
+
+	ds, _, _, _ := prepare(t, prepConfig{
+		numIngesters:    3,
+		happyIngesters:  3,
+		numDistributors: 1,
+		limits:          &limits,
+		enableTracker:   true,
+		configure:       enableDryRunEndpoints,
+	})
+	d := ds[0]
+
+	series := func(cluster, replica string) []mimirpb.LabelAdapter {
+		return []mimirpb.LabelAdapter{{Name: "__name__", Value: "foo"}, {Name: "__replica__", Value: replica}, {Name: "cluster", Value: cluster}}
+	}
+	now := time.Now().UnixMilli()
+
+	_, err := d.Push(ctx, mockWriteRequest(series("cluster0", "replica0"), 1, now))
+	require.NoError(t, err)
+
+	dryRun := func(lbls []mimirpb.LabelAdapter) DryRunSeriesResult {
+		report := &DryRunReport{}
+		require.NoError(t, d.DryRunPush(context.WithValue(ctx, dryRunReportContextKey{}, report), NewParsedRequest(mockWriteRequest(lbls, 1, now))))
+		require.Len(t, report.Series, 1)
+		return report.Series[0]
+	}
+
+	// The samples of the non-elected replica are deduplicated.
+	assert.Equal(t, DryRunSeriesResult{
+		Labels:  `foo{__replica__="replica1", cluster="cluster0"}`,
+		Status:  DryRunSeriesRejected,
+		Reasons: []string{newReplicasDidNotMatchError("replica1", "replica0").Error()},
+	}, dryRun(series("cluster0", "replica1")))
+
+	// The replica label is removed from the samples of a cluster not known yet, without electing its replica.
+	assert.Equal(t, DryRunSeriesResult{
+		Labels:         `foo{__replica__="replica1", cluster="cluster1"}`,
+		IngestedLabels: `foo{cluster="cluster1"}`,
+		Status:         DryRunSeriesModified,
+		Reasons:        []string{`the label "__replica__" is removed`},
+	}, dryRun(series("cluster1", "replica1")))
+
+	// The series of the HA clusters of a request are deduplicated separately.
+	report := &DryRunReport{}
+	req := makeWriteRequestWith(
+		mimirpb.PreallocTimeseries{TimeSeries: &mimirpb.TimeSeries{Labels: series("cluster0", "replica1"), Samples: makeSamples(now, 1)}},
+		mimirpb.PreallocTimeseries{TimeSeries: &mimirpb.TimeSeries{Labels: series("cluster1", "replica1"), Samples: makeSamples(now, 1)}},
+	)
+	require.NoError(t, d.DryRunPush(context.WithValue(ctx, dryRunReportContextKey{}, report), NewParsedRequest(req)))
+	assert.Equal(t, []DryRunSeriesResult{
+		{
+			Labels:  `foo{__replica__="replica1", cluster="cluster0"}`,
+			Status:  DryRunSeriesRejected,
+			Reasons: []string{newReplicasDidNotMatchError("replica1", "replica0").Error()},
+		},
+		{
+			Labels:         `foo{__replica__="replica1", cluster="cluster1"}`,
+			IngestedLabels: `foo{cluster="cluster1"}`,
+			Status:         DryRunSeriesModified,
+			Reasons:        []string{`the label "__replica__" is removed`},
+		},
+	}, report.Series)
+
+	tracker := d.HATracker.(*defaultHaTracker)
+	tracker.electedLock.RLock()
+	defer tracker.electedLock.RUnlock()
+	require.Len(t, tracker.clusters["user"], 1)
+	assert.Equal(t, "replica0", tracker.clusters["user"]["cluster0"].elected.Replica)
+}
+
+func TestDryRunHandler(t *testing.T) {
+	limits := validation.MockDefaultOverrides()
+
+	var limitsCfg validation.Limits
+	flagext.DefaultValues(&limitsCfg)
+	ds, ingesters, _, _ := prepare(t, prepConfig{
+		numIngesters:    3,
+		happyIngesters:  3,
+		numDistributors: 1,
+		limits:          &limitsCfg,
+		configure:       enableDryRunEndpoints,
+	})
+
+	handler := DryRunHandler(Handler(100000, nil, nil, false, false, limits, RetryConfig{}, ds[0].DryRunPush, newPushMetrics(nil), log.NewNopLogger()))
+
+	t.Run("should reply with the report of a valid request", func(t *testing.T) {
+		input := prompb.WriteRequest{Timeseries: []prompb.TimeSeries{
+			{Labels: []prompb.Label{{Name: "__name__", Value: "up"}}, Samples: []prompb.Sample{{Value: 1, Timestamp: time.Now().UnixMilli()}}},
+			{Labels: []prompb.Label{{Name: "__name__", Value: "invalid-name"}}, Samples: []prompb.Sample{{Value: 1, Timestamp: time.Now().UnixMilli()}}},
+		}}
+		inputBytes, err := input.Marshal()
+		require.NoError(t, err)
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, createRequest(t, inputBytes))
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "application/json", resp.Header().Get("Content-Type"))
+
+		var report DryRunReport
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &report))
+		assert.Equal(t, 1, report.Accepted)
+		assert.Equal(t, 1, report.Rejected)
+		require.Len(t, report.Series, 2)
+		assert.Equal(t, DryRunSeriesAccepted, report.Series[0].Status)
+		assert.Equal(t, DryRunSeriesRejected, report.Series[1].Status)
+		require.Len(t, report.Series[1].Reasons, 1)
+		assert.Contains(t, report.Series[1].Reasons[0], "err-mimir-metric-name-invalid")
+
+		for _, ing := range ingesters {
+			assert.Empty(t, ing.series())
+		}
+	})
+
+	t.Run("should reply with the error of a request which can't be parsed", func(t *testing.T) {
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, createRequest(t, []byte("not a write request")))
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+		assert.NotEqual(t, "application/json", resp.Header().Get("Content-Type"))
+	})
+}
+
+func enableDryRunEndpoints(cfg *Config) {
+	cfg.EnableDryRunEndpoints = true
+}
@@ -46,6 +46,10 @@ var (
 		validation.IngestionBurstSizeFlag,
 	)
 
+	metricIngestionRateLimitedMsgFormat = globalerror.MetricLimitIngestionRate.Message(
+		"the samples of the series matching %s have been rejected because they exceeded the ingestion rate limit of the metric, set to %v samples/s with a maximum allowed burst of %d. This limit is applied across all distributors",
+	) + ". To adjust the related per-tenant limit, configure metric_limits in the runtime configuration, or contact your service administrator."
+
 	requestRateLimitedMsgFormat = globalerror.RequestRateLimited.MessageWithPerTenantLimitConfig(
 		"the request has been rejected because the tenant exceeded the request rate limit, set to %v requests/s across all distributors with a maximum allowed burst of %d",
 		validation.RequestRateFlag,
@@ -394,6 +398,33 @@ func isIngestionClientError(err error) bool {
 	return false
 }
 
+// isIngesterAvailabilityError returns true if the input error, returned when sending a write request to the
+// ingesters, has been caused by the ingesters being unavailable rather than by the write request being rejected.
+func isIngesterAvailabilityError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var distributorErr Error
+	if errors.As(err, &distributorErr) {
+		switch distributorErr.Cause() {
+		case mimirpb.UNKNOWN_CAUSE, mimirpb.INSTANCE_LIMIT, mimirpb.SERVICE_UNAVAILABLE, mimirpb.TSDB_UNAVAILABLE, mimirpb.TOO_BUSY, mimirpb.CIRCUIT_BREAKER_OPEN:
+			return true
+		default:
+			return false
+		}
+	}
+
+	// This code is needed for backwards compatibility, since ingesters may still return errors with HTTP status
+	// code created by httpgrpc.Errorf(). If err is one of those errors, only 5xx errors are availability errors.
+	if code := grpcutil.ErrorToStatusCode(err); util.IsHTTPStatusCode(code) {
+		return code/100 == 5
+	}
+
+	// Errors such as the ring not having enough healthy ingesters, or the remote timeout being exceeded.
+	return true
+}
+
 type unavailableError struct {
 	state services.State
 }
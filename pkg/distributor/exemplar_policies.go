@@ -0,0 +1,258 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/prometheus/prometheus/model/labels"
+	"golang.org/x/time/rate"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+const (
+	// exemplarValueWindowSize is the number of recent exemplar values the percentile of an exemplar policy is computed on.
+	exemplarValueWindowSize = 1000
+
+	// exemplarValueThresholdUpdateInterval is the number of observed exemplar values after which the percentile
+	// of an exemplar policy is computed again.
+	exemplarValueThresholdUpdateInterval = 100
+
+	// exemplarTraceIDLabel is the label of the exemplars the sampling is based on, when present.
+	exemplarTraceIDLabel = "trace_id"
+)
+
+// exemplarPolicies applies the per-tenant exemplar policies to the exemplars of the series.
+type exemplarPolicies struct {
+	limits  *validation.Overrides
+	matcher *validation.MetricLimitMatcher
+
+	rateLimitersMtx sync.Mutex
+	rateLimiters    map[string]*rate.Limiter // Keyed by exemplarPolicyMetricKey.
+
+	valueWindowsMtx sync.Mutex
+	valueWindows    map[string]*exemplarValueWindow // Keyed by metricLimitKey.
+}
+
+func newExemplarPolicies(limits *validation.Overrides) *exemplarPolicies {
+	return &exemplarPolicies{
+		limits:       limits,
+		matcher:      validation.NewMetricLimitMatcher(),
+		rateLimiters: map[string]*rate.Limiter{},
+		valueWindows: map[string]*exemplarValueWindow{},
+	}
+}
+
+// exemplarPolicyMetricKey returns the key of the rate limiter of the exemplars of a metric matching the exemplar
+// policy with the given selector.
+func exemplarPolicyMetricKey(tenantID, match, metricName string) string {
+	return metricLimitKey(tenantID, match) + metricLimitKeySeparator + metricName
+}
+
+// apply applies the first exemplar policy matching the series to its exemplars. The prioritised exemplars are
+// moved first, and the exemplars sampled out or exceeding the rate of the policy for the metric of the series
+// are removed. It returns the number of removed exemplars for each reason.
+func (p *exemplarPolicies) apply(now time.Time, userID string, ts *mimirpb.PreallocTimeseries) (sampledOut, quotaExceeded int) {
+	if len(ts.Exemplars) == 0 {
+		return 0, 0
+	}
+	policies := p.limits.ExemplarPolicies(userID)
+	if len(policies) == 0 {
+		return 0, 0
+	}
+
+	seriesLabelValue := labelValueFunc(ts.Labels)
+	policyIdx := -1
+	for i, policy := range policies {
+		if p.matcher.MatchesSelector(policy.Match, seriesLabelValue) {
+			policyIdx = i
+			break
+		}
+	}
+	if policyIdx < 0 {
+		return 0, 0
+	}
+	policy := policies[policyIdx]
+	key := metricLimitKey(userID, policy.Match)
+
+	threshold := math.Inf(1)
+	if policy.KeepValuePercentile > 0 {
+		threshold = p.valueWindow(key).observe(ts.Exemplars, policy.KeepValuePercentile)
+	}
+
+	// The rate is limited per metric, so that the exemplars of a metric don't crowd out the exemplars
+	// of the other metrics matching the policy.
+	var rateLimiter *rate.Limiter
+	if policy.MaxExemplarsPerSecond > 0 {
+		rateLimiter = p.rateLimiter(now, exemplarPolicyMetricKey(userID, policy.Match, seriesLabelValue(labels.MetricName)), policy)
+	}
+
+	// Move the prioritised exemplars first.
+	prioritised := 0
+	for i := range ts.Exemplars {
+		e := &ts.Exemplars[i]
+		keep := e.Value >= threshold
+		if !keep && policy.KeepMatching != "" {
+			keep = p.matcher.MatchesSelector(policy.KeepMatching, labelValueFunc(e.Labels))
+		}
+		if keep {
+			ts.Exemplars[prioritised], ts.Exemplars[i] = ts.Exemplars[i], ts.Exemplars[prioritised]
+			prioritised++
+		}
+	}
+
+	// Sample and limit the other exemplars.
+	kept := prioritised
+	for i := prioritised; i < len(ts.Exemplars); i++ {
+		if policy.SampleRate > 0 && !sampleExemplar(ts.Exemplars[i], policy.SampleRate) {
+			sampledOut++
+			continue
+		}
+		if rateLimiter != nil && !rateLimiter.AllowN(now, 1) {
+			quotaExceeded++
+			continue
+		}
+		ts.Exemplars[kept], ts.Exemplars[i] = ts.Exemplars[i], ts.Exemplars[kept]
+		kept++
+	}
+
+	ts.ExemplarsUpdated()
+	ts.ResizeExemplars(kept)
+	return sampledOut, quotaExceeded
+}
+
+// rateLimiter returns the rate limiter of the given key, updated to the maximum rate of the policy.
+func (p *exemplarPolicies) rateLimiter(now time.Time, key string, policy validation.ExemplarPolicy) *rate.Limiter {
+	limit, burst := rate.Limit(policy.MaxExemplarsPerSecond), policy.Burst()
+
+	p.rateLimitersMtx.Lock()
+	defer p.rateLimitersMtx.Unlock()
+
+	l, ok := p.rateLimiters[key]
+	if !ok {
+		l = rate.NewLimiter(limit, burst)
+		p.rateLimiters[key] = l
+	} else if l.Limit() != limit || l.Burst() != burst {
+		l.SetLimitAt(now, limit)
+		l.SetBurstAt(now, burst)
+	}
+	return l
+}
+
+func (p *exemplarPolicies) valueWindow(key string) *exemplarValueWindow {
+	p.valueWindowsMtx.Lock()
+	defer p.valueWindowsMtx.Unlock()
+
+	w, ok := p.valueWindows[key]
+	if !ok {
+		w = &exemplarValueWindow{}
+		p.valueWindows[key] = w
+	}
+	return w
+}
+
+// cleanupTenant removes the state of the exemplar policies of the tenant.
+func (p *exemplarPolicies) cleanupTenant(userID string) {
+	prefix := metricLimitKey(userID, "")
+
+	p.rateLimitersMtx.Lock()
+	for key := range p.rateLimiters {
+		if strings.HasPrefix(key, prefix) {
+			delete(p.rateLimiters, key)
+		}
+	}
+	p.rateLimitersMtx.Unlock()
+
+	p.valueWindowsMtx.Lock()
+	for key := range p.valueWindows {
+		if strings.HasPrefix(key, prefix) {
+			delete(p.valueWindows, key)
+		}
+	}
+	p.valueWindowsMtx.Unlock()
+}
+
+// sampleExemplar returns whether the exemplar is kept with the given sample rate. The decision only depends
+// on the trace ID of the exemplar, or on all its labels when missing.
+func sampleExemplar(e mimirpb.Exemplar, rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+
+	var h uint64
+	if traceID := labelValueFunc(e.Labels)(exemplarTraceIDLabel); traceID != "" {
+		h = xxhash.Sum64String(traceID)
+	} else {
+		d := xxhash.New()
+		for _, l := range e.Labels {
+			_, _ = d.WriteString(l.Name)
+			_, _ = d.Write([]byte{0xff})
+			_, _ = d.WriteString(l.Value)
+			_, _ = d.Write([]byte{0xff})
+		}
+		h = d.Sum64()
+	}
+	return float64(h) < rate*math.MaxUint64
+}
+
+func labelValueFunc(ls []mimirpb.LabelAdapter) func(name string) string {
+	return func(name string) string {
+		for _, l := range ls {
+			if l.Name == name {
+				return l.Value
+			}
+		}
+		return ""
+	}
+}
+
+// exemplarValueWindow holds the recent exemplar values of an exemplar policy, and the percentile above which
+// the exemplars are prioritised.
+type exemplarValueWindow struct {
+	mtx        sync.Mutex
+	values     []float64
+	next       int
+	observed   int
+	percentile float64
+	threshold  float64
+}
+
+// observe adds the values of the exemplars to the window, and returns the value above which the exemplars are
+// prioritised. It returns +Inf until enough values have been observed.
+func (w *exemplarValueWindow) observe(exemplars []mimirpb.Exemplar, percentile float64) float64 {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	for _, e := range exemplars {
+		if math.IsNaN(e.Value) {
+			continue
+		}
+		if len(w.values) < exemplarValueWindowSize {
+			w.values = append(w.values, e.Value)
+		} else {
+			w.values[w.next] = e.Value
+			w.next = (w.next + 1) % exemplarValueWindowSize
+		}
+		w.observed++
+	}
+
+	if len(w.values) < exemplarValueThresholdUpdateInterval {
+		return math.Inf(1)
+	}
+	if w.observed >= exemplarValueThresholdUpdateInterval || w.percentile != percentile {
+		sorted := slices.Clone(w.values)
+		slices.Sort(sorted)
+		idx := int(math.Ceil(percentile/100*float64(len(sorted)))) - 1
+		w.threshold = sorted[max(0, min(idx, len(sorted)-1))]
+		w.percentile = percentile
+		w.observed = 0
+	}
+	return w.threshold
+}
@@ -0,0 +1,232 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+func makeExemplarPolicySeries(metricName string, exemplars ...mimirpb.Exemplar) *mimirpb.PreallocTimeseries {
+	return &mimirpb.PreallocTimeseries{
+		TimeSeries: &mimirpb.TimeSeries{
+			Labels:    []mimirpb.LabelAdapter{{Name: "__name__", Value: metricName}},
+			Exemplars: exemplars,
+		},
+	}
+}
+
+func makeExemplar(traceID string, value float64, extraLabels ...string) mimirpb.Exemplar {
+	e := mimirpb.Exemplar{
+		Labels:      []mimirpb.LabelAdapter{{Name: "trace_id", Value: traceID}},
+		Value:       value,
+		TimestampMs: 1000,
+	}
+	for i := 0; i+1 < len(extraLabels); i += 2 {
+		e.Labels = append(e.Labels, mimirpb.LabelAdapter{Name: extraLabels[i], Value: extraLabels[i+1]})
+	}
+	return e
+}
+
+func exemplarTraceIDs(ts *mimirpb.PreallocTimeseries) []string {
+	traceIDs := make([]string, 0, len(ts.Exemplars))
+	for _, e := range ts.Exemplars {
+		traceIDs = append(traceIDs, e.Labels[0].Value)
+	}
+	return traceIDs
+}
+
+func newExemplarPoliciesForTest(policies ...validation.ExemplarPolicy) *exemplarPolicies {
+	limits := prepareDefaultLimits()
+	limits.ExemplarPolicies = policies
+	return newExemplarPolicies(validation.NewOverrides(*limits, nil))
+}
+
+func TestExemplarPolicies_SampleRate(t *testing.T) {
+	p := newExemplarPoliciesForTest(validation.ExemplarPolicy{Match: "foo", SampleRate: 0.25})
+	now := time.Now()
+
+	const numExemplars = 4000
+	exemplars := make([]mimirpb.Exemplar, 0, numExemplars)
+	for i := 0; i < numExemplars; i++ {
+		exemplars = append(exemplars, makeExemplar(fmt.Sprintf("trace-%d", i), float64(i)))
+	}
+
+	ts := makeExemplarPolicySeries("foo", exemplars...)
+	sampledOut, quotaExceeded := p.apply(now, "user", ts)
+	assert.Equal(t, 0, quotaExceeded)
+	assert.Equal(t, numExemplars, sampledOut+len(ts.Exemplars))
+	assert.InDelta(t, numExemplars/4, len(ts.Exemplars), numExemplars/20)
+
+	// The sampling is consistent for the exemplars of a trace, whatever the series.
+	kept := exemplarTraceIDs(ts)
+	for _, traceID := range kept[:10] {
+		other := makeExemplarPolicySeries("foo", makeExemplar(traceID, 1, "span_id", "other"))
+		sampledOut, _ := p.apply(now, "user", other)
+		assert.Equal(t, 0, sampledOut)
+		assert.Len(t, other.Exemplars, 1)
+	}
+
+	// The series not matching any policy aren't sampled.
+	ts = makeExemplarPolicySeries("bar", exemplars[:100]...)
+	sampledOut, quotaExceeded = p.apply(now, "user", ts)
+	assert.Equal(t, 0, sampledOut)
+	assert.Equal(t, 0, quotaExceeded)
+	assert.Len(t, ts.Exemplars, 100)
+}
+
+func TestExemplarPolicies_KeepMatching(t *testing.T) {
+	p := newExemplarPoliciesForTest(validation.ExemplarPolicy{Match: "{__name__=~\"foo|bar\"}", MaxExemplarsPerSecond: 1, KeepMatching: `{status="error"}`})
+	now := time.Now()
+
+	ts := makeExemplarPolicySeries("foo",
+		makeExemplar("1", 1),
+		makeExemplar("2", 1),
+		makeExemplar("3", 1, "status", "error"),
+		makeExemplar("4", 1),
+		makeExemplar("5", 1, "status", "error"),
+	)
+	sampledOut, quotaExceeded := p.apply(now, "user", ts)
+	assert.Equal(t, 0, sampledOut)
+	assert.Equal(t, 2, quotaExceeded)
+	// The prioritised exemplars are moved first, and aren't limited.
+	assert.Equal(t, []string{"3", "5", "1"}, exemplarTraceIDs(ts))
+
+	// The quota is per metric.
+	ts = makeExemplarPolicySeries("bar", makeExemplar("6", 1), makeExemplar("7", 1, "status", "error"))
+	sampledOut, quotaExceeded = p.apply(now, "user", ts)
+	assert.Equal(t, 0, sampledOut)
+	assert.Equal(t, 0, quotaExceeded)
+	assert.Equal(t, []string{"7", "6"}, exemplarTraceIDs(ts))
+
+	// The quota is shared by the series of the metric.
+	ts = makeExemplarPolicySeries("bar", makeExemplar("10", 1))
+	ts.Labels = append(ts.Labels, mimirpb.LabelAdapter{Name: "job", Value: "other"})
+	_, quotaExceeded = p.apply(now, "user", ts)
+	assert.Equal(t, 1, quotaExceeded)
+	assert.Empty(t, ts.Exemplars)
+
+	// The quota is per tenant.
+	ts = makeExemplarPolicySeries("bar", makeExemplar("8", 1))
+	_, quotaExceeded = p.apply(now, "other", ts)
+	assert.Equal(t, 0, quotaExceeded)
+	assert.Equal(t, []string{"8"}, exemplarTraceIDs(ts))
+
+	// The quota is replenished over time.
+	ts = makeExemplarPolicySeries("foo", makeExemplar("9", 1))
+	_, quotaExceeded = p.apply(now.Add(time.Second), "user", ts)
+	assert.Equal(t, 0, quotaExceeded)
+	assert.Equal(t, []string{"9"}, exemplarTraceIDs(ts))
+
+	// The quota of the tenant is removed on cleanup.
+	ts = makeExemplarPolicySeries("foo", makeExemplar("11", 1))
+	_, quotaExceeded = p.apply(now.Add(time.Second), "user", ts)
+	assert.Equal(t, 1, quotaExceeded)
+	p.cleanupTenant("user")
+	assert.Len(t, p.rateLimiters, 1) // The quota of the other tenant is kept.
+	ts = makeExemplarPolicySeries("foo", makeExemplar("12", 1))
+	_, quotaExceeded = p.apply(now.Add(time.Second), "user", ts)
+	assert.Equal(t, 0, quotaExceeded)
+	assert.Equal(t, []string{"12"}, exemplarTraceIDs(ts))
+}
+
+func TestExemplarPolicies_KeepValuePercentile(t *testing.T) {
+	p := newExemplarPoliciesForTest(validation.ExemplarPolicy{Match: "foo", SampleRate: math.SmallestNonzeroFloat64, KeepValuePercentile: 90})
+	now := time.Now()
+
+	// No exemplar is prioritised until enough values have been observed.
+	ts := makeExemplarPolicySeries("foo", makeExemplar("first", 1000))
+	sampledOut, _ := p.apply(now, "user", ts)
+	assert.Equal(t, 1, sampledOut)
+	assert.Empty(t, ts.Exemplars)
+
+	exemplars := make([]mimirpb.Exemplar, 0, exemplarValueThresholdUpdateInterval)
+	for i := 1; i < exemplarValueThresholdUpdateInterval; i++ {
+		exemplars = append(exemplars, makeExemplar(fmt.Sprintf("%d", i), float64(i)))
+	}
+	ts = makeExemplarPolicySeries("foo", exemplars...)
+	p.apply(now, "user", ts)
+	// The threshold is the 90th percentile of the values 1 to 99 and 1000.
+	assert.Equal(t, []string{"90", "91", "92", "93", "94", "95", "96", "97", "98", "99"}, slices.Sorted(slices.Values(exemplarTraceIDs(ts))))
+
+	ts = makeExemplarPolicySeries("foo", makeExemplar("slow", 500), makeExemplar("fast", 10))
+	sampledOut, _ = p.apply(now, "user", ts)
+	assert.Equal(t, 1, sampledOut)
+	assert.Equal(t, []string{"slow"}, exemplarTraceIDs(ts))
+
+	// The state of the tenant is removed on cleanup.
+	p.cleanupTenant("user")
+	ts = makeExemplarPolicySeries("foo", makeExemplar("slow", 500))
+	sampledOut, _ = p.apply(now, "user", ts)
+	assert.Equal(t, 1, sampledOut)
+}
+
+func TestDistributor_validateExemplars_ExemplarPolicies(t *testing.T) {
+	limits := prepareDefaultLimits()
+	limits.MaxGlobalExemplarsPerUser = 100
+	limits.MaxExemplarsPerSeriesPerRequest = 2
+	limits.ExemplarPolicies = validation.ExemplarPoliciesConfig{
+		{Match: "foo", KeepMatching: `{status="error"}`, MaxExemplarsPerSecond: 1},
+	}
+	overrides := validation.NewOverrides(*limits, nil)
+	reg := prometheus.NewPedanticRegistry()
+	d := &Distributor{
+		limits:                    overrides,
+		exemplarValidationMetrics: newExemplarValidationMetrics(reg),
+		exemplarPolicies:          newExemplarPolicies(overrides),
+	}
+
+	ts := makeExemplarPolicySeries("foo",
+		mimirpb.Exemplar{Labels: []mimirpb.LabelAdapter{{Name: "trace_id", Value: "1"}}, Value: 1, TimestampMs: 3000},
+		mimirpb.Exemplar{Labels: []mimirpb.LabelAdapter{{Name: "trace_id", Value: "2"}}, Value: 1, TimestampMs: 2000},
+		mimirpb.Exemplar{Labels: []mimirpb.LabelAdapter{{Name: "trace_id", Value: "3"}, {Name: "status", Value: "error"}}, Value: 1, TimestampMs: 4000},
+		mimirpb.Exemplar{Labels: []mimirpb.LabelAdapter{{Name: "trace_id", Value: "4"}, {Name: "status", Value: "error"}}, Value: 1, TimestampMs: 1000},
+	)
+	d.validateExemplars(time.Now(), ts, "user", 0, math.MaxInt64)
+
+	// The prioritised exemplars are kept over the maximum number of exemplars per series, and sorted by timestamp.
+	assert.Equal(t, []string{"4", "3"}, exemplarTraceIDs(ts))
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_discarded_exemplars_total The total number of exemplars that were discarded.
+		# TYPE cortex_discarded_exemplars_total counter
+		cortex_discarded_exemplars_total{reason="exemplar_policy_quota_exceeded",user="user"} 1
+		cortex_discarded_exemplars_total{reason="too_many_exemplars_per_series_per_request",user="user"} 1
+	`), "cortex_discarded_exemplars_total"))
+}
+
+func TestDistributor_validateExemplars_ExemplarPoliciesOnlyApplyToValidExemplars(t *testing.T) {
+	limits := prepareDefaultLimits()
+	limits.MaxGlobalExemplarsPerUser = 100
+	limits.ExemplarPolicies = validation.ExemplarPoliciesConfig{
+		{Match: "foo", MaxExemplarsPerSecond: 1},
+	}
+	overrides := validation.NewOverrides(*limits, nil)
+	reg := prometheus.NewPedanticRegistry()
+	d := &Distributor{
+		limits:                    overrides,
+		exemplarValidationMetrics: newExemplarValidationMetrics(reg),
+		exemplarPolicies:          newExemplarPolicies(overrides),
+	}
+
+	ts := makeExemplarPolicySeries("foo",
+		mimirpb.Exemplar{Value: 1, TimestampMs: 1000},
+		mimirpb.Exemplar{Labels: []mimirpb.LabelAdapter{{Name: "trace_id", Value: "1"}}, Value: 1, TimestampMs: 2000},
+	)
+	d.validateExemplars(time.Now(), ts, "user", 0, math.MaxInt64)
+
+	// The invalid exemplar doesn't use the rate of the policy.
+	assert.Equal(t, []string{"1"}, exemplarTraceIDs(ts))
+	assert.Equal(t, 0, testutil.CollectAndCount(d.exemplarValidationMetrics.quotaExceeded))
+}
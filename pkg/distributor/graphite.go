@@ -0,0 +1,94 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/httpgrpc"
+	"github.com/grafana/dskit/middleware"
+	"github.com/grafana/dskit/tenant"
+	"github.com/pkg/errors"
+
+	"github.com/grafana/mimir/pkg/distributor/graphitepush"
+	"github.com/grafana/mimir/pkg/distributor/pushutil"
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util"
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+// graphiteUnmapped is the reason of the Graphite samples discarded because their path has no tags
+// and doesn't match any mapping rule.
+const graphiteUnmapped = "graphite_unmapped"
+
+// graphiteInvalid is the reason of the Graphite samples discarded because their line can't be parsed,
+// or their path is mapped to an invalid series.
+const graphiteInvalid = "graphite_invalid"
+
+type distributorMaxGraphiteRequestSizeErr struct {
+	limit int
+}
+
+func (e distributorMaxGraphiteRequestSizeErr) Error() string {
+	return fmt.Sprintf("the incoming Graphite request has been rejected because its message size is larger than the allowed limit of %d bytes (configured via -%s)", e.limit, maxGraphiteRequestSizeFlag)
+}
+
+// GraphiteHandler is a http.Handler which accepts the Graphite plaintext protocol and converts it to WriteRequests,
+// applying the Graphite mapping rules of the tenant, whose compiled form is cached in mappers.
+func GraphiteHandler(
+	maxRecvMsgSize int,
+	requestBufferPool util.Pool,
+	sourceIPs *middleware.SourceIPExtractor,
+	limits *validation.Overrides,
+	mappers *graphitepush.MapperCache,
+	retryCfg RetryConfig,
+	push PushFunc,
+	pushMetrics *PushMetrics,
+	logger log.Logger,
+) http.Handler {
+	return handler(maxRecvMsgSize, requestBufferPool, sourceIPs, false, false, limits, retryCfg, push, logger, func(ctx context.Context, r *http.Request, maxRecvMsgSize int, _ *util.RequestBuffers, req *mimirpb.PreallocWriteRequest, logger log.Logger) error {
+		spanLogger, ctx := spanlogger.New(ctx, logger, tracer, "Distributor.GraphiteHandler.decodeAndConvert")
+		defer spanLogger.Finish()
+
+		spanLogger.SetTag("content_type", r.Header.Get("Content-Type"))
+		spanLogger.SetTag("content_encoding", r.Header.Get("Content-Encoding"))
+		spanLogger.SetTag("content_length", r.ContentLength)
+
+		tenantID, err := tenant.TenantID(ctx)
+		if err != nil {
+			return err
+		}
+		pushMetrics.IncGraphiteRequest(tenantID)
+
+		mapper, err := mappers.Get(tenantID, limits.GraphiteMappingRules(tenantID))
+		if err != nil {
+			return err
+		}
+
+		timeseries, discarded, bytesRead, err := graphitepush.ParseRequest(r, maxRecvMsgSize, mapper, time.Now())
+		level.Debug(spanLogger).Log("msg", "decodeAndConvert complete", "bytesRead", bytesRead, "metric_count", len(timeseries), "unmapped", discarded.Unmapped, "invalid", discarded.Invalid, "first_invalid_err", discarded.InvalidErr, "err", err)
+		pushMetrics.ObserveGraphiteUncompressedBodySize(tenantID, float64(bytesRead))
+		if errors.Is(err, pushutil.ErrRequestTooLarge) {
+			return httpgrpc.Error(http.StatusRequestEntityTooLarge, distributorMaxGraphiteRequestSizeErr{limit: maxRecvMsgSize}.Error())
+		}
+		if err != nil {
+			return err
+		}
+
+		if discarded.Unmapped > 0 {
+			pushMetrics.IncGraphiteUnmappedDiscardedSamples(tenantID, discarded.Unmapped)
+		}
+		if discarded.Invalid > 0 {
+			pushMetrics.IncGraphiteInvalidDiscardedSamples(tenantID, discarded.Invalid)
+		}
+
+		req.Timeseries = timeseries
+		return nil
+	})
+}
@@ -0,0 +1,147 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/user"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/distributor/graphitepush"
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+func TestGraphiteHandleSeriesPush(t *testing.T) {
+	const tenantID = "test"
+
+	limits := validation.MockOverrides(func(defaults *validation.Limits, tenantLimits map[string]*validation.Limits) {
+		tenantLimits[tenantID] = validation.MockDefaultLimits()
+		tenantLimits[tenantID].GraphiteMappingRules = validation.GraphiteMappingRulesConfig{
+			{Match: "servers.*.cpu.*", Name: "server_cpu", Labels: map[string]string{"host": "$1", "mode": "$2"}},
+		}
+	})
+
+	defaultExpectedWriteRequest := &mimirpb.WriteRequest{
+		Timeseries: []mimirpb.PreallocTimeseries{
+			{
+				TimeSeries: &mimirpb.TimeSeries{
+					Labels: []mimirpb.LabelAdapter{
+						{Name: "__name__", Value: "server_cpu"},
+						{Name: "host", Value: "web-1"},
+						{Name: "mode", Value: "user"},
+					},
+					Samples: []mimirpb.Sample{
+						{Value: 0.5, TimestampMs: 1700000000000},
+					},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name                string
+		data                string
+		expectedCode        int
+		expectedUnmapped    int
+		expectedInvalid     int
+		push                func(t *testing.T) PushFunc
+		maxRequestSizeBytes int
+	}{
+		{
+			name:         "mapped line",
+			data:         "servers.web-1.cpu.user 0.5 1700000000\n",
+			expectedCode: http.StatusOK,
+			push: func(t *testing.T) PushFunc {
+				return func(_ context.Context, pushReq *Request) error {
+					req, err := pushReq.WriteRequest()
+					assert.Equal(t, defaultExpectedWriteRequest, req)
+					assert.Nil(t, err)
+					return err
+				}
+			},
+			maxRequestSizeBytes: 1 << 20,
+		},
+		{
+			name:             "unmapped lines are discarded",
+			data:             "servers.web-1.cpu.user 0.5 1700000000\nunknown.metric 1 1700000000\nother.metric 2 1700000000\n",
+			expectedCode:     http.StatusOK,
+			expectedUnmapped: 2,
+			push: func(t *testing.T) PushFunc {
+				return func(_ context.Context, pushReq *Request) error {
+					req, err := pushReq.WriteRequest()
+					assert.Equal(t, defaultExpectedWriteRequest, req)
+					assert.Nil(t, err)
+					return err
+				}
+			},
+			maxRequestSizeBytes: 1 << 20,
+		},
+		{
+			name:            "invalid lines are discarded",
+			data:            "servers.web-1.cpu.user 0.5 1700000000\nservers.web-1.cpu.user abc 1700000000\nservers.web-1.cpu.user\n",
+			expectedCode:    http.StatusOK,
+			expectedInvalid: 2,
+			push: func(t *testing.T) PushFunc {
+				return func(_ context.Context, pushReq *Request) error {
+					req, err := pushReq.WriteRequest()
+					assert.Equal(t, defaultExpectedWriteRequest, req)
+					assert.Nil(t, err)
+					return err
+				}
+			},
+			maxRequestSizeBytes: 1 << 20,
+		},
+		{
+			name:         "max request size violated",
+			data:         "servers.web-1.cpu.user 0.5 1700000000\n",
+			expectedCode: http.StatusRequestEntityTooLarge,
+			push: func(t *testing.T) PushFunc {
+				return func(_ context.Context, pushReq *Request) error {
+					req, err := pushReq.WriteRequest()
+					assert.Nil(t, req)
+					assert.ErrorContains(t, err, "-distributor.max-graphite-request-size")
+					return err
+				}
+			},
+			maxRequestSizeBytes: 10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewPedanticRegistry()
+			pushMetrics := newPushMetrics(reg)
+
+			handler := GraphiteHandler(tt.maxRequestSizeBytes, nil, nil, limits, graphitepush.NewMapperCache(), RetryConfig{}, tt.push(t), pushMetrics, log.NewNopLogger())
+			req := httptest.NewRequest("POST", "/api/v1/push/graphite", strings.NewReader(tt.data))
+			req.Header.Set("X-Scope-OrgID", tenantID)
+			ctx := user.InjectOrgID(context.Background(), tenantID)
+			req = req.WithContext(ctx)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			assert.Equal(t, tt.expectedCode, rec.Code)
+
+			require.Equal(t, float64(1), testutil.ToFloat64(pushMetrics.graphiteRequestCounter.WithLabelValues(tenantID)))
+			if tt.expectedUnmapped > 0 {
+				require.Equal(t, float64(tt.expectedUnmapped), testutil.ToFloat64(pushMetrics.graphiteUnmappedDiscardedSamples.WithLabelValues(tenantID, "")))
+			} else {
+				require.Equal(t, 0, testutil.CollectAndCount(pushMetrics.graphiteUnmappedDiscardedSamples))
+			}
+			if tt.expectedInvalid > 0 {
+				require.Equal(t, float64(tt.expectedInvalid), testutil.ToFloat64(pushMetrics.graphiteInvalidDiscardedSamples.WithLabelValues(tenantID, "")))
+			} else {
+				require.Equal(t, 0, testutil.CollectAndCount(pushMetrics.graphiteInvalidDiscardedSamples))
+			}
+		})
+	}
+}
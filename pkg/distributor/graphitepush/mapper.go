@@ -0,0 +1,138 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package graphitepush
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/grafana/regexp"
+	"github.com/prometheus/prometheus/model/labels"
+
+	"github.com/grafana/mimir/pkg/distributor/pushutil"
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+// Mapper maps the dotted paths of Graphite metrics to metric names and labels, in the way of
+// the mapping configuration of the graphite_exporter.
+type Mapper struct {
+	rules []mappingRule
+}
+
+type mappingRule struct {
+	match  string
+	re     *regexp.Regexp
+	name   string
+	labels map[string]string
+}
+
+// NewMapper returns a Mapper applying the given rules. The first rule matching a path is applied.
+func NewMapper(rules []validation.GraphiteMappingRule) (*Mapper, error) {
+	m := &Mapper{rules: make([]mappingRule, 0, len(rules))}
+	for _, r := range rules {
+		re, err := r.Regexp()
+		if err != nil {
+			return nil, fmt.Errorf("invalid Graphite mapping rule %q: %w", r.Match, err)
+		}
+		m.rules = append(m.rules, mappingRule{match: r.Match, re: re, name: r.Name, labels: r.Labels})
+	}
+	return m, nil
+}
+
+// Map returns the metric name and the labels, without the metric name label, of the given path.
+// The metric name is sanitized, and the labels whose value is empty are dropped. It returns false
+// if the path doesn't match any rule, and an error if the path is mapped to an empty metric name.
+func (m *Mapper) Map(path string) (string, []mimirpb.LabelAdapter, bool, error) {
+	if m == nil {
+		return "", nil, false, nil
+	}
+
+	for _, r := range m.rules {
+		match := r.re.FindStringSubmatchIndex(path)
+		if match == nil {
+			continue
+		}
+
+		name := pushutil.SanitizeName(string(r.re.ExpandString(nil, r.name, path, match)))
+		if name == "" {
+			return "", nil, false, fmt.Errorf("the Graphite mapping rule %q maps the path %q to an empty metric name", r.match, path)
+		}
+		lbls := make([]mimirpb.LabelAdapter, 0, len(r.labels))
+		for k, v := range r.labels {
+			if k == labels.MetricName {
+				continue
+			}
+			value := string(r.re.ExpandString(nil, v, path, match))
+			if value == "" {
+				continue
+			}
+			lbls = append(lbls, mimirpb.LabelAdapter{Name: k, Value: value})
+		}
+		return name, lbls, true, nil
+	}
+	return "", nil, false, nil
+}
+
+// MapperCache caches the Mapper of each tenant, so that the mapping rules are only compiled again when they change.
+type MapperCache struct {
+	mtx     sync.RWMutex
+	mappers map[string]cachedMapper
+}
+
+type cachedMapper struct {
+	rules  []validation.GraphiteMappingRule
+	mapper *Mapper
+}
+
+// NewMapperCache returns an empty MapperCache.
+func NewMapperCache() *MapperCache {
+	return &MapperCache{mappers: map[string]cachedMapper{}}
+}
+
+// Get returns the Mapper of the tenant applying the given rules. The cached Mapper of the tenant is
+// returned if the rules haven't changed since it was built. Without rules, the Mapper of the tenant
+// is evicted and a nil Mapper, which doesn't map any path, is returned.
+func (c *MapperCache) Get(tenantID string, rules []validation.GraphiteMappingRule) (*Mapper, error) {
+	if len(rules) == 0 {
+		c.Delete(tenantID)
+		return nil, nil
+	}
+
+	c.mtx.RLock()
+	cached, ok := c.mappers[tenantID]
+	c.mtx.RUnlock()
+	if ok && slices.EqualFunc(cached.rules, rules, equalMappingRules) {
+		return cached.mapper, nil
+	}
+
+	mapper, err := NewMapper(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mtx.Lock()
+	c.mappers[tenantID] = cachedMapper{rules: rules, mapper: mapper}
+	c.mtx.Unlock()
+	return mapper, nil
+}
+
+// Delete evicts the Mapper of the tenant, if any.
+func (c *MapperCache) Delete(tenantID string) {
+	c.mtx.RLock()
+	_, ok := c.mappers[tenantID]
+	c.mtx.RUnlock()
+	if !ok {
+		return
+	}
+
+	c.mtx.Lock()
+	delete(c.mappers, tenantID)
+	c.mtx.Unlock()
+}
+
+func equalMappingRules(a, b validation.GraphiteMappingRule) bool {
+	return a.Match == b.Match && a.MatchType == b.MatchType && a.Name == b.Name && maps.Equal(a.Labels, b.Labels)
+}
@@ -0,0 +1,143 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package graphitepush
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+func TestMapper(t *testing.T) {
+	mapper, err := NewMapper([]validation.GraphiteMappingRule{
+		{Match: "servers.*.cpu", Name: "server_cpu", Labels: map[string]string{"host": "$1"}},
+		{Match: "servers.*.*", Name: "server_$2"},
+		{Match: "queue-*.size", Name: "queue_size", Labels: map[string]string{"queue": "$1", "__name__": "ignored"}},
+		{Match: "jobs.*", Name: "$1"},
+	})
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		path           string
+		expectedName   string
+		expectedLabels []mimirpb.LabelAdapter
+		expectedMapped bool
+		expectedErr    string
+	}{
+		"first matching rule is applied": {
+			path:           "servers.web-1.cpu",
+			expectedName:   "server_cpu",
+			expectedLabels: []mimirpb.LabelAdapter{{Name: "host", Value: "web-1"}},
+			expectedMapped: true,
+		},
+		"name template": {
+			path:           "servers.web-1.memory",
+			expectedName:   "server_memory",
+			expectedLabels: []mimirpb.LabelAdapter{},
+			expectedMapped: true,
+		},
+		"glob wildcard matches part of a node": {
+			path:           "queue-orders.size",
+			expectedName:   "queue_size",
+			expectedLabels: []mimirpb.LabelAdapter{{Name: "queue", Value: "orders"}},
+			expectedMapped: true,
+		},
+		"metric name is sanitized": {
+			path:           "servers.web-1.disk-io",
+			expectedName:   "server_disk_io",
+			expectedLabels: []mimirpb.LabelAdapter{},
+			expectedMapped: true,
+		},
+		"labels with empty value are dropped": {
+			path:           "queue-.size",
+			expectedName:   "queue_size",
+			expectedLabels: []mimirpb.LabelAdapter{},
+			expectedMapped: true,
+		},
+		"empty metric name": {
+			path:        "jobs.",
+			expectedErr: `the Graphite mapping rule "jobs.*" maps the path "jobs." to an empty metric name`,
+		},
+		"glob wildcard doesn't match more than one node": {
+			path: "servers.web-1.cpu.user",
+		},
+		"glob matches the whole path": {
+			path: "prefix.servers.web-1.cpu",
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			name, lbls, mapped, err := mapper.Map(testData.path)
+			if testData.expectedErr != "" {
+				require.EqualError(t, err, testData.expectedErr)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, testData.expectedMapped, mapped)
+			assert.Equal(t, testData.expectedName, name)
+			assert.Equal(t, testData.expectedLabels, lbls)
+		})
+	}
+}
+
+func TestNewMapper_InvalidRule(t *testing.T) {
+	_, err := NewMapper([]validation.GraphiteMappingRule{{Match: "(", MatchType: validation.GraphiteMatchTypeRegex, Name: "x"}})
+	require.ErrorContains(t, err, `invalid Graphite mapping rule "("`)
+}
+
+func TestMapperCache(t *testing.T) {
+	cache := NewMapperCache()
+	rules := []validation.GraphiteMappingRule{
+		{Match: "servers.*.cpu", Name: "server_cpu", Labels: map[string]string{"host": "$1"}},
+	}
+
+	first, err := cache.Get("user-1", rules)
+	require.NoError(t, err)
+
+	// The mapper is reused while the rules don't change, even if they're a different copy.
+	same, err := cache.Get("user-1", []validation.GraphiteMappingRule{
+		{Match: "servers.*.cpu", Name: "server_cpu", Labels: map[string]string{"host": "$1"}},
+	})
+	require.NoError(t, err)
+	assert.Same(t, first, same)
+
+	// Each tenant has its own mapper.
+	other, err := cache.Get("user-2", rules)
+	require.NoError(t, err)
+	assert.NotSame(t, first, other)
+
+	// The mapper is rebuilt when the rules change.
+	changedRules := []validation.GraphiteMappingRule{
+		{Match: "servers.*.cpu", Name: "server_cpu", Labels: map[string]string{"server": "$1"}},
+	}
+	changed, err := cache.Get("user-1", changedRules)
+	require.NoError(t, err)
+	assert.NotSame(t, first, changed)
+	name, lbls, ok, err := changed.Map("servers.web-1.cpu")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "server_cpu", name)
+	assert.Equal(t, []mimirpb.LabelAdapter{{Name: "server", Value: "web-1"}}, lbls)
+
+	// Invalid rules aren't cached.
+	_, err = cache.Get("user-1", []validation.GraphiteMappingRule{{Match: "(", MatchType: validation.GraphiteMatchTypeRegex, Name: "x"}})
+	require.Error(t, err)
+	cached, err := cache.Get("user-1", changedRules)
+	require.NoError(t, err)
+	assert.Same(t, changed, cached)
+
+	// The mapper is evicted when the tenant has no rules anymore.
+	evicted, err := cache.Get("user-1", nil)
+	require.NoError(t, err)
+	assert.Nil(t, evicted)
+	assert.NotContains(t, cache.mappers, "user-1")
+
+	// The mapper is evicted when the tenant is deleted.
+	cache.Delete("user-2")
+	assert.Empty(t, cache.mappers)
+}
@@ -0,0 +1,189 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package graphitepush
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+
+	"github.com/grafana/mimir/pkg/distributor/pushutil"
+	"github.com/grafana/mimir/pkg/mimirpb"
+)
+
+// ParseRequest parses a request made of lines of the Graphite plaintext protocol, "<path> <value> [<timestamp>]",
+// and converts them into time series using the given mapper. The path may carry Graphite tags, as in
+// "<name>;<tag>=<value>;...". The timestamp is in seconds, and the lines without timestamp, or with a timestamp
+// of -1, are timestamped with now.
+//
+// The lines which can't be parsed or mapped, and the lines whose path has no tags and doesn't match any mapping
+// rule, are discarded and counted in the returned Discarded. It also returns the number of bytes of the
+// uncompressed request body.
+func ParseRequest(r *http.Request, maxSize int, mapper *Mapper, now time.Time) (ts []mimirpb.PreallocTimeseries, discarded Discarded, bytesRead int, err error) {
+	body, err := pushutil.ReadBody(r, maxSize, pushutil.Gzip)
+	if err != nil {
+		return nil, Discarded{}, len(body), err
+	}
+
+	ts, discarded = parseLines(body, mapper, now)
+	return ts, discarded, len(body), nil
+}
+
+// Discarded counts the lines of a request discarded by ParseRequest.
+type Discarded struct {
+	// Unmapped is the number of lines whose path has no tags and doesn't match any mapping rule.
+	Unmapped int
+	// Invalid is the number of lines which can't be parsed or mapped.
+	Invalid int
+	// InvalidErr is the error of the first invalid line, if any.
+	InvalidErr error
+}
+
+func parseLines(body []byte, mapper *Mapper, now time.Time) ([]mimirpb.PreallocTimeseries, Discarded) {
+	timeseries := mimirpb.PreallocTimeseriesSliceFromPool()[:0]
+
+	// The samples of the same series are appended to the same time series.
+	seriesIndex := map[string]int{}
+	var discarded Discarded
+
+	for lineNum := 1; len(body) > 0; lineNum++ {
+		var line []byte
+		if i := bytes.IndexByte(body, '\n'); i >= 0 {
+			line, body = body[:i], body[i+1:]
+		} else {
+			line, body = body, nil
+		}
+
+		fields := strings.Fields(string(line))
+		if len(fields) == 0 {
+			continue
+		}
+
+		lbls, sample, mapped, err := parseLine(fields, mapper, now)
+		if err != nil {
+			if discarded.Invalid == 0 {
+				discarded.InvalidErr = fmt.Errorf("can't parse line %d: %w", lineNum, err)
+			}
+			discarded.Invalid++
+			continue
+		}
+		if !mapped {
+			discarded.Unmapped++
+			continue
+		}
+
+		key := mimirpb.FromLabelAdaptersToKeyString(lbls)
+		if idx, ok := seriesIndex[key]; ok {
+			timeseries[idx].Samples = append(timeseries[idx].Samples, sample)
+			continue
+		}
+		seriesIndex[key] = len(timeseries)
+		timeseries = append(timeseries, mimirpb.PreallocTimeseries{TimeSeries: &mimirpb.TimeSeries{
+			Labels:  lbls,
+			Samples: []mimirpb.Sample{sample},
+		}})
+	}
+
+	for _, s := range timeseries {
+		slices.SortStableFunc(s.Samples, func(a, b mimirpb.Sample) int {
+			return cmp.Compare(a.TimestampMs, b.TimestampMs)
+		})
+	}
+
+	return timeseries, discarded
+}
+
+// parseLine parses the fields of a line, and returns its labels and sample. It returns false if the line
+// has no tags and its path doesn't match any mapping rule.
+func parseLine(fields []string, mapper *Mapper, now time.Time) ([]mimirpb.LabelAdapter, mimirpb.Sample, bool, error) {
+	if len(fields) > 3 {
+		return nil, mimirpb.Sample{}, false, fmt.Errorf("expected \"<path> <value> [<timestamp>]\", got %d fields", len(fields))
+	}
+	if len(fields) < 2 {
+		return nil, mimirpb.Sample{}, false, errors.New("missing value")
+	}
+
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return nil, mimirpb.Sample{}, false, fmt.Errorf("invalid value %q", fields[1])
+	}
+
+	timestampMs := now.UnixMilli()
+	if len(fields) == 3 && fields[2] != "-1" {
+		ts, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil || math.IsNaN(ts) || math.IsInf(ts, 0) {
+			return nil, mimirpb.Sample{}, false, fmt.Errorf("invalid timestamp %q", fields[2])
+		}
+		timestampMs = int64(math.Round(ts * 1000))
+	}
+
+	path, tags, err := parsePath(fields[0])
+	if err != nil {
+		return nil, mimirpb.Sample{}, false, err
+	}
+
+	name, lbls, mapped, err := mapper.Map(path)
+	if err != nil {
+		return nil, mimirpb.Sample{}, false, err
+	}
+	if !mapped {
+		if len(tags) == 0 {
+			return nil, mimirpb.Sample{}, false, nil
+		}
+		name = pushutil.SanitizeName(path)
+	}
+
+	seen := make(map[string]struct{}, len(lbls)+len(tags))
+	for _, l := range lbls {
+		seen[l.Name] = struct{}{}
+	}
+	for _, t := range tags {
+		if _, ok := seen[t.Name]; ok {
+			continue
+		}
+		seen[t.Name] = struct{}{}
+		lbls = append(lbls, t)
+	}
+	lbls = append(lbls, mimirpb.LabelAdapter{Name: labels.MetricName, Value: name})
+
+	slices.SortFunc(lbls, func(a, b mimirpb.LabelAdapter) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return lbls, mimirpb.Sample{TimestampMs: timestampMs, Value: value}, true, nil
+}
+
+// parsePath splits a Graphite path into the dotted path and its tags, converted into labels.
+// When a tag is repeated, the first value is kept.
+func parsePath(s string) (string, []mimirpb.LabelAdapter, error) {
+	path, rest, tagged := strings.Cut(s, ";")
+	if path == "" {
+		return "", nil, errors.New("empty path")
+	}
+	if !tagged {
+		return path, nil, nil
+	}
+
+	var tags []mimirpb.LabelAdapter
+	for _, tag := range strings.Split(rest, ";") {
+		key, value, ok := strings.Cut(tag, "=")
+		if !ok || key == "" || value == "" {
+			return "", nil, fmt.Errorf("invalid tag %q", tag)
+		}
+		key = pushutil.SanitizeName(key)
+		if key == labels.MetricName || slices.ContainsFunc(tags, func(l mimirpb.LabelAdapter) bool { return l.Name == key }) {
+			continue
+		}
+		tags = append(tags, mimirpb.LabelAdapter{Name: key, Value: value})
+	}
+	return path, tags, nil
+}
@@ -0,0 +1,271 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package graphitepush
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/distributor/pushutil"
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+func TestParseRequest(t *testing.T) {
+	now := time.UnixMilli(1700000000000)
+
+	mapper, err := NewMapper([]validation.GraphiteMappingRule{
+		{
+			Match: "servers.*.cpu.*",
+			Name:  "server_cpu",
+			Labels: map[string]string{
+				"host": "$1",
+				"mode": "${2}",
+			},
+		},
+		{
+			Match:     `apps\.([a-z]+)\.(requests|errors)`,
+			MatchType: validation.GraphiteMatchTypeRegex,
+			Name:      "app_${2}_total",
+			Labels:    map[string]string{"app": "$1"},
+		},
+	})
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		body               string
+		expectedSeries     []mimirpb.PreallocTimeseries
+		expectedDiscarded  Discarded
+		expectedInvalidErr string
+	}{
+		"glob mapping": {
+			body: "servers.web-1.cpu.user 0.5 1700000010\n",
+			expectedSeries: []mimirpb.PreallocTimeseries{
+				makeTimeseries(
+					[]mimirpb.LabelAdapter{
+						{Name: "__name__", Value: "server_cpu"},
+						{Name: "host", Value: "web-1"},
+						{Name: "mode", Value: "user"},
+					},
+					mimirpb.Sample{TimestampMs: 1700000010000, Value: 0.5},
+				),
+			},
+		},
+		"regex mapping": {
+			body: "apps.checkout.errors 3 1700000010.5",
+			expectedSeries: []mimirpb.PreallocTimeseries{
+				makeTimeseries(
+					[]mimirpb.LabelAdapter{
+						{Name: "__name__", Value: "app_errors_total"},
+						{Name: "app", Value: "checkout"},
+					},
+					mimirpb.Sample{TimestampMs: 1700000010500, Value: 3},
+				),
+			},
+		},
+		"samples of the same series are grouped and sorted": {
+			body: "servers.web-1.cpu.user 2 1700000020\nservers.web-2.cpu.user 3 1700000010\nservers.web-1.cpu.user 1 1700000010\n",
+			expectedSeries: []mimirpb.PreallocTimeseries{
+				makeTimeseries(
+					[]mimirpb.LabelAdapter{
+						{Name: "__name__", Value: "server_cpu"},
+						{Name: "host", Value: "web-1"},
+						{Name: "mode", Value: "user"},
+					},
+					mimirpb.Sample{TimestampMs: 1700000010000, Value: 1},
+					mimirpb.Sample{TimestampMs: 1700000020000, Value: 2},
+				),
+				makeTimeseries(
+					[]mimirpb.LabelAdapter{
+						{Name: "__name__", Value: "server_cpu"},
+						{Name: "host", Value: "web-2"},
+						{Name: "mode", Value: "user"},
+					},
+					mimirpb.Sample{TimestampMs: 1700000010000, Value: 3},
+				),
+			},
+		},
+		"missing timestamp and -1 timestamp use now": {
+			body: "servers.web-1.cpu.user 1\nservers.web-2.cpu.user 2 -1\n",
+			expectedSeries: []mimirpb.PreallocTimeseries{
+				makeTimeseries(
+					[]mimirpb.LabelAdapter{
+						{Name: "__name__", Value: "server_cpu"},
+						{Name: "host", Value: "web-1"},
+						{Name: "mode", Value: "user"},
+					},
+					mimirpb.Sample{TimestampMs: 1700000000000, Value: 1},
+				),
+				makeTimeseries(
+					[]mimirpb.LabelAdapter{
+						{Name: "__name__", Value: "server_cpu"},
+						{Name: "host", Value: "web-2"},
+						{Name: "mode", Value: "user"},
+					},
+					mimirpb.Sample{TimestampMs: 1700000000000, Value: 2},
+				),
+			},
+		},
+		"tagged metric without mapping": {
+			body: "disk.used;datacenter=dc1;rack=a1;datacenter=dc2 42 1700000010",
+			expectedSeries: []mimirpb.PreallocTimeseries{
+				makeTimeseries(
+					[]mimirpb.LabelAdapter{
+						{Name: "__name__", Value: "disk_used"},
+						{Name: "datacenter", Value: "dc1"},
+						{Name: "rack", Value: "a1"},
+					},
+					mimirpb.Sample{TimestampMs: 1700000010000, Value: 42},
+				),
+			},
+		},
+		"tagged metric with mapping": {
+			body: "servers.web-1.cpu.user;host=ignored;env=prod 1 1700000010",
+			expectedSeries: []mimirpb.PreallocTimeseries{
+				makeTimeseries(
+					[]mimirpb.LabelAdapter{
+						{Name: "__name__", Value: "server_cpu"},
+						{Name: "env", Value: "prod"},
+						{Name: "host", Value: "web-1"},
+						{Name: "mode", Value: "user"},
+					},
+					mimirpb.Sample{TimestampMs: 1700000010000, Value: 1},
+				),
+			},
+		},
+		"unmapped lines are counted": {
+			body: "unknown.metric 1 1700000010\n\n  \nservers.web-1.cpu.user 1 1700000010\nother.unknown 2\n",
+			expectedSeries: []mimirpb.PreallocTimeseries{
+				makeTimeseries(
+					[]mimirpb.LabelAdapter{
+						{Name: "__name__", Value: "server_cpu"},
+						{Name: "host", Value: "web-1"},
+						{Name: "mode", Value: "user"},
+					},
+					mimirpb.Sample{TimestampMs: 1700000010000, Value: 1},
+				),
+			},
+			expectedDiscarded: Discarded{Unmapped: 2},
+		},
+		"invalid lines are discarded": {
+			body: "servers.web-1.cpu.user 1\nservers.web-1.cpu.user abc 1700000010\nservers.web-2.cpu.user 1 abc",
+			expectedSeries: []mimirpb.PreallocTimeseries{
+				makeTimeseries(
+					[]mimirpb.LabelAdapter{
+						{Name: "__name__", Value: "server_cpu"},
+						{Name: "host", Value: "web-1"},
+						{Name: "mode", Value: "user"},
+					},
+					mimirpb.Sample{TimestampMs: 1700000000000, Value: 1},
+				),
+			},
+			expectedDiscarded:  Discarded{Invalid: 2},
+			expectedInvalidErr: `can't parse line 2: invalid value "abc"`,
+		},
+		"invalid timestamp": {
+			body:               "servers.web-1.cpu.user 1 abc",
+			expectedSeries:     []mimirpb.PreallocTimeseries{},
+			expectedDiscarded:  Discarded{Invalid: 1},
+			expectedInvalidErr: `can't parse line 1: invalid timestamp "abc"`,
+		},
+		"missing value": {
+			body:               "servers.web-1.cpu.user",
+			expectedSeries:     []mimirpb.PreallocTimeseries{},
+			expectedDiscarded:  Discarded{Invalid: 1},
+			expectedInvalidErr: "can't parse line 1: missing value",
+		},
+		"too many fields": {
+			body:               "servers.web-1.cpu.user 1 1700000010 extra",
+			expectedSeries:     []mimirpb.PreallocTimeseries{},
+			expectedDiscarded:  Discarded{Invalid: 1},
+			expectedInvalidErr: "can't parse line 1: expected \"<path> <value> [<timestamp>]\", got 4 fields",
+		},
+		"invalid tag": {
+			body:               "disk.used;datacenter 1",
+			expectedSeries:     []mimirpb.PreallocTimeseries{},
+			expectedDiscarded:  Discarded{Invalid: 1},
+			expectedInvalidErr: `can't parse line 1: invalid tag "datacenter"`,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "/", strings.NewReader(testData.body))
+			require.NoError(t, err)
+
+			timeseries, discarded, bytesRead, err := ParseRequest(req, 1<<20, mapper, now)
+			require.NoError(t, err)
+			assert.Equal(t, len(testData.body), bytesRead)
+			assert.Equal(t, testData.expectedSeries, timeseries)
+			if testData.expectedInvalidErr != "" {
+				require.EqualError(t, discarded.InvalidErr, testData.expectedInvalidErr)
+			} else {
+				require.NoError(t, discarded.InvalidErr)
+			}
+			discarded.InvalidErr = nil
+			assert.Equal(t, testData.expectedDiscarded, discarded)
+		})
+	}
+}
+
+func TestParseRequest_WithoutMappingRules(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "/", strings.NewReader("servers.web-1.cpu.user 1 1700000010\ndisk.used;dc=dc1 2 1700000010\n"))
+	require.NoError(t, err)
+
+	timeseries, discarded, _, err := ParseRequest(req, 1<<20, nil, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, Discarded{Unmapped: 1}, discarded)
+	assert.Equal(t, []mimirpb.PreallocTimeseries{
+		makeTimeseries(
+			[]mimirpb.LabelAdapter{
+				{Name: "__name__", Value: "disk_used"},
+				{Name: "dc", Value: "dc1"},
+			},
+			mimirpb.Sample{TimestampMs: 1700000010000, Value: 2},
+		),
+	}, timeseries)
+}
+
+func TestParseRequest_Compression(t *testing.T) {
+	body := "disk.used;dc=dc1 2 1700000010\n"
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, _ = w.Write([]byte(body))
+	require.NoError(t, w.Close())
+
+	req, err := http.NewRequest(http.MethodPost, "/", &buf)
+	require.NoError(t, err)
+	req.Header.Set("Content-Encoding", "gzip")
+
+	timeseries, _, bytesRead, err := ParseRequest(req, 1<<20, nil, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, len(body), bytesRead)
+	require.Len(t, timeseries, 1)
+
+	req, err = http.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Encoding", "zstd")
+
+	_, _, _, err = ParseRequest(req, 1<<20, nil, time.Now())
+	require.ErrorContains(t, err, "unsupported compression: zstd")
+}
+
+func TestParseRequest_RequestTooLarge(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "/", strings.NewReader("disk.used;dc=dc1 2 1700000010\n"))
+	require.NoError(t, err)
+
+	_, _, _, err = ParseRequest(req, 10, nil, time.Now())
+	require.ErrorIs(t, err, pushutil.ErrRequestTooLarge)
+}
+
+func makeTimeseries(lbls []mimirpb.LabelAdapter, samples ...mimirpb.Sample) mimirpb.PreallocTimeseries {
+	return mimirpb.PreallocTimeseries{TimeSeries: &mimirpb.TimeSeries{Labels: lbls, Samples: samples}}
+}
@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"math/rand"
 	"net/http"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -24,6 +25,7 @@ import (
 	"github.com/grafana/dskit/services"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/timestamp"
 
 	"github.com/grafana/mimir/pkg/mimirpb"
@@ -45,6 +47,7 @@ type haTracker interface {
 	http.Handler
 
 	checkReplica(ctx context.Context, userID, cluster, replica string, now time.Time) error
+	peekReplica(userID, cluster, replica string) error
 	cleanupHATrackerMetricsForUser(userID string)
 }
 
@@ -591,6 +594,31 @@ func (h *defaultHaTracker) checkReplica(ctx context.Context, userID, cluster, re
 	return h.checkReplica(ctx, userID, cluster, replica, now)
 }
 
+// peekReplica returns the error checkReplica would return for the cluster and replica, without updating the
+// tracker state. The replica of a cluster not known yet is considered as elected.
+func (h *defaultHaTracker) peekReplica(userID, cluster, replica string) error {
+	h.electedLock.RLock()
+	entry := h.clusters[userID][cluster]
+	var elected string
+	if entry != nil {
+		elected = entry.elected.Replica
+	}
+	nClusters := len(h.clusters[userID])
+	h.electedLock.RUnlock()
+
+	if entry != nil {
+		if elected != replica {
+			return newReplicasDidNotMatchError(replica, elected)
+		}
+		return nil
+	}
+
+	if limit := h.limits.MaxHAClusters(userID); limit > 0 && nClusters+1 > limit {
+		return newTooManyClustersError(limit)
+	}
+	return nil
+}
+
 type defaultHaTrackerForUser struct {
 	*defaultHaTracker
 	userID              string
@@ -710,22 +738,76 @@ func (h *defaultHaTrackerForUser) updateKVStore(ctx context.Context, cluster, re
 	return err
 }
 
-func findHALabels(replicaLabel, clusterLabel string, labels []mimirpb.LabelAdapter) (string, string) {
+// findHALabels returns the HA cluster and replica of the series. When a single label identifies the HA clusters,
+// the cluster is the value of this label. Otherwise, the cluster is the HA group identified by the values of all the
+// cluster labels, formatted as a label set, and it's empty if any of the cluster labels is missing.
+func findHALabels(replicaLabel string, clusterLabels []string, lbls []mimirpb.LabelAdapter) (string, string) {
 	var cluster, replica string
+	var group []labels.Label
 	var pair mimirpb.LabelAdapter
 
-	for _, pair = range labels {
+	for _, pair = range lbls {
 		if pair.Name == replicaLabel {
 			replica = pair.Value
 		}
-		if pair.Name == clusterLabel {
-			cluster = pair.Value
+		if len(clusterLabels) == 1 {
+			if pair.Name == clusterLabels[0] {
+				cluster = pair.Value
+			}
+		} else if slices.Contains(clusterLabels, pair.Name) {
+			group = append(group, labels.Label{Name: pair.Name, Value: pair.Value})
 		}
 	}
 
+	if len(clusterLabels) > 1 && len(group) == len(clusterLabels) {
+		cluster = labels.New(group...).String()
+	}
+
 	return cluster, replica
 }
 
+// haReplicaGroup is an HA cluster and replica found on the series of a request.
+type haReplicaGroup struct {
+	cluster, replica string
+	// seriesIndexes are the indexes of the series of the request with this cluster and replica, or nil if it's
+	// the only group of the request.
+	seriesIndexes []int
+}
+
+// findHAReplicaGroups groups the series by their HA cluster and replica, in order of first appearance.
+// The cluster and replica are copied, since they may be retained as labels on metrics.
+func findHAReplicaGroups(replicaLabel string, clusterLabels []string, series []mimirpb.PreallocTimeseries) []haReplicaGroup {
+	if len(series) == 0 {
+		return nil
+	}
+
+	cluster, replica := findHALabels(replicaLabel, clusterLabels, series[0].Labels)
+	groups := []haReplicaGroup{{cluster: strings.Clone(cluster), replica: strings.Clone(replica)}}
+
+	for i := 1; i < len(series); i++ {
+		cluster, replica = findHALabels(replicaLabel, clusterLabels, series[i].Labels)
+		if len(groups) == 1 && cluster == groups[0].cluster && replica == groups[0].replica {
+			// Most requests are sent by a single replica, so the series indexes are only tracked once
+			// a second group is found.
+			continue
+		}
+		if groups[0].seriesIndexes == nil {
+			groups[0].seriesIndexes = make([]int, i)
+			for j := range groups[0].seriesIndexes {
+				groups[0].seriesIndexes[j] = j
+			}
+		}
+
+		groupIdx := slices.IndexFunc(groups, func(g haReplicaGroup) bool { return g.cluster == cluster && g.replica == replica })
+		if groupIdx < 0 {
+			groups = append(groups, haReplicaGroup{cluster: strings.Clone(cluster), replica: strings.Clone(replica)})
+			groupIdx = len(groups) - 1
+		}
+		groups[groupIdx].seriesIndexes = append(groups[groupIdx].seriesIndexes, i)
+	}
+	return groups
+}
+
 func (h *defaultHaTracker) cleanupHATrackerMetricsForUser(userID string) {
 	filter := prometheus.Labels{"user": userID}
 
@@ -26,6 +26,10 @@ func (n nopHaTracker) checkReplica(context.Context, string, string, string, time
 	return nil
 }
 
+func (n nopHaTracker) peekReplica(string, string, string) error {
+	return nil
+}
+
 func (n nopHaTracker) cleanupHATrackerMetricsForUser(string) {
 	// no-op
 }
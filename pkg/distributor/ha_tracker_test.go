@@ -975,12 +975,90 @@ func TestHATrackerFindHALabels(t *testing.T) {
 	}
 
 	for _, c := range cases {
-		cluster, replica := findHALabels(replicaLabel, clusterLabel, c.labelsIn)
+		cluster, replica := findHALabels(replicaLabel, []string{clusterLabel}, c.labelsIn)
 		assert.Equal(t, c.expected.cluster, cluster)
 		assert.Equal(t, c.expected.replica, replica)
 	}
 }
 
+func TestHATrackerFindHALabels_MultipleClusterLabels(t *testing.T) {
+	replicaLabel, clusterLabels := "replica", []string{"job", "cluster"}
+
+	cases := map[string]struct {
+		labelsIn        []mimirpb.LabelAdapter
+		expectedCluster string
+		expectedReplica string
+	}{
+		"all the cluster labels": {
+			labelsIn: []mimirpb.LabelAdapter{
+				{Name: "__name__", Value: "foo"},
+				{Name: "cluster", Value: "cluster-1"},
+				{Name: "job", Value: "api"},
+				{Name: replicaLabel, Value: "1"},
+			},
+			expectedCluster: `{cluster="cluster-1", job="api"}`,
+			expectedReplica: "1",
+		},
+		"missing cluster label": {
+			labelsIn: []mimirpb.LabelAdapter{
+				{Name: "__name__", Value: "foo"},
+				{Name: "job", Value: "api"},
+				{Name: replicaLabel, Value: "1"},
+			},
+			expectedCluster: "",
+			expectedReplica: "1",
+		},
+		"missing replica label": {
+			labelsIn: []mimirpb.LabelAdapter{
+				{Name: "__name__", Value: "foo"},
+				{Name: "cluster", Value: "cluster-1"},
+				{Name: "job", Value: "api"},
+			},
+			expectedCluster: `{cluster="cluster-1", job="api"}`,
+			expectedReplica: "",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			cluster, replica := findHALabels(replicaLabel, clusterLabels, c.labelsIn)
+			assert.Equal(t, c.expectedCluster, cluster)
+			assert.Equal(t, c.expectedReplica, replica)
+		})
+	}
+}
+
+func TestFindHAReplicaGroups(t *testing.T) {
+	series := func(cluster, replica string) mimirpb.PreallocTimeseries {
+		return makeTimeseries([]string{"__name__", "foo", "cluster", cluster, "replica", replica}, nil, nil, nil)
+	}
+
+	cases := map[string]struct {
+		series   []mimirpb.PreallocTimeseries
+		expected []haReplicaGroup
+	}{
+		"no series": {},
+		"single group": {
+			series:   []mimirpb.PreallocTimeseries{series("a", "1"), series("a", "1")},
+			expected: []haReplicaGroup{{cluster: "a", replica: "1"}},
+		},
+		"several groups": {
+			series: []mimirpb.PreallocTimeseries{series("a", "1"), series("a", "1"), series("b", "1"), series("a", "2"), series("b", "1")},
+			expected: []haReplicaGroup{
+				{cluster: "a", replica: "1", seriesIndexes: []int{0, 1}},
+				{cluster: "b", replica: "1", seriesIndexes: []int{2, 4}},
+				{cluster: "a", replica: "2", seriesIndexes: []int{3}},
+			},
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, c.expected, findHAReplicaGroups("replica", []string{"cluster"}, c.series))
+		})
+	}
+}
+
 func TestHATrackerConfig_ShouldCustomizePrefixDefaultValue(t *testing.T) {
 	haConfig := HATrackerConfig{}
 	ringConfig := ring.Config{}
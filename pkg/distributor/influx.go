@@ -5,9 +5,11 @@ package distributor
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
@@ -23,11 +25,25 @@ import (
 
 	"github.com/grafana/mimir/pkg/distributor/influxpush"
 	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/storage/ingest"
 	"github.com/grafana/mimir/pkg/util"
 	utillog "github.com/grafana/mimir/pkg/util/log"
 	"github.com/grafana/mimir/pkg/util/spanlogger"
+	"github.com/grafana/mimir/pkg/util/validation"
 )
 
+const (
+	// InfluxV2TenantFromAuth takes the tenant of the InfluxDB v2 write requests from the auth middleware, whatever
+	// their organization and bucket.
+	InfluxV2TenantFromAuth = "auth"
+	// InfluxV2TenantFromOrg requires the organization of the InfluxDB v2 write requests to be the authenticated tenant.
+	InfluxV2TenantFromOrg = "org"
+	// InfluxV2TenantFromBucket requires the bucket of the InfluxDB v2 write requests to be the authenticated tenant.
+	InfluxV2TenantFromBucket = "bucket"
+)
+
+var influxV2TenantFromValues = []string{InfluxV2TenantFromAuth, InfluxV2TenantFromOrg, InfluxV2TenantFromBucket}
+
 func influxRequestParser(ctx context.Context, r *http.Request, maxSize int, _ *util.RequestBuffers, req *mimirpb.PreallocWriteRequest, logger log.Logger) (int, error) {
 	spanLogger, ctx := spanlogger.New(ctx, logger, tracer, "Distributor.InfluxHandler.decodeAndConvert")
 	defer spanLogger.Finish()
@@ -56,6 +72,108 @@ func InfluxHandler(
 	push PushFunc,
 	pushMetrics *PushMetrics,
 	logger log.Logger,
+) http.Handler {
+	return influxHandler(maxRecvMsgSize, requestBufferPool, sourceIPs, retryCfg, push, pushMetrics, logger, nil, writeInfluxV1Error)
+}
+
+// InfluxV2Handler is a http.Handler which accepts requests of the InfluxDB v2 write API and converts them to WriteRequests.
+// The bucket and the organization of the request are added as labels to the series, according to the tenant limits.
+// The tenant of the request is set by InfluxV2AuthMiddleware. Errors are returned in the InfluxDB v2 JSON format.
+func InfluxV2Handler(
+	maxRecvMsgSize int,
+	requestBufferPool util.Pool,
+	sourceIPs *middleware.SourceIPExtractor,
+	limits *validation.Overrides,
+	retryCfg RetryConfig,
+	push PushFunc,
+	pushMetrics *PushMetrics,
+	logger log.Logger,
+) http.Handler {
+	requestLabels := func(tenantID string, r *http.Request) []mimirpb.LabelAdapter {
+		var lbls []mimirpb.LabelAdapter
+		qp := r.URL.Query()
+		if name := limits.InfluxBucketLabel(tenantID); name != "" {
+			lbls = append(lbls, mimirpb.LabelAdapter{Name: name, Value: qp.Get("bucket")})
+		}
+		if name := limits.InfluxOrgLabel(tenantID); name != "" {
+			if org := influxV2Org(r); org != "" {
+				lbls = append(lbls, mimirpb.LabelAdapter{Name: name, Value: org})
+			}
+		}
+		return lbls
+	}
+
+	h := influxHandler(maxRecvMsgSize, requestBufferPool, sourceIPs, retryCfg, push, pushMetrics, logger, requestLabels, writeInfluxV2Error)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := tenant.TenantID(r.Context()); err != nil {
+			writeInfluxV2Error(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if r.URL.Query().Get("bucket") == "" {
+			writeInfluxV2Error(w, http.StatusBadRequest, "bucket not specified")
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// InfluxV2AuthMiddleware returns a middleware authenticating the InfluxDB v2 write requests with auth. The
+// Authorization header, which holds the InfluxDB token of the request, is forwarded to auth as is. If tenantFrom
+// is InfluxV2TenantFromOrg or InfluxV2TenantFromBucket, the requests whose organization or bucket isn't the
+// authenticated tenant are rejected. The tenant is never taken from the request parameters, which are set by the
+// client.
+func InfluxV2AuthMiddleware(tenantFrom string, auth middleware.Interface) middleware.Interface {
+	return middleware.Func(func(next http.Handler) http.Handler {
+		if tenantFrom == InfluxV2TenantFromAuth {
+			return auth.Wrap(next)
+		}
+
+		return auth.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tenantID, err := tenant.TenantID(r.Context())
+			if err != nil {
+				writeInfluxV2Error(w, http.StatusUnauthorized, err.Error())
+				return
+			}
+
+			requested := r.URL.Query().Get("bucket")
+			if tenantFrom == InfluxV2TenantFromOrg {
+				requested = influxV2Org(r)
+			}
+			if requested == "" {
+				writeInfluxV2Error(w, http.StatusBadRequest, fmt.Sprintf("%s not specified", tenantFrom))
+				return
+			}
+			if requested != tenantID {
+				writeInfluxV2Error(w, http.StatusForbidden, fmt.Sprintf("the %s %q isn't the authenticated tenant", tenantFrom, requested))
+				return
+			}
+			next.ServeHTTP(w, r)
+		}))
+	})
+}
+
+// influxV2Org returns the organization of the InfluxDB v2 write request, given either by name or by ID.
+func influxV2Org(r *http.Request) string {
+	qp := r.URL.Query()
+	if org := qp.Get("org"); org != "" {
+		return org
+	}
+	return qp.Get("orgID")
+}
+
+// influxHandler returns a http.Handler accepting Influx Line protocol. The labels returned by requestLabels, if any,
+// are added to all the series of the request, and writeError writes the response of the failed requests.
+func influxHandler(
+	maxRecvMsgSize int,
+	requestBufferPool util.Pool,
+	sourceIPs *middleware.SourceIPExtractor,
+	retryCfg RetryConfig,
+	push PushFunc,
+	pushMetrics *PushMetrics,
+	logger log.Logger,
+	requestLabels func(tenantID string, r *http.Request) []mimirpb.LabelAdapter,
+	writeError func(w http.ResponseWriter, httpCode int, msg string),
 ) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -86,6 +204,9 @@ func InfluxHandler(
 				rb.CleanUp()
 				return nil, nil, err
 			}
+			if requestLabels != nil {
+				setInfluxLabels(req.Timeseries, requestLabels(tenantID, r))
+			}
 
 			cleanup := func() {
 				mimirpb.ReuseSlice(req.Timeseries)
@@ -98,16 +219,19 @@ func InfluxHandler(
 
 		req := newRequest(supplier)
 		req.contentLength = r.ContentLength
+		ctx = ingest.ContextWithProducedOffsets(ctx)
+		ctx = contextWithWriteBufferedMarker(ctx)
+
 		// https://docs.influxdata.com/influxdb/cloud/api/v2/#tag/Response-codes
 		if err := push(ctx, req); err != nil {
 			if errors.Is(err, context.Canceled) {
 				level.Warn(logger).Log("msg", "push request canceled", "err", err)
-				w.WriteHeader(statusClientClosedRequest)
+				writeError(w, statusClientClosedRequest, err.Error())
 				return
 			}
 			if errors.Is(err, influxio.ErrReadLimitExceeded) {
 				level.Warn(logger).Log("msg", "request too large", "err", err, "bytesRead", bytesRead, "maxMsgSize", maxRecvMsgSize)
-				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				writeError(w, http.StatusRequestEntityTooLarge, err.Error())
 				return
 			}
 			// From: https://github.com/grafana/influx2cortex/blob/main/pkg/influx/errors.go
@@ -144,14 +268,87 @@ func InfluxHandler(
 				level.Warn(logger).Log("msg", errorMsg, "response_code", httpCode, "err", err)
 			}
 			addErrorHeaders(w, err, r, httpCode, retryCfg)
-			w.WriteHeader(httpCode)
+			writeError(w, httpCode, errorMsg)
 		} else {
 			addSuccessHeaders(w, req.artificialDelay)
-			w.WriteHeader(http.StatusNoContent) // Needed for Telegraf, otherwise it tries to marshal JSON and considers the write a failure.
+			addReadConsistencyOffsetsHeader(ctx, w)
+			w.WriteHeader(successStatusCode(ctx, w, http.StatusNoContent)) // Needed for Telegraf, otherwise it tries to marshal JSON and considers the write a failure.
 		}
 	})
 }
 
+// setInfluxLabels sets the given labels on all the series, overriding the existing labels with the same name.
+func setInfluxLabels(timeseries []mimirpb.PreallocTimeseries, lbls []mimirpb.LabelAdapter) {
+	if len(lbls) == 0 {
+		return
+	}
+
+	for _, ts := range timeseries {
+		for _, l := range lbls {
+			idx := slices.IndexFunc(ts.Labels, func(existing mimirpb.LabelAdapter) bool { return existing.Name == l.Name })
+			if idx >= 0 {
+				ts.Labels[idx].Value = l.Value
+			} else {
+				ts.Labels = append(ts.Labels, l)
+			}
+		}
+		slices.SortFunc(ts.Labels, func(a, b mimirpb.LabelAdapter) int {
+			return strings.Compare(a.Name, b.Name)
+		})
+	}
+}
+
+func writeInfluxV1Error(w http.ResponseWriter, httpCode int, _ string) {
+	w.WriteHeader(httpCode)
+}
+
+// influxV2Error is the body of the error responses of the InfluxDB v2 API.
+type influxV2Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// writeInfluxV2Error writes an error response in the InfluxDB v2 format.
+// See https://docs.influxdata.com/influxdb/v2/api/#tag/Response-codes.
+func writeInfluxV2Error(w http.ResponseWriter, httpCode int, msg string) {
+	if httpCode/100 == 2 {
+		// Some errors, like the samples deduplicated by the HA tracker, are successful responses.
+		w.WriteHeader(httpCode)
+		return
+	}
+
+	code := influxV2ErrorCode(httpCode)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Platform-Error-Code", code)
+	w.WriteHeader(httpCode)
+	_ = json.NewEncoder(w).Encode(influxV2Error{Code: code, Message: msg})
+}
+
+func influxV2ErrorCode(httpCode int) string {
+	switch httpCode {
+	case http.StatusBadRequest:
+		return "invalid"
+	case http.StatusUnauthorized:
+		return "unauthorized"
+	case http.StatusForbidden:
+		return "forbidden"
+	case http.StatusNotFound:
+		return "not found"
+	case http.StatusRequestEntityTooLarge:
+		return "request too large"
+	case http.StatusUnsupportedMediaType:
+		return "unsupported media type"
+	case http.StatusUnprocessableEntity:
+		return "unprocessable entity"
+	case http.StatusTooManyRequests:
+		return "too many requests"
+	case http.StatusServiceUnavailable:
+		return "unavailable"
+	default:
+		return "internal error"
+	}
+}
+
 // TimeseriesToInfluxRequest is used in tests.
 func TimeseriesToInfluxRequest(timeseries []prompb.TimeSeries) string {
 	var retBuffer bytes.Buffer
@@ -4,17 +4,25 @@ package distributor
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/go-kit/log"
+	"github.com/grafana/dskit/middleware"
+	"github.com/grafana/dskit/tenant"
 	"github.com/grafana/dskit/user"
 	influxio "github.com/influxdata/influxdb/v2/kit/io"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util/validation"
 )
 
 func TestInfluxHandleSeriesPush(t *testing.T) {
@@ -149,3 +157,325 @@ func TestInfluxHandleSeriesPush(t *testing.T) {
 		})
 	}
 }
+
+func TestInfluxV2HandleSeriesPush(t *testing.T) {
+	const tenantID = "test"
+
+	limits := validation.MockOverrides(func(_ *validation.Limits, tenantLimits map[string]*validation.Limits) {
+		tenantLimits[tenantID] = validation.MockDefaultLimits()
+		tenantLimits[tenantID].InfluxOrgLabel = "org"
+	})
+
+	expectedWriteRequest := func(extraLabels ...mimirpb.LabelAdapter) *mimirpb.WriteRequest {
+		lbls := append([]mimirpb.LabelAdapter{
+			{Name: "__name__", Value: "measurement_f1"},
+			{Name: "__proxy_source__", Value: "influx"},
+			{Name: "t1", Value: "v1"},
+		}, extraLabels...)
+		slices.SortFunc(lbls, func(a, b mimirpb.LabelAdapter) int { return strings.Compare(a.Name, b.Name) })
+
+		return &mimirpb.WriteRequest{
+			Timeseries: []mimirpb.PreallocTimeseries{
+				{
+					TimeSeries: &mimirpb.TimeSeries{
+						Labels:  lbls,
+						Samples: []mimirpb.Sample{{Value: 2, TimestampMs: 1465839830100}},
+					},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name                string
+		url                 string
+		tenantID            string
+		data                string
+		gzip                bool
+		expectedCode        int
+		expectedErrorCode   string
+		push                func(t *testing.T) PushFunc
+		maxRequestSizeBytes int
+	}{
+		{
+			name:         "bucket and org are added as labels",
+			url:          "/api/v2/write?org=my-org&bucket=my-bucket",
+			tenantID:     tenantID,
+			data:         "measurement,t1=v1 f1=2 1465839830100400200",
+			expectedCode: http.StatusNoContent,
+			push: func(t *testing.T) PushFunc {
+				return func(_ context.Context, pushReq *Request) error {
+					req, err := pushReq.WriteRequest()
+					assert.Equal(t, expectedWriteRequest(mimirpb.LabelAdapter{Name: "bucket", Value: "my-bucket"}, mimirpb.LabelAdapter{Name: "org", Value: "my-org"}), req)
+					assert.Nil(t, err)
+					return err
+				}
+			},
+			maxRequestSizeBytes: 1 << 20,
+		},
+		{
+			name:         "bucket overrides a tag with the same name, org label disabled by default",
+			url:          "/api/v2/write?org=my-org&bucket=my-bucket",
+			tenantID:     "other",
+			data:         "measurement,t1=v1,bucket=tag f1=2 1465839830100400200",
+			expectedCode: http.StatusNoContent,
+			push: func(t *testing.T) PushFunc {
+				return func(_ context.Context, pushReq *Request) error {
+					req, err := pushReq.WriteRequest()
+					assert.Equal(t, expectedWriteRequest(mimirpb.LabelAdapter{Name: "bucket", Value: "my-bucket"}), req)
+					assert.Nil(t, err)
+					return err
+				}
+			},
+			maxRequestSizeBytes: 1 << 20,
+		},
+		{
+			name:         "precision and gzip",
+			url:          "/api/v2/write?bucket=my-bucket&precision=ms&orgID=my-org-id",
+			tenantID:     tenantID,
+			data:         "measurement,t1=v1 f1=2 1465839830100",
+			gzip:         true,
+			expectedCode: http.StatusNoContent,
+			push: func(t *testing.T) PushFunc {
+				return func(_ context.Context, pushReq *Request) error {
+					req, err := pushReq.WriteRequest()
+					assert.Equal(t, expectedWriteRequest(mimirpb.LabelAdapter{Name: "bucket", Value: "my-bucket"}, mimirpb.LabelAdapter{Name: "org", Value: "my-org-id"}), req)
+					assert.Nil(t, err)
+					return err
+				}
+			},
+			maxRequestSizeBytes: 1 << 20,
+		},
+		{
+			name:         "precision in seconds",
+			url:          "/api/v2/write?bucket=my-bucket&precision=s",
+			tenantID:     "other",
+			data:         "measurement,t1=v1 f1=2 1465839830",
+			expectedCode: http.StatusNoContent,
+			push: func(t *testing.T) PushFunc {
+				return func(_ context.Context, pushReq *Request) error {
+					req, err := pushReq.WriteRequest()
+					require.NoError(t, err)
+					assert.Equal(t, int64(1465839830000), req.Timeseries[0].Samples[0].TimestampMs)
+					return nil
+				}
+			},
+			maxRequestSizeBytes: 1 << 20,
+		},
+		{
+			name:              "missing bucket",
+			url:               "/api/v2/write?org=my-org",
+			tenantID:          tenantID,
+			data:              "measurement,t1=v1 f1=2 1465839830100400200",
+			expectedCode:      http.StatusBadRequest,
+			expectedErrorCode: "invalid",
+			push: func(t *testing.T) PushFunc {
+				return func(context.Context, *Request) error {
+					t.Error("push shouldn't be called")
+					return nil
+				}
+			},
+			maxRequestSizeBytes: 1 << 20,
+		},
+		{
+			name:              "missing tenant",
+			url:               "/api/v2/write?bucket=my-bucket",
+			data:              "measurement,t1=v1 f1=2 1465839830100400200",
+			expectedCode:      http.StatusUnauthorized,
+			expectedErrorCode: "unauthorized",
+			push: func(t *testing.T) PushFunc {
+				return func(context.Context, *Request) error {
+					t.Error("push shouldn't be called")
+					return nil
+				}
+			},
+			maxRequestSizeBytes: 1 << 20,
+		},
+		{
+			name:              "invalid line protocol",
+			url:               "/api/v2/write?bucket=my-bucket",
+			tenantID:          tenantID,
+			data:              "measurement,t1=v1 f1= 1465839830100400200",
+			expectedCode:      http.StatusBadRequest,
+			expectedErrorCode: "invalid",
+			push: func(*testing.T) PushFunc {
+				return func(_ context.Context, pushReq *Request) error {
+					_, err := pushReq.WriteRequest()
+					return err
+				}
+			},
+			maxRequestSizeBytes: 1 << 20,
+		},
+		{
+			name:              "invalid precision",
+			url:               "/api/v2/write?bucket=my-bucket&precision=h",
+			tenantID:          tenantID,
+			data:              "measurement,t1=v1 f1=2 1465839830100400200",
+			expectedCode:      http.StatusBadRequest,
+			expectedErrorCode: "invalid",
+			push: func(*testing.T) PushFunc {
+				return func(_ context.Context, pushReq *Request) error {
+					_, err := pushReq.WriteRequest()
+					return err
+				}
+			},
+			maxRequestSizeBytes: 1 << 20,
+		},
+		{
+			name:              "service unavailable",
+			url:               "/api/v2/write?bucket=my-bucket",
+			tenantID:          tenantID,
+			data:              "measurement,t1=v1 f1=2 1465839830100400200",
+			expectedCode:      http.StatusServiceUnavailable,
+			expectedErrorCode: "unavailable",
+			push: func(*testing.T) PushFunc {
+				return func(context.Context, *Request) error {
+					return context.DeadlineExceeded
+				}
+			},
+			maxRequestSizeBytes: 1 << 20,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := InfluxV2Handler(tt.maxRequestSizeBytes, nil, nil, limits, RetryConfig{}, tt.push(t), nil, log.NewNopLogger())
+
+			body := []byte(tt.data)
+			if tt.gzip {
+				var buf bytes.Buffer
+				gz := gzip.NewWriter(&buf)
+				_, err := gz.Write(body)
+				require.NoError(t, err)
+				require.NoError(t, gz.Close())
+				body = buf.Bytes()
+			}
+
+			req := httptest.NewRequest("POST", tt.url, bytes.NewReader(body))
+			if tt.gzip {
+				req.Header.Set("Content-Encoding", "gzip")
+			}
+			if tt.tenantID != "" {
+				req = req.WithContext(user.InjectOrgID(context.Background(), tt.tenantID))
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			assert.Equal(t, tt.expectedCode, rec.Code)
+
+			if tt.expectedErrorCode != "" {
+				var resp influxV2Error
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+				assert.Equal(t, tt.expectedErrorCode, resp.Code)
+				assert.NotEmpty(t, resp.Message)
+				assert.Equal(t, tt.expectedErrorCode, rec.Header().Get("X-Platform-Error-Code"))
+			} else {
+				assert.Empty(t, rec.Body.Bytes())
+			}
+		})
+	}
+}
+
+func TestInfluxV2AuthMiddleware(t *testing.T) {
+	tests := map[string]struct {
+		tenantFrom        string
+		url               string
+		header            http.Header
+		expectedCode      int
+		expectedTenant    string
+		expectedErrorCode string
+	}{
+		"tenant from the auth middleware": {
+			tenantFrom:     InfluxV2TenantFromAuth,
+			url:            "/api/v2/write?org=my-org&bucket=my-bucket",
+			header:         http.Header{user.OrgIDHeaderName: {"tenant-1"}},
+			expectedCode:   http.StatusNoContent,
+			expectedTenant: "tenant-1",
+		},
+		"tenant from the auth middleware, missing tenant": {
+			tenantFrom:   InfluxV2TenantFromAuth,
+			url:          "/api/v2/write?org=my-org&bucket=my-bucket",
+			header:       http.Header{"Authorization": {"Token secret"}},
+			expectedCode: http.StatusUnauthorized,
+		},
+		"organization matching the tenant": {
+			tenantFrom:     InfluxV2TenantFromOrg,
+			url:            "/api/v2/write?org=tenant-1&bucket=my-bucket",
+			header:         http.Header{user.OrgIDHeaderName: {"tenant-1"}},
+			expectedCode:   http.StatusNoContent,
+			expectedTenant: "tenant-1",
+		},
+		"organization ID matching the tenant": {
+			tenantFrom:     InfluxV2TenantFromOrg,
+			url:            "/api/v2/write?orgID=tenant-1&bucket=my-bucket",
+			header:         http.Header{user.OrgIDHeaderName: {"tenant-1"}},
+			expectedCode:   http.StatusNoContent,
+			expectedTenant: "tenant-1",
+		},
+		"bucket matching the tenant": {
+			tenantFrom:     InfluxV2TenantFromBucket,
+			url:            "/api/v2/write?org=my-org&bucket=tenant-1",
+			header:         http.Header{user.OrgIDHeaderName: {"tenant-1"}},
+			expectedCode:   http.StatusNoContent,
+			expectedTenant: "tenant-1",
+		},
+		"organization not matching the tenant": {
+			tenantFrom:        InfluxV2TenantFromOrg,
+			url:               "/api/v2/write?org=tenant-2&bucket=my-bucket",
+			header:            http.Header{user.OrgIDHeaderName: {"tenant-1"}},
+			expectedCode:      http.StatusForbidden,
+			expectedErrorCode: "forbidden",
+		},
+		"bucket not matching the tenant": {
+			tenantFrom:        InfluxV2TenantFromBucket,
+			url:               "/api/v2/write?org=tenant-1&bucket=tenant-2",
+			header:            http.Header{user.OrgIDHeaderName: {"tenant-1"}},
+			expectedCode:      http.StatusForbidden,
+			expectedErrorCode: "forbidden",
+		},
+		"organization without authenticated tenant": {
+			tenantFrom:   InfluxV2TenantFromOrg,
+			url:          "/api/v2/write?org=tenant-1&bucket=my-bucket",
+			expectedCode: http.StatusUnauthorized,
+		},
+		"missing organization": {
+			tenantFrom:        InfluxV2TenantFromOrg,
+			url:               "/api/v2/write?bucket=my-bucket",
+			header:            http.Header{user.OrgIDHeaderName: {"tenant-1"}},
+			expectedCode:      http.StatusBadRequest,
+			expectedErrorCode: "invalid",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var tenantID, authorization string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var err error
+				tenantID, err = tenant.TenantID(r.Context())
+				require.NoError(t, err)
+				authorization = r.Header.Get("Authorization")
+				w.WriteHeader(http.StatusNoContent)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, tc.url, nil)
+			req.Header.Set("Authorization", "Token secret")
+			for k, v := range tc.header {
+				req.Header.Set(k, v[0])
+			}
+			rec := httptest.NewRecorder()
+			InfluxV2AuthMiddleware(tc.tenantFrom, middleware.AuthenticateUser).Wrap(next).ServeHTTP(rec, req)
+
+			require.Equal(t, tc.expectedCode, rec.Code)
+			if tc.expectedCode == http.StatusNoContent {
+				assert.Equal(t, tc.expectedTenant, tenantID)
+				// The InfluxDB token is forwarded to the auth middleware and the handler.
+				assert.Equal(t, "Token secret", authorization)
+			}
+			if tc.expectedErrorCode != "" {
+				var resp influxV2Error
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+				assert.Equal(t, tc.expectedErrorCode, resp.Code)
+			}
+		})
+	}
+}
@@ -28,8 +28,11 @@ const internalLabel = "__proxy_source__"
 func ParseInfluxLineReader(_ context.Context, r *http.Request, maxSize int) ([]mimirpb.PreallocTimeseries, int, error) {
 	qp := r.URL.Query()
 	precision := qp.Get("precision")
-	if precision == "" {
+	switch precision {
+	case "", "n":
 		precision = "ns"
+	case "u":
+		precision = "us"
 	}
 
 	if !models.ValidPrecision(precision) {
@@ -54,6 +54,36 @@ func TestParseInfluxLineReader(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "parse simple line with microseconds precision alias",
+			url:  "/?precision=u",
+			data: "measurement,t1=v1 f1=2 1465839830100400",
+			expectedResult: []mimirpb.TimeSeries{
+				{
+					Labels: []mimirpb.LabelAdapter{
+						{Name: "__name__", Value: "measurement_f1"},
+						{Name: "__proxy_source__", Value: "influx"},
+						{Name: "t1", Value: "v1"},
+					},
+					Samples: []mimirpb.Sample{{Value: 2, TimestampMs: 1465839830100}},
+				},
+			},
+		},
+		{
+			name: "parse simple line with nanoseconds precision alias",
+			url:  "/?precision=n",
+			data: "measurement,t1=v1 f1=2 1465839830100400200",
+			expectedResult: []mimirpb.TimeSeries{
+				{
+					Labels: []mimirpb.LabelAdapter{
+						{Name: "__name__", Value: "measurement_f1"},
+						{Name: "__proxy_source__", Value: "influx"},
+						{Name: "t1", Value: "v1"},
+					},
+					Samples: []mimirpb.Sample{{Value: 2, TimestampMs: 1465839830100}},
+				},
+			},
+		},
 		{
 			name: "parse simple line single float value",
 			url:  "/",
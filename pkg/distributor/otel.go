@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
 	"strconv"
 	"time"
 
@@ -39,6 +40,7 @@ import (
 
 	"github.com/grafana/mimir/pkg/distributor/otlp"
 	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/storage/ingest"
 	"github.com/grafana/mimir/pkg/util"
 	utillog "github.com/grafana/mimir/pkg/util/log"
 	"github.com/grafana/mimir/pkg/util/spanlogger"
@@ -61,6 +63,10 @@ type OTLPHandlerLimits interface {
 	OTelConvertHistogramsToNHCB(id string) bool
 	OTelPromoteScopeMetadata(id string) bool
 	OTelNativeDeltaIngestion(id string) bool
+	OTelConvertDeltaToCumulative(id string) bool
+	AcceptHASamples(id string) bool
+	HAClusterLabels(id string) []string
+	HAReplicaLabel(id string) string
 }
 
 // OTLPHandler is an http.Handler accepting OTLP write requests.
@@ -72,12 +78,13 @@ func OTLPHandler(
 	resourceAttributePromotionConfig OTelResourceAttributePromotionConfig,
 	retryCfg RetryConfig,
 	enableStartTimeQuietZero bool,
+	deltaToCumulative *DeltaToCumulativeConverter,
 	push PushFunc,
 	pushMetrics *PushMetrics,
 	reg prometheus.Registerer,
 	logger log.Logger,
 ) http.Handler {
-	discardedDueToOtelParseError := validation.DiscardedSamplesCounter(reg, otelParseError)
+	discardedDueToOtelParseError := newDiscardedDueToOtelParseErrorCounter(reg)
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
@@ -91,7 +98,9 @@ func OTLPHandler(
 
 		otlpConverter := newOTLPMimirConverter()
 
-		parser := newOTLPParser(limits, resourceAttributePromotionConfig, otlpConverter, enableStartTimeQuietZero, pushMetrics, discardedDueToOtelParseError)
+		deltas := deltaToCumulative.NewBatch()
+
+		parser := newOTLPParser(limits, resourceAttributePromotionConfig, otlpConverter, enableStartTimeQuietZero, deltas, pushMetrics, discardedDueToOtelParseError)
 
 		supplier := func() (*mimirpb.WriteRequest, func(), error) {
 			rb := util.NewRequestBuffers(requestBufferPool)
@@ -115,8 +124,14 @@ func OTLPHandler(
 		req := newRequest(supplier)
 		req.contentLength = r.ContentLength
 
+		ctx = ingest.ContextWithProducedOffsets(ctx)
+		ctx = contextWithWriteBufferedMarker(ctx)
 		pushErr := push(ctx, req)
 		if pushErr == nil {
+			// The running totals of the delta streams are only updated once the request has been ingested,
+			// so that a retried request isn't accumulated twice.
+			deltas.Commit()
+
 			if otlpErr := otlpConverter.Err(); otlpErr != nil {
 				// Push was successful, but OTLP converter left out some samples. We let the client know about it by replying with 4xx (and an insight log).
 				pushErr = httpgrpc.Error(http.StatusBadRequest, otlpErr.Error())
@@ -125,7 +140,8 @@ func OTLPHandler(
 				// https://opentelemetry.io/docs/specs/otlp/#otlphttp-response.
 				var expResp colmetricpb.ExportMetricsServiceResponse
 				addSuccessHeaders(w, req.artificialDelay)
-				writeOTLPResponse(r, w, http.StatusOK, &expResp, logger)
+				addReadConsistencyOffsetsHeader(ctx, w)
+				writeOTLPResponse(r, w, successStatusCode(ctx, w, http.StatusOK), &expResp, logger)
 				return
 			}
 		}
@@ -135,31 +151,8 @@ func OTLPHandler(
 			writeErrorToHTTPResponseBody(r, w, statusClientClosedRequest, codes.Canceled, "push request context canceled", logger)
 			return
 		}
-		if labelValueTooLongErr := (LabelValueTooLongError{}); errors.As(pushErr, &labelValueTooLongErr) {
-			// Translate from Mimir to OTel domain terminology
-			pushErr = newValidationError(otelAttributeValueTooLongError{labelValueTooLongErr})
-		}
-		var (
-			httpCode int
-			grpcCode codes.Code
-			errorMsg string
-		)
-		if st, ok := grpcutil.ErrorToStatus(pushErr); ok {
-			grpcCode = st.Code()
-			errorMsg = st.Message()
-
-			// This code is needed for a correct handling of errors returned by the supplier function.
-			// These errors are usually created by using the httpgrpc package.
-			// However, distributor's write path is complex and has a lot of dependencies, so sometimes it's not.
-			if util.IsHTTPStatusCode(grpcCode) {
-				httpCode = httpRetryableToOTLPRetryable(int(grpcCode))
-			} else {
-				httpCode = http.StatusServiceUnavailable
-			}
-		} else {
-			grpcCode, httpCode = toOtlpGRPCHTTPStatus(pushErr)
-			errorMsg = pushErr.Error()
-		}
+		pushErr = toOtelDomainError(pushErr)
+		grpcCode, httpCode, errorMsg := toOtlpErrorStatus(pushErr)
 		if httpCode != 202 {
 			// This error message is consistent with error message in Prometheus remote-write handler, and ingester's ingest-storage pushToStorage method.
 			msgs := []interface{}{"msg", "detected an error while ingesting OTLP metrics request (the request may have been partially ingested)", "httpCode", httpCode, "err", pushErr}
@@ -175,11 +168,30 @@ func OTLPHandler(
 	})
 }
 
+// newDiscardedDueToOtelParseErrorCounter returns the counter of samples discarded because of OTLP parse errors.
+// The counter is shared between the OTLP HTTP and gRPC endpoints, so the already registered one is returned, if any.
+func newDiscardedDueToOtelParseErrorCounter(reg prometheus.Registerer) *prometheus.CounterVec {
+	counter := validation.DiscardedSamplesCounter(nil, otelParseError)
+	if reg == nil {
+		return counter
+	}
+
+	if err := reg.Register(counter); err != nil {
+		alreadyRegisteredErr := prometheus.AlreadyRegisteredError{}
+		if errors.As(err, &alreadyRegisteredErr) {
+			return alreadyRegisteredErr.ExistingCollector.(*prometheus.CounterVec)
+		}
+		panic(err)
+	}
+	return counter
+}
+
 func newOTLPParser(
 	limits OTLPHandlerLimits,
 	resourceAttributePromotionConfig OTelResourceAttributePromotionConfig,
 	otlpConverter *otlpMimirConverter,
 	enableStartTimeQuietZero bool,
+	deltas *DeltaToCumulativeBatch,
 	pushMetrics *PushMetrics,
 	discardedDueToOtelParseError *prometheus.CounterVec,
 ) parserFunc {
@@ -280,73 +292,134 @@ func newOTLPParser(
 
 		level.Debug(spanLogger).Log("msg", "decoding complete, starting conversion")
 
-		tenantID, err := tenant.TenantID(ctx)
-		if err != nil {
-			return err
-		}
-		addSuffixes := limits.OTelMetricSuffixesEnabled(tenantID)
-		enableCTZeroIngestion := limits.OTelCreatedTimestampZeroIngestionEnabled(tenantID)
-		if resourceAttributePromotionConfig == nil {
-			resourceAttributePromotionConfig = limits
-		}
-		promoteResourceAttributes := resourceAttributePromotionConfig.PromoteOTelResourceAttributes(tenantID)
-		keepIdentifyingResourceAttributes := limits.OTelKeepIdentifyingResourceAttributes(tenantID)
-		convertHistogramsToNHCB := limits.OTelConvertHistogramsToNHCB(tenantID)
-		promoteScopeMetadata := limits.OTelPromoteScopeMetadata(tenantID)
-		allowDeltaTemporality := limits.OTelNativeDeltaIngestion(tenantID)
+		return convertOTLPExportRequest(ctx, otlpReq, uncompressedBodySize, limits, resourceAttributePromotionConfig, otlpConverter, enableStartTimeQuietZero, deltas, pushMetrics, discardedDueToOtelParseError, req, spanLogger)
+	}
+}
 
+// convertOTLPExportRequest converts the decoded OTLP export request into the Mimir write request req.
+// It's shared between the OTLP HTTP and gRPC endpoints. The delta data points converted into cumulative
+// ones are staged in deltas, which must be committed once req has been successfully pushed.
+func convertOTLPExportRequest(
+	ctx context.Context,
+	otlpReq pmetricotlp.ExportRequest,
+	uncompressedBodySize int,
+	limits OTLPHandlerLimits,
+	resourceAttributePromotionConfig OTelResourceAttributePromotionConfig,
+	otlpConverter *otlpMimirConverter,
+	enableStartTimeQuietZero bool,
+	deltas *DeltaToCumulativeBatch,
+	pushMetrics *PushMetrics,
+	discardedDueToOtelParseError *prometheus.CounterVec,
+	req *mimirpb.PreallocWriteRequest,
+	spanLogger log.Logger,
+) error {
+	tenantID, err := tenant.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+	addSuffixes := limits.OTelMetricSuffixesEnabled(tenantID)
+	enableCTZeroIngestion := limits.OTelCreatedTimestampZeroIngestionEnabled(tenantID)
+	if resourceAttributePromotionConfig == nil {
+		resourceAttributePromotionConfig = limits
+	}
+	promoteResourceAttributes := resourceAttributePromotionConfig.PromoteOTelResourceAttributes(tenantID)
+	keepIdentifyingResourceAttributes := limits.OTelKeepIdentifyingResourceAttributes(tenantID)
+	convertHistogramsToNHCB := limits.OTelConvertHistogramsToNHCB(tenantID)
+	promoteScopeMetadata := limits.OTelPromoteScopeMetadata(tenantID)
+	allowDeltaTemporality := limits.OTelNativeDeltaIngestion(tenantID)
+	if limits.AcceptHASamples(tenantID) {
+		// The resource attributes identifying the HA cluster and replica are promoted to labels,
+		// so that the HA tracker can deduplicate the requests of the OTel collectors running as pairs.
+		haLabels := append(slices.Clone(limits.HAClusterLabels(tenantID)), limits.HAReplicaLabel(tenantID))
+		promoteResourceAttributes = appendHAResourceAttributes(promoteResourceAttributes, haLabels, otlpReq.Metrics())
+	}
+
+	if !isForwardedOTLPDeltas(ctx) {
+		// The delta data points forwarded by another distributor have already been counted by it.
 		pushMetrics.IncOTLPRequest(tenantID)
 		pushMetrics.ObserveUncompressedBodySize(tenantID, float64(uncompressedBodySize))
+	}
 
-		metrics, metricsDropped, err := otelMetricsToTimeseries(
-			ctx,
-			otlpConverter,
-			otlpReq.Metrics(),
-			conversionOptions{
-				addSuffixes:                       addSuffixes,
-				enableCTZeroIngestion:             enableCTZeroIngestion,
-				enableStartTimeQuietZero:          enableStartTimeQuietZero,
-				keepIdentifyingResourceAttributes: keepIdentifyingResourceAttributes,
-				convertHistogramsToNHCB:           convertHistogramsToNHCB,
-				promoteScopeMetadata:              promoteScopeMetadata,
-				promoteResourceAttributes:         promoteResourceAttributes,
-				allowDeltaTemporality:             allowDeltaTemporality,
-			},
-			spanLogger,
-		)
-		if metricsDropped > 0 {
-			discardedDueToOtelParseError.WithLabelValues(tenantID, "").Add(float64(metricsDropped)) // "group" label is empty here as metrics couldn't be parsed
-		}
-		if err != nil {
+	if deltas != nil && limits.OTelConvertDeltaToCumulative(tenantID) {
+		// Delta metrics are converted into cumulative ones before the translation, so that they're
+		// translated like any other cumulative metric.
+		if err := deltas.Convert(ctx, tenantID, otlpReq.Metrics()); err != nil {
 			return err
 		}
+	}
 
-		metricCount := len(metrics)
-		sampleCount := 0
-		histogramCount := 0
-		exemplarCount := 0
+	metrics, metricsDropped, err := otelMetricsToTimeseries(
+		ctx,
+		otlpConverter,
+		otlpReq.Metrics(),
+		conversionOptions{
+			addSuffixes:                       addSuffixes,
+			enableCTZeroIngestion:             enableCTZeroIngestion,
+			enableStartTimeQuietZero:          enableStartTimeQuietZero,
+			keepIdentifyingResourceAttributes: keepIdentifyingResourceAttributes,
+			convertHistogramsToNHCB:           convertHistogramsToNHCB,
+			promoteScopeMetadata:              promoteScopeMetadata,
+			promoteResourceAttributes:         promoteResourceAttributes,
+			allowDeltaTemporality:             allowDeltaTemporality,
+		},
+		spanLogger,
+	)
+	if metricsDropped > 0 {
+		discardedDueToOtelParseError.WithLabelValues(tenantID, "").Add(float64(metricsDropped)) // "group" label is empty here as metrics couldn't be parsed
+	}
+	if err != nil {
+		return err
+	}
 
-		for _, m := range metrics {
-			sampleCount += len(m.Samples)
-			histogramCount += len(m.Histograms)
-			exemplarCount += len(m.Exemplars)
-		}
+	metricCount := len(metrics)
+	sampleCount := 0
+	histogramCount := 0
+	exemplarCount := 0
 
-		level.Debug(spanLogger).Log(
-			"msg", "OTLP to Prometheus conversion complete",
-			"metric_count", metricCount,
-			"metrics_dropped", metricsDropped,
-			"sample_count", sampleCount,
-			"histogram_count", histogramCount,
-			"exemplar_count", exemplarCount,
-			"promoted_resource_attributes", promoteResourceAttributes,
-		)
+	for _, m := range metrics {
+		sampleCount += len(m.Samples)
+		histogramCount += len(m.Histograms)
+		exemplarCount += len(m.Exemplars)
+	}
 
-		req.Timeseries = metrics
-		req.Metadata = otelMetricsToMetadata(addSuffixes, otlpReq.Metrics())
+	level.Debug(spanLogger).Log(
+		"msg", "OTLP to Prometheus conversion complete",
+		"metric_count", metricCount,
+		"metrics_dropped", metricsDropped,
+		"sample_count", sampleCount,
+		"histogram_count", histogramCount,
+		"exemplar_count", exemplarCount,
+		"promoted_resource_attributes", promoteResourceAttributes,
+	)
 
-		return nil
+	req.Timeseries = metrics
+	req.Metadata = otelMetricsToMetadata(addSuffixes, otlpReq.Metrics())
+
+	return nil
+}
+
+// toOtelDomainError translates the input push error from Mimir to OTel domain terminology.
+func toOtelDomainError(pushErr error) error {
+	if labelValueTooLongErr := (LabelValueTooLongError{}); errors.As(pushErr, &labelValueTooLongErr) {
+		return newValidationError(otelAttributeValueTooLongError{labelValueTooLongErr})
 	}
+	return pushErr
+}
+
+// toOtlpErrorStatus returns the gRPC and HTTP status codes, and the error message, of the OTLP response to the input push error.
+func toOtlpErrorStatus(pushErr error) (codes.Code, int, string) {
+	if st, ok := grpcutil.ErrorToStatus(pushErr); ok {
+		// This code is needed for a correct handling of errors returned by the supplier function.
+		// These errors are usually created by using the httpgrpc package.
+		// However, distributor's write path is complex and has a lot of dependencies, so sometimes it's not.
+		if util.IsHTTPStatusCode(st.Code()) {
+			return st.Code(), httpRetryableToOTLPRetryable(int(st.Code())), st.Message()
+		}
+		return st.Code(), http.StatusServiceUnavailable, st.Message()
+	}
+
+	grpcCode, httpCode := toOtlpGRPCHTTPStatus(pushErr)
+	return grpcCode, httpCode, pushErr.Error()
 }
 
 // toOtlpGRPCHTTPStatus is utilized by the OTLP endpoint.
@@ -513,6 +586,23 @@ func otelMetricsToMetadata(addSuffixes bool, md pmetric.Metrics) []*mimirpb.Metr
 	return metadata
 }
 
+// appendHAResourceAttributes returns the resource attributes to promote, adding the resource attributes of the metrics
+// whose names are translated to one of the HA labels.
+func appendHAResourceAttributes(promoteResourceAttributes []string, haLabels []string, md pmetric.Metrics) []string {
+	namer := otlptranslator.LabelNamer{}
+	// The configured attributes are copied before appending to them.
+	out := slices.Clone(promoteResourceAttributes)
+	for i := 0; i < md.ResourceMetrics().Len(); i++ {
+		md.ResourceMetrics().At(i).Resource().Attributes().Range(func(name string, _ pcommon.Value) bool {
+			if slices.Contains(haLabels, namer.Build(name)) && !slices.Contains(out, name) {
+				out = append(out, name)
+			}
+			return true
+		})
+	}
+	return out
+}
+
 type conversionOptions struct {
 	addSuffixes                       bool
 	enableCTZeroIngestion             bool
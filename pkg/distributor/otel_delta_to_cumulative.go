@@ -0,0 +1,857 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"context"
+	"encoding/binary"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/concurrency"
+	"github.com/grafana/dskit/grpcclient"
+	"github.com/grafana/dskit/grpcutil"
+	"github.com/grafana/dskit/httpgrpc"
+	"github.com/grafana/dskit/ring"
+	ring_client "github.com/grafana/dskit/ring/client"
+	"github.com/grafana/dskit/services"
+	"github.com/grafana/dskit/user"
+	"github.com/open-telemetry/opentelemetry-collector-contrib/pkg/pdatautil"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"go.uber.org/atomic"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+const (
+	// otelDeltaOutOfOrder is the reason of the samples discarded by the delta-to-cumulative conversion,
+	// because older than the last sample of the same stream, or because their start timestamp is before
+	// the start timestamp of the stream.
+	otelDeltaOutOfOrder = "otlp_delta_out_of_order"
+
+	deltaToCumulativeStripes = 128
+)
+
+var (
+	deltaStreamBaseBytes = int64(unsafe.Sizeof(deltaStreamKey{}) + unsafe.Sizeof(deltaStream{}))
+	deltaHistogramBytes  = int64(unsafe.Sizeof(deltaHistogramState{}))
+)
+
+// DeltaToCumulativeConverter converts OTLP delta sums and delta exponential histograms into cumulative ones,
+// keeping the running total of each stream in memory. A stream is identified by the tenant, the resource,
+// the instrumentation scope, the metric and the data point attributes.
+//
+// Each stream is owned by a single distributor, chosen among the healthy distributors of the ring by rendezvous
+// hashing, so that its running total is kept by only one of them. The data points of the streams owned by another
+// distributor are forwarded to it over gRPC, before the request is pushed, and the request fails if they can't be.
+// When the ring changes, the running totals of the streams which moved to another distributor restart there, which
+// is observed as a counter reset on the query side. Streams not receiving any data point for longer than the idle
+// timeout are removed, and restart from their next data point as well.
+type DeltaToCumulativeConverter struct {
+	services.Service
+
+	idleTimeout    time.Duration
+	forwardTimeout time.Duration
+	ring           ring.ReadRing
+	instanceID     string
+	clients        *ring_client.Pool
+	stripes        [deltaToCumulativeStripes]deltaStreamsStripe
+
+	// streamsPerTenant is the number of streams per tenant, used to delete the metrics of tenants without streams.
+	streamsPerTenantMtx sync.Mutex
+	streamsPerTenant    map[string]int
+
+	memoryBytes atomic.Int64
+
+	activeStreams       *prometheus.GaugeVec
+	expiredStreams      *prometheus.CounterVec
+	discardedSamples    *prometheus.CounterVec
+	forwardedDataPoints *prometheus.CounterVec
+	failedForwards      *prometheus.CounterVec
+}
+
+type deltaStreamsStripe struct {
+	mtx     sync.Mutex
+	streams map[deltaStreamKey]*deltaStream
+}
+
+type deltaStreamKey struct {
+	tenantID string
+	hash     [16]byte
+}
+
+type deltaStream struct {
+	start    pcommon.Timestamp
+	last     pcommon.Timestamp
+	lastSeen int64 // Unix nanoseconds.
+	size     int64
+
+	isInt      bool
+	intValue   int64
+	floatValue float64
+
+	histogram *deltaHistogramState
+}
+
+type deltaHistogramState struct {
+	scale         int32
+	zeroThreshold float64
+	count         uint64
+	zeroCount     uint64
+
+	sum            float64
+	min, max       float64
+	hasSum         bool
+	hasMin, hasMax bool
+
+	positive, negative deltaHistogramBuckets
+}
+
+type deltaHistogramBuckets struct {
+	offset int32
+	counts []uint64
+}
+
+// NewDeltaToCumulativeConverter returns a new DeltaToCumulativeConverter removing the streams which haven't
+// received any data point for longer than idleTimeout. The streams are owned by the healthy instances of
+// distributorsRing, and the data points of the streams owned by another distributor are forwarded to it with
+// the given timeout. If distributorsRing is nil, this distributor owns all the streams.
+func NewDeltaToCumulativeConverter(idleTimeout, forwardTimeout time.Duration, clientCfg grpcclient.Config, distributorsRing ring.ReadRing, instanceID string, logger log.Logger, reg prometheus.Registerer) *DeltaToCumulativeConverter {
+	c := &DeltaToCumulativeConverter{
+		idleTimeout:      idleTimeout,
+		forwardTimeout:   forwardTimeout,
+		ring:             distributorsRing,
+		instanceID:       instanceID,
+		streamsPerTenant: map[string]int{},
+		activeStreams: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "cortex_distributor_otlp_delta_to_cumulative_streams",
+			Help: "The number of OTLP delta streams tracked by the delta-to-cumulative conversion.",
+		}, []string{"user"}),
+		expiredStreams: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_distributor_otlp_delta_to_cumulative_expired_streams_total",
+			Help: "The total number of OTLP delta streams removed by the delta-to-cumulative conversion because idle.",
+		}, []string{"user"}),
+		discardedSamples: validation.DiscardedSamplesCounter(reg, otelDeltaOutOfOrder),
+		forwardedDataPoints: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_distributor_otlp_delta_to_cumulative_forwarded_data_points_total",
+			Help: "The total number of OTLP delta data points forwarded to the distributor owning their stream.",
+		}, []string{"user"}),
+		failedForwards: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_distributor_otlp_delta_to_cumulative_forward_failures_total",
+			Help: "The total number of failed requests forwarding OTLP delta data points to the distributor owning their streams.",
+		}, []string{"user"}),
+	}
+
+	promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "cortex_distributor_otlp_delta_to_cumulative_memory_bytes",
+		Help: "The estimated memory used by the state of the OTLP delta streams tracked by the delta-to-cumulative conversion.",
+	}, func() float64 {
+		return float64(c.memoryBytes.Load())
+	})
+
+	for i := range c.stripes {
+		c.stripes[i].streams = map[deltaStreamKey]*deltaStream{}
+	}
+
+	if distributorsRing != nil {
+		clientsCount := promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "cortex_distributor_otlp_delta_to_cumulative_clients",
+			Help: "The current number of distributor clients used to forward the OTLP delta data points to the distributor owning their stream.",
+		})
+		c.clients = newDistributorClientsPool(clientCfg, distributorsRing, "distributor-otlp-delta-to-cumulative", clientsCount, logger, reg)
+	}
+
+	c.Service = services.NewTimerService(idleTimeout/2, c.starting, c.iteration, c.stopping).WithName("otlp delta-to-cumulative conversion")
+	return c
+}
+
+func (c *DeltaToCumulativeConverter) starting(ctx context.Context) error {
+	if c.clients == nil {
+		return nil
+	}
+	return services.StartAndAwaitRunning(ctx, c.clients)
+}
+
+func (c *DeltaToCumulativeConverter) iteration(_ context.Context) error {
+	c.expireStreams(time.Now())
+	return nil
+}
+
+func (c *DeltaToCumulativeConverter) stopping(_ error) error {
+	if c.clients == nil {
+		return nil
+	}
+	return services.StopAndAwaitTerminated(context.Background(), c.clients)
+}
+
+// NewBatch returns a new batch converting the delta data points of a request. It returns nil if c is nil.
+func (c *DeltaToCumulativeConverter) NewBatch() *DeltaToCumulativeBatch {
+	if c == nil {
+		return nil
+	}
+	return &DeltaToCumulativeBatch{converter: c, staged: map[deltaStreamKey]*deltaStream{}}
+}
+
+// DeltaToCumulativeBatch converts the delta data points of a request. The running totals of the streams are only
+// updated once the batch is committed, after the request has been successfully pushed, so that the data points of
+// a failed request aren't accumulated twice when the request is retried by the client.
+type DeltaToCumulativeBatch struct {
+	converter *DeltaToCumulativeConverter
+
+	// staged holds the running totals of the streams, including the data points of the batch.
+	staged map[deltaStreamKey]*deltaStream
+	points []deltaPoint
+}
+
+// deltaPoint is a delta data point of a stream, kept by the batch until it's committed.
+type deltaPoint struct {
+	key       deltaStreamKey
+	start, ts pcommon.Timestamp
+	noValue   bool
+
+	isInt      bool
+	intValue   int64
+	floatValue float64
+
+	histogram *deltaHistogramState
+}
+
+// Convert converts the delta sums and delta exponential histograms in md into cumulative ones, in place.
+// Data points which can't be accumulated, because out of order, are removed from md. The running totals
+// of the streams aren't updated until the batch is committed. The data points of the streams owned by
+// other distributors are removed from md and forwarded to them, unless ctx is the one of data points
+// already forwarded by another distributor. Convert fails if they can't be forwarded.
+func (b *DeltaToCumulativeBatch) Convert(ctx context.Context, tenantID string, md pmetric.Metrics) error {
+	return b.convert(ctx, tenantID, md, time.Now())
+}
+
+func (b *DeltaToCumulativeBatch) convert(ctx context.Context, tenantID string, md pmetric.Metrics, now time.Time) error {
+	c := b.converter
+	var (
+		discarded int
+		forwards  = deltaForwards{}
+		owner     = c.ownerFunc(ctx)
+	)
+
+	resourceMetrics := md.ResourceMetrics()
+	for i := 0; i < resourceMetrics.Len(); i++ {
+		rm := resourceMetrics.At(i)
+		scopeMetrics := rm.ScopeMetrics()
+
+		for j := 0; j < scopeMetrics.Len(); j++ {
+			sm := scopeMetrics.At(j)
+			metrics := sm.Metrics()
+
+			for k := 0; k < metrics.Len(); k++ {
+				m := metrics.At(k)
+
+				switch m.Type() {
+				case pmetric.MetricTypeSum:
+					sum := m.Sum()
+					if sum.AggregationTemporality() != pmetric.AggregationTemporalityDelta {
+						continue
+					}
+
+					metricHash := deltaMetricHash(rm.Resource(), sm.Scope(), m)
+					sum.DataPoints().RemoveIf(func(dp pmetric.NumberDataPoint) bool {
+						key := deltaStreamKey{tenantID: tenantID, hash: deltaStreamHash(metricHash, dp.Attributes())}
+						if addr, local := owner(key); !local {
+							dp.CopyTo(forwards.metric(addr, [3]int{i, j, k}, rm, sm, m).Sum().DataPoints().AppendEmpty())
+							forwards[addr].points++
+							return true
+						}
+
+						s, keep := b.accumulate(newDeltaSumPoint(key, dp), now)
+						if !keep {
+							discarded++
+							return true
+						}
+						if s != nil {
+							s.copySumTo(dp)
+						}
+						return false
+					})
+					sum.SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+
+				case pmetric.MetricTypeExponentialHistogram:
+					histogram := m.ExponentialHistogram()
+					if histogram.AggregationTemporality() != pmetric.AggregationTemporalityDelta {
+						continue
+					}
+
+					metricHash := deltaMetricHash(rm.Resource(), sm.Scope(), m)
+					histogram.DataPoints().RemoveIf(func(dp pmetric.ExponentialHistogramDataPoint) bool {
+						key := deltaStreamKey{tenantID: tenantID, hash: deltaStreamHash(metricHash, dp.Attributes())}
+						if addr, local := owner(key); !local {
+							dp.CopyTo(forwards.metric(addr, [3]int{i, j, k}, rm, sm, m).ExponentialHistogram().DataPoints().AppendEmpty())
+							forwards[addr].points++
+							return true
+						}
+
+						s, keep := b.accumulate(newDeltaHistogramPoint(key, dp), now)
+						if !keep {
+							discarded++
+							return true
+						}
+						if s != nil {
+							s.copyHistogramTo(dp)
+						}
+						return false
+					})
+					histogram.SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+				}
+			}
+		}
+	}
+
+	if discarded > 0 {
+		c.discardedSamples.WithLabelValues(tenantID, "").Add(float64(discarded))
+	}
+	return c.forward(ctx, tenantID, forwards)
+}
+
+// ownerFunc returns a function returning the address of the distributor owning a stream, and whether it's this
+// distributor. The data points forwarded by another distributor are always accumulated by this distributor, even
+// if the ring changed in between, so that they're never forwarded again.
+func (c *DeltaToCumulativeConverter) ownerFunc(ctx context.Context) func(deltaStreamKey) (string, bool) {
+	if c.ring == nil || isForwardedOTLPDeltas(ctx) {
+		return func(deltaStreamKey) (string, bool) { return "", true }
+	}
+
+	var (
+		instances []ring.InstanceDesc
+		loaded    bool
+	)
+	return func(key deltaStreamKey) (string, bool) {
+		if !loaded {
+			// The healthy distributors are only looked up if the request has delta data points.
+			instances, loaded = healthyDistributors(c.ring), true
+		}
+		return rendezvousOwner(instances, c.instanceID, key.tenantID, unsafe.String(&key.hash[0], len(key.hash)))
+	}
+}
+
+// forward sends the data points of the streams owned by other distributors to them, concurrently. The owners
+// convert and push them like any other OTLP request.
+func (c *DeltaToCumulativeConverter) forward(ctx context.Context, tenantID string, forwards deltaForwards) error {
+	if len(forwards) == 0 {
+		return nil
+	}
+
+	addrs := slices.Collect(maps.Keys(forwards))
+	return concurrency.ForEachJob(ctx, len(addrs), len(addrs), func(ctx context.Context, idx int) error {
+		addr := addrs[idx]
+		if err := c.forwardTo(ctx, tenantID, addr, forwards[addr].md); err != nil {
+			c.failedForwards.WithLabelValues(tenantID).Inc()
+			return otlpDeltaForwardError(addr, err)
+		}
+		c.forwardedDataPoints.WithLabelValues(tenantID).Add(float64(forwards[addr].points))
+		return nil
+	})
+}
+
+func (c *DeltaToCumulativeConverter) forwardTo(ctx context.Context, tenantID, addr string, md pmetric.Metrics) error {
+	data, err := pmetricotlp.NewExportRequestFromMetrics(md).MarshalProto()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(user.InjectOrgID(ctx, tenantID), c.forwardTimeout)
+	defer cancel()
+
+	client, err := c.clients.GetClientFor(addr)
+	if err != nil {
+		return err
+	}
+	return client.(*distributorClient).conn.Invoke(ctx, otlpDeltaForwardMethod, &wrapperspb.BytesValue{Value: data}, &emptypb.Empty{})
+}
+
+// otlpDeltaForwardError returns the error of a request whose delta data points couldn't be forwarded to the
+// distributor owning their streams. The errors caused by the data points themselves aren't retryable, while
+// the other ones are.
+func otlpDeltaForwardError(addr string, err error) error {
+	code, msg := http.StatusServiceUnavailable, err.Error()
+	if s, ok := grpcutil.ErrorToStatus(err); ok {
+		msg = s.Message()
+		switch s.Code() {
+		case codes.InvalidArgument:
+			code = http.StatusBadRequest
+		case codes.Unauthenticated:
+			code = http.StatusUnauthorized
+		case codes.PermissionDenied:
+			code = http.StatusForbidden
+		}
+	}
+	return httpgrpc.Errorf(code, "failed to forward OTLP delta data points to the distributor %s owning their streams: %s", addr, msg)
+}
+
+// deltaForwards holds the data points to forward to each distributor, keyed by address.
+type deltaForwards map[string]*deltaForward
+
+// deltaForward holds the data points to forward to a distributor, with the resources, scopes and metrics they
+// belong to, which are keyed by their index in the request.
+type deltaForward struct {
+	md        pmetric.Metrics
+	resources map[int]pmetric.ResourceMetrics
+	scopes    map[[2]int]pmetric.ScopeMetrics
+	metrics   map[[3]int]pmetric.Metric
+	points    int
+}
+
+// metric returns the metric m, with the resource rm and the scope sm, of the data points to forward to addr,
+// without data points. idx holds the index of the resource, the scope and the metric in the request.
+func (f deltaForwards) metric(addr string, idx [3]int, rm pmetric.ResourceMetrics, sm pmetric.ScopeMetrics, m pmetric.Metric) pmetric.Metric {
+	fwd, ok := f[addr]
+	if !ok {
+		fwd = &deltaForward{
+			md:        pmetric.NewMetrics(),
+			resources: map[int]pmetric.ResourceMetrics{},
+			scopes:    map[[2]int]pmetric.ScopeMetrics{},
+			metrics:   map[[3]int]pmetric.Metric{},
+		}
+		f[addr] = fwd
+	}
+	if dst, ok := fwd.metrics[idx]; ok {
+		return dst
+	}
+
+	scope, ok := fwd.scopes[[2]int{idx[0], idx[1]}]
+	if !ok {
+		resource, ok := fwd.resources[idx[0]]
+		if !ok {
+			resource = fwd.md.ResourceMetrics().AppendEmpty()
+			rm.Resource().CopyTo(resource.Resource())
+			resource.SetSchemaUrl(rm.SchemaUrl())
+			fwd.resources[idx[0]] = resource
+		}
+		scope = resource.ScopeMetrics().AppendEmpty()
+		sm.Scope().CopyTo(scope.Scope())
+		scope.SetSchemaUrl(sm.SchemaUrl())
+		fwd.scopes[[2]int{idx[0], idx[1]}] = scope
+	}
+
+	dst := scope.Metrics().AppendEmpty()
+	dst.SetName(m.Name())
+	dst.SetDescription(m.Description())
+	dst.SetUnit(m.Unit())
+	m.Metadata().CopyTo(dst.Metadata())
+	switch m.Type() {
+	case pmetric.MetricTypeSum:
+		sum := dst.SetEmptySum()
+		sum.SetAggregationTemporality(pmetric.AggregationTemporalityDelta)
+		sum.SetIsMonotonic(m.Sum().IsMonotonic())
+	case pmetric.MetricTypeExponentialHistogram:
+		dst.SetEmptyExponentialHistogram().SetAggregationTemporality(pmetric.AggregationTemporalityDelta)
+	}
+	fwd.metrics[idx] = dst
+	return dst
+}
+
+// accumulate adds the data point p to the staged running total of its stream. It returns the staged stream,
+// which is nil if the stream has no running total yet, and whether the data point should be kept.
+func (b *DeltaToCumulativeBatch) accumulate(p deltaPoint, now time.Time) (*deltaStream, bool) {
+	s, ok := b.staged[p.key]
+	if !ok {
+		s = b.converter.stream(p.key)
+	}
+
+	s, keep := accumulateDelta(s, p, now)
+	b.staged[p.key] = s
+	if keep {
+		b.points = append(b.points, p)
+	}
+	return s, keep
+}
+
+// Commit updates the running totals of the streams with the data points of the batch. It must be called
+// once the request has been successfully pushed. A nil batch is a no-op.
+func (b *DeltaToCumulativeBatch) Commit() {
+	if b == nil {
+		return
+	}
+	b.converter.commit(b.points, time.Now())
+}
+
+// commit adds the data points to the running totals of their streams. Data points which are not newer than the
+// last one of their stream anymore, because a concurrent request of the same stream has been committed in the
+// meanwhile, are ignored.
+func (c *DeltaToCumulativeConverter) commit(points []deltaPoint, now time.Time) {
+	for _, p := range points {
+		stripe := c.stripe(p.key)
+		stripe.mtx.Lock()
+
+		prev := stripe.streams[p.key]
+		var prevSize int64
+		if prev != nil {
+			prevSize = prev.size
+		}
+
+		s, _ := accumulateDelta(prev, p, now)
+		switch {
+		case s == prev && s != nil:
+			c.memoryBytes.Add(s.size - prevSize)
+		case s != prev:
+			// The stream starts over.
+			if prev != nil {
+				c.removeStream(stripe, p.key, prev)
+			}
+			if s != nil {
+				c.addStream(stripe, p.key, s)
+			}
+		}
+
+		stripe.mtx.Unlock()
+	}
+}
+
+// stream returns a copy of the running total of the stream, or nil if the stream doesn't exist.
+func (c *DeltaToCumulativeConverter) stream(key deltaStreamKey) *deltaStream {
+	stripe := c.stripe(key)
+	stripe.mtx.Lock()
+	defer stripe.mtx.Unlock()
+
+	if s, ok := stripe.streams[key]; ok {
+		return s.clone()
+	}
+	return nil
+}
+
+func newDeltaSumPoint(key deltaStreamKey, dp pmetric.NumberDataPoint) deltaPoint {
+	p := deltaPoint{key: key, start: dp.StartTimestamp(), ts: dp.Timestamp(), noValue: dp.Flags().NoRecordedValue()}
+	if dp.ValueType() == pmetric.NumberDataPointValueTypeInt {
+		p.isInt = true
+		p.intValue = dp.IntValue()
+	} else {
+		p.floatValue = dp.DoubleValue()
+	}
+	return p
+}
+
+func newDeltaHistogramPoint(key deltaStreamKey, dp pmetric.ExponentialHistogramDataPoint) deltaPoint {
+	return deltaPoint{key: key, start: dp.StartTimestamp(), ts: dp.Timestamp(), noValue: dp.Flags().NoRecordedValue(), histogram: newDeltaHistogramState(dp)}
+}
+
+// accumulateDelta adds the delta data point p to the running total of the stream s, which is nil if the stream
+// doesn't exist, and updates s in place. It returns the stream, which is a new one if the stream starts over, and
+// whether the data point should be kept.
+func accumulateDelta(s *deltaStream, p deltaPoint, now time.Time) (*deltaStream, bool) {
+	if s != nil && ((s.histogram == nil) != (p.histogram == nil) || (p.histogram != nil && s.histogram.zeroThreshold != p.histogram.zeroThreshold)) {
+		// The metric type or the zero threshold changed, so the running total can't be
+		// accumulated anymore and we start over.
+		s = nil
+	}
+	if s != nil && p.start > s.last {
+		// There's a gap between the last data point and this one, which may have been lost or sent to another
+		// distributor, or the producer restarted: the running total is reset.
+		s = nil
+	}
+
+	if s == nil {
+		if p.noValue {
+			// There's no value to start the stream from.
+			return nil, true
+		}
+		s = &deltaStream{start: p.start, last: p.ts, lastSeen: now.UnixNano(), isInt: p.isInt, intValue: p.intValue, floatValue: p.floatValue}
+		if p.histogram != nil {
+			s.histogram = p.histogram.clone()
+		}
+		s.size = s.estimatedSize()
+		return s, true
+	}
+
+	if p.ts <= s.last || p.start < s.start {
+		return s, false
+	}
+
+	s.last = p.ts
+	s.lastSeen = now.UnixNano()
+
+	if p.noValue {
+		// The staleness marker is forwarded as is, without resetting the running total.
+		return s, true
+	}
+
+	if s.histogram != nil {
+		s.histogram.add(p.histogram.clone())
+		s.size = s.estimatedSize()
+		return s, true
+	}
+
+	switch {
+	case s.isInt && p.isInt:
+		s.intValue += p.intValue
+	case s.isInt:
+		// The value type changed from int to float, so we keep accumulating as float.
+		s.isInt = false
+		s.floatValue = float64(s.intValue) + p.floatValue
+	case p.isInt:
+		s.floatValue += float64(p.intValue)
+	default:
+		s.floatValue += p.floatValue
+	}
+	return s, true
+}
+
+// copySumTo sets the running total of the stream in the sum data point dp.
+func (s *deltaStream) copySumTo(dp pmetric.NumberDataPoint) {
+	dp.SetStartTimestamp(s.start)
+	if dp.Flags().NoRecordedValue() {
+		return
+	}
+	if s.isInt {
+		dp.SetIntValue(s.intValue)
+	} else {
+		dp.SetDoubleValue(s.floatValue)
+	}
+}
+
+// copyHistogramTo sets the running total of the stream in the histogram data point dp.
+func (s *deltaStream) copyHistogramTo(dp pmetric.ExponentialHistogramDataPoint) {
+	dp.SetStartTimestamp(s.start)
+	if dp.Flags().NoRecordedValue() {
+		return
+	}
+	s.histogram.copyTo(dp)
+}
+
+func (s *deltaStream) clone() *deltaStream {
+	c := *s
+	if s.histogram != nil {
+		c.histogram = s.histogram.clone()
+	}
+	return &c
+}
+
+// estimatedSize returns the estimated memory used by the stream.
+func (s *deltaStream) estimatedSize() int64 {
+	if s.histogram != nil {
+		return s.histogram.size()
+	}
+	return deltaStreamBaseBytes
+}
+
+// expireStreams removes the streams which haven't received any data point since idleTimeout before now.
+func (c *DeltaToCumulativeConverter) expireStreams(now time.Time) {
+	deadline := now.Add(-c.idleTimeout).UnixNano()
+	expired := map[string]int{}
+
+	for i := range c.stripes {
+		stripe := &c.stripes[i]
+
+		stripe.mtx.Lock()
+		for key, s := range stripe.streams {
+			if s.lastSeen < deadline {
+				delete(stripe.streams, key)
+				c.memoryBytes.Sub(s.size)
+				expired[key.tenantID]++
+			}
+		}
+		stripe.mtx.Unlock()
+	}
+
+	for tenantID, count := range expired {
+		c.expiredStreams.WithLabelValues(tenantID).Add(float64(count))
+		c.decStreams(tenantID, count)
+	}
+}
+
+// addStream adds the stream s to the stripe. The stripe lock must be held.
+func (c *DeltaToCumulativeConverter) addStream(stripe *deltaStreamsStripe, key deltaStreamKey, s *deltaStream) {
+	stripe.streams[key] = s
+	c.memoryBytes.Add(s.size)
+
+	c.streamsPerTenantMtx.Lock()
+	c.streamsPerTenant[key.tenantID]++
+	c.activeStreams.WithLabelValues(key.tenantID).Inc()
+	c.streamsPerTenantMtx.Unlock()
+}
+
+// removeStream removes the stream s from the stripe. The stripe lock must be held.
+func (c *DeltaToCumulativeConverter) removeStream(stripe *deltaStreamsStripe, key deltaStreamKey, s *deltaStream) {
+	delete(stripe.streams, key)
+	c.memoryBytes.Sub(s.size)
+	c.decStreams(key.tenantID, 1)
+}
+
+func (c *DeltaToCumulativeConverter) decStreams(tenantID string, count int) {
+	c.streamsPerTenantMtx.Lock()
+	defer c.streamsPerTenantMtx.Unlock()
+
+	c.streamsPerTenant[tenantID] -= count
+	if c.streamsPerTenant[tenantID] > 0 {
+		c.activeStreams.WithLabelValues(tenantID).Sub(float64(count))
+		return
+	}
+
+	delete(c.streamsPerTenant, tenantID)
+	c.activeStreams.DeleteLabelValues(tenantID)
+}
+
+// cleanupTenantMetrics deletes the metrics of the tenant, once it's inactive. Its streams have expired by then.
+func (c *DeltaToCumulativeConverter) cleanupTenantMetrics(tenantID string) {
+	c.expiredStreams.DeleteLabelValues(tenantID)
+	c.discardedSamples.DeletePartialMatch(prometheus.Labels{"user": tenantID})
+	c.forwardedDataPoints.DeleteLabelValues(tenantID)
+	c.failedForwards.DeleteLabelValues(tenantID)
+}
+
+func (c *DeltaToCumulativeConverter) stripe(key deltaStreamKey) *deltaStreamsStripe {
+	return &c.stripes[binary.LittleEndian.Uint64(key.hash[:8])%deltaToCumulativeStripes]
+}
+
+// deltaMetricHash returns the hash identifying the metric m, within the given resource and scope.
+func deltaMetricHash(resource pcommon.Resource, scope pcommon.InstrumentationScope, m pmetric.Metric) [16]byte {
+	return pdatautil.Hash(
+		pdatautil.WithMap(resource.Attributes()),
+		pdatautil.WithString(scope.Name()),
+		pdatautil.WithString(scope.Version()),
+		pdatautil.WithMap(scope.Attributes()),
+		pdatautil.WithString(m.Name()),
+		pdatautil.WithString(m.Unit()),
+		pdatautil.WithString(m.Type().String()),
+	)
+}
+
+// deltaStreamHash returns the hash identifying the stream of the data point with the given attributes, within the metric.
+func deltaStreamHash(metricHash [16]byte, attributes pcommon.Map) [16]byte {
+	return pdatautil.Hash(
+		pdatautil.WithString(unsafe.String(&metricHash[0], len(metricHash))),
+		pdatautil.WithMap(attributes),
+	)
+}
+
+func newDeltaHistogramState(dp pmetric.ExponentialHistogramDataPoint) *deltaHistogramState {
+	return &deltaHistogramState{
+		scale:         dp.Scale(),
+		zeroThreshold: dp.ZeroThreshold(),
+		count:         dp.Count(),
+		zeroCount:     dp.ZeroCount(),
+		sum:           dp.Sum(),
+		min:           dp.Min(),
+		max:           dp.Max(),
+		hasSum:        dp.HasSum(),
+		hasMin:        dp.HasMin(),
+		hasMax:        dp.HasMax(),
+		positive:      deltaHistogramBuckets{offset: dp.Positive().Offset(), counts: dp.Positive().BucketCounts().AsRaw()},
+		negative:      deltaHistogramBuckets{offset: dp.Negative().Offset(), counts: dp.Negative().BucketCounts().AsRaw()},
+	}
+}
+
+func (h *deltaHistogramState) clone() *deltaHistogramState {
+	c := *h
+	c.positive.counts = slices.Clone(h.positive.counts)
+	c.negative.counts = slices.Clone(h.negative.counts)
+	return &c
+}
+
+// add adds other to h. The two histograms are expected to have the same zero threshold. If they have a
+// different scale, the one with the higher scale is downscaled.
+func (h *deltaHistogramState) add(other *deltaHistogramState) {
+	scale := min(h.scale, other.scale)
+	h.positive.downscale(h.scale - scale)
+	h.negative.downscale(h.scale - scale)
+	other.positive.downscale(other.scale - scale)
+	other.negative.downscale(other.scale - scale)
+	h.scale = scale
+
+	h.positive.add(other.positive)
+	h.negative.add(other.negative)
+
+	h.count += other.count
+	h.zeroCount += other.zeroCount
+
+	h.hasSum = h.hasSum && other.hasSum
+	h.sum += other.sum
+
+	h.hasMin = h.hasMin && other.hasMin
+	h.min = min(h.min, other.min)
+
+	h.hasMax = h.hasMax && other.hasMax
+	h.max = max(h.max, other.max)
+}
+
+// copyTo sets the values of h in the data point dp, keeping its timestamps, attributes and exemplars.
+func (h *deltaHistogramState) copyTo(dp pmetric.ExponentialHistogramDataPoint) {
+	dp.SetScale(h.scale)
+	dp.SetCount(h.count)
+	dp.SetZeroCount(h.zeroCount)
+
+	if h.hasSum {
+		dp.SetSum(h.sum)
+	} else {
+		dp.RemoveSum()
+	}
+	if h.hasMin {
+		dp.SetMin(h.min)
+	} else {
+		dp.RemoveMin()
+	}
+	if h.hasMax {
+		dp.SetMax(h.max)
+	} else {
+		dp.RemoveMax()
+	}
+
+	dp.Positive().SetOffset(h.positive.offset)
+	dp.Positive().BucketCounts().FromRaw(append([]uint64(nil), h.positive.counts...))
+	dp.Negative().SetOffset(h.negative.offset)
+	dp.Negative().BucketCounts().FromRaw(append([]uint64(nil), h.negative.counts...))
+}
+
+// size returns the estimated memory used by the stream of the histogram.
+func (h *deltaHistogramState) size() int64 {
+	return deltaStreamBaseBytes + deltaHistogramBytes + 8*int64(cap(h.positive.counts)+cap(h.negative.counts))
+}
+
+// downscale reduces the scale of the buckets by the given number of steps, merging 2^by adjacent buckets.
+func (b *deltaHistogramBuckets) downscale(by int32) {
+	if by <= 0 || len(b.counts) == 0 {
+		return
+	}
+
+	offset := b.offset >> by
+	counts := make([]uint64, ((b.offset+int32(len(b.counts))-1)>>by)-offset+1)
+	for i, count := range b.counts {
+		counts[((b.offset+int32(i))>>by)-offset] += count
+	}
+
+	b.offset = offset
+	b.counts = counts
+}
+
+// add adds the counts of other to b. The buckets are expected to have the same scale.
+func (b *deltaHistogramBuckets) add(other deltaHistogramBuckets) {
+	if len(other.counts) == 0 {
+		return
+	}
+	if len(b.counts) == 0 {
+		b.offset = other.offset
+		b.counts = append(b.counts[:0], other.counts...)
+		return
+	}
+
+	lo := min(b.offset, other.offset)
+	hi := max(b.offset+int32(len(b.counts)), other.offset+int32(len(other.counts)))
+	if lo != b.offset || hi != b.offset+int32(len(b.counts)) {
+		counts := make([]uint64, hi-lo)
+		copy(counts[b.offset-lo:], b.counts)
+		b.offset = lo
+		b.counts = counts
+	}
+
+	for i, count := range other.counts {
+		b.counts[other.offset-b.offset+int32(i)] += count
+	}
+}
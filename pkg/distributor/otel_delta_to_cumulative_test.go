@@ -0,0 +1,606 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/grafana/dskit/grpcclient"
+	"github.com/grafana/dskit/httpgrpc"
+	"github.com/grafana/dskit/middleware"
+	"github.com/grafana/dskit/ring"
+	"github.com/grafana/dskit/services"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"google.golang.org/grpc"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+func TestDeltaToCumulativeConverter_Sum(t *testing.T) {
+	type point struct {
+		start, ts int64
+		value     int64
+		attr      string
+	}
+	type expectedPoint struct {
+		start, ts int64
+		value     int64
+	}
+
+	tests := map[string]struct {
+		requests          [][]point
+		expected          [][]expectedPoint
+		expectedDiscarded int
+		expectedStreams   int
+	}{
+		"should accumulate the data points of a stream": {
+			requests: [][]point{
+				{{start: 0, ts: 1, value: 1}},
+				{{start: 1, ts: 2, value: 2}, {start: 2, ts: 3, value: 3}},
+			},
+			expected: [][]expectedPoint{
+				{{start: 0, ts: 1, value: 1}},
+				{{start: 0, ts: 2, value: 3}, {start: 0, ts: 3, value: 6}},
+			},
+			expectedStreams: 1,
+		},
+		"should accumulate the data points of different streams separately": {
+			requests: [][]point{
+				{{start: 0, ts: 1, value: 1, attr: "a"}, {start: 0, ts: 1, value: 10, attr: "b"}},
+				{{start: 1, ts: 2, value: 2, attr: "a"}, {start: 1, ts: 2, value: 20, attr: "b"}},
+			},
+			expected: [][]expectedPoint{
+				{{start: 0, ts: 1, value: 1}, {start: 0, ts: 1, value: 10}},
+				{{start: 0, ts: 2, value: 3}, {start: 0, ts: 2, value: 30}},
+			},
+			expectedStreams: 2,
+		},
+		"should discard data points not newer than the last one of the stream": {
+			requests: [][]point{
+				{{start: 0, ts: 1, value: 1}, {start: 1, ts: 2, value: 2}},
+				{{start: 1, ts: 2, value: 2}, {start: 0, ts: 1, value: 1}, {start: 2, ts: 3, value: 3}},
+			},
+			expected: [][]expectedPoint{
+				{{start: 0, ts: 1, value: 1}, {start: 0, ts: 2, value: 3}},
+				{{start: 0, ts: 3, value: 6}},
+			},
+			expectedDiscarded: 2,
+			expectedStreams:   1,
+		},
+		"should discard data points starting before the start of the stream": {
+			requests: [][]point{
+				{{start: 5, ts: 6, value: 1}},
+				{{start: 4, ts: 7, value: 2}},
+			},
+			expected: [][]expectedPoint{
+				{{start: 5, ts: 6, value: 1}},
+				{},
+			},
+			expectedDiscarded: 1,
+			expectedStreams:   1,
+		},
+		"should reset the running total on gaps between data points": {
+			requests: [][]point{
+				{{start: 0, ts: 1, value: 1}},
+				{{start: 10, ts: 11, value: 2}, {start: 11, ts: 12, value: 3}},
+			},
+			expected: [][]expectedPoint{
+				{{start: 0, ts: 1, value: 1}},
+				{{start: 10, ts: 11, value: 2}, {start: 10, ts: 12, value: 5}},
+			},
+			expectedStreams: 1,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			reg := prometheus.NewPedanticRegistry()
+			c := newTestDeltaToCumulativeConverter(reg)
+
+			for i, req := range testData.requests {
+				md := pmetric.NewMetrics()
+				m := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+				m.SetName("test_sum")
+				sum := m.SetEmptySum()
+				sum.SetAggregationTemporality(pmetric.AggregationTemporalityDelta)
+				sum.SetIsMonotonic(true)
+				for _, p := range req {
+					dp := sum.DataPoints().AppendEmpty()
+					dp.SetStartTimestamp(pcommon.Timestamp(p.start))
+					dp.SetTimestamp(pcommon.Timestamp(p.ts))
+					dp.SetIntValue(p.value)
+					if p.attr != "" {
+						dp.Attributes().PutStr("attr", p.attr)
+					}
+				}
+
+				convertAndCommit(t, c, "user", md)
+
+				assert.Equal(t, pmetric.AggregationTemporalityCumulative, sum.AggregationTemporality())
+
+				actual := make([]expectedPoint, 0, sum.DataPoints().Len())
+				for j := 0; j < sum.DataPoints().Len(); j++ {
+					dp := sum.DataPoints().At(j)
+					actual = append(actual, expectedPoint{start: int64(dp.StartTimestamp()), ts: int64(dp.Timestamp()), value: dp.IntValue()})
+				}
+				assert.Equal(t, testData.expected[i], actual, "request %d", i)
+			}
+
+			assert.Equal(t, float64(testData.expectedDiscarded), testutil.ToFloat64(c.discardedSamples.WithLabelValues("user", "")))
+			assert.Equal(t, float64(testData.expectedStreams), testutil.ToFloat64(c.activeStreams.WithLabelValues("user")))
+			assert.Equal(t, testData.expectedStreams*int(deltaStreamBaseBytes), int(c.memoryBytes.Load()))
+		})
+	}
+}
+
+func TestDeltaToCumulativeConverter_SumValueTypeChange(t *testing.T) {
+	c := newTestDeltaToCumulativeConverter(nil)
+
+	md := pmetric.NewMetrics()
+	sum := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty().SetEmptySum()
+	sum.SetAggregationTemporality(pmetric.AggregationTemporalityDelta)
+	dp := sum.DataPoints().AppendEmpty()
+	dp.SetTimestamp(1)
+	dp.SetIntValue(1)
+	dp = sum.DataPoints().AppendEmpty()
+	dp.SetTimestamp(2)
+	dp.SetDoubleValue(1.5)
+	dp = sum.DataPoints().AppendEmpty()
+	dp.SetTimestamp(3)
+	dp.SetIntValue(2)
+
+	convertAndCommit(t, c, "user", md)
+
+	require.Equal(t, 3, sum.DataPoints().Len())
+	assert.Equal(t, int64(1), sum.DataPoints().At(0).IntValue())
+	assert.Equal(t, 2.5, sum.DataPoints().At(1).DoubleValue())
+	assert.Equal(t, 4.5, sum.DataPoints().At(2).DoubleValue())
+}
+
+func TestDeltaToCumulativeConverter_ShouldNotConvertCumulativeMetrics(t *testing.T) {
+	c := newTestDeltaToCumulativeConverter(nil)
+
+	md := pmetric.NewMetrics()
+	sum := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty().SetEmptySum()
+	sum.SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+	for ts := 1; ts <= 2; ts++ {
+		dp := sum.DataPoints().AppendEmpty()
+		dp.SetTimestamp(pcommon.Timestamp(ts))
+		dp.SetIntValue(5)
+	}
+
+	convertAndCommit(t, c, "user", md)
+
+	require.Equal(t, 2, sum.DataPoints().Len())
+	assert.Equal(t, int64(5), sum.DataPoints().At(0).IntValue())
+	assert.Equal(t, int64(5), sum.DataPoints().At(1).IntValue())
+	assert.Equal(t, 0, testutil.CollectAndCount(c.activeStreams))
+}
+
+func TestDeltaToCumulativeConverter_ExponentialHistogram(t *testing.T) {
+	c := newTestDeltaToCumulativeConverter(nil)
+
+	md := pmetric.NewMetrics()
+	histogram := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty().SetEmptyExponentialHistogram()
+	histogram.SetAggregationTemporality(pmetric.AggregationTemporalityDelta)
+
+	dp := histogram.DataPoints().AppendEmpty()
+	dp.SetStartTimestamp(0)
+	dp.SetTimestamp(1)
+	dp.SetScale(1)
+	dp.SetCount(6)
+	dp.SetZeroCount(1)
+	dp.SetSum(10)
+	dp.SetMin(0)
+	dp.SetMax(5)
+	dp.Positive().SetOffset(-1)
+	dp.Positive().BucketCounts().FromRaw([]uint64{1, 1, 1, 1})
+	dp.Negative().SetOffset(0)
+	dp.Negative().BucketCounts().FromRaw([]uint64{1})
+
+	dp = histogram.DataPoints().AppendEmpty()
+	dp.SetStartTimestamp(1)
+	dp.SetTimestamp(2)
+	dp.SetScale(0)
+	dp.SetCount(3)
+	dp.SetZeroCount(0)
+	dp.SetSum(20)
+	dp.SetMin(-1)
+	dp.SetMax(10)
+	dp.Positive().SetOffset(2)
+	dp.Positive().BucketCounts().FromRaw([]uint64{2})
+	dp.Exemplars().AppendEmpty().SetDoubleValue(3)
+
+	convertAndCommit(t, c, "user", md)
+
+	assert.Equal(t, pmetric.AggregationTemporalityCumulative, histogram.AggregationTemporality())
+	require.Equal(t, 2, histogram.DataPoints().Len())
+
+	// The first data point is kept as is.
+	dp = histogram.DataPoints().At(0)
+	assert.Equal(t, int32(1), dp.Scale())
+	assert.Equal(t, uint64(6), dp.Count())
+	assert.Equal(t, []uint64{1, 1, 1, 1}, dp.Positive().BucketCounts().AsRaw())
+
+	// The second data point is accumulated, after downscaling the first one to scale 0:
+	// indexes [-1, 0, 1, 2] at scale 1 are merged into indexes [-1, 0, 0, 1] at scale 0.
+	dp = histogram.DataPoints().At(1)
+	assert.Equal(t, pcommon.Timestamp(0), dp.StartTimestamp())
+	assert.Equal(t, pcommon.Timestamp(2), dp.Timestamp())
+	assert.Equal(t, int32(0), dp.Scale())
+	assert.Equal(t, uint64(9), dp.Count())
+	assert.Equal(t, uint64(1), dp.ZeroCount())
+	assert.Equal(t, 30.0, dp.Sum())
+	assert.Equal(t, -1.0, dp.Min())
+	assert.Equal(t, 10.0, dp.Max())
+	assert.Equal(t, int32(-1), dp.Positive().Offset())
+	assert.Equal(t, []uint64{1, 2, 1, 2}, dp.Positive().BucketCounts().AsRaw())
+	assert.Equal(t, int32(0), dp.Negative().Offset())
+	assert.Equal(t, []uint64{1}, dp.Negative().BucketCounts().AsRaw())
+	assert.Equal(t, 1, dp.Exemplars().Len())
+
+	// A data point without sum makes the cumulative histogram lose the sum too.
+	md = pmetric.NewMetrics()
+	histogram = md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty().SetEmptyExponentialHistogram()
+	histogram.SetAggregationTemporality(pmetric.AggregationTemporalityDelta)
+	dp = histogram.DataPoints().AppendEmpty()
+	dp.SetStartTimestamp(2)
+	dp.SetTimestamp(3)
+	dp.SetCount(1)
+	dp.Positive().SetOffset(-3)
+	dp.Positive().BucketCounts().FromRaw([]uint64{1})
+
+	convertAndCommit(t, c, "user", md)
+
+	require.Equal(t, 1, histogram.DataPoints().Len())
+	dp = histogram.DataPoints().At(0)
+	assert.Equal(t, uint64(10), dp.Count())
+	assert.False(t, dp.HasSum())
+	assert.False(t, dp.HasMin())
+	assert.False(t, dp.HasMax())
+	assert.Equal(t, int32(-3), dp.Positive().Offset())
+	assert.Equal(t, []uint64{1, 0, 1, 2, 1, 2}, dp.Positive().BucketCounts().AsRaw())
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(c.activeStreams.WithLabelValues("user")))
+	assert.Equal(t, deltaStreamBaseBytes+deltaHistogramBytes+8*int64(cap(c.stripeStreams()[0].histogram.positive.counts)+cap(c.stripeStreams()[0].histogram.negative.counts)), c.memoryBytes.Load())
+}
+
+func TestDeltaToCumulativeConverter_ExponentialHistogramZeroThresholdChange(t *testing.T) {
+	c := newTestDeltaToCumulativeConverter(nil)
+
+	md := pmetric.NewMetrics()
+	histogram := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty().SetEmptyExponentialHistogram()
+	histogram.SetAggregationTemporality(pmetric.AggregationTemporalityDelta)
+	for ts, zeroThreshold := range []float64{0, 0, 0.5} {
+		dp := histogram.DataPoints().AppendEmpty()
+		dp.SetStartTimestamp(pcommon.Timestamp(ts))
+		dp.SetTimestamp(pcommon.Timestamp(ts + 1))
+		dp.SetZeroThreshold(zeroThreshold)
+		dp.SetCount(1)
+		dp.SetZeroCount(1)
+	}
+
+	convertAndCommit(t, c, "user", md)
+
+	// The stream restarts when the zero threshold changes.
+	require.Equal(t, 3, histogram.DataPoints().Len())
+	assert.Equal(t, uint64(1), histogram.DataPoints().At(0).Count())
+	assert.Equal(t, uint64(2), histogram.DataPoints().At(1).Count())
+	assert.Equal(t, uint64(1), histogram.DataPoints().At(2).Count())
+	assert.Equal(t, pcommon.Timestamp(2), histogram.DataPoints().At(2).StartTimestamp())
+	assert.Equal(t, float64(1), testutil.ToFloat64(c.activeStreams.WithLabelValues("user")))
+}
+
+func TestDeltaToCumulativeConverter_ExpireStreams(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	c := newTestDeltaToCumulativeConverter(reg)
+	now := time.Now()
+
+	deltaSum := func(tenantID string, name string, start, ts int64, value float64) pmetric.Sum {
+		md := pmetric.NewMetrics()
+		m := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		m.SetName(name)
+		sum := m.SetEmptySum()
+		sum.SetAggregationTemporality(pmetric.AggregationTemporalityDelta)
+		dp := sum.DataPoints().AppendEmpty()
+		dp.SetStartTimestamp(pcommon.Timestamp(start))
+		dp.SetTimestamp(pcommon.Timestamp(ts))
+		dp.SetDoubleValue(value)
+
+		b := c.NewBatch()
+		require.NoError(t, b.convert(context.Background(), tenantID, md, now))
+		c.commit(b.points, now)
+		return sum
+	}
+
+	deltaSum("user-1", "series_1", 0, 1, 1)
+	deltaSum("user-1", "series_2", 0, 1, 1)
+	deltaSum("user-2", "series_1", 0, 1, 1)
+
+	now = now.Add(30 * time.Second)
+	deltaSum("user-1", "series_1", 1, 2, 1)
+
+	// The streams which haven't received any data point in the last minute are expired.
+	c.expireStreams(now.Add(45 * time.Second))
+
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_distributor_otlp_delta_to_cumulative_expired_streams_total The total number of OTLP delta streams removed by the delta-to-cumulative conversion because idle.
+		# TYPE cortex_distributor_otlp_delta_to_cumulative_expired_streams_total counter
+		cortex_distributor_otlp_delta_to_cumulative_expired_streams_total{user="user-1"} 1
+		cortex_distributor_otlp_delta_to_cumulative_expired_streams_total{user="user-2"} 1
+
+		# HELP cortex_distributor_otlp_delta_to_cumulative_memory_bytes The estimated memory used by the state of the OTLP delta streams tracked by the delta-to-cumulative conversion.
+		# TYPE cortex_distributor_otlp_delta_to_cumulative_memory_bytes gauge
+		cortex_distributor_otlp_delta_to_cumulative_memory_bytes `+strconv.FormatInt(deltaStreamBaseBytes, 10)+`
+
+		# HELP cortex_distributor_otlp_delta_to_cumulative_streams The number of OTLP delta streams tracked by the delta-to-cumulative conversion.
+		# TYPE cortex_distributor_otlp_delta_to_cumulative_streams gauge
+		cortex_distributor_otlp_delta_to_cumulative_streams{user="user-1"} 1
+	`), "cortex_distributor_otlp_delta_to_cumulative_expired_streams_total", "cortex_distributor_otlp_delta_to_cumulative_memory_bytes", "cortex_distributor_otlp_delta_to_cumulative_streams"))
+
+	// The stream which hasn't expired keeps accumulating.
+	sum := deltaSum("user-1", "series_1", 2, 3, 1)
+	assert.Equal(t, 3.0, sum.DataPoints().At(0).DoubleValue())
+	assert.Equal(t, pcommon.Timestamp(0), sum.DataPoints().At(0).StartTimestamp())
+
+	// The expired stream restarts from its next data point.
+	sum = deltaSum("user-1", "series_2", 1, 2, 1)
+	assert.Equal(t, 1.0, sum.DataPoints().At(0).DoubleValue())
+	assert.Equal(t, pcommon.Timestamp(1), sum.DataPoints().At(0).StartTimestamp())
+
+	// All streams are expired.
+	c.expireStreams(now.Add(time.Hour))
+	c.cleanupTenantMetrics("user-1")
+	c.cleanupTenantMetrics("user-2")
+
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_distributor_otlp_delta_to_cumulative_memory_bytes The estimated memory used by the state of the OTLP delta streams tracked by the delta-to-cumulative conversion.
+		# TYPE cortex_distributor_otlp_delta_to_cumulative_memory_bytes gauge
+		cortex_distributor_otlp_delta_to_cumulative_memory_bytes 0
+	`), "cortex_distributor_otlp_delta_to_cumulative_expired_streams_total", "cortex_distributor_otlp_delta_to_cumulative_memory_bytes", "cortex_distributor_otlp_delta_to_cumulative_streams"))
+}
+
+func TestDeltaToCumulativeConverter_ShouldOnlyAccumulateCommittedBatches(t *testing.T) {
+	c := newTestDeltaToCumulativeConverter(nil)
+
+	deltaSum := func(start, ts int64, value int64) (pmetric.Metrics, pmetric.Sum) {
+		md := pmetric.NewMetrics()
+		m := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		m.SetName("test_sum")
+		sum := m.SetEmptySum()
+		sum.SetAggregationTemporality(pmetric.AggregationTemporalityDelta)
+		dp := sum.DataPoints().AppendEmpty()
+		dp.SetStartTimestamp(pcommon.Timestamp(start))
+		dp.SetTimestamp(pcommon.Timestamp(ts))
+		dp.SetIntValue(value)
+		return md, sum
+	}
+
+	md, sum := deltaSum(0, 1, 1)
+	convertAndCommit(t, c, "user", md)
+	assert.Equal(t, int64(1), sum.DataPoints().At(0).IntValue())
+
+	// The push of the request fails, so the batch isn't committed and the request is retried.
+	md, sum = deltaSum(1, 2, 2)
+	require.NoError(t, c.NewBatch().Convert(context.Background(), "user", md))
+	assert.Equal(t, int64(3), sum.DataPoints().At(0).IntValue())
+
+	md, sum = deltaSum(1, 2, 2)
+	convertAndCommit(t, c, "user", md)
+	assert.Equal(t, int64(3), sum.DataPoints().At(0).IntValue())
+
+	// Concurrent requests of the same stream are both accumulated once committed in order, even though the
+	// second one is converted as a reset, because the data point preceding it isn't committed yet.
+	md1, sum1 := deltaSum(2, 3, 3)
+	b1 := c.NewBatch()
+	require.NoError(t, b1.Convert(context.Background(), "user", md1))
+	md2, sum2 := deltaSum(3, 4, 4)
+	b2 := c.NewBatch()
+	require.NoError(t, b2.Convert(context.Background(), "user", md2))
+	assert.Equal(t, int64(6), sum1.DataPoints().At(0).IntValue())
+	assert.Equal(t, int64(4), sum2.DataPoints().At(0).IntValue())
+	assert.Equal(t, pcommon.Timestamp(3), sum2.DataPoints().At(0).StartTimestamp())
+	b1.Commit()
+	b2.Commit()
+
+	md, sum = deltaSum(4, 5, 5)
+	convertAndCommit(t, c, "user", md)
+	assert.Equal(t, int64(15), sum.DataPoints().At(0).IntValue())
+	assert.Equal(t, float64(1), testutil.ToFloat64(c.activeStreams.WithLabelValues("user")))
+	assert.Equal(t, int(deltaStreamBaseBytes), int(c.memoryBytes.Load()))
+}
+
+func TestDeltaToCumulativeConverter_ShouldForwardTheStreamsOwnedByOtherDistributors(t *testing.T) {
+	limits := validation.MockOverrides(func(defaults *validation.Limits, _ map[string]*validation.Limits) {
+		defaults.OTelConvertDeltaToCumulative = true
+	})
+
+	var (
+		mtx      sync.Mutex
+		received []mimirpb.PreallocTimeseries
+		pushErr  error
+	)
+	receiver := NewOTLPGRPCHandler(100000, util.NewBufferPool(0), limits, nil, false, newTestDeltaToCumulativeConverter(nil), func(_ context.Context, pushReq *Request) error {
+		defer pushReq.CleanUp()
+
+		request, err := pushReq.WriteRequest()
+		require.NoError(t, err)
+
+		mtx.Lock()
+		defer mtx.Unlock()
+		if pushErr != nil {
+			return pushErr
+		}
+		for _, series := range request.Timeseries {
+			received = append(received, mimirpb.DeepCopyTimeseries(mimirpb.PreallocTimeseries{}, series, true, false))
+		}
+		return nil
+	}, newPushMetrics(nil), nil, log.NewNopLogger())
+
+	// The receiver serves the internal gRPC service, which requires a tenant.
+	server := grpc.NewServer(grpc.UnaryInterceptor(middleware.ServerUserHeaderInterceptor))
+	RegisterOTLPDeltaForwardingServer(server, receiver)
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	distributors := &deltaToCumulativeRingMock{instances: []ring.InstanceDesc{
+		{Id: "local", Addr: "localhost:1"},
+		{Id: "remote", Addr: listener.Addr().String()},
+	}}
+	clientCfg := grpcclient.Config{}
+	flagext.DefaultValues(&clientCfg)
+	reg := prometheus.NewPedanticRegistry()
+	sender := NewDeltaToCumulativeConverter(time.Minute, 5*time.Second, clientCfg, distributors, "local", log.NewNopLogger(), reg)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), sender))
+	t.Cleanup(func() { require.NoError(t, services.StopAndAwaitTerminated(context.Background(), sender)) })
+
+	const streams = 20
+	deltaSums := func(start, ts int64) (pmetric.Metrics, pmetric.Sum) {
+		md := pmetric.NewMetrics()
+		rm := md.ResourceMetrics().AppendEmpty()
+		rm.Resource().Attributes().PutStr("service.name", "test")
+		m := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		m.SetName("test_sum")
+		sum := m.SetEmptySum()
+		sum.SetAggregationTemporality(pmetric.AggregationTemporalityDelta)
+		sum.SetIsMonotonic(true)
+		for i := 0; i < streams; i++ {
+			dp := sum.DataPoints().AppendEmpty()
+			dp.SetStartTimestamp(pcommon.Timestamp(start * int64(time.Millisecond)))
+			dp.SetTimestamp(pcommon.Timestamp(ts * int64(time.Millisecond)))
+			dp.SetIntValue(1)
+			dp.Attributes().PutInt("stream", int64(i))
+		}
+		return md, sum
+	}
+
+	// The data points of the streams owned by the remote distributor are removed from the request, and
+	// accumulated by the remote distributor.
+	for i := int64(0); i < 2; i++ {
+		md, sum := deltaSums(i, i+1)
+		convertAndCommit(t, sender, "user", md)
+
+		local := sum.DataPoints().Len()
+		for j := 0; j < local; j++ {
+			assert.Equal(t, i+1, sum.DataPoints().At(j).IntValue())
+		}
+		mtx.Lock()
+		require.Len(t, received, streams-local)
+		for _, series := range received {
+			require.Len(t, series.Samples, 1)
+			assert.Equal(t, float64(i+1), series.Samples[0].Value)
+		}
+		received = nil
+		mtx.Unlock()
+
+		require.Greater(t, local, 0)
+		require.Less(t, local, streams)
+		assert.Equal(t, float64((i+1)*int64(streams-local)), testutil.ToFloat64(sender.forwardedDataPoints.WithLabelValues("user")))
+	}
+
+	// The request fails if the remote distributor rejects the data points.
+	mtx.Lock()
+	pushErr = httpgrpc.Error(http.StatusBadRequest, "invalid")
+	mtx.Unlock()
+
+	md, _ := deltaSums(2, 3)
+	err = sender.NewBatch().Convert(context.Background(), "user", md)
+	require.Error(t, err)
+	resp, ok := httpgrpc.HTTPResponseFromError(err)
+	require.True(t, ok)
+	assert.Equal(t, int32(http.StatusBadRequest), resp.Code)
+	assert.Contains(t, string(resp.Body), "invalid")
+	assert.Equal(t, float64(1), testutil.ToFloat64(sender.failedForwards.WithLabelValues("user")))
+
+	// The data points already forwarded by another distributor are never forwarded again.
+	md, sum := deltaSums(2, 3)
+	require.NoError(t, sender.NewBatch().Convert(context.WithValue(context.Background(), forwardedOTLPDeltasContextKey{}, true), "user", md))
+	assert.Equal(t, streams, sum.DataPoints().Len())
+}
+
+// deltaToCumulativeRingMock is a ring whose healthy instances are the given ones.
+type deltaToCumulativeRingMock struct {
+	ring.ReadRing
+	instances []ring.InstanceDesc
+}
+
+func (r *deltaToCumulativeRingMock) GetAllHealthy(ring.Operation) (ring.ReplicationSet, error) {
+	return ring.ReplicationSet{Instances: r.instances}, nil
+}
+
+// newTestDeltaToCumulativeConverter returns a DeltaToCumulativeConverter owning all the streams.
+func newTestDeltaToCumulativeConverter(reg prometheus.Registerer) *DeltaToCumulativeConverter {
+	return NewDeltaToCumulativeConverter(time.Minute, time.Second, grpcclient.Config{}, nil, "", log.NewNopLogger(), reg)
+}
+
+// convertAndCommit converts md with a new batch of c, and commits the batch.
+func convertAndCommit(t *testing.T, c *DeltaToCumulativeConverter, tenantID string, md pmetric.Metrics) {
+	b := c.NewBatch()
+	require.NoError(t, b.Convert(context.Background(), tenantID, md))
+	b.Commit()
+}
+
+func TestDeltaHistogramBuckets_Downscale(t *testing.T) {
+	tests := map[string]struct {
+		buckets  deltaHistogramBuckets
+		by       int32
+		expected deltaHistogramBuckets
+	}{
+		"no downscaling": {
+			buckets:  deltaHistogramBuckets{offset: -3, counts: []uint64{1, 2, 3}},
+			by:       0,
+			expected: deltaHistogramBuckets{offset: -3, counts: []uint64{1, 2, 3}},
+		},
+		"downscale by 1 with negative offset": {
+			buckets:  deltaHistogramBuckets{offset: -3, counts: []uint64{1, 2, 3, 4, 5}},
+			by:       1,
+			expected: deltaHistogramBuckets{offset: -2, counts: []uint64{1, 5, 9}},
+		},
+		"downscale by 2 with positive offset": {
+			buckets:  deltaHistogramBuckets{offset: 3, counts: []uint64{1, 2, 3, 4, 5}},
+			by:       2,
+			expected: deltaHistogramBuckets{offset: 0, counts: []uint64{1, 14}},
+		},
+		"empty buckets": {
+			buckets:  deltaHistogramBuckets{offset: 5},
+			by:       2,
+			expected: deltaHistogramBuckets{offset: 5},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			testData.buckets.downscale(testData.by)
+			assert.Equal(t, testData.expected, testData.buckets)
+		})
+	}
+}
+
+// stripeStreams returns all the streams tracked by c.
+func (c *DeltaToCumulativeConverter) stripeStreams() []*deltaStream {
+	var streams []*deltaStream
+	for i := range c.stripes {
+		for _, s := range c.stripes[i].streams {
+			streams = append(streams, s)
+		}
+	}
+	return streams
+}
@@ -0,0 +1,260 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/httpgrpc"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	querierapi "github.com/grafana/mimir/pkg/querier/api"
+	"github.com/grafana/mimir/pkg/storage/ingest"
+	"github.com/grafana/mimir/pkg/util"
+	utillog "github.com/grafana/mimir/pkg/util/log"
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+)
+
+// OTLPGRPCHandler implements the OTLP gRPC MetricsService accepting OTLP write requests.
+// It converts and pushes the requests like OTLPHandler does for OTLP write requests received over HTTP.
+type OTLPGRPCHandler struct {
+	pmetricotlp.UnimplementedGRPCServer
+
+	maxRecvMsgSize                   int
+	requestBufferPool                util.Pool
+	limits                           OTLPHandlerLimits
+	resourceAttributePromotionConfig OTelResourceAttributePromotionConfig
+	enableStartTimeQuietZero         bool
+	deltaToCumulative                *DeltaToCumulativeConverter
+	push                             PushFunc
+	pushMetrics                      *PushMetrics
+	discardedDueToOtelParseError     *prometheus.CounterVec
+	logger                           log.Logger
+}
+
+// NewOTLPGRPCHandler returns a new OTLPGRPCHandler.
+func NewOTLPGRPCHandler(
+	maxRecvMsgSize int,
+	requestBufferPool util.Pool,
+	limits OTLPHandlerLimits,
+	resourceAttributePromotionConfig OTelResourceAttributePromotionConfig,
+	enableStartTimeQuietZero bool,
+	deltaToCumulative *DeltaToCumulativeConverter,
+	push PushFunc,
+	pushMetrics *PushMetrics,
+	reg prometheus.Registerer,
+	logger log.Logger,
+) *OTLPGRPCHandler {
+	return &OTLPGRPCHandler{
+		maxRecvMsgSize:                   maxRecvMsgSize,
+		requestBufferPool:                requestBufferPool,
+		limits:                           limits,
+		resourceAttributePromotionConfig: resourceAttributePromotionConfig,
+		enableStartTimeQuietZero:         enableStartTimeQuietZero,
+		deltaToCumulative:                deltaToCumulative,
+		push:                             push,
+		pushMetrics:                      pushMetrics,
+		discardedDueToOtelParseError:     newDiscardedDueToOtelParseErrorCounter(reg),
+		logger:                           logger,
+	}
+}
+
+// Export implements pmetricotlp.GRPCServer.
+func (h *OTLPGRPCHandler) Export(ctx context.Context, otlpReq pmetricotlp.ExportRequest) (pmetricotlp.ExportResponse, error) {
+	logger := utillog.WithContext(ctx, h.logger)
+
+	// The request has already been decoded by the gRPC server, so we check its size against the limit
+	// in order to enforce the same limit of the OTLP HTTP endpoint.
+	size := (&pmetric.ProtoMarshaler{}).MetricsSize(otlpReq.Metrics())
+	if size > h.maxRecvMsgSize {
+		return pmetricotlp.NewExportResponse(), status.Error(codes.ResourceExhausted, distributorMaxOTLPRequestSizeErr{
+			actual: size,
+			limit:  h.maxRecvMsgSize,
+		}.Error())
+	}
+
+	otlpConverter := newOTLPMimirConverter()
+	deltas := h.deltaToCumulative.NewBatch()
+
+	supplier := func() (*mimirpb.WriteRequest, func(), error) {
+		spanLogger, ctx := spanlogger.New(ctx, logger, tracer, "Distributor.OTLPGRPCHandler.convert")
+		defer spanLogger.Finish()
+
+		rb := util.NewRequestBuffers(h.requestBufferPool)
+		var req mimirpb.PreallocWriteRequest
+		if err := convertOTLPExportRequest(ctx, otlpReq, size, h.limits, h.resourceAttributePromotionConfig, otlpConverter, h.enableStartTimeQuietZero, deltas, h.pushMetrics, h.discardedDueToOtelParseError, &req, spanLogger); err != nil {
+			// Check for httpgrpc error, default to client error if conversion failed
+			if _, ok := httpgrpc.HTTPResponseFromError(err); !ok {
+				err = httpgrpc.Error(http.StatusBadRequest, err.Error())
+			}
+
+			rb.CleanUp()
+			return nil, nil, err
+		}
+
+		cleanup := func() {
+			mimirpb.ReuseSlice(req.Timeseries)
+			rb.CleanUp()
+		}
+		return &req.WriteRequest, cleanup, nil
+	}
+	req := newRequest(supplier)
+
+	ctx = ingest.ContextWithProducedOffsets(ctx)
+	pushErr := h.push(ctx, req)
+	if pushErr == nil {
+		// The running totals of the delta streams are only updated once the request has been ingested,
+		// so that a retried request isn't accumulated twice.
+		deltas.Commit()
+		addReadConsistencyOffsetsGRPCHeader(ctx)
+
+		resp := pmetricotlp.NewExportResponse()
+		if otlpErr := otlpConverter.Err(); otlpErr != nil {
+			// Push was successful, but OTLP converter left out some data points. We let the client know about it
+			// with a partial success response, as per spec: https://opentelemetry.io/docs/specs/otlp/#partial-success.
+			level.Warn(logger).Log("msg", "OTLP metrics request has been partially ingested", "rejected_data_points", otlpConverter.DroppedTotal(), "err", otlpErr, "insight", true)
+			resp.PartialSuccess().SetRejectedDataPoints(int64(otlpConverter.DroppedTotal()))
+			resp.PartialSuccess().SetErrorMessage(validUTF8Message(otlpErr.Error()))
+		}
+		return resp, nil
+	}
+
+	if errors.Is(pushErr, context.Canceled) {
+		level.Warn(logger).Log("msg", "push request canceled", "err", pushErr)
+		return pmetricotlp.NewExportResponse(), status.Error(codes.Canceled, "push request context canceled")
+	}
+
+	pushErr = toOtelDomainError(pushErr)
+	grpcCode, httpCode, errorMsg := toOtlpErrorStatus(pushErr)
+	if httpCode == http.StatusAccepted {
+		// The request has been deduplicated by the HA tracker, so the client shouldn't retry it.
+		return pmetricotlp.NewExportResponse(), nil
+	}
+
+	// This error message is consistent with error message in the OTLP HTTP handler.
+	msgs := []interface{}{"msg", "detected an error while ingesting OTLP metrics request (the request may have been partially ingested)", "httpCode", httpCode, "err", pushErr}
+	logLevel := level.Error
+	if httpCode/100 == 4 {
+		msgs = append(msgs, "insight", true)
+		logLevel = level.Warn
+	}
+	logLevel(logger).Log(msgs...)
+
+	return pmetricotlp.NewExportResponse(), status.Error(httpToOTLPGRPCStatusCode(grpcCode, httpCode), validUTF8Message(errorMsg))
+}
+
+// otlpDeltaForwardMethod is the internal gRPC method receiving the OTLP delta data points forwarded by the
+// distributors to the distributor owning their streams.
+const otlpDeltaForwardMethod = "/distributor.OTLPDeltaToCumulative/Push"
+
+type forwardedOTLPDeltasContextKey struct{}
+
+// isForwardedOTLPDeltas returns whether ctx is the one of OTLP delta data points forwarded by another distributor.
+func isForwardedOTLPDeltas(ctx context.Context) bool {
+	forwarded, _ := ctx.Value(forwardedOTLPDeltasContextKey{}).(bool)
+	return forwarded
+}
+
+// PushForwardedDeltas receives the OTLP delta data points forwarded by another distributor, which are owned by this
+// distributor, as a serialized OTLP export request. They're converted and pushed like the ones received by Export.
+func (h *OTLPGRPCHandler) PushForwardedDeltas(ctx context.Context, req *wrapperspb.BytesValue) (*emptypb.Empty, error) {
+	otlpReq := pmetricotlp.NewExportRequest()
+	if err := otlpReq.UnmarshalProto(req.GetValue()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "failed to unmarshal the forwarded OTLP delta data points: %s", err)
+	}
+
+	if _, err := h.Export(context.WithValue(ctx, forwardedOTLPDeltasContextKey{}, true), otlpReq); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// otlpDeltaForwardingServer is the server of the internal gRPC service receiving the forwarded OTLP delta data points.
+type otlpDeltaForwardingServer interface {
+	PushForwardedDeltas(context.Context, *wrapperspb.BytesValue) (*emptypb.Empty, error)
+}
+
+var otlpDeltaForwardingServiceDesc = grpc.ServiceDesc{
+	ServiceName: "distributor.OTLPDeltaToCumulative",
+	HandlerType: (*otlpDeltaForwardingServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Push",
+			Handler:    otlpDeltaForwardingPushHandler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+func otlpDeltaForwardingPushHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(wrapperspb.BytesValue)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(otlpDeltaForwardingServer).PushForwardedDeltas(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: otlpDeltaForwardMethod,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(otlpDeltaForwardingServer).PushForwardedDeltas(ctx, req.(*wrapperspb.BytesValue))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// RegisterOTLPDeltaForwardingServer registers the internal gRPC service receiving the OTLP delta data points
+// forwarded by the other distributors. It's only served over gRPC, and not exposed on the HTTP API.
+func RegisterOTLPDeltaForwardingServer(s grpc.ServiceRegistrar, h *OTLPGRPCHandler) {
+	s.RegisterService(&otlpDeltaForwardingServiceDesc, h)
+}
+
+// httpToOTLPGRPCStatusCode returns the gRPC status code of the OTLP gRPC response, given the gRPC and HTTP
+// status codes of the OTLP HTTP response to the same error. Errors which are retryable by OTLP HTTP clients
+// (HTTP status codes 429, 502, 503 and 504) are mapped to codes.Unavailable, so that OTLP gRPC clients retry
+// them too (https://opentelemetry.io/docs/specs/otlp/#failures).
+func httpToOTLPGRPCStatusCode(grpcCode codes.Code, httpCode int) codes.Code {
+	if httpCode == http.StatusTooManyRequests || httpCode/100 == 5 {
+		return codes.Unavailable
+	}
+
+	// Errors created with the httpgrpc package carry the HTTP status code as gRPC code.
+	if util.IsHTTPStatusCode(grpcCode) {
+		switch httpCode {
+		case http.StatusUnauthorized:
+			return codes.Unauthenticated
+		case http.StatusForbidden:
+			return codes.PermissionDenied
+		case statusClientClosedRequest:
+			return codes.Canceled
+		}
+		return codes.InvalidArgument
+	}
+
+	return grpcCode
+}
+
+// addReadConsistencyOffsetsGRPCHeader is the gRPC equivalent of addReadConsistencyOffsetsHeader.
+func addReadConsistencyOffsetsGRPCHeader(ctx context.Context) {
+	offsets := ingest.ProducedOffsetsFromContext(ctx).Offsets()
+	if len(offsets) == 0 {
+		return
+	}
+
+	// The header can't be set if the request hasn't been received through a gRPC server, e.g. in tests.
+	_ = grpc.SetHeader(ctx, metadata.Pairs(querierapi.ReadConsistencyOffsetsHeader, string(querierapi.EncodeOffsets(offsets))))
+}
@@ -0,0 +1,236 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"context"
+	"flag"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/middleware"
+	dskit_server "github.com/grafana/dskit/server"
+	"github.com/grafana/dskit/user"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	querierapi "github.com/grafana/mimir/pkg/querier/api"
+	"github.com/grafana/mimir/pkg/storage/ingest"
+	"github.com/grafana/mimir/pkg/util"
+)
+
+func TestOTLPGRPCHandler(t *testing.T) {
+	now := time.Now()
+
+	gaugeMetrics := func() pmetric.Metrics {
+		md := pmetric.NewMetrics()
+		m := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		m.SetName("test_gauge")
+		dp := m.SetEmptyGauge().DataPoints().AppendEmpty()
+		dp.SetTimestamp(pcommon.NewTimestampFromTime(now))
+		dp.SetDoubleValue(1)
+		return md
+	}
+
+	// Delta sums are rejected by the OTLP converter, because native delta ingestion is disabled.
+	appendDeltaSum := func(md pmetric.Metrics) pmetric.Metrics {
+		m := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		m.SetName("test_delta_sum")
+		sum := m.SetEmptySum()
+		sum.SetAggregationTemporality(pmetric.AggregationTemporalityDelta)
+		dp := sum.DataPoints().AppendEmpty()
+		dp.SetTimestamp(pcommon.NewTimestampFromTime(now))
+		dp.SetDoubleValue(1)
+		return md
+	}
+
+	successfulPush := func(_ context.Context, req *Request) error {
+		_, err := req.WriteRequest()
+		return err
+	}
+
+	tests := map[string]struct {
+		metrics                    pmetric.Metrics
+		maxRecvMsgSize             int
+		push                       PushFunc
+		expectedCode               codes.Code
+		expectedErrMsg             string
+		expectedRejectedDataPoints int64
+		expectedPartialSuccessMsg  string
+		expectedOffsetsHeader      string
+	}{
+		"should ingest the request": {
+			metrics: gaugeMetrics(),
+			push: func(_ context.Context, req *Request) error {
+				wr, err := req.WriteRequest()
+				if err != nil {
+					return err
+				}
+				if len(wr.Timeseries) != 1 || mimirpb.FromLabelAdaptersToLabels(wr.Timeseries[0].Labels).Get("__name__") != "test_gauge" {
+					return errors.New("unexpected series")
+				}
+				if wr.Source != mimirpb.API {
+					return errors.New("unexpected source")
+				}
+				return nil
+			},
+			expectedCode: codes.OK,
+		},
+		"should return the offsets of the partitions the request has been produced to": {
+			metrics: gaugeMetrics(),
+			push: func(ctx context.Context, req *Request) error {
+				if _, err := req.WriteRequest(); err != nil {
+					return err
+				}
+				ingest.ProducedOffsetsFromContext(ctx).Add(2, 5)
+				return nil
+			},
+			expectedCode:          codes.OK,
+			expectedOffsetsHeader: "v1=2:5",
+		},
+		"should return partial success if some data points have been rejected by the conversion": {
+			metrics:                    appendDeltaSum(gaugeMetrics()),
+			push:                       successfulPush,
+			expectedCode:               codes.OK,
+			expectedRejectedDataPoints: 1,
+			expectedPartialSuccessMsg:  `otlp parse error: invalid temporality and type combination for metric "test_delta_sum"`,
+		},
+		"should return InvalidArgument if all data points have been rejected by the conversion": {
+			metrics:        appendDeltaSum(pmetric.NewMetrics()),
+			push:           successfulPush,
+			expectedCode:   codes.InvalidArgument,
+			expectedErrMsg: `otlp parse error: invalid temporality and type combination for metric "test_delta_sum"`,
+		},
+		"should return ResourceExhausted if the request exceeds the size limit": {
+			metrics:        gaugeMetrics(),
+			maxRecvMsgSize: 10,
+			push:           successfulPush,
+			expectedCode:   codes.ResourceExhausted,
+			expectedErrMsg: "the incoming OTLP request has been rejected because its message size",
+		},
+		"should return InvalidArgument on validation errors": {
+			metrics: gaugeMetrics(),
+			push: func(context.Context, *Request) error {
+				return newValidationError(errors.New("invalid series"))
+			},
+			expectedCode:   codes.InvalidArgument,
+			expectedErrMsg: "invalid series",
+		},
+		"should return Unavailable when the tenant is rate limited, so that the client retries": {
+			metrics: gaugeMetrics(),
+			push: func(context.Context, *Request) error {
+				return newIngestionRateLimitedError(10, 10)
+			},
+			expectedCode:   codes.Unavailable,
+			expectedErrMsg: "the request has been rejected because the tenant exceeded the ingestion rate limit",
+		},
+		"should return Unavailable on unexpected errors, so that the client retries": {
+			metrics: gaugeMetrics(),
+			push: func(context.Context, *Request) error {
+				return errors.New("unexpected error")
+			},
+			expectedCode:   codes.Unavailable,
+			expectedErrMsg: "unexpected error",
+		},
+		"should return success if the request has been deduplicated by the HA tracker": {
+			metrics: gaugeMetrics(),
+			push: func(context.Context, *Request) error {
+				return newReplicasDidNotMatchError("replica-2", "replica-1")
+			},
+			expectedCode: codes.OK,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			maxRecvMsgSize := testData.maxRecvMsgSize
+			if maxRecvMsgSize == 0 {
+				maxRecvMsgSize = 100000
+			}
+
+			reg := prometheus.NewPedanticRegistry()
+			handler := NewOTLPGRPCHandler(maxRecvMsgSize, util.NewBufferPool(0), otlpLimitsMock{}, nil, false, nil, testData.push, newPushMetrics(reg), reg, log.NewNopLogger())
+			client := startOTLPGRPCServer(t, handler)
+
+			ctx := user.InjectOrgID(context.Background(), "test")
+			var header metadata.MD
+			resp, err := client.Export(ctx, pmetricotlp.NewExportRequestFromMetrics(testData.metrics), grpc.Header(&header))
+
+			if testData.expectedCode != codes.OK {
+				require.Error(t, err)
+				st, ok := status.FromError(err)
+				require.True(t, ok)
+				assert.Equal(t, testData.expectedCode, st.Code())
+				assert.Contains(t, st.Message(), testData.expectedErrMsg)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, testData.expectedRejectedDataPoints, resp.PartialSuccess().RejectedDataPoints())
+			assert.Equal(t, testData.expectedPartialSuccessMsg, resp.PartialSuccess().ErrorMessage())
+
+			if testData.expectedOffsetsHeader != "" {
+				assert.Equal(t, []string{testData.expectedOffsetsHeader}, header.Get(querierapi.ReadConsistencyOffsetsHeader))
+			} else {
+				assert.Empty(t, header.Get(querierapi.ReadConsistencyOffsetsHeader))
+			}
+		})
+	}
+}
+
+func TestOTLPGRPCHandler_ShouldShareMetricsWithOTLPHandler(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	pushMetrics := newPushMetrics(reg)
+
+	// Creating both handlers with the same registerer should not panic.
+	require.NotPanics(t, func() {
+		OTLPHandler(100000, util.NewBufferPool(0), nil, otlpLimitsMock{}, nil, RetryConfig{}, false, nil, nil, pushMetrics, reg, log.NewNopLogger())
+		NewOTLPGRPCHandler(100000, util.NewBufferPool(0), otlpLimitsMock{}, nil, false, nil, nil, pushMetrics, reg, log.NewNopLogger())
+	})
+}
+
+func startOTLPGRPCServer(t *testing.T, handler *OTLPGRPCHandler) pmetricotlp.GRPCClient {
+	cfg := dskit_server.Config{}
+	// Set default values
+	cfg.RegisterFlags(flag.NewFlagSet("test", flag.ContinueOnError))
+
+	// Configure values for test.
+	cfg.HTTPListenAddress = "localhost"
+	cfg.HTTPListenPort = 0 // auto-assign
+	cfg.GRPCListenAddress = "localhost"
+	cfg.GRPCListenPort = 0 // auto-assign
+	cfg.Registerer = prometheus.NewRegistry()
+	cfg.GRPCMiddleware = []grpc.UnaryServerInterceptor{middleware.ServerUserHeaderInterceptor}
+
+	srv, err := dskit_server.New(cfg)
+	require.NoError(t, err)
+
+	pmetricotlp.RegisterGRPCServer(srv.GRPC, handler)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() { defer wg.Done(); _ = srv.Run() }()
+	t.Cleanup(func() {
+		srv.Stop()
+		wg.Wait()
+	})
+
+	conn, err := grpc.NewClient(srv.GRPCListenAddr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithUnaryInterceptor(middleware.ClientUserHeaderInterceptor))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return pmetricotlp.NewGRPCClient(conn)
+}
@@ -509,6 +509,25 @@ func TestConvertOTelHistograms(t *testing.T) {
 	}
 }
 
+func TestAppendHAResourceAttributes(t *testing.T) {
+	md := pmetric.NewMetrics()
+	for _, collector := range []string{"collector-a", "collector-b"} {
+		rm := md.ResourceMetrics().AppendEmpty()
+		rm.Resource().Attributes().PutStr("k8s.cluster.name", "cluster0")
+		rm.Resource().Attributes().PutStr("collector.id", collector)
+		rm.Resource().Attributes().PutStr("host.name", "host0")
+	}
+
+	configured := []string{"host.name"}
+	promoted := appendHAResourceAttributes(configured, []string{"k8s_cluster_name", "collector_id"}, md)
+	assert.Equal(t, []string{"host.name", "k8s.cluster.name", "collector.id"}, promoted)
+	// The configured attributes aren't modified.
+	assert.Equal(t, []string{"host.name"}, configured)
+
+	promoted = appendHAResourceAttributes(nil, []string{"cluster", "__replica__"}, md)
+	assert.Empty(t, promoted)
+}
+
 func TestOTelDeltaIngestion(t *testing.T) {
 	ts := time.Unix(100, 0)
 
@@ -743,7 +762,7 @@ func BenchmarkOTLPHandler(b *testing.B) {
 		return nil
 	}
 	limits := validation.MockDefaultOverrides()
-	handler := OTLPHandler(100000, nil, nil, limits, nil, RetryConfig{}, false, pushFunc, nil, nil, log.NewNopLogger())
+	handler := OTLPHandler(100000, nil, nil, limits, nil, RetryConfig{}, false, nil, pushFunc, nil, nil, log.NewNopLogger())
 
 	b.Run("protobuf", func(b *testing.B) {
 		req := createOTLPProtoRequest(b, exportReq, "")
@@ -1244,7 +1263,7 @@ func TestHandlerOTLPPush(t *testing.T) {
 
 			logs := &concurrency.SyncBuffer{}
 			retryConfig := RetryConfig{Enabled: true, MinBackoff: 5 * time.Second, MaxBackoff: 5 * time.Second}
-			handler := OTLPHandler(tt.maxMsgSize, nil, nil, limits, tt.resourceAttributePromotionConfig, retryConfig, false, pusher, nil, nil, util_log.MakeLeveledLogger(logs, "info"))
+			handler := OTLPHandler(tt.maxMsgSize, nil, nil, limits, tt.resourceAttributePromotionConfig, retryConfig, false, nil, pusher, nil, nil, util_log.MakeLeveledLogger(logs, "info"))
 
 			resp := httptest.NewRecorder()
 			handler.ServeHTTP(resp, req)
@@ -1324,7 +1343,7 @@ func TestHandler_otlpDroppedMetricsPanic(t *testing.T) {
 
 	req := createOTLPProtoRequest(t, pmetricotlp.NewExportRequestFromMetrics(md), "")
 	resp := httptest.NewRecorder()
-	handler := OTLPHandler(100000, nil, nil, limits, nil, RetryConfig{}, false, func(_ context.Context, pushReq *Request) error {
+	handler := OTLPHandler(100000, nil, nil, limits, nil, RetryConfig{}, false, nil, func(_ context.Context, pushReq *Request) error {
 		request, err := pushReq.WriteRequest()
 		assert.NoError(t, err)
 		assert.Len(t, request.Timeseries, 3)
@@ -1366,7 +1385,7 @@ func TestHandler_otlpDroppedMetricsPanic2(t *testing.T) {
 
 	req := createOTLPProtoRequest(t, pmetricotlp.NewExportRequestFromMetrics(md), "")
 	resp := httptest.NewRecorder()
-	handler := OTLPHandler(100000, nil, nil, limits, nil, RetryConfig{}, false, func(_ context.Context, pushReq *Request) error {
+	handler := OTLPHandler(100000, nil, nil, limits, nil, RetryConfig{}, false, nil, func(_ context.Context, pushReq *Request) error {
 		request, err := pushReq.WriteRequest()
 		t.Cleanup(pushReq.CleanUp)
 		require.NoError(t, err)
@@ -1392,7 +1411,7 @@ func TestHandler_otlpDroppedMetricsPanic2(t *testing.T) {
 
 	req = createOTLPProtoRequest(t, pmetricotlp.NewExportRequestFromMetrics(md), "")
 	resp = httptest.NewRecorder()
-	handler = OTLPHandler(100000, nil, nil, limits, nil, RetryConfig{}, false, func(_ context.Context, pushReq *Request) error {
+	handler = OTLPHandler(100000, nil, nil, limits, nil, RetryConfig{}, false, nil, func(_ context.Context, pushReq *Request) error {
 		request, err := pushReq.WriteRequest()
 		t.Cleanup(pushReq.CleanUp)
 		require.NoError(t, err)
@@ -1420,7 +1439,7 @@ func TestHandler_otlpWriteRequestTooBigWithCompression(t *testing.T) {
 
 	resp := httptest.NewRecorder()
 
-	handler := OTLPHandler(140, nil, nil, nil, nil, RetryConfig{}, false, readBodyPushFunc(t), nil, nil, log.NewNopLogger())
+	handler := OTLPHandler(140, nil, nil, nil, nil, RetryConfig{}, false, nil, readBodyPushFunc(t), nil, nil, log.NewNopLogger())
 	handler.ServeHTTP(resp, req)
 	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.Code)
 	body, err := io.ReadAll(resp.Body)
@@ -1654,3 +1673,68 @@ type fakeResourceAttributePromotionConfig struct {
 func (c fakeResourceAttributePromotionConfig) PromoteOTelResourceAttributes(string) []string {
 	return []string{"resource.attr"}
 }
+
+func TestHandler_otlpDeltaToCumulative(t *testing.T) {
+	now := time.Now()
+
+	deltaSumRequest := func(start, ts time.Time, value float64) *http.Request {
+		md := pmetric.NewMetrics()
+		m := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		m.SetName("test_delta_sum")
+		sum := m.SetEmptySum()
+		sum.SetAggregationTemporality(pmetric.AggregationTemporalityDelta)
+		sum.SetIsMonotonic(true)
+		dp := sum.DataPoints().AppendEmpty()
+		dp.SetStartTimestamp(pcommon.NewTimestampFromTime(start))
+		dp.SetTimestamp(pcommon.NewTimestampFromTime(ts))
+		dp.SetDoubleValue(value)
+
+		return createOTLPProtoRequest(t, pmetricotlp.NewExportRequestFromMetrics(md), "")
+	}
+
+	limits := validation.MockOverrides(func(defaults *validation.Limits, _ map[string]*validation.Limits) {
+		defaults.OTelConvertDeltaToCumulative = true
+	})
+
+	var (
+		samples  []mimirpb.Sample
+		pushErrs = []error{nil, httpgrpc.Error(http.StatusServiceUnavailable, "unavailable"), nil, nil}
+	)
+	handler := OTLPHandler(100000, nil, nil, limits, nil, RetryConfig{}, false, newTestDeltaToCumulativeConverter(nil), func(_ context.Context, pushReq *Request) error {
+		defer pushReq.CleanUp()
+
+		request, err := pushReq.WriteRequest()
+		require.NoError(t, err)
+		require.Len(t, request.Timeseries, 1)
+		assert.Equal(t, "test_delta_sum", mimirpb.FromLabelAdaptersToLabels(request.Timeseries[0].Labels).Get(model.MetricNameLabel))
+
+		pushErr := pushErrs[0]
+		pushErrs = pushErrs[1:]
+		if pushErr != nil {
+			return pushErr
+		}
+		samples = append(samples, request.Timeseries[0].Samples...)
+		return nil
+	}, nil, nil, log.NewNopLogger())
+
+	// The push of the second request fails, so it's retried by the client without being accumulated twice.
+	for i, value := range []float64{1, 2, 2, 3} {
+		start, end := i, i+1
+		if i > 1 {
+			start, end = i-1, i
+		}
+
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, deltaSumRequest(now.Add(time.Duration(start)*time.Second), now.Add(time.Duration(end)*time.Second), value))
+		if i == 1 {
+			require.Equal(t, http.StatusServiceUnavailable, resp.Code)
+			continue
+		}
+		require.Equal(t, http.StatusOK, resp.Code)
+	}
+
+	require.Len(t, samples, 3)
+	assert.Equal(t, 1.0, samples[0].Value)
+	assert.Equal(t, 3.0, samples[1].Value)
+	assert.Equal(t, 6.0, samples[2].Value)
+}
@@ -29,6 +29,8 @@ import (
 	"go.opentelemetry.io/otel/trace"
 
 	"github.com/grafana/mimir/pkg/mimirpb"
+	querierapi "github.com/grafana/mimir/pkg/querier/api"
+	"github.com/grafana/mimir/pkg/storage/ingest"
 	"github.com/grafana/mimir/pkg/util"
 	"github.com/grafana/mimir/pkg/util/globalerror"
 	utillog "github.com/grafana/mimir/pkg/util/log"
@@ -110,6 +112,11 @@ func Handler(
 		}
 		pushMetrics.ObserveUncompressedBodySize(tenantID, float64(protoBodySize))
 
+		if limits.RemoteWriteConvertClassicHistogramsToNHCB(tenantID) {
+			converted, notConverted := convertClassicHistogramsToNHCB(&req.WriteRequest)
+			pushMetrics.AddClassicHistogramsConvertedToNHCB(tenantID, converted, notConverted)
+		}
+
 		return nil
 	})
 }
@@ -215,6 +222,8 @@ func handler(
 		if isRW2 {
 			ctx = contextWithWriteResponseStats(ctx)
 		}
+		ctx = ingest.ContextWithProducedOffsets(ctx)
+		ctx = contextWithWriteBufferedMarker(ctx)
 		err = push(ctx, req)
 		if isRW2 {
 			if err := addWriteResponseStats(ctx, w); err != nil {
@@ -224,6 +233,10 @@ func handler(
 		}
 		if err == nil {
 			addSuccessHeaders(w, req.artificialDelay)
+			addReadConsistencyOffsetsHeader(ctx, w)
+			if code := successStatusCode(ctx, w, http.StatusOK); code != http.StatusOK {
+				w.WriteHeader(code)
+			}
 		} else {
 			if errors.Is(err, context.Canceled) {
 				http.Error(w, err.Error(), statusClientClosedRequest)
@@ -319,6 +332,18 @@ func addWriteResponseStats(ctx context.Context, w http.ResponseWriter) error {
 	return nil
 }
 
+// addReadConsistencyOffsetsHeader adds the offsets of the partitions the write request has been produced to, if any,
+// to the response. The client can pass them in the X-Read-Consistency-Offsets header of the following queries to
+// read its own writes, without waiting for the last produced offsets of all partitions.
+func addReadConsistencyOffsetsHeader(ctx context.Context, w http.ResponseWriter) {
+	offsets := ingest.ProducedOffsetsFromContext(ctx).Offsets()
+	if len(offsets) == 0 {
+		return
+	}
+
+	w.Header().Set(querierapi.ReadConsistencyOffsetsHeader, string(querierapi.EncodeOffsets(offsets)))
+}
+
 func updateWriteResponseStatsCtx(ctx context.Context, samples, histograms, exemplars int) {
 	prs := ctx.Value(pushResponseStatsContextKey)
 	if prs == nil {
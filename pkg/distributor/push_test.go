@@ -42,6 +42,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/histogram"
 	"github.com/prometheus/prometheus/prompb"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -55,6 +56,8 @@ import (
 	"github.com/grafana/mimir/pkg/ingester"
 	"github.com/grafana/mimir/pkg/ingester/client"
 	"github.com/grafana/mimir/pkg/mimirpb"
+	querierapi "github.com/grafana/mimir/pkg/querier/api"
+	"github.com/grafana/mimir/pkg/storage/ingest"
 	"github.com/grafana/mimir/pkg/util"
 	"github.com/grafana/mimir/pkg/util/test"
 	"github.com/grafana/mimir/pkg/util/validation"
@@ -68,6 +71,49 @@ func TestHandler_remoteWrite(t *testing.T) {
 	assert.Equal(t, 200, resp.Code)
 }
 
+func TestHandler_ReadConsistencyOffsetsHeader(t *testing.T) {
+	tests := map[string]struct {
+		pushFunc       PushFunc
+		expectedHeader string
+	}{
+		"should not add the header if the request has not been produced to any partition": {
+			pushFunc:       verifyWritePushFunc(t, mimirpb.API),
+			expectedHeader: "",
+		},
+		"should add the header with the offsets of the partitions the request has been produced to": {
+			pushFunc: func(ctx context.Context, req *Request) error {
+				if _, err := req.WriteRequest(); err != nil {
+					return err
+				}
+				ingest.ProducedOffsetsFromContext(ctx).Add(1, 10)
+				ingest.ProducedOffsetsFromContext(ctx).Add(1, 12)
+				return nil
+			},
+			expectedHeader: "v1=1:12",
+		},
+		"should not add the header if the request failed": {
+			pushFunc: func(ctx context.Context, req *Request) error {
+				if _, err := req.WriteRequest(); err != nil {
+					return err
+				}
+				ingest.ProducedOffsetsFromContext(ctx).Add(1, 10)
+				return errors.New("failed")
+			},
+			expectedHeader: "",
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			req := createRequest(t, createPrometheusRemoteWriteProtobuf(t))
+			resp := httptest.NewRecorder()
+			handler := Handler(100000, nil, nil, false, false, validation.MockDefaultOverrides(), RetryConfig{}, testData.pushFunc, nil, log.NewNopLogger())
+			handler.ServeHTTP(resp, req)
+			assert.Equal(t, testData.expectedHeader, resp.Header().Get(querierapi.ReadConsistencyOffsetsHeader))
+		})
+	}
+}
+
 func TestHandler_remoteWriteWithMalformedRequest(t *testing.T) {
 	req := createMalformedRW1Request(t, createPrometheusRemoteWriteProtobuf(t))
 	resp := httptest.NewRecorder()
@@ -76,6 +122,69 @@ func TestHandler_remoteWriteWithMalformedRequest(t *testing.T) {
 	assert.Equal(t, 200, resp.Code)
 }
 
+func TestHandler_remoteWriteConvertClassicHistogramsToNHCB(t *testing.T) {
+	classicHistogram := func(name string, le string) prompb.TimeSeries {
+		lbls := []prompb.Label{{Name: "__name__", Value: name}}
+		if le != "" {
+			lbls = append(lbls, prompb.Label{Name: "le", Value: le})
+		}
+		return prompb.TimeSeries{Labels: lbls, Samples: []prompb.Sample{{Value: 2, Timestamp: 1000}}}
+	}
+	input := prompb.WriteRequest{
+		Timeseries: []prompb.TimeSeries{
+			classicHistogram("latency_bucket", "1"),
+			classicHistogram("latency_bucket", "+Inf"),
+			classicHistogram("latency_sum", ""),
+			classicHistogram("latency_count", ""),
+		},
+		Metadata: []prompb.MetricMetadata{{MetricFamilyName: "latency", Type: prompb.MetricMetadata_HISTOGRAM}},
+	}
+	inputBytes, err := input.Marshal()
+	require.NoError(t, err)
+
+	for _, enabled := range []bool{false, true} {
+		t.Run(fmt.Sprintf("enabled=%t", enabled), func(t *testing.T) {
+			limits := validation.MockOverrides(func(defaults *validation.Limits, _ map[string]*validation.Limits) {
+				defaults.RemoteWriteConvertClassicHistogramsToNHCB = enabled
+			})
+			reg := prometheus.NewPedanticRegistry()
+
+			var pushed []mimirpb.PreallocTimeseries
+			pushFunc := func(_ context.Context, pushReq *Request) error {
+				req, err := pushReq.WriteRequest()
+				require.NoError(t, err)
+				t.Cleanup(pushReq.CleanUp)
+				pushed = req.Timeseries
+				return nil
+			}
+
+			handler := Handler(100000, nil, nil, false, false, limits, RetryConfig{}, pushFunc, newPushMetrics(reg), log.NewNopLogger())
+			resp := httptest.NewRecorder()
+			handler.ServeHTTP(resp, createRequest(t, inputBytes))
+			require.Equal(t, http.StatusOK, resp.Code)
+
+			if !enabled {
+				require.Len(t, pushed, 4)
+				return
+			}
+
+			require.Len(t, pushed, 1)
+			assert.Equal(t, []mimirpb.LabelAdapter{{Name: "__name__", Value: "latency"}}, pushed[0].Labels)
+			assert.Empty(t, pushed[0].Samples)
+			require.Len(t, pushed[0].Histograms, 1)
+			assert.Equal(t, int64(1000), pushed[0].Histograms[0].Timestamp)
+			assert.Equal(t, histogram.CustomBucketsSchema, pushed[0].Histograms[0].Schema)
+			assert.Equal(t, []float64{1}, pushed[0].Histograms[0].CustomValues)
+
+			assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+				# HELP cortex_distributor_classic_histograms_converted_to_nhcb_total The total number of classic histograms received through Prometheus remote write and converted into native histograms with custom buckets.
+				# TYPE cortex_distributor_classic_histograms_converted_to_nhcb_total counter
+				cortex_distributor_classic_histograms_converted_to_nhcb_total{user="test"} 1
+			`), "cortex_distributor_classic_histograms_converted_to_nhcb_total", "cortex_distributor_classic_histograms_not_converted_to_nhcb_total"))
+		})
+	}
+}
+
 func TestOTelMetricsToMetadata(t *testing.T) {
 	otelMetrics := pmetric.NewMetrics()
 	rs := otelMetrics.ResourceMetrics().AppendEmpty()
@@ -1551,7 +1660,7 @@ cortex_distributor_uncompressed_request_body_size_bytes_count{user="test"} 1
 			require.NoError(t, err)
 
 			reg := prometheus.NewRegistry()
-			handler := OTLPHandler(MiB, util.NewBufferPool(0), nil, otlpLimitsMock{}, nil, RetryConfig{}, false, distr.limitsMiddleware(dummyPushFunc), newPushMetrics(reg), reg, log.NewNopLogger())
+			handler := OTLPHandler(MiB, util.NewBufferPool(0), nil, otlpLimitsMock{}, nil, RetryConfig{}, false, nil, distr.limitsMiddleware(dummyPushFunc), newPushMetrics(reg), reg, log.NewNopLogger())
 
 			resp := httptest.NewRecorder()
 			handler.ServeHTTP(resp, req)
@@ -1594,7 +1703,7 @@ func TestOTLPPushHandlerErrorsAreReportedCorrectlyViaHttpgrpc(t *testing.T) {
 
 		return nil
 	}
-	h := OTLPHandler(200, util.NewBufferPool(0), nil, otlpLimitsMock{}, nil, RetryConfig{}, false, push, newPushMetrics(reg), reg, log.NewNopLogger())
+	h := OTLPHandler(200, util.NewBufferPool(0), nil, otlpLimitsMock{}, nil, RetryConfig{}, false, nil, push, newPushMetrics(reg), reg, log.NewNopLogger())
 	srv.HTTP.Handle("/otlp", h)
 
 	// start the server
@@ -1853,6 +1962,14 @@ func (o otlpLimitsMock) OTelPromoteScopeMetadata(string) bool {
 
 func (o otlpLimitsMock) OTelNativeDeltaIngestion(string) bool { return false }
 
+func (o otlpLimitsMock) OTelConvertDeltaToCumulative(string) bool { return false }
+
+func (o otlpLimitsMock) AcceptHASamples(string) bool { return false }
+
+func (o otlpLimitsMock) HAClusterLabels(string) []string { return []string{"cluster"} }
+
+func (o otlpLimitsMock) HAReplicaLabel(string) string { return "__replica__" }
+
 func promToMimirHistogram(h *prompb.Histogram) mimirpb.Histogram {
 	pSpans := make([]mimirpb.BucketSpan, 0, len(h.PositiveSpans))
 	for _, span := range h.PositiveSpans {
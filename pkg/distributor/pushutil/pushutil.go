@@ -0,0 +1,108 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package pushutil provides the helpers shared by the parsers of the push protocols converted into write requests.
+package pushutil
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+// Encoding is a supported Content-Encoding of the request body.
+type Encoding string
+
+const (
+	Gzip Encoding = "gzip"
+	// Deflate is the zlib format, which is what the "deflate" Content-Encoding stands for.
+	Deflate Encoding = "deflate"
+	Zstd    Encoding = "zstd"
+)
+
+// ErrRequestTooLarge is returned when the uncompressed request body is larger than the max size.
+var ErrRequestTooLarge = errors.New("request body too large")
+
+// ReadBody reads the request body, uncompressing it according to its Content-Encoding, which must be one of the
+// supported encodings. It returns ErrRequestTooLarge if the uncompressed body is larger than maxSize. The body
+// read so far is returned together with the error.
+func ReadBody(r *http.Request, maxSize int, supported ...Encoding) ([]byte, error) {
+	var reader io.Reader = r.Body
+
+	encoding := r.Header.Get("Content-Encoding")
+	switch {
+	case encoding == "" || encoding == "identity":
+	case (encoding == "gzip" || encoding == "x-gzip") && slices.Contains(supported, Gzip):
+		gzReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, errors.Wrap(err, "create gzip reader")
+		}
+		defer gzReader.Close()
+		reader = gzReader
+	case encoding == string(Deflate) && slices.Contains(supported, Deflate):
+		zlibReader, err := zlib.NewReader(reader)
+		if err != nil {
+			return nil, errors.Wrap(err, "create deflate reader")
+		}
+		defer zlibReader.Close()
+		reader = zlibReader
+	case encoding == string(Zstd) && slices.Contains(supported, Zstd):
+		zstdReader, err := zstd.NewReader(reader)
+		if err != nil {
+			return nil, errors.Wrap(err, "create zstd reader")
+		}
+		defer zstdReader.Close()
+		reader = zstdReader
+	default:
+		return nil, unsupportedEncodingError(encoding, supported)
+	}
+
+	// Limit at maxSize+1 so we can tell when the size is exceeded.
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(io.LimitReader(reader, int64(maxSize)+1)); err != nil {
+		return buf.Bytes(), errors.Wrap(err, "read body")
+	}
+	if buf.Len() > maxSize {
+		return buf.Bytes(), ErrRequestTooLarge
+	}
+	return buf.Bytes(), nil
+}
+
+func unsupportedEncodingError(encoding string, supported []Encoding) error {
+	quoted := make([]string, 0, len(supported))
+	for _, e := range supported {
+		quoted = append(quoted, fmt.Sprintf("%q", e))
+	}
+
+	switch len(quoted) {
+	case 0:
+		return fmt.Errorf("unsupported compression: %s. Only no compression supported", encoding)
+	case 1:
+		return fmt.Errorf("unsupported compression: %s. Only %s or no compression supported", encoding, quoted[0])
+	default:
+		return fmt.Errorf("unsupported compression: %s. Only %s, or no compression supported", encoding, strings.Join(quoted, ", "))
+	}
+}
+
+// SanitizeName replaces the characters not matching [a-zA-Z0-9_] with "_",
+// and prefixes the name with "_" if it starts with a digit.
+func SanitizeName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		//nolint:staticcheck
+		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_') {
+			b[i] = '_'
+		}
+	}
+	if len(b) > 0 && b[0] >= '0' && b[0] <= '9' {
+		b = append([]byte{'_'}, b...)
+	}
+	return string(b)
+}
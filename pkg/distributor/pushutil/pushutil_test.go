@@ -0,0 +1,87 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package pushutil
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadBody(t *testing.T) {
+	const body = "disk.used 2 1700000010\n"
+
+	var gzipped bytes.Buffer
+	w := gzip.NewWriter(&gzipped)
+	_, _ = w.Write([]byte(body))
+	require.NoError(t, w.Close())
+
+	tests := map[string]struct {
+		body        []byte
+		encoding    string
+		supported   []Encoding
+		maxSize     int
+		expectedErr string
+	}{
+		"no compression": {
+			body:    []byte(body),
+			maxSize: 100,
+		},
+		"supported compression": {
+			body:      gzipped.Bytes(),
+			encoding:  "gzip",
+			supported: []Encoding{Gzip},
+			maxSize:   100,
+		},
+		"unsupported compression": {
+			body:        gzipped.Bytes(),
+			encoding:    "gzip",
+			supported:   []Encoding{Zstd},
+			maxSize:     100,
+			expectedErr: `unsupported compression: gzip. Only "zstd" or no compression supported`,
+		},
+		"unknown compression": {
+			body:        []byte(body),
+			encoding:    "br",
+			supported:   []Encoding{Gzip, Deflate, Zstd},
+			maxSize:     100,
+			expectedErr: `unsupported compression: br. Only "gzip", "deflate", "zstd", or no compression supported`,
+		},
+		"uncompressed body too large": {
+			body:        gzipped.Bytes(),
+			encoding:    "gzip",
+			supported:   []Encoding{Gzip},
+			maxSize:     len(body) - 1,
+			expectedErr: ErrRequestTooLarge.Error(),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "/", bytes.NewReader(tc.body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Encoding", tc.encoding)
+
+			actual, err := ReadBody(req, tc.maxSize, tc.supported...)
+			if tc.expectedErr != "" {
+				require.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, body, string(actual))
+		})
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	assert.Equal(t, "system_cpu_user", SanitizeName("system.cpu.user"))
+	assert.Equal(t, "_1st", SanitizeName("1st"))
+	assert.Equal(t, "a_b_c", SanitizeName("a-b/c"))
+	assert.Equal(t, "", SanitizeName(""))
+	assert.Equal(t, "servers_web_1", SanitizeName(strings.ReplaceAll("servers.web.1", ".", "_")))
+}
@@ -7,6 +7,7 @@ package distributor
 
 import (
 	"math"
+	"strings"
 
 	"github.com/grafana/dskit/limiter"
 	"golang.org/x/time/rate"
@@ -114,6 +115,55 @@ func (s *requestRateStrategy) Burst(tenantID string) int {
 	return math.MaxInt
 }
 
+// metricLimitKeySeparator separates the tenant ID and the selector of a metric limit in the keys of
+// the metric ingestion rate limiter. It can't be part of a tenant ID.
+const metricLimitKeySeparator = "\xff"
+
+// metricLimitKey returns the key of the metric ingestion rate limiter of the metric limit with the given selector.
+func metricLimitKey(tenantID, match string) string {
+	return tenantID + metricLimitKeySeparator + match
+}
+
+// metricIngestionRateStrategy is the strategy of the rate limiter keyed by metricLimitKey, enforcing the
+// ingestion rate limits of the metric limits.
+type metricIngestionRateStrategy struct {
+	limits *validation.Overrides
+}
+
+func newMetricIngestionRateStrategy(limits *validation.Overrides) limiter.RateLimiterStrategy {
+	return &metricIngestionRateStrategy{
+		limits: limits,
+	}
+}
+
+func (s *metricIngestionRateStrategy) Limit(key string) float64 {
+	if l, ok := s.metricLimit(key); ok && l.IngestionRate > 0 {
+		return l.IngestionRate
+	}
+	return float64(rate.Inf)
+}
+
+func (s *metricIngestionRateStrategy) Burst(key string) int {
+	if l, ok := s.metricLimit(key); ok && l.IngestionRate > 0 {
+		return l.Burst()
+	}
+	// Burst is ignored when limit = rate.Inf
+	return 0
+}
+
+func (s *metricIngestionRateStrategy) metricLimit(key string) (validation.MetricLimit, bool) {
+	tenantID, match, ok := strings.Cut(key, metricLimitKeySeparator)
+	if !ok {
+		return validation.MetricLimit{}, false
+	}
+	for _, l := range s.limits.MetricLimits(tenantID) {
+		if l.Match == match {
+			return l, true
+		}
+	}
+	return validation.MetricLimit{}, false
+}
+
 type infiniteStrategy struct{}
 
 func newInfiniteRateStrategy() limiter.RateLimiterStrategy {
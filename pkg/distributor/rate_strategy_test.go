@@ -38,6 +38,26 @@ func TestIngestionRateStrategy(t *testing.T) {
 		assert.Equal(t, strategy.Limit("test"), float64(rate.Inf))
 		assert.Equal(t, strategy.Burst("test"), 0)
 	})
+	t.Run("metric ingestion rate limiter should share the limit of the metric limit across the number of distributors", func(t *testing.T) {
+		overrides := validation.NewOverrides(validation.Limits{
+			MetricLimits: validation.MetricLimitsConfig{
+				{Match: "foo", IngestionRate: 1000, IngestionBurstSize: 2000},
+				{Match: "bar", MaxGlobalSeries: 10},
+			},
+		}, nil)
+
+		mockRing := newReadLifecyclerMock()
+		mockRing.On("HealthyInstancesCount").Return(2)
+
+		strategy := newGlobalRateStrategy(newMetricIngestionRateStrategy(overrides), mockRing)
+		assert.Equal(t, float64(500), strategy.Limit(metricLimitKey("test", "foo")))
+		assert.Equal(t, 2000, strategy.Burst(metricLimitKey("test", "foo")))
+
+		// Limits without ingestion rate, or not configured anymore, are unlimited.
+		assert.Equal(t, float64(rate.Inf), strategy.Limit(metricLimitKey("test", "bar")))
+		assert.Equal(t, float64(rate.Inf), strategy.Limit(metricLimitKey("test", "baz")))
+	})
+
 	t.Run("Burst factor should be 3x the per distributor limit", func(t *testing.T) {
 		// Init limits overrides
 		overrides := validation.NewOverrides(validation.Limits{
@@ -0,0 +1,478 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/golang/snappy"
+	"github.com/grafana/dskit/backoff"
+	"github.com/grafana/dskit/services"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util/validation"
+	"github.com/grafana/mimir/pkg/util/version"
+)
+
+const (
+	// remoteWriteForwardingCleanupInterval is the interval at which the queues of the endpoints which aren't
+	// in the rules of their tenant anymore are stopped.
+	remoteWriteForwardingCleanupInterval = time.Minute
+
+	reasonForwardingQueueFull  = "queue_full"
+	reasonForwardingSendFailed = "send_failed"
+)
+
+var (
+	errInvalidRemoteWriteForwardingQueueCapacity     = errors.New("invalid remote write forwarding queue capacity, the value must be greater than zero")
+	errInvalidRemoteWriteForwardingMaxBatchSize      = errors.New("invalid remote write forwarding max batch size, the value must be greater than zero")
+	errInvalidRemoteWriteForwardingBatchSendDeadline = errors.New("invalid remote write forwarding batch send deadline, the value must be greater than zero")
+)
+
+// RemoteWriteForwardingConfig configures the forwarding of series to remote write endpoints.
+type RemoteWriteForwardingConfig struct {
+	Enabled           bool           `yaml:"enabled" category:"experimental"`
+	QueueCapacity     int            `yaml:"queue_capacity" category:"experimental"`
+	MaxBatchSize      int            `yaml:"max_batch_size" category:"experimental"`
+	BatchSendDeadline time.Duration  `yaml:"batch_send_deadline" category:"experimental"`
+	RequestTimeout    time.Duration  `yaml:"request_timeout" category:"experimental"`
+	Backoff           backoff.Config `yaml:"backoff" doc:"description=Configures the retries of the failed remote write requests."`
+}
+
+// RegisterFlags adds the flags required to config this to the given FlagSet.
+func (cfg *RemoteWriteForwardingConfig) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.Enabled, "distributor.remote-write-forwarding.enabled", false, "Enable the forwarding of the series matching the per-tenant remote_write_forwarding_rules to remote write endpoints.")
+	f.IntVar(&cfg.QueueCapacity, "distributor.remote-write-forwarding.queue-capacity", 10000, "Maximum number of series queued for each tenant and endpoint. The series received while the queue is full are dropped, so that the ingestion isn't slowed down.")
+	f.IntVar(&cfg.MaxBatchSize, "distributor.remote-write-forwarding.max-batch-size", 1000, "Maximum number of series sent in a single remote write request.")
+	f.DurationVar(&cfg.BatchSendDeadline, "distributor.remote-write-forwarding.batch-send-deadline", 5*time.Second, "Maximum time a series waits in the queue before being sent.")
+	f.DurationVar(&cfg.RequestTimeout, "distributor.remote-write-forwarding.request-timeout", 10*time.Second, "Timeout of a remote write request.")
+	cfg.Backoff.RegisterFlagsWithPrefix("distributor.remote-write-forwarding", f)
+}
+
+func (cfg *RemoteWriteForwardingConfig) Validate() error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.QueueCapacity <= 0 {
+		return errInvalidRemoteWriteForwardingQueueCapacity
+	}
+	if cfg.MaxBatchSize <= 0 {
+		return errInvalidRemoteWriteForwardingMaxBatchSize
+	}
+	if cfg.BatchSendDeadline <= 0 {
+		return errInvalidRemoteWriteForwardingBatchSendDeadline
+	}
+	return nil
+}
+
+// RemoteWriteForwarder forwards the series matching the per-tenant remote write forwarding rules to remote write
+// endpoints. The series are copied into a bounded queue for each tenant and endpoint, which is sent asynchronously
+// in batches, so that forwarding never slows down nor fails the ingestion. The series received while the queue
+// is full are dropped.
+type RemoteWriteForwarder struct {
+	services.Service
+
+	cfg    RemoteWriteForwardingConfig
+	limits *validation.Overrides
+	client *http.Client
+	logger log.Logger
+
+	// matcher matches the series against the selectors of the rules.
+	matcher *validation.MetricLimitMatcher
+
+	queuesMtx sync.Mutex
+	queues    map[forwardingQueueKey]*forwardingQueue
+	queuesWg  sync.WaitGroup
+
+	// retriesCtx is canceled when stopping, to stop retrying the failed requests.
+	retriesCtx    context.Context
+	cancelRetries context.CancelFunc
+
+	enqueuedSeries *prometheus.CounterVec
+	sentSeries     *prometheus.CounterVec
+	droppedSeries  *prometheus.CounterVec
+	retries        *prometheus.CounterVec
+	queueLength    *prometheus.GaugeVec
+}
+
+// forwardingEndpoint is a remote write endpoint, with the authentication and headers sent to it.
+type forwardingEndpoint struct {
+	url               string
+	basicAuthUsername string
+	basicAuthPassword string
+	bearerToken       string
+	// headers are the additional headers, sorted and formatted, so that the endpoint is comparable.
+	headers string
+}
+
+func newForwardingEndpoint(rule validation.RemoteWriteForwardingRule) forwardingEndpoint {
+	headers := make([]string, 0, len(rule.Headers))
+	for name, value := range rule.Headers {
+		headers = append(headers, name+"\xff"+value)
+	}
+	sort.Strings(headers)
+
+	return forwardingEndpoint{
+		url:               rule.URL,
+		basicAuthUsername: rule.BasicAuthUsername,
+		basicAuthPassword: rule.BasicAuthPassword.String(),
+		bearerToken:       rule.BearerToken.String(),
+		headers:           strings.Join(headers, "\xfe"),
+	}
+}
+
+type forwardingQueueKey struct {
+	tenantID string
+	endpoint forwardingEndpoint
+}
+
+// forwardingQueue is the queue of the series forwarded to an endpoint for a tenant.
+type forwardingQueue struct {
+	key    forwardingQueueKey
+	series chan mimirpb.PreallocTimeseries
+	done   chan struct{}
+}
+
+// NewRemoteWriteForwarder returns a new RemoteWriteForwarder.
+func NewRemoteWriteForwarder(cfg RemoteWriteForwardingConfig, limits *validation.Overrides, logger log.Logger, reg prometheus.Registerer) *RemoteWriteForwarder {
+	retriesCtx, cancelRetries := context.WithCancel(context.Background())
+	f := &RemoteWriteForwarder{
+		cfg:           cfg,
+		limits:        limits,
+		client:        &http.Client{Timeout: cfg.RequestTimeout},
+		logger:        logger,
+		matcher:       validation.NewMetricLimitMatcher(),
+		queues:        map[forwardingQueueKey]*forwardingQueue{},
+		retriesCtx:    retriesCtx,
+		cancelRetries: cancelRetries,
+		enqueuedSeries: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_distributor_remote_write_forwarding_enqueued_series_total",
+			Help: "The total number of series enqueued to be forwarded to remote write endpoints.",
+		}, []string{"user"}),
+		sentSeries: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_distributor_remote_write_forwarding_sent_series_total",
+			Help: "The total number of series successfully forwarded to remote write endpoints.",
+		}, []string{"user"}),
+		droppedSeries: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_distributor_remote_write_forwarding_dropped_series_total",
+			Help: "The total number of series which couldn't be forwarded to remote write endpoints, because the queue was full or the requests failed.",
+		}, []string{"user", "reason"}),
+		retries: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_distributor_remote_write_forwarding_retries_total",
+			Help: "The total number of retried remote write requests forwarding series.",
+		}, []string{"user"}),
+		queueLength: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "cortex_distributor_remote_write_forwarding_queue_length",
+			Help: "The number of series queued to be forwarded to remote write endpoints.",
+		}, []string{"user"}),
+	}
+
+	f.Service = services.NewTimerService(remoteWriteForwardingCleanupInterval, nil, f.iteration, f.stopping).WithName("remote write forwarding")
+	return f
+}
+
+func (f *RemoteWriteForwarder) iteration(_ context.Context) error {
+	f.stopRemovedEndpoints()
+	return nil
+}
+
+func (f *RemoteWriteForwarder) stopping(_ error) error {
+	f.cancelRetries()
+
+	f.queuesMtx.Lock()
+	for key, q := range f.queues {
+		close(q.done)
+		delete(f.queues, key)
+	}
+	f.queuesMtx.Unlock()
+
+	// The queues send the series they still hold before stopping, without retrying.
+	f.queuesWg.Wait()
+	return nil
+}
+
+// pendingForwards are the copies of the series of a request to forward to each endpoint, enqueued once the
+// request has been successfully ingested.
+type pendingForwards struct {
+	tenantID string
+	series   map[forwardingEndpoint][]mimirpb.PreallocTimeseries
+}
+
+// Prepare copies the series matching the rules of the tenant, to be enqueued with Enqueue once they've been
+// ingested, or released with Release otherwise. The series are copied beforehand, because the request may be
+// reused before its push returns. It returns nil if no series is forwarded.
+func (f *RemoteWriteForwarder) Prepare(tenantID string, series []mimirpb.PreallocTimeseries) *pendingForwards {
+	rules := f.limits.RemoteWriteForwardingRules(tenantID)
+	if len(rules) == 0 || f.State() != services.Running {
+		return nil
+	}
+
+	endpoints := make([]forwardingEndpoint, len(rules))
+	for i, rule := range rules {
+		endpoints[i] = newForwardingEndpoint(rule)
+	}
+
+	var (
+		pending   *pendingForwards
+		forwarded = map[forwardingEndpoint]struct{}{}
+	)
+
+	for _, ts := range series {
+		labelValue := labelValueFunc(ts.Labels)
+		clear(forwarded)
+
+		for ruleIdx, rule := range rules {
+			if !f.matcher.MatchesSelector(rule.Match, labelValue) {
+				continue
+			}
+			// A series is forwarded once to each endpoint, even if it matches several of its rules.
+			if _, ok := forwarded[endpoints[ruleIdx]]; ok {
+				continue
+			}
+			forwarded[endpoints[ruleIdx]] = struct{}{}
+
+			if pending == nil {
+				pending = &pendingForwards{tenantID: tenantID, series: map[forwardingEndpoint][]mimirpb.PreallocTimeseries{}}
+			}
+			pending.series[endpoints[ruleIdx]] = append(pending.series[endpoints[ruleIdx]], mimirpb.DeepCopyTimeseries(mimirpb.PreallocTimeseries{}, ts, true, false))
+		}
+	}
+	return pending
+}
+
+// Enqueue enqueues the prepared series to be sent to their endpoints. It never blocks: the series are dropped
+// if the queue of an endpoint is full.
+func (f *RemoteWriteForwarder) Enqueue(pending *pendingForwards) {
+	if pending == nil {
+		return
+	}
+
+	var enqueued, dropped int
+	for endpoint, series := range pending.series {
+		q := f.queue(forwardingQueueKey{tenantID: pending.tenantID, endpoint: endpoint})
+		for i := range series {
+			if q != nil {
+				select {
+				case q.series <- series[i]:
+					enqueued++
+					continue
+				default:
+					dropped++
+				}
+			}
+			mimirpb.ReusePreallocTimeseries(&series[i])
+		}
+	}
+
+	if enqueued > 0 {
+		f.enqueuedSeries.WithLabelValues(pending.tenantID).Add(float64(enqueued))
+		f.queueLength.WithLabelValues(pending.tenantID).Add(float64(enqueued))
+	}
+	if dropped > 0 {
+		f.droppedSeries.WithLabelValues(pending.tenantID, reasonForwardingQueueFull).Add(float64(dropped))
+	}
+}
+
+// Release releases the prepared series without sending them, because the request failed.
+func (f *RemoteWriteForwarder) Release(pending *pendingForwards) {
+	if pending == nil {
+		return
+	}
+	for _, series := range pending.series {
+		for i := range series {
+			mimirpb.ReusePreallocTimeseries(&series[i])
+		}
+	}
+}
+
+// queue returns the queue of the endpoint for the tenant, starting it if needed,
+// or nil if the forwarder is stopping.
+func (f *RemoteWriteForwarder) queue(key forwardingQueueKey) *forwardingQueue {
+	f.queuesMtx.Lock()
+	defer f.queuesMtx.Unlock()
+
+	if q, ok := f.queues[key]; ok {
+		return q
+	}
+	if f.State() != services.Running {
+		return nil
+	}
+
+	q := &forwardingQueue{
+		key:    key,
+		series: make(chan mimirpb.PreallocTimeseries, f.cfg.QueueCapacity),
+		done:   make(chan struct{}),
+	}
+	f.queues[key] = q
+
+	f.queuesWg.Add(1)
+	go f.runQueue(q)
+	return q
+}
+
+// stopRemovedEndpoints stops the queues of the endpoints which aren't in the rules of their tenant anymore.
+func (f *RemoteWriteForwarder) stopRemovedEndpoints() {
+	f.queuesMtx.Lock()
+	defer f.queuesMtx.Unlock()
+
+	endpoints := map[string]map[forwardingEndpoint]struct{}{}
+	for key, q := range f.queues {
+		tenantEndpoints, ok := endpoints[key.tenantID]
+		if !ok {
+			tenantEndpoints = map[forwardingEndpoint]struct{}{}
+			for _, rule := range f.limits.RemoteWriteForwardingRules(key.tenantID) {
+				tenantEndpoints[newForwardingEndpoint(rule)] = struct{}{}
+			}
+			endpoints[key.tenantID] = tenantEndpoints
+		}
+
+		if _, ok := tenantEndpoints[key.endpoint]; !ok {
+			close(q.done)
+			delete(f.queues, key)
+		}
+	}
+}
+
+// runQueue sends the series of the queue in batches, until the queue is stopped.
+func (f *RemoteWriteForwarder) runQueue(q *forwardingQueue) {
+	defer f.queuesWg.Done()
+
+	ticker := time.NewTicker(f.cfg.BatchSendDeadline)
+	defer ticker.Stop()
+
+	batch := make([]mimirpb.PreallocTimeseries, 0, f.cfg.MaxBatchSize)
+	send := func() {
+		if len(batch) == 0 {
+			return
+		}
+		f.sendBatch(q.key, batch)
+		for i := range batch {
+			mimirpb.ReusePreallocTimeseries(&batch[i])
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case ts := <-q.series:
+			f.queueLength.WithLabelValues(q.key.tenantID).Dec()
+			batch = append(batch, ts)
+			if len(batch) >= f.cfg.MaxBatchSize {
+				send()
+			}
+
+		case <-ticker.C:
+			send()
+
+		case <-q.done:
+			// Send the series still in the queue.
+			for {
+				select {
+				case ts := <-q.series:
+					f.queueLength.WithLabelValues(q.key.tenantID).Dec()
+					batch = append(batch, ts)
+					if len(batch) >= f.cfg.MaxBatchSize {
+						send()
+					}
+				default:
+					send()
+					return
+				}
+			}
+		}
+	}
+}
+
+// sendBatch sends the batch of series to the endpoint, retrying on server errors and rate limiting.
+func (f *RemoteWriteForwarder) sendBatch(key forwardingQueueKey, batch []mimirpb.PreallocTimeseries) {
+	req := mimirpb.WriteRequest{Timeseries: batch, Source: mimirpb.API}
+	data, err := req.Marshal()
+	if err != nil {
+		level.Warn(f.logger).Log("msg", "failed to marshal the series forwarded to the remote write endpoint", "user", key.tenantID, "err", err)
+		f.droppedSeries.WithLabelValues(key.tenantID, reasonForwardingSendFailed).Add(float64(len(batch)))
+		return
+	}
+	body := snappy.Encode(nil, data)
+
+	boff := backoff.New(f.retriesCtx, f.cfg.Backoff)
+	for {
+		retryable, err := f.send(key.endpoint, body)
+		if err == nil {
+			f.sentSeries.WithLabelValues(key.tenantID).Add(float64(len(batch)))
+			return
+		}
+
+		if retryable {
+			boff.Wait()
+		}
+		if !retryable || !boff.Ongoing() {
+			level.Warn(f.logger).Log("msg", "failed to forward series to the remote write endpoint", "user", key.tenantID, "url", key.endpoint.url, "series", len(batch), "err", err)
+			f.droppedSeries.WithLabelValues(key.tenantID, reasonForwardingSendFailed).Add(float64(len(batch)))
+			return
+		}
+		f.retries.WithLabelValues(key.tenantID).Inc()
+	}
+}
+
+// send sends the snappy-compressed remote write request to the endpoint. It returns whether the request
+// can be retried if it failed.
+func (f *RemoteWriteForwarder) send(endpoint forwardingEndpoint, body []byte) (bool, error) {
+	httpReq, err := http.NewRequest(http.MethodPost, endpoint.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	httpReq.Header.Set("Content-Encoding", "snappy")
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	httpReq.Header.Set("User-Agent", version.UserAgent())
+	httpReq.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if endpoint.headers != "" {
+		for _, header := range strings.Split(endpoint.headers, "\xfe") {
+			name, value, _ := strings.Cut(header, "\xff")
+			httpReq.Header.Set(name, value)
+		}
+	}
+	switch {
+	case endpoint.basicAuthUsername != "":
+		httpReq.SetBasicAuth(endpoint.basicAuthUsername, endpoint.basicAuthPassword)
+	case endpoint.bearerToken != "":
+		httpReq.Header.Set("Authorization", "Bearer "+endpoint.bearerToken)
+	}
+
+	resp, err := f.client.Do(httpReq)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return false, nil
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+	err = fmt.Errorf("server returned HTTP status %s: %s", resp.Status, bytes.TrimSpace(msg))
+	return resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests, err
+}
+
+// cleanupTenantMetrics deletes the metrics of the tenant, once it's inactive.
+func (f *RemoteWriteForwarder) cleanupTenantMetrics(tenantID string) {
+	f.enqueuedSeries.DeleteLabelValues(tenantID)
+	f.sentSeries.DeleteLabelValues(tenantID)
+	f.droppedSeries.DeletePartialMatch(prometheus.Labels{"user": tenantID})
+	f.retries.DeleteLabelValues(tenantID)
+	f.queueLength.DeleteLabelValues(tenantID)
+}
@@ -0,0 +1,365 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/golang/snappy"
+	"github.com/grafana/dskit/backoff"
+	"github.com/grafana/dskit/flagext"
+	"github.com/grafana/dskit/services"
+	"github.com/grafana/dskit/user"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+// remoteWriteReceiver is a remote write endpoint recording the received requests.
+type remoteWriteReceiver struct {
+	t *testing.T
+
+	mtx      sync.Mutex
+	series   []string
+	requests []*http.Request
+	// statusCodes are the status codes returned to the next requests, 204 once exhausted.
+	statusCodes []int
+}
+
+func (r *remoteWriteReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	require.NoError(r.t, err)
+	data, err := snappy.Decode(nil, body)
+	require.NoError(r.t, err)
+	var wr mimirpb.WriteRequest
+	require.NoError(r.t, wr.Unmarshal(data))
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.requests = append(r.requests, req)
+	if len(r.statusCodes) > 0 {
+		statusCode := r.statusCodes[0]
+		r.statusCodes = r.statusCodes[1:]
+		w.WriteHeader(statusCode)
+		return
+	}
+	for _, ts := range wr.Timeseries {
+		r.series = append(r.series, mimirpb.FromLabelAdaptersToString(ts.Labels))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (r *remoteWriteReceiver) receivedSeries() []string {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return append([]string(nil), r.series...)
+}
+
+func (r *remoteWriteReceiver) receivedRequests() []*http.Request {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return append([]*http.Request(nil), r.requests...)
+}
+
+func TestRemoteWriteForwarder_Forward(t *testing.T) {
+	receiver := &remoteWriteReceiver{t: t}
+	server := httptest.NewServer(receiver)
+	t.Cleanup(server.Close)
+
+	other := &remoteWriteReceiver{t: t}
+	otherServer := httptest.NewServer(other)
+	t.Cleanup(otherServer.Close)
+
+	f, reg := newTestRemoteWriteForwarder(t, []validation.RemoteWriteForwardingRule{
+		{Match: `{__name__=~"slo:.+"}`, URL: server.URL, BasicAuthUsername: "partner", BasicAuthPassword: flagext.SecretWithValue("secret"), Headers: map[string]string{"X-Scope-OrgID": "team"}},
+		{Match: `{job="a"}`, URL: server.URL, BasicAuthUsername: "partner", BasicAuthPassword: flagext.SecretWithValue("secret"), Headers: map[string]string{"X-Scope-OrgID": "team"}},
+		{Match: `{job="b"}`, URL: otherServer.URL, BearerToken: flagext.SecretWithValue("token")},
+	})
+
+	f.Enqueue(f.Prepare("user", []mimirpb.PreallocTimeseries{
+		makeTimeseries([]string{"__name__", "slo:errors:ratio", "job", "a"}, makeSamples(1, 1), nil, nil),
+		makeTimeseries([]string{"__name__", "up", "job", "b"}, makeSamples(1, 1), nil, nil),
+		makeTimeseries([]string{"__name__", "up", "job", "c"}, makeSamples(1, 1), nil, nil),
+	}))
+
+	// The series matching several rules of the same endpoint is forwarded once.
+	require.Eventually(t, func() bool { return len(receiver.receivedSeries()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{`slo:errors:ratio{job="a"}`}, receiver.receivedSeries())
+	require.Eventually(t, func() bool { return len(other.receivedSeries()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{`up{job="b"}`}, other.receivedSeries())
+
+	req := receiver.receivedRequests()[0]
+	username, password, ok := req.BasicAuth()
+	require.True(t, ok)
+	assert.Equal(t, "partner", username)
+	assert.Equal(t, "secret", password)
+	assert.Equal(t, "team", req.Header.Get("X-Scope-OrgID"))
+	assert.Equal(t, "snappy", req.Header.Get("Content-Encoding"))
+	assert.Equal(t, "Bearer token", other.receivedRequests()[0].Header.Get("Authorization"))
+
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(f.sentSeries.WithLabelValues("user")) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, float64(2), testutil.ToFloat64(f.enqueuedSeries.WithLabelValues("user")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(f.queueLength.WithLabelValues("user")))
+	assert.Equal(t, 0, testutil.CollectAndCount(reg, "cortex_distributor_remote_write_forwarding_dropped_series_total"))
+
+	f.cleanupTenantMetrics("user")
+	assert.Equal(t, 0, testutil.CollectAndCount(reg, "cortex_distributor_remote_write_forwarding_queue_length"))
+}
+
+func TestRemoteWriteForwarder_Retries(t *testing.T) {
+	tests := map[string]struct {
+		statusCodes     []int
+		expectedSent    float64
+		expectedRetries float64
+		expectedDropped float64
+	}{
+		"should retry on server errors": {
+			statusCodes:     []int{http.StatusInternalServerError, http.StatusServiceUnavailable},
+			expectedSent:    1,
+			expectedRetries: 2,
+		},
+		"should retry on rate limiting": {
+			statusCodes:     []int{http.StatusTooManyRequests},
+			expectedSent:    1,
+			expectedRetries: 1,
+		},
+		"should drop the series once the retries are exhausted": {
+			statusCodes:     []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError},
+			expectedRetries: 2,
+			expectedDropped: 1,
+		},
+		"should not retry on client errors": {
+			statusCodes:     []int{http.StatusBadRequest},
+			expectedDropped: 1,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			receiver := &remoteWriteReceiver{t: t, statusCodes: tc.statusCodes}
+			server := httptest.NewServer(receiver)
+			t.Cleanup(server.Close)
+
+			f, _ := newTestRemoteWriteForwarder(t, []validation.RemoteWriteForwardingRule{{Match: "up", URL: server.URL}})
+			f.Enqueue(f.Prepare("user", []mimirpb.PreallocTimeseries{
+				makeTimeseries([]string{"__name__", "up", "job", "a"}, makeSamples(1, 1), nil, nil),
+			}))
+
+			require.Eventually(t, func() bool {
+				return testutil.ToFloat64(f.sentSeries.WithLabelValues("user"))+testutil.ToFloat64(f.droppedSeries.WithLabelValues("user", reasonForwardingSendFailed)) == 1
+			}, 5*time.Second, 10*time.Millisecond)
+			assert.Equal(t, tc.expectedSent, testutil.ToFloat64(f.sentSeries.WithLabelValues("user")))
+			assert.Equal(t, tc.expectedRetries, testutil.ToFloat64(f.retries.WithLabelValues("user")))
+			assert.Equal(t, tc.expectedDropped, testutil.ToFloat64(f.droppedSeries.WithLabelValues("user", reasonForwardingSendFailed)))
+		})
+	}
+}
+
+func TestRemoteWriteForwarder_QueueFull(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := testRemoteWriteForwardingConfig()
+	cfg.QueueCapacity = 1
+	cfg.MaxBatchSize = 1
+	f := NewRemoteWriteForwarder(cfg, remoteWriteForwardingOverrides([]validation.RemoteWriteForwardingRule{{Match: "up", URL: server.URL}}), log.NewNopLogger(), prometheus.NewPedanticRegistry())
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), f))
+
+	// The sender is blocked by the endpoint, so the series are dropped once the queue is full,
+	// without blocking the caller.
+	for i := 0; i < 10; i++ {
+		f.Enqueue(f.Prepare("user", []mimirpb.PreallocTimeseries{
+			makeTimeseries([]string{"__name__", "up", "job", "a"}, makeSamples(int64(i), 1), nil, nil),
+		}))
+	}
+
+	dropped := testutil.ToFloat64(f.droppedSeries.WithLabelValues("user", reasonForwardingQueueFull))
+	assert.GreaterOrEqual(t, dropped, float64(8))
+	assert.Equal(t, float64(10), dropped+testutil.ToFloat64(f.enqueuedSeries.WithLabelValues("user")))
+
+	close(release)
+	require.NoError(t, services.StopAndAwaitTerminated(context.Background(), f))
+}
+
+func TestRemoteWriteForwarder_StopRemovedEndpoints(t *testing.T) {
+	receiver := &remoteWriteReceiver{t: t}
+	server := httptest.NewServer(receiver)
+	t.Cleanup(server.Close)
+
+	rules := []validation.RemoteWriteForwardingRule{{Match: "up", URL: server.URL}}
+	limits := validation.MockOverrides(func(_ *validation.Limits, tenantLimits map[string]*validation.Limits) {
+		tenantLimits["user"] = validation.MockDefaultLimits()
+		tenantLimits["user"].RemoteWriteForwardingRules = rules
+	})
+	f := NewRemoteWriteForwarder(testRemoteWriteForwardingConfig(), limits, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), f))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(context.Background(), f))
+	})
+
+	f.Enqueue(f.Prepare("user", []mimirpb.PreallocTimeseries{
+		makeTimeseries([]string{"__name__", "up", "job", "a"}, makeSamples(1, 1), nil, nil),
+	}))
+	f.stopRemovedEndpoints()
+	require.Len(t, f.queues, 1)
+
+	// The queue is stopped once its endpoint is removed from the rules, after sending the queued series.
+	rules[0].URL = server.URL + "/other"
+	f.stopRemovedEndpoints()
+	require.Len(t, f.queues, 0)
+	require.Eventually(t, func() bool { return len(receiver.receivedSeries()) == 1 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestRemoteWriteForwardingMiddleware(t *testing.T) {
+	receiver := &remoteWriteReceiver{t: t}
+	server := httptest.NewServer(receiver)
+	t.Cleanup(server.Close)
+
+	limits := remoteWriteForwardingOverrides([]validation.RemoteWriteForwardingRule{{Match: "up", URL: server.URL}})
+	d := &Distributor{limits: limits}
+	d.RemoteWriteForwarder = NewRemoteWriteForwarder(testRemoteWriteForwardingConfig(), limits, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), d.RemoteWriteForwarder))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(context.Background(), d.RemoteWriteForwarder))
+	})
+
+	var pushed int
+	push := d.prePushRemoteWriteForwardingMiddleware(func(_ context.Context, pushReq *Request) error {
+		req, err := pushReq.WriteRequest()
+		require.NoError(t, err)
+		pushed += len(req.Timeseries)
+		// The request is reused once pushed, which mustn't affect the forwarded series.
+		for _, ts := range req.Timeseries {
+			mimirpb.ReusePreallocTimeseries(&ts)
+		}
+		return nil
+	})
+
+	ctx := user.InjectOrgID(context.Background(), "user")
+	req := &mimirpb.WriteRequest{Timeseries: []mimirpb.PreallocTimeseries{
+		makeTimeseries([]string{"__name__", "up", "job", "a"}, makeSamples(1, 1), nil, nil),
+		makeTimeseries([]string{"__name__", "other", "job", "a"}, makeSamples(1, 1), nil, nil),
+	}}
+	require.NoError(t, push(ctx, NewParsedRequest(req)))
+
+	// All the series are pushed, and the matching ones are forwarded too.
+	assert.Equal(t, 2, pushed)
+	require.Eventually(t, func() bool { return len(receiver.receivedSeries()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{`up{job="a"}`}, receiver.receivedSeries())
+}
+
+func TestRemoteWriteForwardingMiddleware_PushFailed(t *testing.T) {
+	receiver := &remoteWriteReceiver{t: t}
+	server := httptest.NewServer(receiver)
+	t.Cleanup(server.Close)
+
+	limits := remoteWriteForwardingOverrides([]validation.RemoteWriteForwardingRule{{Match: "up", URL: server.URL}})
+	d := &Distributor{limits: limits}
+	d.RemoteWriteForwarder = NewRemoteWriteForwarder(testRemoteWriteForwardingConfig(), limits, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), d.RemoteWriteForwarder))
+
+	pushErr := errors.New("push failed")
+	push := d.prePushRemoteWriteForwardingMiddleware(func(context.Context, *Request) error {
+		return pushErr
+	})
+
+	ctx := user.InjectOrgID(context.Background(), "user")
+	req := &mimirpb.WriteRequest{Timeseries: []mimirpb.PreallocTimeseries{
+		makeTimeseries([]string{"__name__", "up", "job", "a"}, makeSamples(1, 1), nil, nil),
+	}}
+	require.ErrorIs(t, push(ctx, NewParsedRequest(req)), pushErr)
+
+	// The series of a failed request aren't forwarded.
+	require.NoError(t, services.StopAndAwaitTerminated(context.Background(), d.RemoteWriteForwarder))
+	assert.Empty(t, receiver.receivedSeries())
+	assert.Equal(t, float64(0), testutil.ToFloat64(d.RemoteWriteForwarder.enqueuedSeries.WithLabelValues("user")))
+}
+
+func TestRemoteWriteForwardingConfig_Validate(t *testing.T) {
+	tests := map[string]struct {
+		setup       func(cfg *RemoteWriteForwardingConfig)
+		expectedErr error
+	}{
+		"should pass with the default config": {
+			setup: func(*RemoteWriteForwardingConfig) {},
+		},
+		"should pass with invalid config when disabled": {
+			setup: func(cfg *RemoteWriteForwardingConfig) {
+				cfg.Enabled = false
+				cfg.QueueCapacity = 0
+			},
+		},
+		"should fail with zero queue capacity": {
+			setup:       func(cfg *RemoteWriteForwardingConfig) { cfg.QueueCapacity = 0 },
+			expectedErr: errInvalidRemoteWriteForwardingQueueCapacity,
+		},
+		"should fail with zero max batch size": {
+			setup:       func(cfg *RemoteWriteForwardingConfig) { cfg.MaxBatchSize = 0 },
+			expectedErr: errInvalidRemoteWriteForwardingMaxBatchSize,
+		},
+		"should fail with zero batch send deadline": {
+			setup:       func(cfg *RemoteWriteForwardingConfig) { cfg.BatchSendDeadline = 0 },
+			expectedErr: errInvalidRemoteWriteForwardingBatchSendDeadline,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := testRemoteWriteForwardingConfig()
+			tc.setup(&cfg)
+			assert.Equal(t, tc.expectedErr, cfg.Validate())
+		})
+	}
+}
+
+func testRemoteWriteForwardingConfig() RemoteWriteForwardingConfig {
+	return RemoteWriteForwardingConfig{
+		Enabled:           true,
+		QueueCapacity:     100,
+		MaxBatchSize:      10,
+		BatchSendDeadline: 10 * time.Millisecond,
+		RequestTimeout:    time.Second,
+		Backoff: backoff.Config{
+			MinBackoff: time.Millisecond,
+			MaxBackoff: time.Millisecond,
+			MaxRetries: 3,
+		},
+	}
+}
+
+func remoteWriteForwardingOverrides(rules []validation.RemoteWriteForwardingRule) *validation.Overrides {
+	return validation.MockOverrides(func(defaults *validation.Limits, _ map[string]*validation.Limits) {
+		defaults.RemoteWriteForwardingRules = rules
+	})
+}
+
+func newTestRemoteWriteForwarder(t *testing.T, rules []validation.RemoteWriteForwardingRule) (*RemoteWriteForwarder, *prometheus.Registry) {
+	t.Helper()
+
+	reg := prometheus.NewPedanticRegistry()
+	f := NewRemoteWriteForwarder(testRemoteWriteForwardingConfig(), remoteWriteForwardingOverrides(rules), log.NewNopLogger(), reg)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), f))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(context.Background(), f))
+	})
+	return f, reg
+}
@@ -0,0 +1,805 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"context"
+	"flag"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/grpcclient"
+	"github.com/grafana/dskit/ring"
+	ring_client "github.com/grafana/dskit/ring/client"
+	"github.com/grafana/dskit/services"
+	"github.com/grafana/dskit/tenant"
+	"github.com/grafana/dskit/user"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/value"
+	"google.golang.org/grpc"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util/grpcencoding/s2"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+const (
+	// streamingAggregationPushMethod is the internal gRPC method on which the distributors receive the series
+	// forwarded by the other distributors, because the output series they're aggregated into are owned by the receiver.
+	streamingAggregationPushMethod = "/distributor.StreamingAggregation/Push"
+
+	streamingAggregationStripes = 128
+
+	// reasonStreamingAggregationMaxOutputSeries is the reason of the samples which aren't aggregated, because
+	// the tenant reached the max number of output series.
+	reasonStreamingAggregationMaxOutputSeries = "max_output_series"
+	// reasonStreamingAggregationForwardQueueFull is the reason of the series which aren't forwarded, because
+	// the forward queue is full.
+	reasonStreamingAggregationForwardQueueFull = "forward_queue_full"
+)
+
+var (
+	errInvalidStreamingAggregationInterval         = errors.New("invalid streaming aggregation interval, the value must be greater than zero")
+	errInvalidStreamingAggregationStateIdleTimeout = errors.New("invalid streaming aggregation state idle timeout, the value must be greater than the interval")
+	errInvalidStreamingAggregationForwardQueue     = errors.New("invalid streaming aggregation forward queue, the capacity and the concurrency must be greater than zero")
+)
+
+// StreamingAggregationConfig configures the streaming aggregation of series at ingestion.
+type StreamingAggregationConfig struct {
+	Enabled              bool              `yaml:"enabled" category:"experimental"`
+	Interval             time.Duration     `yaml:"interval" category:"experimental"`
+	StateIdleTimeout     time.Duration     `yaml:"state_idle_timeout" category:"experimental"`
+	ForwardTimeout       time.Duration     `yaml:"forward_timeout" category:"experimental"`
+	ForwardQueueCapacity int               `yaml:"forward_queue_capacity" category:"experimental"`
+	ForwardConcurrency   int               `yaml:"forward_concurrency" category:"experimental"`
+	GRPCClientConfig     grpcclient.Config `yaml:"grpc_client_config" doc:"description=Configures the gRPC client used to forward the input series to the distributor owning their output series."`
+}
+
+// RegisterFlags adds the flags required to config this to the given FlagSet.
+func (cfg *StreamingAggregationConfig) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.Enabled, "distributor.streaming-aggregation.enabled", false, "Enable the streaming aggregation of the series matching the per-tenant streaming_aggregation_rules. Each output series is owned by one of the healthy distributors in the ring, and the input series received by the other distributors are forwarded to it.")
+	f.DurationVar(&cfg.Interval, "distributor.streaming-aggregation.interval", time.Minute, "Interval at which the aggregated output series are emitted.")
+	f.DurationVar(&cfg.StateIdleTimeout, "distributor.streaming-aggregation.state-idle-timeout", 5*time.Minute, "How long the state of an input series is kept after its last sample. The running total of a counter output series restarts from zero once all its input series have expired.")
+	f.DurationVar(&cfg.ForwardTimeout, "distributor.streaming-aggregation.forward-timeout", 2*time.Second, "Timeout for forwarding the input series to the distributor owning their output series.")
+	f.IntVar(&cfg.ForwardQueueCapacity, "distributor.streaming-aggregation.forward-queue-capacity", 1000, "Maximum number of requests forwarding input series queued to be sent to the distributors owning their output series. The input series are forwarded asynchronously, so that the ingestion isn't slowed down, and are dropped while the queue is full.")
+	f.IntVar(&cfg.ForwardConcurrency, "distributor.streaming-aggregation.forward-concurrency", 16, "Number of requests forwarding input series sent concurrently to the distributors owning their output series.")
+
+	cfg.GRPCClientConfig.CustomCompressors = []string{s2.Name}
+	cfg.GRPCClientConfig.RegisterFlagsWithPrefix("distributor.streaming-aggregation.grpc-client-config", f)
+}
+
+func (cfg *StreamingAggregationConfig) Validate() error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.Interval <= 0 {
+		return errInvalidStreamingAggregationInterval
+	}
+	if cfg.StateIdleTimeout <= cfg.Interval {
+		return errInvalidStreamingAggregationStateIdleTimeout
+	}
+	if cfg.ForwardQueueCapacity <= 0 || cfg.ForwardConcurrency <= 0 {
+		return errInvalidStreamingAggregationForwardQueue
+	}
+	return cfg.GRPCClientConfig.Validate()
+}
+
+// streamingAggregationOutputKey is the context key marking the push of the aggregated output series,
+// which must not be aggregated again.
+type streamingAggregationOutputKey struct{}
+
+func isStreamingAggregationOutput(ctx context.Context) bool {
+	return ctx.Value(streamingAggregationOutputKey{}) != nil
+}
+
+// StreamingAggregator aggregates the series matching the per-tenant streaming aggregation rules into output
+// series, which are pushed at a fixed interval. Samples are aggregated in the interval they're received in.
+//
+// Each output series is owned by a single distributor, chosen among the healthy distributors of the ring
+// by rendezvous hashing, so that its state is kept by only one of them. The input series whose output series
+// is owned by another distributor are forwarded to it asynchronously, over gRPC, through a bounded queue. When
+// the ring changes, the state of the output series which moved to another distributor is lost, and restarts there.
+type StreamingAggregator struct {
+	services.Service
+
+	cfg        StreamingAggregationConfig
+	limits     *validation.Overrides
+	push       PushFunc
+	ring       ring.ReadRing
+	instanceID string
+	clients    *ring_client.Pool
+	logger     log.Logger
+
+	stripes [streamingAggregationStripes]aggregatedSeriesStripe
+
+	// matcher matches the series against the selectors of the rules.
+	matcher *validation.MetricLimitMatcher
+
+	// outputSeriesCount is the number of output series whose state is kept, by tenant. It's updated with the
+	// mutex of a stripe held.
+	outputSeriesCountMtx sync.Mutex
+	outputSeriesCount    map[string]int
+
+	// tenantsWithOutputs are the tenants with output series on the last flush, used to reset their gauge.
+	tenantsWithOutputs map[string]struct{}
+
+	// forwardQueue holds the input series to forward, which are sent by the forward workers.
+	forwardQueue   chan streamingAggregationForward
+	forwardWorkers sync.WaitGroup
+
+	inputSamples        *prometheus.CounterVec
+	discardedSamples    *prometheus.CounterVec
+	forwardedSeries     *prometheus.CounterVec
+	droppedForwards     *prometheus.CounterVec
+	failedForwards      *prometheus.CounterVec
+	outputSeries        *prometheus.GaugeVec
+	outputSamples       *prometheus.CounterVec
+	failedOutputSamples *prometheus.CounterVec
+}
+
+type aggregatedSeriesStripe struct {
+	mtx    sync.Mutex
+	series map[aggregatedSeriesKey]*aggregatedSeries
+}
+
+type aggregatedSeriesKey struct {
+	tenantID string
+	series   string
+}
+
+// aggregatedSeries is the state of an output series.
+type aggregatedSeries struct {
+	labels      labels.Labels
+	aggregation string
+	counter     bool
+
+	inputs map[uint64]*aggregationInput
+
+	// total and totalHistogram are the running totals of the counter sums and histogram merges.
+	total          float64
+	totalHistogram *histogram.FloatHistogram
+
+	// value is the min or max of the samples received in the interval, if hasValue.
+	value    float64
+	hasValue bool
+}
+
+// aggregationInput is the state of an input series of an output series.
+type aggregationInput struct {
+	lastSeen int64 // Unix nanoseconds.
+	updated  bool  // Whether a sample was received in the interval.
+
+	value     float64
+	hasValue  bool
+	histogram *histogram.FloatHistogram
+}
+
+// streamingAggregationForward is a request forwarding input series to the distributor owning their output series.
+type streamingAggregationForward struct {
+	tenantID string
+	addr     string
+	req      *mimirpb.WriteRequest
+}
+
+// NewStreamingAggregator returns a new StreamingAggregator pushing the output series with push. The input series
+// are forwarded to the distributor owning their output series among the healthy instances of distributorsRing,
+// unless nil, in which case all the output series are owned by this distributor.
+func NewStreamingAggregator(cfg StreamingAggregationConfig, limits *validation.Overrides, push PushFunc, distributorsRing ring.ReadRing, instanceID string, logger log.Logger, reg prometheus.Registerer) *StreamingAggregator {
+	a := &StreamingAggregator{
+		cfg:                cfg,
+		limits:             limits,
+		push:               push,
+		ring:               distributorsRing,
+		instanceID:         instanceID,
+		logger:             logger,
+		matcher:            validation.NewMetricLimitMatcher(),
+		outputSeriesCount:  map[string]int{},
+		tenantsWithOutputs: map[string]struct{}{},
+		forwardQueue:       make(chan streamingAggregationForward, cfg.ForwardQueueCapacity),
+		inputSamples: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_distributor_streaming_aggregation_input_samples_total",
+			Help: "The total number of samples aggregated by the streaming aggregation.",
+		}, []string{"user"}),
+		discardedSamples: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_distributor_streaming_aggregation_discarded_samples_total",
+			Help: "The total number of input samples which haven't been aggregated by the streaming aggregation.",
+		}, []string{"user", "reason"}),
+		forwardedSeries: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_distributor_streaming_aggregation_forwarded_series_total",
+			Help: "The total number of input series forwarded to the distributor owning their output series.",
+		}, []string{"user"}),
+		droppedForwards: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_distributor_streaming_aggregation_forward_dropped_series_total",
+			Help: "The total number of input series which haven't been forwarded to the distributor owning their output series.",
+		}, []string{"user", "reason"}),
+		failedForwards: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_distributor_streaming_aggregation_forward_failures_total",
+			Help: "The total number of failed requests forwarding input series to the distributor owning their output series.",
+		}, []string{"user"}),
+		outputSeries: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "cortex_distributor_streaming_aggregation_output_series",
+			Help: "The number of output series whose state is kept by the streaming aggregation.",
+		}, []string{"user"}),
+		outputSamples: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_distributor_streaming_aggregation_output_samples_total",
+			Help: "The total number of samples of the output series pushed by the streaming aggregation.",
+		}, []string{"user"}),
+		failedOutputSamples: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_distributor_streaming_aggregation_failed_output_samples_total",
+			Help: "The total number of samples of the output series which failed to be pushed by the streaming aggregation.",
+		}, []string{"user"}),
+	}
+
+	for i := range a.stripes {
+		a.stripes[i].series = map[aggregatedSeriesKey]*aggregatedSeries{}
+	}
+
+	if distributorsRing != nil {
+		a.clients = newStreamingAggregationClientsPool(cfg.GRPCClientConfig, distributorsRing, logger, reg)
+	}
+
+	a.Service = services.NewTimerService(cfg.Interval, a.starting, a.iteration, a.stopping).WithName("streaming aggregation")
+	return a
+}
+
+func (a *StreamingAggregator) starting(ctx context.Context) error {
+	if a.clients == nil {
+		return nil
+	}
+	if err := services.StartAndAwaitRunning(ctx, a.clients); err != nil {
+		return err
+	}
+
+	// The workers stop when the service context is canceled, on stopping.
+	for i := 0; i < a.cfg.ForwardConcurrency; i++ {
+		a.forwardWorkers.Add(1)
+		go a.runForwardWorker(ctx)
+	}
+	return nil
+}
+
+func (a *StreamingAggregator) iteration(ctx context.Context) error {
+	a.flush(ctx, time.Now())
+	return nil
+}
+
+func (a *StreamingAggregator) stopping(_ error) error {
+	// Push what has been aggregated in the last interval.
+	a.flush(context.Background(), time.Now())
+
+	if a.clients == nil {
+		return nil
+	}
+	a.forwardWorkers.Wait()
+	return services.StopAndAwaitTerminated(context.Background(), a.clients)
+}
+
+// Aggregate aggregates the series matching the rules of the tenant, forwarding the ones whose output series are
+// owned by other distributors. It returns the indexes of the series which must be dropped, because matching
+// a rule with drop_input.
+func (a *StreamingAggregator) Aggregate(ctx context.Context, tenantID string, series []mimirpb.PreallocTimeseries) []int {
+	return a.aggregate(tenantID, series, false, time.Now())
+}
+
+// aggregate aggregates the series matching the rules of the tenant. The series forwarded by another distributor
+// are only aggregated into the output series owned by this distributor, and never forwarded again.
+func (a *StreamingAggregator) aggregate(tenantID string, series []mimirpb.PreallocTimeseries, forwarded bool, now time.Time) []int {
+	rules := a.limits.StreamingAggregationRules(tenantID)
+	if len(rules) == 0 {
+		return nil
+	}
+
+	instances := a.healthyInstances()
+
+	var (
+		dropIndexes    []int
+		forwards       = map[string]*mimirpb.WriteRequest{}
+		aggregated     int
+		discarded      int
+		lb             = labels.NewBuilder(labels.EmptyLabels())
+		forwardedOwner = map[string]struct{}{}
+	)
+
+	for tsIdx, ts := range series {
+		mimirpb.FromLabelAdaptersToBuilder(ts.Labels, lb)
+		lbls := lb.Labels()
+
+		drop := false
+		clear(forwardedOwner)
+
+		for _, rule := range rules {
+			if !a.matcher.MatchesSelector(rule.Match, lbls.Get) {
+				continue
+			}
+			drop = drop || rule.DropInput
+
+			output := streamingAggregationOutputLabels(rule, lbls, lb)
+			key := aggregatedSeriesKey{tenantID: tenantID, series: rule.Aggregation + "\xff" + strconv.FormatBool(rule.Counter) + "\xff" + output.String()}
+
+			owner, local := a.owner(key, instances)
+			switch {
+			case local:
+				if samples, ok := a.accumulate(key, rule, output, lbls.Hash(), ts.TimeSeries, now); ok {
+					aggregated += samples
+				} else {
+					discarded += samples
+				}
+			case forwarded:
+				// The series was forwarded to a distributor which doesn't own its output series, because the
+				// ring changed in between, so it's skipped.
+			default:
+				if _, ok := forwardedOwner[owner]; ok {
+					continue
+				}
+				forwardedOwner[owner] = struct{}{}
+
+				req, ok := forwards[owner]
+				if !ok {
+					req = &mimirpb.WriteRequest{}
+					forwards[owner] = req
+				}
+				// The series is copied, because the request is reused once pushed, before the series is forwarded.
+				req.Timeseries = append(req.Timeseries, mimirpb.DeepCopyTimeseries(mimirpb.PreallocTimeseries{}, ts, true, false))
+			}
+		}
+
+		if drop {
+			dropIndexes = append(dropIndexes, tsIdx)
+		}
+	}
+
+	if aggregated > 0 {
+		a.inputSamples.WithLabelValues(tenantID).Add(float64(aggregated))
+	}
+	if discarded > 0 {
+		a.discardedSamples.WithLabelValues(tenantID, reasonStreamingAggregationMaxOutputSeries).Add(float64(discarded))
+	}
+
+	a.forward(tenantID, forwards)
+	return dropIndexes
+}
+
+// healthyInstances returns the healthy distributors owning output series, or nil if the ring is disabled
+// or can't be read, in which case this distributor owns all the output series.
+func (a *StreamingAggregator) healthyInstances() []ring.InstanceDesc {
+	return healthyDistributors(a.ring)
+}
+
+// owner returns the address of the distributor owning the output series, chosen among the instances by
+// rendezvous hashing, and whether it's this distributor.
+func (a *StreamingAggregator) owner(key aggregatedSeriesKey, instances []ring.InstanceDesc) (string, bool) {
+	return rendezvousOwner(instances, a.instanceID, key.tenantID, key.series)
+}
+
+// accumulate adds the samples of the input series to the output series, and returns the number of samples
+// of the input series and whether they have been aggregated. They aren't if the output series is new and
+// the tenant reached the max number of output series.
+func (a *StreamingAggregator) accumulate(key aggregatedSeriesKey, rule validation.StreamingAggregationRule, output labels.Labels, inputHash uint64, ts *mimirpb.TimeSeries, now time.Time) (int, bool) {
+	stripe := &a.stripes[xxhash.Sum64String(key.tenantID+key.series)%streamingAggregationStripes]
+	stripe.mtx.Lock()
+	defer stripe.mtx.Unlock()
+
+	s, ok := stripe.series[key]
+	if !ok {
+		if !a.addOutputSeries(key.tenantID) {
+			return len(ts.Samples) + len(ts.Histograms), false
+		}
+		s = &aggregatedSeries{
+			labels:      mimirpb.CopyLabels(output),
+			aggregation: rule.Aggregation,
+			counter:     rule.Counter,
+			inputs:      map[uint64]*aggregationInput{},
+		}
+		stripe.series[key] = s
+	}
+
+	in, ok := s.inputs[inputHash]
+	if !ok {
+		in = &aggregationInput{}
+		s.inputs[inputHash] = in
+	}
+	in.lastSeen = now.UnixNano()
+	in.updated = true
+
+	if s.aggregation == validation.StreamingAggregationHistogramMerge {
+		for i := range ts.Histograms {
+			s.addHistogram(in, &ts.Histograms[i])
+		}
+		return len(ts.Histograms), true
+	}
+
+	if s.aggregation == validation.StreamingAggregationCount {
+		return len(ts.Samples) + len(ts.Histograms), true
+	}
+
+	for _, sample := range ts.Samples {
+		s.addSample(in, sample.Value)
+	}
+	return len(ts.Samples), true
+}
+
+// addOutputSeries accounts for a new output series of the tenant, and returns false if the tenant
+// reached the max number of output series.
+func (a *StreamingAggregator) addOutputSeries(tenantID string) bool {
+	a.outputSeriesCountMtx.Lock()
+	defer a.outputSeriesCountMtx.Unlock()
+
+	if limit := a.limits.StreamingAggregationMaxOutputSeries(tenantID); limit > 0 && a.outputSeriesCount[tenantID] >= limit {
+		return false
+	}
+	a.outputSeriesCount[tenantID]++
+	return true
+}
+
+// removeOutputSeries accounts for a removed output series of the tenant.
+func (a *StreamingAggregator) removeOutputSeries(tenantID string) {
+	a.outputSeriesCountMtx.Lock()
+	defer a.outputSeriesCountMtx.Unlock()
+
+	if a.outputSeriesCount[tenantID]--; a.outputSeriesCount[tenantID] <= 0 {
+		delete(a.outputSeriesCount, tenantID)
+	}
+}
+
+func (s *aggregatedSeries) addSample(in *aggregationInput, v float64) {
+	if value.IsStaleNaN(v) {
+		return
+	}
+
+	switch s.aggregation {
+	case validation.StreamingAggregationSum:
+		if s.counter && in.hasValue {
+			if v >= in.value {
+				s.total += v - in.value
+			} else {
+				// Counter reset: the counter restarted from zero.
+				s.total += v
+			}
+		}
+		// The first value of an input series of a counter isn't added to the running total, because its
+		// increase is unknown.
+		in.value, in.hasValue = v, true
+	case validation.StreamingAggregationMin:
+		if !s.hasValue || v < s.value {
+			s.value = v
+		}
+		s.hasValue = true
+	case validation.StreamingAggregationMax:
+		if !s.hasValue || v > s.value {
+			s.value = v
+		}
+		s.hasValue = true
+	}
+}
+
+func (s *aggregatedSeries) addHistogram(in *aggregationInput, hp *mimirpb.Histogram) {
+	var h *histogram.FloatHistogram
+	if hp.IsFloatHistogram() {
+		h = mimirpb.FromFloatHistogramProtoToFloatHistogram(hp).Copy()
+	} else {
+		h = mimirpb.FromHistogramProtoToFloatHistogram(hp).Copy()
+	}
+	if value.IsStaleNaN(h.Sum) {
+		return
+	}
+
+	if !s.counter {
+		in.histogram = h
+		return
+	}
+
+	if s.totalHistogram == nil {
+		s.totalHistogram = &histogram.FloatHistogram{Schema: h.Schema, ZeroThreshold: h.ZeroThreshold, CustomValues: h.CustomValues}
+	}
+
+	// The first histogram of an input series of a counter isn't added to the running total, because its
+	// increase is unknown.
+	if in.histogram != nil {
+		increase := h
+		if !h.DetectReset(in.histogram) {
+			var err error
+			if increase, err = h.Copy().Sub(in.histogram); err != nil {
+				increase = nil
+			}
+		}
+		if increase != nil {
+			if _, err := s.totalHistogram.Add(increase); err != nil {
+				// The histograms are incompatible, for example because of different custom buckets, so we start over.
+				s.totalHistogram = &histogram.FloatHistogram{Schema: h.Schema, ZeroThreshold: h.ZeroThreshold, CustomValues: h.CustomValues}
+			}
+		}
+	}
+	in.histogram = h
+}
+
+// flush pushes the output series updated in the interval, and removes the input series idle for longer than
+// the state idle timeout.
+func (a *StreamingAggregator) flush(ctx context.Context, now time.Time) {
+	timestamp := now.UnixMilli()
+	deadline := now.Add(-a.cfg.StateIdleTimeout).UnixNano()
+
+	outputs := map[string][]mimirpb.PreallocTimeseries{}
+	outputSeries := map[string]int{}
+
+	for i := range a.stripes {
+		stripe := &a.stripes[i]
+
+		stripe.mtx.Lock()
+		for key, s := range stripe.series {
+			if ts := s.emit(timestamp); ts != nil {
+				outputs[key.tenantID] = append(outputs[key.tenantID], mimirpb.PreallocTimeseries{TimeSeries: ts})
+			}
+
+			for hash, in := range s.inputs {
+				in.updated = false
+				if in.lastSeen < deadline {
+					delete(s.inputs, hash)
+				}
+			}
+			s.hasValue = false
+
+			if len(s.inputs) == 0 {
+				delete(stripe.series, key)
+				a.removeOutputSeries(key.tenantID)
+				continue
+			}
+			outputSeries[key.tenantID]++
+		}
+		stripe.mtx.Unlock()
+	}
+
+	for tenantID := range a.tenantsWithOutputs {
+		if _, ok := outputSeries[tenantID]; !ok {
+			a.outputSeries.DeleteLabelValues(tenantID)
+			delete(a.tenantsWithOutputs, tenantID)
+		}
+	}
+	for tenantID, count := range outputSeries {
+		a.outputSeries.WithLabelValues(tenantID).Set(float64(count))
+		a.tenantsWithOutputs[tenantID] = struct{}{}
+	}
+
+	for tenantID, series := range outputs {
+		a.pushOutputs(ctx, tenantID, series)
+	}
+}
+
+// emit returns the output time series with the aggregated value at the timestamp, or nil if none of
+// its input series received a sample in the interval.
+func (s *aggregatedSeries) emit(timestamp int64) *mimirpb.TimeSeries {
+	var (
+		updated        int
+		sum            float64
+		hasSum         bool
+		histogramTotal *histogram.FloatHistogram
+	)
+	for _, in := range s.inputs {
+		if !in.updated {
+			continue
+		}
+		updated++
+
+		if in.hasValue {
+			sum += in.value
+			hasSum = true
+		}
+		if !s.counter && in.histogram != nil {
+			if histogramTotal == nil {
+				histogramTotal = in.histogram.Copy()
+			} else if _, err := histogramTotal.Add(in.histogram); err != nil {
+				continue
+			}
+		}
+	}
+	if updated == 0 {
+		return nil
+	}
+
+	ts := &mimirpb.TimeSeries{Labels: mimirpb.FromLabelsToLabelAdapters(s.labels)}
+
+	switch s.aggregation {
+	case validation.StreamingAggregationSum:
+		switch {
+		case s.counter:
+			ts.Samples = []mimirpb.Sample{{TimestampMs: timestamp, Value: s.total}}
+		case hasSum:
+			ts.Samples = []mimirpb.Sample{{TimestampMs: timestamp, Value: sum}}
+		}
+	case validation.StreamingAggregationCount:
+		ts.Samples = []mimirpb.Sample{{TimestampMs: timestamp, Value: float64(updated)}}
+	case validation.StreamingAggregationMin, validation.StreamingAggregationMax:
+		if s.hasValue {
+			ts.Samples = []mimirpb.Sample{{TimestampMs: timestamp, Value: s.value}}
+		}
+	case validation.StreamingAggregationHistogramMerge:
+		if s.counter && s.totalHistogram != nil {
+			ts.Histograms = []mimirpb.Histogram{mimirpb.FromFloatHistogramToHistogramProto(timestamp, s.totalHistogram.Copy())}
+		} else if histogramTotal != nil {
+			histogramTotal.CounterResetHint = histogram.GaugeType
+			ts.Histograms = []mimirpb.Histogram{mimirpb.FromFloatHistogramToHistogramProto(timestamp, histogramTotal)}
+		}
+	}
+
+	if len(ts.Samples) == 0 && len(ts.Histograms) == 0 {
+		return nil
+	}
+	return ts
+}
+
+func (a *StreamingAggregator) pushOutputs(ctx context.Context, tenantID string, series []mimirpb.PreallocTimeseries) {
+	ctx, cancel := context.WithTimeout(user.InjectOrgID(ctx, tenantID), a.cfg.Interval)
+	defer cancel()
+	ctx = context.WithValue(ctx, streamingAggregationOutputKey{}, true)
+
+	samples := 0
+	for _, ts := range series {
+		samples += len(ts.Samples) + len(ts.Histograms)
+	}
+
+	req := &mimirpb.WriteRequest{Timeseries: series, Source: mimirpb.API}
+	if err := a.push(ctx, NewParsedRequest(req)); err != nil {
+		level.Warn(a.logger).Log("msg", "failed to push streaming aggregation output series", "user", tenantID, "err", err)
+		a.failedOutputSamples.WithLabelValues(tenantID).Add(float64(samples))
+		return
+	}
+	a.outputSamples.WithLabelValues(tenantID).Add(float64(samples))
+}
+
+// forward enqueues the input series to be sent to the distributors owning their output series. It never blocks:
+// the series are dropped if the queue is full. The failures are logged and tracked, but don't fail the push of
+// the input series.
+func (a *StreamingAggregator) forward(tenantID string, forwards map[string]*mimirpb.WriteRequest) {
+	dropped := 0
+	for addr, req := range forwards {
+		select {
+		case a.forwardQueue <- streamingAggregationForward{tenantID: tenantID, addr: addr, req: req}:
+		default:
+			dropped += len(req.Timeseries)
+			releaseForwardedSeries(req)
+		}
+	}
+
+	if dropped > 0 {
+		a.droppedForwards.WithLabelValues(tenantID, reasonStreamingAggregationForwardQueueFull).Add(float64(dropped))
+	}
+}
+
+// runForwardWorker sends the queued input series to the distributors owning their output series, until the context
+// is canceled. The series still queued then are dropped.
+func (a *StreamingAggregator) runForwardWorker(ctx context.Context) {
+	defer a.forwardWorkers.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case f := <-a.forwardQueue:
+			if err := a.forwardTo(ctx, f.tenantID, f.addr, f.req); err != nil {
+				level.Warn(a.logger).Log("msg", "failed to forward series to the distributor owning their streaming aggregation", "user", f.tenantID, "addr", f.addr, "err", err)
+				a.failedForwards.WithLabelValues(f.tenantID).Inc()
+			} else {
+				a.forwardedSeries.WithLabelValues(f.tenantID).Add(float64(len(f.req.Timeseries)))
+			}
+			releaseForwardedSeries(f.req)
+		}
+	}
+}
+
+func (a *StreamingAggregator) forwardTo(ctx context.Context, tenantID, addr string, req *mimirpb.WriteRequest) error {
+	ctx, cancel := context.WithTimeout(user.InjectOrgID(ctx, tenantID), a.cfg.ForwardTimeout)
+	defer cancel()
+
+	c, err := a.clients.GetClientFor(addr)
+	if err != nil {
+		return err
+	}
+	return c.(*distributorClient).conn.Invoke(ctx, streamingAggregationPushMethod, req, &mimirpb.WriteResponse{})
+}
+
+// releaseForwardedSeries returns the copies of the forwarded series to the pool.
+func releaseForwardedSeries(req *mimirpb.WriteRequest) {
+	for i := range req.Timeseries {
+		mimirpb.ReusePreallocTimeseries(&req.Timeseries[i])
+	}
+}
+
+// PushForwarded aggregates the input series forwarded by another distributor, because the output series they're
+// aggregated into are owned by this distributor. It's served by the internal gRPC service registered with
+// RegisterStreamingAggregationServer.
+func (a *StreamingAggregator) PushForwarded(ctx context.Context, req *mimirpb.WriteRequest) (*mimirpb.WriteResponse, error) {
+	defer req.FreeBuffer()
+
+	tenantID, err := tenant.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	a.aggregate(tenantID, req.Timeseries, true, time.Now())
+	return &mimirpb.WriteResponse{}, nil
+}
+
+// streamingAggregationServer is the server of the internal gRPC service receiving the forwarded input series.
+type streamingAggregationServer interface {
+	PushForwarded(context.Context, *mimirpb.WriteRequest) (*mimirpb.WriteResponse, error)
+}
+
+var streamingAggregationServiceDesc = grpc.ServiceDesc{
+	ServiceName: "distributor.StreamingAggregation",
+	HandlerType: (*streamingAggregationServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Push",
+			Handler:    streamingAggregationPushHandler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+func streamingAggregationPushHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(mimirpb.WriteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(streamingAggregationServer).PushForwarded(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: streamingAggregationPushMethod,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(streamingAggregationServer).PushForwarded(ctx, req.(*mimirpb.WriteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// RegisterStreamingAggregationServer registers the internal gRPC service receiving the input series forwarded by
+// the other distributors. It's only served over gRPC, and not exposed on the HTTP API.
+func RegisterStreamingAggregationServer(s grpc.ServiceRegistrar, a *StreamingAggregator) {
+	s.RegisterService(&streamingAggregationServiceDesc, a)
+}
+
+// cleanupTenantMetrics deletes the metrics of the tenant, once it's inactive. Its output series have expired by then.
+func (a *StreamingAggregator) cleanupTenantMetrics(tenantID string) {
+	a.inputSamples.DeleteLabelValues(tenantID)
+	a.discardedSamples.DeletePartialMatch(prometheus.Labels{"user": tenantID})
+	a.forwardedSeries.DeleteLabelValues(tenantID)
+	a.droppedForwards.DeletePartialMatch(prometheus.Labels{"user": tenantID})
+	a.failedForwards.DeleteLabelValues(tenantID)
+	a.outputSamples.DeleteLabelValues(tenantID)
+	a.failedOutputSamples.DeleteLabelValues(tenantID)
+}
+
+// streamingAggregationOutputLabels returns the labels of the output series of the rule for the input series,
+// using lb as scratch builder. When neither by nor without are set, all the labels are aggregated away.
+func streamingAggregationOutputLabels(rule validation.StreamingAggregationRule, input labels.Labels, lb *labels.Builder) labels.Labels {
+	if len(rule.Without) > 0 {
+		lb.Reset(input)
+		lb.Del(rule.Without...)
+	} else {
+		lb.Reset(labels.EmptyLabels())
+		for _, name := range rule.By {
+			if v := input.Get(name); v != "" {
+				lb.Set(name, v)
+			}
+		}
+	}
+	lb.Set(labels.MetricName, rule.Output)
+	return lb.Labels()
+}
+
+func newStreamingAggregationClientsPool(cfg grpcclient.Config, distributorsRing ring.ReadRing, logger log.Logger, reg prometheus.Registerer) *ring_client.Pool {
+	clientsCount := promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+		Name: "cortex_distributor_streaming_aggregation_clients",
+		Help: "The current number of distributor clients used to forward the input series of the streaming aggregation.",
+	})
+	return newDistributorClientsPool(cfg, distributorsRing, "distributor-streaming-aggregation", clientsCount, logger, reg)
+}
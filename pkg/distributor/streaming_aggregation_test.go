@@ -0,0 +1,422 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package distributor
+
+import (
+	"context"
+	"net"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/grafana/dskit/middleware"
+	"github.com/grafana/dskit/ring"
+	dskit_test "github.com/grafana/dskit/test"
+	"github.com/grafana/dskit/user"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/util/test"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+func TestStreamingAggregator_Aggregate(t *testing.T) {
+	type output struct {
+		labels string
+		value  float64
+	}
+
+	tests := map[string]struct {
+		rule     validation.StreamingAggregationRule
+		requests [][]mimirpb.PreallocTimeseries
+		expected [][]output
+	}{
+		"should sum gauges by the given labels": {
+			rule: validation.StreamingAggregationRule{Match: "memory_bytes", By: []string{"job"}, Output: "job:memory_bytes:sum", Aggregation: validation.StreamingAggregationSum},
+			requests: [][]mimirpb.PreallocTimeseries{
+				{
+					makeTimeseries([]string{"__name__", "memory_bytes", "job", "a", "pod", "1"}, makeSamples(1, 10), nil, nil),
+					makeTimeseries([]string{"__name__", "memory_bytes", "job", "a", "pod", "2"}, append(makeSamples(1, 5), makeSamples(2, 20)...), nil, nil),
+					makeTimeseries([]string{"__name__", "memory_bytes", "job", "b", "pod", "3"}, makeSamples(1, 1), nil, nil),
+					makeTimeseries([]string{"__name__", "other", "job", "a"}, makeSamples(1, 100), nil, nil),
+				},
+			},
+			expected: [][]output{{
+				{labels: `job:memory_bytes:sum{job="a"}`, value: 30},
+				{labels: `job:memory_bytes:sum{job="b"}`, value: 1},
+			}},
+		},
+		"should sum the increases of counters, handling counter resets": {
+			rule: validation.StreamingAggregationRule{Match: "requests_total", Without: []string{"pod"}, Output: "requests_total:sum", Aggregation: validation.StreamingAggregationSum, Counter: true},
+			requests: [][]mimirpb.PreallocTimeseries{
+				{
+					makeTimeseries([]string{"__name__", "requests_total", "job", "a", "pod", "1"}, append(makeSamples(1, 10), makeSamples(2, 15)...), nil, nil),
+					makeTimeseries([]string{"__name__", "requests_total", "job", "a", "pod", "2"}, makeSamples(1, 5), nil, nil),
+				},
+				{
+					makeTimeseries([]string{"__name__", "requests_total", "job", "a", "pod", "1"}, makeSamples(3, 3), nil, nil),
+					makeTimeseries([]string{"__name__", "requests_total", "job", "a", "pod", "2"}, makeSamples(3, 7), nil, nil),
+				},
+				{},
+			},
+			expected: [][]output{
+				{{labels: `requests_total:sum{job="a"}`, value: 5}},
+				{{labels: `requests_total:sum{job="a"}`, value: 10}},
+				nil,
+			},
+		},
+		"should count the input series": {
+			rule: validation.StreamingAggregationRule{Match: `up`, By: []string{"job"}, Output: "job:up:count", Aggregation: validation.StreamingAggregationCount},
+			requests: [][]mimirpb.PreallocTimeseries{
+				{
+					makeTimeseries([]string{"__name__", "up", "job", "a", "pod", "1"}, append(makeSamples(1, 1), makeSamples(2, 1)...), nil, nil),
+					makeTimeseries([]string{"__name__", "up", "job", "a", "pod", "2"}, makeSamples(1, 0), nil, nil),
+				},
+			},
+			expected: [][]output{{{labels: `job:up:count{job="a"}`, value: 2}}},
+		},
+		"should compute the min and max of each interval": {
+			rule: validation.StreamingAggregationRule{Match: "temperature", Output: "temperature:max", Aggregation: validation.StreamingAggregationMax},
+			requests: [][]mimirpb.PreallocTimeseries{
+				{
+					makeTimeseries([]string{"__name__", "temperature", "pod", "1"}, append(makeSamples(1, 10), makeSamples(2, 30)...), nil, nil),
+					makeTimeseries([]string{"__name__", "temperature", "pod", "2"}, makeSamples(1, 20), nil, nil),
+				},
+				{
+					makeTimeseries([]string{"__name__", "temperature", "pod", "1"}, makeSamples(3, 5), nil, nil),
+				},
+			},
+			expected: [][]output{
+				{{labels: `temperature:max`, value: 30}},
+				{{labels: `temperature:max`, value: 5}},
+			},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			pushed := &capturedOutputs{}
+			a := newTestStreamingAggregator(t, []validation.StreamingAggregationRule{testData.rule}, pushed.push)
+
+			now := time.Now()
+			for i, req := range testData.requests {
+				a.aggregate("user", req, false, now)
+				a.flush(context.Background(), now)
+				now = now.Add(time.Minute)
+
+				var actual []output
+				for _, ts := range pushed.take() {
+					require.Len(t, ts.Samples, 1)
+					actual = append(actual, output{labels: mimirpb.FromLabelAdaptersToString(ts.Labels), value: ts.Samples[0].Value})
+				}
+				sort.Slice(actual, func(i, j int) bool { return actual[i].labels < actual[j].labels })
+				assert.Equal(t, testData.expected[i], actual, "interval %d", i)
+			}
+		})
+	}
+}
+
+func TestStreamingAggregator_HistogramMerge(t *testing.T) {
+	rule := validation.StreamingAggregationRule{Match: "latency_seconds", Output: "latency_seconds:merged", Aggregation: validation.StreamingAggregationHistogramMerge, Counter: true}
+	pushed := &capturedOutputs{}
+	a := newTestStreamingAggregator(t, []validation.StreamingAggregationRule{rule}, pushed.push)
+
+	series := func(pod string, h *histogram.Histogram) mimirpb.PreallocTimeseries {
+		return makeTimeseries([]string{"__name__", "latency_seconds", "pod", pod}, nil, []mimirpb.Histogram{mimirpb.FromHistogramToHistogramProto(1, h)}, nil)
+	}
+
+	now := time.Now()
+	a.aggregate("user", []mimirpb.PreallocTimeseries{series("1", test.GenerateTestHistogram(1)), series("2", test.GenerateTestHistogram(1))}, false, now)
+	a.flush(context.Background(), now)
+
+	outputs := pushed.take()
+	require.Len(t, outputs, 1)
+	require.Len(t, outputs[0].Histograms, 1)
+	assert.Equal(t, float64(0), outputs[0].Histograms[0].GetCountFloat(), "the first histogram of each input series isn't accumulated")
+
+	// The first input series increases from 1 to 3, and the second one is reset.
+	a.aggregate("user", []mimirpb.PreallocTimeseries{series("1", test.GenerateTestHistogram(3)), series("2", test.GenerateTestHistogram(0))}, false, now)
+	a.flush(context.Background(), now.Add(time.Minute))
+
+	expected := test.GenerateTestFloatHistogram(3)
+	_, err := expected.Sub(test.GenerateTestFloatHistogram(1))
+	require.NoError(t, err)
+	_, err = expected.Add(test.GenerateTestFloatHistogram(0))
+	require.NoError(t, err)
+
+	outputs = pushed.take()
+	require.Len(t, outputs, 1)
+	require.Len(t, outputs[0].Histograms, 1)
+	actual := mimirpb.FromFloatHistogramProtoToFloatHistogram(&outputs[0].Histograms[0])
+	assert.Equal(t, expected.Count, actual.Count)
+	assert.Equal(t, expected.Sum, actual.Sum)
+}
+
+func TestStreamingAggregator_StateIdleTimeout(t *testing.T) {
+	rule := validation.StreamingAggregationRule{Match: "requests_total", Output: "requests_total:sum", Aggregation: validation.StreamingAggregationSum, Counter: true}
+	reg := prometheus.NewPedanticRegistry()
+	a := NewStreamingAggregator(testStreamingAggregationConfig(), streamingAggregationOverrides([]validation.StreamingAggregationRule{rule}), (&capturedOutputs{}).push, nil, "", log.NewNopLogger(), reg)
+
+	now := time.Now()
+	a.aggregate("user", []mimirpb.PreallocTimeseries{
+		makeTimeseries([]string{"__name__", "requests_total", "pod", "1"}, makeSamples(1, 1), nil, nil),
+	}, false, now)
+
+	a.flush(context.Background(), now)
+	assert.Equal(t, float64(1), testutil.ToFloat64(a.outputSeries.WithLabelValues("user")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(a.inputSamples.WithLabelValues("user")))
+
+	a.flush(context.Background(), now.Add(6*time.Minute))
+	assert.Equal(t, 0, testutil.CollectAndCount(a.outputSeries))
+}
+
+func TestStreamingAggregator_Owner(t *testing.T) {
+	instances := []ring.InstanceDesc{
+		{Id: "distributor-1", Addr: "1.1.1.1:9095"},
+		{Id: "distributor-2", Addr: "2.2.2.2:9095"},
+		{Id: "distributor-3", Addr: "3.3.3.3:9095"},
+	}
+
+	a := &StreamingAggregator{instanceID: "distributor-1"}
+
+	owned := map[string]int{}
+	for i := 0; i < 300; i++ {
+		key := aggregatedSeriesKey{tenantID: "user", series: labels.FromStrings("__name__", "metric", "i", string(rune('a'+i%26)), "j", string(rune('a'+i/26))).String()}
+
+		addr, local := a.owner(key, instances)
+		if local {
+			addr = "local"
+		}
+		owned[addr]++
+
+		// The owner is stable.
+		again, _ := a.owner(key, instances)
+		assert.Equal(t, addr == "local", again == "", "owner of %s", key.series)
+	}
+
+	// The output series are spread across all the instances.
+	assert.Len(t, owned, 3)
+	assert.NotContains(t, owned, "1.1.1.1:9095")
+	for addr, count := range owned {
+		assert.Greater(t, count, 50, addr)
+	}
+
+	// Without instances, all the output series are local.
+	_, local := a.owner(aggregatedSeriesKey{tenantID: "user", series: "series"}, nil)
+	assert.True(t, local)
+}
+
+func TestStreamingAggregator_Forward(t *testing.T) {
+	rule := validation.StreamingAggregationRule{Match: "memory_bytes", Output: "memory_bytes:sum", Aggregation: validation.StreamingAggregationSum}
+	pushed := &capturedOutputs{}
+	receiver := newTestStreamingAggregator(t, []validation.StreamingAggregationRule{rule}, pushed.push)
+
+	// The receiver serves the internal gRPC service, which requires a tenant.
+	server := grpc.NewServer(grpc.UnaryInterceptor(middleware.ServerUserHeaderInterceptor))
+	RegisterStreamingAggregationServer(server, receiver)
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	cfg := StreamingAggregationConfig{}
+	flagext.DefaultValues(&cfg)
+	cfg.ForwardQueueCapacity = 1
+	reg := prometheus.NewPedanticRegistry()
+	sender := NewStreamingAggregator(cfg, streamingAggregationOverrides([]validation.StreamingAggregationRule{rule}), (&capturedOutputs{}).push, nil, "", log.NewNopLogger(), reg)
+	sender.clients = newStreamingAggregationClientsPool(cfg.GRPCClientConfig, nil, log.NewNopLogger(), reg)
+	t.Cleanup(func() { sender.clients.RemoveClientFor(listener.Addr().String()) })
+
+	series := []mimirpb.PreallocTimeseries{
+		makeTimeseries([]string{"__name__", "memory_bytes", "pod", "1"}, makeSamples(1, 10), nil, nil),
+		makeTimeseries([]string{"__name__", "memory_bytes", "pod", "2"}, makeSamples(1, 5), nil, nil),
+	}
+
+	// The series are enqueued, without waiting for them to be sent. The series which don't fit the queue are dropped.
+	sender.forward("user", map[string]*mimirpb.WriteRequest{listener.Addr().String(): {Timeseries: []mimirpb.PreallocTimeseries{
+		mimirpb.DeepCopyTimeseries(mimirpb.PreallocTimeseries{}, series[0], true, false),
+		mimirpb.DeepCopyTimeseries(mimirpb.PreallocTimeseries{}, series[1], true, false),
+	}}})
+	sender.forward("user", map[string]*mimirpb.WriteRequest{listener.Addr().String(): {Timeseries: []mimirpb.PreallocTimeseries{
+		mimirpb.DeepCopyTimeseries(mimirpb.PreallocTimeseries{}, series[0], true, false),
+	}}})
+	assert.Equal(t, float64(1), testutil.ToFloat64(sender.droppedForwards.WithLabelValues("user", reasonStreamingAggregationForwardQueueFull)))
+	require.Len(t, sender.forwardQueue, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sender.forwardWorkers.Add(1)
+	go sender.runForwardWorker(ctx)
+	dskit_test.Poll(t, 5*time.Second, float64(2), func() interface{} {
+		return testutil.ToFloat64(sender.forwardedSeries.WithLabelValues("user"))
+	})
+	cancel()
+	sender.forwardWorkers.Wait()
+	assert.Equal(t, float64(0), testutil.ToFloat64(sender.failedForwards.WithLabelValues("user")))
+
+	receiver.flush(context.Background(), time.Now())
+	outputs := pushed.take()
+	require.Len(t, outputs, 1)
+	assert.Equal(t, `memory_bytes:sum`, mimirpb.FromLabelAdaptersToString(outputs[0].Labels))
+	assert.Equal(t, float64(15), outputs[0].Samples[0].Value)
+
+	t.Run("should reject the forwarded series without tenant", func(t *testing.T) {
+		_, err := receiver.PushForwarded(context.Background(), &mimirpb.WriteRequest{Timeseries: series})
+		require.Error(t, err)
+	})
+}
+
+func TestStreamingAggregator_MaxOutputSeries(t *testing.T) {
+	rule := validation.StreamingAggregationRule{Match: "memory_bytes", By: []string{"job"}, Output: "job:memory_bytes:sum", Aggregation: validation.StreamingAggregationSum}
+	limits := validation.MockOverrides(func(defaults *validation.Limits, _ map[string]*validation.Limits) {
+		defaults.StreamingAggregationRules = []validation.StreamingAggregationRule{rule}
+		defaults.StreamingAggregationMaxOutputSeries = 1
+	})
+	pushed := &capturedOutputs{}
+	a := NewStreamingAggregator(testStreamingAggregationConfig(), limits, pushed.push, nil, "", log.NewNopLogger(), prometheus.NewPedanticRegistry())
+
+	now := time.Now()
+	a.aggregate("user", []mimirpb.PreallocTimeseries{
+		makeTimeseries([]string{"__name__", "memory_bytes", "job", "a", "pod", "1"}, makeSamples(1, 10), nil, nil),
+		makeTimeseries([]string{"__name__", "memory_bytes", "job", "a", "pod", "2"}, makeSamples(1, 5), nil, nil),
+		makeTimeseries([]string{"__name__", "memory_bytes", "job", "b", "pod", "1"}, append(makeSamples(1, 1), makeSamples(2, 2)...), nil, nil),
+	}, false, now)
+	a.aggregate("other", []mimirpb.PreallocTimeseries{
+		makeTimeseries([]string{"__name__", "memory_bytes", "job", "b", "pod", "1"}, makeSamples(1, 1), nil, nil),
+	}, false, now)
+
+	// The samples of the input series of a new output series above the limit aren't aggregated.
+	assert.Equal(t, float64(2), testutil.ToFloat64(a.discardedSamples.WithLabelValues("user", reasonStreamingAggregationMaxOutputSeries)))
+	assert.Equal(t, float64(2), testutil.ToFloat64(a.inputSamples.WithLabelValues("user")))
+	a.flush(context.Background(), now)
+	outputs := pushed.take()
+	require.Len(t, outputs, 2)
+	sort.Slice(outputs, func(i, j int) bool { return outputs[i].Samples[0].Value > outputs[j].Samples[0].Value })
+	assert.Equal(t, `job:memory_bytes:sum{job="a"}`, mimirpb.FromLabelAdaptersToString(outputs[0].Labels))
+	assert.Equal(t, `job:memory_bytes:sum{job="b"}`, mimirpb.FromLabelAdaptersToString(outputs[1].Labels), "the limit applies to each tenant")
+
+	// Once the output series has expired, another one can be created.
+	a.flush(context.Background(), now.Add(6*time.Minute))
+	a.aggregate("user", []mimirpb.PreallocTimeseries{
+		makeTimeseries([]string{"__name__", "memory_bytes", "job", "b", "pod", "1"}, makeSamples(3, 3), nil, nil),
+	}, false, now.Add(7*time.Minute))
+	assert.Equal(t, float64(2), testutil.ToFloat64(a.discardedSamples.WithLabelValues("user", reasonStreamingAggregationMaxOutputSeries)))
+	a.flush(context.Background(), now.Add(7*time.Minute))
+	outputs = pushed.take()
+	require.Len(t, outputs, 1)
+	assert.Equal(t, `job:memory_bytes:sum{job="b"}`, mimirpb.FromLabelAdaptersToString(outputs[0].Labels))
+}
+
+func TestDistributor_prePushStreamingAggregationMiddleware(t *testing.T) {
+	rules := []validation.StreamingAggregationRule{
+		{Match: "requests_total", By: []string{"job"}, Output: "job:requests_total:sum", Aggregation: validation.StreamingAggregationSum, Counter: true, DropInput: true},
+		{Match: "memory_bytes", Output: "memory_bytes:max", Aggregation: validation.StreamingAggregationMax},
+	}
+	limits := streamingAggregationOverrides(rules)
+
+	var received [][]string
+	next := func(_ context.Context, pushReq *Request) error {
+		req, err := pushReq.WriteRequest()
+		require.NoError(t, err)
+
+		var names []string
+		for _, ts := range req.Timeseries {
+			names = append(names, mimirpb.FromLabelAdaptersToLabels(ts.Labels).Get(labels.MetricName))
+		}
+		received = append(received, names)
+		return nil
+	}
+
+	d := &Distributor{limits: limits}
+	push := d.prePushStreamingAggregationMiddleware(next)
+	d.StreamingAggregator = NewStreamingAggregator(testStreamingAggregationConfig(), limits, push, nil, "", log.NewNopLogger(), prometheus.NewPedanticRegistry())
+
+	ctx := user.InjectOrgID(context.Background(), "user")
+	req := &mimirpb.WriteRequest{Timeseries: []mimirpb.PreallocTimeseries{
+		makeTimeseries([]string{"__name__", "requests_total", "job", "a", "pod", "1"}, makeSamples(1, 1), nil, nil),
+		makeTimeseries([]string{"__name__", "memory_bytes", "job", "a", "pod", "1"}, makeSamples(1, 1), nil, nil),
+		makeTimeseries([]string{"__name__", "up", "job", "a", "pod", "1"}, makeSamples(1, 1), nil, nil),
+	}}
+	require.NoError(t, push(ctx, NewParsedRequest(req)))
+
+	// The input series of the rule dropping its input are removed.
+	require.Len(t, received, 1)
+	assert.Equal(t, []string{"memory_bytes", "up"}, received[0])
+
+	// The output series are pushed through the middleware without being aggregated again, nor dropped.
+	d.StreamingAggregator.flush(context.Background(), time.Now())
+	require.Len(t, received, 2)
+	sort.Strings(received[1])
+	assert.Equal(t, []string{"job:requests_total:sum", "memory_bytes:max"}, received[1])
+	assert.Equal(t, float64(2), testutil.ToFloat64(d.StreamingAggregator.outputSamples.WithLabelValues("user")))
+}
+
+func TestStreamingAggregationConfig_Validate(t *testing.T) {
+	cfg := testStreamingAggregationConfig()
+	require.NoError(t, cfg.Validate())
+
+	cfg.Interval = 0
+	require.ErrorIs(t, cfg.Validate(), errInvalidStreamingAggregationInterval)
+
+	cfg = testStreamingAggregationConfig()
+	cfg.StateIdleTimeout = cfg.Interval
+	require.ErrorIs(t, cfg.Validate(), errInvalidStreamingAggregationStateIdleTimeout)
+
+	cfg = testStreamingAggregationConfig()
+	cfg.ForwardQueueCapacity = 0
+	require.ErrorIs(t, cfg.Validate(), errInvalidStreamingAggregationForwardQueue)
+
+	cfg.Enabled = false
+	require.NoError(t, cfg.Validate())
+}
+
+type capturedOutputs struct {
+	series []mimirpb.PreallocTimeseries
+}
+
+func (c *capturedOutputs) push(ctx context.Context, pushReq *Request) error {
+	if !isStreamingAggregationOutput(ctx) {
+		return nil
+	}
+	req, err := pushReq.WriteRequest()
+	if err != nil {
+		return err
+	}
+	c.series = append(c.series, req.Timeseries...)
+	return nil
+}
+
+func (c *capturedOutputs) take() []mimirpb.PreallocTimeseries {
+	series := c.series
+	c.series = nil
+	return series
+}
+
+func testStreamingAggregationConfig() StreamingAggregationConfig {
+	return StreamingAggregationConfig{
+		Enabled:              true,
+		Interval:             time.Minute,
+		StateIdleTimeout:     5 * time.Minute,
+		ForwardTimeout:       time.Second,
+		ForwardQueueCapacity: 10,
+		ForwardConcurrency:   1,
+	}
+}
+
+func streamingAggregationOverrides(rules []validation.StreamingAggregationRule) *validation.Overrides {
+	return validation.MockOverrides(func(defaults *validation.Limits, _ map[string]*validation.Limits) {
+		defaults.StreamingAggregationRules = rules
+	})
+}
+
+func newTestStreamingAggregator(t *testing.T, rules []validation.StreamingAggregationRule, push PushFunc) *StreamingAggregator {
+	t.Helper()
+	return NewStreamingAggregator(testStreamingAggregationConfig(), streamingAggregationOverrides(rules), push, nil, "", log.NewNopLogger(), prometheus.NewPedanticRegistry())
+}
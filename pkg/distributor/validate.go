@@ -10,11 +10,14 @@ import (
 	"fmt"
 	"slices"
 	"strings"
+	"sync"
 	"time"
 	"unicode"
 	"unicode/utf8"
 
+	"github.com/cespare/xxhash/v2"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/common/model"
 
 	"github.com/grafana/mimir/pkg/costattribution"
@@ -28,6 +31,12 @@ const (
 	// The combined length of the label names and values of an Exemplar's LabelSet MUST NOT exceed 128 UTF-8 characters
 	// https://github.com/OpenObservability/OpenMetrics/blob/main/specification/OpenMetrics.md#exemplars
 	ExemplarMaxLabelSetLength = 128
+
+	// truncatedLabelHashSuffixLength is the length of the suffix appended to the truncated label names and values:
+	// an underscore followed by the hexadecimal hash of the full label name or value.
+	truncatedLabelHashSuffixLength = 1 + 16
+
+	metricSchemasConfigMsgSuffix = ". To adjust the related per-tenant limit, configure metric_schemas in the runtime configuration, or contact your service administrator."
 )
 
 var (
@@ -46,6 +55,9 @@ var (
 	reasonTooFarInFuture               = globalerror.SampleTooFarInFuture.LabelValue()
 	reasonTooFarInPast                 = globalerror.SampleTooFarInPast.LabelValue()
 	reasonDuplicateTimestamp           = globalerror.SampleDuplicateTimestamp.LabelValue()
+	reasonMetricNotInSchema            = globalerror.MetricNotInSchema.LabelValue()
+	reasonLabelNotInSchema             = globalerror.LabelNotInSchema.LabelValue()
+	reasonMetricSchemaTypeMismatch     = globalerror.MetricSchemaTypeMismatch.LabelValue()
 
 	// Discarded exemplars reasons.
 	reasonExemplarLabelsMissing               = globalerror.ExemplarLabelsMissing.LabelValue()
@@ -55,6 +67,8 @@ var (
 	reasonExemplarTooOld                      = "exemplar_too_old"
 	reasonExemplarTooFarInFuture              = "exemplar_too_far_in_future"
 	reasonTooManyExemplarsPerSeriesPerRequest = "too_many_exemplars_per_series_per_request"
+	reasonExemplarSampledOut                  = "exemplar_sampled_out"
+	reasonExemplarPolicyQuotaExceeded         = "exemplar_policy_quota_exceeded"
 
 	// Discarded metadata reasons.
 	reasonMetadataMetricNameTooLong = globalerror.MetricMetadataMetricNameTooLong.LabelValue()
@@ -67,6 +81,10 @@ var (
 	// reasonTooManyHAClusters is one of the reasons for discarding samples.
 	reasonTooManyHAClusters = "too_many_ha_clusters"
 
+	// reasonMetricRateLimited is the prefix of the reasons for discarding the samples of the series exceeding the
+	// ingestion rate limit of a metric limit. The reason is suffixed with the selector of the limit.
+	reasonMetricRateLimited = "metric_rate_limited"
+
 	labelNameTooLongMsgFormat = globalerror.SeriesLabelNameTooLong.MessageWithPerTenantLimitConfig(
 		"received a series whose label name length exceeds the limit, label: '%.200s' series: '%.200s'",
 		validation.MaxLabelNameLengthFlag,
@@ -120,6 +138,15 @@ var (
 		"received a metric metadata whose unit name length exceeds the limit, unit: '%.200s' metric name: '%.200s'",
 		validation.MaxMetadataLengthFlag,
 	)
+	metricNotInSchemaMsgFormat = globalerror.MetricNotInSchema.Message(
+		"received a series whose metric name is not in the metric schemas, metric: '%.200s'",
+	) + metricSchemasConfigMsgSuffix
+	labelNotInSchemaMsgFormat = globalerror.LabelNotInSchema.Message(
+		"received a series with a label name not allowed by the metric schema, label: '%.200s' series: '%.200s'",
+	) + metricSchemasConfigMsgSuffix
+	metricSchemaTypeMismatchMsgFormat = globalerror.MetricSchemaTypeMismatch.Message(
+		"received a series whose samples don't match the type of the metric schema, type: '%s' series: '%.200s'",
+	) + metricSchemasConfigMsgSuffix
 	nativeHistogramCustomBucketsNotReducibleMsgFormat = globalerror.NativeHistogramCustomBucketsNotReducible.Message("received a native histogram sample with more custom buckets than the limit, timestamp: %d series: %s, buckets: %d, limit: %d")
 )
 
@@ -158,6 +185,11 @@ type sampleValidationMetrics struct {
 	tooFarInFuture               *prometheus.CounterVec
 	tooFarInPast                 *prometheus.CounterVec
 	duplicateTimestamp           *prometheus.CounterVec
+	metricNotInSchema            *prometheus.CounterVec
+	labelNotInSchema             *prometheus.CounterVec
+	metricSchemaTypeMismatch     *prometheus.CounterVec
+	labelNamesTruncated          *prometheus.CounterVec
+	labelValuesTruncated         *prometheus.CounterVec
 }
 
 func (m *sampleValidationMetrics) deleteUserMetrics(userID string) {
@@ -176,6 +208,11 @@ func (m *sampleValidationMetrics) deleteUserMetrics(userID string) {
 	m.tooFarInFuture.DeletePartialMatch(filter)
 	m.tooFarInPast.DeletePartialMatch(filter)
 	m.duplicateTimestamp.DeletePartialMatch(filter)
+	m.metricNotInSchema.DeletePartialMatch(filter)
+	m.labelNotInSchema.DeletePartialMatch(filter)
+	m.metricSchemaTypeMismatch.DeletePartialMatch(filter)
+	m.labelNamesTruncated.DeletePartialMatch(filter)
+	m.labelValuesTruncated.DeletePartialMatch(filter)
 }
 
 func (m *sampleValidationMetrics) deleteUserMetricsForGroup(userID, group string) {
@@ -193,6 +230,11 @@ func (m *sampleValidationMetrics) deleteUserMetricsForGroup(userID, group string
 	m.tooFarInFuture.DeleteLabelValues(userID, group)
 	m.tooFarInPast.DeleteLabelValues(userID, group)
 	m.duplicateTimestamp.DeleteLabelValues(userID, group)
+	m.metricNotInSchema.DeleteLabelValues(userID, group)
+	m.labelNotInSchema.DeleteLabelValues(userID, group)
+	m.metricSchemaTypeMismatch.DeleteLabelValues(userID, group)
+	m.labelNamesTruncated.DeleteLabelValues(userID, group)
+	m.labelValuesTruncated.DeleteLabelValues(userID, group)
 }
 
 func newSampleValidationMetrics(r prometheus.Registerer) *sampleValidationMetrics {
@@ -211,6 +253,17 @@ func newSampleValidationMetrics(r prometheus.Registerer) *sampleValidationMetric
 		tooFarInFuture:               validation.DiscardedSamplesCounter(r, reasonTooFarInFuture),
 		tooFarInPast:                 validation.DiscardedSamplesCounter(r, reasonTooFarInPast),
 		duplicateTimestamp:           validation.DiscardedSamplesCounter(r, reasonDuplicateTimestamp),
+		metricNotInSchema:            validation.DiscardedSamplesCounter(r, reasonMetricNotInSchema),
+		labelNotInSchema:             validation.DiscardedSamplesCounter(r, reasonLabelNotInSchema),
+		metricSchemaTypeMismatch:     validation.DiscardedSamplesCounter(r, reasonMetricSchemaTypeMismatch),
+		labelNamesTruncated: promauto.With(r).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_distributor_label_names_truncated_total",
+			Help: "The total number of label names truncated because longer than the maximum length.",
+		}, []string{"user", "group"}),
+		labelValuesTruncated: promauto.With(r).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_distributor_label_values_truncated_total",
+			Help: "The total number of label values truncated because longer than the maximum length.",
+		}, []string{"user", "group"}),
 	}
 }
 
@@ -223,6 +276,8 @@ type exemplarValidationMetrics struct {
 	tooOld           *prometheus.CounterVec
 	tooFarInFuture   *prometheus.CounterVec
 	tooManyExemplars *prometheus.CounterVec
+	sampledOut       *prometheus.CounterVec
+	quotaExceeded    *prometheus.CounterVec
 }
 
 func (m *exemplarValidationMetrics) deleteUserMetrics(userID string) {
@@ -233,6 +288,8 @@ func (m *exemplarValidationMetrics) deleteUserMetrics(userID string) {
 	m.tooOld.DeleteLabelValues(userID)
 	m.tooFarInFuture.DeleteLabelValues(userID)
 	m.tooManyExemplars.DeleteLabelValues(userID)
+	m.sampledOut.DeleteLabelValues(userID)
+	m.quotaExceeded.DeleteLabelValues(userID)
 }
 
 func newExemplarValidationMetrics(r prometheus.Registerer) *exemplarValidationMetrics {
@@ -244,6 +301,8 @@ func newExemplarValidationMetrics(r prometheus.Registerer) *exemplarValidationMe
 		tooOld:           validation.DiscardedExemplarsCounter(r, reasonExemplarTooOld),
 		tooFarInFuture:   validation.DiscardedExemplarsCounter(r, reasonExemplarTooFarInFuture),
 		tooManyExemplars: validation.DiscardedExemplarsCounter(r, reasonTooManyExemplarsPerSeriesPerRequest),
+		sampledOut:       validation.DiscardedExemplarsCounter(r, reasonExemplarSampledOut),
+		quotaExceeded:    validation.DiscardedExemplarsCounter(r, reasonExemplarPolicyQuotaExceeded),
 	}
 }
 
@@ -390,6 +449,8 @@ type labelValidationConfig interface {
 	MaxLabelNamesPerInfoSeries(userID string) int
 	MaxLabelNameLength(userID string) int
 	MaxLabelValueLength(userID string) int
+	LabelNameTooLongStrategy(userID string) string
+	LabelValueTooLongStrategy(userID string) string
 }
 
 func removeNonASCIIChars(in string) (out string) {
@@ -445,6 +506,8 @@ func validateLabels(m *sampleValidationMetrics, cfg labelValidationConfig, userI
 
 	maxLabelNameLength := cfg.MaxLabelNameLength(userID)
 	maxLabelValueLength := cfg.MaxLabelValueLength(userID)
+	truncateLabels(m, cfg, userID, group, ls, maxLabelNameLength, maxLabelValueLength)
+
 	lastLabelName := ""
 	for _, l := range ls {
 		if !skipLabelValidation && !model.LabelName(l.Name).IsValid() {
@@ -474,6 +537,183 @@ func validateLabels(m *sampleValidationMetrics, cfg labelValidationConfig, userI
 	return nil
 }
 
+// truncateLabels truncates the label names and values longer than the maximum lengths, if the tenant's strategy
+// is to truncate them. The metric name is never truncated. The labels are sorted again if a label name is truncated.
+func truncateLabels(m *sampleValidationMetrics, cfg labelValidationConfig, userID, group string, ls []mimirpb.LabelAdapter, maxLabelNameLength, maxLabelValueLength int) {
+	truncateNames := cfg.LabelNameTooLongStrategy(userID) == validation.LabelTooLongStrategyTruncate
+	truncateValues := cfg.LabelValueTooLongStrategy(userID) == validation.LabelTooLongStrategyTruncate
+	if !truncateNames && !truncateValues {
+		return
+	}
+
+	namesTruncated := false
+	for i, l := range ls {
+		if truncateNames && len(l.Name) > maxLabelNameLength {
+			if name, ok := truncateLabel(l.Name, maxLabelNameLength); ok {
+				ls[i].Name = name
+				namesTruncated = true
+				m.labelNamesTruncated.WithLabelValues(userID, group).Inc()
+			}
+		}
+		if truncateValues && len(l.Value) > maxLabelValueLength && l.Name != model.MetricNameLabel {
+			if value, ok := truncateLabel(l.Value, maxLabelValueLength); ok {
+				ls[i].Value = value
+				m.labelValuesTruncated.WithLabelValues(userID, group).Inc()
+			}
+		}
+	}
+
+	if namesTruncated {
+		slices.SortFunc(ls, func(a, b mimirpb.LabelAdapter) int {
+			return strings.Compare(a.Name, b.Name)
+		})
+	}
+}
+
+// truncateLabel truncates s to maxLength bytes, replacing its end with a hash of s so that distinct long strings
+// sharing the same prefix stay distinct. It returns false if maxLength is too short to fit the hash.
+func truncateLabel(s string, maxLength int) (string, bool) {
+	if maxLength <= truncatedLabelHashSuffixLength {
+		return s, false
+	}
+
+	end := maxLength - truncatedLabelHashSuffixLength
+	// Don't split a multi-byte character.
+	for end > 0 && !utf8.RuneStart(s[end]) {
+		end--
+	}
+	return fmt.Sprintf("%s_%016x", s[:end], xxhash.Sum64String(s)), true
+}
+
+// classicHistogramSuffixes are the suffixes of the series of the classic histograms and summaries, which are
+// matched against the metric schema of the metric family.
+var classicHistogramSuffixes = []string{"_bucket", "_sum", "_count"}
+
+// newMetricSchemaIndex indexes the metric schemas by metric name.
+func newMetricSchemaIndex(schemas []validation.MetricSchema) map[string]validation.MetricSchema {
+	index := make(map[string]validation.MetricSchema, len(schemas))
+	for _, s := range schemas {
+		index[s.MetricName] = s
+	}
+	return index
+}
+
+// metricSchemaIndexCache caches the index of the metric schemas of each tenant, rebuilt when its schemas change.
+type metricSchemaIndexCache struct {
+	mtx     sync.RWMutex
+	indexes map[string]cachedMetricSchemaIndex
+}
+
+// cachedMetricSchemaIndex is the index of the metric schemas of a tenant. The limits aren't modified once loaded
+// and are replaced when reloaded, so the schemas the index has been built from are identified by the first element
+// and the length of their slice, instead of being compared on each push.
+type cachedMetricSchemaIndex struct {
+	first *validation.MetricSchema
+	count int
+	index map[string]validation.MetricSchema
+}
+
+func newMetricSchemaIndexCache() *metricSchemaIndexCache {
+	return &metricSchemaIndexCache{indexes: map[string]cachedMetricSchemaIndex{}}
+}
+
+// get returns the index of the metric schemas of the tenant, or nil if the tenant has none.
+func (c *metricSchemaIndexCache) get(userID string, schemas []validation.MetricSchema) map[string]validation.MetricSchema {
+	if len(schemas) == 0 {
+		return nil
+	}
+
+	c.mtx.RLock()
+	cached, ok := c.indexes[userID]
+	c.mtx.RUnlock()
+	if ok && cached.first == &schemas[0] && cached.count == len(schemas) {
+		return cached.index
+	}
+
+	cached = cachedMetricSchemaIndex{
+		first: &schemas[0],
+		count: len(schemas),
+		index: newMetricSchemaIndex(schemas),
+	}
+	c.mtx.Lock()
+	c.indexes[userID] = cached
+	c.mtx.Unlock()
+	return cached.index
+}
+
+func (c *metricSchemaIndexCache) cleanupTenant(userID string) {
+	c.mtx.Lock()
+	delete(c.indexes, userID)
+	c.mtx.Unlock()
+}
+
+// lookupMetricSchema returns the metric schema of the series with the given metric name, and the suffix of the
+// series if it's a series of a classic histogram or summary.
+func lookupMetricSchema(schemas map[string]validation.MetricSchema, metricName string) (schema validation.MetricSchema, suffix string, ok bool) {
+	if schema, ok = schemas[metricName]; ok {
+		return schema, "", true
+	}
+	for _, suffix = range classicHistogramSuffixes {
+		family, found := strings.CutSuffix(metricName, suffix)
+		if !found {
+			continue
+		}
+		schema, ok = schemas[family]
+		switch {
+		case !ok:
+			continue
+		case schema.Type == string(model.MetricTypeHistogram):
+			return schema, suffix, true
+		case schema.Type == string(model.MetricTypeSummary) && suffix != "_bucket":
+			return schema, suffix, true
+		}
+	}
+	return validation.MetricSchema{}, "", false
+}
+
+// validateMetricSchema returns an error if the series doesn't conform to the metric schemas of the tenant,
+// indexed by metric name. The returned error doesn't retain the series labels.
+func validateMetricSchema(m *sampleValidationMetrics, schemas map[string]validation.MetricSchema, userID, group string, ts *mimirpb.PreallocTimeseries, cat *costattribution.SampleTracker, now time.Time) error {
+	samples := float64(len(ts.Samples) + len(ts.Histograms))
+
+	unsafeMetricName, err := extract.UnsafeMetricNameFromLabelAdapters(ts.Labels)
+	if err != nil {
+		// The series have already been validated, so this shouldn't happen.
+		return err
+	}
+
+	schema, suffix, ok := lookupMetricSchema(schemas, unsafeMetricName)
+	if !ok {
+		cat.IncrementDiscardedSamples(ts.Labels, samples, reasonMetricNotInSchema, now)
+		m.metricNotInSchema.WithLabelValues(userID, group).Add(samples)
+		return fmt.Errorf(metricNotInSchemaMsgFormat, unsafeMetricName)
+	}
+
+	for _, l := range ts.Labels {
+		switch {
+		case l.Name == model.MetricNameLabel:
+		case l.Name == model.BucketLabel && suffix == "_bucket":
+		case l.Name == model.QuantileLabel && schema.Type == string(model.MetricTypeSummary) && suffix == "":
+		case slices.Contains(schema.LabelNames, l.Name):
+		default:
+			cat.IncrementDiscardedSamples(ts.Labels, samples, reasonLabelNotInSchema, now)
+			m.labelNotInSchema.WithLabelValues(userID, group).Add(samples)
+			return fmt.Errorf(labelNotInSchemaMsgFormat, l.Name, mimirpb.FromLabelAdaptersToString(ts.Labels))
+		}
+	}
+
+	if schema.Type == "" {
+		return nil
+	}
+	isHistogram := schema.Type == string(model.MetricTypeHistogram)
+	if (len(ts.Histograms) > 0 && !isHistogram) || (len(ts.Samples) > 0 && isHistogram && suffix == "") {
+		cat.IncrementDiscardedSamples(ts.Labels, samples, reasonMetricSchemaTypeMismatch, now)
+		m.metricSchemaTypeMismatch.WithLabelValues(userID, group).Add(samples)
+		return fmt.Errorf(metricSchemaTypeMismatchMsgFormat, schema.Type, mimirpb.FromLabelAdaptersToString(ts.Labels))
+	}
+	return nil
+}
+
 // metadataValidationMetrics is a collection of metrics used by metadata validation.
 type metadataValidationMetrics struct {
 	missingMetricName *prometheus.CounterVec
@@ -9,11 +9,13 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 	"unicode/utf8"
 
+	"github.com/cespare/xxhash/v2"
 	"github.com/go-kit/log"
 	"github.com/gogo/protobuf/proto"
 	"github.com/grafana/dskit/grpcutil"
@@ -37,6 +39,8 @@ type validateLabelsCfg struct {
 	maxLabelNamesPerInfoSeries int
 	maxLabelNameLength         int
 	maxLabelValueLength        int
+	labelNameTooLongStrategy   string
+	labelValueTooLongStrategy  string
 }
 
 func (v validateLabelsCfg) MaxLabelNamesPerSeries(_ string) int {
@@ -55,6 +59,14 @@ func (v validateLabelsCfg) MaxLabelValueLength(_ string) int {
 	return v.maxLabelValueLength
 }
 
+func (v validateLabelsCfg) LabelNameTooLongStrategy(_ string) string {
+	return v.labelNameTooLongStrategy
+}
+
+func (v validateLabelsCfg) LabelValueTooLongStrategy(_ string) string {
+	return v.labelValueTooLongStrategy
+}
+
 type validateMetadataCfg struct {
 	enforceMetadataMetricName bool
 	maxMetadataLength         int
@@ -488,6 +500,220 @@ func TestValidateLabelDuplication(t *testing.T) {
 	assert.Equal(t, expected, actual)
 }
 
+func TestValidateLabelsTruncation(t *testing.T) {
+	ts := time.Now()
+	userID := "testUser"
+	longName := "a_label_name_longer_than_the_limit"
+	longValue := "a label value longer than the limit"
+	longMetricName := "a_metric_name_longer_than_the_limit"
+
+	cfg := validateLabelsCfg{
+		maxLabelNamesPerSeries:    10,
+		maxLabelNameLength:        25,
+		maxLabelValueLength:       25,
+		labelNameTooLongStrategy:  validation.LabelTooLongStrategyTruncate,
+		labelValueTooLongStrategy: validation.LabelTooLongStrategyTruncate,
+	}
+
+	t.Run("label names and values longer than the limit are truncated with a hash suffix", func(t *testing.T) {
+		reg := prometheus.NewPedanticRegistry()
+		ls := []mimirpb.LabelAdapter{
+			{Name: model.MetricNameLabel, Value: "foo"},
+			{Name: longName, Value: "bar"},
+			{Name: "a_label", Value: longValue},
+			{Name: "b", Value: longValue + " suffix"},
+		}
+
+		require.NoError(t, validateLabels(newSampleValidationMetrics(reg), cfg, userID, "group", ls, false, false, nil, ts))
+
+		truncatedName := fmt.Sprintf("a_label__%016x", xxhash.Sum64String(longName))
+		assert.Equal(t, []mimirpb.LabelAdapter{
+			{Name: model.MetricNameLabel, Value: "foo"},
+			{Name: "a_label", Value: fmt.Sprintf("a label _%016x", xxhash.Sum64String(longValue))},
+			{Name: truncatedName, Value: "bar"},
+			{Name: "b", Value: fmt.Sprintf("a label _%016x", xxhash.Sum64String(longValue+" suffix"))},
+		}, ls)
+		for _, l := range ls {
+			assert.LessOrEqual(t, len(l.Name), cfg.maxLabelNameLength)
+			assert.LessOrEqual(t, len(l.Value), cfg.maxLabelValueLength)
+		}
+
+		require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+			# HELP cortex_distributor_label_names_truncated_total The total number of label names truncated because longer than the maximum length.
+			# TYPE cortex_distributor_label_names_truncated_total counter
+			cortex_distributor_label_names_truncated_total{group="group",user="testUser"} 1
+			# HELP cortex_distributor_label_values_truncated_total The total number of label values truncated because longer than the maximum length.
+			# TYPE cortex_distributor_label_values_truncated_total counter
+			cortex_distributor_label_values_truncated_total{group="group",user="testUser"} 2
+		`), "cortex_distributor_label_names_truncated_total", "cortex_distributor_label_values_truncated_total"))
+	})
+
+	t.Run("multi-byte characters are not split", func(t *testing.T) {
+		value := "x" + strings.Repeat("é", 20)
+		ls := []mimirpb.LabelAdapter{
+			{Name: model.MetricNameLabel, Value: "foo"},
+			{Name: "a", Value: value},
+		}
+
+		require.NoError(t, validateLabels(newSampleValidationMetrics(nil), cfg, userID, "", ls, false, false, nil, ts))
+		assert.Equal(t, fmt.Sprintf("xééé_%016x", xxhash.Sum64String(value)), ls[1].Value)
+	})
+
+	t.Run("metric name is not truncated", func(t *testing.T) {
+		ls := []mimirpb.LabelAdapter{
+			{Name: model.MetricNameLabel, Value: longMetricName},
+		}
+
+		err := validateLabels(newSampleValidationMetrics(nil), cfg, userID, "", ls, false, false, nil, ts)
+		assert.Equal(t, LabelValueTooLongError{Label: ls[0], Series: ls, Limit: cfg.maxLabelValueLength}, err)
+	})
+
+	t.Run("series is rejected if the limit is too short to fit the hash suffix", func(t *testing.T) {
+		cfg := cfg
+		cfg.maxLabelValueLength = truncatedLabelHashSuffixLength
+		ls := []mimirpb.LabelAdapter{
+			{Name: model.MetricNameLabel, Value: "foo"},
+			{Name: "a", Value: longValue},
+		}
+
+		err := validateLabels(newSampleValidationMetrics(nil), cfg, userID, "", ls, false, false, nil, ts)
+		assert.Equal(t, LabelValueTooLongError{Label: ls[1], Series: ls, Limit: cfg.maxLabelValueLength}, err)
+	})
+
+	t.Run("series is rejected with the error strategy", func(t *testing.T) {
+		cfg := cfg
+		cfg.labelNameTooLongStrategy = validation.LabelTooLongStrategyError
+		ls := []mimirpb.LabelAdapter{
+			{Name: model.MetricNameLabel, Value: "foo"},
+			{Name: longName, Value: "bar"},
+		}
+
+		err := validateLabels(newSampleValidationMetrics(nil), cfg, userID, "", ls, false, false, nil, ts)
+		assert.Equal(t, fmt.Errorf(labelNameTooLongMsgFormat, longName, mimirpb.FromLabelAdaptersToString(ls)), err)
+	})
+}
+
+func TestValidateMetricSchema(t *testing.T) {
+	now := time.Now()
+	userID := "testUser"
+	schemas := newMetricSchemaIndex([]validation.MetricSchema{
+		{MetricName: "requests_total", LabelNames: []string{"job"}, Type: "counter"},
+		{MetricName: "request_duration_seconds", LabelNames: []string{"job"}, Type: "histogram"},
+		{MetricName: "response_size_bytes", LabelNames: []string{"job"}, Type: "summary"},
+		{MetricName: "temperature", LabelNames: []string{"room"}},
+	})
+
+	floatSeries := func(seriesLabels ...string) mimirpb.PreallocTimeseries {
+		return makeTimeseries(seriesLabels, makeSamples(1, 1), nil, nil)
+	}
+	histogramSeries := func(seriesLabels ...string) mimirpb.PreallocTimeseries {
+		return makeTimeseries(seriesLabels, nil, makeHistograms(1, generateTestHistogram(1)), nil)
+	}
+
+	tests := map[string]struct {
+		series         mimirpb.PreallocTimeseries
+		expectedErr    string
+		expectedReason string
+	}{
+		"counter with allowed labels": {
+			series: floatSeries(model.MetricNameLabel, "requests_total", "job", "a"),
+		},
+		"metric without type": {
+			series: floatSeries(model.MetricNameLabel, "temperature", "room", "a"),
+		},
+		"metric not in the schemas": {
+			series:         floatSeries(model.MetricNameLabel, "unknown", "job", "a"),
+			expectedErr:    fmt.Sprintf(metricNotInSchemaMsgFormat, "unknown"),
+			expectedReason: reasonMetricNotInSchema,
+		},
+		"label not in the schema": {
+			series:         floatSeries(model.MetricNameLabel, "requests_total", "job", "a", "pod", "b"),
+			expectedErr:    fmt.Sprintf(labelNotInSchemaMsgFormat, "pod", `requests_total{job="a", pod="b"}`),
+			expectedReason: reasonLabelNotInSchema,
+		},
+		"classic histogram bucket": {
+			series: floatSeries(model.MetricNameLabel, "request_duration_seconds_bucket", "job", "a", "le", "1"),
+		},
+		"classic histogram count": {
+			series: floatSeries(model.MetricNameLabel, "request_duration_seconds_count", "job", "a"),
+		},
+		"le label not allowed on the classic histogram count": {
+			series:         floatSeries(model.MetricNameLabel, "request_duration_seconds_count", "job", "a", "le", "1"),
+			expectedErr:    fmt.Sprintf(labelNotInSchemaMsgFormat, "le", `request_duration_seconds_count{job="a", le="1"}`),
+			expectedReason: reasonLabelNotInSchema,
+		},
+		"native histogram": {
+			series: histogramSeries(model.MetricNameLabel, "request_duration_seconds", "job", "a"),
+		},
+		"float samples on a histogram": {
+			series:         floatSeries(model.MetricNameLabel, "request_duration_seconds", "job", "a"),
+			expectedErr:    fmt.Sprintf(metricSchemaTypeMismatchMsgFormat, "histogram", `request_duration_seconds{job="a"}`),
+			expectedReason: reasonMetricSchemaTypeMismatch,
+		},
+		"native histogram on a counter": {
+			series:         histogramSeries(model.MetricNameLabel, "requests_total", "job", "a"),
+			expectedErr:    fmt.Sprintf(metricSchemaTypeMismatchMsgFormat, "counter", `requests_total{job="a"}`),
+			expectedReason: reasonMetricSchemaTypeMismatch,
+		},
+		"summary quantile": {
+			series: floatSeries(model.MetricNameLabel, "response_size_bytes", "job", "a", "quantile", "0.5"),
+		},
+		"summary sum": {
+			series: floatSeries(model.MetricNameLabel, "response_size_bytes_sum", "job", "a"),
+		},
+		"summary has no buckets": {
+			series:         floatSeries(model.MetricNameLabel, "response_size_bytes_bucket", "job", "a", "le", "1"),
+			expectedErr:    fmt.Sprintf(metricNotInSchemaMsgFormat, "response_size_bytes_bucket"),
+			expectedReason: reasonMetricNotInSchema,
+		},
+		"classic histogram series of a metric without type": {
+			series:         floatSeries(model.MetricNameLabel, "temperature_count", "room", "a"),
+			expectedErr:    fmt.Sprintf(metricNotInSchemaMsgFormat, "temperature_count"),
+			expectedReason: reasonMetricNotInSchema,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			reg := prometheus.NewPedanticRegistry()
+			err := validateMetricSchema(newSampleValidationMetrics(reg), schemas, userID, "group", &tc.series, nil, now)
+			if tc.expectedErr == "" {
+				require.NoError(t, err)
+				return
+			}
+
+			require.EqualError(t, err, tc.expectedErr)
+			require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(fmt.Sprintf(`
+				# HELP cortex_discarded_samples_total The total number of samples that were discarded.
+				# TYPE cortex_discarded_samples_total counter
+				cortex_discarded_samples_total{group="group",reason="%s",user="testUser"} 1
+			`, tc.expectedReason)), "cortex_discarded_samples_total"))
+		})
+	}
+}
+
+func TestMetricSchemaIndexCache(t *testing.T) {
+	c := newMetricSchemaIndexCache()
+	require.Nil(t, c.get("user", nil))
+
+	schemas := []validation.MetricSchema{{MetricName: "metric", LabelNames: []string{"job"}}}
+	index := c.get("user", schemas)
+	require.Equal(t, map[string]validation.MetricSchema{"metric": schemas[0]}, index)
+
+	// The index is reused while the schemas of the limits aren't reloaded.
+	require.Equal(t, reflect.ValueOf(index).Pointer(), reflect.ValueOf(c.get("user", schemas)).Pointer())
+
+	// The index is rebuilt when the limits are reloaded.
+	schemas = []validation.MetricSchema{{MetricName: "metric", LabelNames: []string{"job", "instance"}}}
+	require.Equal(t, map[string]validation.MetricSchema{"metric": schemas[0]}, c.get("user", schemas))
+
+	schemas = append(schemas[:1:1], validation.MetricSchema{MetricName: "other"})
+	require.Equal(t, map[string]validation.MetricSchema{"metric": schemas[0], "other": schemas[1]}, c.get("user", schemas))
+
+	c.cleanupTenant("user")
+	require.Empty(t, c.indexes)
+}
+
 type sampleValidationCfg struct {
 	maxNativeHistogramBuckets           int
 	reduceNativeHistogramOverMaxBuckets bool
@@ -3,6 +3,7 @@
 package querymiddleware
 
 import (
+	"fmt"
 	"net/http"
 	"sync"
 
@@ -51,6 +52,25 @@ func (r *readConsistencyRoundTripper) RoundTrip(req *http.Request) (_ *http.Resp
 		return nil, apierror.New(apierror.TypeBadData, err.Error())
 	}
 
+	// The client may supply the offsets of the partitions it has written to, as returned by the distributor
+	// on write. In this case the query only waits for these offsets, without fetching the last produced offsets.
+	if clientOffsets, ok := querierapi.ReadConsistencyEncodedOffsetsFromContext(req.Context()); ok {
+		offsets, err := r.getClientOffsets(clientOffsets)
+		if err != nil {
+			return nil, err
+		}
+
+		spanLog.DebugLog("msg", "evaluating query with strong read consistency up until the offsets supplied by the client", "offsets", offsets)
+
+		reqCtx := querierapi.ContextWithReadConsistencyLevel(req.Context(), querierapi.ReadConsistencyStrong)
+		reqCtx = querierapi.ContextWithReadConsistencyEncodedOffsets(reqCtx, offsets)
+		req = req.WithContext(reqCtx)
+		req.Header.Set(querierapi.ReadConsistencyHeader, querierapi.ReadConsistencyStrong)
+		req.Header.Set(querierapi.ReadConsistencyOffsetsHeader, string(offsets))
+
+		return r.next.RoundTrip(req)
+	}
+
 	// Detect the requested read consistency level.
 	level, ok := querierapi.ReadConsistencyLevelFromContext(req.Context())
 	if !ok {
@@ -97,6 +117,42 @@ func (r *readConsistencyRoundTripper) RoundTrip(req *http.Request) (_ *http.Resp
 	return r.next.RoundTrip(req)
 }
 
+// getClientOffsets returns the offsets to wait for, given the offsets supplied by the client. Ingesters wait for
+// the last produced offset of the partitions missing from the offsets, so the partitions not written by the client
+// are explicitly added with offset -1, which means there's nothing to wait for.
+func (r *readConsistencyRoundTripper) getClientOffsets(clientOffsets querierapi.EncodedOffsets) (querierapi.EncodedOffsets, error) {
+	offsets, err := querierapi.DecodeOffsets(clientOffsets)
+	if err != nil {
+		return "", apierror.New(apierror.TypeBadData, fmt.Sprintf("invalid %s header: %s", querierapi.ReadConsistencyOffsetsHeader, err))
+	}
+
+	offsetsReader, ok := r.offsetsReaders[querierapi.ReadConsistencyOffsetsHeader]
+	if !ok {
+		return clientOffsets, nil
+	}
+
+	offsets, err = r.metrics.Observe(offsetsReader.Topic(), true, func() (map[int32]int64, error) {
+		// The cached offsets are only used to know the partitions of the topic, so it doesn't matter if they're
+		// outdated. If they're not available yet, ingesters fall back to waiting for the last produced offset.
+		lastProducedOffsets, err := offsetsReader.CachedOffset()
+		if err != nil {
+			return offsets, nil
+		}
+
+		for partitionID := range lastProducedOffsets {
+			if _, ok := offsets[partitionID]; !ok {
+				offsets[partitionID] = -1
+			}
+		}
+		return offsets, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return querierapi.EncodeOffsets(offsets), nil
+}
+
 // getDefaultReadConsistency returns the default read consistency for the input tenantIDs,
 // giving preference to strong consistency if enabled for any of the tenants.
 func getDefaultReadConsistency(tenantIDs []string, limits Limits) string {
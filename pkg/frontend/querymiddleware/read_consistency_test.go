@@ -145,6 +145,119 @@ func TestReadConsistencyRoundTripper(t *testing.T) {
 	}
 }
 
+func TestReadConsistencyRoundTripper_WithOffsetsSuppliedByClient(t *testing.T) {
+	const (
+		topic         = "test"
+		numPartitions = 3
+		tenantID      = "user-1"
+	)
+
+	tests := map[string]struct {
+		reqOffsets      querierapi.EncodedOffsets
+		expectedOffsets map[int32]int64
+		expectedErr     string
+	}{
+		"should wait only for the offsets supplied by the client": {
+			reqOffsets:      querierapi.EncodeOffsets(map[int32]int64{1: 0}),
+			expectedOffsets: map[int32]int64{0: -1, 1: 0, 2: -1},
+		},
+		"should not override the offsets supplied by the client for any partition": {
+			reqOffsets:      querierapi.EncodeOffsets(map[int32]int64{0: 1, 1: 0, 2: -1}),
+			expectedOffsets: map[int32]int64{0: 1, 1: 0, 2: -1},
+		},
+		"should fail if the offsets supplied by the client are invalid": {
+			reqOffsets:  "v1=0:invalid",
+			expectedErr: "invalid X-Read-Consistency-Offsets header",
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			// Capture the downstream HTTP request.
+			var downstreamReq *http.Request
+			downstream := RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+				downstreamReq = req
+				return nil, nil
+			})
+
+			ctx := context.Background()
+			logger := log.NewNopLogger()
+
+			_, clusterAddr := testkafka.CreateCluster(t, numPartitions, topic)
+
+			// Write some records, so that the last produced offsets are different than the ones supplied by the client.
+			produceKafkaRecords(t, clusterAddr, topic,
+				&kgo.Record{Partition: 0},
+				&kgo.Record{Partition: 0},
+				&kgo.Record{Partition: 0},
+				&kgo.Record{Partition: 1},
+				&kgo.Record{Partition: 2},
+			)
+
+			// Create the topic offsets reader.
+			readClient, err := ingest.NewKafkaReaderClient(createKafkaConfig(clusterAddr, topic), nil, logger)
+			require.NoError(t, err)
+			t.Cleanup(readClient.Close)
+
+			reader := ingest.NewTopicOffsetsReaderForAllPartitions(readClient, topic, time.Hour, nil, logger)
+			require.NoError(t, services.StartAndAwaitRunning(ctx, reader))
+			t.Cleanup(func() {
+				require.NoError(t, services.StopAndAwaitTerminated(ctx, reader))
+			})
+
+			// Send an HTTP request through the roundtripper. The request explicitly asks for eventual consistency,
+			// but the offsets supplied by the client take precedence.
+			req := httptest.NewRequest("GET", "/", nil)
+			req = req.WithContext(user.InjectOrgID(req.Context(), tenantID))
+			req = req.WithContext(querierapi.ContextWithReadConsistencyLevel(req.Context(), querierapi.ReadConsistencyEventual))
+			req = req.WithContext(querierapi.ContextWithReadConsistencyEncodedOffsets(req.Context(), testData.reqOffsets))
+
+			offsetsReaders := map[string]*ingest.TopicOffsetsReader{querierapi.ReadConsistencyOffsetsHeader: reader}
+			limits := mockLimits{ingestStorageReadConsistency: querierapi.ReadConsistencyEventual}
+
+			reg := prometheus.NewPedanticRegistry()
+			rt := newReadConsistencyRoundTripper(downstream, offsetsReaders, limits, log.NewNopLogger(), newReadConsistencyMetrics(reg, offsetsReaders))
+
+			// The roundtripper must not wait for the next fetch of the last produced offsets, which would take
+			// up to the poll interval.
+			start := time.Now()
+			_, err = rt.RoundTrip(req)
+			assert.Less(t, time.Since(start), 10*time.Second)
+
+			if testData.expectedErr != "" {
+				require.ErrorContains(t, err, testData.expectedErr)
+				assert.Nil(t, downstreamReq)
+				return
+			}
+
+			require.NoError(t, err)
+			require.NotNil(t, downstreamReq)
+
+			assert.Equal(t, querierapi.ReadConsistencyStrong, downstreamReq.Header.Get(querierapi.ReadConsistencyHeader))
+
+			level, _ := querierapi.ReadConsistencyLevelFromContext(downstreamReq.Context())
+			assert.Equal(t, querierapi.ReadConsistencyStrong, level)
+
+			actualOffsets, err := querierapi.DecodeOffsets(querierapi.EncodedOffsets(downstreamReq.Header.Get(querierapi.ReadConsistencyOffsetsHeader)))
+			require.NoError(t, err)
+			assert.Equal(t, testData.expectedOffsets, actualOffsets)
+
+			encodedOffsets, _ := querierapi.ReadConsistencyEncodedOffsetsFromContext(downstreamReq.Context())
+			actualOffsets, err = querierapi.DecodeOffsets(encodedOffsets)
+			require.NoError(t, err)
+			assert.Equal(t, testData.expectedOffsets, actualOffsets)
+
+			assert.NoError(t, promtest.GatherAndCompare(reg, strings.NewReader(fmt.Sprintf(`
+				# HELP cortex_ingest_storage_strong_consistency_requests_total Total number of requests for which strong consistency has been requested. The metric distinguishes between requests with an offset specified and requests requesting to enforce strong consistency up until the last produced offset.
+				# TYPE cortex_ingest_storage_strong_consistency_requests_total counter
+				cortex_ingest_storage_strong_consistency_requests_total{component="query-frontend", topic="%s", with_offset="false"} 0
+				cortex_ingest_storage_strong_consistency_requests_total{component="query-frontend", topic="%s", with_offset="true"} 1
+			`, topic, topic)),
+				"cortex_ingest_storage_strong_consistency_requests_total"))
+		})
+	}
+}
+
 func TestGetDefaultReadConsistency(t *testing.T) {
 	defaults := validation.Limits{IngestStorageReadConsistency: querierapi.ReadConsistencyEventual}
 	tenantLimits := map[string]*validation.Limits{
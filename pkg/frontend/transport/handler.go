@@ -27,11 +27,15 @@ import (
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
 
 	apierror "github.com/grafana/mimir/pkg/api/error"
+	"github.com/grafana/mimir/pkg/costattribution"
 	"github.com/grafana/mimir/pkg/frontend/querymiddleware"
 	querierapi "github.com/grafana/mimir/pkg/querier/api"
 	querier_stats "github.com/grafana/mimir/pkg/querier/stats"
+	"github.com/grafana/mimir/pkg/tenantusage"
 	"github.com/grafana/mimir/pkg/util"
 	"github.com/grafana/mimir/pkg/util/activitytracker"
 	util_log "github.com/grafana/mimir/pkg/util/log"
@@ -73,6 +77,9 @@ type HandlerConfig struct {
 	MaxBodySize              int64                  `yaml:"max_body_size" category:"advanced"`
 	QueryStatsEnabled        bool                   `yaml:"query_stats_enabled" category:"advanced"`
 	ActiveSeriesWriteTimeout time.Duration          `yaml:"active_series_write_timeout" category:"experimental"`
+
+	// TenantUsageTracker is dynamically injected when the tenant usage tracking is enabled.
+	TenantUsageTracker *tenantusage.Tracker `yaml:"-"`
 }
 
 func (cfg *HandlerConfig) RegisterFlags(f *flag.FlagSet) {
@@ -92,6 +99,8 @@ type Handler struct {
 	roundTripper http.RoundTripper
 	at           *activitytracker.ActivityTracker
 
+	costAttributionMgr *costattribution.Manager
+
 	// Metrics.
 	querySeconds                       *prometheus.CounterVec
 	querySeries                        *prometheus.CounterVec
@@ -109,13 +118,14 @@ type Handler struct {
 }
 
 // NewHandler creates a new frontend handler.
-func NewHandler(cfg HandlerConfig, roundTripper http.RoundTripper, log log.Logger, reg prometheus.Registerer, at *activitytracker.ActivityTracker) *Handler {
+func NewHandler(cfg HandlerConfig, roundTripper http.RoundTripper, log log.Logger, reg prometheus.Registerer, at *activitytracker.ActivityTracker, costAttributionMgr *costattribution.Manager) *Handler {
 	h := &Handler{
-		cfg:          cfg,
-		headersToLog: filterHeadersToLog(cfg.LogQueryRequestHeaders),
-		log:          log,
-		roundTripper: roundTripper,
-		at:           at,
+		cfg:                cfg,
+		headersToLog:       filterHeadersToLog(cfg.LogQueryRequestHeaders),
+		log:                log,
+		roundTripper:       roundTripper,
+		at:                 at,
+		costAttributionMgr: costAttributionMgr,
 	}
 	h.cond = sync.NewCond(&h.mtx)
 
@@ -282,6 +292,7 @@ func (f *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if queryStatsHeaderNameOk {
 		cl, _ := strconv.Atoi(resp.Header.Get("Content-Length"))
 		parts = append(parts, getResponseQueryStats(queryResponseTime, cl, queryDetails)...)
+		parts = append(parts, getResponseTenantQueryStats(r, queryDetails)...)
 	}
 
 	if len(parts) > 0 {
@@ -300,6 +311,38 @@ func (f *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// reportQueryCostAttribution attributes the costs of the query to the cost attribution labels of the tenant.
+// The costs include the ones reported by the queriers, which don't attribute them themselves.
+func (f *Handler) reportQueryCostAttribution(r *http.Request, queryString url.Values, userID string, costs costattribution.QueryCosts) {
+	tracker := f.costAttributionMgr.QueryTracker(userID)
+	if tracker == nil {
+		return
+	}
+
+	var selectors [][]*labels.Matcher
+	if tracker.UsesQueryMatchers() {
+		selectors = querySelectors(queryString)
+	}
+	tracker.IncrementQueryCosts(r.Header, selectors, costs, time.Now())
+}
+
+// querySelectors returns the series selectors of the PromQL query or of the match[] parameters of the request.
+// The queries that can't be parsed have no selector.
+func querySelectors(queryString url.Values) [][]*labels.Matcher {
+	var selectors [][]*labels.Matcher
+	if query := queryString.Get("query"); query != "" {
+		if expr, err := parser.ParseExpr(query); err == nil {
+			selectors = append(selectors, parser.ExtractSelectors(expr)...)
+		}
+	}
+	for _, match := range queryString["match[]"] {
+		if matchers, err := parser.ParseMetricSelector(match); err == nil {
+			selectors = append(selectors, matchers)
+		}
+	}
+	return selectors
+}
+
 // reportSlowQuery reports slow queries.
 func (f *Handler) reportSlowQuery(r *http.Request, queryString url.Values, queryResponseTime time.Duration, details *querymiddleware.QueryDetails) {
 	logMessage := append([]any{
@@ -343,16 +386,40 @@ func (f *Handler) reportQueryStats(
 	numIndexBytes := stats.LoadFetchedIndexBytes()
 	sharded := strconv.FormatBool(stats.LoadShardedQueries() > 0)
 	samplesProcessed := stats.LoadSamplesProcessed()
+	// The data fetched by a federated query is attributed to each tenant of the query.
+	tenantStats := federatedTenantStats(tenantIDs, stats)
 	if stats != nil {
 		// Track stats.
 		f.querySeconds.WithLabelValues(userID, sharded).Add(wallTime.Seconds())
-		f.querySeries.WithLabelValues(userID).Add(float64(numSeries))
-		f.queryChunkBytes.WithLabelValues(userID).Add(float64(numBytes))
-		f.queryChunks.WithLabelValues(userID).Add(float64(numChunks))
-		f.queryIndexBytes.WithLabelValues(userID).Add(float64(numIndexBytes))
+		if len(tenantStats) > 0 {
+			for _, ts := range tenantStats {
+				f.querySeries.WithLabelValues(ts.TenantId).Add(float64(ts.FetchedSeriesCount))
+				f.queryChunkBytes.WithLabelValues(ts.TenantId).Add(float64(ts.FetchedChunkBytes))
+				f.queryChunks.WithLabelValues(ts.TenantId).Add(float64(ts.FetchedChunksCount))
+				f.queryIndexBytes.WithLabelValues(ts.TenantId).Add(float64(ts.FetchedIndexBytes))
+				f.activeUsers.UpdateUserTimestamp(ts.TenantId, time.Now())
+				f.cfg.TenantUsageTracker.AddQuery(ts.TenantId, ts.FetchedChunkBytes, ts.FetchedIndexBytes, queryStartTime)
+			}
+		} else {
+			f.querySeries.WithLabelValues(userID).Add(float64(numSeries))
+			f.queryChunkBytes.WithLabelValues(userID).Add(float64(numBytes))
+			f.queryChunks.WithLabelValues(userID).Add(float64(numChunks))
+			f.queryIndexBytes.WithLabelValues(userID).Add(float64(numIndexBytes))
+			f.cfg.TenantUsageTracker.AddQuery(userID, numBytes, numIndexBytes, queryStartTime)
+		}
 		f.querySamplesProcessed.WithLabelValues(userID).Add(float64(samplesProcessed))
 		f.activeUsers.UpdateUserTimestamp(userID, time.Now())
 		f.querySamplesProcessedCacheAdjusted.WithLabelValues(userID).Add(float64(samplesProcessedCacheAdjusted))
+
+		// The costs of the queries of several tenants aren't attributed.
+		if len(tenantIDs) == 1 {
+			f.reportQueryCostAttribution(r, queryString, userID, costattribution.QueryCosts{
+				FetchedSeries:     numSeries,
+				FetchedChunkBytes: numBytes,
+				SamplesProcessed:  samplesProcessed,
+				WallTime:          wallTime,
+			})
+		}
 	}
 
 	// Log stats.
@@ -381,6 +448,10 @@ func (f *Handler) reportQueryStats(
 		"samples_processed_cache_adjusted", samplesProcessedCacheAdjusted,
 	}, formatQueryString(details, queryString)...)
 
+	if len(tenantStats) > 0 {
+		logMessage = append(logMessage, formatTenantStats(tenantStats)...)
+	}
+
 	if details != nil {
 		// Start and End may be zero when the request wasn't a query (e.g. /metadata)
 		// or if the query was a constant expression and didn't need to process samples.
@@ -563,6 +634,58 @@ func getResponseQueryStats(queryResponseTime time.Duration, contentLengthBytes i
 	}
 }
 
+// getResponseTenantQueryStats returns the per-tenant response query stats of a federated query in the
+// format of Server-Timing header. The tenant ID is set as the description of each metric.
+func getResponseTenantQueryStats(r *http.Request, details *querymiddleware.QueryDetails) []string {
+	if details == nil {
+		return nil
+	}
+	tenantIDs, err := tenant.TenantIDs(r.Context())
+	if err != nil {
+		return nil
+	}
+
+	var parts []string
+	for _, ts := range federatedTenantStats(tenantIDs, details.QuerierStats) {
+		desc := fmt.Sprintf(";desc=%q", ts.TenantId)
+		parts = append(parts,
+			statsValue("tenant_"+fetchedChunkBytes, ts.FetchedChunkBytes)+desc,
+			statsValue("tenant_"+fetchedChunksCount, ts.FetchedChunksCount)+desc,
+			statsValue("tenant_"+fetchedIndexBytes, ts.FetchedIndexBytes)+desc,
+			statsValue("tenant_"+fetchedSeriesCount, ts.FetchedSeriesCount)+desc,
+		)
+	}
+	return parts
+}
+
+// federatedTenantStats returns the per-tenant stats if the query has been federated across multiple tenants.
+func federatedTenantStats(tenantIDs []string, stats *querier_stats.SafeStats) []querier_stats.TenantStats {
+	if len(tenantIDs) < 2 {
+		return nil
+	}
+	return stats.LoadTenantStats()
+}
+
+// formatTenantStats returns the log fields for the per-tenant stats, formatted as "<tenant>=<value>,...".
+func formatTenantStats(tenantStats []querier_stats.TenantStats) []any {
+	var seriesSB, chunkBytesSB, chunksSB strings.Builder
+	for i, ts := range tenantStats {
+		if i > 0 {
+			seriesSB.WriteByte(',')
+			chunkBytesSB.WriteByte(',')
+			chunksSB.WriteByte(',')
+		}
+		fmt.Fprintf(&seriesSB, "%s=%d", ts.TenantId, ts.FetchedSeriesCount)
+		fmt.Fprintf(&chunkBytesSB, "%s=%d", ts.TenantId, ts.FetchedChunkBytes)
+		fmt.Fprintf(&chunksSB, "%s=%d", ts.TenantId, ts.FetchedChunksCount)
+	}
+	return []any{
+		fetchedSeriesCount + "_per_tenant", seriesSB.String(),
+		fetchedChunkBytes + "_per_tenant", chunkBytesSB.String(),
+		fetchedChunksCount + "_per_tenant", chunksSB.String(),
+	}
+}
+
 func statsValue(name string, val interface{}) string {
 	switch v := val.(type) {
 	case time.Duration:
@@ -27,6 +27,7 @@ import (
 	"github.com/grafana/dskit/concurrency"
 	"github.com/grafana/dskit/httpgrpc"
 	"github.com/grafana/dskit/middleware"
+	"github.com/grafana/dskit/services"
 	"github.com/grafana/dskit/test"
 	"github.com/grafana/dskit/user"
 	"github.com/pkg/errors"
@@ -35,12 +36,18 @@ import (
 	"github.com/prometheus/prometheus/prompb"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
 	"go.uber.org/atomic"
 
 	apierror "github.com/grafana/mimir/pkg/api/error"
+	"github.com/grafana/mimir/pkg/costattribution"
+	"github.com/grafana/mimir/pkg/costattribution/costattributionmodel"
 	"github.com/grafana/mimir/pkg/frontend/querymiddleware"
 	"github.com/grafana/mimir/pkg/querier/api"
+	querier_stats "github.com/grafana/mimir/pkg/querier/stats"
+	"github.com/grafana/mimir/pkg/tenantusage"
 	"github.com/grafana/mimir/pkg/util/activitytracker"
+	"github.com/grafana/mimir/pkg/util/validation"
 )
 
 type roundTripperFunc func(*http.Request) (*http.Response, error)
@@ -409,7 +416,7 @@ func TestHandler_ServeHTTP(t *testing.T) {
 			t.Cleanup(func() { require.NoError(t, at.Close()) })
 
 			logger := &testLogger{}
-			handler := NewHandler(tt.cfg, roundTripper, logger, reg, at)
+			handler := NewHandler(tt.cfg, roundTripper, logger, reg, at, nil)
 
 			req := tt.request()
 			req = req.WithContext(user.InjectOrgID(req.Context(), "12345"))
@@ -555,7 +562,7 @@ func TestHandler_FailedRoundTrip(t *testing.T) {
 			reg := prometheus.NewPedanticRegistry()
 			logs := &concurrency.SyncBuffer{}
 			logger := log.NewLogfmtLogger(logs)
-			handler := NewHandler(test.cfg, test.queryResponseFunc, logger, reg, nil)
+			handler := NewHandler(test.cfg, test.queryResponseFunc, logger, reg, nil, nil)
 
 			ctx := user.InjectOrgID(context.Background(), "12345")
 			req := httptest.NewRequest("GET", test.path, nil)
@@ -608,7 +615,7 @@ func TestHandler_Stop(t *testing.T) {
 	reg := prometheus.NewPedanticRegistry()
 	cfg := HandlerConfig{MaxBodySize: 1024}
 	logger := &testLogger{}
-	handler := NewHandler(cfg, roundTripper, logger, reg, nil)
+	handler := NewHandler(cfg, roundTripper, logger, reg, nil, nil)
 
 	var wg sync.WaitGroup
 	for i := 0; i < requests; i++ {
@@ -817,7 +824,7 @@ func TestHandler_LogsFormattedQueryDetails(t *testing.T) {
 			t.Cleanup(func() { require.NoError(t, at.Close()) })
 
 			logger := &testLogger{}
-			handler := NewHandler(HandlerConfig{QueryStatsEnabled: true, MaxBodySize: 1024, LogQueryRequestHeaders: tt.logQueryRequestHeaders}, roundTripper, logger, reg, at)
+			handler := NewHandler(HandlerConfig{QueryStatsEnabled: true, MaxBodySize: 1024, LogQueryRequestHeaders: tt.logQueryRequestHeaders}, roundTripper, logger, reg, at, nil)
 
 			req := httptest.NewRequest(http.MethodPost, "/api/v1/query", nil)
 			for header, value := range tt.requestAdditionalHeaders {
@@ -904,7 +911,7 @@ func TestHandler_ActiveSeriesWriteTimeout(t *testing.T) {
 
 			handler := NewHandler(
 				HandlerConfig{ActiveSeriesWriteTimeout: activeSeriesWriteTimeout},
-				roundTripper, log.NewNopLogger(), nil, nil,
+				roundTripper, log.NewNopLogger(), nil, nil, nil,
 			)
 
 			server := httptest.NewUnstartedServer(handler)
@@ -970,3 +977,151 @@ func TestFormatRequestHeaders(t *testing.T) {
 
 	assert.Equal(t, expected, fields)
 }
+
+func TestHandler_FederatedQueryTenantStats(t *testing.T) {
+	queryStats := &querier_stats.SafeStats{}
+	queryStats.AddFetchedSeries(15)
+	queryStats.AddTenantStats("team-a", statsWithFetchedData(10, 100, 2))
+	queryStats.AddTenantStats("team-b", statsWithFetchedData(5, 50, 1))
+	details := &querymiddleware.QueryDetails{QuerierStats: queryStats}
+
+	t.Run("federated query", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/v1/query?query=up", nil)
+		req = req.WithContext(user.InjectOrgID(req.Context(), "team-a|team-b"))
+
+		assert.Equal(t, []any{
+			"fetched_series_count_per_tenant", "team-a=10,team-b=5",
+			"fetched_chunk_bytes_per_tenant", "team-a=100,team-b=50",
+			"fetched_chunks_count_per_tenant", "team-a=2,team-b=1",
+		}, formatTenantStats(federatedTenantStats([]string{"team-a", "team-b"}, queryStats)))
+
+		assert.Equal(t, []string{
+			`tenant_fetched_chunk_bytes;val=100;desc="team-a"`,
+			`tenant_fetched_chunks_count;val=2;desc="team-a"`,
+			`tenant_fetched_index_bytes;val=0;desc="team-a"`,
+			`tenant_fetched_series_count;val=10;desc="team-a"`,
+			`tenant_fetched_chunk_bytes;val=50;desc="team-b"`,
+			`tenant_fetched_chunks_count;val=1;desc="team-b"`,
+			`tenant_fetched_index_bytes;val=0;desc="team-b"`,
+			`tenant_fetched_series_count;val=5;desc="team-b"`,
+		}, getResponseTenantQueryStats(req, details))
+	})
+
+	t.Run("single tenant query", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/v1/query?query=up", nil)
+		req = req.WithContext(user.InjectOrgID(req.Context(), "team-a"))
+
+		assert.Empty(t, federatedTenantStats([]string{"team-a"}, queryStats))
+		assert.Empty(t, getResponseTenantQueryStats(req, details))
+	})
+}
+
+func statsWithFetchedData(series, chunkBytes, chunks uint64) *querier_stats.SafeStats {
+	s := &querier_stats.SafeStats{}
+	s.AddFetchedSeries(series)
+	s.AddFetchedChunkBytes(chunkBytes)
+	s.AddFetchedChunks(chunks)
+	return s
+}
+
+func TestHandler_QueryCostAttribution(t *testing.T) {
+	limits := validation.NewOverrides(validation.Limits{}, validation.NewMockTenantLimits(map[string]*validation.Limits{
+		"user-1": {
+			MaxCostAttributionCardinality: 10,
+			CostAttributionQueryLabels: []costattributionmodel.QueryLabel{
+				{Output: "dashboard", Header: "X-Dashboard-Uid"},
+				{Output: "team", Matcher: "team"},
+			},
+		},
+	}))
+	costAttributionReg := prometheus.NewPedanticRegistry()
+	manager, err := costattribution.NewManager(time.Minute, time.Hour, log.NewNopLogger(), limits, prometheus.NewPedanticRegistry(), costAttributionReg)
+	require.NoError(t, err)
+
+	roundTripper := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		stats := querymiddleware.QueryDetailsFromContext(req.Context()).QuerierStats
+		stats.AddFetchedSeries(5)
+		stats.AddFetchedChunkBytes(100)
+		stats.AddSamplesProcessed(50)
+		stats.AddWallTime(time.Second)
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("{}"))}, nil
+	})
+	handler := NewHandler(HandlerConfig{QueryStatsEnabled: true, MaxBodySize: 1024}, roundTripper, log.NewNopLogger(), prometheus.NewPedanticRegistry(), nil, manager)
+
+	for _, tenantID := range []string{"user-1", "user-2", "user-1|user-2"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/query?query="+url.QueryEscape(`sum(rate(http_requests_total{team="foo"}[1m]))`), nil)
+		req.Header.Set("X-Dashboard-Uid", "abc")
+		req = req.WithContext(user.InjectOrgID(req.Context(), tenantID))
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		require.Equal(t, http.StatusOK, resp.Code)
+	}
+
+	// Only the queries of the tenant with query cost attribution enabled are attributed, not the federated ones.
+	require.NoError(t, promtest.GatherAndCompare(costAttributionReg, strings.NewReader(`
+		# HELP cortex_query_frontend_attributed_fetched_series_total The total number of series fetched to execute the queries per attribution.
+		# TYPE cortex_query_frontend_attributed_fetched_series_total counter
+		cortex_query_frontend_attributed_fetched_series_total{dashboard="abc",team="foo",tenant="user-1",tracker="cost-attribution"} 5
+		# HELP cortex_query_frontend_attributed_querier_wall_time_seconds_total The total wall clock time spent by the queriers processing the queries per attribution.
+		# TYPE cortex_query_frontend_attributed_querier_wall_time_seconds_total counter
+		cortex_query_frontend_attributed_querier_wall_time_seconds_total{dashboard="abc",team="foo",tenant="user-1",tracker="cost-attribution"} 1
+	`), "cortex_query_frontend_attributed_fetched_series_total", "cortex_query_frontend_attributed_querier_wall_time_seconds_total"))
+}
+
+func TestHandler_TenantUsage(t *testing.T) {
+	ctx := context.Background()
+	tracker := tenantusage.NewTracker(tenantusage.Config{
+		Enabled:                 true,
+		InstanceID:              "query-frontend",
+		FlushInterval:           time.Hour,
+		RollupDelay:             2 * time.Hour,
+		PartialsRetentionPeriod: 7 * 24 * time.Hour,
+	}, objstore.NewInMemBucket(), log.NewNopLogger(), prometheus.NewPedanticRegistry())
+	require.NoError(t, services.StartAndAwaitRunning(ctx, tracker))
+
+	roundTripper := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		stats := querymiddleware.QueryDetailsFromContext(req.Context()).QuerierStats
+		stats.AddFetchedChunkBytes(100)
+		stats.AddFetchedIndexBytes(10)
+		if tenantID, _ := user.ExtractOrgID(req.Context()); tenantID == "user-1|user-2" {
+			stats.AddTenantStats("user-1", statsWithFetchedData(1, 60, 1))
+			stats.AddTenantStats("user-2", statsWithFetchedData(1, 40, 1))
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("{}"))}, nil
+	})
+	handler := NewHandler(HandlerConfig{QueryStatsEnabled: true, MaxBodySize: 1024, TenantUsageTracker: tracker}, roundTripper, log.NewNopLogger(), prometheus.NewPedanticRegistry(), nil, nil)
+
+	now := time.Now()
+	for _, tenantID := range []string{"user-1", "user-1|user-2"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/query?query=up", nil)
+		req = req.WithContext(user.InjectOrgID(req.Context(), tenantID))
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		require.Equal(t, http.StatusOK, resp.Code)
+	}
+
+	// The usage is written when the tracker stops.
+	require.NoError(t, services.StopAndAwaitTerminated(ctx, tracker))
+
+	// The data fetched by the federated query is attributed to each tenant of the query.
+	today := now.UTC().Truncate(24 * time.Hour)
+	usage, err := tracker.Report(ctx, today, today, nil, now)
+	require.NoError(t, err)
+	day := today.Format("2006-01-02")
+	assert.Equal(t, []tenantusage.TenantUsage{
+		{Day: day, Tenant: "user-1", QueriesExecuted: 2, FetchedChunkBytes: 160, FetchedIndexBytes: 10},
+		{Day: day, Tenant: "user-2", QueriesExecuted: 1, FetchedChunkBytes: 40},
+	}, usage)
+}
+
+func TestQuerySelectors(t *testing.T) {
+	selectors := querySelectors(url.Values{
+		"query":   []string{`up{job="a"} / on() down`},
+		"match[]": []string{`{team="foo"}`, `invalid{`},
+	})
+	require.Len(t, selectors, 3)
+	assert.Equal(t, `job="a"`, selectors[0][0].String())
+	assert.Equal(t, `team="foo"`, selectors[2][0].String())
+
+	assert.Empty(t, querySelectors(url.Values{"query": []string{"sum("}}))
+}
@@ -349,7 +349,7 @@ func testFrontend(t *testing.T, config Config, handler http.Handler, test func(a
 	r.PathPrefix("/").Handler(middleware.Merge(
 		middleware.AuthenticateUser,
 		middleware.Tracer{},
-	).Wrap(transport.NewHandler(handlerCfg, rt, logger, nil, nil)))
+	).Wrap(transport.NewHandler(handlerCfg, rt, logger, nil, nil, nil)))
 
 	httpServer := http.Server{
 		Handler:      r,
@@ -321,6 +321,43 @@ var _ ingesterError = perMetricSeriesLimitReachedError{}
 // Ensure that perMetricSeriesLimitReachedError is an softError.
 var _ softError = perMetricSeriesLimitReachedError{}
 
+// metricLimitSeriesLimitReachedError is an ingesterError indicating that the series limit of a per-tenant metric limit has been reached.
+type metricLimitSeriesLimitReachedError struct {
+	match  string
+	limit  int
+	series string
+}
+
+// newMetricLimitSeriesLimitReachedError creates a new metricLimitSeriesLimitReachedError indicating that the series limit of a per-tenant metric limit has been reached.
+func newMetricLimitSeriesLimitReachedError(match string, limit int, labels []mimirpb.LabelAdapter) metricLimitSeriesLimitReachedError {
+	return metricLimitSeriesLimitReachedError{
+		match:  match,
+		limit:  limit,
+		series: mimirpb.FromLabelAdaptersToString(labels),
+	}
+}
+
+func (e metricLimitSeriesLimitReachedError) Error() string {
+	return fmt.Sprintf("%s. To adjust the related per-tenant limit, configure metric_limits in the runtime configuration, or contact your service administrator. This is for series %s",
+		globalerror.MetricLimitMaxSeries.Message(
+			fmt.Sprintf("series limit of %d exceeded for the series matching %s", e.limit, e.match),
+		),
+		e.series,
+	)
+}
+
+func (e metricLimitSeriesLimitReachedError) errorCause() mimirpb.ErrorCause {
+	return mimirpb.TENANT_LIMIT
+}
+
+func (e metricLimitSeriesLimitReachedError) soft() {}
+
+// Ensure that metricLimitSeriesLimitReachedError is an ingesterError.
+var _ ingesterError = metricLimitSeriesLimitReachedError{}
+
+// Ensure that metricLimitSeriesLimitReachedError is an softError.
+var _ softError = metricLimitSeriesLimitReachedError{}
+
 // perMetricMetadataLimitReachedError is an ingesterError indicating that a per-metric metadata limit has been reached.
 type perMetricMetadataLimitReachedError struct {
 	limit  int
@@ -519,6 +556,7 @@ type ingesterErrSamplers struct {
 	sampleOutOfOrder                  *log.Sampler
 	sampleDuplicateTimestamp          *log.Sampler
 	maxSeriesPerMetricLimitExceeded   *log.Sampler
+	metricLimitSeriesLimitExceeded    *log.Sampler
 	maxMetadataPerMetricLimitExceeded *log.Sampler
 	maxSeriesPerUserLimitExceeded     *log.Sampler
 	maxMetadataPerUserLimitExceeded   *log.Sampler
@@ -537,6 +575,7 @@ func newIngesterErrSamplers(freq int64) ingesterErrSamplers {
 		log.NewSampler(freq),
 		log.NewSampler(freq),
 		log.NewSampler(freq),
+		log.NewSampler(freq),
 	}
 }
 
@@ -65,6 +65,7 @@ import (
 	"github.com/grafana/mimir/pkg/storage/sharding"
 	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
 	"github.com/grafana/mimir/pkg/storage/tsdb/block"
+	"github.com/grafana/mimir/pkg/tenantusage"
 	"github.com/grafana/mimir/pkg/usagestats"
 	"github.com/grafana/mimir/pkg/util"
 	"github.com/grafana/mimir/pkg/util/globalerror"
@@ -115,6 +116,10 @@ const (
 	reasonPerMetricSeriesLimit   = "per_metric_series_limit"
 	reasonInvalidNativeHistogram = "invalid-native-histogram"
 
+	// reasonMetricSeriesLimit is the prefix of the reasons for discarding the samples of the series exceeding the
+	// series limit of a metric limit. The reason is suffixed with the selector of the limit.
+	reasonMetricSeriesLimit = "metric_series_limit"
+
 	replicationFactorStatsName             = "ingester_replication_factor"
 	ringStoreStatsName                     = "ingester_ring_store"
 	memorySeriesStatsName                  = "ingester_inmemory_series"
@@ -225,6 +230,9 @@ type Config struct {
 	// This config is dynamically injected because defined outside the ingester config.
 	IngestStorageConfig ingest.Config `yaml:"-"`
 
+	// TenantUsageTracker is dynamically injected when the tenant usage tracking is enabled.
+	TenantUsageTracker *tenantusage.Tracker `yaml:"-"`
+
 	// This config can be overridden in tests.
 	limitMetricsUpdatePeriod time.Duration `yaml:"-"`
 }
@@ -359,6 +367,7 @@ type Ingester struct {
 	ingestReader              *ingest.PartitionReader
 	ingestPartitionID         int32
 	ingestPartitionLifecycler *ring.PartitionInstanceLifecycler
+	ingestersRing             ring.ReadRing // Used to count the zones, each consuming all the partitions.
 
 	circuitBreaker  ingesterCircuitBreaker
 	reactiveLimiter *ingesterReactiveLimiter
@@ -485,6 +494,8 @@ func New(cfg Config, limits *validation.Overrides, ingestersRing ring.ReadRing,
 			logger,
 			prometheus.WrapRegistererWithPrefix("cortex_", registerer))
 
+		i.ingestersRing = ingestersRing
+
 		limiterStrategy = newPartitionRingLimiterStrategy(partitionRingWatcher, i.limits.IngestionPartitionsTenantShardSize)
 		ownedSeriesStrategy = newOwnedSeriesPartitionRingStrategy(i.ingestPartitionID, partitionRingWatcher, i.limits.IngestionPartitionsTenantShardSize)
 	} else {
@@ -798,6 +809,18 @@ func (i *Ingester) replaceMatchersAndTrackers(asm *asmodel.Matchers, cat *costat
 	userDB.activeSeries.ReloadMatchersAndTrackers(asm, cat, now)
 }
 
+// seriesReplicas returns the number of ingesters holding each series: the replication factor, or the number of
+// zones if the ingest storage is enabled, because each partition is consumed by one ingester of each zone.
+func (i *Ingester) seriesReplicas() int {
+	if i.cfg.IngestStorageConfig.Enabled {
+		if i.ingestersRing == nil {
+			return 1
+		}
+		return max(1, i.ingestersRing.ZonesCount())
+	}
+	return max(1, i.cfg.IngesterRing.ReplicationFactor)
+}
+
 func (i *Ingester) updateActiveSeries(now time.Time) {
 	for _, userID := range i.getTSDBUsers() {
 		userDB := i.getTSDB(userID)
@@ -821,6 +844,7 @@ func (i *Ingester) updateActiveSeries(now time.Time) {
 		} else {
 			allActive, activeMatching, allActiveHistograms, activeMatchingHistograms, allActiveBuckets, activeMatchingBuckets := userDB.activeSeries.ActiveWithMatchers()
 			i.metrics.activeSeriesLoading.DeleteLabelValues(userID)
+			i.cfg.TenantUsageTracker.ObserveActiveSeries(userID, allActive/i.seriesReplicas(), now)
 			if allActive > 0 {
 				i.metrics.activeSeriesPerUser.WithLabelValues(userID).Set(float64(allActive))
 			} else {
@@ -995,6 +1019,9 @@ type pushStats struct {
 	perUserSeriesLimitCount     int
 	perMetricSeriesLimitCount   int
 	invalidNativeHistogramCount int
+	// metricLimitSeriesLimitCounts are the numbers of samples discarded because of the series limit of
+	// the metric limits, by selector.
+	metricLimitSeriesLimitCounts map[string]int
 }
 
 type ctxKey int
@@ -1305,6 +1332,16 @@ func (i *Ingester) PushWithCleanup(ctx context.Context, req *mimirpb.WriteReques
 					return newPerMetricSeriesLimitReachedError(i.limiter.limits.MaxGlobalSeriesPerMetric(userID), labels)
 				})
 			},
+			func(match string, limit int, labels []mimirpb.LabelAdapter) {
+				if stats.metricLimitSeriesLimitCounts == nil {
+					stats.metricLimitSeriesLimitCounts = map[string]int{}
+				}
+				stats.metricLimitSeriesLimitCounts[match]++
+				cast.IncrementDiscardedSamples(labels, 1, metricSeriesLimitReason(match), startAppend)
+				updateFirstPartial(i.errorSamplers.metricLimitSeriesLimitExceeded, func() softError {
+					return newMetricLimitSeriesLimitReachedError(match, limit, labels)
+				})
+			},
 			func(err error, timestamp int64, labels []mimirpb.LabelAdapter) {
 				stats.invalidNativeHistogramCount++
 				cast.IncrementDiscardedSamples(labels, 1, reasonInvalidNativeHistogram, startAppend)
@@ -1429,6 +1466,12 @@ func (i *Ingester) PushWithCleanup(ctx context.Context, req *mimirpb.WriteReques
 	return nil
 }
 
+// metricSeriesLimitReason returns the reason for discarding the samples of the series exceeding the series limit
+// of the metric limit with the given selector.
+func metricSeriesLimitReason(match string) string {
+	return reasonMetricSeriesLimit + ":" + match
+}
+
 func (i *Ingester) updateMetricsFromPushStats(userID string, group string, stats *pushStats, samplesSource mimirpb.WriteRequest_SourceEnum, db *userTSDB, discarded *discardedMetrics) {
 	if stats.sampleTimestampTooOldCount > 0 {
 		discarded.sampleTimestampTooOld.WithLabelValues(userID, group).Add(float64(stats.sampleTimestampTooOldCount))
@@ -1454,6 +1497,9 @@ func (i *Ingester) updateMetricsFromPushStats(userID string, group string, stats
 	if stats.invalidNativeHistogramCount > 0 {
 		discarded.invalidNativeHistogram.WithLabelValues(userID, group).Add(float64(stats.invalidNativeHistogramCount))
 	}
+	for match, count := range stats.metricLimitSeriesLimitCounts {
+		discarded.metricLimitSeriesLimit.WithReason(metricSeriesLimitReason(match)).WithLabelValues(userID, group).Add(float64(count))
+	}
 	if stats.succeededSamplesCount > 0 {
 		i.ingestionRate.Add(int64(stats.succeededSamplesCount))
 
@@ -2800,6 +2846,7 @@ func (i *Ingester) createTSDB(userID string, walReplayConcurrency int) (*userTSD
 		userID:                  userID,
 		activeSeries:            activeseries.NewActiveSeries(asmodel.NewMatchers(matchersConfig), i.cfg.ActiveSeriesMetrics.IdleTimeout, i.costAttributionMgr.ActiveSeriesTracker(userID)),
 		seriesInMetric:          newMetricCounter(i.limiter, i.cfg.getIgnoreSeriesLimitForMetricNamesMap()),
+		seriesInMetricLimits:    newMetricLimitSeriesCounter(),
 		ingestedAPISamples:      util_math.NewEWMARate(0.2, i.cfg.RateUpdatePeriod),
 		ingestedRuleSamples:     util_math.NewEWMARate(0.2, i.cfg.RateUpdatePeriod),
 		instanceLimitsFn:        i.getInstanceLimits,
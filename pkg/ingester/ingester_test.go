@@ -9935,6 +9935,53 @@ func TestIngesterUserLimitExceeded(t *testing.T) {
 
 }
 
+func TestIngesterMetricLimitSeriesLimitExceeded(t *testing.T) {
+	limits := defaultLimitsTestConfig()
+	limits.MetricLimits = validation.MetricLimitsConfig{
+		{Match: "testmetric", MaxGlobalSeries: 2},
+	}
+
+	cfg := defaultIngesterTestConfig(t)
+	// Set RF=1 here to ensure the series limit is actually set to 2.
+	cfg.IngesterRing.ReplicationFactor = 1
+	reg := prometheus.NewPedanticRegistry()
+	ing, err := prepareIngesterWithBlocksStorageAndLimits(t, cfg, limits, nil, t.TempDir(), reg)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), ing))
+	defer services.StopAndAwaitTerminated(context.Background(), ing) //nolint:errcheck
+
+	// Wait until it's healthy
+	test.Poll(t, time.Second, 1, func() interface{} {
+		return ing.lifecycler.HealthyInstancesCount()
+	})
+
+	userID := "1"
+	ctx := user.InjectOrgID(context.Background(), userID)
+	series := func(metric, value string) []mimirpb.LabelAdapter {
+		return []mimirpb.LabelAdapter{{Name: labels.MetricName, Value: metric}, {Name: "foo", Value: value}}
+	}
+	sample := mimirpb.Sample{TimestampMs: 1, Value: 1}
+
+	// Append the series up to the limit.
+	_, err = ing.Push(ctx, mimirpb.ToWriteRequest([][]mimirpb.LabelAdapter{series("testmetric", "a"), series("testmetric", "b")}, []mimirpb.Sample{sample, sample}, nil, nil, mimirpb.API))
+	require.NoError(t, err)
+
+	// The new series of the limited metric is rejected, while the series of other metrics and the existing series are appended.
+	_, err = ing.Push(ctx, mimirpb.ToWriteRequest(
+		[][]mimirpb.LabelAdapter{series("testmetric", "c"), series("othermetric", "a"), series("testmetric", "a")},
+		[]mimirpb.Sample{sample, sample, {TimestampMs: 2, Value: 2}}, nil, nil, mimirpb.API),
+	)
+	expectedErr := newErrorWithStatus(wrapOrAnnotateWithUser(newMetricLimitSeriesLimitReachedError("testmetric", 2, series("testmetric", "c")), userID), codes.FailedPrecondition)
+	checkErrorWithStatus(t, err, expectedErr)
+
+	assert.Equal(t, uint64(3), ing.getTSDB(userID).Head().NumSeries())
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_discarded_samples_total The total number of samples that were discarded.
+		# TYPE cortex_discarded_samples_total counter
+		cortex_discarded_samples_total{group="",reason="metric_series_limit:testmetric",user="1"} 1
+	`), "cortex_discarded_samples_total"))
+}
+
 func TestIngesterMetricLimitExceeded(t *testing.T) {
 	limits := defaultLimitsTestConfig()
 	limits.MaxGlobalSeriesPerMetric = 1
@@ -12845,3 +12892,47 @@ var ingesterSampleTypeScenarios = map[string]struct {
 		},
 	},
 }
+
+func TestIngester_seriesReplicas(t *testing.T) {
+	tests := map[string]struct {
+		ingestStorage     bool
+		replicationFactor int
+		ingestersRing     ring.ReadRing
+		expected          int
+	}{
+		"replication factor": {
+			replicationFactor: 3,
+			expected:          3,
+		},
+		"ingest storage with zones": {
+			ingestStorage:     true,
+			replicationFactor: 3,
+			ingestersRing:     zonesCountRingMock{zones: 2},
+			expected:          2,
+		},
+		"ingest storage without zones": {
+			ingestStorage:     true,
+			replicationFactor: 3,
+			ingestersRing:     zonesCountRingMock{zones: 0},
+			expected:          1,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			i := &Ingester{ingestersRing: tc.ingestersRing}
+			i.cfg.IngestStorageConfig.Enabled = tc.ingestStorage
+			i.cfg.IngesterRing.ReplicationFactor = tc.replicationFactor
+			assert.Equal(t, tc.expected, i.seriesReplicas())
+		})
+	}
+}
+
+type zonesCountRingMock struct {
+	ring.ReadRing
+	zones int
+}
+
+func (m zonesCountRingMock) ZonesCount() int {
+	return m.zones
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/grafana/dskit/ring"
 
 	"github.com/grafana/mimir/pkg/util"
+	"github.com/grafana/mimir/pkg/util/validation"
 )
 
 // limiterTenantLimits provides access to limits used by Limiter.
@@ -20,6 +21,7 @@ type limiterTenantLimits interface {
 	MaxGlobalMetadataPerMetric(userID string) int
 	MaxGlobalMetricsWithMetadataPerUser(userID string) int
 	MaxGlobalExemplarsPerUser(userID string) int
+	MetricLimits(userID string) []validation.MetricLimit
 }
 
 // Limiter implements primitives to get the maximum number of series, exemplars, metadata, etc.
@@ -44,6 +46,13 @@ func (l *Limiter) IsWithinMaxSeriesPerMetric(userID string, series int) bool {
 	return series < actualLimit
 }
 
+// IsWithinMaxSeriesPerMetricLimit returns true if the series limit of the metric limit has not been reached
+// compared to the current number of matching series in input; otherwise returns false.
+func (l *Limiter) IsWithinMaxSeriesPerMetricLimit(userID string, limit validation.MetricLimit, series int) bool {
+	actualLimit := l.convertGlobalToLocalLimitOrUnlimited(userID, func(string) int { return limit.MaxGlobalSeries }, 0)
+	return series < actualLimit
+}
+
 // IsWithinMaxMetadataPerMetric returns true if limit has not been reached compared to the current
 // number of metadata per metric in input; otherwise returns false.
 func (l *Limiter) IsWithinMaxMetadataPerMetric(userID string, metadata int) bool {
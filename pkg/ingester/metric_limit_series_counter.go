@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ingester
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/prometheus/prometheus/model/labels"
+
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+// metricLimitSeriesCounter counts the in-memory series of a tenant by the metric limit applied to them, which is
+// the first limit whose selector matches the series, for the limits with a series limit. The series of a limit are
+// counted from the TSDB head the first time its series limit is enforced, and then tracked on series creation and
+// deletion.
+type metricLimitSeriesCounter struct {
+	matcher *validation.MetricLimitMatcher
+
+	mtx sync.Mutex
+	// limits are the metric limits the series are counted for. The series are counted again when they change,
+	// because the limit applied to a series depends on the limits before it.
+	limits []validation.MetricLimit
+	// series are the numbers of series the tracked limits are applied to, by selector.
+	series map[string]int
+}
+
+func newMetricLimitSeriesCounter() *metricLimitSeriesCounter {
+	return &metricLimitSeriesCounter{
+		matcher: validation.NewMetricLimitMatcher(),
+		series:  map[string]int{},
+	}
+}
+
+// canAddSeries returns the metric limit applied to the series, and false if its series limit has been reached.
+// countSeries is called to count the in-memory series matching the selector of a limit not tracked yet, among the
+// ones for which counted returns true.
+func (c *metricLimitSeriesCounter) canAddSeries(userID string, limiter *Limiter, metric labels.Labels, countSeries func(matchers []*labels.Matcher, counted func(labels.Labels) bool) (int, error)) (validation.MetricLimit, bool) {
+	limits := limiter.limits.MetricLimits(userID)
+	idx := c.matcher.Match(limits, metric.Get)
+	if idx < 0 || limits[idx].MaxGlobalSeries <= 0 {
+		return validation.MetricLimit{}, true
+	}
+	limit := limits[idx]
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if !slices.Equal(c.limits, limits) {
+		c.limits = slices.Clone(limits)
+		clear(c.series)
+	}
+
+	series, ok := c.series[limit.Match]
+	if !ok {
+		matchers, err := limit.Matchers()
+		if err != nil {
+			return limit, true
+		}
+		// Only the series the limit is applied to are counted, and not the ones matching a limit before it.
+		// Series created concurrently may be counted twice, which is negligible compared to the limit.
+		series, err = countSeries(matchers, func(lbls labels.Labels) bool {
+			return c.matcher.Match(limits, lbls.Get) == idx
+		})
+		if err != nil {
+			// Don't enforce the limit until the series can be counted.
+			return limit, true
+		}
+		c.series[limit.Match] = series
+	}
+
+	return limit, limiter.IsWithinMaxSeriesPerMetricLimit(userID, limit, series)
+}
+
+// trackedLimit returns the selector of the tracked limit applied to the series, if any. Must be called with the lock held.
+func (c *metricLimitSeriesCounter) trackedLimit(metric labels.Labels) (string, bool) {
+	idx := c.matcher.Match(c.limits, metric.Get)
+	if idx < 0 {
+		return "", false
+	}
+	match := c.limits[idx].Match
+	_, ok := c.series[match]
+	return match, ok
+}
+
+func (c *metricLimitSeriesCounter) increaseSeries(metric labels.Labels) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if match, ok := c.trackedLimit(metric); ok {
+		c.series[match]++
+	}
+}
+
+func (c *metricLimitSeriesCounter) decreaseSeries(metric labels.Labels) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if match, ok := c.trackedLimit(metric); ok && c.series[match] > 0 {
+		c.series[match]--
+	}
+}
@@ -0,0 +1,155 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ingester
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+func TestMetricLimitSeriesCounter(t *testing.T) {
+	limits := validation.Limits{
+		MetricLimits: validation.MetricLimitsConfig{
+			{Match: `testmetric{foo="bar"}`, MaxGlobalSeries: 5},
+			{Match: "testmetric", MaxGlobalSeries: 3},
+			{Match: "othermetric", IngestionRate: 10},
+		},
+	}
+	overrides := validation.NewOverrides(limits, nil)
+	// A single ingester, so the local limits are the global ones.
+	ring := &ringCountMock{instancesCount: 1, zonesCount: 1}
+	limiter := NewLimiter(overrides, newIngesterRingLimiterStrategy(ring, 1, false, "", overrides.IngestionTenantShardSize))
+
+	countedSeries := 0
+	countSeries := func(ms []*labels.Matcher, _ func(labels.Labels) bool) (int, error) {
+		countedSeries++
+		require.Equal(t, []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "testmetric")}, ms)
+		// Two series were created before the limit was enforced.
+		return 2, nil
+	}
+
+	c := newMetricLimitSeriesCounter()
+	series := labels.FromStrings(labels.MetricName, "testmetric", "foo", "baz")
+
+	limit, ok := c.canAddSeries("test", limiter, series, countSeries)
+	assert.True(t, ok)
+	assert.Equal(t, "testmetric", limit.Match)
+	c.increaseSeries(series)
+
+	// The limit is reached, and the series are counted only once.
+	_, ok = c.canAddSeries("test", limiter, series, countSeries)
+	assert.False(t, ok)
+	assert.Equal(t, 1, countedSeries)
+
+	c.decreaseSeries(series)
+	_, ok = c.canAddSeries("test", limiter, series, countSeries)
+	assert.True(t, ok)
+
+	// The first matching limit is applied.
+	limit, ok = c.canAddSeries("test", limiter, labels.FromStrings(labels.MetricName, "testmetric", "foo", "bar"), func([]*labels.Matcher, func(labels.Labels) bool) (int, error) {
+		return 0, nil
+	})
+	assert.True(t, ok)
+	assert.Equal(t, `testmetric{foo="bar"}`, limit.Match)
+
+	// The series matching only limits without series limit aren't limited.
+	limit, ok = c.canAddSeries("test", limiter, labels.FromStrings(labels.MetricName, "othermetric"), nil)
+	assert.True(t, ok)
+	assert.Empty(t, limit.Match)
+}
+
+func TestMetricLimitSeriesCounter_OverlappingSelectors(t *testing.T) {
+	limits := validation.Limits{
+		MetricLimits: validation.MetricLimitsConfig{
+			{Match: `testmetric{foo="bar"}`, MaxGlobalSeries: 1},
+			{Match: "testmetric", MaxGlobalSeries: 2},
+		},
+	}
+	overrides := validation.NewOverrides(limits, nil)
+	// A single ingester, so the local limits are the global ones.
+	ring := &ringCountMock{instancesCount: 1, zonesCount: 1}
+	limiter := NewLimiter(overrides, newIngesterRingLimiterStrategy(ring, 1, false, "", overrides.IngestionTenantShardSize))
+
+	// headSeries are the series in memory, counted like the TSDB head does.
+	var headSeries []labels.Labels
+	countSeries := func(ms []*labels.Matcher, counted func(labels.Labels) bool) (int, error) {
+		count := 0
+		for _, s := range headSeries {
+			matches := true
+			for _, m := range ms {
+				matches = matches && m.Matches(s.Get(m.Name))
+			}
+			if matches && counted(s) {
+				count++
+			}
+		}
+		return count, nil
+	}
+
+	c := newMetricLimitSeriesCounter()
+	addSeries := func(s labels.Labels) bool {
+		if _, ok := c.canAddSeries("test", limiter, s, countSeries); !ok {
+			return false
+		}
+		headSeries = append(headSeries, s)
+		c.increaseSeries(s)
+		return true
+	}
+
+	barSeries := labels.FromStrings(labels.MetricName, "testmetric", "foo", "bar")
+	// The series matching the first limit was created before the second limit is tracked.
+	require.True(t, addSeries(barSeries))
+
+	// The series matching the first limit isn't counted under the second one.
+	require.True(t, addSeries(labels.FromStrings(labels.MetricName, "testmetric", "foo", "1")))
+	require.True(t, addSeries(labels.FromStrings(labels.MetricName, "testmetric", "foo", "2")))
+	require.False(t, addSeries(labels.FromStrings(labels.MetricName, "testmetric", "foo", "3")))
+
+	// Only the first limit is applied to the series matching both.
+	require.False(t, addSeries(labels.FromStrings(labels.MetricName, "testmetric", "foo", "bar", "other", "1")))
+
+	// Deleting the series matching the first limit doesn't free a series under the second one.
+	c.decreaseSeries(barSeries)
+	require.False(t, addSeries(labels.FromStrings(labels.MetricName, "testmetric", "foo", "3")))
+	require.True(t, addSeries(labels.FromStrings(labels.MetricName, "testmetric", "foo", "bar", "other", "1")))
+}
+
+func TestMetricLimitSeriesCounter_LimitsChanged(t *testing.T) {
+	tenant := &validation.Limits{
+		MetricLimits: validation.MetricLimitsConfig{{Match: "testmetric", MaxGlobalSeries: 2}},
+	}
+	tenantLimits := &TenantLimitsMock{}
+	tenantLimits.On("ByUserID", "test").Return(tenant)
+	overrides := validation.NewOverrides(validation.Limits{}, tenantLimits)
+	ring := &ringCountMock{instancesCount: 1, zonesCount: 1}
+	limiter := NewLimiter(overrides, newIngesterRingLimiterStrategy(ring, 1, false, "", overrides.IngestionTenantShardSize))
+
+	countedSeries := 0
+	countSeries := func([]*labels.Matcher, func(labels.Labels) bool) (int, error) {
+		countedSeries++
+		return 1, nil
+	}
+
+	c := newMetricLimitSeriesCounter()
+	series := labels.FromStrings(labels.MetricName, "testmetric", "foo", "bar")
+	_, ok := c.canAddSeries("test", limiter, series, countSeries)
+	require.True(t, ok)
+	_, ok = c.canAddSeries("test", limiter, series, countSeries)
+	require.True(t, ok)
+	require.Equal(t, 1, countedSeries)
+
+	// A limit added before the tracked one changes the limit applied to the series, so they're counted again.
+	tenant.MetricLimits = validation.MetricLimitsConfig{
+		{Match: `testmetric{foo="bar"}`, MaxGlobalSeries: 1},
+		{Match: "testmetric", MaxGlobalSeries: 2},
+	}
+	limit, ok := c.canAddSeries("test", limiter, series, countSeries)
+	require.False(t, ok)
+	require.Equal(t, `testmetric{foo="bar"}`, limit.Match)
+	require.Equal(t, 2, countedSeries)
+}
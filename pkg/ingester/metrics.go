@@ -441,6 +441,7 @@ type discardedMetrics struct {
 	perUserSeriesLimit     *prometheus.CounterVec
 	perMetricSeriesLimit   *prometheus.CounterVec
 	invalidNativeHistogram *prometheus.CounterVec
+	metricLimitSeriesLimit *validation.DiscardedSamplesCounters
 }
 
 func newDiscardedMetrics(r prometheus.Registerer) *discardedMetrics {
@@ -453,6 +454,7 @@ func newDiscardedMetrics(r prometheus.Registerer) *discardedMetrics {
 		perUserSeriesLimit:     validation.DiscardedSamplesCounter(r, reasonPerUserSeriesLimit),
 		perMetricSeriesLimit:   validation.DiscardedSamplesCounter(r, reasonPerMetricSeriesLimit),
 		invalidNativeHistogram: validation.DiscardedSamplesCounter(r, reasonInvalidNativeHistogram),
+		metricLimitSeriesLimit: validation.NewDiscardedSamplesCounters(r),
 	}
 }
 
@@ -465,6 +467,7 @@ func (m *discardedMetrics) DeletePartialMatch(filter prometheus.Labels) {
 	m.perUserSeriesLimit.DeletePartialMatch(filter)
 	m.perMetricSeriesLimit.DeletePartialMatch(filter)
 	m.invalidNativeHistogram.DeletePartialMatch(filter)
+	m.metricLimitSeriesLimit.DeletePartialMatch(filter)
 }
 
 func (m *discardedMetrics) DeleteLabelValues(userID string, group string) {
@@ -476,6 +479,7 @@ func (m *discardedMetrics) DeleteLabelValues(userID string, group string) {
 	m.perUserSeriesLimit.DeleteLabelValues(userID, group)
 	m.perMetricSeriesLimit.DeleteLabelValues(userID, group)
 	m.invalidNativeHistogram.DeleteLabelValues(userID, group)
+	m.metricLimitSeriesLimit.DeletePartialMatch(prometheus.Labels{"user": userID, "group": group})
 }
 
 // TSDB metrics collector. Each tenant has its own registry, that TSDB code uses.
@@ -25,6 +25,7 @@ import (
 	"go.uber.org/atomic"
 
 	"github.com/grafana/mimir/pkg/ingester/activeseries"
+	mimir_storage "github.com/grafana/mimir/pkg/storage"
 	"github.com/grafana/mimir/pkg/util/extract"
 	"github.com/grafana/mimir/pkg/util/globalerror"
 	util_math "github.com/grafana/mimir/pkg/util/math"
@@ -96,7 +97,9 @@ type userTSDB struct {
 	userID         string
 	activeSeries   *activeseries.ActiveSeries
 	seriesInMetric *metricCounter
-	limiter        *Limiter
+	// seriesInMetricLimits counts the series by the per-tenant metric limit with a series limit applied to them.
+	seriesInMetricLimits *metricLimitSeriesCounter
+	limiter              *Limiter
 
 	instanceSeriesCount *atomic.Int64 // Shared across all userTSDB instances created by ingester.
 	instanceLimitsFn    func() *InstanceLimits
@@ -308,9 +311,45 @@ func (u *userTSDB) PreCreation(metric labels.Labels) error {
 		return globalerror.MaxSeriesPerMetric
 	}
 
+	// Per-tenant metric limit series limit.
+	if limit, ok := u.seriesInMetricLimits.canAddSeries(u.userID, u.limiter, metric, u.countHeadSeries); !ok {
+		return mimir_storage.MetricLimitSeriesLimitError{Match: limit.Match, Limit: limit.MaxGlobalSeries}
+	}
+
 	return nil
 }
 
+// countHeadSeries returns the number of series in the TSDB head matching the matchers, for which counted returns true.
+func (u *userTSDB) countHeadSeries(matchers []*labels.Matcher, counted func(labels.Labels) bool) (int, error) {
+	idx, err := u.Head().Index()
+	if err != nil {
+		return 0, err
+	}
+	defer idx.Close()
+
+	postings, err := tsdb.PostingsForMatchers(context.Background(), idx, matchers...)
+	if err != nil {
+		return 0, err
+	}
+	var (
+		count   = 0
+		builder labels.ScratchBuilder
+	)
+	for postings.Next() {
+		if err := idx.Series(postings.At(), &builder, nil); err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				// The series has been deleted in the meantime.
+				continue
+			}
+			return 0, err
+		}
+		if counted(builder.Labels()) {
+			count++
+		}
+	}
+	return count, postings.Err()
+}
+
 // getSeriesCountAndMinLocalLimit returns current number of series and minimum local limit that should be used for computing
 // series limit.
 func (u *userTSDB) getSeriesCountAndMinLocalLimit() (int, int) {
@@ -339,6 +378,7 @@ func (u *userTSDB) PostCreation(metric labels.Labels) {
 		return
 	}
 	u.seriesInMetric.increaseSeriesForMetric(metricName)
+	u.seriesInMetricLimits.increaseSeries(metric)
 }
 
 func (u *userTSDB) PostDeletion(metrics map[chunks.HeadSeriesRef]labels.Labels) {
@@ -351,6 +391,7 @@ func (u *userTSDB) PostDeletion(metrics map[chunks.HeadSeriesRef]labels.Labels)
 			continue
 		}
 		u.seriesInMetric.decreaseSeriesForMetric(metricName)
+		u.seriesInMetricLimits.decreaseSeries(lbls)
 	}
 
 	// We cannot update ownedSeriesCount here, as we don't know whether deleted series were owned by this ingester or not.
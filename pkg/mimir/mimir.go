@@ -73,6 +73,8 @@ import (
 	"github.com/grafana/mimir/pkg/storage/tsdb"
 	"github.com/grafana/mimir/pkg/storegateway"
 	"github.com/grafana/mimir/pkg/streamingpromql"
+	"github.com/grafana/mimir/pkg/tenantlimits"
+	"github.com/grafana/mimir/pkg/tenantusage"
 	"github.com/grafana/mimir/pkg/usagestats"
 	"github.com/grafana/mimir/pkg/util"
 	"github.com/grafana/mimir/pkg/util/activitytracker"
@@ -84,7 +86,10 @@ import (
 	"github.com/grafana/mimir/pkg/vault"
 )
 
-var errInvalidBucketConfig = errors.New("invalid bucket config")
+var (
+	errInvalidBucketConfig             = errors.New("invalid bucket config")
+	errDistributorDiskBufferNotAllowed = errors.New("the distributor disk buffer (-distributor.disk-buffer.enabled) is not supported with the ingest storage (-ingest-storage.enabled)")
+)
 
 // The design pattern for Mimir is a series of config objects, which are
 // registered for command line flags, and then a series of components that
@@ -138,10 +143,12 @@ type Config struct {
 	RulerStorage        rulestore.Config                           `yaml:"ruler_storage"`
 	Alertmanager        alertmanager.MultitenantAlertmanagerConfig `yaml:"alertmanager"`
 	AlertmanagerStorage alertstore.Config                          `yaml:"alertmanager_storage"`
-	RuntimeConfig       runtimeconfig.Config                       `yaml:"runtime_config"`
+	RuntimeConfig       RuntimeConfigSources                       `yaml:"runtime_config"`
 	MemberlistKV        memberlist.KVConfig                        `yaml:"memberlist"`
 	QueryScheduler      scheduler.Config                           `yaml:"query_scheduler"`
 	UsageStats          usagestats.Config                          `yaml:"usage_stats"`
+	TenantUsage         tenantusage.Config                         `yaml:"tenant_usage"`
+	TenantLimitsStore   tenantlimits.Config                        `yaml:"tenant_limits_store"`
 	ContinuousTest      continuoustest.Config                      `yaml:"-"`
 	OverridesExporter   exporter.Config                            `yaml:"overrides_exporter"`
 
@@ -208,6 +215,8 @@ func (c *Config) RegisterFlags(f *flag.FlagSet, logger log.Logger) {
 	c.ActivityTracker.RegisterFlags(f)
 	c.QueryScheduler.RegisterFlags(f, logger)
 	c.UsageStats.RegisterFlags(f)
+	c.TenantUsage.RegisterFlags(f, logger)
+	c.TenantLimitsStore.RegisterFlags(f)
 	c.ContinuousTest.RegisterFlags(f)
 	c.OverridesExporter.RegisterFlags(f, logger)
 
@@ -281,6 +290,9 @@ func (c *Config) Validate(log log.Logger) error {
 	if err := c.Distributor.Validate(c.LimitsConfig); err != nil {
 		return errors.Wrap(err, "invalid distributor config")
 	}
+	if c.Distributor.DiskBufferConfig.Enabled && c.IngestStorage.Enabled {
+		return errDistributorDiskBufferNotAllowed
+	}
 	if err := c.Querier.Validate(); err != nil {
 		return errors.Wrap(err, "invalid querier config")
 	}
@@ -319,9 +331,21 @@ func (c *Config) Validate(log log.Logger) error {
 	if err := c.QueryScheduler.Validate(); err != nil {
 		return errors.Wrap(err, "invalid query-scheduler config")
 	}
+	if err := c.RuntimeConfig.Validate(); err != nil {
+		return errors.Wrap(err, "invalid runtime config")
+	}
 	if err := c.UsageStats.Validate(); err != nil {
 		return errors.Wrap(err, "invalid usage stats config")
 	}
+	if err := c.API.AuditLog.Validate(); err != nil {
+		return errors.Wrap(err, "invalid audit log config")
+	}
+	if err := c.TenantUsage.Validate(); err != nil {
+		return errors.Wrap(err, "invalid tenant usage config")
+	}
+	if err := c.TenantLimitsStore.Validate(); err != nil {
+		return errors.Wrap(err, "invalid tenant limits store config")
+	}
 	if err := c.Vault.Validate(); err != nil {
 		return errors.Wrap(err, "invalid vault config")
 	}
@@ -459,6 +483,15 @@ func (c *Config) validateFilesystemPaths(logger log.Logger) error {
 		})
 	}
 
+	// Distributor.
+	if c.isAnyModuleEnabled(All, Distributor, Write) && c.Distributor.DiskBufferConfig.Enabled {
+		paths = append(paths, pathConfig{
+			name:       "distributor disk buffer directory",
+			cfgValue:   c.Distributor.DiskBufferConfig.Directory,
+			checkValue: c.Distributor.DiskBufferConfig.Directory,
+		})
+	}
+
 	// Store-gateway.
 	if c.isAnyModuleEnabled(All, StoreGateway, Backend) {
 		paths = append(paths, pathConfig{
@@ -781,6 +814,7 @@ type Mimir struct {
 	IngesterPartitionRingWatcher     *ring.PartitionRingWatcher
 	IngesterPartitionInstanceRing    *ring.PartitionInstanceRing
 	TenantLimits                     validation.TenantLimits
+	TenantSets                       tenantfederation.TenantSetsProvider
 	Overrides                        *validation.Overrides
 	ActiveGroupsCleanup              *util.ActiveGroupsCleanupService
 	Distributor                      *distributor.Distributor
@@ -806,6 +840,8 @@ type Mimir struct {
 	ActivityTracker                  *activitytracker.ActivityTracker
 	Vault                            *vault.Vault
 	UsageStatsReporter               *usagestats.Reporter
+	TenantUsageTracker               *tenantusage.Tracker
+	TenantLimitsStore                *tenantlimits.Store
 	BlockBuilder                     *blockbuilder.BlockBuilder
 	BlockBuilderScheduler            *blockbuilderscheduler.BlockBuilderScheduler
 	ContinuousTestManager            *continuoustest.Manager
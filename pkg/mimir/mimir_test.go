@@ -165,7 +165,8 @@ func TestMimir(t *testing.T) {
 			InstanceInterfaceNames: []string{"en0", "eth0", "lo0", "lo"},
 		}},
 		Querier: querier.Config{
-			QueryEngine: "prometheus",
+			QueryEngine:        "prometheus",
+			ExternalRemoteRead: querier.ExternalRemoteReadConfig{MaxClients: 1},
 		},
 		Frontend: frontend.CombinedFrontendConfig{
 			QueryEngine: "prometheus",
@@ -384,6 +385,18 @@ func TestConfigValidation(t *testing.T) {
 			},
 			expectedError: nil,
 		},
+		{
+			name: "Distributor: should fail if the disk buffer is enabled with the ingest storage",
+			getTestConfig: func() *Config {
+				cfg := newDefaultConfig()
+				cfg.IngestStorage.Enabled = true
+				cfg.IngestStorage.KafkaConfig.Address = "localhost:9092"
+				cfg.IngestStorage.KafkaConfig.Topic = "mimir"
+				cfg.Distributor.DiskBufferConfig.Enabled = true
+				return cfg
+			},
+			expectedError: errDistributorDiskBufferNotAllowed,
+		},
 		{
 			name: "Alertmanager: should ignore invalid alertmanager configuration when alertmanager is not running",
 			getTestConfig: func() *Config {
@@ -23,6 +23,7 @@ import (
 	"github.com/grafana/dskit/ring"
 	"github.com/grafana/dskit/server"
 	"github.com/grafana/dskit/services"
+	"github.com/grafana/dskit/tenant"
 	"github.com/pkg/errors"
 	"github.com/prometheus/alertmanager/featurecontrol"
 	"github.com/prometheus/alertmanager/matchers/compat"
@@ -33,11 +34,13 @@ import (
 	"github.com/prometheus/prometheus/rules"
 	prom_storage "github.com/prometheus/prometheus/storage"
 	prom_remote "github.com/prometheus/prometheus/storage/remote"
+	"github.com/thanos-io/objstore"
 
 	"github.com/grafana/mimir/pkg/alertmanager"
 	"github.com/grafana/mimir/pkg/alertmanager/alertstore"
 	"github.com/grafana/mimir/pkg/alertmanager/alertstore/bucketclient"
 	"github.com/grafana/mimir/pkg/api"
+	"github.com/grafana/mimir/pkg/api/audit"
 	"github.com/grafana/mimir/pkg/blockbuilder"
 	blockbuilderscheduler "github.com/grafana/mimir/pkg/blockbuilder/scheduler"
 	"github.com/grafana/mimir/pkg/compactor"
@@ -58,10 +61,14 @@ import (
 	"github.com/grafana/mimir/pkg/ruler"
 	"github.com/grafana/mimir/pkg/scheduler"
 	"github.com/grafana/mimir/pkg/storage/bucket"
+	"github.com/grafana/mimir/pkg/storage/bucket/filesystem"
 	"github.com/grafana/mimir/pkg/storage/ingest"
+	mimir_tsdb "github.com/grafana/mimir/pkg/storage/tsdb"
 	"github.com/grafana/mimir/pkg/storegateway"
 	"github.com/grafana/mimir/pkg/streamingpromql"
 	streamingpromqlcompat "github.com/grafana/mimir/pkg/streamingpromql/compat"
+	"github.com/grafana/mimir/pkg/tenantlimits"
+	"github.com/grafana/mimir/pkg/tenantusage"
 	"github.com/grafana/mimir/pkg/usagestats"
 	"github.com/grafana/mimir/pkg/util"
 	"github.com/grafana/mimir/pkg/util/activitytracker"
@@ -79,6 +86,7 @@ const (
 	ActiveGroupsCleanupService       string = "active-groups-cleanup-service"
 	ActivityTracker                  string = "activity-tracker"
 	AlertManager                     string = "alertmanager"
+	AuditLog                         string = "audit-log"
 	BlockBuilder                     string = "block-builder"
 	BlockBuilderScheduler            string = "block-builder-scheduler"
 	Compactor                        string = "compactor"
@@ -105,11 +113,15 @@ const (
 	Ruler                            string = "ruler"
 	RulerStorage                     string = "ruler-storage"
 	RuntimeConfig                    string = "runtime-config"
+	RuntimeConfigTenants             string = "runtime-config-tenants"
 	SanityCheck                      string = "sanity-check"
 	Server                           string = "server"
 	StoreGateway                     string = "store-gateway"
 	StoreQueryable                   string = "store-queryable"
 	TenantFederation                 string = "tenant-federation"
+	TenantLimitsStore                string = "tenant-limits-store"
+	TenantSets                       string = "tenant-sets"
+	TenantUsage                      string = "tenant-usage"
 	UsageStats                       string = "usage-stats"
 	Vault                            string = "vault"
 
@@ -158,6 +170,30 @@ func (t *Mimir) initAPI() (services.Service, error) {
 	return nil, nil
 }
 
+func (t *Mimir) initAuditLog() (services.Service, error) {
+	if !t.Cfg.API.AuditLog.Enabled {
+		return nil, nil
+	}
+
+	var bucketClient objstore.Bucket
+	if t.Cfg.API.AuditLog.Sink == audit.SinkBucket {
+		var err error
+		bucketClient, err = bucket.NewClient(context.Background(), t.Cfg.BlocksStorage.Bucket, AuditLog, util_log.Logger, t.Registerer)
+		if err != nil {
+			return nil, errors.Wrapf(err, "create %s bucket client", AuditLog)
+		}
+	}
+
+	logger, err := audit.NewLogger(t.Cfg.API.AuditLog, bucketClient, util_log.Logger, t.Registerer)
+	if err != nil {
+		return nil, err
+	}
+
+	// The audit log is injected in the API, which records the administrative and destructive API calls.
+	t.Cfg.API.AuditLogger = logger
+	return logger, nil
+}
+
 func (t *Mimir) initActivityTracker() (services.Service, error) {
 	if t.Cfg.ActivityTracker.Filepath == "" {
 		return nil, nil
@@ -433,7 +469,7 @@ func (t *Mimir) initRuntimeConfig() (services.Service, error) {
 	t.TenantLimits = newTenantLimits(serv)
 
 	t.RuntimeConfig = serv
-	t.API.RegisterRuntimeConfig(runtimeConfigHandler(t.RuntimeConfig, t.Cfg.LimitsConfig), validation.UserLimitsHandler(t.Cfg.LimitsConfig, t.TenantLimits))
+	t.API.RegisterRuntimeConfig(runtimeConfigHandler(t.RuntimeConfig, t.Cfg.LimitsConfig))
 
 	// Update config fields using runtime config. Only if multiKV is used for given ring these returned functions will be
 	// called and register the listener.
@@ -454,8 +490,41 @@ func (t *Mimir) initRuntimeConfig() (services.Service, error) {
 	return serv, nil
 }
 
+func (t *Mimir) initRuntimeConfigTenants() (services.Service, error) {
+	if !t.Cfg.RuntimeConfig.tenantsEnabled() {
+		return nil, nil
+	}
+
+	var bucketClient objstore.Bucket
+	if t.Cfg.RuntimeConfig.TenantsDir != "" {
+		var err error
+		bucketClient, err = filesystem.NewBucketClient(filesystem.Config{Directory: t.Cfg.RuntimeConfig.TenantsDir})
+		if err != nil {
+			return nil, errors.Wrapf(err, "create %s bucket client", RuntimeConfigTenants)
+		}
+	} else {
+		blocksBucket, err := bucket.NewClient(context.Background(), t.Cfg.BlocksStorage.Bucket, RuntimeConfigTenants, util_log.Logger, t.Registerer)
+		if err != nil {
+			return nil, errors.Wrapf(err, "create %s bucket client", RuntimeConfigTenants)
+		}
+		bucketClient = bucket.NewPrefixedBucketClient(blocksBucket, t.Cfg.RuntimeConfig.TenantsBucketPrefix)
+	}
+
+	// The tenant files are unmarshalled on top of the default limits, even without runtime config files.
+	validation.SetDefaultLimitsForYAMLUnmarshalling(t.Cfg.LimitsConfig)
+
+	// The tenant files replace the per-tenant limits of the runtime config files, if any.
+	serv := newRuntimeConfigTenants(bucketClient, t.Cfg.RuntimeConfig.ReloadPeriod, t.Cfg.ValidateLimits, t.TenantLimits, util_log.Logger, t.Registerer)
+	t.TenantLimits = serv
+	return serv, nil
+}
+
 func (t *Mimir) initOverrides() (serv services.Service, err error) {
 	t.Overrides = validation.NewOverrides(t.Cfg.LimitsConfig, t.TenantLimits)
+	// The per-tenant limits come from the runtime config and the tenant limits store, which are set up before.
+	if t.TenantLimits != nil {
+		t.API.RegisterUserLimits(validation.UserLimitsHandler(t.Cfg.LimitsConfig, t.TenantLimits))
+	}
 	// overrides don't have operational state, nor do they need to do anything more in starting/stopping phase,
 	// so there is no need to return any service.
 	return nil, nil
@@ -486,6 +555,7 @@ func (t *Mimir) initOverridesExporter() (services.Service, error) {
 func (t *Mimir) initDistributorService() (serv services.Service, err error) {
 	t.Cfg.Distributor.DistributorRing.Common.ListenPort = t.Cfg.Server.GRPCListenPort
 	t.Cfg.Distributor.InstanceLimitsFn = distributorInstanceLimits(t.RuntimeConfig)
+	t.Cfg.Distributor.TenantUsageTracker = t.TenantUsageTracker
 
 	if t.Cfg.Querier.ShuffleShardingIngestersEnabled {
 		t.Cfg.Distributor.ShuffleShardingLookbackPeriod = t.Cfg.BlocksStorage.TSDB.Retention
@@ -561,13 +631,22 @@ func (t *Mimir) initTenantFederation() (serv services.Service, err error) {
 		// and ruler metrics and prevents duplicate registration.
 		registerer := prometheus.WrapRegistererWith(querierEngine, t.Registerer)
 
-		t.QuerierQueryable = querier.NewSampleAndChunkQueryable(tenantfederation.NewQueryable(t.QuerierQueryable, bypassForSingleQuerier, t.Cfg.TenantFederation.MaxConcurrent, registerer, util_log.Logger))
+		t.QuerierQueryable = querier.NewSampleAndChunkQueryable(tenantfederation.NewQueryable(t.QuerierQueryable, t.tenantFederationResolver(), bypassForSingleQuerier, t.Cfg.TenantFederation.MaxConcurrent, t.Cfg.TenantFederation.QueryLimits(), registerer, util_log.Logger))
 		t.ExemplarQueryable = tenantfederation.NewExemplarQueryable(t.ExemplarQueryable, bypassForSingleQuerier, t.Cfg.TenantFederation.MaxConcurrent, registerer, util_log.Logger)
 		t.MetadataSupplier = tenantfederation.NewMetadataSupplier(t.MetadataSupplier, t.Cfg.TenantFederation.MaxConcurrent, util_log.Logger)
 	}
 	return nil, nil
 }
 
+// tenantFederationResolver returns the tenant.Resolver used by federated queryables, expanding
+// tenant set references when tenant sets are enabled.
+func (t *Mimir) tenantFederationResolver() tenant.Resolver {
+	if t.TenantSets != nil {
+		return tenantfederation.NewTenantSetsResolver(t.TenantSets)
+	}
+	return tenant.NewMultiResolver()
+}
+
 // initQuerier registers an internal HTTP router with a Prometheus API backed by the
 // Mimir Queryable. Then it does one of the following:
 //
@@ -711,6 +790,7 @@ func (t *Mimir) initIngesterService() (serv services.Service, err error) {
 	t.Cfg.Ingester.StreamTypeFn = ingesterChunkStreaming(t.RuntimeConfig)
 	t.Cfg.Ingester.InstanceLimitsFn = ingesterInstanceLimits(t.RuntimeConfig)
 	t.Cfg.Ingester.IngestStorageConfig = t.Cfg.IngestStorage
+	t.Cfg.Ingester.TenantUsageTracker = t.TenantUsageTracker
 	t.tsdbIngesterConfig()
 
 	t.Ingester, err = ingester.New(t.Cfg.Ingester, t.Overrides, t.IngesterRing, t.IngesterPartitionRingWatcher, t.ActiveGroupsCleanup, t.CostAttributionManager, t.Registerer, util_log.Logger)
@@ -883,7 +963,8 @@ func (t *Mimir) initQueryFrontend() (serv services.Service, err error) {
 		roundTripper = querymiddleware.NewFrontendRunningRoundTripper(roundTripper, frontendSvc, t.Cfg.Frontend.QueryMiddleware.NotRunningTimeout, util_log.Logger)
 	}
 
-	handler := transport.NewHandler(t.Cfg.Frontend.Handler, roundTripper, util_log.Logger, t.Registerer, t.ActivityTracker)
+	t.Cfg.Frontend.Handler.TenantUsageTracker = t.TenantUsageTracker
+	handler := transport.NewHandler(t.Cfg.Frontend.Handler, roundTripper, util_log.Logger, t.Registerer, t.ActivityTracker, t.CostAttributionManager)
 	// Allow the Prometheus engine to be explicitly selected if MQE is in use and a fallback is configured.
 	fallbackInjector := streamingpromqlcompat.EngineFallbackInjector{}
 	t.API.RegisterQueryFrontendHandler(fallbackInjector.Wrap(handler), t.BuildInfoHandler)
@@ -987,7 +1068,7 @@ func (t *Mimir) initRuler() (serv services.Service, err error) {
 			// This makes this label more consistent and hopefully less confusing to users.
 			const bypassForSingleQuerier = false
 
-			federatedQueryable = tenantfederation.NewQueryable(queryable, bypassForSingleQuerier, t.Cfg.TenantFederation.MaxConcurrent, rulerRegisterer, util_log.Logger)
+			federatedQueryable = tenantfederation.NewQueryable(queryable, t.tenantFederationResolver(), bypassForSingleQuerier, t.Cfg.TenantFederation.MaxConcurrent, t.Cfg.TenantFederation.QueryLimits(), rulerRegisterer, util_log.Logger)
 
 			regularQueryFunc := rules.EngineQueryFunc(eng, queryable)
 			federatedQueryFunc := rules.EngineQueryFunc(eng, federatedQueryable)
@@ -1100,6 +1181,9 @@ func (t *Mimir) initCompactor() (serv services.Service, err error) {
 	t.Cfg.Compactor.ShardingRing.Common.ListenPort = t.Cfg.Server.GRPCListenPort
 	t.Cfg.Compactor.SparseIndexHeadersConfig = t.Cfg.BlocksStorage.BucketStore.IndexHeader
 	t.Cfg.Compactor.SparseIndexHeadersSamplingRate = t.Cfg.BlocksStorage.BucketStore.PostingOffsetsInMemSampling
+	if t.TenantUsageTracker != nil {
+		t.Cfg.Compactor.TenantUsageRecorder = t.TenantUsageTracker
+	}
 
 	t.Compactor, err = compactor.NewMultitenantCompactor(t.Cfg.Compactor, t.Cfg.BlocksStorage, t.Overrides, util_log.Logger, t.Registerer)
 	if err != nil {
@@ -1108,6 +1192,9 @@ func (t *Mimir) initCompactor() (serv services.Service, err error) {
 
 	// Expose HTTP endpoints.
 	t.API.RegisterCompactor(t.Compactor)
+	if t.TenantUsageTracker != nil {
+		t.API.RegisterTenantUsage(t.TenantUsageTracker)
+	}
 	return t.Compactor, nil
 }
 
@@ -1193,6 +1280,70 @@ func (t *Mimir) initUsageStats() (services.Service, error) {
 	return t.UsageStatsReporter, nil
 }
 
+func (t *Mimir) initTenantSets() (services.Service, error) {
+	if !t.Cfg.TenantFederation.Enabled || !t.Cfg.TenantFederation.TenantSetsEnabled || t.RuntimeConfig == nil {
+		return nil, nil
+	}
+
+	bucketClient, err := bucket.NewClient(context.Background(), t.Cfg.BlocksStorage.Bucket, TenantSets, util_log.Logger, t.Registerer)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create %s bucket client", TenantSets)
+	}
+	scanTenants := func(ctx context.Context) ([]string, error) {
+		return mimir_tsdb.ListUsers(ctx, bucketClient)
+	}
+
+	// The per-tenant limits are read when the tenant sets are resolved, to include the tenants of all the sources
+	// of per-tenant limits, which are all set up by the overrides module.
+	tenantLimits := func() validation.TenantLimits { return t.TenantLimits }
+
+	serv := newTenantSets(t.RuntimeConfig, tenantLimits, scanTenants, t.Cfg.RuntimeConfig.ReloadPeriod, util_log.Logger)
+	t.TenantSets = serv
+	t.API.RegisterTenantSets(serv)
+	return serv, nil
+}
+
+func (t *Mimir) initTenantUsage() (services.Service, error) {
+	if !t.Cfg.TenantUsage.Enabled {
+		return nil, nil
+	}
+
+	// The usage is tracked by the components ingesting and querying the series, and by the compactor,
+	// which also rolls it up.
+	if !t.Cfg.isAnyModuleEnabled(All, Write, Read, Backend, Distributor, Ingester, QueryFrontend, Ruler, Compactor) {
+		return nil, nil
+	}
+	t.Cfg.TenantUsage.RollupEnabled = t.Cfg.isAnyModuleEnabled(All, Backend, Compactor)
+
+	bucketClient, err := bucket.NewClient(context.Background(), t.Cfg.BlocksStorage.Bucket, TenantUsage, util_log.Logger, t.Registerer)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create %s bucket client", TenantUsage)
+	}
+
+	t.TenantUsageTracker = tenantusage.NewTracker(t.Cfg.TenantUsage, bucketClient, util_log.Logger, t.Registerer)
+	return t.TenantUsageTracker, nil
+}
+
+func (t *Mimir) initTenantLimitsStore() (services.Service, error) {
+	if !t.Cfg.TenantLimitsStore.Enabled {
+		return nil, nil
+	}
+
+	bucketClient, err := bucket.NewClient(context.Background(), t.Cfg.BlocksStorage.Bucket, TenantLimitsStore, util_log.Logger, t.Registerer)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create %s bucket client", TenantLimitsStore)
+	}
+
+	// The stored overrides are unmarshalled on top of the default limits, even without runtime config.
+	validation.SetDefaultLimitsForYAMLUnmarshalling(t.Cfg.LimitsConfig)
+
+	// The store merges the stored overrides with the per-tenant limits of the runtime config, if any.
+	t.TenantLimitsStore = tenantlimits.NewStore(t.Cfg.TenantLimitsStore, t.Cfg.LimitsConfig, t.Cfg.ValidateLimits, t.TenantLimits, bucketClient, util_log.Logger, t.Registerer)
+	t.TenantLimits = t.TenantLimitsStore
+	t.API.RegisterTenantLimitsStore(t.TenantLimitsStore)
+	return t.TenantLimitsStore, nil
+}
+
 func (t *Mimir) initBlockBuilder() (_ services.Service, err error) {
 	t.Cfg.BlockBuilder.Kafka = t.Cfg.IngestStorage.KafkaConfig
 	t.Cfg.BlockBuilder.BlocksStorage = t.Cfg.BlocksStorage
@@ -1239,6 +1390,7 @@ func (t *Mimir) setupModuleManager() error {
 	mm.RegisterModule(ActiveGroupsCleanupService, t.initActiveGroupsCleanupService, modules.UserInvisibleModule)
 	mm.RegisterModule(ActivityTracker, t.initActivityTracker, modules.UserInvisibleModule)
 	mm.RegisterModule(AlertManager, t.initAlertManager)
+	mm.RegisterModule(AuditLog, t.initAuditLog, modules.UserInvisibleModule)
 	mm.RegisterModule(BlockBuilder, t.initBlockBuilder)
 	mm.RegisterModule(BlockBuilderScheduler, t.initBlockBuilderScheduler)
 	mm.RegisterModule(Compactor, t.initCompactor)
@@ -1265,11 +1417,15 @@ func (t *Mimir) setupModuleManager() error {
 	mm.RegisterModule(Ruler, t.initRuler)
 	mm.RegisterModule(RulerStorage, t.initRulerStorage, modules.UserInvisibleModule)
 	mm.RegisterModule(RuntimeConfig, t.initRuntimeConfig, modules.UserInvisibleModule)
+	mm.RegisterModule(RuntimeConfigTenants, t.initRuntimeConfigTenants, modules.UserInvisibleModule)
 	mm.RegisterModule(SanityCheck, t.initSanityCheck, modules.UserInvisibleModule)
 	mm.RegisterModule(Server, t.initServer, modules.UserInvisibleModule)
 	mm.RegisterModule(StoreGateway, t.initStoreGateway)
 	mm.RegisterModule(StoreQueryable, t.initStoreQueryable, modules.UserInvisibleModule)
 	mm.RegisterModule(TenantFederation, t.initTenantFederation, modules.UserInvisibleModule)
+	mm.RegisterModule(TenantLimitsStore, t.initTenantLimitsStore, modules.UserInvisibleModule)
+	mm.RegisterModule(TenantSets, t.initTenantSets, modules.UserInvisibleModule)
+	mm.RegisterModule(TenantUsage, t.initTenantUsage, modules.UserInvisibleModule)
 	mm.RegisterModule(UsageStats, t.initUsageStats, modules.UserInvisibleModule)
 	mm.RegisterModule(Vault, t.initVault, modules.UserInvisibleModule)
 
@@ -1282,25 +1438,25 @@ func (t *Mimir) setupModuleManager() error {
 	// Add dependencies
 	deps := map[string][]string{
 		//lint:sorted
-		API:                              {Server},
+		API:                              {Server, AuditLog},
 		AlertManager:                     {API, MemberlistKV, Overrides, Vault},
 		BlockBuilder:                     {API, Overrides},
 		BlockBuilderScheduler:            {API},
-		Compactor:                        {API, MemberlistKV, Overrides, Vault},
+		Compactor:                        {API, MemberlistKV, Overrides, Vault, TenantUsage},
 		ContinuousTest:                   {API},
 		CostAttributionService:           {API, Overrides},
 		Distributor:                      {DistributorService, API, ActiveGroupsCleanupService, Vault},
-		DistributorService:               {IngesterRing, IngesterPartitionRing, Overrides, Vault, CostAttributionService},
+		DistributorService:               {IngesterRing, IngesterPartitionRing, Overrides, Vault, CostAttributionService, TenantUsage},
 		Flusher:                          {Overrides, API},
 		Ingester:                         {IngesterService, API, ActiveGroupsCleanupService, Vault},
 		IngesterPartitionRing:            {MemberlistKV, IngesterRing, API},
 		IngesterRing:                     {API, RuntimeConfig, MemberlistKV, Vault},
-		IngesterService:                  {IngesterRing, IngesterPartitionRing, Overrides, RuntimeConfig, MemberlistKV, CostAttributionService},
+		IngesterService:                  {IngesterRing, IngesterPartitionRing, Overrides, RuntimeConfig, MemberlistKV, CostAttributionService, TenantUsage},
 		MemberlistKV:                     {API, Vault},
-		Overrides:                        {RuntimeConfig},
+		Overrides:                        {API, RuntimeConfig, RuntimeConfigTenants, TenantLimitsStore},
 		OverridesExporter:                {Overrides, MemberlistKV, Vault},
 		Querier:                          {TenantFederation, Vault},
-		QueryFrontend:                    {QueryFrontendTripperware, MemberlistKV, Vault},
+		QueryFrontend:                    {QueryFrontendTripperware, MemberlistKV, Vault, CostAttributionService, TenantSets, TenantUsage},
 		QueryFrontendTopicOffsetsReaders: {IngesterPartitionRing},
 		QueryFrontendTripperware:         {API, Overrides, QueryFrontendCodec, QueryFrontendTopicOffsetsReaders, QueryPlanner},
 		QueryPlanner:                     {API, ActivityTracker},
@@ -1309,10 +1465,14 @@ func (t *Mimir) setupModuleManager() error {
 		Ruler:                            {DistributorService, StoreQueryable, RulerStorage, Vault, QueryPlanner},
 		RulerStorage:                     {Overrides},
 		RuntimeConfig:                    {API},
+		RuntimeConfigTenants:             {API, RuntimeConfig},
 		Server:                           {ActivityTracker, SanityCheck, UsageStats},
 		StoreGateway:                     {API, Overrides, MemberlistKV, Vault},
 		StoreQueryable:                   {Overrides, MemberlistKV},
-		TenantFederation:                 {Queryable},
+		TenantFederation:                 {Queryable, TenantSets},
+		TenantLimitsStore:                {API, RuntimeConfig, RuntimeConfigTenants},
+		TenantSets:                       {API, Overrides},
+		TenantUsage:                      {API},
 
 		Backend: {QueryScheduler, Ruler, StoreGateway, Compactor, AlertManager, OverridesExporter},
 		Read:    {QueryFrontend, Querier},
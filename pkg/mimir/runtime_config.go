@@ -18,6 +18,7 @@ import (
 
 	"github.com/grafana/mimir/pkg/distributor"
 	"github.com/grafana/mimir/pkg/ingester"
+	"github.com/grafana/mimir/pkg/querier/tenantfederation"
 	"github.com/grafana/mimir/pkg/util"
 	"github.com/grafana/mimir/pkg/util/validation"
 )
@@ -38,6 +39,8 @@ type runtimeConfigValues struct {
 
 	IngesterLimits    *ingester.InstanceLimits    `yaml:"ingester_limits"`
 	DistributorLimits *distributor.InstanceLimits `yaml:"distributor_limits"`
+
+	TenantSets map[string]*tenantfederation.TenantSet `yaml:"tenant_sets"`
 }
 
 // runtimeConfigTenantLimits provides per-tenant limit overrides based on a runtimeconfig.Manager
@@ -235,5 +238,5 @@ func NewRuntimeManager(cfg *Config, name string, reg prometheus.Registerer, logg
 	validation.SetDefaultLimitsForYAMLUnmarshalling(cfg.LimitsConfig)
 	ingester.SetDefaultInstanceLimitsForYAMLUnmarshalling(cfg.Ingester.DefaultLimits)
 	distributor.SetDefaultInstanceLimitsForYAMLUnmarshalling(cfg.Distributor.DefaultLimits)
-	return runtimeconfig.New(cfg.RuntimeConfig, name, reg, logger)
+	return runtimeconfig.New(cfg.RuntimeConfig.Config, name, reg, logger)
 }
@@ -0,0 +1,298 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package mimir
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/runtimeconfig"
+	"github.com/grafana/dskit/services"
+	"github.com/grafana/dskit/tenant"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/thanos-io/objstore"
+	"gopkg.in/yaml.v3"
+
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+var (
+	errMultipleTenantSources = errors.New("the per-tenant runtime configuration files can't be loaded from both a directory and a bucket prefix")
+)
+
+// RuntimeConfigSources configures the runtime configuration files, and the per-tenant runtime configuration files.
+type RuntimeConfigSources struct {
+	runtimeconfig.Config `yaml:",inline"`
+
+	TenantsDir          string `yaml:"tenants_dir" category:"experimental"`
+	TenantsBucketPrefix string `yaml:"tenants_bucket_prefix" category:"experimental"`
+}
+
+// RegisterFlags registers flags.
+func (cfg *RuntimeConfigSources) RegisterFlags(f *flag.FlagSet) {
+	cfg.Config.RegisterFlags(f)
+
+	f.StringVar(&cfg.TenantsDir, "runtime-config.tenants-dir", "", "Directory containing one runtime configuration file per tenant, named <tenant>.yaml, holding the limits overrides of the tenant. The files are reloaded every -runtime-config.reload-period, and only the changed files are parsed again. An invalid file only affects its tenant, which keeps the limits of the last valid version of the file. The limits of a tenant file replace the overrides of the tenant in the runtime configuration files.")
+	f.StringVar(&cfg.TenantsBucketPrefix, "runtime-config.tenants-bucket-prefix", "", "Prefix in the blocks storage bucket containing one runtime configuration file per tenant, loaded the same way as the files of -runtime-config.tenants-dir.")
+}
+
+func (cfg *RuntimeConfigSources) Validate() error {
+	if cfg.TenantsDir != "" && cfg.TenantsBucketPrefix != "" {
+		return errMultipleTenantSources
+	}
+	return nil
+}
+
+// tenantsEnabled returns whether the per-tenant runtime configuration files are configured.
+func (cfg *RuntimeConfigSources) tenantsEnabled() bool {
+	return cfg.TenantsDir != "" || cfg.TenantsBucketPrefix != ""
+}
+
+// runtimeConfigTenants periodically loads the per-tenant runtime configuration files from a bucket, which is
+// either a directory or a bucket prefix. Only the files changed since they've been loaded are parsed again,
+// and an invalid file only affects its tenant, which keeps the limits of the last valid version of the file.
+// The limits of the tenant files replace the limits of the runtime configuration files.
+type runtimeConfigTenants struct {
+	services.Service
+
+	bkt        objstore.Bucket
+	validate   func(validation.Limits) error
+	fileLimits validation.TenantLimits
+	logger     log.Logger
+
+	mtx sync.RWMutex
+	// files holds the loaded tenant files, keyed by tenant.
+	files map[string]*runtimeConfigTenantFile
+
+	lastReloadSuccessful prometheus.Gauge
+	parsedFiles          prometheus.Counter
+	invalidFiles         prometheus.Gauge
+}
+
+type runtimeConfigTenantFile struct {
+	name      string
+	updatedAt time.Time
+	// limits holds the limits of the last valid version of the file, or nil if there's none.
+	limits *validation.Limits
+	// invalid is whether the last version of the file is invalid.
+	invalid bool
+}
+
+// newRuntimeConfigTenants creates a runtimeConfigTenants loading the tenant files from the bucket every
+// reloadPeriod, and falling back to fileLimits, which may be nil, for the tenants without a tenant file.
+func newRuntimeConfigTenants(bkt objstore.Bucket, reloadPeriod time.Duration, validate func(validation.Limits) error, fileLimits validation.TenantLimits, logger log.Logger, reg prometheus.Registerer) *runtimeConfigTenants {
+	r := &runtimeConfigTenants{
+		bkt:        bkt,
+		validate:   validate,
+		fileLimits: fileLimits,
+		logger:     log.With(logger, "component", "runtime-config-tenants"),
+		files:      map[string]*runtimeConfigTenantFile{},
+
+		lastReloadSuccessful: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "cortex_runtime_config_tenant_files_last_reload_successful",
+			Help: "Whether the last reload of the per-tenant runtime configuration files was successful.",
+		}),
+		parsedFiles: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_runtime_config_tenant_files_parsed_total",
+			Help: "Total number of per-tenant runtime configuration files parsed.",
+		}),
+		invalidFiles: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "cortex_runtime_config_tenant_files_invalid",
+			Help: "Number of per-tenant runtime configuration files whose last version is invalid.",
+		}),
+	}
+
+	r.Service = services.NewTimerService(reloadPeriod, r.starting, r.iteration, nil)
+	return r
+}
+
+func (r *runtimeConfigTenants) starting(ctx context.Context) error {
+	// The tenant files must be loaded before the limits are used.
+	if err := r.reload(ctx); err != nil {
+		return fmt.Errorf("failed to load the per-tenant runtime configuration files: %w", err)
+	}
+	return nil
+}
+
+func (r *runtimeConfigTenants) iteration(ctx context.Context) error {
+	if err := r.reload(ctx); err != nil {
+		level.Error(r.logger).Log("msg", "failed to reload the per-tenant runtime configuration files", "err", err)
+	}
+	return nil
+}
+
+// reload loads the tenant files which have been added or changed since the last reload, and forgets the
+// tenant files which have been removed.
+func (r *runtimeConfigTenants) reload(ctx context.Context) error {
+	updates, err := r.list(ctx)
+	if err != nil {
+		r.lastReloadSuccessful.Set(0)
+		return err
+	}
+
+	r.mtx.RLock()
+	previous := r.files
+	r.mtx.RUnlock()
+
+	files := make(map[string]*runtimeConfigTenantFile, len(updates))
+	invalid := 0
+	for name, updatedAt := range updates {
+		userID := strings.TrimSuffix(strings.TrimSuffix(name, ".yaml"), ".yml")
+		if err := tenant.ValidTenantID(userID); err != nil {
+			level.Warn(r.logger).Log("msg", "skipped per-tenant runtime configuration file with invalid tenant ID", "file", name, "err", err)
+			continue
+		}
+
+		file := previous[userID]
+		if file == nil || file.name != name || updatedAt.IsZero() || !updatedAt.Equal(file.updatedAt) {
+			file = r.load(ctx, userID, name, updatedAt, file)
+		}
+		if file.invalid {
+			invalid++
+		}
+		files[userID] = file
+	}
+
+	r.mtx.Lock()
+	r.files = files
+	r.mtx.Unlock()
+
+	r.invalidFiles.Set(float64(invalid))
+	r.lastReloadSuccessful.Set(1)
+	return nil
+}
+
+// list returns the tenant files of the bucket, with the time they've been last updated, if available.
+func (r *runtimeConfigTenants) list(ctx context.Context) (map[string]time.Time, error) {
+	files := map[string]time.Time{}
+	isTenantFile := func(name string) bool {
+		return path.Dir(name) == "." && (strings.HasSuffix(name, ".yaml") || strings.HasSuffix(name, ".yml"))
+	}
+
+	if slices.Contains(r.bkt.SupportedIterOptions(), objstore.UpdatedAt) {
+		err := r.bkt.IterWithAttributes(ctx, "", func(attrs objstore.IterObjectAttributes) error {
+			if isTenantFile(attrs.Name) {
+				files[attrs.Name], _ = attrs.LastModified()
+			}
+			return nil
+		}, objstore.WithUpdatedAt())
+		return files, err
+	}
+
+	err := r.bkt.Iter(ctx, "", func(name string) error {
+		if isTenantFile(name) {
+			files[name] = time.Time{}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for name := range files {
+		attrs, err := r.bkt.Attributes(ctx, name)
+		if err != nil {
+			if r.bkt.IsObjNotFoundErr(err) {
+				delete(files, name)
+				continue
+			}
+			return nil, err
+		}
+		files[name] = attrs.LastModified
+	}
+	return files, nil
+}
+
+// load parses the tenant file. If it's invalid, the limits of the previous version of the file are kept.
+func (r *runtimeConfigTenants) load(ctx context.Context, userID, name string, updatedAt time.Time, previous *runtimeConfigTenantFile) *runtimeConfigTenantFile {
+	r.parsedFiles.Inc()
+
+	file := &runtimeConfigTenantFile{name: name, updatedAt: updatedAt}
+	limits, err := r.parse(ctx, name)
+	if err != nil {
+		level.Warn(r.logger).Log("msg", "invalid per-tenant runtime configuration file, keeping the last valid limits of the tenant", "user", userID, "file", name, "err", err)
+		file.invalid = true
+		if previous != nil {
+			file.limits = previous.limits
+		}
+		return file
+	}
+
+	file.limits = limits
+	return file
+}
+
+func (r *runtimeConfigTenants) parse(ctx context.Context, name string) (*validation.Limits, error) {
+	reader, err := r.bkt.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = reader.Close() }()
+
+	decoder := yaml.NewDecoder(reader)
+	decoder.KnownFields(true)
+
+	// An empty file doesn't override any limit.
+	var limits *validation.Limits
+	if err := decoder.Decode(&limits); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if err := decoder.Decode(&validation.Limits{}); !errors.Is(err, io.EOF) {
+		return nil, errMultipleDocuments
+	}
+
+	if limits != nil && r.validate != nil {
+		if err := r.validate(*limits); err != nil {
+			return nil, err
+		}
+	}
+	return limits, nil
+}
+
+// ByUserID implements validation.TenantLimits.
+func (r *runtimeConfigTenants) ByUserID(userID string) *validation.Limits {
+	r.mtx.RLock()
+	file := r.files[userID]
+	r.mtx.RUnlock()
+
+	if file != nil && file.limits != nil {
+		return file.limits
+	}
+	if r.fileLimits == nil {
+		return nil
+	}
+	return r.fileLimits.ByUserID(userID)
+}
+
+// AllByUserID implements validation.TenantLimits.
+func (r *runtimeConfigTenants) AllByUserID() map[string]*validation.Limits {
+	all := map[string]*validation.Limits{}
+	if r.fileLimits != nil {
+		for userID, limits := range r.fileLimits.AllByUserID() {
+			all[userID] = limits
+		}
+	}
+
+	r.mtx.RLock()
+	for userID, file := range r.files {
+		if file.limits != nil {
+			all[userID] = file.limits
+		}
+	}
+	r.mtx.RUnlock()
+
+	if len(all) == 0 {
+		return nil
+	}
+	return all
+}
@@ -0,0 +1,106 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package mimir
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/storage/bucket/filesystem"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+func TestRuntimeConfigSources_Validate(t *testing.T) {
+	cfg := RuntimeConfigSources{TenantsDir: "/tenants"}
+	require.NoError(t, cfg.Validate())
+
+	cfg.TenantsBucketPrefix = "tenants"
+	require.ErrorIs(t, cfg.Validate(), errMultipleTenantSources)
+}
+
+func TestRuntimeConfigTenants(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	bkt, err := filesystem.NewBucketClient(filesystem.Config{Directory: dir})
+	require.NoError(t, err)
+
+	// Each write of a file gets a new modification time.
+	modTime := time.Now().Add(-time.Hour)
+	writeFile := func(name, content string) {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(p, []byte(content), 0o600))
+		modTime = modTime.Add(time.Second)
+		require.NoError(t, os.Chtimes(p, modTime, modTime))
+	}
+
+	fileLimits := getDefaultLimits()
+	fileLimits.IngestionRate = 100
+	runtimeConfigFileLimits := validation.NewMockTenantLimits(map[string]*validation.Limits{
+		"user-1": &fileLimits,
+		"user-3": &fileLimits,
+	})
+
+	validate := func(limits validation.Limits) error {
+		if limits.MaxGlobalSeriesPerUser < 0 {
+			return errors.New("invalid max global series per user")
+		}
+		return nil
+	}
+	reg := prometheus.NewPedanticRegistry()
+	tenants := newRuntimeConfigTenants(bkt, time.Minute, validate, runtimeConfigFileLimits, log.NewNopLogger(), reg)
+
+	writeFile("user-1.yaml", "ingestion_rate: 200\n")
+	writeFile("user-2.yml", "ingestion_rate: 300\n")
+	writeFile("user-4.yaml", "")
+	writeFile("README.md", "not a tenant file")
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "nested"), 0o700))
+	writeFile("nested/user-5.yaml", "ingestion_rate: 500\n")
+	require.NoError(t, tenants.reload(ctx))
+
+	// The tenant files replace the limits of the runtime config files.
+	assert.Equal(t, float64(200), tenants.ByUserID("user-1").IngestionRate)
+	assert.Equal(t, float64(300), tenants.ByUserID("user-2").IngestionRate)
+	assert.Same(t, &fileLimits, tenants.ByUserID("user-3"))
+	// An empty tenant file doesn't override any limit.
+	assert.Nil(t, tenants.ByUserID("user-4"))
+	assert.Nil(t, tenants.ByUserID("user-5"))
+	assert.Len(t, tenants.AllByUserID(), 3)
+
+	// Only the changed files are parsed again.
+	writeFile("user-2.yml", "ingestion_rate: 400\n")
+	require.NoError(t, tenants.reload(ctx))
+	assert.Equal(t, float64(400), tenants.ByUserID("user-2").IngestionRate)
+	assert.Equal(t, float64(4), testutil.ToFloat64(tenants.parsedFiles))
+
+	// An invalid file only affects its tenant, which keeps the last valid limits.
+	writeFile("user-1.yaml", "max_global_series_per_user: -1\n")
+	writeFile("user-2.yml", "unknown_limit: 1\n")
+	writeFile("user-3.yaml", "ingestion_rate: 600\n")
+	require.NoError(t, tenants.reload(ctx))
+	assert.Equal(t, float64(200), tenants.ByUserID("user-1").IngestionRate)
+	assert.Equal(t, float64(400), tenants.ByUserID("user-2").IngestionRate)
+	assert.Equal(t, float64(600), tenants.ByUserID("user-3").IngestionRate)
+	assert.Equal(t, float64(2), testutil.ToFloat64(tenants.invalidFiles))
+
+	// The invalid files aren't parsed again until they change.
+	require.NoError(t, tenants.reload(ctx))
+	assert.Equal(t, float64(7), testutil.ToFloat64(tenants.parsedFiles))
+
+	// The removed tenant files don't override the limits anymore.
+	require.NoError(t, os.Remove(filepath.Join(dir, "user-1.yaml")))
+	writeFile("user-2.yml", "ingestion_rate: 700\n")
+	require.NoError(t, tenants.reload(ctx))
+	assert.Same(t, &fileLimits, tenants.ByUserID("user-1"))
+	assert.Equal(t, float64(700), tenants.ByUserID("user-2").IngestionRate)
+	assert.Equal(t, float64(0), testutil.ToFloat64(tenants.invalidFiles))
+}
@@ -254,3 +254,38 @@ func getDefaultLimits() validation.Limits {
 	flagext.DefaultValues(&limits)
 	return limits
 }
+
+func TestRuntimeConfigLoader_ShouldLoadTenantSets(t *testing.T) {
+	yamlFile := strings.NewReader(`
+overrides:
+  prod-a:
+    ingestion_rate: 1500
+  prod-b:
+    ingestion_rate: 1500
+  dev-a:
+    ingestion_rate: 1500
+tenant_sets:
+  prod:
+    match: prod-.*
+    tenants: [legacy]
+    allowed_principals: [sre]
+`)
+
+	loader := &runtimeConfigLoader{}
+	runtimeCfg, err := loader.load(yamlFile)
+	require.NoError(t, err)
+
+	sets := runtimeCfg.(*runtimeConfigValues).TenantSets
+	require.Len(t, sets, 1)
+	require.Equal(t, []string{"legacy"}, sets["prod"].Tenants)
+	require.Equal(t, []string{"sre"}, sets["prod"].AllowedPrincipals)
+
+	t.Run("invalid match regular expression", func(t *testing.T) {
+		_, err := loader.load(strings.NewReader(`
+tenant_sets:
+  prod:
+    match: prod-(
+`))
+		require.ErrorContains(t, err, "invalid match regular expression in tenant set")
+	})
+}
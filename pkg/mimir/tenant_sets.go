@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package mimir
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/runtimeconfig"
+	"github.com/grafana/dskit/services"
+
+	"github.com/grafana/mimir/pkg/querier/tenantfederation"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+// runtimeConfigTenantSets provides the tenant sets used by tenant federation based on a runtimeconfig.Manager.
+// The tenants known to the cluster are the tenants having blocks in the bucket, refreshed periodically, and the
+// tenants having per-tenant limits, from any source of per-tenant limits.
+type runtimeConfigTenantSets struct {
+	services.Service
+
+	manager *runtimeconfig.Manager
+	// tenantLimits returns the per-tenant limits, which are set up after the runtime config.
+	tenantLimits func() validation.TenantLimits
+	// scanTenants returns the tenants having blocks in the bucket.
+	scanTenants func(ctx context.Context) ([]string, error)
+	logger      log.Logger
+
+	mtx           sync.RWMutex
+	bucketTenants []string
+}
+
+// newTenantSets creates a new tenantfederation.TenantSetsProvider that loads tenant sets from
+// a runtimeconfig.Manager, and refreshes the tenants of the bucket every refreshInterval.
+func newTenantSets(manager *runtimeconfig.Manager, tenantLimits func() validation.TenantLimits, scanTenants func(ctx context.Context) ([]string, error), refreshInterval time.Duration, logger log.Logger) *runtimeConfigTenantSets {
+	s := &runtimeConfigTenantSets{
+		manager:      manager,
+		tenantLimits: tenantLimits,
+		scanTenants:  scanTenants,
+		logger:       log.With(logger, "component", "tenant-sets"),
+	}
+
+	s.Service = services.NewTimerService(refreshInterval, s.refresh, s.refresh, nil)
+	return s
+}
+
+// refresh updates the tenants of the bucket. A failure keeps the previous tenants, so that it doesn't prevent
+// the tenant sets from being used.
+func (s *runtimeConfigTenantSets) refresh(ctx context.Context) error {
+	tenants, err := s.scanTenants(ctx)
+	if err != nil {
+		level.Warn(s.logger).Log("msg", "failed to list the tenants of the bucket for the tenant sets", "err", err)
+		return nil
+	}
+
+	s.mtx.Lock()
+	s.bucketTenants = tenants
+	s.mtx.Unlock()
+	return nil
+}
+
+func (s *runtimeConfigTenantSets) TenantSets() map[string]*tenantfederation.TenantSet {
+	cfg, ok := s.manager.GetConfig().(*runtimeConfigValues)
+	if cfg != nil && ok {
+		return cfg.TenantSets
+	}
+
+	return nil
+}
+
+func (s *runtimeConfigTenantSets) KnownTenants() []string {
+	s.mtx.RLock()
+	tenants := slices.Clone(s.bucketTenants)
+	s.mtx.RUnlock()
+
+	if limits := s.tenantLimits(); limits != nil {
+		for userID := range limits.AllByUserID() {
+			tenants = append(tenants, userID)
+		}
+	}
+
+	slices.Sort(tenants)
+	return slices.Compact(tenants)
+}
@@ -0,0 +1,43 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package mimir
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+func TestRuntimeConfigTenantSets_KnownTenants(t *testing.T) {
+	ctx := context.Background()
+
+	var tenantLimits validation.TenantLimits
+	bucketTenants := []string{"tenant-b", "tenant-a"}
+	var scanErr error
+	scanTenants := func(context.Context) ([]string, error) {
+		return bucketTenants, scanErr
+	}
+	s := newTenantSets(nil, func() validation.TenantLimits { return tenantLimits }, scanTenants, time.Minute, log.NewNopLogger())
+
+	// The tenants of the bucket are known once listed, even without limits overrides.
+	assert.Empty(t, s.KnownTenants())
+	require.NoError(t, s.refresh(ctx))
+	assert.Equal(t, []string{"tenant-a", "tenant-b"}, s.KnownTenants())
+
+	// The tenants having limits overrides, from any source, are known too.
+	limits := validation.MockDefaultLimits()
+	tenantLimits = validation.NewMockTenantLimits(map[string]*validation.Limits{"tenant-b": limits, "tenant-c": limits})
+	assert.Equal(t, []string{"tenant-a", "tenant-b", "tenant-c"}, s.KnownTenants())
+
+	// A failure to list the bucket keeps the previous tenants.
+	bucketTenants, scanErr = nil, errors.New("unavailable")
+	require.NoError(t, s.refresh(ctx))
+	assert.Equal(t, []string{"tenant-a", "tenant-b", "tenant-c"}, s.KnownTenants())
+}
@@ -241,6 +241,10 @@ func (p *PreallocTimeseries) HistogramsUpdated() {
 	p.clearUnmarshalData()
 }
 
+func (p *PreallocTimeseries) ExemplarsUpdated() {
+	p.clearUnmarshalData()
+}
+
 // DeleteExemplarByMovingLast deletes the exemplar by moving the last one on top and shortening the slice.
 func (p *PreallocTimeseries) DeleteExemplarByMovingLast(ix int) {
 	last := len(p.Exemplars) - 1
@@ -34,8 +34,10 @@ func (c *RuntimeConfigCommand) validate(*kingpin.ParseContext) error {
 	}
 
 	mimirCfg := mimir.Config{
-		RuntimeConfig: runtimeconfig.Config{
-			LoadPath: flagext.StringSliceCSV{c.configFile},
+		RuntimeConfig: mimir.RuntimeConfigSources{
+			Config: runtimeconfig.Config{
+				LoadPath: flagext.StringSliceCSV{c.configFile},
+			},
 		},
 	}
 	mimirCfg.RegisterFlags(flag.NewFlagSet("", flag.PanicOnError), log.NewNopLogger())
@@ -4,6 +4,8 @@ package api
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"slices"
 	"strconv"
@@ -250,3 +252,39 @@ func EncodeOffsets(offsets map[int32]int64) EncodedOffsets {
 
 	return EncodedOffsets(unsafe.String(unsafe.SliceData(buffer), len(buffer)))
 }
+
+// DecodeOffsets parses the input offsets, encoded with EncodeOffsets.
+func DecodeOffsets(encoded EncodedOffsets) (map[int32]int64, error) {
+	const version = "v1="
+
+	value, ok := strings.CutPrefix(string(encoded), version)
+	if !ok {
+		return nil, fmt.Errorf("unsupported encoding of the partition offsets %q", encoded)
+	}
+
+	if value == "" {
+		return nil, errors.New("no partition offsets")
+	}
+
+	offsets := map[int32]int64{}
+	for _, entry := range strings.Split(value, ",") {
+		partitionValue, offsetValue, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid partition offset %q", entry)
+		}
+
+		partitionID, err := strconv.ParseInt(partitionValue, 10, 32)
+		if err != nil || partitionID < 0 {
+			return nil, fmt.Errorf("invalid partition ID in partition offset %q", entry)
+		}
+
+		offset, err := strconv.ParseInt(offsetValue, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid offset in partition offset %q", entry)
+		}
+
+		offsets[int32(partitionID)] = offset
+	}
+
+	return offsets, nil
+}
@@ -237,6 +237,39 @@ func TestEncodeOffsets(t *testing.T) {
 	})
 }
 
+func TestDecodeOffsets(t *testing.T) {
+	t.Run("should decode the offsets encoded with EncodeOffsets", func(t *testing.T) {
+		for _, offsets := range []map[int32]int64{
+			{0: 1000},
+			{1: 1, 2: 2, 10: 9, 123: 456},
+			{123: 321, 456: -1},
+			generateTestOffsets(100),
+		} {
+			actual, err := DecodeOffsets(EncodeOffsets(offsets))
+			require.NoError(t, err)
+			assert.Equal(t, offsets, actual)
+		}
+	})
+
+	t.Run("should fail on invalid offsets", func(t *testing.T) {
+		for _, encoded := range []EncodedOffsets{
+			"",
+			"v1=",
+			"v2=1:1",
+			"1:1",
+			"v1=1",
+			"v1=1:1,",
+			"v1=a:1",
+			"v1=-1:1",
+			"v1=1:a",
+			"v1=1:1,2",
+		} {
+			_, err := DecodeOffsets(encoded)
+			assert.Error(t, err, "encoded offsets: %q", encoded)
+		}
+	})
+}
+
 func TestEncodedOffsets_Lookup_SpecialCases(t *testing.T) {
 	tests := map[string]struct {
 		encoded              EncodedOffsets
@@ -0,0 +1,248 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querier
+
+import (
+	"context"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/oklog/ulid/v2"
+	"github.com/pkg/errors"
+
+	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
+	"github.com/grafana/mimir/pkg/storegateway/storegatewaypb"
+	"github.com/grafana/mimir/pkg/storegateway/storepb"
+	"github.com/grafana/mimir/pkg/util"
+)
+
+// getAlternateClient returns a store-gateway client, other than c and the store-gateways already queried
+// for the blocks, holding all the input blocks. It returns nil if the blocks are not all held by a single
+// other store-gateway.
+func (q *blocksStoreQuerier) getAlternateClient(tenantID string, c BlocksStoreClient, blockIDs []ulid.ULID, remainingBlocks bucketindex.Blocks, attemptedBlocks map[ulid.ULID][]string) BlocksStoreClient {
+	blocks := make(bucketindex.Blocks, 0, len(blockIDs))
+	exclude := make(map[ulid.ULID][]string, len(blockIDs))
+
+	for _, b := range remainingBlocks {
+		if !slices.Contains(blockIDs, b.ID) {
+			continue
+		}
+
+		blocks = append(blocks, b)
+		exclude[b.ID] = append(slices.Clone(attemptedBlocks[b.ID]), c.RemoteAddress())
+	}
+
+	if len(blocks) != len(blockIDs) {
+		return nil
+	}
+
+	clients, err := q.stores.GetClientsFor(tenantID, blocks, exclude)
+	if err != nil || len(clients) != 1 {
+		return nil
+	}
+
+	for alternate := range clients {
+		return alternate
+	}
+	return nil
+}
+
+// hedgingDelay returns the delay after which a series request to a store-gateway is hedged for the tenant.
+// The returned bool is false if hedging is disabled, or not enough latencies have been observed yet.
+func (q *blocksStoreQuerier) hedgingDelay(tenantID string) (time.Duration, bool) {
+	percentile := q.limits.StoreGatewayHedgingPercentile(tenantID)
+	if percentile <= 0 {
+		return 0, false
+	}
+
+	delay, ok := q.latencyTracker.Percentile(percentile)
+	if !ok {
+		return 0, false
+	}
+
+	return max(delay, q.hedgingMinDelay), true
+}
+
+type seriesStreamResult struct {
+	client BlocksStoreClient
+	cancel context.CancelFunc
+	stream storegatewaypb.StoreGateway_SeriesClient
+	first  *storepb.SeriesResponse
+	err    error
+}
+
+func (r seriesStreamResult) close() {
+	r.cancel()
+
+	if r.stream != nil {
+		util.CloseAndExhaust[*storepb.SeriesResponse](r.stream) //nolint:errcheck
+	}
+}
+
+// openSeriesStream sends the series request to the store-gateway c. If hedging is enabled for the tenant, it waits
+// for the first response in order to track the store-gateway latency and, if the store-gateway doesn't respond
+// within the hedging delay, the request is also sent to another store-gateway holding the same blocks. The first
+// store-gateway to respond is returned, together with its stream, while the request to the other one is canceled.
+func (q *blocksStoreQuerier) openSeriesStream(ctx context.Context, logger log.Logger, c BlocksStoreClient, alternateClient alternateClientFunc, req *storepb.SeriesRequest, tenantID string, blockIDs []ulid.ULID) (BlocksStoreClient, storegatewaypb.StoreGateway_SeriesClient, error) {
+	if q.latencyTracker == nil {
+		stream, err := c.Series(ctx, req)
+		return c, stream, err
+	}
+
+	if alternateClient == nil || q.limits.StoreGatewayHedgingPercentile(tenantID) <= 0 {
+		// The latency is still tracked, when the first response is received by the caller.
+		start := time.Now()
+		stream, err := c.Series(ctx, req)
+		if err != nil {
+			q.latencyTracker.Observe(c.RemoteAddress(), time.Since(start), ctx.Err() == nil)
+			return c, nil, err
+		}
+		return c, &latencyTrackingSeriesClient{StoreGateway_SeriesClient: stream, ctx: ctx, tracker: q.latencyTracker, addr: c.RemoteAddress(), start: start}, nil
+	}
+
+	var (
+		results = make(chan seriesStreamResult, 2)
+		cancels = map[BlocksStoreClient]context.CancelFunc{}
+	)
+
+	send := func(client BlocksStoreClient) {
+		// The context of the stream returned to the caller is canceled together with the parent context.
+		streamCtx, cancel := context.WithCancel(ctx)
+		cancels[client] = cancel
+
+		go func() {
+			start := time.Now()
+			res := seriesStreamResult{client: client, cancel: cancel}
+
+			if stream, err := client.Series(streamCtx, req); err != nil {
+				res.err = err
+			} else {
+				res.stream = stream
+				res.first, res.err = stream.Recv()
+			}
+
+			// A canceled request is not a failure of the store-gateway, but it tells it's slower than the other one.
+			failed := res.err != nil && !errors.Is(res.err, io.EOF) && streamCtx.Err() == nil
+			q.latencyTracker.Observe(client.RemoteAddress(), time.Since(start), failed)
+
+			results <- res
+		}()
+	}
+
+	send(c)
+	inflight := 1
+
+	var hedgeTimer <-chan time.Time
+	if delay, ok := q.hedgingDelay(tenantID); ok {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		hedgeTimer = timer.C
+	}
+
+	for {
+		select {
+		case <-hedgeTimer:
+			hedgeTimer = nil
+
+			alternate := alternateClient(c, blockIDs)
+			if alternate == nil {
+				level.Debug(logger).Log("msg", "no store-gateway available to hedge the series request", "remote", c.RemoteAddress())
+				continue
+			}
+
+			level.Debug(logger).Log("msg", "hedging series request", "remote", c.RemoteAddress(), "hedged_remote", alternate.RemoteAddress())
+			q.metrics.hedgedRequests.Inc()
+			send(alternate)
+			inflight++
+
+		case res := <-results:
+			inflight--
+
+			// If the request failed while the other one is still in flight, wait for the other one.
+			if res.err != nil && !errors.Is(res.err, io.EOF) && inflight > 0 {
+				level.Warn(logger).Log("msg", "failed to fetch series while the hedged request is in flight", "remote", res.client.RemoteAddress(), "err", res.err)
+				res.close()
+				continue
+			}
+
+			if res.client != c {
+				q.metrics.hedgedRequestsWon.Inc()
+			}
+
+			if inflight > 0 {
+				for client, cancel := range cancels {
+					if client != res.client {
+						cancel()
+					}
+				}
+
+				go func() {
+					loser := <-results
+					loser.close()
+				}()
+			}
+
+			if res.stream == nil {
+				res.cancel()
+				return res.client, nil, res.err
+			}
+
+			return res.client, &peekedSeriesClient{StoreGateway_SeriesClient: res.stream, cancel: res.cancel, first: res.first, firstErr: res.err}, nil
+		}
+	}
+}
+
+// peekedSeriesClient is a StoreGateway_SeriesClient returning the already received first response of
+// the stream before the next ones. The context of the stream is canceled once the stream is done.
+type peekedSeriesClient struct {
+	storegatewaypb.StoreGateway_SeriesClient
+
+	cancel   context.CancelFunc
+	first    *storepb.SeriesResponse
+	firstErr error
+	consumed bool
+}
+
+func (c *peekedSeriesClient) Recv() (*storepb.SeriesResponse, error) {
+	var (
+		msg *storepb.SeriesResponse
+		err error
+	)
+
+	if !c.consumed {
+		c.consumed = true
+		msg, err = c.first, c.firstErr
+	} else {
+		msg, err = c.StoreGateway_SeriesClient.Recv()
+	}
+
+	if err != nil {
+		c.cancel()
+	}
+	return msg, err
+}
+
+// latencyTrackingSeriesClient is a StoreGateway_SeriesClient tracking the latency of the store-gateway
+// when the first response of the stream is received.
+type latencyTrackingSeriesClient struct {
+	storegatewaypb.StoreGateway_SeriesClient
+
+	ctx      context.Context
+	tracker  *storeGatewayLatencyTracker
+	addr     string
+	start    time.Time
+	observed bool
+}
+
+func (c *latencyTrackingSeriesClient) Recv() (*storepb.SeriesResponse, error) {
+	msg, err := c.StoreGateway_SeriesClient.Recv()
+	if !c.observed {
+		c.observed = true
+		failed := err != nil && !errors.Is(err, io.EOF) && c.ctx.Err() == nil
+		c.tracker.Observe(c.addr, time.Since(c.start), failed)
+	}
+	return msg, err
+}
@@ -0,0 +1,313 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querier
+
+import (
+	"context"
+	"io"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	"github.com/grafana/mimir/pkg/mimirpb"
+	"github.com/grafana/mimir/pkg/storage/tsdb/bucketindex"
+	"github.com/grafana/mimir/pkg/storegateway/storegatewaypb"
+	"github.com/grafana/mimir/pkg/storegateway/storepb"
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+)
+
+func TestBlocksStoreQuerier_OpenSeriesStream(t *testing.T) {
+	const tenantID = "user-1"
+
+	var (
+		block1      = ulid.MustNew(1, nil)
+		minT        = int64(10)
+		metricLabel = "test_metric"
+	)
+
+	newClient := func(addr string, delay time.Duration) *delayedStoreGatewayClientMock {
+		return &delayedStoreGatewayClientMock{
+			storeGatewayClientMock: storeGatewayClientMock{
+				remoteAddr: addr,
+				mockedSeriesResponses: []*storepb.SeriesResponse{
+					mockSeriesResponse(labels.FromStrings(labels.MetricName, metricLabel, "addr", addr), minT, 1),
+					mockHintsResponse(block1),
+				},
+			},
+			delay: delay,
+		}
+	}
+
+	tests := map[string]struct {
+		hedgingPercentile  float64
+		primaryDelay       time.Duration
+		alternateAvailable bool
+		expectedAddr       string
+		expectedHedged     int
+		expectedHedgedWon  int
+	}{
+		"hedging disabled": {
+			hedgingPercentile:  0,
+			primaryDelay:       200 * time.Millisecond,
+			alternateAvailable: true,
+			expectedAddr:       "primary",
+		},
+		"primary store-gateway responding before the hedging delay": {
+			hedgingPercentile:  90,
+			primaryDelay:       0,
+			alternateAvailable: true,
+			expectedAddr:       "primary",
+		},
+		"primary store-gateway slower than the hedging delay": {
+			hedgingPercentile:  90,
+			primaryDelay:       5 * time.Second,
+			alternateAvailable: true,
+			expectedAddr:       "alternate",
+			expectedHedged:     1,
+			expectedHedgedWon:  1,
+		},
+		"no alternate store-gateway holding the blocks": {
+			hedgingPercentile:  90,
+			primaryDelay:       200 * time.Millisecond,
+			alternateAvailable: false,
+			expectedAddr:       "primary",
+		},
+	}
+
+	for name, testData := range tests {
+		t.Run(name, func(t *testing.T) {
+			tracker := newStoreGatewayLatencyTracker()
+			for i := 0; i < storeGatewayLatencyMinSamples; i++ {
+				tracker.Observe("other", time.Millisecond, false)
+			}
+
+			reg := prometheus.NewPedanticRegistry()
+			q := &blocksStoreQuerier{
+				limits:          &blocksStoreLimitsMock{storeGatewayHedgingPercentile: testData.hedgingPercentile},
+				metrics:         newBlocksStoreQueryableMetrics(reg),
+				logger:          log.NewNopLogger(),
+				latencyTracker:  tracker,
+				hedgingMinDelay: 20 * time.Millisecond,
+			}
+
+			primary := newClient("primary", testData.primaryDelay)
+			alternate := newClient("alternate", 0)
+			alternateClient := func(c BlocksStoreClient, blockIDs []ulid.ULID) BlocksStoreClient {
+				assert.Equal(t, primary, c)
+				assert.Equal(t, []ulid.ULID{block1}, blockIDs)
+
+				if !testData.alternateAvailable {
+					return nil
+				}
+				return alternate
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			t.Cleanup(cancel)
+
+			c, stream, err := q.openSeriesStream(ctx, log.NewNopLogger(), primary, alternateClient, &storepb.SeriesRequest{}, tenantID, []ulid.ULID{block1})
+			require.NoError(t, err)
+			assert.Equal(t, testData.expectedAddr, c.RemoteAddress())
+
+			// The first response, received to track the latency, is returned by the stream.
+			resp, err := stream.Recv()
+			require.NoError(t, err)
+			require.NotNil(t, resp.GetSeries())
+			assert.Equal(t, labels.FromStrings(labels.MetricName, metricLabel, "addr", testData.expectedAddr), mimirpb.FromLabelAdaptersToLabels(resp.GetSeries().Labels))
+
+			resp, err = stream.Recv()
+			require.NoError(t, err)
+			require.NotNil(t, resp.GetHints())
+
+			// The context of the stream is canceled once the stream is done.
+			_, err = stream.Recv()
+			require.ErrorIs(t, err, io.EOF)
+			winner := primary
+			if testData.expectedAddr == alternate.RemoteAddress() {
+				winner = alternate
+			}
+
+			assert.Equal(t, float64(testData.expectedHedged), testutil.ToFloat64(q.metrics.hedgedRequests))
+			assert.Equal(t, float64(testData.expectedHedgedWon), testutil.ToFloat64(q.metrics.hedgedRequestsWon))
+
+			assert.Greater(t, tracker.Score(testData.expectedAddr), 0.0)
+
+			if testData.hedgingPercentile <= 0 {
+				// The stream is returned without waiting for its first response.
+				assert.IsType(t, &latencyTrackingSeriesClient{}, stream)
+				return
+			}
+			assert.Error(t, winner.seriesCtx.Err())
+		})
+	}
+}
+
+func TestBlocksStoreQuerier_OpenSeriesStream_ShouldReturnTheHedgedRequestIfThePrimaryOneFails(t *testing.T) {
+	tracker := newStoreGatewayLatencyTracker()
+	for i := 0; i < storeGatewayLatencyMinSamples; i++ {
+		tracker.Observe("other", time.Millisecond, false)
+	}
+
+	q := &blocksStoreQuerier{
+		limits:          &blocksStoreLimitsMock{storeGatewayHedgingPercentile: 90},
+		metrics:         newBlocksStoreQueryableMetrics(prometheus.NewPedanticRegistry()),
+		logger:          log.NewNopLogger(),
+		latencyTracker:  tracker,
+		hedgingMinDelay: 20 * time.Millisecond,
+	}
+
+	block1 := ulid.MustNew(1, nil)
+	primary := &delayedStoreGatewayClientMock{
+		storeGatewayClientMock: storeGatewayClientMock{remoteAddr: "primary", mockedSeriesErr: context.DeadlineExceeded},
+		delay:                  200 * time.Millisecond,
+	}
+	alternate := &delayedStoreGatewayClientMock{
+		storeGatewayClientMock: storeGatewayClientMock{remoteAddr: "alternate", mockedSeriesResponses: []*storepb.SeriesResponse{mockHintsResponse(block1)}},
+		delay:                  400 * time.Millisecond,
+	}
+
+	c, stream, err := q.openSeriesStream(context.Background(), log.NewNopLogger(), primary, func(BlocksStoreClient, []ulid.ULID) BlocksStoreClient {
+		return alternate
+	}, &storepb.SeriesRequest{}, "user-1", []ulid.ULID{block1})
+	require.NoError(t, err)
+	assert.Equal(t, "alternate", c.RemoteAddress())
+
+	resp, err := stream.Recv()
+	require.NoError(t, err)
+	require.NotNil(t, resp.GetHints())
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(q.metrics.hedgedRequestsWon))
+
+	// The failure of the primary store-gateway has been tracked.
+	assert.Greater(t, tracker.Score("primary"), tracker.Score("alternate"))
+}
+
+func TestBlocksStoreQuerier_FetchSeriesFromStores_ShouldTrackAllTheBlocksQueriedOnTheStoreGatewayServingTheHedgedRequest(t *testing.T) {
+	tracker := newStoreGatewayLatencyTracker()
+	for i := 0; i < storeGatewayLatencyMinSamples; i++ {
+		tracker.Observe("other", time.Millisecond, false)
+	}
+
+	q := &blocksStoreQuerier{
+		limits:          &blocksStoreLimitsMock{storeGatewayHedgingPercentile: 90},
+		metrics:         newBlocksStoreQueryableMetrics(prometheus.NewPedanticRegistry()),
+		logger:          log.NewNopLogger(),
+		latencyTracker:  tracker,
+		hedgingMinDelay: 20 * time.Millisecond,
+	}
+
+	block1 := ulid.MustNew(1, nil)
+	block2 := ulid.MustNew(2, nil)
+	primary := &delayedStoreGatewayClientMock{
+		storeGatewayClientMock: storeGatewayClientMock{remoteAddr: "primary", mockedSeriesResponses: []*storepb.SeriesResponse{mockHintsResponse(block1)}},
+		delay:                  5 * time.Second,
+	}
+	// The alternate store-gateway of the blocks of the primary one is also queried for other blocks.
+	other := &storeGatewayClientMock{remoteAddr: "other", mockedSeriesResponses: []*storepb.SeriesResponse{mockHintsResponse(block1, block2)}}
+	alternateClient := func(c BlocksStoreClient, _ []ulid.ULID) BlocksStoreClient {
+		if c == primary {
+			return other
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	clients := map[BlocksStoreClient][]ulid.ULID{primary: {block1}, other: {block2}}
+	_, _, queriedClients, _, _, _, err := q.fetchSeriesFromStores(ctx, &storage.SelectHints{}, clients, alternateClient, 0, 10, "user-1", nil)
+	require.NoError(t, err)
+	require.Len(t, queriedClients, 1)
+	assert.ElementsMatch(t, []ulid.ULID{block1, block2}, queriedClients[other])
+}
+
+func TestBlocksStoreQuerier_QueryWithConsistencyCheck_ShouldExcludeTheStoreGatewayWhichServedTheHedgedRequest(t *testing.T) {
+	const tenantID = "user-1"
+
+	block1 := ulid.MustNew(1, nil)
+	primary := &storeGatewayClientMock{remoteAddr: "primary"}
+	alternate := &storeGatewayClientMock{remoteAddr: "alternate"}
+	other := &storeGatewayClientMock{remoteAddr: "other"}
+
+	stores := &excludeRecordingStoreSetMock{blocksStoreSetMock: blocksStoreSetMock{mockedResponses: []interface{}{
+		map[BlocksStoreClient][]ulid.ULID{primary: {block1}},
+		map[BlocksStoreClient][]ulid.ULID{other: {block1}},
+	}}}
+	finder := &blocksFinderMock{}
+	finder.On("GetBlocks", mock.Anything, tenantID, int64(0), int64(10)).Return(bucketindex.Blocks{{ID: block1}}, nil)
+
+	reg := prometheus.NewPedanticRegistry()
+	q := &blocksStoreQuerier{
+		finder:             finder,
+		stores:             stores,
+		dynamicReplication: newDynamicReplication(),
+		consistency:        NewBlocksConsistency(0, reg),
+		logger:             log.NewNopLogger(),
+		metrics:            newBlocksStoreQueryableMetrics(reg),
+		limits:             &blocksStoreLimitsMock{},
+	}
+
+	attempt := 0
+	queryF := func(clients map[BlocksStoreClient][]ulid.ULID, _ alternateClientFunc, _, _ int64) ([]ulid.ULID, map[BlocksStoreClient][]ulid.ULID, error) {
+		attempt++
+		if attempt == 1 {
+			// The request to the primary store-gateway has been hedged, and the alternate one has served it without the block.
+			return nil, map[BlocksStoreClient][]ulid.ULID{alternate: clients[primary]}, nil
+		}
+		return clients[other], clients, nil
+	}
+
+	ctx := context.Background()
+	require.NoError(t, q.queryWithConsistencyCheck(ctx, spanlogger.FromContext(ctx, log.NewNopLogger()), 0, 10, tenantID, nil, queryF))
+	require.Len(t, stores.excludes, 2)
+	assert.Empty(t, stores.excludes[0])
+	assert.Equal(t, map[ulid.ULID][]string{block1: {"alternate"}}, stores.excludes[1])
+}
+
+// excludeRecordingStoreSetMock is a blocksStoreSetMock recording the store-gateways excluded at each call.
+type excludeRecordingStoreSetMock struct {
+	blocksStoreSetMock
+
+	excludes []map[ulid.ULID][]string
+}
+
+func (m *excludeRecordingStoreSetMock) GetClientsFor(tenantID string, blocks bucketindex.Blocks, exclude map[ulid.ULID][]string) (map[BlocksStoreClient][]ulid.ULID, error) {
+	excluded := make(map[ulid.ULID][]string, len(exclude))
+	for id, addrs := range exclude {
+		excluded[id] = slices.Clone(addrs)
+	}
+	m.excludes = append(m.excludes, excluded)
+
+	return m.blocksStoreSetMock.GetClientsFor(tenantID, blocks, exclude)
+}
+
+// delayedStoreGatewayClientMock is a storeGatewayClientMock responding to series requests after a delay.
+type delayedStoreGatewayClientMock struct {
+	storeGatewayClientMock
+
+	delay     time.Duration
+	seriesCtx context.Context
+}
+
+func (m *delayedStoreGatewayClientMock) Series(ctx context.Context, req *storepb.SeriesRequest, opts ...grpc.CallOption) (storegatewaypb.StoreGateway_SeriesClient, error) {
+	m.seriesCtx = ctx
+
+	select {
+	case <-time.After(m.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	return m.storeGatewayClientMock.Series(ctx, req, opts...)
+}
@@ -0,0 +1,167 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querier
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/grafana/dskit/ring"
+)
+
+const (
+	// storeGatewayLatencyEWMAWeight is the weight given to the latest observation when updating
+	// the exponentially weighted moving averages of a store-gateway latency and error rate.
+	storeGatewayLatencyEWMAWeight = 0.2
+
+	// storeGatewayLatencyHalfLife is the period after which the score of a store-gateway which has
+	// not been queried is halved. Decaying the score ensures that a store-gateway which was slow
+	// in the past is eventually queried again, so that its latency can be re-evaluated.
+	storeGatewayLatencyHalfLife = 30 * time.Second
+
+	// storeGatewayErrorPenalty is the multiplier applied to the error rate of a store-gateway when
+	// computing its score, so that an instance failing requests is ranked after slower instances.
+	storeGatewayErrorPenalty = 10
+
+	// storeGatewayLatencySamples is the number of recent latency observations used to compute
+	// the latency percentiles.
+	storeGatewayLatencySamples = 512
+
+	// storeGatewayLatencyMinSamples is the minimum number of latency observations required to
+	// compute a latency percentile.
+	storeGatewayLatencyMinSamples = 20
+)
+
+// storeGatewayLatencyTracker tracks the time it takes for store-gateways to send the first response
+// to a series request. It keeps an exponentially weighted moving average of the latency and error
+// rate of each store-gateway, used to rank the replicas holding a block, and a window of the recent
+// observations across all store-gateways, used to compute the hedging delay.
+type storeGatewayLatencyTracker struct {
+	mtx       sync.Mutex
+	instances map[string]*storeGatewayLatencyStats
+	samples   []time.Duration
+	next      int
+
+	now func() time.Time
+}
+
+type storeGatewayLatencyStats struct {
+	latency    float64 // Seconds.
+	errorRate  float64
+	lastUpdate time.Time
+}
+
+func newStoreGatewayLatencyTracker() *storeGatewayLatencyTracker {
+	return &storeGatewayLatencyTracker{
+		instances: map[string]*storeGatewayLatencyStats{},
+		samples:   make([]time.Duration, 0, storeGatewayLatencySamples),
+		now:       time.Now,
+	}
+}
+
+// Observe records the latency of a request to the store-gateway at addr, and whether it failed.
+func (t *storeGatewayLatencyTracker) Observe(addr string, latency time.Duration, failed bool) {
+	if t == nil {
+		return
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	errorValue := 0.0
+	if failed {
+		errorValue = 1
+	}
+
+	stats, ok := t.instances[addr]
+	if !ok {
+		t.instances[addr] = &storeGatewayLatencyStats{
+			latency:    latency.Seconds(),
+			errorRate:  errorValue,
+			lastUpdate: t.now(),
+		}
+	} else {
+		stats.latency += storeGatewayLatencyEWMAWeight * (latency.Seconds() - stats.latency)
+		stats.errorRate += storeGatewayLatencyEWMAWeight * (errorValue - stats.errorRate)
+		stats.lastUpdate = t.now()
+	}
+
+	// Failed requests don't tell how long a successful response takes.
+	if failed {
+		return
+	}
+
+	if len(t.samples) < storeGatewayLatencySamples {
+		t.samples = append(t.samples, latency)
+	} else {
+		t.samples[t.next] = latency
+		t.next = (t.next + 1) % storeGatewayLatencySamples
+	}
+}
+
+// Score returns the score of the store-gateway at addr. Store-gateways with a lower score are expected
+// to respond faster. Store-gateways which have never been queried have a score of 0.
+func (t *storeGatewayLatencyTracker) Score(addr string) float64 {
+	if t == nil {
+		return 0
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	return t.scoreLocked(addr)
+}
+
+func (t *storeGatewayLatencyTracker) scoreLocked(addr string) float64 {
+	stats, ok := t.instances[addr]
+	if !ok {
+		return 0
+	}
+
+	decay := math.Pow(0.5, float64(t.now().Sub(stats.lastUpdate))/float64(storeGatewayLatencyHalfLife))
+	return stats.latency * (1 + storeGatewayErrorPenalty*stats.errorRate) * decay
+}
+
+// SortByScore sorts the instances by increasing score, preserving the order of the instances
+// with the same score.
+func (t *storeGatewayLatencyTracker) SortByScore(instances []ring.InstanceDesc) {
+	if t == nil || len(instances) < 2 {
+		return
+	}
+
+	t.mtx.Lock()
+	scores := make(map[string]float64, len(instances))
+	for _, instance := range instances {
+		scores[instance.Addr] = t.scoreLocked(instance.Addr)
+	}
+	t.mtx.Unlock()
+
+	slices.SortStableFunc(instances, func(a, b ring.InstanceDesc) int {
+		return cmp.Compare(scores[a.Addr], scores[b.Addr])
+	})
+}
+
+// Percentile returns the given percentile of the recently observed latencies. The returned bool is
+// false if not enough latencies have been observed yet.
+func (t *storeGatewayLatencyTracker) Percentile(percentile float64) (time.Duration, bool) {
+	if t == nil {
+		return 0, false
+	}
+
+	t.mtx.Lock()
+	if len(t.samples) < storeGatewayLatencyMinSamples {
+		t.mtx.Unlock()
+		return 0, false
+	}
+	samples := slices.Clone(t.samples)
+	t.mtx.Unlock()
+
+	slices.Sort(samples)
+
+	idx := int(math.Ceil(percentile/100*float64(len(samples)))) - 1
+	idx = max(0, min(idx, len(samples)-1))
+	return samples[idx], true
+}
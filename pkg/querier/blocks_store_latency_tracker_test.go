@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querier
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/dskit/ring"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreGatewayLatencyTracker_Score(t *testing.T) {
+	now := time.Now()
+	tracker := newStoreGatewayLatencyTracker()
+	tracker.now = func() time.Time { return now }
+
+	// Store-gateways which have never been queried are preferred, so that their latency gets tracked.
+	assert.Equal(t, 0.0, tracker.Score("unknown"))
+
+	tracker.Observe("fast", 10*time.Millisecond, false)
+	tracker.Observe("slow", 100*time.Millisecond, false)
+	tracker.Observe("failing", 10*time.Millisecond, true)
+
+	assert.InDelta(t, 0.01, tracker.Score("fast"), 1e-9)
+	assert.InDelta(t, 0.1, tracker.Score("slow"), 1e-9)
+	assert.Greater(t, tracker.Score("failing"), tracker.Score("slow"))
+
+	// The moving average moves towards the latest observations.
+	tracker.Observe("slow", 10*time.Millisecond, false)
+	assert.InDelta(t, 0.082, tracker.Score("slow"), 1e-9)
+
+	// The score of store-gateways which have not been queried recently decays.
+	now = now.Add(storeGatewayLatencyHalfLife)
+	assert.InDelta(t, 0.041, tracker.Score("slow"), 1e-9)
+}
+
+func TestStoreGatewayLatencyTracker_SortByScore(t *testing.T) {
+	tracker := newStoreGatewayLatencyTracker()
+	tracker.Observe("slow", 100*time.Millisecond, false)
+	tracker.Observe("fast", 10*time.Millisecond, false)
+
+	instances := []ring.InstanceDesc{{Addr: "slow"}, {Addr: "fast"}, {Addr: "unknown-1"}, {Addr: "unknown-2"}}
+	tracker.SortByScore(instances)
+	assert.Equal(t, []ring.InstanceDesc{{Addr: "unknown-1"}, {Addr: "unknown-2"}, {Addr: "fast"}, {Addr: "slow"}}, instances)
+
+	// A nil tracker doesn't change the order.
+	var nilTracker *storeGatewayLatencyTracker
+	instances = []ring.InstanceDesc{{Addr: "slow"}, {Addr: "fast"}}
+	nilTracker.SortByScore(instances)
+	assert.Equal(t, []ring.InstanceDesc{{Addr: "slow"}, {Addr: "fast"}}, instances)
+}
+
+func TestStoreGatewayLatencyTracker_Percentile(t *testing.T) {
+	tracker := newStoreGatewayLatencyTracker()
+
+	for i := 1; i < storeGatewayLatencyMinSamples; i++ {
+		tracker.Observe("instance", time.Duration(i)*time.Millisecond, false)
+	}
+
+	// Failed requests are not taken into account.
+	tracker.Observe("instance", time.Hour, true)
+
+	_, ok := tracker.Percentile(90)
+	require.False(t, ok, "not enough samples")
+
+	for i := storeGatewayLatencyMinSamples; i <= 100; i++ {
+		tracker.Observe("instance", time.Duration(i)*time.Millisecond, false)
+	}
+
+	p, ok := tracker.Percentile(90)
+	require.True(t, ok)
+	assert.Equal(t, 90*time.Millisecond, p)
+
+	p, ok = tracker.Percentile(100)
+	require.True(t, ok)
+	assert.Equal(t, 100*time.Millisecond, p)
+
+	// Only the most recent samples are kept.
+	for i := 0; i < storeGatewayLatencySamples; i++ {
+		tracker.Observe("instance", time.Second, false)
+	}
+
+	p, ok = tracker.Percentile(1)
+	require.True(t, ok)
+	assert.Equal(t, time.Second, p)
+}
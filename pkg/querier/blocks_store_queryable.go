@@ -94,6 +94,7 @@ type BlocksStoreLimits interface {
 	MaxLabelsQueryLength(userID string) time.Duration
 	MaxChunksPerQuery(userID string) int
 	StoreGatewayTenantShardSize(userID string) int
+	StoreGatewayHedgingPercentile(userID string) float64
 }
 
 type blocksStoreQueryableMetrics struct {
@@ -105,6 +106,9 @@ type blocksStoreQueryableMetrics struct {
 	blocksWithCompactorShardButIncompatibleQueryShard prometheus.Counter
 	// The total number of chunks received from store-gateways that were used to evaluate queries
 	chunksTotal prometheus.Counter
+
+	hedgedRequests    prometheus.Counter
+	hedgedRequestsWon prometheus.Counter
 }
 
 func newBlocksStoreQueryableMetrics(reg prometheus.Registerer) *blocksStoreQueryableMetrics {
@@ -136,6 +140,14 @@ func newBlocksStoreQueryableMetrics(reg prometheus.Registerer) *blocksStoreQuery
 			Name: "cortex_querier_query_storegateway_chunks_total",
 			Help: "Number of chunks received from store gateways at query time.",
 		}),
+		hedgedRequests: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_querier_storegateway_hedged_requests_total",
+			Help: "Number of hedged series requests sent to store-gateways because the store-gateway initially queried was slower than the hedging delay.",
+		}),
+		hedgedRequestsWon: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_querier_storegateway_hedged_requests_won_total",
+			Help: "Number of hedged series requests to store-gateways which responded before the store-gateway initially queried.",
+		}),
 	}
 }
 
@@ -153,6 +165,10 @@ type BlocksStoreQueryable struct {
 	limits                   BlocksStoreLimits
 	streamingChunksBatchSize uint64
 
+	// Latency of the store-gateways, used to compute the delay after which series requests are hedged.
+	latencyTracker  *storeGatewayLatencyTracker
+	hedgingMinDelay time.Duration
+
 	// Subservices manager.
 	subservices        *services.Manager
 	subservicesWatcher *services.FailureWatcher
@@ -250,7 +266,14 @@ func NewBlocksStoreQueryableFromConfig(querierCfg Config, gatewayCfg storegatewa
 		)
 	}
 
-	stores, err = newBlocksStoreReplicationSet(storesRing, randomLoadBalancing, dynamicReplication, limits, querierCfg.StoreGatewayClient, logger, reg)
+	latencyTracker := newStoreGatewayLatencyTracker()
+
+	var replicaSelectionLatencyTracker *storeGatewayLatencyTracker
+	if querierCfg.StoreGatewayLatencyAwareReplicaSelection {
+		replicaSelectionLatencyTracker = latencyTracker
+	}
+
+	stores, err = newBlocksStoreReplicationSet(storesRing, randomLoadBalancing, dynamicReplication, limits, replicaSelectionLatencyTracker, querierCfg.StoreGatewayClient, logger, reg)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create store set")
 	}
@@ -264,7 +287,15 @@ func NewBlocksStoreQueryableFromConfig(querierCfg Config, gatewayCfg storegatewa
 
 	streamingBufferSize := querierCfg.StreamingChunksPerStoreGatewaySeriesBufferSize
 
-	return NewBlocksStoreQueryable(stores, dynamicReplication, finder, consistency, limits, querierCfg.QueryStoreAfter, streamingBufferSize, logger, reg)
+	q, err := NewBlocksStoreQueryable(stores, dynamicReplication, finder, consistency, limits, querierCfg.QueryStoreAfter, streamingBufferSize, logger, reg)
+	if err != nil {
+		return nil, err
+	}
+
+	q.latencyTracker = latencyTracker
+	q.hedgingMinDelay = querierCfg.StoreGatewayHedgingMinDelay
+
+	return q, nil
 }
 
 func (q *BlocksStoreQueryable) starting(ctx context.Context) error {
@@ -310,6 +341,8 @@ func (q *BlocksStoreQueryable) Querier(mint, maxt int64) (storage.Querier, error
 		consistency:              q.consistency,
 		logger:                   q.logger,
 		queryStoreAfter:          q.queryStoreAfter,
+		latencyTracker:           q.latencyTracker,
+		hedgingMinDelay:          q.hedgingMinDelay,
 	}, nil
 }
 
@@ -328,6 +361,10 @@ type blocksStoreQuerier struct {
 	// "now - queryStoreAfter" so that most recent blocks are not queried.
 	queryStoreAfter time.Duration
 
+	// If set, series requests are hedged after the tenant's percentile of the store-gateway latencies.
+	latencyTracker  *storeGatewayLatencyTracker
+	hedgingMinDelay time.Duration
+
 	streamReadersMtx sync.Mutex
 	closed           bool
 	streamReaders    []*storeGatewayStreamReader
@@ -370,16 +407,16 @@ func (q *blocksStoreQuerier) LabelNames(ctx context.Context, hints *storage.Labe
 		convertedMatchers = convertMatchersToLabelMatcher(matchers)
 	)
 
-	queryF := func(clients map[BlocksStoreClient][]ulid.ULID, minT, maxT int64) ([]ulid.ULID, error) {
+	queryF := func(clients map[BlocksStoreClient][]ulid.ULID, _ alternateClientFunc, minT, maxT int64) ([]ulid.ULID, map[BlocksStoreClient][]ulid.ULID, error) {
 		nameSets, warnings, queriedBlocks, err := q.fetchLabelNamesFromStore(ctx, clients, minT, maxT, tenantID, hints, convertedMatchers)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		resNameSets = append(resNameSets, nameSets...)
 		resWarnings.Merge(warnings)
 
-		return queriedBlocks, nil
+		return queriedBlocks, clients, nil
 	}
 
 	if err := q.queryWithConsistencyCheck(ctx, spanLog, minT, maxT, tenantID, nil, queryF); err != nil {
@@ -414,16 +451,16 @@ func (q *blocksStoreQuerier) LabelValues(ctx context.Context, name string, hints
 		resWarnings  annotations.Annotations
 	)
 
-	queryF := func(clients map[BlocksStoreClient][]ulid.ULID, minT, maxT int64) ([]ulid.ULID, error) {
+	queryF := func(clients map[BlocksStoreClient][]ulid.ULID, _ alternateClientFunc, minT, maxT int64) ([]ulid.ULID, map[BlocksStoreClient][]ulid.ULID, error) {
 		valueSets, warnings, queriedBlocks, err := q.fetchLabelValuesFromStore(ctx, name, clients, minT, maxT, tenantID, hints, matchers...)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		resValueSets = append(resValueSets, valueSets...)
 		resWarnings.Merge(warnings)
 
-		return queriedBlocks, nil
+		return queriedBlocks, clients, nil
 	}
 
 	if err := q.queryWithConsistencyCheck(ctx, spanLog, minT, maxT, tenantID, nil, queryF); err != nil {
@@ -466,10 +503,10 @@ func (q *blocksStoreQuerier) selectSorted(ctx context.Context, sp *storage.Selec
 		return storage.ErrSeriesSet(err)
 	}
 
-	queryF := func(clients map[BlocksStoreClient][]ulid.ULID, minT, maxT int64) ([]ulid.ULID, error) {
-		seriesSets, queriedBlocks, warnings, streamReaders, chunkEstimator, err := q.fetchSeriesFromStores(ctx, sp, clients, minT, maxT, tenantID, convertedMatchers)
+	queryF := func(clients map[BlocksStoreClient][]ulid.ULID, alternateClient alternateClientFunc, minT, maxT int64) ([]ulid.ULID, map[BlocksStoreClient][]ulid.ULID, error) {
+		seriesSets, queriedBlocks, queriedClients, warnings, streamReaders, chunkEstimator, err := q.fetchSeriesFromStores(ctx, sp, clients, alternateClient, minT, maxT, tenantID, convertedMatchers)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		resSeriesSets = append(resSeriesSets, seriesSets...)
@@ -477,7 +514,7 @@ func (q *blocksStoreQuerier) selectSorted(ctx context.Context, sp *storage.Selec
 		resStreamReaders = append(resStreamReaders, streamReaders...)
 		chunkEstimators = append(chunkEstimators, chunkEstimator)
 
-		return queriedBlocks, nil
+		return queriedBlocks, queriedClients, nil
 	}
 
 	err = q.queryWithConsistencyCheck(ctx, spanLog, minT, maxT, tenantID, shard, queryF)
@@ -535,7 +572,14 @@ func (q *blocksStoreQuerier) startBuffering(streamReaders []*storeGatewayStreamR
 	return nil
 }
 
-type queryFunc func(clients map[BlocksStoreClient][]ulid.ULID, minT, maxT int64) ([]ulid.ULID, error)
+// queryFunc queries the blocks from the store-gateway clients. The alternateClient function can be used
+// to find another store-gateway holding the same blocks as one of the clients. It returns the queried blocks,
+// and the store-gateways which have actually been queried for each block.
+type queryFunc func(clients map[BlocksStoreClient][]ulid.ULID, alternateClient alternateClientFunc, minT, maxT int64) ([]ulid.ULID, map[BlocksStoreClient][]ulid.ULID, error)
+
+// alternateClientFunc returns a store-gateway client, other than the input one, holding all the input blocks.
+// It returns nil if there's no such store-gateway.
+type alternateClientFunc func(c BlocksStoreClient, blockIDs []ulid.ULID) BlocksStoreClient
 
 func (q *blocksStoreQuerier) queryWithConsistencyCheck(
 	ctx context.Context, spanLog *spanlogger.SpanLogger, minT, maxT int64, tenantID string, shard *sharding.ShardSelector, queryF queryFunc,
@@ -616,14 +660,19 @@ func (q *blocksStoreQuerier) queryWithConsistencyCheck(
 
 		// Fetch series from stores. If an error occur we do not retry because retries
 		// are only meant to cover missing blocks.
-		queriedBlocks, err := queryF(clients, minT, maxT)
+		alternateClient := func(c BlocksStoreClient, blockIDs []ulid.ULID) BlocksStoreClient {
+			return q.getAlternateClient(tenantID, c, blockIDs, remainingBlocks, attemptedBlocks)
+		}
+
+		queriedBlocks, queriedClients, err := queryF(clients, alternateClient, minT, maxT)
 		if err != nil {
 			return err
 		}
 		spanLog.DebugLog("msg", "received series from all store-gateways", "queried blocks", strings.Join(convertULIDsToString(queriedBlocks), " "))
 
-		// Update the map of blocks we attempted to query.
-		for client, blockIDs := range clients {
+		// Update the map of blocks we attempted to query. A hedged request may have been served by
+		// another store-gateway than the one the blocks have been assigned to.
+		for client, blockIDs := range queriedClients {
 			touchedStores[client.RemoteAddress()] = struct{}{}
 
 			for _, blockID := range blockIDs {
@@ -759,7 +808,8 @@ func canBlockWithCompactorShardIndexContainQueryShard(queryShardIndex, queryShar
 // when all the concurrent fetches terminate with no exception, fetchSeriesFromStores returns:
 //  1. a slice of fetched storage.SeriesSet
 //  2. a slice of ulid.ULID corresponding to the queried blocks
-//  3. annotations.Annotations encountered during the operation
+//  3. the store-gateways which have served the series, which may differ from clients when requests are hedged
+//  4. annotations.Annotations encountered during the operation
 //
 // In case of a serious error during any of the concurrent executions, the error is returned.
 // Errors while creating storepb.SeriesRequest, context cancellation, and unprocessable
@@ -769,7 +819,7 @@ func canBlockWithCompactorShardIndexContainQueryShard(queryShardIndex, queryShar
 // In case of a successful run, fetchSeriesFromStores returns a startStreamingChunks function to start streaming
 // chunks for the fetched series iff it was a streaming call for series+chunks. startStreamingChunks must be called
 // before iterating on the series.
-func (q *blocksStoreQuerier) fetchSeriesFromStores(ctx context.Context, sp *storage.SelectHints, clients map[BlocksStoreClient][]ulid.ULID, minT int64, maxT int64, tenantID string, convertedMatchers []storepb.LabelMatcher) (_ []storage.SeriesSet, _ []ulid.ULID, _ annotations.Annotations, streamReaders []*storeGatewayStreamReader, estimateChunks func() int, _ error) {
+func (q *blocksStoreQuerier) fetchSeriesFromStores(ctx context.Context, sp *storage.SelectHints, clients map[BlocksStoreClient][]ulid.ULID, alternateClient alternateClientFunc, minT int64, maxT int64, tenantID string, convertedMatchers []storepb.LabelMatcher) (_ []storage.SeriesSet, _ []ulid.ULID, queriedClients map[BlocksStoreClient][]ulid.ULID, _ annotations.Annotations, streamReaders []*storeGatewayStreamReader, estimateChunks func() int, _ error) {
 	var (
 		// We deliberately only cancel this context if any store-gateway call fails, to ensure that all streams are aborted promptly.
 		// When all calls succeed, we rely on the parent context being cancelled, otherwise we'd abort all the store-gateway streams returned by this method, which makes them unusable.
@@ -787,6 +837,7 @@ func (q *blocksStoreQuerier) fetchSeriesFromStores(ctx context.Context, sp *stor
 		memoryTracker = limiter.MemoryTrackerFromContextWithFallback(ctx)
 	)
 
+	queriedClients = make(map[BlocksStoreClient][]ulid.ULID, len(clients))
 	debugQuery := chunkinfologger.IsChunkInfoLoggingEnabled(ctx)
 
 	// Concurrently fetch series from all clients.
@@ -807,7 +858,11 @@ func (q *blocksStoreQuerier) fetchSeriesFromStores(ctx context.Context, sp *stor
 				return errors.Wrapf(err, "failed to create series request")
 			}
 
-			stream, err := c.Series(reqCtx, req)
+			c, stream, err := q.openSeriesStream(reqCtx, log, c, alternateClient, req, tenantID, blockIDs)
+			mtx.Lock()
+			// A hedged request may have been served by a store-gateway already queried for other blocks.
+			queriedClients[c] = append(queriedClients[c], blockIDs...)
+			mtx.Unlock()
 			if err == nil {
 				mtx.Lock()
 				streams = append(streams, stream)
@@ -948,7 +1003,7 @@ func (q *blocksStoreQuerier) fetchSeriesFromStores(ctx context.Context, sp *stor
 				level.Warn(q.logger).Log("msg", "closing store-gateway client stream failed", "err", err)
 			}
 		}
-		return nil, nil, nil, nil, nil, err
+		return nil, nil, nil, nil, nil, nil, err
 	}
 
 	estimateChunks = func() int {
@@ -961,7 +1016,7 @@ func (q *blocksStoreQuerier) fetchSeriesFromStores(ctx context.Context, sp *stor
 		return totalChunks
 	}
 
-	return seriesSets, queriedBlocks, warnings, streamReaders, estimateChunks, nil //nolint:govet // It's OK to return without cancelling reqCtx, see comment above.
+	return seriesSets, queriedBlocks, queriedClients, warnings, streamReaders, estimateChunks, nil //nolint:govet // It's OK to return without cancelling reqCtx, see comment above.
 }
 
 func (q *blocksStoreQuerier) receiveMessage(c BlocksStoreClient, stream storegatewaypb.StoreGateway_SeriesClient, queryLimiter *limiter.QueryLimiter, mySeries []*storepb.Series, myWarnings annotations.Annotations, myQueriedBlocks []ulid.ULID, myStreamingSeriesLabels []labels.Labels, indexBytesFetched uint64) ([]*storepb.Series, annotations.Annotations, []ulid.ULID, []labels.Labels, uint64, bool, bool, error) {
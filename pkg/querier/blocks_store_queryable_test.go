@@ -3390,6 +3390,7 @@ type blocksStoreLimitsMock struct {
 	maxLabelsQueryLength            time.Duration
 	maxChunksPerQuery               int
 	storeGatewayTenantShardSize     int
+	storeGatewayHedgingPercentile   float64
 	storeGatewayExpandedReplication bool
 }
 
@@ -3405,6 +3406,10 @@ func (m *blocksStoreLimitsMock) StoreGatewayTenantShardSize(_ string) int {
 	return m.storeGatewayTenantShardSize
 }
 
+func (m *blocksStoreLimitsMock) StoreGatewayHedgingPercentile(_ string) float64 {
+	return m.storeGatewayHedgingPercentile
+}
+
 func (m *blocksStoreLimitsMock) StoreGatewayExpandedReplication(_ string) bool {
 	return m.storeGatewayExpandedReplication
 }
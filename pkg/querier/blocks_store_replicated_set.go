@@ -43,6 +43,9 @@ type blocksStoreReplicationSet struct {
 	dynamicReplication storegateway.DynamicReplication
 	limits             BlocksStoreLimits
 
+	// If set, the replicas of a block are ordered by their observed latency and error rate.
+	latencyTracker *storeGatewayLatencyTracker
+
 	// Subservices manager.
 	subservices        *services.Manager
 	subservicesWatcher *services.FailureWatcher
@@ -53,6 +56,7 @@ func newBlocksStoreReplicationSet(
 	balancingStrategy loadBalancingStrategy,
 	dynamicReplication storegateway.DynamicReplication,
 	limits BlocksStoreLimits,
+	latencyTracker *storeGatewayLatencyTracker,
 	clientConfig grpcclient.Config,
 	logger log.Logger,
 	reg prometheus.Registerer,
@@ -63,6 +67,7 @@ func newBlocksStoreReplicationSet(
 		dynamicReplication: dynamicReplication,
 		balancingStrategy:  balancingStrategy,
 		limits:             limits,
+		latencyTracker:     latencyTracker,
 		subservicesWatcher: services.NewFailureWatcher(),
 	}
 
@@ -121,7 +126,7 @@ func (s *blocksStoreReplicationSet) GetClientsFor(userID string, blocks bucketin
 		}
 
 		// Pick a non excluded store-gateway instance.
-		inst := getNonExcludedInstance(set, exclude[block.ID], s.balancingStrategy)
+		inst := getNonExcludedInstance(set, exclude[block.ID], s.balancingStrategy, s.latencyTracker)
 		if inst == nil {
 			return nil, fmt.Errorf("no store-gateway instance left after checking exclude for block %s", block.ID)
 		}
@@ -145,7 +150,7 @@ func (s *blocksStoreReplicationSet) GetClientsFor(userID string, blocks bucketin
 	return clients, nil
 }
 
-func getNonExcludedInstance(set ring.ReplicationSet, exclude []string, balancingStrategy loadBalancingStrategy) *ring.InstanceDesc {
+func getNonExcludedInstance(set ring.ReplicationSet, exclude []string, balancingStrategy loadBalancingStrategy, latencyTracker *storeGatewayLatencyTracker) *ring.InstanceDesc {
 	if balancingStrategy == randomLoadBalancing {
 		// Randomize the list of instances to not always query the same one.
 		rand.Shuffle(len(set.Instances), func(i, j int) {
@@ -153,6 +158,10 @@ func getNonExcludedInstance(set ring.ReplicationSet, exclude []string, balancing
 		})
 	}
 
+	// Prefer the instances which have been responding faster. The sorting is stable, so the load
+	// is still randomly balanced between the instances with the same score.
+	latencyTracker.SortByScore(set.Instances)
+
 	for _, instance := range set.Instances {
 		if !util.StringsContain(exclude, instance.Addr) {
 			return &instance
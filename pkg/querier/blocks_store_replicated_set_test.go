@@ -357,7 +357,7 @@ func TestBlocksStoreReplicationSet_GetClientsFor(t *testing.T) {
 			}
 
 			reg := prometheus.NewPedanticRegistry()
-			s, err := newBlocksStoreReplicationSet(r, noLoadBalancing, storegateway.NewNopDynamicReplication(ringCfg.ReplicationFactor), limits, grpcclient.Config{}, log.NewNopLogger(), reg)
+			s, err := newBlocksStoreReplicationSet(r, noLoadBalancing, storegateway.NewNopDynamicReplication(ringCfg.ReplicationFactor), limits, nil, grpcclient.Config{}, log.NewNopLogger(), reg)
 			require.NoError(t, err)
 			require.NoError(t, services.StartAndAwaitRunning(ctx, s))
 			defer services.StopAndAwaitTerminated(ctx, s) //nolint:errcheck
@@ -427,7 +427,7 @@ func TestBlocksStoreReplicationSet_GetClientsFor_ShouldSupportRandomLoadBalancin
 
 	limits := &blocksStoreLimitsMock{storeGatewayTenantShardSize: 0}
 	reg := prometheus.NewPedanticRegistry()
-	s, err := newBlocksStoreReplicationSet(r, randomLoadBalancing, storegateway.NewNopDynamicReplication(ringCfg.ReplicationFactor), limits, grpcclient.Config{}, log.NewNopLogger(), reg)
+	s, err := newBlocksStoreReplicationSet(r, randomLoadBalancing, storegateway.NewNopDynamicReplication(ringCfg.ReplicationFactor), limits, nil, grpcclient.Config{}, log.NewNopLogger(), reg)
 	require.NoError(t, err)
 	require.NoError(t, services.StartAndAwaitRunning(ctx, s))
 	defer services.StopAndAwaitTerminated(ctx, s) //nolint:errcheck
@@ -467,6 +467,82 @@ func TestBlocksStoreReplicationSet_GetClientsFor_ShouldSupportRandomLoadBalancin
 	}
 }
 
+func TestBlocksStoreReplicationSet_GetClientsFor_ShouldPreferInstancesWithLowerLatency(t *testing.T) {
+	const (
+		numRuns      = 100
+		numInstances = 3
+	)
+
+	ctx := context.Background()
+	userID := "user-A"
+	registeredAt := time.Now()
+
+	minT := time.Now().Add(-5 * time.Hour)
+	maxT := minT.Add(2 * time.Hour)
+	block1 := newBlock(ulid.MustNew(1, nil), minT, maxT)
+
+	// Create a ring.
+	ringStore, closer := consul.NewInMemoryClient(ring.GetCodec(), log.NewNopLogger(), nil)
+	t.Cleanup(func() { assert.NoError(t, closer.Close()) })
+
+	require.NoError(t, ringStore.CAS(ctx, "test", func(interface{}) (interface{}, bool, error) {
+		d := ring.NewDesc()
+		for n := 1; n <= numInstances; n++ {
+			d.AddIngester(fmt.Sprintf("instance-%d", n), fmt.Sprintf("127.0.0.%d", n), "", []uint32{uint32(n)}, ring.ACTIVE, registeredAt, false, time.Time{})
+		}
+		return d, true, nil
+	}))
+
+	// Configure a replication factor equal to the number of instances, so that every store-gateway gets all blocks.
+	ringCfg := ring.Config{}
+	flagext.DefaultValues(&ringCfg)
+	ringCfg.ReplicationFactor = numInstances
+
+	r, err := ring.NewWithStoreClientAndStrategy(ringCfg, "test", "test", ringStore, ring.NewIgnoreUnhealthyInstancesReplicationStrategy(), nil, log.NewNopLogger())
+	require.NoError(t, err)
+
+	// The second instance has the lowest latency, while the third one is failing requests.
+	latencyTracker := newStoreGatewayLatencyTracker()
+	latencyTracker.Observe("127.0.0.1", 100*time.Millisecond, false)
+	latencyTracker.Observe("127.0.0.2", 10*time.Millisecond, false)
+	latencyTracker.Observe("127.0.0.3", 10*time.Millisecond, true)
+
+	limits := &blocksStoreLimitsMock{storeGatewayTenantShardSize: 0}
+	reg := prometheus.NewPedanticRegistry()
+	s, err := newBlocksStoreReplicationSet(r, randomLoadBalancing, storegateway.NewNopDynamicReplication(ringCfg.ReplicationFactor), limits, latencyTracker, grpcclient.Config{}, log.NewNopLogger(), reg)
+	require.NoError(t, err)
+	require.NoError(t, services.StartAndAwaitRunning(ctx, s))
+	defer services.StopAndAwaitTerminated(ctx, s) //nolint:errcheck
+
+	// Wait until the ring client has initialised the state.
+	test.Poll(t, time.Second, true, func() interface{} {
+		all, err := r.GetAllHealthy(storegateway.BlocksRead)
+		return err == nil && len(all.Instances) > 0
+	})
+
+	// Close all clients to ensure no goroutines are leaked.
+	closeClients := func(clients map[BlocksStoreClient][]ulid.ULID) {
+		for c := range clients {
+			c.(io.Closer).Close() //nolint:errcheck
+		}
+	}
+
+	for n := 0; n < numRuns; n++ {
+		clients, err := s.GetClientsFor(userID, []*bucketindex.Block{block1}, nil)
+		require.NoError(t, err)
+		closeClients(clients)
+		require.Len(t, clients, 1)
+		assert.Contains(t, getStoreGatewayClientAddrs(clients), "127.0.0.2")
+
+		// When the fastest instance is excluded, the next fastest one is picked.
+		clients, err = s.GetClientsFor(userID, []*bucketindex.Block{block1}, map[ulid.ULID][]string{block1.ID: {"127.0.0.2"}})
+		require.NoError(t, err)
+		closeClients(clients)
+		require.Len(t, clients, 1)
+		assert.Contains(t, getStoreGatewayClientAddrs(clients), "127.0.0.1")
+	}
+}
+
 func getStoreGatewayClientAddrs(clients map[BlocksStoreClient][]ulid.ULID) map[string][]ulid.ULID {
 	addrs := map[string][]ulid.ULID{}
 	for c, blockIDs := range clients {
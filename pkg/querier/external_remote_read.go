@@ -0,0 +1,354 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querier
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/tenant"
+	"github.com/hashicorp/golang-lru/v2/simplelru"
+	config_util "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	prom_remote "github.com/prometheus/prometheus/storage/remote"
+	"github.com/prometheus/prometheus/util/annotations"
+
+	"github.com/grafana/mimir/pkg/querier/stats"
+	"github.com/grafana/mimir/pkg/storage/series"
+	"github.com/grafana/mimir/pkg/util/limiter"
+	"github.com/grafana/mimir/pkg/util/spanlogger"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+const externalRemoteReadStorageName = "external-remote-read"
+
+// ExternalRemoteReadConfig configures the queries to the external Prometheus-compatible remote read
+// endpoints, configured on a per-tenant basis.
+type ExternalRemoteReadConfig struct {
+	Timeout          time.Duration `yaml:"timeout" category:"experimental"`
+	ChunkedReadLimit uint64        `yaml:"chunked_read_limit" category:"experimental"`
+	MaxClients       int           `yaml:"max_clients" category:"experimental"`
+}
+
+func (cfg *ExternalRemoteReadConfig) RegisterFlags(f *flag.FlagSet) {
+	f.DurationVar(&cfg.Timeout, "querier.external-remote-read.timeout", 30*time.Second, "Timeout for remote read requests to the external remote read endpoint configured for a tenant.")
+	f.Uint64Var(&cfg.ChunkedReadLimit, "querier.external-remote-read.chunked-read-limit", 50*1024*1024, "Maximum size in bytes of a single chunked remote read response frame received from an external remote read endpoint. 0 to disable the limit.")
+	f.IntVar(&cfg.MaxClients, "querier.external-remote-read.max-clients", 100, "Maximum number of clients of the external remote read endpoints kept by the querier. A client is kept for each distinct endpoint URL and credentials. When the limit is reached, the least recently used client is closed.")
+}
+
+func (cfg *ExternalRemoteReadConfig) Validate() error {
+	if cfg.MaxClients <= 0 {
+		return errors.New("the external remote read max clients must be greater than 0")
+	}
+	return nil
+}
+
+// ExternalRemoteReadLimits is the per-tenant configuration of the external remote read endpoints.
+type ExternalRemoteReadLimits interface {
+	ExternalRemoteReadURL(userID string) string
+	ExternalRemoteReadQueryAfter(userID string) time.Duration
+	ExternalRemoteReadBasicAuthUsername(userID string) string
+	ExternalRemoteReadBasicAuthPassword(userID string) string
+	ExternalRemoteReadBearerToken(userID string) string
+}
+
+// NewExternalRemoteReadTimeRangeQueryable returns a TimeRangeQueryable querying the external
+// Prometheus-compatible remote read endpoint configured for the tenant, if any. The series returned
+// by the external endpoint are merged and deduplicated with the series queried from Mimir storage.
+func NewExternalRemoteReadTimeRangeQueryable(cfg ExternalRemoteReadConfig, limits ExternalRemoteReadLimits, logger log.Logger) (TimeRangeQueryable, error) {
+	queryable, err := newExternalRemoteReadQueryable(cfg, limits, logger)
+	if err != nil {
+		return TimeRangeQueryable{}, err
+	}
+
+	return TimeRangeQueryable{
+		Queryable:   queryable,
+		StorageName: externalRemoteReadStorageName,
+		IsApplicable: func(_ context.Context, tenantID string, now time.Time, queryMinT, _ int64, _ log.Logger, _ ...*labels.Matcher) bool {
+			if limits.ExternalRemoteReadURL(tenantID) == "" {
+				return false
+			}
+			// The external endpoint is queried like the store-gateway, only for queries
+			// reaching older than the configured query-after period.
+			return ShouldQueryBlockStore(limits.ExternalRemoteReadQueryAfter(tenantID), now, queryMinT)
+		},
+	}, nil
+}
+
+type externalRemoteReadQueryable struct {
+	cfg    ExternalRemoteReadConfig
+	limits ExternalRemoteReadLimits
+	logger log.Logger
+
+	clientsMx sync.Mutex
+	clients   *simplelru.LRU[externalRemoteReadClientKey, *prom_remote.Client]
+}
+
+// externalRemoteReadClientKey identifies the client of an external remote read endpoint.
+type externalRemoteReadClientKey struct {
+	url               string
+	basicAuthUsername string
+	basicAuthPassword string
+	bearerToken       string
+}
+
+func newExternalRemoteReadQueryable(cfg ExternalRemoteReadConfig, limits ExternalRemoteReadLimits, logger log.Logger) (*externalRemoteReadQueryable, error) {
+	// The idle connections of the evicted clients are closed, given they're not reused anymore.
+	clients, err := simplelru.NewLRU[externalRemoteReadClientKey, *prom_remote.Client](cfg.MaxClients, func(_ externalRemoteReadClientKey, c *prom_remote.Client) {
+		c.Client.CloseIdleConnections()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &externalRemoteReadQueryable{
+		cfg:     cfg,
+		limits:  limits,
+		logger:  logger,
+		clients: clients,
+	}, nil
+}
+
+func (q *externalRemoteReadQueryable) Querier(minT, maxT int64) (storage.Querier, error) {
+	return &externalRemoteReadQuerier{
+		queryable: q,
+		minT:      minT,
+		maxT:      maxT,
+	}, nil
+}
+
+// client returns the remote read client for the endpoint URL and credentials. Clients are shared between
+// tenants configured with the same endpoint URL and credentials.
+func (q *externalRemoteReadQueryable) client(key externalRemoteReadClientKey) (prom_remote.ReadClient, error) {
+	q.clientsMx.Lock()
+	defer q.clientsMx.Unlock()
+
+	if c, ok := q.clients.Get(key); ok {
+		return c, nil
+	}
+
+	u, err := url.Parse(key.url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid external remote read URL: %w", err)
+	}
+
+	httpClientCfg := config_util.DefaultHTTPClientConfig
+	if key.basicAuthUsername != "" {
+		httpClientCfg.BasicAuth = &config_util.BasicAuth{
+			Username: key.basicAuthUsername,
+			Password: config_util.Secret(key.basicAuthPassword),
+		}
+	}
+	if key.bearerToken != "" {
+		httpClientCfg.Authorization = &config_util.Authorization{
+			Type:        "Bearer",
+			Credentials: config_util.Secret(key.bearerToken),
+		}
+	}
+
+	rc, err := prom_remote.NewReadClient(externalRemoteReadStorageName, &prom_remote.ClientConfig{
+		URL:              &config_util.URL{URL: u},
+		Timeout:          model.Duration(q.cfg.Timeout),
+		HTTPClientConfig: httpClientCfg,
+		ChunkedReadLimit: q.cfg.ChunkedReadLimit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	c, ok := rc.(*prom_remote.Client)
+	if !ok {
+		return nil, fmt.Errorf("unexpected remote read client type %T", rc)
+	}
+
+	// The bytes of the responses are tracked as fetched chunk bytes of the query.
+	c.Client.Transport = &externalRemoteReadRoundTripper{next: c.Client.Transport}
+
+	q.clients.Add(key, c)
+	return c, nil
+}
+
+type externalRemoteReadQuerier struct {
+	queryable  *externalRemoteReadQueryable
+	minT, maxT int64
+}
+
+// Select issues a remote read request to the external endpoint configured for the tenant.
+// If the request fails, the error is returned as a warning, so that the data queried from
+// Mimir storage is still returned.
+func (q *externalRemoteReadQuerier) Select(ctx context.Context, sortSeries bool, hints *storage.SelectHints, matchers ...*labels.Matcher) storage.SeriesSet {
+	spanLog, ctx := spanlogger.New(ctx, q.queryable.logger, tracer, "externalRemoteReadQuerier.Select")
+	defer spanLog.Finish()
+
+	tenantID, err := tenant.TenantID(ctx)
+	if err != nil {
+		return storage.ErrSeriesSet(err)
+	}
+
+	rawURL := q.queryable.limits.ExternalRemoteReadURL(tenantID)
+	if rawURL == "" {
+		return storage.EmptySeriesSet()
+	}
+
+	client, err := q.queryable.client(externalRemoteReadClientKey{
+		url:               rawURL,
+		basicAuthUsername: q.queryable.limits.ExternalRemoteReadBasicAuthUsername(tenantID),
+		basicAuthPassword: q.queryable.limits.ExternalRemoteReadBasicAuthPassword(tenantID),
+		bearerToken:       q.queryable.limits.ExternalRemoteReadBearerToken(tenantID),
+	})
+	if err != nil {
+		return storage.ErrSeriesSet(err)
+	}
+
+	minT, maxT := q.minT, q.maxT
+	if hints != nil {
+		minT, maxT = hints.Start, hints.End
+	}
+
+	query, err := prom_remote.ToQuery(minT, maxT, matchers, hints)
+	if err != nil {
+		return storage.ErrSeriesSet(err)
+	}
+
+	responseLimiter := &externalRemoteReadResponseLimiter{
+		queryLimiter: limiter.QueryLimiterFromContextWithFallback(ctx),
+		stats:        stats.FromContext(ctx),
+	}
+	set, err := client.Read(context.WithValue(ctx, externalRemoteReadResponseLimiterContextKey, responseLimiter), query, sortSeries)
+	if responseLimiter.err != nil {
+		return storage.ErrSeriesSet(responseLimiter.err)
+	}
+	if err != nil {
+		level.Warn(spanLog).Log("msg", "failed to query external remote read endpoint", "err", err)
+
+		var warnings annotations.Annotations
+		warnings.Add(fmt.Errorf("failed to query external remote read endpoint: %w", err))
+		return series.NewSeriesSetWithWarnings(storage.EmptySeriesSet(), warnings)
+	}
+
+	return &externalRemoteReadSeriesSet{
+		SeriesSet:       set,
+		queryLimiter:    responseLimiter.queryLimiter,
+		stats:           responseLimiter.stats,
+		responseLimiter: responseLimiter,
+	}
+}
+
+// LabelValues implements storage.Querier. Label values are not queried from the external endpoint,
+// given the remote read protocol doesn't support it.
+func (q *externalRemoteReadQuerier) LabelValues(context.Context, string, *storage.LabelHints, ...*labels.Matcher) ([]string, annotations.Annotations, error) {
+	return nil, nil, nil
+}
+
+// LabelNames implements storage.Querier. Label names are not queried from the external endpoint,
+// given the remote read protocol doesn't support it.
+func (q *externalRemoteReadQuerier) LabelNames(context.Context, *storage.LabelHints, ...*labels.Matcher) ([]string, annotations.Annotations, error) {
+	return nil, nil, nil
+}
+
+func (q *externalRemoteReadQuerier) Close() error {
+	return nil
+}
+
+// externalRemoteReadSeriesSet enforces the per-query limits on the series returned by the external
+// remote read endpoint, and tracks them in the query stats.
+type externalRemoteReadSeriesSet struct {
+	storage.SeriesSet
+
+	queryLimiter    *limiter.QueryLimiter
+	stats           *stats.SafeStats
+	responseLimiter *externalRemoteReadResponseLimiter
+	err             error
+}
+
+func (s *externalRemoteReadSeriesSet) Next() bool {
+	if s.err != nil || !s.SeriesSet.Next() {
+		return false
+	}
+
+	if limitErr := s.queryLimiter.AddSeries(s.SeriesSet.At().Labels()); limitErr != nil {
+		s.err = limitErr
+		return false
+	}
+	s.stats.AddFetchedSeries(1)
+	return true
+}
+
+func (s *externalRemoteReadSeriesSet) Err() error {
+	if s.err != nil {
+		return s.err
+	}
+	// The streamed responses are read while iterating the series.
+	if s.responseLimiter.err != nil {
+		return s.responseLimiter.err
+	}
+	return s.SeriesSet.Err()
+}
+
+type externalRemoteReadContextKey int
+
+const externalRemoteReadResponseLimiterContextKey externalRemoteReadContextKey = 0
+
+// externalRemoteReadResponseLimiter enforces the per-query fetched chunk bytes limit on the bytes of
+// the responses of the external remote read endpoint, and tracks them in the query stats.
+type externalRemoteReadResponseLimiter struct {
+	queryLimiter *limiter.QueryLimiter
+	stats        *stats.SafeStats
+	err          validation.LimitError
+}
+
+func (l *externalRemoteReadResponseLimiter) add(bytes int) error {
+	if l.err != nil {
+		return l.err
+	}
+
+	l.stats.AddFetchedChunkBytes(uint64(bytes))
+	if limitErr := l.queryLimiter.AddChunkBytes(bytes); limitErr != nil {
+		l.err = limitErr
+		return limitErr
+	}
+	return nil
+}
+
+// externalRemoteReadRoundTripper passes the bytes of the responses through the externalRemoteReadResponseLimiter
+// of the request context, if any.
+type externalRemoteReadRoundTripper struct {
+	next http.RoundTripper
+}
+
+func (rt *externalRemoteReadRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := rt.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if l, ok := req.Context().Value(externalRemoteReadResponseLimiterContextKey).(*externalRemoteReadResponseLimiter); ok {
+		resp.Body = &externalRemoteReadLimitedBody{ReadCloser: resp.Body, limiter: l}
+	}
+	return resp, nil
+}
+
+type externalRemoteReadLimitedBody struct {
+	io.ReadCloser
+	limiter *externalRemoteReadResponseLimiter
+}
+
+func (b *externalRemoteReadLimitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		if limitErr := b.limiter.add(n); limitErr != nil {
+			return n, limitErr
+		}
+	}
+	return n, err
+}
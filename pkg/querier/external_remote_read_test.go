@@ -0,0 +1,253 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querier
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/user"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/storage"
+	prom_remote "github.com/prometheus/prometheus/storage/remote"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/querier/stats"
+	"github.com/grafana/mimir/pkg/storage/series"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+func TestExternalRemoteReadQueryable(t *testing.T) {
+	const tenantID = "team-a"
+
+	externalSeries := []*prompb.TimeSeries{
+		{
+			Labels:  []prompb.Label{{Name: labels.MetricName, Value: "up"}, {Name: "job", Value: "old"}},
+			Samples: []prompb.Sample{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 2}},
+		},
+		{
+			Labels:  []prompb.Label{{Name: labels.MetricName, Value: "up"}, {Name: "job", Value: "other"}},
+			Samples: []prompb.Sample{{Timestamp: 1000, Value: 5}},
+		},
+	}
+
+	var receivedQueries []*prompb.Query
+	serveRead := func(w http.ResponseWriter, r *http.Request) {
+		req, err := prom_remote.DecodeReadRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		receivedQueries = append(receivedQueries, req.Queries...)
+
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.Header().Set("Content-Encoding", "snappy")
+		require.NoError(t, prom_remote.EncodeReadResponse(&prompb.ReadResponse{
+			Results: []*prompb.QueryResult{{Timeseries: externalSeries}},
+		}, w))
+	}
+	server := httptest.NewServer(http.HandlerFunc(serveRead))
+	t.Cleanup(server.Close)
+
+	basicAuthServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "pass" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		serveRead(w, r)
+	}))
+	t.Cleanup(basicAuthServer.Close)
+
+	bearerTokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		serveRead(w, r)
+	}))
+	t.Cleanup(bearerTokenServer.Close)
+
+	failingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(failingServer.Close)
+
+	newOverrides := func(url string, modify func(limits *validation.Limits)) *validation.Overrides {
+		limits := defaultLimitsConfig()
+		limits.ExternalRemoteReadURL = url
+		if modify != nil {
+			modify(&limits)
+		}
+		return validation.NewOverrides(limits, nil)
+	}
+
+	// The queryable simulating the Mimir storage returns an overlapping series.
+	storageQueryable := TimeRangeQueryable{
+		StorageName: "ingester",
+		IsApplicable: func(context.Context, string, time.Time, int64, int64, log.Logger, ...*labels.Matcher) bool {
+			return true
+		},
+		Queryable: storage.QueryableFunc(func(int64, int64) (storage.Querier, error) {
+			return mockQuerier{
+				selectFn: func(context.Context, bool, *storage.SelectHints, ...*labels.Matcher) storage.SeriesSet {
+					return series.NewConcreteSeriesSetFromSortedSeries([]storage.Series{
+						series.NewConcreteSeries(labels.FromStrings(labels.MetricName, "up", "job", "old"), []model.SamplePair{{Timestamp: 2000, Value: 2}, {Timestamp: 3000, Value: 3}}, nil),
+					})
+				},
+			}, nil
+		}),
+	}
+
+	query := func(t *testing.T, overrides *validation.Overrides) (map[string][]model.SamplePair, storage.SeriesSet, *stats.SafeStats) {
+		queryMetrics := stats.NewQueryMetrics(prometheus.NewPedanticRegistry())
+		externalQueryable, err := NewExternalRemoteReadTimeRangeQueryable(ExternalRemoteReadConfig{Timeout: 10 * time.Second, MaxClients: 10}, overrides, log.NewNopLogger())
+		require.NoError(t, err)
+		queryables := []TimeRangeQueryable{storageQueryable, externalQueryable}
+
+		q, err := newQueryable(queryables, Config{}, overrides, queryMetrics, log.NewNopLogger()).Querier(0, 10000)
+		require.NoError(t, err)
+		t.Cleanup(func() { require.NoError(t, q.Close()) })
+
+		queryStats, ctx := stats.ContextWithEmptyStats(user.InjectOrgID(context.Background(), tenantID))
+		set := q.Select(ctx, true, nil, labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "up"))
+
+		result := map[string][]model.SamplePair{}
+		for set.Next() {
+			s := set.At()
+			it := s.Iterator(nil)
+			for it.Next() != chunkenc.ValNone {
+				ts, v := it.At()
+				result[s.Labels().String()] = append(result[s.Labels().String()], model.SamplePair{Timestamp: model.Time(ts), Value: model.SampleValue(v)})
+			}
+			require.NoError(t, it.Err())
+		}
+		return result, set, queryStats
+	}
+
+	t.Run("series from the external endpoint are merged and deduplicated with Mimir storage", func(t *testing.T) {
+		receivedQueries = nil
+
+		result, set, queryStats := query(t, newOverrides(server.URL, nil))
+		require.NoError(t, set.Err())
+		assert.Empty(t, set.Warnings())
+
+		assert.Equal(t, map[string][]model.SamplePair{
+			`{__name__="up", job="old"}`:   {{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 2}, {Timestamp: 3000, Value: 3}},
+			`{__name__="up", job="other"}`: {{Timestamp: 1000, Value: 5}},
+		}, result)
+		assert.Equal(t, uint64(2), queryStats.LoadFetchedSeries())
+		assert.Greater(t, queryStats.LoadFetchedChunkBytes(), uint64(0))
+
+		require.Len(t, receivedQueries, 1)
+		assert.Equal(t, int64(0), receivedQueries[0].StartTimestampMs)
+		assert.Equal(t, int64(10000), receivedQueries[0].EndTimestampMs)
+	})
+
+	t.Run("the external endpoint is not queried if not configured for the tenant", func(t *testing.T) {
+		receivedQueries = nil
+
+		result, set, _ := query(t, newOverrides("", nil))
+		require.NoError(t, set.Err())
+		assert.Len(t, result, 1)
+		assert.Empty(t, receivedQueries)
+	})
+
+	t.Run("the per-tenant query limits apply to series from the external endpoint", func(t *testing.T) {
+		_, set, _ := query(t, newOverrides(server.URL, func(limits *validation.Limits) {
+			limits.MaxFetchedSeriesPerQuery = 1
+		}))
+		require.Error(t, set.Err())
+		assert.Contains(t, set.Err().Error(), "err-mimir-max-series-per-query")
+	})
+
+	t.Run("the fetched chunk bytes limit applies to the responses of the external endpoint", func(t *testing.T) {
+		_, set, _ := query(t, newOverrides(server.URL, func(limits *validation.Limits) {
+			limits.MaxFetchedChunkBytesPerQuery = 10
+		}))
+		require.Error(t, set.Err())
+		assert.Contains(t, set.Err().Error(), "err-mimir-max-chunks-bytes-per-query")
+	})
+
+	t.Run("the external endpoint is queried with the basic authentication of the tenant", func(t *testing.T) {
+		result, set, _ := query(t, newOverrides(basicAuthServer.URL, func(limits *validation.Limits) {
+			limits.ExternalRemoteReadBasicAuthUsername = "user"
+			require.NoError(t, limits.ExternalRemoteReadBasicAuthPassword.Set("pass"))
+		}))
+		require.NoError(t, set.Err())
+		assert.Empty(t, set.Warnings())
+		assert.Len(t, result, 2)
+	})
+
+	t.Run("the external endpoint is queried with the bearer token of the tenant", func(t *testing.T) {
+		result, set, _ := query(t, newOverrides(bearerTokenServer.URL, func(limits *validation.Limits) {
+			require.NoError(t, limits.ExternalRemoteReadBearerToken.Set("token"))
+		}))
+		require.NoError(t, set.Err())
+		assert.Empty(t, set.Warnings())
+		assert.Len(t, result, 2)
+	})
+
+	t.Run("a failure of the external endpoint is returned as a warning", func(t *testing.T) {
+		result, set, _ := query(t, newOverrides(failingServer.URL, nil))
+		require.NoError(t, set.Err())
+		assert.Len(t, result, 1)
+		require.Len(t, set.Warnings(), 1)
+		for _, w := range set.Warnings() {
+			assert.ErrorContains(t, w, "failed to query external remote read endpoint")
+		}
+	})
+}
+
+func TestExternalRemoteReadTimeRangeQueryable_IsApplicable(t *testing.T) {
+	now := time.Now()
+
+	limits := defaultLimitsConfig()
+	limits.ExternalRemoteReadURL = "http://localhost/api/v1/read"
+	limits.ExternalRemoteReadQueryAfter = model.Duration(time.Hour)
+	overrides := validation.NewOverrides(limits, nil)
+
+	queryable, err := NewExternalRemoteReadTimeRangeQueryable(ExternalRemoteReadConfig{MaxClients: 10}, overrides, log.NewNopLogger())
+	require.NoError(t, err)
+	assert.Equal(t, externalRemoteReadStorageName, queryable.StorageName)
+	assert.True(t, queryable.IsApplicable(context.Background(), "team-a", now, now.Add(-2*time.Hour).UnixMilli(), now.UnixMilli(), log.NewNopLogger()))
+	assert.False(t, queryable.IsApplicable(context.Background(), "team-a", now, now.Add(-30*time.Minute).UnixMilli(), now.UnixMilli(), log.NewNopLogger()))
+
+	limits.ExternalRemoteReadURL = ""
+	overrides = validation.NewOverrides(limits, nil)
+	queryable, err = NewExternalRemoteReadTimeRangeQueryable(ExternalRemoteReadConfig{MaxClients: 10}, overrides, log.NewNopLogger())
+	require.NoError(t, err)
+	assert.False(t, queryable.IsApplicable(context.Background(), "team-a", now, now.Add(-2*time.Hour).UnixMilli(), now.UnixMilli(), log.NewNopLogger()))
+}
+
+func TestExternalRemoteReadQueryable_ClientsAreBounded(t *testing.T) {
+	queryable, err := newExternalRemoteReadQueryable(ExternalRemoteReadConfig{Timeout: 10 * time.Second, MaxClients: 2}, validation.NewOverrides(defaultLimitsConfig(), nil), log.NewNopLogger())
+	require.NoError(t, err)
+
+	first, err := queryable.client(externalRemoteReadClientKey{url: "http://first/api/v1/read"})
+	require.NoError(t, err)
+
+	// The client is reused for the same URL and credentials.
+	same, err := queryable.client(externalRemoteReadClientKey{url: "http://first/api/v1/read"})
+	require.NoError(t, err)
+	assert.Same(t, first, same)
+
+	// The client isn't reused for other credentials.
+	withCredentials, err := queryable.client(externalRemoteReadClientKey{url: "http://first/api/v1/read", bearerToken: "token"})
+	require.NoError(t, err)
+	assert.NotSame(t, first, withCredentials)
+
+	// The least recently used client is evicted when the limit is reached.
+	_, err = queryable.client(externalRemoteReadClientKey{url: "http://second/api/v1/read"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, queryable.clients.Len())
+	assert.False(t, queryable.clients.Contains(externalRemoteReadClientKey{url: "http://first/api/v1/read"}))
+}
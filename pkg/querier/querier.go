@@ -61,6 +61,9 @@ type Config struct {
 	MinimizeIngesterRequests                       bool          `yaml:"minimize_ingester_requests" category:"advanced"`
 	MinimiseIngesterRequestsHedgingDelay           time.Duration `yaml:"minimize_ingester_requests_hedging_delay" category:"advanced"`
 
+	StoreGatewayLatencyAwareReplicaSelection bool          `yaml:"store_gateway_latency_aware_replica_selection" category:"experimental"`
+	StoreGatewayHedgingMinDelay              time.Duration `yaml:"store_gateway_hedging_min_delay" category:"experimental"`
+
 	QueryEngine               string `yaml:"query_engine" category:"experimental"`
 	EnableQueryEngineFallback bool   `yaml:"enable_query_engine_fallback" category:"experimental"`
 
@@ -70,6 +73,8 @@ type Config struct {
 	// 0 or negative values mean unlimited concurrency.
 	MaxConcurrentRemoteReadQueries int `yaml:"max_concurrent_remote_read_queries" category:"advanced"`
 
+	ExternalRemoteRead ExternalRemoteReadConfig `yaml:"external_remote_read"`
+
 	// PromQL engine config.
 	EngineConfig engine.Config `yaml:",inline"`
 }
@@ -98,6 +103,9 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.Uint64Var(&cfg.StreamingChunksPerIngesterSeriesBufferSize, "querier.streaming-chunks-per-ingester-buffer-size", 256, "Number of series to buffer per ingester when streaming chunks from ingesters.")
 	f.Uint64Var(&cfg.StreamingChunksPerStoreGatewaySeriesBufferSize, "querier.streaming-chunks-per-store-gateway-buffer-size", 256, "Number of series to buffer per store-gateway when streaming chunks from store-gateways.")
 
+	f.BoolVar(&cfg.StoreGatewayLatencyAwareReplicaSelection, "querier.store-gateway-latency-aware-replica-selection", false, "If true, when querying store-gateways, the replicas holding a block are selected based on the moving average of their observed response latency and error rate, instead of randomly.")
+	f.DurationVar(&cfg.StoreGatewayHedgingMinDelay, "querier.store-gateway-hedging-min-delay", 100*time.Millisecond, "Minimum delay before sending a hedged series request to another store-gateway, when hedging is enabled for the tenant with -"+validation.StoreGatewayHedgingPercentileFlag+".")
+
 	f.StringVar(&cfg.QueryEngine, "querier.query-engine", MimirEngine, fmt.Sprintf("Query engine to use, either '%v' or '%v'", PrometheusEngine, MimirEngine))
 	f.BoolVar(&cfg.EnableQueryEngineFallback, "querier.enable-query-engine-fallback", true, "If set to true and the Mimir query engine is in use, fall back to using the Prometheus query engine for any queries not supported by the Mimir query engine.")
 
@@ -105,6 +113,7 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 
 	f.IntVar(&cfg.MaxConcurrentRemoteReadQueries, "querier.max-concurrent-remote-read-queries", 2, "Maximum number of remote read queries that can be executed concurrently. 0 or negative values mean unlimited concurrency.")
 
+	cfg.ExternalRemoteRead.RegisterFlags(f)
 	cfg.EngineConfig.RegisterFlags(f)
 }
 
@@ -113,6 +122,10 @@ func (cfg *Config) Validate() error {
 		return fmt.Errorf("unknown PromQL engine '%s'", cfg.QueryEngine)
 	}
 
+	if err := cfg.ExternalRemoteRead.Validate(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -160,6 +173,11 @@ func New(cfg Config, limits *validation.Overrides, distributor Distributor, quer
 			return ShouldQueryIngesters(limits.QueryIngestersWithin(tenantID), now, queryMaxT)
 		},
 	})
+	externalRemoteReadQueryable, err := NewExternalRemoteReadTimeRangeQueryable(cfg.ExternalRemoteRead, limits, logger)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	queryables = append(queryables, externalRemoteReadQueryable)
 
 	queryable := newQueryable(queryables, cfg, limits, queryMetrics, logger)
 	exemplarQueryable := newDistributorExemplarQueryable(distributor, logger)
@@ -297,13 +315,19 @@ func (mq *multiQuerier) getQueriers(ctx context.Context, minT, maxT int64, match
 		return nil, nil, 0, 0, err
 	}
 
-	ctx = limiter.AddQueryLimiterToContext(ctx, limiter.NewQueryLimiter(
+	queryLimiter := limiter.NewQueryLimiter(
 		mq.limits.MaxFetchedSeriesPerQuery(tenantID),
 		mq.limits.MaxFetchedChunkBytesPerQuery(tenantID),
 		mq.limits.MaxChunksPerQuery(tenantID),
 		mq.limits.MaxEstimatedChunksPerQuery(tenantID),
 		mq.queryMetrics,
-	))
+	)
+	// If this is a tenant sub-query of a federated query, the data fetched is also accounted
+	// against the limits of the federated query.
+	if federatedLimiter := limiter.FederatedQueryLimiterFromContext(ctx); federatedLimiter != nil {
+		queryLimiter.WithFederatedQueryLimiter(federatedLimiter, tenantID)
+	}
+	ctx = limiter.AddQueryLimiterToContext(ctx, queryLimiter)
 
 	minT, maxT, err = validateQueryTimeRange(tenantID, minT, maxT, now.UnixMilli(), mq.limits, spanlogger.FromContext(ctx, mq.logger))
 	if err != nil {
@@ -643,8 +667,9 @@ func (mq *multiQuerier) mergeSeriesSets(sets []storage.SeriesSet) storage.Series
 
 		if err := set.Err(); err != nil {
 			otherSets = append(otherSets, storage.ErrSeriesSet(err))
-		} else if len(nonChunkSeries) > 0 {
-			otherSets = append(otherSets, &sliceSeriesSet{series: nonChunkSeries, ix: -1})
+		} else if warnings := set.Warnings(); len(nonChunkSeries) > 0 || len(warnings) > 0 {
+			// Keep the warnings even if there are no series, e.g. when a source failed and returned partial results.
+			otherSets = append(otherSets, &sliceSeriesSet{series: nonChunkSeries, ix: -1, warnings: warnings})
 		}
 	}
 
@@ -664,8 +689,9 @@ func (mq *multiQuerier) mergeSeriesSets(sets []storage.SeriesSet) storage.Series
 }
 
 type sliceSeriesSet struct {
-	series []storage.Series
-	ix     int
+	series   []storage.Series
+	ix       int
+	warnings annotations.Annotations
 }
 
 func (s *sliceSeriesSet) Next() bool {
@@ -685,7 +711,7 @@ func (s *sliceSeriesSet) Err() error {
 }
 
 func (s *sliceSeriesSet) Warnings() annotations.Annotations {
-	return nil
+	return s.warnings
 }
 
 func validateQueryTimeRange(userID string, startMs, endMs, now int64, limits *validation.Overrides, spanLog *spanlogger.SpanLogger) (int64, int64, error) {
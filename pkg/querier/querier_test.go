@@ -626,7 +626,7 @@ func TestQuerier_QueryIngestersWithinConfig(t *testing.T) {
 		MaxSamples:         1e6,
 		Timeout:            1 * time.Minute,
 	})
-	cfg := Config{QueryEngine: PrometheusEngine}
+	cfg := Config{QueryEngine: PrometheusEngine, ExternalRemoteRead: ExternalRemoteReadConfig{MaxClients: 1}}
 	for _, c := range testCases {
 		t.Run(c.name, func(t *testing.T) {
 			distributor := &errDistributor{}
@@ -7,6 +7,8 @@ package stats
 
 import (
 	"context"
+	"slices"
+	"strings"
 	"sync"
 	"sync/atomic" //lint:ignore faillint we can't use go.uber.org/atomic with a protobuf struct without wrapping it.
 	"time"
@@ -25,6 +27,11 @@ func ContextWithEmptyStats(ctx context.Context) (*SafeStats, context.Context) {
 	return stats, ctx
 }
 
+// ContextWithStats returns a context with the provided stats.
+func ContextWithStats(ctx context.Context, stats *SafeStats) context.Context {
+	return context.WithValue(ctx, ctxKey, stats)
+}
+
 // FromContext gets the Stats out of the Context. Returns nil if stats have not
 // been initialised in the context. Note that Stats methods are safe to call with
 // a nil receiver.
@@ -273,6 +280,54 @@ func (s *SafeStats) Merge(other *SafeStats) {
 	s.AddSamplesProcessed(other.LoadSamplesProcessed())
 	s.AddSpunOffSubqueries(other.LoadSpunOffSubqueries())
 	s.mergeSamplesProcessedPerStep(other.LoadSamplesProcessedPerStep())
+	s.mergeTenantStats(other.LoadTenantStats())
+}
+
+// AddTenantStats attributes the data fetched according to the provided stats to the tenant.
+// It doesn't add the provided stats to the totals, use Merge for that.
+func (s *SafeStats) AddTenantStats(tenantID string, other *SafeStats) {
+	if s == nil || other == nil {
+		return
+	}
+	s.mergeTenantStats([]TenantStats{{
+		TenantId:           tenantID,
+		FetchedSeriesCount: other.LoadFetchedSeries(),
+		FetchedChunkBytes:  other.LoadFetchedChunkBytes(),
+		FetchedChunksCount: other.LoadFetchedChunks(),
+		FetchedIndexBytes:  other.LoadFetchedIndexBytes(),
+	}})
+}
+
+// LoadTenantStats returns a copy of the per-tenant stats, sorted by tenant ID.
+func (s *SafeStats) LoadTenantStats() []TenantStats {
+	if s == nil {
+		return nil
+	}
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return slices.Clone(s.TenantStats)
+}
+
+func (s *SafeStats) mergeTenantStats(other []TenantStats) {
+	if s == nil || len(other) == 0 {
+		return
+	}
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for _, o := range other {
+		idx, found := slices.BinarySearchFunc(s.TenantStats, o.TenantId, func(ts TenantStats, tenantID string) int {
+			return strings.Compare(ts.TenantId, tenantID)
+		})
+		if !found {
+			s.TenantStats = slices.Insert(s.TenantStats, idx, TenantStats{TenantId: o.TenantId})
+		}
+		ts := &s.TenantStats[idx]
+		ts.FetchedSeriesCount += o.FetchedSeriesCount
+		ts.FetchedChunkBytes += o.FetchedChunkBytes
+		ts.FetchedChunksCount += o.FetchedChunksCount
+		ts.FetchedIndexBytes += o.FetchedIndexBytes
+	}
 }
 
 func (s *SafeStats) mergeSamplesProcessedPerStep(other []StepStat) {
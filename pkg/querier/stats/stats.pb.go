@@ -56,6 +56,9 @@ type Stats struct {
 	SpunOffSubqueries uint32 `protobuf:"varint,12,opt,name=spun_off_subqueries,json=spunOffSubqueries,proto3" json:"spun_off_subqueries,omitempty"`
 	// SamplesProcessedPerStep represents the number of samples scanned per step timestamp while evaluating a query.
 	SamplesProcessedPerStep []StepStat `protobuf:"bytes,13,rep,name=samples_processed_per_step,json=samplesProcessedPerStep,proto3" json:"samples_processed_per_step"`
+	// TenantStats breaks down the fetched data per tenant, for queries federated across multiple tenants.
+	// Sorted by tenant ID.
+	TenantStats []TenantStats `protobuf:"bytes,14,rep,name=tenant_stats,json=tenantStats,proto3" json:"tenant_stats"`
 }
 
 func (m *Stats) Reset()      { *m = Stats{} }
@@ -181,6 +184,13 @@ func (m *Stats) GetSamplesProcessedPerStep() []StepStat {
 	return nil
 }
 
+func (m *Stats) GetTenantStats() []TenantStats {
+	if m != nil {
+		return m.TenantStats
+	}
+	return nil
+}
+
 // StepStat represents a sample count at a specific timestamp
 type StepStat struct {
 	Timestamp int64 `protobuf:"varint,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
@@ -233,48 +243,133 @@ func (m *StepStat) GetValue() int64 {
 	return 0
 }
 
+// TenantStats represents the data fetched for a single tenant of a federated query.
+type TenantStats struct {
+	TenantId string `protobuf:"bytes,1,opt,name=tenant_id,json=tenantId,proto3" json:"tenant_id,omitempty"`
+	// The number of series fetched for the tenant
+	FetchedSeriesCount uint64 `protobuf:"varint,2,opt,name=fetched_series_count,json=fetchedSeriesCount,proto3" json:"fetched_series_count,omitempty"`
+	// The number of bytes of the chunks fetched for the tenant, after any deduplication
+	FetchedChunkBytes uint64 `protobuf:"varint,3,opt,name=fetched_chunk_bytes,json=fetchedChunkBytes,proto3" json:"fetched_chunk_bytes,omitempty"`
+	// The number of chunks fetched for the tenant, after any deduplication
+	FetchedChunksCount uint64 `protobuf:"varint,4,opt,name=fetched_chunks_count,json=fetchedChunksCount,proto3" json:"fetched_chunks_count,omitempty"`
+	// The number of index bytes fetched on the store-gateway for the tenant
+	FetchedIndexBytes uint64 `protobuf:"varint,5,opt,name=fetched_index_bytes,json=fetchedIndexBytes,proto3" json:"fetched_index_bytes,omitempty"`
+}
+
+func (m *TenantStats) Reset()      { *m = TenantStats{} }
+func (*TenantStats) ProtoMessage() {}
+func (*TenantStats) Descriptor() ([]byte, []int) {
+	return fileDescriptor_b4756a0aec8b9d44, []int{2}
+}
+func (m *TenantStats) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *TenantStats) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_TenantStats.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *TenantStats) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TenantStats.Merge(m, src)
+}
+func (m *TenantStats) XXX_Size() int {
+	return m.Size()
+}
+func (m *TenantStats) XXX_DiscardUnknown() {
+	xxx_messageInfo_TenantStats.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TenantStats proto.InternalMessageInfo
+
+func (m *TenantStats) GetTenantId() string {
+	if m != nil {
+		return m.TenantId
+	}
+	return ""
+}
+
+func (m *TenantStats) GetFetchedSeriesCount() uint64 {
+	if m != nil {
+		return m.FetchedSeriesCount
+	}
+	return 0
+}
+
+func (m *TenantStats) GetFetchedChunkBytes() uint64 {
+	if m != nil {
+		return m.FetchedChunkBytes
+	}
+	return 0
+}
+
+func (m *TenantStats) GetFetchedChunksCount() uint64 {
+	if m != nil {
+		return m.FetchedChunksCount
+	}
+	return 0
+}
+
+func (m *TenantStats) GetFetchedIndexBytes() uint64 {
+	if m != nil {
+		return m.FetchedIndexBytes
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterType((*Stats)(nil), "stats.Stats")
 	proto.RegisterType((*StepStat)(nil), "stats.StepStat")
+	proto.RegisterType((*TenantStats)(nil), "stats.TenantStats")
 }
 
 func init() { proto.RegisterFile("stats.proto", fileDescriptor_b4756a0aec8b9d44) }
 
 var fileDescriptor_b4756a0aec8b9d44 = []byte{
-	// 523 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x93, 0xbf, 0x72, 0xd3, 0x40,
-	0x10, 0xc6, 0x75, 0xd8, 0x0e, 0xf6, 0x39, 0x26, 0x58, 0x78, 0x40, 0x78, 0x98, 0x8b, 0x27, 0x14,
-	0x78, 0x86, 0x19, 0x99, 0x09, 0x74, 0xcc, 0x30, 0x8c, 0x93, 0x86, 0x8a, 0x20, 0x53, 0xd1, 0xdc,
-	0xc8, 0xd6, 0xca, 0xd6, 0x20, 0xe9, 0x14, 0xdd, 0x1d, 0x7f, 0x3a, 0x1e, 0x81, 0x92, 0x47, 0xe0,
-	0x51, 0x52, 0x50, 0xb8, 0x4c, 0x05, 0x58, 0x6e, 0x28, 0xf3, 0x08, 0xcc, 0xdd, 0x49, 0xc6, 0x09,
-	0x4d, 0x3a, 0xdf, 0xfe, 0xf6, 0xdb, 0x5d, 0x7f, 0xbb, 0xc2, 0x6d, 0x2e, 0x7c, 0xc1, 0xdd, 0x2c,
-	0x67, 0x82, 0xd9, 0x0d, 0xfd, 0xe8, 0xf7, 0xe6, 0x6c, 0xce, 0x74, 0x64, 0xa4, 0x7e, 0x19, 0xd8,
-	0x27, 0x73, 0xc6, 0xe6, 0x31, 0x8c, 0xf4, 0x6b, 0x2a, 0xc3, 0x51, 0x20, 0x73, 0x5f, 0x44, 0x2c,
-	0x35, 0xfc, 0xe0, 0x47, 0x03, 0x37, 0x26, 0x4a, 0x6f, 0xbf, 0xc4, 0xad, 0x8f, 0x7e, 0x1c, 0x53,
-	0x11, 0x25, 0xe0, 0xa0, 0x01, 0x1a, 0xb6, 0x0f, 0xef, 0xbb, 0x46, 0xed, 0x56, 0x6a, 0xf7, 0xb8,
-	0x54, 0x8f, 0x9b, 0x67, 0x3f, 0xf7, 0xad, 0x6f, 0xbf, 0xf6, 0x91, 0xd7, 0x54, 0xaa, 0xb7, 0x51,
-	0x02, 0xf6, 0x13, 0xdc, 0x0b, 0x41, 0xcc, 0x16, 0x10, 0x50, 0x0e, 0x79, 0x04, 0x9c, 0xce, 0x98,
-	0x4c, 0x85, 0x73, 0x63, 0x80, 0x86, 0x75, 0xcf, 0x2e, 0xd9, 0x44, 0xa3, 0x23, 0x45, 0x6c, 0x17,
-	0xdf, 0xa9, 0x14, 0xb3, 0x85, 0x4c, 0xdf, 0xd3, 0xe9, 0x67, 0x01, 0xdc, 0xa9, 0x69, 0x41, 0xb7,
-	0x44, 0x47, 0x8a, 0x8c, 0x15, 0xd8, 0xee, 0xa0, 0xf3, 0xab, 0x0e, 0xf5, 0x4b, 0x1d, 0xb4, 0xa0,
-	0xec, 0xf0, 0x08, 0xef, 0xf1, 0x85, 0x9f, 0x07, 0x10, 0xd0, 0x53, 0xa9, 0x3b, 0x3b, 0x8d, 0x01,
-	0x1a, 0x76, 0xbc, 0x5b, 0x65, 0xf8, 0x8d, 0x89, 0xda, 0x0f, 0x71, 0x87, 0x67, 0x71, 0x24, 0x36,
-	0x69, 0x3b, 0x3a, 0x6d, 0x57, 0x07, 0xab, 0xa4, 0xad, 0x79, 0xa3, 0x34, 0x80, 0x4f, 0xe5, 0xbc,
-	0x37, 0x2f, 0xcd, 0xfb, 0x4a, 0x11, 0x33, 0xef, 0x33, 0x7c, 0x17, 0xb8, 0x88, 0x12, 0x5f, 0x5c,
-	0xf5, 0xa4, 0xa9, 0x25, 0xbd, 0x0d, 0xdd, 0x76, 0x65, 0x8c, 0xf1, 0xa9, 0x04, 0x09, 0x66, 0x15,
-	0xad, 0xeb, 0xaf, 0xa2, 0xa5, 0x65, 0x7a, 0x17, 0xc7, 0xb8, 0x0d, 0xe9, 0x8c, 0x05, 0x65, 0x11,
-	0x7c, 0xfd, 0x22, 0xd8, 0xe8, 0x74, 0x95, 0xc7, 0xb8, 0xcb, 0xfd, 0x24, 0x8b, 0x81, 0xd3, 0x2c,
-	0x67, 0x33, 0xe0, 0x1c, 0x02, 0xa7, 0xad, 0x47, 0xbf, 0x5d, 0x82, 0x93, 0x2a, 0xae, 0xcc, 0xe1,
-	0x99, 0x4c, 0x29, 0x0b, 0x43, 0xca, 0xe5, 0xb4, 0xf2, 0x71, 0x57, 0xfb, 0xd8, 0x55, 0xe8, 0x75,
-	0x18, 0x4e, 0x36, 0xc0, 0xf6, 0x70, 0xff, 0xbf, 0xe2, 0x34, 0x83, 0x9c, 0x72, 0x01, 0x99, 0xd3,
-	0x19, 0xd4, 0x86, 0xed, 0xc3, 0x3d, 0xd7, 0x5c, 0xfa, 0x44, 0x40, 0xa6, 0xce, 0x74, 0x5c, 0x57,
-	0x73, 0x7a, 0xf7, 0xae, 0x36, 0x3f, 0x81, 0x5c, 0xa5, 0x1c, 0xbc, 0xc0, 0xcd, 0x2a, 0xd5, 0x7e,
-	0x80, 0x5b, 0xea, 0xbf, 0x73, 0xe1, 0x27, 0x99, 0x3e, 0xe8, 0x9a, 0xf7, 0x2f, 0x60, 0xf7, 0x70,
-	0xe3, 0x83, 0x1f, 0x4b, 0xd0, 0xd7, 0x59, 0xf3, 0xcc, 0x63, 0xfc, 0x7c, 0xb9, 0x22, 0xd6, 0xf9,
-	0x8a, 0x58, 0x17, 0x2b, 0x82, 0xbe, 0x14, 0x04, 0x7d, 0x2f, 0x08, 0x3a, 0x2b, 0x08, 0x5a, 0x16,
-	0x04, 0xfd, 0x2e, 0x08, 0xfa, 0x53, 0x10, 0xeb, 0xa2, 0x20, 0xe8, 0xeb, 0x9a, 0x58, 0xcb, 0x35,
-	0xb1, 0xce, 0xd7, 0xc4, 0x7a, 0x67, 0xbe, 0xc0, 0xe9, 0x8e, 0xb6, 0xf5, 0xe9, 0xdf, 0x00, 0x00,
-	0x00, 0xff, 0xff, 0xb2, 0x95, 0x8c, 0x70, 0x9e, 0x03, 0x00, 0x00,
+	// 577 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xcc, 0x54, 0xbf, 0x6f, 0xd3, 0x40,
+	0x14, 0xf6, 0x91, 0xa6, 0xc4, 0xe7, 0xfe, 0xa0, 0x47, 0x04, 0xa6, 0xa0, 0x6b, 0x14, 0x06, 0x22,
+	0x21, 0x39, 0xa8, 0xb0, 0x55, 0x42, 0x28, 0xed, 0xd2, 0x89, 0xe2, 0x74, 0x62, 0xb1, 0x9c, 0xf8,
+	0x39, 0xb1, 0x70, 0x6c, 0xd7, 0x77, 0xe6, 0xc7, 0xc6, 0xca, 0xc6, 0xc8, 0x9f, 0xc0, 0x9f, 0xd2,
+	0x31, 0x63, 0x27, 0x20, 0xce, 0xc2, 0x84, 0xfa, 0x27, 0xa0, 0x7b, 0xb6, 0xd3, 0xb4, 0xa8, 0x52,
+	0x47, 0x36, 0xdf, 0xf7, 0xbd, 0xef, 0xfb, 0x9e, 0xde, 0xbd, 0x33, 0x35, 0x84, 0x74, 0xa5, 0xb0,
+	0x92, 0x34, 0x96, 0x31, 0xab, 0xe3, 0x61, 0xbb, 0x39, 0x8a, 0x47, 0x31, 0x22, 0x5d, 0xf5, 0x55,
+	0x90, 0xdb, 0x7c, 0x14, 0xc7, 0xa3, 0x10, 0xba, 0x78, 0x1a, 0x64, 0x7e, 0xd7, 0xcb, 0x52, 0x57,
+	0x06, 0x71, 0x54, 0xf0, 0xed, 0x2f, 0xab, 0xb4, 0xde, 0x57, 0x7a, 0xf6, 0x8a, 0xea, 0x1f, 0xdc,
+	0x30, 0x74, 0x64, 0x30, 0x01, 0x93, 0xb4, 0x48, 0xc7, 0xd8, 0x7d, 0x60, 0x15, 0x6a, 0xab, 0x52,
+	0x5b, 0x07, 0xa5, 0xba, 0xd7, 0x38, 0xfd, 0xb1, 0xa3, 0x7d, 0xfb, 0xb9, 0x43, 0xec, 0x86, 0x52,
+	0x1d, 0x07, 0x13, 0x60, 0xcf, 0x68, 0xd3, 0x07, 0x39, 0x1c, 0x83, 0xe7, 0x08, 0x48, 0x03, 0x10,
+	0xce, 0x30, 0xce, 0x22, 0x69, 0xde, 0x6a, 0x91, 0xce, 0x8a, 0xcd, 0x4a, 0xae, 0x8f, 0xd4, 0xbe,
+	0x62, 0x98, 0x45, 0xef, 0x56, 0x8a, 0xe1, 0x38, 0x8b, 0xde, 0x39, 0x83, 0x4f, 0x12, 0x84, 0x59,
+	0x43, 0xc1, 0x56, 0x49, 0xed, 0x2b, 0xa6, 0xa7, 0x88, 0xe5, 0x04, 0xac, 0xaf, 0x12, 0x56, 0x2e,
+	0x25, 0xa0, 0xa0, 0x4c, 0x78, 0x42, 0x37, 0xc5, 0xd8, 0x4d, 0x3d, 0xf0, 0x9c, 0x93, 0x0c, 0x93,
+	0xcd, 0x7a, 0x8b, 0x74, 0xd6, 0xed, 0x8d, 0x12, 0x7e, 0x53, 0xa0, 0xec, 0x31, 0x5d, 0x17, 0x49,
+	0x18, 0xc8, 0x45, 0xd9, 0x2a, 0x96, 0xad, 0x21, 0x58, 0x15, 0x2d, 0xf5, 0x1b, 0x44, 0x1e, 0x7c,
+	0x2c, 0xfb, 0xbd, 0x7d, 0xa9, 0xdf, 0x43, 0xc5, 0x14, 0xfd, 0xbe, 0xa0, 0xf7, 0x40, 0xc8, 0x60,
+	0xe2, 0xca, 0xab, 0x33, 0x69, 0xa0, 0xa4, 0xb9, 0x60, 0x97, 0xa7, 0xd2, 0xa3, 0xf4, 0x24, 0x83,
+	0x0c, 0x8a, 0xab, 0xd0, 0x6f, 0x7e, 0x15, 0x3a, 0xca, 0xf0, 0x2e, 0x0e, 0xa8, 0x01, 0xd1, 0x30,
+	0xf6, 0x4a, 0x13, 0x7a, 0x73, 0x13, 0x5a, 0xe8, 0xd0, 0xe5, 0x29, 0xdd, 0x12, 0xee, 0x24, 0x09,
+	0x41, 0x38, 0x49, 0x1a, 0x0f, 0x41, 0x08, 0xf0, 0x4c, 0x03, 0x5b, 0xbf, 0x53, 0x12, 0x47, 0x15,
+	0xae, 0x86, 0x23, 0x92, 0x2c, 0x72, 0x62, 0xdf, 0x77, 0x44, 0x36, 0xa8, 0xe6, 0xb8, 0x86, 0x73,
+	0xdc, 0x52, 0xd4, 0x6b, 0xdf, 0xef, 0x2f, 0x08, 0x66, 0xd3, 0xed, 0x7f, 0xcc, 0x9d, 0x04, 0x52,
+	0x47, 0x48, 0x48, 0xcc, 0xf5, 0x56, 0xad, 0x63, 0xec, 0x6e, 0x5a, 0xc5, 0xa6, 0xf7, 0x25, 0x24,
+	0x6a, 0x4d, 0x7b, 0x2b, 0xaa, 0x4f, 0xfb, 0xfe, 0xd5, 0xf0, 0x23, 0x48, 0x55, 0x09, 0xdb, 0xa3,
+	0x6b, 0x12, 0x22, 0x37, 0x92, 0x0e, 0xea, 0xcc, 0x0d, 0x74, 0x61, 0xa5, 0xcb, 0x31, 0x52, 0xb8,
+	0xee, 0xa5, 0x91, 0x21, 0x2f, 0xa0, 0xf6, 0x4b, 0xda, 0xa8, 0x72, 0xd8, 0x23, 0xaa, 0xab, 0xc1,
+	0x09, 0xe9, 0x4e, 0x12, 0x7c, 0x0d, 0x35, 0xfb, 0x02, 0x60, 0x4d, 0x5a, 0x7f, 0xef, 0x86, 0x19,
+	0xe0, 0x6a, 0xd7, 0xec, 0xe2, 0xd0, 0xfe, 0x43, 0xa8, 0xb1, 0x14, 0xc1, 0x1e, 0x52, 0xbd, 0x6c,
+	0x26, 0xf0, 0xd0, 0x43, 0xb7, 0x1b, 0x05, 0x70, 0xe8, 0xfd, 0x97, 0x8f, 0xe5, 0x9a, 0xf5, 0xae,
+	0x5f, 0xb3, 0xde, 0xbd, 0xbd, 0xe9, 0x8c, 0x6b, 0x67, 0x33, 0xae, 0x9d, 0xcf, 0x38, 0xf9, 0x9c,
+	0x73, 0xf2, 0x3d, 0xe7, 0xe4, 0x34, 0xe7, 0x64, 0x9a, 0x73, 0xf2, 0x2b, 0xe7, 0xe4, 0x77, 0xce,
+	0xb5, 0xf3, 0x9c, 0x93, 0xaf, 0x73, 0xae, 0x4d, 0xe7, 0x5c, 0x3b, 0x9b, 0x73, 0xed, 0x6d, 0xf1,
+	0xbf, 0x1a, 0xac, 0xe2, 0x12, 0x3e, 0xff, 0x3b, 0x00, 0xc8, 0x32, 0xf3, 0x35, 0xcc, 0x04, 0x00,
+	0x00,
 }
 
 func (this *Stats) Equal(that interface{}) bool {
@@ -340,6 +435,14 @@ func (this *Stats) Equal(that interface{}) bool {
 			return false
 		}
 	}
+	if len(this.TenantStats) != len(that1.TenantStats) {
+		return false
+	}
+	for i := range this.TenantStats {
+		if !this.TenantStats[i].Equal(&that1.TenantStats[i]) {
+			return false
+		}
+	}
 	return true
 }
 func (this *StepStat) Equal(that interface{}) bool {
@@ -369,11 +472,47 @@ func (this *StepStat) Equal(that interface{}) bool {
 	}
 	return true
 }
+func (this *TenantStats) Equal(that interface{}) bool {
+	if that == nil {
+		return this == nil
+	}
+
+	that1, ok := that.(*TenantStats)
+	if !ok {
+		that2, ok := that.(TenantStats)
+		if ok {
+			that1 = &that2
+		} else {
+			return false
+		}
+	}
+	if that1 == nil {
+		return this == nil
+	} else if this == nil {
+		return false
+	}
+	if this.TenantId != that1.TenantId {
+		return false
+	}
+	if this.FetchedSeriesCount != that1.FetchedSeriesCount {
+		return false
+	}
+	if this.FetchedChunkBytes != that1.FetchedChunkBytes {
+		return false
+	}
+	if this.FetchedChunksCount != that1.FetchedChunksCount {
+		return false
+	}
+	if this.FetchedIndexBytes != that1.FetchedIndexBytes {
+		return false
+	}
+	return true
+}
 func (this *Stats) GoString() string {
 	if this == nil {
 		return "nil"
 	}
-	s := make([]string, 0, 17)
+	s := make([]string, 0, 18)
 	s = append(s, "&stats.Stats{")
 	s = append(s, "WallTime: "+fmt.Sprintf("%#v", this.WallTime)+",\n")
 	s = append(s, "FetchedSeriesCount: "+fmt.Sprintf("%#v", this.FetchedSeriesCount)+",\n")
@@ -394,6 +533,13 @@ func (this *Stats) GoString() string {
 		}
 		s = append(s, "SamplesProcessedPerStep: "+fmt.Sprintf("%#v", vs)+",\n")
 	}
+	if this.TenantStats != nil {
+		vs := make([]TenantStats, len(this.TenantStats))
+		for i := range vs {
+			vs[i] = this.TenantStats[i]
+		}
+		s = append(s, "TenantStats: "+fmt.Sprintf("%#v", vs)+",\n")
+	}
 	s = append(s, "}")
 	return strings.Join(s, "")
 }
@@ -408,6 +554,20 @@ func (this *StepStat) GoString() string {
 	s = append(s, "}")
 	return strings.Join(s, "")
 }
+func (this *TenantStats) GoString() string {
+	if this == nil {
+		return "nil"
+	}
+	s := make([]string, 0, 9)
+	s = append(s, "&stats.TenantStats{")
+	s = append(s, "TenantId: "+fmt.Sprintf("%#v", this.TenantId)+",\n")
+	s = append(s, "FetchedSeriesCount: "+fmt.Sprintf("%#v", this.FetchedSeriesCount)+",\n")
+	s = append(s, "FetchedChunkBytes: "+fmt.Sprintf("%#v", this.FetchedChunkBytes)+",\n")
+	s = append(s, "FetchedChunksCount: "+fmt.Sprintf("%#v", this.FetchedChunksCount)+",\n")
+	s = append(s, "FetchedIndexBytes: "+fmt.Sprintf("%#v", this.FetchedIndexBytes)+",\n")
+	s = append(s, "}")
+	return strings.Join(s, "")
+}
 func valueToGoStringStats(v interface{}, typ string) string {
 	rv := reflect.ValueOf(v)
 	if rv.IsNil() {
@@ -436,6 +596,20 @@ func (m *Stats) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if len(m.TenantStats) > 0 {
+		for iNdEx := len(m.TenantStats) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.TenantStats[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintStats(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x72
+		}
+	}
 	if len(m.SamplesProcessedPerStep) > 0 {
 		for iNdEx := len(m.SamplesProcessedPerStep) - 1; iNdEx >= 0; iNdEx-- {
 			{
@@ -555,6 +729,56 @@ func (m *StepStat) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	return len(dAtA) - i, nil
 }
 
+func (m *TenantStats) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *TenantStats) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *TenantStats) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.FetchedIndexBytes != 0 {
+		i = encodeVarintStats(dAtA, i, uint64(m.FetchedIndexBytes))
+		i--
+		dAtA[i] = 0x28
+	}
+	if m.FetchedChunksCount != 0 {
+		i = encodeVarintStats(dAtA, i, uint64(m.FetchedChunksCount))
+		i--
+		dAtA[i] = 0x20
+	}
+	if m.FetchedChunkBytes != 0 {
+		i = encodeVarintStats(dAtA, i, uint64(m.FetchedChunkBytes))
+		i--
+		dAtA[i] = 0x18
+	}
+	if m.FetchedSeriesCount != 0 {
+		i = encodeVarintStats(dAtA, i, uint64(m.FetchedSeriesCount))
+		i--
+		dAtA[i] = 0x10
+	}
+	if len(m.TenantId) > 0 {
+		i -= len(m.TenantId)
+		copy(dAtA[i:], m.TenantId)
+		i = encodeVarintStats(dAtA, i, uint64(len(m.TenantId)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
 func encodeVarintStats(dAtA []byte, offset int, v uint64) int {
 	offset -= sovStats(v)
 	base := offset
@@ -611,6 +835,12 @@ func (m *Stats) Size() (n int) {
 			n += 1 + l + sovStats(uint64(l))
 		}
 	}
+	if len(m.TenantStats) > 0 {
+		for _, e := range m.TenantStats {
+			l = e.Size()
+			n += 1 + l + sovStats(uint64(l))
+		}
+	}
 	return n
 }
 
@@ -629,6 +859,31 @@ func (m *StepStat) Size() (n int) {
 	return n
 }
 
+func (m *TenantStats) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = len(m.TenantId)
+	if l > 0 {
+		n += 1 + l + sovStats(uint64(l))
+	}
+	if m.FetchedSeriesCount != 0 {
+		n += 1 + sovStats(uint64(m.FetchedSeriesCount))
+	}
+	if m.FetchedChunkBytes != 0 {
+		n += 1 + sovStats(uint64(m.FetchedChunkBytes))
+	}
+	if m.FetchedChunksCount != 0 {
+		n += 1 + sovStats(uint64(m.FetchedChunksCount))
+	}
+	if m.FetchedIndexBytes != 0 {
+		n += 1 + sovStats(uint64(m.FetchedIndexBytes))
+	}
+	return n
+}
+
 func sovStats(x uint64) (n int) {
 	return (math_bits.Len64(x|1) + 6) / 7
 }
@@ -644,6 +899,11 @@ func (this *Stats) String() string {
 		repeatedStringForSamplesProcessedPerStep += strings.Replace(strings.Replace(f.String(), "StepStat", "StepStat", 1), `&`, ``, 1) + ","
 	}
 	repeatedStringForSamplesProcessedPerStep += "}"
+	repeatedStringForTenantStats := "[]TenantStats{"
+	for _, f := range this.TenantStats {
+		repeatedStringForTenantStats += strings.Replace(strings.Replace(f.String(), "TenantStats", "TenantStats", 1), `&`, ``, 1) + ","
+	}
+	repeatedStringForTenantStats += "}"
 	s := strings.Join([]string{`&Stats{`,
 		`WallTime:` + strings.Replace(strings.Replace(fmt.Sprintf("%v", this.WallTime), "Duration", "durationpb.Duration", 1), `&`, ``, 1) + `,`,
 		`FetchedSeriesCount:` + fmt.Sprintf("%v", this.FetchedSeriesCount) + `,`,
@@ -658,6 +918,7 @@ func (this *Stats) String() string {
 		`SamplesProcessed:` + fmt.Sprintf("%v", this.SamplesProcessed) + `,`,
 		`SpunOffSubqueries:` + fmt.Sprintf("%v", this.SpunOffSubqueries) + `,`,
 		`SamplesProcessedPerStep:` + repeatedStringForSamplesProcessedPerStep + `,`,
+		`TenantStats:` + repeatedStringForTenantStats + `,`,
 		`}`,
 	}, "")
 	return s
@@ -673,6 +934,20 @@ func (this *StepStat) String() string {
 	}, "")
 	return s
 }
+func (this *TenantStats) String() string {
+	if this == nil {
+		return "nil"
+	}
+	s := strings.Join([]string{`&TenantStats{`,
+		`TenantId:` + fmt.Sprintf("%v", this.TenantId) + `,`,
+		`FetchedSeriesCount:` + fmt.Sprintf("%v", this.FetchedSeriesCount) + `,`,
+		`FetchedChunkBytes:` + fmt.Sprintf("%v", this.FetchedChunkBytes) + `,`,
+		`FetchedChunksCount:` + fmt.Sprintf("%v", this.FetchedChunksCount) + `,`,
+		`FetchedIndexBytes:` + fmt.Sprintf("%v", this.FetchedIndexBytes) + `,`,
+		`}`,
+	}, "")
+	return s
+}
 func valueToStringStats(v interface{}) string {
 	rv := reflect.ValueOf(v)
 	if rv.IsNil() {
@@ -1014,6 +1289,40 @@ func (m *Stats) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 14:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field TenantStats", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowStats
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthStats
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthStats
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.TenantStats = append(m.TenantStats, TenantStats{})
+			if err := m.TenantStats[len(m.TenantStats)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipStats(dAtA[iNdEx:])
@@ -1123,6 +1432,164 @@ func (m *StepStat) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
+func (m *TenantStats) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowStats
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: TenantStats: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: TenantStats: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field TenantId", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowStats
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthStats
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthStats
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.TenantId = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field FetchedSeriesCount", wireType)
+			}
+			m.FetchedSeriesCount = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowStats
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.FetchedSeriesCount |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field FetchedChunkBytes", wireType)
+			}
+			m.FetchedChunkBytes = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowStats
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.FetchedChunkBytes |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field FetchedChunksCount", wireType)
+			}
+			m.FetchedChunksCount = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowStats
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.FetchedChunksCount |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field FetchedIndexBytes", wireType)
+			}
+			m.FetchedIndexBytes = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowStats
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.FetchedIndexBytes |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipStats(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if (skippy < 0) || (iNdEx+skippy) < 0 {
+				return ErrInvalidLengthStats
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
 func skipStats(dAtA []byte) (n int, err error) {
 	l := len(dAtA)
 	iNdEx := 0
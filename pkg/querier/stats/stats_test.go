@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestStats_WallTime(t *testing.T) {
@@ -213,6 +214,46 @@ func TestStats_Merge(t *testing.T) {
 	})
 }
 
+func TestStats_TenantStats(t *testing.T) {
+	tenantA := &SafeStats{}
+	tenantA.AddFetchedSeries(10)
+	tenantA.AddFetchedChunks(20)
+	tenantA.AddFetchedChunkBytes(300)
+	tenantA.AddFetchedIndexBytes(40)
+
+	tenantB := &SafeStats{}
+	tenantB.AddFetchedSeries(1)
+
+	stats1 := &SafeStats{}
+	stats1.AddTenantStats("b", tenantB)
+	stats1.AddTenantStats("a", tenantA)
+
+	// Adding tenant stats doesn't change the totals.
+	assert.Equal(t, uint64(0), stats1.LoadFetchedSeries())
+	assert.Equal(t, []TenantStats{
+		{TenantId: "a", FetchedSeriesCount: 10, FetchedChunksCount: 20, FetchedChunkBytes: 300, FetchedIndexBytes: 40},
+		{TenantId: "b", FetchedSeriesCount: 1},
+	}, stats1.LoadTenantStats())
+
+	stats2 := &SafeStats{}
+	stats2.AddTenantStats("c", tenantB)
+	stats2.AddTenantStats("b", tenantB)
+
+	stats1.Merge(stats2)
+	assert.Equal(t, []TenantStats{
+		{TenantId: "a", FetchedSeriesCount: 10, FetchedChunksCount: 20, FetchedChunkBytes: 300, FetchedIndexBytes: 40},
+		{TenantId: "b", FetchedSeriesCount: 2},
+		{TenantId: "c", FetchedSeriesCount: 1},
+	}, stats1.LoadTenantStats())
+
+	// Tenant stats survive the protobuf round trip between querier and query-frontend.
+	data, err := stats1.Marshal()
+	require.NoError(t, err)
+	decoded := &SafeStats{}
+	require.NoError(t, decoded.Unmarshal(data))
+	assert.Equal(t, stats1.LoadTenantStats(), decoded.LoadTenantStats())
+}
+
 func TestStats_Copy(t *testing.T) {
 	s1 := &SafeStats{
 		Stats: Stats{
@@ -10,6 +10,7 @@ import (
 	"slices"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-kit/log"
@@ -24,6 +25,8 @@ import (
 	"github.com/prometheus/prometheus/tsdb/chunkenc"
 	"github.com/prometheus/prometheus/util/annotations"
 
+	"github.com/grafana/mimir/pkg/querier/stats"
+	"github.com/grafana/mimir/pkg/util/limiter"
 	"github.com/grafana/mimir/pkg/util/spanlogger"
 )
 
@@ -38,7 +41,10 @@ import (
 // If the label "__tenant_id__" already exists, its value is overwritten
 // by the tenant ID and the previous value is exposed through a new label
 // prefixed with "original_". This behaviour is not implemented recursively.
-func NewQueryable(upstream storage.Queryable, bypassWithSingleID bool, maxConcurrency int, reg prometheus.Registerer, logger log.Logger) storage.Queryable {
+// The resolver is used to find the tenant IDs involved in a request, see NewTenantSetsResolver.
+// The data fetched by each tenant query is attributed to the tenant in the query stats, and the
+// data fetched across all tenants is limited according to limits.
+func NewQueryable(upstream storage.Queryable, resolver tenant.Resolver, bypassWithSingleID bool, maxConcurrency int, limits FederatedQueryLimits, reg prometheus.Registerer, logger log.Logger) storage.Queryable {
 	callbacks := MergeQueryableCallbacks{
 		Querier: func(mint, maxt int64) (MergeQuerierUpstream, error) {
 			q, err := upstream.Querier(mint, maxt)
@@ -51,7 +57,7 @@ func NewQueryable(upstream storage.Queryable, bypassWithSingleID bool, maxConcur
 			}, nil
 		},
 	}
-	return NewMergeQueryable(defaultTenantLabel, callbacks, tenant.NewMultiResolver(), bypassWithSingleID, maxConcurrency, reg, logger, nil)
+	return NewMergeQueryableWithLimits(defaultTenantLabel, callbacks, resolver, bypassWithSingleID, maxConcurrency, limits, reg, logger, nil)
 }
 
 // MergeQueryableCallbacks contains callbacks to NewMergeQueryable, for customizing its behaviour.
@@ -70,26 +76,71 @@ type MergeQuerierUpstream interface {
 
 // tenantQuerier implements MergeQuerierUpstream, wrapping a storage.Querier.
 // The federation ID gets injected into the context as a tenant ID.
+//
+// When query stats are enabled, each tenant query records its stats in a dedicated SafeStats,
+// which is merged into the query stats and attributed to the tenant when the querier is closed.
 type tenantQuerier struct {
 	upstream storage.Querier
+
+	statsMx     sync.Mutex
+	parentStats *stats.SafeStats
+	tenantStats map[string]*stats.SafeStats
 }
 
 func (q *tenantQuerier) Select(ctx context.Context, id string, sortSeries bool, hints *storage.SelectHints, matchers ...*labels.Matcher) storage.SeriesSet {
-	return q.upstream.Select(user.InjectOrgID(ctx, id), sortSeries, hints, matchers...)
+	return q.upstream.Select(q.tenantContext(ctx, id), sortSeries, hints, matchers...)
 }
 
 func (q *tenantQuerier) LabelValues(ctx context.Context, id string, name string, hints *storage.LabelHints, matchers ...*labels.Matcher) ([]string, annotations.Annotations, error) {
-	return q.upstream.LabelValues(user.InjectOrgID(ctx, id), name, hints, matchers...)
+	return q.upstream.LabelValues(q.tenantContext(ctx, id), name, hints, matchers...)
 }
 
 func (q *tenantQuerier) LabelNames(ctx context.Context, id string, hints *storage.LabelHints, matchers ...*labels.Matcher) ([]string, annotations.Annotations, error) {
-	return q.upstream.LabelNames(user.InjectOrgID(ctx, id), hints, matchers...)
+	return q.upstream.LabelNames(q.tenantContext(ctx, id), hints, matchers...)
 }
 
 func (q *tenantQuerier) Close() error {
+	q.statsMx.Lock()
+	for id, s := range q.tenantStats {
+		q.parentStats.Merge(s)
+		q.parentStats.AddTenantStats(id, s)
+	}
+	q.tenantStats = nil
+	q.statsMx.Unlock()
+
 	return q.upstream.Close()
 }
 
+// tenantContext returns the context for the query of the tenant id.
+func (q *tenantQuerier) tenantContext(ctx context.Context, id string) context.Context {
+	ctx = user.InjectOrgID(ctx, id)
+
+	parent := stats.FromContext(ctx)
+	if parent == nil {
+		return ctx
+	}
+
+	q.statsMx.Lock()
+	defer q.statsMx.Unlock()
+
+	// All the queries run by a querier share the same stats, so we track the parent of the first one only.
+	if q.parentStats == nil {
+		q.parentStats = parent
+	} else if q.parentStats != parent {
+		return ctx
+	}
+
+	s, ok := q.tenantStats[id]
+	if !ok {
+		if q.tenantStats == nil {
+			q.tenantStats = map[string]*stats.SafeStats{}
+		}
+		s = &stats.SafeStats{}
+		q.tenantStats[id] = s
+	}
+	return stats.ContextWithStats(ctx, s)
+}
+
 // NewMergeQueryable returns a queryable that merges results for all involved
 // federation IDs. The underlying querier is returned by a callback in
 // MergeQueryableCallbacks.
@@ -108,6 +159,12 @@ func (q *tenantQuerier) Close() error {
 // Select method that is used to query multiple tenants in parallel. When left
 // nil, the default behavior is used.
 func NewMergeQueryable(idLabelName string, callbacks MergeQueryableCallbacks, resolver tenant.Resolver, bypassWithSingleID bool, maxConcurrency int, reg prometheus.Registerer, logger log.Logger, multiTenantSelectFunc MultiTenantSelectFunc) storage.Queryable {
+	return NewMergeQueryableWithLimits(idLabelName, callbacks, resolver, bypassWithSingleID, maxConcurrency, FederatedQueryLimits{}, reg, logger, multiTenantSelectFunc)
+}
+
+// NewMergeQueryableWithLimits is like NewMergeQueryable, but also limits the data fetched
+// across all the federation IDs of a query according to limits.
+func NewMergeQueryableWithLimits(idLabelName string, callbacks MergeQueryableCallbacks, resolver tenant.Resolver, bypassWithSingleID bool, maxConcurrency int, limits FederatedQueryLimits, reg prometheus.Registerer, logger log.Logger, multiTenantSelectFunc MultiTenantSelectFunc) storage.Queryable {
 	if multiTenantSelectFunc == nil {
 		multiTenantSelectFunc = defaultMultiTenantSelectFunc
 	}
@@ -126,6 +183,11 @@ func NewMergeQueryable(idLabelName string, callbacks MergeQueryableCallbacks, re
 			NativeHistogramMaxBucketNumber:  100,
 			NativeHistogramMinResetDuration: 1 * time.Hour,
 		}),
+
+		queriesRejected: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_querier_federation_queries_rejected_total",
+			Help: "Number of federated queries that were rejected because they exceeded a federated query limit.",
+		}, []string{"reason"}),
 	}
 	// Note that we allow tenant.Resolver to be injected instead of using the
 	// tenant.TenantIDs() method because GEM needs to inject different behavior
@@ -137,6 +199,7 @@ func NewMergeQueryable(idLabelName string, callbacks MergeQueryableCallbacks, re
 		resolver:              resolver,
 		bypassWithSingleID:    bypassWithSingleID,
 		maxConcurrency:        maxConcurrency,
+		limits:                limits,
 		multiTenantSelectFunc: multiTenantSelectFunc,
 		mergeQueryableMetrics: metrics,
 	}
@@ -149,6 +212,7 @@ type mergeQueryable struct {
 	callbacks             MergeQueryableCallbacks
 	resolver              tenant.Resolver
 	maxConcurrency        int
+	limits                FederatedQueryLimits
 	multiTenantSelectFunc MultiTenantSelectFunc
 
 	mergeQueryableMetrics
@@ -157,6 +221,7 @@ type mergeQueryable struct {
 type mergeQueryableMetrics struct {
 	tenantsQueried            prometheus.Histogram
 	upstreamQueryWaitDuration prometheus.Histogram
+	queriesRejected           *prometheus.CounterVec
 }
 
 // Querier returns a new mergeQuerier, which aggregates results for multiple federation IDs
@@ -177,6 +242,7 @@ func (m *mergeQueryable) Querier(mint int64, maxt int64) (storage.Querier, error
 		tenantsQueried:            m.tenantsQueried,
 		upstreamQueryWaitDuration: m.upstreamQueryWaitDuration,
 		multiTenantSelectFunc:     m.multiTenantSelectFunc,
+		federatedLimiter:          m.limits.newLimiter(m.queriesRejected),
 	}, nil
 }
 
@@ -196,6 +262,9 @@ type mergeQuerier struct {
 	tenantsQueried            prometheus.Histogram
 	upstreamQueryWaitDuration prometheus.Histogram
 	multiTenantSelectFunc     MultiTenantSelectFunc
+
+	// federatedLimiter is nil if no federated query limit is configured.
+	federatedLimiter *limiter.FederatedQueryLimiter
 }
 
 // LabelValues returns all potential values for a label name given involved federation IDs.
@@ -375,6 +444,10 @@ func (m *mergeQuerier) Select(ctx context.Context, sortSeries bool, hints *stora
 		jobs = append(jobs, id)
 	}
 
+	if m.federatedLimiter != nil {
+		ctx = limiter.AddFederatedQueryLimiterToContext(ctx, m.federatedLimiter)
+	}
+
 	wrMergeQuerier := waitRecordingMergeQuerier{
 		start:                     start,
 		upstreamQueryWaitDuration: m.upstreamQueryWaitDuration,
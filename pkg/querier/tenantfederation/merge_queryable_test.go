@@ -12,6 +12,7 @@ import (
 	"reflect"
 	"slices"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/go-kit/log"
@@ -31,7 +32,9 @@ import (
 	tracesdk "go.opentelemetry.io/otel/sdk/trace"
 	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 
+	"github.com/grafana/mimir/pkg/querier/stats"
 	"github.com/grafana/mimir/pkg/storage/series"
+	"github.com/grafana/mimir/pkg/util/limiter"
 	"github.com/grafana/mimir/pkg/util/spanlogger"
 )
 
@@ -284,7 +287,7 @@ type mergeQueryableScenario struct {
 func (s *mergeQueryableScenario) init(t *testing.T) (context.Context, prometheus.Gatherer, storage.Querier) {
 	// initialize with default tenant label
 	reg := prometheus.NewPedanticRegistry()
-	q := NewQueryable(&s.queryable, !s.doNotByPassSingleQuerier, defaultConcurrency, reg, log.NewNopLogger())
+	q := NewQueryable(&s.queryable, tenant.NewMultiResolver(), !s.doNotByPassSingleQuerier, defaultConcurrency, FederatedQueryLimits{}, reg, log.NewNopLogger())
 
 	// inject tenants into context
 	ctx := context.Background()
@@ -374,7 +377,7 @@ func TestMergeQueryable_Querier(t *testing.T) {
 		queryable := &mockTenantQueryableWithFilter{
 			logger: log.NewNopLogger(),
 		}
-		qable := NewQueryable(queryable, false /* bypassWithSingleID */, defaultConcurrency, reg, log.NewNopLogger())
+		qable := NewQueryable(queryable, tenant.NewMultiResolver(), false /* bypassWithSingleID */, defaultConcurrency, FederatedQueryLimits{}, reg, log.NewNopLogger())
 		q, err := qable.Querier(mint, maxt)
 		require.NoError(t, err)
 
@@ -983,6 +986,106 @@ func TestSetLabelsRetainExisting(t *testing.T) {
 	}
 }
 
+func TestMergeQueryable_TenantStats(t *testing.T) {
+	fetchedSeriesByTenant := map[string]uint64{"team-a": 3, "team-b": 5}
+
+	queryable := storage.QueryableFunc(func(_, _ int64) (storage.Querier, error) {
+		return &statsRecordingQuerier{fetchedSeriesByTenant: fetchedSeriesByTenant}, nil
+	})
+
+	qable := NewQueryable(queryable, tenant.NewMultiResolver(), false, defaultConcurrency, FederatedQueryLimits{}, prometheus.NewPedanticRegistry(), log.NewNopLogger())
+	q, err := qable.Querier(mint, maxt)
+	require.NoError(t, err)
+
+	queryStats, ctx := stats.ContextWithEmptyStats(user.InjectOrgID(context.Background(), "team-a|team-b"))
+	set := q.Select(ctx, true, nil)
+	for set.Next() {
+	}
+	require.NoError(t, set.Err())
+
+	// Stats are attributed to each tenant once the querier is closed.
+	assert.Empty(t, queryStats.LoadTenantStats())
+	require.NoError(t, q.Close())
+
+	assert.Equal(t, uint64(8), queryStats.LoadFetchedSeries())
+	assert.Equal(t, []stats.TenantStats{
+		{TenantId: "team-a", FetchedSeriesCount: 3},
+		{TenantId: "team-b", FetchedSeriesCount: 5},
+	}, queryStats.LoadTenantStats())
+}
+
+func TestMergeQueryable_FederatedQueryLimits(t *testing.T) {
+	for name, tc := range map[string]struct {
+		tenants         string
+		limits          FederatedQueryLimits
+		expectedLimiter bool
+	}{
+		"federated query with limits": {
+			tenants:         "team-a|team-b",
+			limits:          FederatedQueryLimits{MaxFetchedSeries: 10},
+			expectedLimiter: true,
+		},
+		"federated query without limits": {
+			tenants:         "team-a|team-b",
+			expectedLimiter: false,
+		},
+		"single tenant query with limits": {
+			tenants:         "team-a",
+			limits:          FederatedQueryLimits{MaxFetchedSeries: 10},
+			expectedLimiter: false,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			upstream := &statsRecordingQuerier{}
+			queryable := storage.QueryableFunc(func(_, _ int64) (storage.Querier, error) {
+				return upstream, nil
+			})
+
+			qable := NewQueryable(queryable, tenant.NewMultiResolver(), true, defaultConcurrency, tc.limits, prometheus.NewPedanticRegistry(), log.NewNopLogger())
+			q, err := qable.Querier(mint, maxt)
+			require.NoError(t, err)
+
+			set := q.Select(user.InjectOrgID(context.Background(), tc.tenants), true, nil)
+			for set.Next() {
+			}
+			require.NoError(t, set.Err())
+			require.NotEmpty(t, upstream.limiters)
+			for _, l := range upstream.limiters {
+				assert.Equal(t, tc.expectedLimiter, l != nil)
+			}
+		})
+	}
+}
+
+// statsRecordingQuerier is a storage.Querier recording fetched series in the query stats
+// and the federated query limiter found in the context of each Select.
+type statsRecordingQuerier struct {
+	storage.Querier
+
+	fetchedSeriesByTenant map[string]uint64
+
+	mtx      sync.Mutex
+	limiters []*limiter.FederatedQueryLimiter
+}
+
+func (q *statsRecordingQuerier) Select(ctx context.Context, _ bool, _ *storage.SelectHints, _ ...*labels.Matcher) storage.SeriesSet {
+	tenantID, err := tenant.TenantID(ctx)
+	if err != nil {
+		return storage.ErrSeriesSet(err)
+	}
+	stats.FromContext(ctx).AddFetchedSeries(q.fetchedSeriesByTenant[tenantID])
+
+	q.mtx.Lock()
+	q.limiters = append(q.limiters, limiter.FederatedQueryLimiterFromContext(ctx))
+	q.mtx.Unlock()
+
+	return storage.EmptySeriesSet()
+}
+
+func (q *statsRecordingQuerier) Close() error {
+	return nil
+}
+
 func TestTracingMergeQueryable(t *testing.T) {
 	spanExporter.Reset()
 
@@ -990,7 +1093,7 @@ func TestTracingMergeQueryable(t *testing.T) {
 	ctx := user.InjectOrgID(context.Background(), "team-a|team-b")
 
 	filter := mockTenantQueryableWithFilter{}
-	q := NewQueryable(&filter, false, defaultConcurrency, reg, log.NewNopLogger())
+	q := NewQueryable(&filter, tenant.NewMultiResolver(), false, defaultConcurrency, FederatedQueryLimits{}, reg, log.NewNopLogger())
 	// retrieve querier if set
 	querier, err := q.Querier(mint, maxt)
 	require.NoError(t, err)
@@ -8,8 +8,11 @@ package tenantfederation
 import (
 	"flag"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/prometheus/model/labels"
 	"go.opentelemetry.io/otel"
+
+	"github.com/grafana/mimir/pkg/util/limiter"
 )
 
 const (
@@ -26,12 +29,49 @@ type Config struct {
 	Enabled       bool `yaml:"enabled"`
 	MaxConcurrent int  `yaml:"max_concurrent" category:"experimental"`
 	MaxTenants    int  `yaml:"max_tenants"`
+
+	TenantSetsEnabled         bool   `yaml:"tenant_sets_enabled" category:"experimental"`
+	TenantSetsPrincipalHeader string `yaml:"tenant_sets_principal_header" category:"experimental"`
+
+	MaxFetchedSeriesPerQuery     int `yaml:"max_fetched_series_per_query" category:"experimental"`
+	MaxFetchedChunkBytesPerQuery int `yaml:"max_fetched_chunk_bytes_per_query" category:"experimental"`
+	MaxFetchedChunksPerQuery     int `yaml:"max_fetched_chunks_per_query" category:"experimental"`
 }
 
 func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.BoolVar(&cfg.Enabled, "tenant-federation.enabled", false, "If enabled on all services, queries can be federated across multiple tenants. The tenant IDs involved need to be specified separated by a '|' character in the 'X-Scope-OrgID' header.")
 	f.IntVar(&cfg.MaxConcurrent, "tenant-federation.max-concurrent", defaultConcurrency, "The number of workers used for each tenant federated query. This setting limits the maximum number of per-tenant queries executed at a time for a tenant federated query.")
 	f.IntVar(&cfg.MaxTenants, "tenant-federation.max-tenants", defaultMaxTenants, "The max number of tenant IDs that may be supplied for a federated query if enabled. 0 to disable the limit.")
+	f.BoolVar(&cfg.TenantSetsEnabled, "tenant-federation.tenant-sets-enabled", false, "If enabled, tenant sets defined in the runtime configuration can be referenced as 'set(<name>)' in the 'X-Scope-OrgID' header of a federated query. Tenant set references are resolved to the tenants they contain before the max tenants limit is enforced.")
+	f.StringVar(&cfg.TenantSetsPrincipalHeader, "tenant-federation.tenant-sets-principal-header", "", "HTTP header carrying the principal issuing the request. The principal is checked against the allowed principals of a tenant set. If empty, only tenant sets without allowed principals can be queried. The header is trusted as is, so it must be set by an authenticating proxy in front of Mimir, which must overwrite or strip the header sent by the clients.")
+	f.IntVar(&cfg.MaxFetchedSeriesPerQuery, "tenant-federation.max-fetched-series-per-query", 0, "The maximum number of series fetched across all the tenants of a federated query. The same series fetched for different tenants is counted once per tenant. The per-tenant limits of each tenant still apply. 0 to disable the limit.")
+	f.IntVar(&cfg.MaxFetchedChunkBytesPerQuery, "tenant-federation.max-fetched-chunk-bytes-per-query", 0, "The maximum size of all chunks in bytes fetched across all the tenants of a federated query. The per-tenant limits of each tenant still apply. 0 to disable the limit.")
+	f.IntVar(&cfg.MaxFetchedChunksPerQuery, "tenant-federation.max-fetched-chunks-per-query", 0, "The maximum number of chunks fetched across all the tenants of a federated query. The per-tenant limits of each tenant still apply. 0 to disable the limit.")
+}
+
+// QueryLimits returns the limits applied to the data fetched across all the tenants of a federated query.
+func (cfg *Config) QueryLimits() FederatedQueryLimits {
+	return FederatedQueryLimits{
+		MaxFetchedSeries:     cfg.MaxFetchedSeriesPerQuery,
+		MaxFetchedChunkBytes: cfg.MaxFetchedChunkBytesPerQuery,
+		MaxFetchedChunks:     cfg.MaxFetchedChunksPerQuery,
+	}
+}
+
+// FederatedQueryLimits are the limits applied to the data fetched across all the tenants of a
+// federated query. A limit set to 0 is disabled.
+type FederatedQueryLimits struct {
+	MaxFetchedSeries     int
+	MaxFetchedChunkBytes int
+	MaxFetchedChunks     int
+}
+
+// newLimiter returns a new limiter for a federated query, or nil if no limit is set.
+func (l FederatedQueryLimits) newLimiter(rejected *prometheus.CounterVec) *limiter.FederatedQueryLimiter {
+	if l == (FederatedQueryLimits{}) {
+		return nil
+	}
+	return limiter.NewFederatedQueryLimiter(l.MaxFetchedSeries, l.MaxFetchedChunkBytes, l.MaxFetchedChunks, rejected)
 }
 
 // FilterValuesByMatchers applies matchers to inputed `idLabelName` and
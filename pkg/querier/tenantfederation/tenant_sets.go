@@ -0,0 +1,215 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package tenantfederation
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/grafana/dskit/tenant"
+	"github.com/grafana/dskit/user"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	tenantSetReferencePrefix = "set("
+	tenantSetReferenceSuffix = ")"
+)
+
+var (
+	// ErrUnknownTenantSet is returned when a request references a tenant set that is not defined.
+	ErrUnknownTenantSet = errors.New("unknown tenant set")
+
+	// ErrTenantSetNotAllowed is returned when the requesting principal is not allowed to query a tenant set.
+	ErrTenantSetNotAllowed = errors.New("principal is not allowed to query tenant set")
+
+	// ErrEmptyTenantSet is returned when a tenant set resolves to no tenants.
+	ErrEmptyTenantSet = errors.New("tenant set resolved to no tenants")
+)
+
+// TenantSet is a named group of tenants defined in the runtime configuration. A tenant set can be
+// referenced in the X-Scope-OrgID header as "set(<name>)" and is resolved server-side to the
+// tenants it contains.
+type TenantSet struct {
+	// Tenants is an explicit list of tenant IDs belonging to the set.
+	Tenants []string `yaml:"tenants,omitempty" json:"tenants,omitempty"`
+
+	// Match is a regular expression, anchored at both ends, selecting tenants among the known tenants.
+	Match string `yaml:"match,omitempty" json:"match,omitempty"`
+
+	// AllowedPrincipals is the list of principals allowed to query the set. If empty, any principal
+	// (including requests without a principal) is allowed.
+	AllowedPrincipals []string `yaml:"allowed_principals,omitempty" json:"allowed_principals,omitempty"`
+
+	matchRegexp *regexp.Regexp
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+// The tenant IDs and the match regular expression are validated when the set is loaded.
+func (s *TenantSet) UnmarshalYAML(value *yaml.Node) error {
+	// Use a type alias to avoid infinite recursion when decoding.
+	type plain TenantSet
+	if err := value.DecodeWithOptions((*plain)(s), yaml.DecodeOptions{KnownFields: true}); err != nil {
+		return err
+	}
+	return s.compile()
+}
+
+func (s *TenantSet) compile() error {
+	for _, id := range s.Tenants {
+		if err := tenant.ValidTenantID(id); err != nil {
+			return errors.Wrapf(err, "invalid tenant in tenant set")
+		}
+		if _, ok := ParseTenantSetReference(id); ok {
+			return fmt.Errorf("tenant set can't reference another tenant set: %s", id)
+		}
+	}
+
+	s.matchRegexp = nil
+	if s.Match != "" {
+		re, err := regexp.Compile("^(?:" + s.Match + ")$")
+		if err != nil {
+			return errors.Wrapf(err, "invalid match regular expression in tenant set")
+		}
+		s.matchRegexp = re
+	}
+	return nil
+}
+
+// allows returns whether the principal is allowed to query the tenant set.
+func (s *TenantSet) allows(principal string) bool {
+	return len(s.AllowedPrincipals) == 0 || (principal != "" && slices.Contains(s.AllowedPrincipals, principal))
+}
+
+// resolve returns the tenants of the set. Tenants matched by the regular expression are selected
+// among knownTenants.
+func (s *TenantSet) resolve(knownTenants []string) []string {
+	out := slices.Clone(s.Tenants)
+	if s.matchRegexp != nil {
+		for _, id := range knownTenants {
+			if s.matchRegexp.MatchString(id) {
+				out = append(out, id)
+			}
+		}
+	}
+	return out
+}
+
+// TenantSetsProvider provides the tenant sets and the tenants known to the cluster.
+type TenantSetsProvider interface {
+	// TenantSets returns the tenant sets by name.
+	TenantSets() map[string]*TenantSet
+
+	// KnownTenants returns the tenants that the Match regular expression of a tenant set is evaluated against.
+	KnownTenants() []string
+}
+
+// ParseTenantSetReference returns the name of the tenant set referenced by id, and whether id is a
+// tenant set reference at all.
+func ParseTenantSetReference(id string) (string, bool) {
+	if !strings.HasPrefix(id, tenantSetReferencePrefix) || !strings.HasSuffix(id, tenantSetReferenceSuffix) {
+		return "", false
+	}
+	name := id[len(tenantSetReferencePrefix) : len(id)-len(tenantSetReferenceSuffix)]
+	return name, name != ""
+}
+
+// ExpandTenantSets replaces the tenant set references in ids with the tenants they resolve to.
+// The returned tenant IDs are sorted and de-duplicated. The input slice is not modified.
+func ExpandTenantSets(ids []string, principal string, provider TenantSetsProvider) ([]string, error) {
+	if !slices.ContainsFunc(ids, isTenantSetReference) {
+		return ids, nil
+	}
+
+	var (
+		sets         map[string]*TenantSet
+		knownTenants []string
+	)
+	if provider != nil {
+		sets = provider.TenantSets()
+		knownTenants = provider.KnownTenants()
+	}
+
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		name, ok := ParseTenantSetReference(id)
+		if !ok {
+			out = append(out, id)
+			continue
+		}
+
+		set := sets[name]
+		if set == nil {
+			return nil, errors.Wrapf(ErrUnknownTenantSet, "tenant set %q", name)
+		}
+		if !set.allows(principal) {
+			return nil, errors.Wrapf(ErrTenantSetNotAllowed, "principal %q, tenant set %q", principal, name)
+		}
+
+		resolved := set.resolve(knownTenants)
+		if len(resolved) == 0 {
+			return nil, errors.Wrapf(ErrEmptyTenantSet, "tenant set %q", name)
+		}
+		out = append(out, resolved...)
+	}
+
+	return tenant.NormalizeTenantIDs(out), nil
+}
+
+func isTenantSetReference(id string) bool {
+	_, ok := ParseTenantSetReference(id)
+	return ok
+}
+
+type principalContextKey int
+
+const principalKey principalContextKey = 0
+
+// InjectPrincipal returns a derived context containing the principal issuing the request.
+func InjectPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey, principal)
+}
+
+// PrincipalFromContext returns the principal issuing the request, or an empty string if not set.
+func PrincipalFromContext(ctx context.Context) string {
+	principal, _ := ctx.Value(principalKey).(string)
+	return principal
+}
+
+// NewTenantSetsResolver returns a tenant.Resolver that expands tenant set references found in the
+// tenant IDs of the request. The principal used to authorize access to tenant sets is read from
+// the context, see InjectPrincipal.
+func NewTenantSetsResolver(provider TenantSetsProvider) tenant.Resolver {
+	return &tenantSetsResolver{
+		upstream: tenant.NewMultiResolver(),
+		provider: provider,
+	}
+}
+
+type tenantSetsResolver struct {
+	upstream tenant.Resolver
+	provider TenantSetsProvider
+}
+
+func (r *tenantSetsResolver) TenantID(ctx context.Context) (string, error) {
+	ids, err := r.TenantIDs(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(ids) > 1 {
+		return "", user.ErrTooManyOrgIDs
+	}
+	return ids[0], nil
+}
+
+func (r *tenantSetsResolver) TenantIDs(ctx context.Context) ([]string, error) {
+	ids, err := r.upstream.TenantIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ExpandTenantSets(ids, PrincipalFromContext(ctx), r.provider)
+}
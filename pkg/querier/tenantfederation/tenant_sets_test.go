@@ -0,0 +1,141 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package tenantfederation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/grafana/dskit/user"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+type staticTenantSets struct {
+	sets         map[string]*TenantSet
+	knownTenants []string
+}
+
+func (s staticTenantSets) TenantSets() map[string]*TenantSet { return s.sets }
+func (s staticTenantSets) KnownTenants() []string            { return s.knownTenants }
+
+func newStaticTenantSets(t *testing.T, config string, knownTenants ...string) staticTenantSets {
+	var sets map[string]*TenantSet
+	require.NoError(t, yaml.Unmarshal([]byte(config), &sets))
+	return staticTenantSets{sets: sets, knownTenants: knownTenants}
+}
+
+func TestParseTenantSetReference(t *testing.T) {
+	for id, expected := range map[string]struct {
+		name string
+		ok   bool
+	}{
+		"set(prod)":  {name: "prod", ok: true},
+		"set()":      {},
+		"set(prod":   {},
+		"prod":       {},
+		"xset(prod)": {},
+	} {
+		name, ok := ParseTenantSetReference(id)
+		require.Equal(t, expected.name, name, id)
+		require.Equal(t, expected.ok, ok, id)
+	}
+}
+
+func TestExpandTenantSets(t *testing.T) {
+	provider := newStaticTenantSets(t, `
+prod:
+  match: prod-.*
+  tenants: [legacy]
+restricted:
+  tenants: [secret-a, secret-b]
+  allowed_principals: [sre]
+empty:
+  match: staging-.*
+`, "prod-a", "prod-b", "dev-a", "production")
+
+	for name, tc := range map[string]struct {
+		ids         []string
+		principal   string
+		expected    []string
+		expectedErr error
+	}{
+		"no tenant set reference": {
+			ids:      []string{"a", "b"},
+			expected: []string{"a", "b"},
+		},
+		"regular expression and explicit tenants": {
+			ids:      []string{"set(prod)"},
+			expected: []string{"legacy", "prod-a", "prod-b"},
+		},
+		"tenant set mixed with tenants": {
+			ids:      []string{"dev-a", "prod-a", "set(prod)"},
+			expected: []string{"dev-a", "legacy", "prod-a", "prod-b"},
+		},
+		"allowed principal": {
+			ids:       []string{"set(restricted)"},
+			principal: "sre",
+			expected:  []string{"secret-a", "secret-b"},
+		},
+		"principal not allowed": {
+			ids:         []string{"set(restricted)"},
+			principal:   "dev",
+			expectedErr: ErrTenantSetNotAllowed,
+		},
+		"missing principal": {
+			ids:         []string{"set(restricted)"},
+			expectedErr: ErrTenantSetNotAllowed,
+		},
+		"unknown tenant set": {
+			ids:         []string{"set(unknown)"},
+			expectedErr: ErrUnknownTenantSet,
+		},
+		"empty tenant set": {
+			ids:         []string{"set(empty)"},
+			expectedErr: ErrEmptyTenantSet,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			actual, err := ExpandTenantSets(tc.ids, tc.principal, provider)
+			if tc.expectedErr != nil {
+				require.ErrorIs(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestTenantSet_UnmarshalYAML(t *testing.T) {
+	var sets map[string]*TenantSet
+	require.ErrorContains(t, yaml.Unmarshal([]byte(`prod: {tenants: ["a/b"]}`), &sets), "invalid tenant in tenant set")
+	require.ErrorContains(t, yaml.Unmarshal([]byte(`prod: {tenants: ["set(dev)"]}`), &sets), "can't reference another tenant set")
+	require.ErrorContains(t, yaml.Unmarshal([]byte(`prod: {match: "("}`), &sets), "invalid match regular expression")
+	require.ErrorContains(t, yaml.Unmarshal([]byte(`prod: {unknown: true}`), &sets), "field unknown not found")
+}
+
+func TestTenantSetsResolver(t *testing.T) {
+	resolver := NewTenantSetsResolver(newStaticTenantSets(t, `
+prod:
+  tenants: [prod-a, prod-b]
+  allowed_principals: [sre]
+single:
+  tenants: [prod-a]
+`))
+
+	ctx := InjectPrincipal(user.InjectOrgID(context.Background(), "dev-a|set(prod)"), "sre")
+	ids, err := resolver.TenantIDs(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"dev-a", "prod-a", "prod-b"}, ids)
+
+	_, err = resolver.TenantID(ctx)
+	require.ErrorIs(t, err, user.ErrTooManyOrgIDs)
+
+	id, err := resolver.TenantID(user.InjectOrgID(context.Background(), "set(single)"))
+	require.NoError(t, err)
+	require.Equal(t, "prod-a", id)
+
+	_, err = resolver.TenantIDs(user.InjectOrgID(context.Background(), "set(prod)"))
+	require.ErrorIs(t, err, ErrTenantSetNotAllowed)
+}
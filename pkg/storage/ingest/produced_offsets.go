@@ -0,0 +1,57 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ingest
+
+import (
+	"context"
+	"maps"
+	"sync"
+)
+
+type producedOffsetsContextKey int
+
+const producedOffsetsKey producedOffsetsContextKey = 0
+
+// ProducedOffsets tracks the offset of the last record produced to each partition while serving a write request.
+type ProducedOffsets struct {
+	mx      sync.Mutex
+	offsets map[int32]int64
+}
+
+// ContextWithProducedOffsets returns a new context tracking the offsets of the records produced by the Writer.
+// The offsets can be retrieved with ProducedOffsetsFromContext.
+func ContextWithProducedOffsets(ctx context.Context) context.Context {
+	return context.WithValue(ctx, producedOffsetsKey, &ProducedOffsets{offsets: map[int32]int64{}})
+}
+
+// ProducedOffsetsFromContext returns the ProducedOffsets set with ContextWithProducedOffsets, or nil if not set.
+func ProducedOffsetsFromContext(ctx context.Context) *ProducedOffsets {
+	offsets, _ := ctx.Value(producedOffsetsKey).(*ProducedOffsets)
+	return offsets
+}
+
+// Add tracks a record produced to the partition at the given offset. It's safe to call Add on a nil ProducedOffsets.
+func (p *ProducedOffsets) Add(partitionID int32, offset int64) {
+	if p == nil {
+		return
+	}
+
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	if prev, ok := p.offsets[partitionID]; !ok || offset > prev {
+		p.offsets[partitionID] = offset
+	}
+}
+
+// Offsets returns the offset of the last record produced to each partition.
+func (p *ProducedOffsets) Offsets() map[int32]int64 {
+	if p == nil {
+		return nil
+	}
+
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	return maps.Clone(p.offsets)
+}
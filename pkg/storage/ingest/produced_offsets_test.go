@@ -0,0 +1,41 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package ingest
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProducedOffsets(t *testing.T) {
+	t.Run("should return nil if not set in the context", func(t *testing.T) {
+		producedOffsets := ProducedOffsetsFromContext(context.Background())
+		assert.Nil(t, producedOffsets)
+
+		// Should be safe to call on nil.
+		producedOffsets.Add(1, 10)
+		assert.Nil(t, producedOffsets.Offsets())
+	})
+
+	t.Run("should keep track of the highest offset produced to each partition", func(t *testing.T) {
+		ctx := ContextWithProducedOffsets(context.Background())
+		producedOffsets := ProducedOffsetsFromContext(ctx)
+
+		wg := sync.WaitGroup{}
+		for partitionID := int32(0); partitionID < 3; partitionID++ {
+			for offset := int64(0); offset < 10; offset++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					producedOffsets.Add(partitionID, offset)
+				}()
+			}
+		}
+		wg.Wait()
+
+		assert.Equal(t, map[int32]int64{0: 9, 1: 9, 2: 9}, producedOffsets.Offsets())
+	})
+}
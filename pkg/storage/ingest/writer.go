@@ -141,7 +141,8 @@ func (w *Writer) stopping(_ error) error {
 }
 
 // WriteSync the input data to the ingest storage. The function blocks until the data has been successfully committed,
-// or an error occurred.
+// or an error occurred. If the context has been created with ContextWithProducedOffsets, the offsets of the committed
+// records are tracked in it.
 func (w *Writer) WriteSync(ctx context.Context, partitionID int32, userID string, req *mimirpb.WriteRequest) error {
 	startTime := time.Now()
 
@@ -187,6 +188,13 @@ func (w *Writer) WriteSync(ctx context.Context, partitionID int32, userID string
 		return err
 	}
 
+	// Keep track of the produced offsets, if requested by the caller.
+	if producedOffsets := ProducedOffsetsFromContext(ctx); producedOffsets != nil {
+		for _, r := range res {
+			producedOffsets.Add(partitionID, r.Record.Offset)
+		}
+	}
+
 	return nil
 }
 
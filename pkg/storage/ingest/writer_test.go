@@ -280,6 +280,23 @@ func TestWriter_WriteSync(t *testing.T) {
 		}
 	})
 
+	t.Run("should track the produced offsets if requested in the context", func(t *testing.T) {
+		t.Parallel()
+
+		_, clusterAddr := testkafka.CreateCluster(t, numPartitions, topicName)
+		writer, _ := createTestWriter(t, createTestKafkaConfig(clusterAddr, topicName))
+
+		// Write a request without tracking the offsets.
+		require.NoError(t, writer.WriteSync(ctx, 0, tenantID, &mimirpb.WriteRequest{Timeseries: series1, Metadata: nil, Source: mimirpb.API}))
+
+		// Write requests tracking the offsets.
+		trackingCtx := ContextWithProducedOffsets(ctx)
+		require.NoError(t, writer.WriteSync(trackingCtx, 0, tenantID, &mimirpb.WriteRequest{Timeseries: series2, Metadata: nil, Source: mimirpb.API}))
+		require.NoError(t, writer.WriteSync(trackingCtx, 1, tenantID, &mimirpb.WriteRequest{Timeseries: series3, Metadata: nil, Source: mimirpb.API}))
+
+		assert.Equal(t, map[int32]int64{0: 1, 1: 0}, ProducedOffsetsFromContext(trackingCtx).Offsets())
+	})
+
 	t.Run("should interrupt the WriteSync() on context cancelled but other concurrent requests should not fail", func(t *testing.T) {
 		t.Parallel()
 
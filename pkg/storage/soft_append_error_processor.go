@@ -3,6 +3,8 @@
 package storage
 
 import (
+	"fmt"
+
 	"github.com/pkg/errors"
 	"github.com/prometheus/prometheus/model/histogram"
 	"github.com/prometheus/prometheus/storage"
@@ -11,6 +13,19 @@ import (
 	"github.com/grafana/mimir/pkg/util/globalerror"
 )
 
+// MetricLimitSeriesLimitError is returned when a series can't be created because the series limit of the
+// per-tenant metric limit applied to it has been reached.
+type MetricLimitSeriesLimitError struct {
+	// Match is the selector of the metric limit.
+	Match string
+	// Limit is the global series limit of the metric limit.
+	Limit int
+}
+
+func (e MetricLimitSeriesLimitError) Error() string {
+	return fmt.Sprintf("series limit of %d reached for the series matching %s", e.Limit, e.Match)
+}
+
 // SoftAppendErrorProcessor helps identify soft errors and run appropriate callbacks.
 // This also helps keep the soft error checks consistent between ingesters and block builders
 // by keeping it all in a single place.
@@ -24,6 +39,7 @@ type SoftAppendErrorProcessor struct {
 	errDuplicateSampleForTimestamp func(string, int64, []mimirpb.LabelAdapter)
 	maxSeriesPerUser               func(labels []mimirpb.LabelAdapter)
 	maxSeriesPerMetric             func(labels []mimirpb.LabelAdapter)
+	metricLimitSeriesLimit         func(match string, limit int, labels []mimirpb.LabelAdapter)
 	// Native histogram errors.
 	errHistogramCountMismatch        func(error, int64, []mimirpb.LabelAdapter)
 	errHistogramCountNotBigEnough    func(error, int64, []mimirpb.LabelAdapter)
@@ -45,6 +61,7 @@ func NewSoftAppendErrorProcessor(
 	errDuplicateSampleForTimestamp func(string, int64, []mimirpb.LabelAdapter),
 	maxSeriesPerUser func([]mimirpb.LabelAdapter),
 	maxSeriesPerMetric func(labels []mimirpb.LabelAdapter),
+	metricLimitSeriesLimit func(match string, limit int, labels []mimirpb.LabelAdapter),
 	errHistogramCountMismatch func(error, int64, []mimirpb.LabelAdapter),
 	errHistogramCountNotBigEnough func(error, int64, []mimirpb.LabelAdapter),
 	errHistogramNegativeBucketCount func(error, int64, []mimirpb.LabelAdapter),
@@ -63,6 +80,7 @@ func NewSoftAppendErrorProcessor(
 		errDuplicateSampleForTimestamp:    errDuplicateSampleForTimestamp,
 		maxSeriesPerUser:                  maxSeriesPerUser,
 		maxSeriesPerMetric:                maxSeriesPerMetric,
+		metricLimitSeriesLimit:            metricLimitSeriesLimit,
 		errHistogramCountMismatch:         errHistogramCountMismatch,
 		errHistogramCountNotBigEnough:     errHistogramCountNotBigEnough,
 		errHistogramNegativeBucketCount:   errHistogramNegativeBucketCount,
@@ -80,6 +98,7 @@ func NewSoftAppendErrorProcessor(
 // err must be non-nil.
 func (e *SoftAppendErrorProcessor) ProcessErr(err error, ts int64, labels []mimirpb.LabelAdapter) bool {
 	e.commonCallback()
+	var metricLimitErr MetricLimitSeriesLimitError
 	switch {
 	case errors.Is(err, storage.ErrOutOfBounds):
 		e.errOutOfBounds(ts, labels)
@@ -102,6 +121,9 @@ func (e *SoftAppendErrorProcessor) ProcessErr(err error, ts int64, labels []mimi
 	case errors.Is(err, globalerror.MaxSeriesPerMetric):
 		e.maxSeriesPerMetric(labels)
 		return true
+	case errors.As(err, &metricLimitErr):
+		e.metricLimitSeriesLimit(metricLimitErr.Match, metricLimitErr.Limit, labels)
+		return true
 
 	// Map TSDB native histogram validation errors to soft errors.
 	case errors.Is(err, histogram.ErrHistogramCountMismatch):
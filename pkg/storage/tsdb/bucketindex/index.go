@@ -101,6 +101,10 @@ type Block struct {
 
 	// Labels contains the external labels from the block's metadata.
 	Labels map[string]string `json:"labels,omitempty"`
+
+	// SizeBytes is the total size of the block files, as listed in the block's metadata.
+	// It's zero if the metadata doesn't list the files.
+	SizeBytes int64 `json:"size_bytes,omitempty"`
 }
 
 // Within returns whether the block contains samples within the provided range.
@@ -187,7 +191,16 @@ func BlockFromThanosMeta(meta block.Meta) *Block {
 		CompactionLevel:  meta.Compaction.Level,
 		OutOfOrder:       meta.Compaction.FromOutOfOrder(),
 		Labels:           maps.Clone(meta.Thanos.Labels),
+		SizeBytes:        blockSizeBytes(meta),
+	}
+}
+
+func blockSizeBytes(meta block.Meta) int64 {
+	size := int64(0)
+	for _, f := range meta.Thanos.Files {
+		size += f.SizeBytes
 	}
+	return size
 }
 
 func detectBlockSegmentsFormat(meta block.Meta) (string, int) {
@@ -290,6 +303,15 @@ func (s Blocks) GetULIDs() []ulid.ULID {
 	return ids
 }
 
+// SizeBytes returns the total size of the blocks.
+func (s Blocks) SizeBytes() int64 {
+	size := int64(0)
+	for _, m := range s {
+		size += m.SizeBytes
+	}
+	return size
+}
+
 func (s Blocks) String() string {
 	b := strings.Builder{}
 
@@ -207,10 +207,10 @@ func TestBlockFromThanosMeta(t *testing.T) {
 				},
 				Thanos: block.ThanosMeta{
 					Files: []block.File{
-						{RelPath: "index"},
-						{RelPath: "chunks/000001"},
-						{RelPath: "chunks/000002"},
-						{RelPath: "chunks/000003"},
+						{RelPath: "index", SizeBytes: 100},
+						{RelPath: "chunks/000001", SizeBytes: 1000},
+						{RelPath: "chunks/000002", SizeBytes: 1000},
+						{RelPath: "chunks/000003", SizeBytes: 500},
 						{RelPath: "tombstone"},
 					},
 				},
@@ -221,6 +221,7 @@ func TestBlockFromThanosMeta(t *testing.T) {
 				MaxTime:        20,
 				SegmentsFormat: SegmentsFormat1Based6Digits,
 				SegmentsNum:    3,
+				SizeBytes:      2600,
 			},
 		},
 		"meta.json with external labels, no compactor shard ID": {
@@ -0,0 +1,175 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package tenantlimits
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+)
+
+const (
+	// limitsPrefix is the prefix of the tenant limits objects in the bucket, under bucket.MimirInternalsPrefix.
+	limitsPrefix = "tenant-limits"
+
+	// overridesFile holds the current version of the overrides of a tenant, in <tenant>/overrides.json.
+	overridesFile = "overrides.json"
+
+	// versionsDir holds all the versions of the overrides of a tenant, in <tenant>/versions/<version>.json.
+	versionsDir = "versions"
+)
+
+// Overrides is a version of the limits overrides of a tenant.
+type Overrides struct {
+	Version   int       `json:"version"`
+	Author    string    `json:"author"`
+	Timestamp time.Time `json:"timestamp"`
+	// Limits holds the overridden limits, keyed by their YAML name.
+	Limits map[string]any `json:"limits"`
+}
+
+// overridesBucket reads and writes the tenant limits overrides in the bucket.
+type overridesBucket struct {
+	bkt objstore.Bucket
+}
+
+func newOverridesBucket(bkt objstore.Bucket) *overridesBucket {
+	return &overridesBucket{bkt: bucket.NewPrefixedBucketClient(bkt, path.Join(bucket.MimirInternalsPrefix, limitsPrefix))}
+}
+
+func overridesPath(userID string) string {
+	return path.Join(userID, overridesFile)
+}
+
+func versionPath(userID string, version int) string {
+	// The versions are zero-padded, to be listed in order.
+	return path.Join(userID, versionsDir, fmt.Sprintf("%010d.json", version))
+}
+
+// list returns the tenants having overrides, with the time their overrides have been last updated, if available.
+func (b *overridesBucket) list(ctx context.Context) (map[string]time.Time, error) {
+	updates := map[string]time.Time{}
+
+	if slices.Contains(b.bkt.SupportedIterOptions(), objstore.UpdatedAt) {
+		err := b.bkt.IterWithAttributes(ctx, "", func(attrs objstore.IterObjectAttributes) error {
+			// Only the current overrides of the tenants are tracked, not their versions.
+			if path.Base(attrs.Name) == overridesFile && path.Dir(path.Dir(attrs.Name)) == "." {
+				updates[path.Dir(attrs.Name)], _ = attrs.LastModified()
+			}
+			return nil
+		}, objstore.WithRecursiveIter(), objstore.WithUpdatedAt())
+		return updates, errors.Wrap(err, "list tenant limits overrides")
+	}
+
+	err := b.bkt.Iter(ctx, "", func(name string) error {
+		if strings.HasSuffix(name, objstore.DirDelim) {
+			updates[strings.TrimSuffix(name, objstore.DirDelim)] = time.Time{}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "list tenant limits overrides")
+	}
+	for userID := range updates {
+		attrs, err := b.bkt.Attributes(ctx, overridesPath(userID))
+		if err != nil {
+			if b.bkt.IsObjNotFoundErr(err) {
+				delete(updates, userID)
+				continue
+			}
+			return nil, errors.Wrapf(err, "read the attributes of the limits overrides of tenant %s", userID)
+		}
+		updates[userID] = attrs.LastModified
+	}
+	return updates, nil
+}
+
+// readOverrides returns the current overrides of the tenant, or nil if there are none.
+func (b *overridesBucket) readOverrides(ctx context.Context, userID string) (*Overrides, error) {
+	overrides := &Overrides{}
+	if err := b.read(ctx, overridesPath(userID), overrides); err != nil {
+		if b.bkt.IsObjNotFoundErr(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return overrides, nil
+}
+
+// writeOverrides writes a new version of the overrides of the tenant, and makes it the current one. It fails with
+// errVersionConflict if the version already exists, because it has been written by another instance in the meantime.
+func (b *overridesBucket) writeOverrides(ctx context.Context, userID string, overrides *Overrides) error {
+	// The objstore clients don't support conditional uploads, so the version is only created if it doesn't exist yet.
+	name := versionPath(userID, overrides.Version)
+	exists, err := b.bkt.Exists(ctx, name)
+	if err != nil {
+		return errors.Wrapf(err, "check %s", name)
+	}
+	if exists {
+		return fmt.Errorf("%w: the version %d already exists", errVersionConflict, overrides.Version)
+	}
+
+	// The version is written first, so that the current overrides are always part of the history.
+	if err := b.write(ctx, name, overrides); err != nil {
+		return err
+	}
+	return b.write(ctx, overridesPath(userID), overrides)
+}
+
+// history returns all the versions of the overrides of the tenant, from the newest to the oldest.
+func (b *overridesBucket) history(ctx context.Context, userID string) ([]*Overrides, error) {
+	var names []string
+	err := b.bkt.Iter(ctx, path.Join(userID, versionsDir)+objstore.DirDelim, func(name string) error {
+		if strings.HasSuffix(name, ".json") {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "list tenant limits overrides versions")
+	}
+	slices.Sort(names)
+
+	history := make([]*Overrides, 0, len(names))
+	for i := len(names) - 1; i >= 0; i-- {
+		overrides := &Overrides{}
+		if err := b.read(ctx, names[i], overrides); err != nil {
+			return nil, err
+		}
+		history = append(history, overrides)
+	}
+	return history, nil
+}
+
+func (b *overridesBucket) write(ctx context.Context, name string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrapf(err, "marshal %s", name)
+	}
+	return errors.Wrapf(b.bkt.Upload(ctx, name, bytes.NewReader(data)), "upload %s", name)
+}
+
+func (b *overridesBucket) read(ctx context.Context, name string, v any) error {
+	r, err := b.bkt.Get(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = r.Close() }()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return errors.Wrapf(err, "read %s", name)
+	}
+	return errors.Wrapf(json.Unmarshal(data, v), "unmarshal %s", name)
+}
@@ -0,0 +1,52 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package tenantlimits
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// PrecedenceFile makes the limits set in the runtime configuration file take precedence over the stored overrides.
+	PrecedenceFile = "file"
+	// PrecedenceStore makes the stored overrides take precedence over the limits set in the runtime configuration file.
+	PrecedenceStore = "store"
+)
+
+var (
+	supportedPrecedences = []string{PrecedenceFile, PrecedenceStore}
+
+	errInvalidPollInterval = errors.New("the tenant limits store poll interval must be greater than 0")
+	errInvalidPrecedence   = fmt.Errorf("unsupported tenant limits store precedence, supported values are: %s", strings.Join(supportedPrecedences, ", "))
+)
+
+type Config struct {
+	Enabled      bool          `yaml:"enabled" category:"experimental"`
+	PollInterval time.Duration `yaml:"poll_interval" category:"experimental"`
+	Precedence   string        `yaml:"precedence" category:"experimental"`
+}
+
+// RegisterFlags adds the flags required to config this to the given FlagSet.
+func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
+	f.BoolVar(&cfg.Enabled, "tenant-limits-store.enabled", false, "Enable the per-tenant limits overrides stored in the blocks storage bucket, which are merged with the overrides of the runtime configuration file and can be changed with the tenant limits API.")
+	f.DurationVar(&cfg.PollInterval, "tenant-limits-store.poll-interval", time.Minute, "How frequently the stored per-tenant limits overrides are reloaded from the bucket.")
+	f.StringVar(&cfg.Precedence, "tenant-limits-store.precedence", PrecedenceFile, fmt.Sprintf("Which overrides take precedence when a limit of a tenant is set both in the runtime configuration file and in the store. Supported values are: %s.", strings.Join(supportedPrecedences, ", ")))
+}
+
+func (cfg *Config) Validate() error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.PollInterval <= 0 {
+		return errInvalidPollInterval
+	}
+	if !slices.Contains(supportedPrecedences, cfg.Precedence) {
+		return errInvalidPrecedence
+	}
+	return nil
+}
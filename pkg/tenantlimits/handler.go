@@ -0,0 +1,143 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package tenantlimits
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/go-kit/log/level"
+	"github.com/gorilla/mux"
+	"github.com/grafana/dskit/tenant"
+	"gopkg.in/yaml.v3"
+
+	"github.com/grafana/mimir/pkg/util"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+// maxOverridesSize is the maximum size of the body of a request changing the overrides of a tenant.
+const maxOverridesSize = 1 << 20
+
+type limitsResponse struct {
+	// Overrides holds the current overrides of the tenant, or nil if there are none.
+	Overrides *Overrides `json:"overrides"`
+	// Limits holds the limits applied to the tenant.
+	Limits *validation.Limits `json:"limits"`
+}
+
+type historyResponse struct {
+	Versions []*Overrides `json:"versions"`
+}
+
+// LimitsHandler serves the current overrides of the tenant and the limits applied to the tenant (GET), replaces
+// the overrides of the tenant (PUT), or merges the given overrides with the current ones (PATCH), in which case a
+// null value removes an override. The overrides are given as a YAML or JSON object of the limits keyed by their
+// YAML name. The changes require the author parameter, and are only applied if the current version is the one
+// given by the optional version parameter.
+func (s *Store) LimitsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["tenant"]
+	if err := tenant.ValidTenantID(userID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		s.update(w, r, userID, func(_, patch map[string]any) map[string]any {
+			return mergePatch(nil, patch)
+		})
+		return
+	case http.MethodPatch:
+		s.update(w, r, userID, mergePatch)
+		return
+	}
+
+	limits := s.ByUserID(userID)
+	if limits == nil {
+		limits = &s.defaults
+	}
+	util.WriteJSONResponse(w, limitsResponse{Overrides: s.Overrides(userID), Limits: limits})
+}
+
+func (s *Store) update(w http.ResponseWriter, r *http.Request, userID string, apply func(current, patch map[string]any) map[string]any) {
+	query := r.URL.Query()
+	author := query.Get("author")
+	if author == "" {
+		http.Error(w, "the author parameter is required", http.StatusBadRequest)
+		return
+	}
+	expectedVersion := -1
+	if v := query.Get("version"); v != "" {
+		var err error
+		if expectedVersion, err = strconv.Atoi(v); err != nil || expectedVersion < 0 {
+			http.Error(w, fmt.Sprintf("invalid version %q", v), http.StatusBadRequest)
+			return
+		}
+	}
+
+	patch, err := readOverrides(http.MaxBytesReader(w, r.Body, maxOverridesSize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s: %s", errInvalidOverrides, err), http.StatusBadRequest)
+		return
+	}
+
+	overrides, err := s.Update(r.Context(), userID, author, expectedVersion, func(current map[string]any) map[string]any {
+		return apply(current, patch)
+	})
+	switch {
+	case errors.Is(err, errInvalidOverrides):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, errVersionConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		level.Error(s.logger).Log("msg", "failed to update tenant limits overrides", "user", userID, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	util.WriteJSONResponse(w, overrides)
+}
+
+// readOverrides reads a YAML or JSON object of limits overrides, normalized to the types of the stored overrides.
+func readOverrides(r io.Reader) (map[string]any, error) {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var overrides map[string]any
+	if err := yaml.Unmarshal(body, &overrides); err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(overrides)
+	if err != nil {
+		return nil, err
+	}
+	normalized := map[string]any{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
+
+// HistoryHandler serves all the versions of the overrides of the tenant, from the newest to the oldest.
+func (s *Store) HistoryHandler(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["tenant"]
+	if err := tenant.ValidTenantID(userID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	versions, err := s.History(r.Context(), userID)
+	if err != nil {
+		level.Error(s.logger).Log("msg", "failed to read tenant limits overrides history", "user", userID, "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	util.WriteJSONResponse(w, historyResponse{Versions: versions})
+}
@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package tenantlimits
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+)
+
+func TestStore_Handlers(t *testing.T) {
+	s := newStoreForTest(t, objstore.NewInMemBucket(), PrecedenceFile, nil)
+
+	router := mux.NewRouter()
+	router.Path("/tenant_limits/{tenant}").Methods(http.MethodGet, http.MethodPut, http.MethodPatch).HandlerFunc(s.LimitsHandler)
+	router.Path("/tenant_limits/{tenant}/history").Methods(http.MethodGet).HandlerFunc(s.HistoryHandler)
+
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, httptest.NewRequest(method, url, strings.NewReader(body)))
+		return resp
+	}
+
+	// The default limits are served for the tenants without overrides.
+	resp := do(http.MethodGet, "/tenant_limits/user-1", "")
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.JSONEq(t, `null`, jsonField(t, resp.Body.Bytes(), "overrides"))
+	assert.Equal(t, float64(s.defaults.IngestionRate), limitValue(t, resp.Body.Bytes(), "ingestion_rate"))
+
+	// The overrides can be given as YAML.
+	resp = do(http.MethodPut, "/tenant_limits/user-1?author=alice", "ingestion_rate: 200\ningestion_burst_size: 500\n")
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	assert.JSONEq(t, `{"ingestion_rate": 200, "ingestion_burst_size": 500}`, jsonField(t, resp.Body.Bytes(), "limits"))
+
+	// Or as JSON.
+	resp = do(http.MethodPatch, "/tenant_limits/user-1?author=bob&version=1", `{"ingestion_rate": null, "max_global_series_per_user": 1000}`)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	assert.JSONEq(t, `2`, jsonField(t, resp.Body.Bytes(), "version"))
+	assert.JSONEq(t, `{"ingestion_burst_size": 500, "max_global_series_per_user": 1000}`, jsonField(t, resp.Body.Bytes(), "limits"))
+
+	resp = do(http.MethodGet, "/tenant_limits/user-1", "")
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, float64(1000), limitValue(t, resp.Body.Bytes(), "max_global_series_per_user"))
+	assert.Equal(t, float64(s.defaults.IngestionRate), limitValue(t, resp.Body.Bytes(), "ingestion_rate"))
+
+	resp = do(http.MethodGet, "/tenant_limits/user-1/history", "")
+	require.Equal(t, http.StatusOK, resp.Code)
+	var history historyResponse
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &history))
+	require.Len(t, history.Versions, 2)
+	assert.Equal(t, "bob", history.Versions[0].Author)
+	assert.Equal(t, "alice", history.Versions[1].Author)
+
+	for name, tc := range map[string]struct {
+		method, url, body string
+		expectedStatus    int
+	}{
+		"missing author":   {http.MethodPut, "/tenant_limits/user-1", "{}", http.StatusBadRequest},
+		"invalid version":  {http.MethodPut, "/tenant_limits/user-1?author=alice&version=x", "{}", http.StatusBadRequest},
+		"version conflict": {http.MethodPut, "/tenant_limits/user-1?author=alice&version=1", "{}", http.StatusConflict},
+		"invalid body":     {http.MethodPut, "/tenant_limits/user-1?author=alice", "[1, 2]", http.StatusBadRequest},
+		"unknown limit":    {http.MethodPatch, "/tenant_limits/user-1?author=alice", "unknown_limit: 1", http.StatusBadRequest},
+		"invalid tenant":   {http.MethodGet, "/tenant_limits/user$1", "", http.StatusBadRequest},
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp := do(tc.method, tc.url, tc.body)
+			assert.Equal(t, tc.expectedStatus, resp.Code, resp.Body.String())
+		})
+	}
+}
+
+func jsonField(t *testing.T, body []byte, field string) string {
+	fields := map[string]json.RawMessage{}
+	require.NoError(t, json.Unmarshal(body, &fields))
+	return string(fields[field])
+}
+
+func limitValue(t *testing.T, body []byte, limit string) any {
+	limits := map[string]any{}
+	require.NoError(t, json.Unmarshal([]byte(jsonField(t, body, "limits")), &limits))
+	return limits[limit]
+}
@@ -0,0 +1,391 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package tenantlimits
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/services"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/mimir/pkg/util"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+var (
+	errInvalidOverrides = errors.New("invalid limits overrides")
+	errVersionConflict  = errors.New("the limits overrides have been changed in the meantime")
+)
+
+// Store holds the per-tenant limits overrides stored in the bucket, which are periodically reloaded, and merges
+// them with the per-tenant limits of the runtime configuration file.
+type Store struct {
+	services.Service
+
+	cfg      Config
+	defaults validation.Limits
+	validate func(validation.Limits) error
+	bucket   *overridesBucket
+	logger   log.Logger
+
+	// fileLimits holds the per-tenant limits of the runtime configuration file, if any.
+	fileLimits validation.TenantLimits
+
+	mtx sync.RWMutex
+	// overrides holds the current overrides, keyed by tenant.
+	overrides map[string]*Overrides
+	// merged caches the limits merged from the current overrides and the limits of the runtime configuration file.
+	merged map[string]mergedLimits
+
+	// updatedAt holds the time the loaded overrides of each tenant have been last updated in the bucket, if
+	// available. It's only accessed by poll.
+	updatedAt map[string]time.Time
+
+	// writeMtx serializes the changes of the overrides done by this instance.
+	writeMtx sync.Mutex
+
+	pollFailures prometheus.Counter
+	readFailures prometheus.Counter
+	lastPollTs   prometheus.Gauge
+	tenants      prometheus.Gauge
+}
+
+type mergedLimits struct {
+	version int
+	file    *validation.Limits
+	limits  *validation.Limits
+}
+
+// NewStore creates a Store reading the overrides from the given blocks storage bucket. The stored overrides
+// are applied on top of the default limits and merged with fileLimits, which may be nil, according to the
+// configured precedence. validate is called on the merged limits, in addition to the limits validation.
+func NewStore(cfg Config, defaults validation.Limits, validate func(validation.Limits) error, fileLimits validation.TenantLimits, bkt objstore.Bucket, logger log.Logger, reg prometheus.Registerer) *Store {
+	s := &Store{
+		cfg:        cfg,
+		defaults:   defaults,
+		validate:   validate,
+		bucket:     newOverridesBucket(bkt),
+		logger:     log.With(logger, "component", "tenant-limits-store"),
+		fileLimits: fileLimits,
+		overrides:  map[string]*Overrides{},
+		merged:     map[string]mergedLimits{},
+		updatedAt:  map[string]time.Time{},
+
+		pollFailures: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_tenant_limits_store_poll_failures_total",
+			Help: "Total number of failures reloading the tenant limits overrides from the bucket.",
+		}),
+		readFailures: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_tenant_limits_store_tenant_read_failures_total",
+			Help: "Total number of failures reading the limits overrides of a tenant from the bucket, in which case the last loaded overrides of the tenant are kept.",
+		}),
+		lastPollTs: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "cortex_tenant_limits_store_last_successful_poll_timestamp_seconds",
+			Help: "Unix timestamp of the last successful reload of the tenant limits overrides from the bucket.",
+		}),
+		tenants: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "cortex_tenant_limits_store_tenants",
+			Help: "Number of tenants having limits overrides in the bucket.",
+		}),
+	}
+
+	s.Service = services.NewTimerService(cfg.PollInterval, s.starting, s.iteration, nil)
+	return s
+}
+
+func (s *Store) starting(ctx context.Context) error {
+	// The overrides must be loaded before the limits are used.
+	return errors.Wrap(s.poll(ctx), "load tenant limits overrides")
+}
+
+func (s *Store) iteration(ctx context.Context) error {
+	if err := s.poll(ctx); err != nil {
+		s.pollFailures.Inc()
+		level.Warn(s.logger).Log("msg", "failed to reload tenant limits overrides", "err", err)
+	}
+	return nil
+}
+
+// poll reloads the overrides which have been added or changed in the bucket since the last reload, and forgets
+// the overrides which have been removed. The tenants whose overrides can't be read keep their last loaded overrides.
+func (s *Store) poll(ctx context.Context) error {
+	updates, err := s.bucket.list(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.mtx.RLock()
+	previous := maps.Clone(s.overrides)
+	s.mtx.RUnlock()
+
+	overrides := make(map[string]*Overrides, len(updates))
+	updatedAt := make(map[string]time.Time, len(updates))
+	for userID, t := range updates {
+		if o, ok := previous[userID]; ok && !t.IsZero() && t.Equal(s.updatedAt[userID]) {
+			overrides[userID] = o
+			updatedAt[userID] = t
+			continue
+		}
+
+		o, err := s.bucket.readOverrides(ctx, userID)
+		if err != nil {
+			s.readFailures.Inc()
+			level.Warn(s.logger).Log("msg", "failed to read the limits overrides of the tenant, keeping the last loaded ones", "user", userID, "err", err)
+			// The update time of the last loaded overrides is kept, so that the changed overrides are read again at the next reload.
+			if o, ok := previous[userID]; ok {
+				overrides[userID] = o
+				updatedAt[userID] = s.updatedAt[userID]
+			}
+			continue
+		}
+		if o != nil {
+			overrides[userID] = o
+			updatedAt[userID] = t
+		}
+	}
+	s.updatedAt = updatedAt
+
+	s.mtx.Lock()
+	for userID := range s.merged {
+		if _, ok := overrides[userID]; !ok {
+			delete(s.merged, userID)
+		}
+	}
+	s.overrides = overrides
+	s.mtx.Unlock()
+
+	s.tenants.Set(float64(len(overrides)))
+	s.lastPollTs.SetToCurrentTime()
+	return nil
+}
+
+// ByUserID implements validation.TenantLimits.
+func (s *Store) ByUserID(userID string) *validation.Limits {
+	var file *validation.Limits
+	if s.fileLimits != nil {
+		file = s.fileLimits.ByUserID(userID)
+	}
+	return s.limits(userID, file)
+}
+
+// AllByUserID implements validation.TenantLimits.
+func (s *Store) AllByUserID() map[string]*validation.Limits {
+	all := map[string]*validation.Limits{}
+	if s.fileLimits != nil {
+		for userID, limits := range s.fileLimits.AllByUserID() {
+			all[userID] = limits
+		}
+	}
+
+	s.mtx.RLock()
+	tenants := make([]string, 0, len(s.overrides))
+	for userID := range s.overrides {
+		tenants = append(tenants, userID)
+	}
+	s.mtx.RUnlock()
+
+	for _, userID := range tenants {
+		all[userID] = s.limits(userID, all[userID])
+	}
+	if len(all) == 0 {
+		return nil
+	}
+	return all
+}
+
+// limits returns the limits of the tenant, merging its overrides with the given limits of the runtime
+// configuration file. The merged limits are cached until either of them changes.
+func (s *Store) limits(userID string, file *validation.Limits) *validation.Limits {
+	s.mtx.RLock()
+	overrides := s.overrides[userID]
+	cached, ok := s.merged[userID]
+	s.mtx.RUnlock()
+
+	if overrides == nil {
+		return file
+	}
+	if ok && cached.version == overrides.Version && cached.file == file {
+		return cached.limits
+	}
+
+	limits, err := s.merge(overrides.Limits, file)
+	if err != nil {
+		// The limits of the runtime configuration file may have changed since the overrides have been validated.
+		level.Warn(s.logger).Log("msg", "failed to merge the tenant limits overrides, ignoring them", "user", userID, "version", overrides.Version, "err", err)
+		limits = file
+	}
+
+	s.mtx.Lock()
+	// Don't cache the limits if the overrides have been reloaded in the meantime.
+	if s.overrides[userID] == overrides {
+		s.merged[userID] = mergedLimits{version: overrides.Version, file: file, limits: limits}
+	}
+	s.mtx.Unlock()
+	return limits
+}
+
+// merge applies the overrides on top of the default limits, or of the given limits of the runtime configuration
+// file if the store takes precedence. If the file takes precedence, the limits of the file which differ from the
+// defaults are kept, and the overrides are only applied to the other limits. The overrides are decoded on top of
+// the limits, rather than merged as JSON, so that the limits which can't be marshalled to JSON as is, such as
+// the secrets, are kept.
+func (s *Store) merge(overrides map[string]any, file *validation.Limits) (*validation.Limits, error) {
+	base := &s.defaults
+	if file != nil {
+		base = file
+	}
+
+	if file != nil && s.cfg.Precedence == PrecedenceFile {
+		defaults, err := limitsToMap(&s.defaults)
+		if err != nil {
+			return nil, err
+		}
+		fileMap, err := limitsToMap(file)
+		if err != nil {
+			return nil, err
+		}
+		diff, err := util.DiffConfig(defaults, fileMap)
+		if err != nil {
+			return nil, err
+		}
+		overrides = removeKeys(overrides, diff)
+	}
+
+	data, err := json.Marshal(overrides)
+	if err != nil {
+		return nil, err
+	}
+	limits, err := base.ApplyJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	if s.validate != nil {
+		if err := s.validate(*limits); err != nil {
+			return nil, err
+		}
+	}
+	return limits, nil
+}
+
+// Overrides returns the current overrides of the tenant, or nil if there are none.
+func (s *Store) Overrides(userID string) *Overrides {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	return s.overrides[userID]
+}
+
+// History returns all the versions of the overrides of the tenant, from the newest to the oldest.
+func (s *Store) History(ctx context.Context, userID string) ([]*Overrides, error) {
+	return s.bucket.history(ctx, userID)
+}
+
+// Update changes the overrides of the tenant with the update function, which is given the current overrides and
+// returns the new ones, and stores them as a new version authored by author. If expectedVersion isn't negative,
+// the overrides are only changed if their current version is expectedVersion. It fails with errVersionConflict
+// if the overrides have been changed by another instance in the meantime.
+func (s *Store) Update(ctx context.Context, userID, author string, expectedVersion int, update func(current map[string]any) map[string]any) (*Overrides, error) {
+	s.writeMtx.Lock()
+	defer s.writeMtx.Unlock()
+
+	// The current overrides are read from the bucket, because they may have been changed by another instance
+	// since the last reload.
+	current, err := s.bucket.readOverrides(ctx, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "read the current limits overrides")
+	}
+	if current == nil {
+		current = &Overrides{}
+	}
+	if expectedVersion >= 0 && current.Version != expectedVersion {
+		return nil, fmt.Errorf("%w: the current version is %d", errVersionConflict, current.Version)
+	}
+
+	limits := update(current.Limits)
+	var file *validation.Limits
+	if s.fileLimits != nil {
+		file = s.fileLimits.ByUserID(userID)
+	}
+	if _, err := s.merge(limits, file); err != nil {
+		return nil, fmt.Errorf("%w: %s", errInvalidOverrides, err)
+	}
+
+	next := &Overrides{
+		Version:   current.Version + 1,
+		Author:    author,
+		Timestamp: time.Now().UTC(),
+		Limits:    limits,
+	}
+	if err := s.bucket.writeOverrides(ctx, userID, next); err != nil {
+		return nil, err
+	}
+
+	s.mtx.Lock()
+	s.overrides[userID] = next
+	s.mtx.Unlock()
+
+	level.Info(s.logger).Log("msg", "updated tenant limits overrides", "user", userID, "version", next.Version, "author", author)
+	return next, nil
+}
+
+// limitsToMap returns the limits keyed by their YAML name.
+func limitsToMap(limits *validation.Limits) (map[string]any, error) {
+	data, err := json.Marshal(limits)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]any{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// removeKeys returns the target without the keys of the given map, recursively for the objects. The target
+// isn't modified.
+func removeKeys(target, keys map[string]any) map[string]any {
+	out := make(map[string]any, len(target))
+	for k, v := range target {
+		nestedTarget, targetIsObject := v.(map[string]any)
+		nestedKeys, keysIsObject := keys[k].(map[string]any)
+		switch _, ok := keys[k]; {
+		case targetIsObject && keysIsObject:
+			out[k] = removeKeys(nestedTarget, nestedKeys)
+		case !ok:
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// mergePatch applies the patch to the target, as a JSON merge patch (RFC 7386): the null values of the patch
+// remove the keys from the target, the objects are merged recursively, and the other values are replaced.
+// The target isn't modified.
+func mergePatch(target, patch map[string]any) map[string]any {
+	out := make(map[string]any, len(target)+len(patch))
+	for k, v := range target {
+		out[k] = v
+	}
+	for k, v := range patch {
+		if v == nil {
+			delete(out, k)
+			continue
+		}
+		if p, ok := v.(map[string]any); ok {
+			t, _ := out[k].(map[string]any)
+			out[k] = mergePatch(t, p)
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,347 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package tenantlimits
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/flagext"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/objstore/providers/filesystem"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+const maxIngestionRate = 100000
+
+func newStoreForTest(t *testing.T, bkt objstore.Bucket, precedence string, fileLimits map[string]*validation.Limits) *Store {
+	defaults := validation.MockDefaultLimits()
+	validation.SetDefaultLimitsForYAMLUnmarshalling(*defaults)
+
+	validate := func(limits validation.Limits) error {
+		if limits.IngestionRate > maxIngestionRate {
+			return errors.New("ingestion rate is too high")
+		}
+		return nil
+	}
+	cfg := Config{Enabled: true, PollInterval: time.Minute, Precedence: precedence}
+	s := NewStore(cfg, *defaults, validate, validation.NewMockTenantLimits(fileLimits), bkt, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+	require.NoError(t, s.poll(context.Background()))
+	return s
+}
+
+func setOverrides(limits map[string]any) func(map[string]any) map[string]any {
+	return func(map[string]any) map[string]any {
+		return limits
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := map[string]struct {
+		setup    func(cfg *Config)
+		expected error
+	}{
+		"default config": {
+			setup: func(*Config) {},
+		},
+		"disabled config isn't validated": {
+			setup: func(cfg *Config) {
+				cfg.Precedence = "unknown"
+			},
+		},
+		"invalid poll interval": {
+			setup: func(cfg *Config) {
+				cfg.Enabled = true
+				cfg.PollInterval = 0
+			},
+			expected: errInvalidPollInterval,
+		},
+		"unsupported precedence": {
+			setup: func(cfg *Config) {
+				cfg.Enabled = true
+				cfg.Precedence = "unknown"
+			},
+			expected: errInvalidPrecedence,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := Config{}
+			flagext.DefaultValues(&cfg)
+			tc.setup(&cfg)
+			assert.Equal(t, tc.expected, cfg.Validate())
+		})
+	}
+}
+
+func TestStore_Merge(t *testing.T) {
+	ctx := context.Background()
+	defaults := validation.MockDefaultLimits()
+
+	fileLimits := *defaults
+	fileLimits.IngestionRate = 100
+	fileLimits.MaxGlobalSeriesPerUser = 1000
+
+	for _, precedence := range []string{PrecedenceFile, PrecedenceStore} {
+		t.Run(precedence, func(t *testing.T) {
+			s := newStoreForTest(t, objstore.NewInMemBucket(), precedence, map[string]*validation.Limits{"user-1": &fileLimits})
+
+			// The tenants without overrides get the limits of the file.
+			assert.Same(t, &fileLimits, s.ByUserID("user-1"))
+			assert.Nil(t, s.ByUserID("user-2"))
+
+			for _, userID := range []string{"user-1", "user-2"} {
+				_, err := s.Update(ctx, userID, "admin", -1, setOverrides(map[string]any{
+					"ingestion_rate":                    float64(200),
+					"max_global_series_per_user":        float64(5000),
+					"compactor_blocks_retention_period": "30d",
+				}))
+				require.NoError(t, err)
+			}
+
+			user1 := s.ByUserID("user-1")
+			if precedence == PrecedenceFile {
+				assert.Equal(t, float64(100), user1.IngestionRate)
+				assert.Equal(t, 1000, user1.MaxGlobalSeriesPerUser)
+			} else {
+				assert.Equal(t, float64(200), user1.IngestionRate)
+				assert.Equal(t, 5000, user1.MaxGlobalSeriesPerUser)
+			}
+			assert.Equal(t, "720h0m0s", time.Duration(user1.CompactorBlocksRetentionPeriod).String())
+			// The merged limits are cached.
+			assert.Same(t, user1, s.ByUserID("user-1"))
+
+			// The tenants only in the store get the overrides applied on top of the defaults.
+			user2 := s.ByUserID("user-2")
+			assert.Equal(t, float64(200), user2.IngestionRate)
+			assert.Equal(t, 5000, user2.MaxGlobalSeriesPerUser)
+			assert.Equal(t, defaults.MaxGlobalSeriesPerMetric, user2.MaxGlobalSeriesPerMetric)
+
+			all := s.AllByUserID()
+			assert.Len(t, all, 2)
+			assert.Same(t, user1, all["user-1"])
+			assert.Same(t, user2, all["user-2"])
+		})
+	}
+}
+
+func TestStore_MergeRemoteWriteForwardingRulesCredentials(t *testing.T) {
+	ctx := context.Background()
+	defaults := validation.MockDefaultLimits()
+
+	fileLimits := *defaults
+	fileLimits.RemoteWriteForwardingRules = validation.RemoteWriteForwardingRulesConfig{
+		{Match: `{__name__="file"}`, URL: "https://file.example.com/api/v1/write", BearerToken: flagext.SecretWithValue("file-token")},
+	}
+
+	for _, precedence := range []string{PrecedenceFile, PrecedenceStore} {
+		t.Run(precedence, func(t *testing.T) {
+			s := newStoreForTest(t, objstore.NewInMemBucket(), precedence, map[string]*validation.Limits{"user-1": &fileLimits})
+
+			// The credentials of the rules of the file are kept when other limits are overridden.
+			_, err := s.Update(ctx, "user-1", "admin", -1, setOverrides(map[string]any{
+				"ingestion_rate": float64(200),
+			}))
+			require.NoError(t, err)
+			user1 := s.ByUserID("user-1")
+			require.Len(t, user1.RemoteWriteForwardingRules, 1)
+			assert.Equal(t, "file-token", user1.RemoteWriteForwardingRules[0].BearerToken.String())
+			assert.Equal(t, float64(200), user1.IngestionRate)
+
+			// The credentials of the rules of the overrides are set as strings.
+			_, err = s.Update(ctx, "user-2", "admin", -1, setOverrides(map[string]any{
+				"remote_write_forwarding_rules": []any{
+					map[string]any{
+						"match":               `{__name__="store"}`,
+						"url":                 "https://store.example.com/api/v1/write",
+						"basic_auth_username": "user",
+						"basic_auth_password": "store-password",
+					},
+				},
+			}))
+			require.NoError(t, err)
+			user2 := s.ByUserID("user-2")
+			require.Len(t, user2.RemoteWriteForwardingRules, 1)
+			assert.Equal(t, "user", user2.RemoteWriteForwardingRules[0].BasicAuthUsername)
+			assert.Equal(t, "store-password", user2.RemoteWriteForwardingRules[0].BasicAuthPassword.String())
+
+			// The credentials are masked when the limits are marshalled.
+			data, err := json.Marshal(user2)
+			require.NoError(t, err)
+			assert.NotContains(t, string(data), "store-password")
+			assert.Contains(t, string(data), `"basic_auth_password":"********"`)
+		})
+	}
+}
+
+func TestStore_Update(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+	s := newStoreForTest(t, bkt, PrecedenceFile, nil)
+
+	first, err := s.Update(ctx, "user-1", "alice", 0, setOverrides(map[string]any{"ingestion_rate": float64(200)}))
+	require.NoError(t, err)
+	assert.Equal(t, 1, first.Version)
+	assert.Equal(t, "alice", first.Author)
+
+	second, err := s.Update(ctx, "user-1", "bob", 1, func(current map[string]any) map[string]any {
+		return mergePatch(current, map[string]any{"ingestion_rate": nil, "ingestion_burst_size": float64(500)})
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, second.Version)
+	assert.Equal(t, map[string]any{"ingestion_burst_size": float64(500)}, second.Limits)
+	assert.Equal(t, 500, s.ByUserID("user-1").IngestionBurstSize)
+
+	t.Run("version conflict", func(t *testing.T) {
+		_, err := s.Update(ctx, "user-1", "alice", 1, setOverrides(map[string]any{}))
+		assert.ErrorIs(t, err, errVersionConflict)
+	})
+
+	t.Run("version written by another instance in the meantime", func(t *testing.T) {
+		// Another instance has written the next version, but not yet the current overrides.
+		require.NoError(t, s.bucket.write(ctx, versionPath("user-1", 3), &Overrides{Version: 3, Author: "carol"}))
+		t.Cleanup(func() {
+			require.NoError(t, s.bucket.bkt.Delete(ctx, versionPath("user-1", 3)))
+		})
+
+		_, err := s.Update(ctx, "user-1", "alice", -1, setOverrides(map[string]any{}))
+		assert.ErrorIs(t, err, errVersionConflict)
+	})
+
+	t.Run("invalid overrides", func(t *testing.T) {
+		for name, limits := range map[string]map[string]any{
+			"unknown limit":      {"unknown_limit": float64(1)},
+			"invalid type":       {"ingestion_rate": "fast"},
+			"failing validation": {"ingestion_rate": float64(maxIngestionRate + 1)},
+		} {
+			t.Run(name, func(t *testing.T) {
+				_, err := s.Update(ctx, "user-1", "alice", -1, setOverrides(limits))
+				assert.ErrorIs(t, err, errInvalidOverrides)
+			})
+		}
+	})
+
+	history, err := s.History(ctx, "user-1")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, second, history[0])
+	assert.Equal(t, first.Version, history[1].Version)
+	assert.Equal(t, first.Limits, history[1].Limits)
+
+	// The changes are loaded by the other instances.
+	other := newStoreForTest(t, bkt, PrecedenceFile, nil)
+	assert.Equal(t, 500, other.ByUserID("user-1").IngestionBurstSize)
+	assert.Equal(t, 2, other.Overrides("user-1").Version)
+}
+
+func TestStore_Poll(t *testing.T) {
+	ctx := context.Background()
+
+	buckets := map[string]func(t *testing.T) objstore.Bucket{
+		// The in-memory bucket doesn't list the update time of the objects.
+		"in-memory": func(*testing.T) objstore.Bucket {
+			return objstore.NewInMemBucket()
+		},
+		"filesystem": func(t *testing.T) objstore.Bucket {
+			bkt, err := filesystem.NewBucket(t.TempDir())
+			require.NoError(t, err)
+			return bkt
+		},
+	}
+
+	for name, newBucket := range buckets {
+		t.Run(name, func(t *testing.T) {
+			bkt := newBucket(t)
+			writer := newStoreForTest(t, bkt, PrecedenceFile, nil)
+			for _, userID := range []string{"user-1", "user-2"} {
+				_, err := writer.Update(ctx, userID, "admin", -1, setOverrides(map[string]any{"ingestion_rate": float64(200)}))
+				require.NoError(t, err)
+			}
+
+			var (
+				reads      = map[string]int{}
+				failedUser string
+			)
+			errorBkt := &bucket.ErrorInjectedBucketClient{Bucket: bkt, Injector: func(op bucket.Operation, target string) error {
+				if op != bucket.OpGet {
+					return nil
+				}
+				userID := path.Base(path.Dir(target))
+				reads[userID]++
+				if userID == failedUser {
+					return errors.New("read failure")
+				}
+				return nil
+			}}
+
+			// The tenants whose overrides can't be read are skipped.
+			failedUser = "user-2"
+			reg := prometheus.NewPedanticRegistry()
+			cfg := Config{Enabled: true, PollInterval: time.Minute, Precedence: PrecedenceFile}
+			s := NewStore(cfg, *validation.MockDefaultLimits(), nil, nil, errorBkt, log.NewNopLogger(), reg)
+			require.NoError(t, s.starting(ctx))
+			assert.Equal(t, 1, s.Overrides("user-1").Version)
+			assert.Nil(t, s.Overrides("user-2"))
+			assert.Equal(t, float64(1), testutil.ToFloat64(s.readFailures))
+			assert.Equal(t, map[string]int{"user-1": 1, "user-2": 1}, reads)
+
+			// Only the overrides which haven't been loaded yet or have changed are read again.
+			failedUser = ""
+			_, err := writer.Update(ctx, "user-1", "admin", -1, setOverrides(map[string]any{"ingestion_rate": float64(300)}))
+			require.NoError(t, err)
+			require.NoError(t, s.poll(ctx))
+			assert.Equal(t, float64(300), s.ByUserID("user-1").IngestionRate)
+			assert.Equal(t, float64(200), s.ByUserID("user-2").IngestionRate)
+			assert.Equal(t, map[string]int{"user-1": 2, "user-2": 2}, reads)
+
+			require.NoError(t, s.poll(ctx))
+			assert.Equal(t, map[string]int{"user-1": 2, "user-2": 2}, reads)
+
+			// The tenants whose changed overrides can't be read keep their last loaded overrides.
+			failedUser = "user-2"
+			_, err = writer.Update(ctx, "user-2", "admin", -1, setOverrides(map[string]any{"ingestion_rate": float64(400)}))
+			require.NoError(t, err)
+			require.NoError(t, s.poll(ctx))
+			assert.Equal(t, float64(200), s.ByUserID("user-2").IngestionRate)
+			assert.Equal(t, float64(2), testutil.ToFloat64(s.readFailures))
+
+			failedUser = ""
+			require.NoError(t, s.poll(ctx))
+			assert.Equal(t, float64(400), s.ByUserID("user-2").IngestionRate)
+			assert.Equal(t, map[string]int{"user-1": 2, "user-2": 4}, reads)
+		})
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	target := map[string]any{
+		"a": float64(1),
+		"b": map[string]any{"c": "d", "e": "f"},
+		"g": "h",
+	}
+	patch := map[string]any{
+		"a": nil,
+		"b": map[string]any{"c": nil, "i": "j"},
+		"k": map[string]any{"l": nil, "m": "n"},
+	}
+	assert.Equal(t, map[string]any{
+		"b": map[string]any{"e": "f", "i": "j"},
+		"g": "h",
+		"k": map[string]any{"m": "n"},
+	}, mergePatch(target, patch))
+
+	// The target isn't modified.
+	assert.Len(t, target, 3)
+}
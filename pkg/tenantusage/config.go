@@ -0,0 +1,61 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package tenantusage
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+var (
+	errInvalidFlushInterval           = errors.New("the tenant usage flush interval must be greater than 0")
+	errInvalidRollupDelay             = errors.New("the tenant usage rollup delay must be greater than the flush interval")
+	errInvalidPartialsRetentionPeriod = errors.New("the tenant usage partials retention period must be greater than 24h plus the rollup delay")
+)
+
+type Config struct {
+	Enabled                 bool          `yaml:"enabled" category:"experimental"`
+	InstanceID              string        `yaml:"instance_id" doc:"default=<hostname>" category:"experimental"`
+	FlushInterval           time.Duration `yaml:"flush_interval" category:"experimental"`
+	RollupDelay             time.Duration `yaml:"rollup_delay" category:"experimental"`
+	PartialsRetentionPeriod time.Duration `yaml:"partials_retention_period" category:"experimental"`
+
+	// RollupEnabled is whether the daily rollups are computed by this instance. It's set by the compactor.
+	RollupEnabled bool `yaml:"-"`
+}
+
+// RegisterFlags adds the flags required to config this to the given FlagSet.
+func (cfg *Config) RegisterFlags(f *flag.FlagSet, logger log.Logger) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		level.Error(logger).Log("msg", "failed to get hostname", "err", err)
+		os.Exit(1)
+	}
+
+	f.BoolVar(&cfg.Enabled, "tenant-usage.enabled", false, "Enable the tracking of the per-tenant usage, persisted as daily rollups in the blocks storage bucket and exposed by the compactor tenant usage report API.")
+	f.StringVar(&cfg.InstanceID, "tenant-usage.instance-id", hostname, "Instance ID the usage tracked by this instance is stored under. It must be unique across the instances, and should be stable across restarts.")
+	f.DurationVar(&cfg.FlushInterval, "tenant-usage.flush-interval", 5*time.Minute, "Interval at which the usage tracked by this instance is written to the bucket.")
+	f.DurationVar(&cfg.RollupDelay, "tenant-usage.rollup-delay", time.Hour, "Delay after the end of a day before the compactor rolls up the usage of the day. It must be greater than the flush interval.")
+	f.DurationVar(&cfg.PartialsRetentionPeriod, "tenant-usage.partials-retention-period", 7*24*time.Hour, "How long the usage written by each instance is kept in the bucket. The daily rollups are kept forever.")
+}
+
+func (cfg *Config) Validate() error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.FlushInterval <= 0 {
+		return errInvalidFlushInterval
+	}
+	if cfg.RollupDelay <= cfg.FlushInterval {
+		return errInvalidRollupDelay
+	}
+	if cfg.PartialsRetentionPeriod <= 24*time.Hour+cfg.RollupDelay {
+		return errInvalidPartialsRetentionPeriod
+	}
+	return nil
+}
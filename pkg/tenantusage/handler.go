@@ -0,0 +1,195 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package tenantusage
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log/level"
+
+	"github.com/grafana/mimir/pkg/util"
+)
+
+const (
+	// maxReportDays is the maximum number of days of a tenant usage report.
+	maxReportDays = 366
+
+	reportFormatJSON = "json"
+	reportFormatCSV  = "csv"
+)
+
+var reportCSVHeader = []string{
+	"day",
+	"tenant",
+	"complete",
+	"samples_ingested",
+	"active_series_p50",
+	"active_series_p90",
+	"active_series_p99",
+	"active_series_max",
+	"stored_bytes",
+	"queries_executed",
+	"fetched_chunk_bytes",
+	"fetched_index_bytes",
+}
+
+type reportResponse struct {
+	Usage []TenantUsage `json:"usage"`
+}
+
+// ReportHandler serves the daily usage of the tenants between the from and to days (both inclusive, in the
+// YYYY-MM-DD format, UTC), which default to the current month. The usage of the tenants set with the tenant
+// parameter is returned, defaulting to all the tenants of the bucket and the tenants having usage. The days
+// which haven't been rolled up yet are computed from the partials written by the instances, and aren't complete.
+func (t *Tracker) ReportHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format := r.Form.Get("format")
+	if format == "" {
+		format = reportFormatJSON
+	}
+	if format != reportFormatJSON && format != reportFormatCSV {
+		http.Error(w, fmt.Sprintf("unsupported format %q, supported formats are %s and %s", format, reportFormatJSON, reportFormatCSV), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	today := now.UTC().Truncate(24 * time.Hour)
+	from, err := parseReportDay(r.Form.Get("from"), today.AddDate(0, 0, 1-today.Day()))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid from: %s", err), http.StatusBadRequest)
+		return
+	}
+	to, err := parseReportDay(r.Form.Get("to"), today)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid to: %s", err), http.StatusBadRequest)
+		return
+	}
+	if to.Before(from) {
+		http.Error(w, "to must not be before from", http.StatusBadRequest)
+		return
+	}
+	if to.Sub(from) >= maxReportDays*24*time.Hour {
+		http.Error(w, fmt.Sprintf("the report can't span more than %d days", maxReportDays), http.StatusBadRequest)
+		return
+	}
+
+	usage, err := t.Report(r.Context(), from, to, r.Form["tenant"], now)
+	if err != nil {
+		level.Error(t.logger).Log("msg", "failed to build the tenant usage report", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if format == reportFormatJSON {
+		util.WriteJSONResponse(w, reportResponse{Usage: usage})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	cw := csv.NewWriter(w)
+	_ = cw.Write(reportCSVHeader)
+	for _, u := range usage {
+		_ = cw.Write([]string{
+			u.Day,
+			u.Tenant,
+			strconv.FormatBool(u.Complete),
+			strconv.FormatUint(u.SamplesIngested, 10),
+			strconv.FormatUint(u.ActiveSeriesP50, 10),
+			strconv.FormatUint(u.ActiveSeriesP90, 10),
+			strconv.FormatUint(u.ActiveSeriesP99, 10),
+			strconv.FormatUint(u.ActiveSeriesMax, 10),
+			strconv.FormatInt(u.StoredBytes, 10),
+			strconv.FormatUint(u.QueriesExecuted, 10),
+			strconv.FormatUint(u.FetchedChunkBytes, 10),
+			strconv.FormatUint(u.FetchedIndexBytes, 10),
+		})
+	}
+	cw.Flush()
+}
+
+func parseReportDay(value string, defaultDay time.Time) (time.Time, error) {
+	if value == "" {
+		return defaultDay, nil
+	}
+	return parseDay(value)
+}
+
+// Report returns the daily usage of the tenants between the from and to days, both inclusive. If no tenant
+// is given, the usage of all the tenants of the bucket and of the tenants having usage is returned.
+// The days without any usage are skipped.
+func (t *Tracker) Report(ctx context.Context, from, to time.Time, tenants []string, now time.Time) ([]TenantUsage, error) {
+	var bucketTenants []string
+	if len(tenants) == 0 {
+		users, markedForDeletion, err := t.usersScanner.ScanUsers(ctx)
+		if err != nil {
+			return nil, err
+		}
+		bucketTenants = append(users, markedForDeletion...)
+	}
+
+	var report []TenantUsage
+	for start := from; !start.After(to); start = start.AddDate(0, 0, 1) {
+		day := dayOf(start)
+		usage, err := t.dayReport(ctx, day, start, now)
+		if err != nil {
+			return nil, err
+		}
+		if usage == nil {
+			continue
+		}
+		complete := len(usage) == 0 || usage[0].Complete
+
+		byTenant := make(map[string]TenantUsage, len(usage))
+		for _, u := range usage {
+			byTenant[u.Tenant] = u
+		}
+
+		dayTenants := tenants
+		if len(dayTenants) == 0 {
+			dayTenants = slices.Clone(bucketTenants)
+			for _, u := range usage {
+				dayTenants = append(dayTenants, u.Tenant)
+			}
+		}
+		slices.Sort(dayTenants)
+		dayTenants = slices.Compact(dayTenants)
+
+		for _, tenant := range dayTenants {
+			u, ok := byTenant[tenant]
+			if !ok {
+				u = TenantUsage{Day: day, Tenant: tenant, Complete: complete}
+			}
+			report = append(report, u)
+		}
+	}
+	return report, nil
+}
+
+// dayReport returns the usage of the tenants over the day from its rollup, or from the partials if the day
+// hasn't been rolled up yet. It returns nil if there's no usage for the day.
+func (t *Tracker) dayReport(ctx context.Context, day string, start, now time.Time) ([]TenantUsage, error) {
+	usage, err := t.store.readDaily(ctx, day)
+	if err != nil || usage != nil {
+		return usage, err
+	}
+
+	// The partials of the day have been deleted after the retention period.
+	if start.Add(24 * time.Hour).Before(now.Add(-t.cfg.PartialsRetentionPeriod)) {
+		return nil, nil
+	}
+	partials, err := t.store.readPartials(ctx, day)
+	if err != nil || partials == nil {
+		return nil, err
+	}
+	return partials.reports(day, false), nil
+}
@@ -0,0 +1,117 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package tenantusage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+)
+
+func TestTracker_Report(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+	uploadTenantBlock(t, bkt, "user-1")
+	uploadTenantBlock(t, bkt, "user-3")
+
+	day := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	compactor := newTrackerForTest(bkt, "compactor", true)
+
+	compactor.AddSamplesIngested("user-1", 10, day)
+	compactor.AddQuery("user-2", 100, 1, day)
+	compactor.AddSamplesIngested("user-1", 20, day.Add(24*time.Hour))
+	compactor.flush(ctx, day.Add(24*time.Hour))
+	require.NoError(t, compactor.rollup(ctx, day.Add(25*time.Hour)))
+
+	now := day.Add(25 * time.Hour)
+
+	t.Run("all tenants", func(t *testing.T) {
+		usage, err := compactor.Report(ctx, day.Add(-24*time.Hour), day.Add(24*time.Hour), nil, now)
+		require.NoError(t, err)
+		// The day without usage is skipped, the tenants of the bucket without usage are reported, and the day
+		// which isn't rolled up yet isn't complete.
+		assert.Equal(t, []TenantUsage{
+			{Day: "2026-03-10", Tenant: "user-1", Complete: true, SamplesIngested: 10},
+			{Day: "2026-03-10", Tenant: "user-2", Complete: true, QueriesExecuted: 1, FetchedChunkBytes: 100, FetchedIndexBytes: 1},
+			{Day: "2026-03-10", Tenant: "user-3", Complete: true},
+			{Day: "2026-03-11", Tenant: "user-1", Complete: false, SamplesIngested: 20},
+			{Day: "2026-03-11", Tenant: "user-3", Complete: false},
+		}, usage)
+	})
+
+	t.Run("selected tenants", func(t *testing.T) {
+		usage, err := compactor.Report(ctx, day, day.Add(24*time.Hour), []string{"user-2"}, now)
+		require.NoError(t, err)
+		assert.Equal(t, []TenantUsage{
+			{Day: "2026-03-10", Tenant: "user-2", Complete: true, QueriesExecuted: 1, FetchedChunkBytes: 100, FetchedIndexBytes: 1},
+			{Day: "2026-03-11", Tenant: "user-2", Complete: false},
+		}, usage)
+	})
+}
+
+func TestTracker_ReportHandler(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+	compactor := newTrackerForTest(bkt, "compactor", true)
+
+	now := time.Now()
+	compactor.AddSamplesIngested("user-1", 10, now)
+	compactor.ObserveActiveSeries("user-1", 5, now)
+	compactor.SetStoredBytes("user-1", 1000, now)
+	compactor.AddQuery("user-1", 100, 1, now)
+	compactor.flush(ctx, now)
+	today := dayOf(now)
+
+	t.Run("json", func(t *testing.T) {
+		resp := httptest.NewRecorder()
+		compactor.ReportHandler(resp, httptest.NewRequest(http.MethodGet, "/compactor/tenant_usage", nil))
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "application/json", resp.Header().Get("Content-Type"))
+
+		var report reportResponse
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &report))
+		assert.Equal(t, []TenantUsage{{
+			Day:               today,
+			Tenant:            "user-1",
+			SamplesIngested:   10,
+			ActiveSeriesP50:   5,
+			ActiveSeriesP90:   5,
+			ActiveSeriesP99:   5,
+			ActiveSeriesMax:   5,
+			StoredBytes:       1000,
+			QueriesExecuted:   1,
+			FetchedChunkBytes: 100,
+			FetchedIndexBytes: 1,
+		}}, report.Usage)
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		resp := httptest.NewRecorder()
+		compactor.ReportHandler(resp, httptest.NewRequest(http.MethodGet, "/compactor/tenant_usage?format=csv&from="+today+"&to="+today+"&tenant=user-1", nil))
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "text/csv; charset=utf-8", resp.Header().Get("Content-Type"))
+		assert.Equal(t, "day,tenant,complete,samples_ingested,active_series_p50,active_series_p90,active_series_p99,active_series_max,stored_bytes,queries_executed,fetched_chunk_bytes,fetched_index_bytes\n"+
+			today+",user-1,false,10,5,5,5,5,1000,1,100,1\n", resp.Body.String())
+	})
+
+	for name, query := range map[string]string{
+		"unsupported format": "format=xml",
+		"invalid from":       "from=yesterday",
+		"invalid to":         "to=2026-13-01",
+		"to before from":     "from=2026-03-10&to=2026-03-09",
+		"too many days":      "from=2025-01-01&to=2026-03-09",
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp := httptest.NewRecorder()
+			compactor.ReportHandler(resp, httptest.NewRequest(http.MethodGet, "/compactor/tenant_usage?"+query, nil))
+			assert.Equal(t, http.StatusBadRequest, resp.Code)
+		})
+	}
+}
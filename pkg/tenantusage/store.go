@@ -0,0 +1,157 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package tenantusage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/mimir/pkg/storage/bucket"
+)
+
+const (
+	// usagePrefix is the prefix of the tenant usage objects in the bucket, under bucket.MimirInternalsPrefix.
+	usagePrefix = "usage"
+
+	// partialsDir holds the usage written by each instance, in partials/<day>/<instance>.json.
+	partialsDir = "partials"
+
+	// dailyDir holds the daily rollups of the usage of all the instances, in daily/<day>.json.
+	dailyDir = "daily"
+)
+
+// store reads and writes the tenant usage in the bucket.
+type store struct {
+	bkt objstore.Bucket
+}
+
+func newStore(bkt objstore.Bucket) *store {
+	return &store{bkt: bucket.NewPrefixedBucketClient(bkt, path.Join(bucket.MimirInternalsPrefix, usagePrefix))}
+}
+
+func partialPath(day, instanceID string) string {
+	return path.Join(partialsDir, day, instanceID+".json")
+}
+
+func dailyPath(day string) string {
+	return path.Join(dailyDir, day+".json")
+}
+
+func (s *store) writePartial(ctx context.Context, day, instanceID string, usage dayUsage) error {
+	return s.write(ctx, partialPath(day, instanceID), usage)
+}
+
+// readPartial returns the usage written by the instance for the day, or nil if there's none.
+func (s *store) readPartial(ctx context.Context, day, instanceID string) (dayUsage, error) {
+	usage := dayUsage{}
+	if err := s.read(ctx, partialPath(day, instanceID), &usage); err != nil {
+		if s.bkt.IsObjNotFoundErr(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return usage, nil
+}
+
+// readPartials returns the usage written by all the instances for the day, or nil if there's none.
+func (s *store) readPartials(ctx context.Context, day string) (dayUsage, error) {
+	var names []string
+	err := s.bkt.Iter(ctx, path.Join(partialsDir, day)+objstore.DirDelim, func(name string) error {
+		if strings.HasSuffix(name, ".json") {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "list tenant usage partials")
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	merged := dayUsage{}
+	for _, name := range names {
+		usage := dayUsage{}
+		if err := s.read(ctx, name, &usage); err != nil {
+			// The partials of the old days may be deleted in the meantime.
+			if s.bkt.IsObjNotFoundErr(err) {
+				continue
+			}
+			return nil, err
+		}
+		merged.add(usage)
+	}
+	return merged, nil
+}
+
+// partialDays returns the days having partials.
+func (s *store) partialDays(ctx context.Context) ([]string, error) {
+	var days []string
+	err := s.bkt.Iter(ctx, partialsDir+objstore.DirDelim, func(name string) error {
+		days = append(days, path.Base(strings.TrimSuffix(name, objstore.DirDelim)))
+		return nil
+	})
+	return days, errors.Wrap(err, "list tenant usage partials")
+}
+
+// deletePartials deletes the partials of the day.
+func (s *store) deletePartials(ctx context.Context, day string) error {
+	return s.bkt.Iter(ctx, path.Join(partialsDir, day)+objstore.DirDelim, func(name string) error {
+		if err := s.bkt.Delete(ctx, name); err != nil && !s.bkt.IsObjNotFoundErr(err) {
+			return errors.Wrapf(err, "delete %s", name)
+		}
+		return nil
+	})
+}
+
+func (s *store) writeDaily(ctx context.Context, day string, usage []TenantUsage) error {
+	return s.write(ctx, dailyPath(day), usage)
+}
+
+// readDaily returns the rollup of the day, or nil if the day hasn't been rolled up.
+func (s *store) readDaily(ctx context.Context, day string) ([]TenantUsage, error) {
+	var usage []TenantUsage
+	if err := s.read(ctx, dailyPath(day), &usage); err != nil {
+		if s.bkt.IsObjNotFoundErr(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if usage == nil {
+		usage = []TenantUsage{}
+	}
+	return usage, nil
+}
+
+func (s *store) dailyExists(ctx context.Context, day string) (bool, error) {
+	return s.bkt.Exists(ctx, dailyPath(day))
+}
+
+func (s *store) write(ctx context.Context, name string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrapf(err, "marshal %s", name)
+	}
+	return errors.Wrapf(s.bkt.Upload(ctx, name, bytes.NewReader(data)), "upload %s", name)
+}
+
+func (s *store) read(ctx context.Context, name string, v any) error {
+	r, err := s.bkt.Get(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = r.Close() }()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return errors.Wrapf(err, "read %s", name)
+	}
+	return errors.Wrapf(json.Unmarshal(data, v), "unmarshal %s", name)
+}
@@ -0,0 +1,310 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package tenantusage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/grafana/dskit/services"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/thanos-io/objstore"
+
+	"github.com/grafana/mimir/pkg/storage/tsdb"
+)
+
+const (
+	// partialsCleanupInterval is the minimum interval between two deletions of the old partials.
+	partialsCleanupInterval = time.Hour
+)
+
+// Tracker tracks the usage of the tenants observed by this instance, and periodically writes it to the bucket.
+// When the rollups are enabled, it also rolls up the usage written by all the instances into daily rollups once
+// the days are over, and serves the tenant usage report.
+//
+// All the methods recording the usage can be called on a nil Tracker, and do nothing.
+type Tracker struct {
+	services.Service
+
+	cfg          Config
+	store        *store
+	usersScanner *tsdb.UsersScanner
+	logger       log.Logger
+
+	mtx sync.Mutex
+	// days holds the usage tracked by this instance, keyed by day. The days are removed once they're over and written.
+	days map[string]dayUsage
+	// dirty holds the days changed since they've been written.
+	dirty map[string]bool
+	// loaded holds the days for which the usage previously written by this instance has been loaded.
+	loaded map[string]bool
+
+	// Only used by the rollups, which don't run concurrently.
+	rolledUp            map[string]bool
+	lastPartialsCleanup time.Time
+
+	flushes         prometheus.Counter
+	flushFailures   prometheus.Counter
+	rollups         prometheus.Counter
+	rollupFailures  prometheus.Counter
+	lastRollupRunTs prometheus.Gauge
+}
+
+// NewTracker creates a Tracker storing the usage in the given blocks storage bucket.
+func NewTracker(cfg Config, bkt objstore.Bucket, logger log.Logger, reg prometheus.Registerer) *Tracker {
+	t := &Tracker{
+		cfg:          cfg,
+		store:        newStore(bkt),
+		usersScanner: tsdb.NewUsersScanner(bkt, tsdb.AllUsers, logger),
+		logger:       log.With(logger, "component", "tenant-usage"),
+		days:         map[string]dayUsage{},
+		dirty:        map[string]bool{},
+		loaded:       map[string]bool{},
+		rolledUp:     map[string]bool{},
+
+		flushes: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_tenant_usage_flushes_total",
+			Help: "Total number of times the tenant usage tracked by this instance has been written to the bucket.",
+		}),
+		flushFailures: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_tenant_usage_flush_failures_total",
+			Help: "Total number of failures writing the tenant usage tracked by this instance to the bucket.",
+		}),
+	}
+
+	if cfg.RollupEnabled {
+		t.rollups = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_tenant_usage_rollups_total",
+			Help: "Total number of days whose tenant usage has been rolled up.",
+		})
+		t.rollupFailures = promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_tenant_usage_rollup_failures_total",
+			Help: "Total number of failures rolling up the tenant usage.",
+		})
+		t.lastRollupRunTs = promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "cortex_tenant_usage_last_successful_rollup_run_timestamp_seconds",
+			Help: "Unix timestamp of the last successful run rolling up the tenant usage.",
+		})
+	}
+
+	t.Service = services.NewTimerService(cfg.FlushInterval, nil, t.iteration, t.stopping)
+	return t
+}
+
+// AddSamplesIngested records samples ingested for the tenant.
+func (t *Tracker) AddSamplesIngested(userID string, samples int, now time.Time) {
+	if t == nil || samples == 0 {
+		return
+	}
+	t.update(now, userID, func(tu *tenantDayUsage) {
+		tu.SamplesIngested += uint64(samples)
+	})
+}
+
+// ObserveActiveSeries records the number of active series of the tenant observed by this instance.
+// The series observed by the instances are summed, so each instance must only observe its share
+// of the series, excluding the replicas.
+func (t *Tracker) ObserveActiveSeries(userID string, series int, now time.Time) {
+	if t == nil || series == 0 {
+		return
+	}
+	slot := activeSeriesSlot(now)
+	t.update(now, userID, func(tu *tenantDayUsage) {
+		if tu.ActiveSeries == nil {
+			tu.ActiveSeries = map[int]uint64{}
+		}
+		// The last observation in the interval wins.
+		tu.ActiveSeries[slot] = uint64(series)
+	})
+}
+
+// AddQuery records a query executed for the tenant, and the bytes fetched to execute it.
+func (t *Tracker) AddQuery(userID string, fetchedChunkBytes, fetchedIndexBytes uint64, now time.Time) {
+	if t == nil {
+		return
+	}
+	t.update(now, userID, func(tu *tenantDayUsage) {
+		tu.QueriesExecuted++
+		tu.FetchedChunkBytes += fetchedChunkBytes
+		tu.FetchedIndexBytes += fetchedIndexBytes
+	})
+}
+
+// SetStoredBytes records the size of the blocks of the tenant in the bucket.
+func (t *Tracker) SetStoredBytes(userID string, storedBytes int64, now time.Time) {
+	if t == nil {
+		return
+	}
+	t.update(now, userID, func(tu *tenantDayUsage) {
+		tu.StoredBytes = storedBytes
+		tu.StoredBytesTimestamp = now.UnixMilli()
+	})
+}
+
+// RecordTenantStorage records the size of the blocks of the tenant in the bucket, as listed in its bucket index.
+func (t *Tracker) RecordTenantStorage(_ context.Context, userID string, storedBytes int64) {
+	t.SetStoredBytes(userID, storedBytes, time.Now())
+}
+
+func (t *Tracker) update(now time.Time, userID string, f func(*tenantDayUsage)) {
+	day := dayOf(now)
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	usage, ok := t.days[day]
+	if !ok {
+		usage = dayUsage{}
+		t.days[day] = usage
+	}
+	f(usage.tenant(userID))
+	t.dirty[day] = true
+}
+
+func (t *Tracker) iteration(ctx context.Context) error {
+	now := time.Now()
+	t.flush(ctx, now)
+
+	if t.cfg.RollupEnabled {
+		if err := t.rollup(ctx, now); err != nil {
+			t.rollupFailures.Inc()
+			level.Warn(t.logger).Log("msg", "failed to roll up the tenant usage", "err", err)
+		} else {
+			t.lastRollupRunTs.SetToCurrentTime()
+		}
+	}
+	return nil
+}
+
+func (t *Tracker) stopping(_ error) error {
+	// Write the usage tracked since the last flush.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	t.flush(ctx, time.Now())
+	return nil
+}
+
+// flush writes the days changed since they've been written, and removes the days which are over from memory.
+func (t *Tracker) flush(ctx context.Context, now time.Time) {
+	t.mtx.Lock()
+	days := make([]string, 0, len(t.dirty))
+	for day, dirty := range t.dirty {
+		if dirty {
+			days = append(days, day)
+		}
+	}
+	t.mtx.Unlock()
+
+	for _, day := range days {
+		t.flushes.Inc()
+		if err := t.flushDay(ctx, day); err != nil {
+			t.flushFailures.Inc()
+			level.Warn(t.logger).Log("msg", "failed to write the tenant usage", "day", day, "err", err)
+		}
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	for day := range t.days {
+		start, err := parseDay(day)
+		if err != nil || t.dirty[day] || start.Add(24*time.Hour).After(now) {
+			continue
+		}
+		delete(t.days, day)
+		delete(t.dirty, day)
+		delete(t.loaded, day)
+	}
+}
+
+func (t *Tracker) flushDay(ctx context.Context, day string) error {
+	t.mtx.Lock()
+	loaded := t.loaded[day]
+	t.mtx.Unlock()
+
+	// The usage written by a previous run of this instance is loaded, not to be overwritten.
+	if !loaded {
+		previous, err := t.store.readPartial(ctx, day, t.cfg.InstanceID)
+		if err != nil {
+			return err
+		}
+
+		t.mtx.Lock()
+		t.days[day].restore(previous)
+		t.loaded[day] = true
+		t.mtx.Unlock()
+	}
+
+	t.mtx.Lock()
+	usage := t.days[day].clone()
+	t.dirty[day] = false
+	t.mtx.Unlock()
+
+	if err := t.store.writePartial(ctx, day, t.cfg.InstanceID, usage); err != nil {
+		t.mtx.Lock()
+		t.dirty[day] = true
+		t.mtx.Unlock()
+		return err
+	}
+	return nil
+}
+
+// rollup rolls up the usage of the days which are over since the rollup delay, and haven't been rolled up yet.
+// The days are rolled up from the partials written by all the instances, which are deleted after the retention period.
+func (t *Tracker) rollup(ctx context.Context, now time.Time) error {
+	first := now.Add(-t.cfg.PartialsRetentionPeriod).UTC().Truncate(24 * time.Hour)
+
+	for start := first; !start.Add(24*time.Hour + t.cfg.RollupDelay).After(now); start = start.Add(24 * time.Hour) {
+		day := dayOf(start)
+		if t.rolledUp[day] {
+			continue
+		}
+
+		exists, err := t.store.dailyExists(ctx, day)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			usage, err := t.store.readPartials(ctx, day)
+			if err != nil {
+				return err
+			}
+			if usage != nil {
+				if err := t.store.writeDaily(ctx, day, usage.reports(day, true)); err != nil {
+					return err
+				}
+				t.rollups.Inc()
+				level.Info(t.logger).Log("msg", "rolled up the tenant usage", "day", day, "tenants", len(usage))
+			}
+		}
+		t.rolledUp[day] = true
+	}
+
+	for day := range t.rolledUp {
+		if start, err := parseDay(day); err != nil || start.Before(first) {
+			delete(t.rolledUp, day)
+		}
+	}
+
+	if now.Sub(t.lastPartialsCleanup) < partialsCleanupInterval {
+		return nil
+	}
+	days, err := t.store.partialDays(ctx)
+	if err != nil {
+		return err
+	}
+	for _, day := range days {
+		if start, err := parseDay(day); err != nil || !start.Before(first) {
+			continue
+		}
+		if err := t.store.deletePartials(ctx, day); err != nil {
+			return err
+		}
+		level.Info(t.logger).Log("msg", "deleted the tenant usage partials after the retention period", "day", day)
+	}
+	t.lastPartialsCleanup = now
+	return nil
+}
@@ -0,0 +1,201 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package tenantusage
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore"
+)
+
+func newTrackerForTest(bkt objstore.Bucket, instanceID string, rollupEnabled bool) *Tracker {
+	cfg := Config{
+		Enabled:                 true,
+		InstanceID:              instanceID,
+		FlushInterval:           time.Minute,
+		RollupDelay:             time.Hour,
+		PartialsRetentionPeriod: 7 * 24 * time.Hour,
+		RollupEnabled:           rollupEnabled,
+	}
+	return NewTracker(cfg, bkt, log.NewNopLogger(), prometheus.NewPedanticRegistry())
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := map[string]struct {
+		setup    func(cfg *Config)
+		expected error
+	}{
+		"default config": {
+			setup: func(*Config) {},
+		},
+		"disabled config isn't validated": {
+			setup: func(cfg *Config) {
+				cfg.RollupDelay = 0
+			},
+		},
+		"invalid flush interval": {
+			setup: func(cfg *Config) {
+				cfg.Enabled = true
+				cfg.FlushInterval = 0
+			},
+			expected: errInvalidFlushInterval,
+		},
+		"rollup delay lower than the flush interval": {
+			setup: func(cfg *Config) {
+				cfg.Enabled = true
+				cfg.RollupDelay = cfg.FlushInterval
+			},
+			expected: errInvalidRollupDelay,
+		},
+		"partials retention period too short": {
+			setup: func(cfg *Config) {
+				cfg.Enabled = true
+				cfg.PartialsRetentionPeriod = 24 * time.Hour
+			},
+			expected: errInvalidPartialsRetentionPeriod,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := Config{}
+			cfg.RegisterFlags(flag.NewFlagSet("", flag.PanicOnError), log.NewNopLogger())
+			tc.setup(&cfg)
+			assert.Equal(t, tc.expected, cfg.Validate())
+		})
+	}
+}
+
+func TestTracker_FlushAndRestore(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+	day := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	tracker := newTrackerForTest(bkt, "instance-1", false)
+	tracker.AddSamplesIngested("user-1", 100, day.Add(time.Hour))
+	tracker.AddQuery("user-1", 1000, 10, day.Add(time.Hour))
+	tracker.ObserveActiveSeries("user-1", 50, day.Add(time.Hour))
+	// The last observation in the interval wins.
+	tracker.ObserveActiveSeries("user-1", 60, day.Add(time.Hour+time.Minute))
+	tracker.flush(ctx, day.Add(2*time.Hour))
+
+	usage, err := tracker.store.readPartial(ctx, "2026-03-10", "instance-1")
+	require.NoError(t, err)
+	assert.Equal(t, dayUsage{
+		"user-1": {SamplesIngested: 100, QueriesExecuted: 1, FetchedChunkBytes: 1000, FetchedIndexBytes: 10, ActiveSeries: map[int]uint64{12: 60}},
+	}, usage)
+
+	// A new run of the same instance doesn't overwrite the usage written by the previous run.
+	tracker = newTrackerForTest(bkt, "instance-1", false)
+	tracker.AddSamplesIngested("user-1", 20, day.Add(3*time.Hour))
+	tracker.ObserveActiveSeries("user-1", 70, day.Add(3*time.Hour))
+	tracker.flush(ctx, day.Add(3*time.Hour))
+
+	usage, err = tracker.store.readPartial(ctx, "2026-03-10", "instance-1")
+	require.NoError(t, err)
+	assert.Equal(t, dayUsage{
+		"user-1": {SamplesIngested: 120, QueriesExecuted: 1, FetchedChunkBytes: 1000, FetchedIndexBytes: 10, ActiveSeries: map[int]uint64{12: 60, 36: 70}},
+	}, usage)
+
+	// The day is removed from memory once it's over and written.
+	tracker.AddSamplesIngested("user-1", 1, day.Add(23*time.Hour))
+	tracker.flush(ctx, day.Add(25*time.Hour))
+	assert.Empty(t, tracker.days)
+
+	// Nothing is tracked by a nil tracker.
+	var nilTracker *Tracker
+	nilTracker.AddSamplesIngested("user-1", 1, day)
+	nilTracker.AddQuery("user-1", 1, 1, day)
+	nilTracker.ObserveActiveSeries("user-1", 1, day)
+	nilTracker.SetStoredBytes("user-1", 1, day)
+}
+
+func TestTracker_Rollup(t *testing.T) {
+	ctx := context.Background()
+	bkt := objstore.NewInMemBucket()
+	day := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+
+	// Two instances observe a share of the active series of user-1 in each interval.
+	instance1 := newTrackerForTest(bkt, "instance-1", false)
+	instance2 := newTrackerForTest(bkt, "instance-2", false)
+	for i := 0; i < 100; i++ {
+		ts := day.Add(time.Duration(i) * activeSeriesSlotDuration)
+		instance1.ObserveActiveSeries("user-1", i, ts)
+		instance2.ObserveActiveSeries("user-1", i+1, ts)
+	}
+	instance1.AddSamplesIngested("user-1", 10, day)
+	instance2.AddSamplesIngested("user-1", 5, day)
+	instance2.AddQuery("user-2", 100, 1, day)
+	instance1.flush(ctx, day.Add(time.Hour))
+	instance2.flush(ctx, day.Add(time.Hour))
+
+	compactor := newTrackerForTest(bkt, "compactor", true)
+	compactor.SetStoredBytes("user-1", 1000, day.Add(time.Hour))
+	compactor.SetStoredBytes("user-1", 2000, day.Add(2*time.Hour))
+	compactor.flush(ctx, day.Add(2*time.Hour))
+
+	// The day isn't rolled up before the rollup delay.
+	require.NoError(t, compactor.rollup(ctx, day.Add(24*time.Hour+30*time.Minute)))
+	exists, err := compactor.store.dailyExists(ctx, "2026-03-10")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	require.NoError(t, compactor.rollup(ctx, day.Add(25*time.Hour)))
+	usage, err := compactor.store.readDaily(ctx, "2026-03-10")
+	require.NoError(t, err)
+	assert.Equal(t, []TenantUsage{
+		{
+			Day:             "2026-03-10",
+			Tenant:          "user-1",
+			Complete:        true,
+			SamplesIngested: 15,
+			// The active series are 1, 3, 5, ..., 199.
+			ActiveSeriesP50: 99,
+			ActiveSeriesP90: 179,
+			ActiveSeriesP99: 197,
+			ActiveSeriesMax: 199,
+			StoredBytes:     2000,
+		},
+		{
+			Day:               "2026-03-10",
+			Tenant:            "user-2",
+			Complete:          true,
+			QueriesExecuted:   1,
+			FetchedChunkBytes: 100,
+			FetchedIndexBytes: 1,
+		},
+	}, usage)
+
+	// The partials are deleted after the retention period.
+	require.NoError(t, compactor.rollup(ctx, day.Add(9*24*time.Hour)))
+	days, err := compactor.store.partialDays(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, days)
+
+	// The rollups are kept.
+	usage, err = compactor.store.readDaily(ctx, "2026-03-10")
+	require.NoError(t, err)
+	assert.Len(t, usage, 2)
+}
+
+func TestActiveSeriesSlot(t *testing.T) {
+	day := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, 0, activeSeriesSlot(day))
+	assert.Equal(t, 0, activeSeriesSlot(day.Add(4*time.Minute)))
+	assert.Equal(t, 1, activeSeriesSlot(day.Add(5*time.Minute)))
+	assert.Equal(t, 287, activeSeriesSlot(day.Add(24*time.Hour-time.Second)))
+	assert.Equal(t, 12, activeSeriesSlot(day.Add(time.Hour).In(time.FixedZone("UTC+2", 2*60*60))))
+}
+
+func uploadTenantBlock(t *testing.T, bkt objstore.Bucket, userID string) {
+	require.NoError(t, bkt.Upload(context.Background(), fmt.Sprintf("%s/01JPV6K3PJ4B3HXZQ9R7A2X6VN/meta.json", userID), bytes.NewReader([]byte("{}"))))
+}
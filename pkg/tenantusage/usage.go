@@ -0,0 +1,190 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package tenantusage
+
+import (
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// dayFormat is the format of the days, which are UTC days.
+	dayFormat = "2006-01-02"
+
+	// activeSeriesSlotDuration is the duration of the intervals the active series are observed on.
+	activeSeriesSlotDuration = 5 * time.Minute
+)
+
+// TenantUsage is the usage of a tenant over a day.
+type TenantUsage struct {
+	Day    string `json:"day"`
+	Tenant string `json:"tenant"`
+
+	// Complete is false if the day hasn't been rolled up yet, and the usage may still change.
+	Complete bool `json:"complete"`
+
+	SamplesIngested uint64 `json:"samples_ingested"`
+
+	// The percentiles of the active series are computed over the 5 minute intervals of the day
+	// in which the tenant had active series.
+	ActiveSeriesP50 uint64 `json:"active_series_p50"`
+	ActiveSeriesP90 uint64 `json:"active_series_p90"`
+	ActiveSeriesP99 uint64 `json:"active_series_p99"`
+	ActiveSeriesMax uint64 `json:"active_series_max"`
+
+	// StoredBytes is the size of the blocks of the tenant in the bucket, as last observed in the day.
+	StoredBytes int64 `json:"stored_bytes"`
+
+	QueriesExecuted   uint64 `json:"queries_executed"`
+	FetchedChunkBytes uint64 `json:"fetched_chunk_bytes"`
+	FetchedIndexBytes uint64 `json:"fetched_index_bytes"`
+}
+
+// dayUsage is the usage of the tenants over a day, keyed by tenant.
+type dayUsage map[string]*tenantDayUsage
+
+// tenantDayUsage is the usage of a tenant over a day, as tracked by one or several instances.
+type tenantDayUsage struct {
+	SamplesIngested uint64 `json:"samples_ingested,omitempty"`
+
+	// ActiveSeries is keyed by the index of the 5 minute interval in the day.
+	ActiveSeries map[int]uint64 `json:"active_series,omitempty"`
+
+	StoredBytes int64 `json:"stored_bytes,omitempty"`
+	// StoredBytesTimestamp is the unix timestamp (millis precision) of when StoredBytes has been observed.
+	StoredBytesTimestamp int64 `json:"stored_bytes_timestamp,omitempty"`
+
+	QueriesExecuted   uint64 `json:"queries_executed,omitempty"`
+	FetchedChunkBytes uint64 `json:"fetched_chunk_bytes,omitempty"`
+	FetchedIndexBytes uint64 `json:"fetched_index_bytes,omitempty"`
+}
+
+func (u dayUsage) tenant(userID string) *tenantDayUsage {
+	tu, ok := u[userID]
+	if !ok {
+		tu = &tenantDayUsage{}
+		u[userID] = tu
+	}
+	return tu
+}
+
+// add adds the usage tracked by another instance.
+func (u dayUsage) add(other dayUsage) {
+	for userID, o := range other {
+		tu := u.tenant(userID)
+		tu.SamplesIngested += o.SamplesIngested
+		tu.QueriesExecuted += o.QueriesExecuted
+		tu.FetchedChunkBytes += o.FetchedChunkBytes
+		tu.FetchedIndexBytes += o.FetchedIndexBytes
+
+		// Each instance observes a share of the active series.
+		for slot, series := range o.ActiveSeries {
+			if tu.ActiveSeries == nil {
+				tu.ActiveSeries = map[int]uint64{}
+			}
+			tu.ActiveSeries[slot] += series
+		}
+
+		if o.StoredBytesTimestamp > tu.StoredBytesTimestamp {
+			tu.StoredBytes = o.StoredBytes
+			tu.StoredBytesTimestamp = o.StoredBytesTimestamp
+		}
+	}
+}
+
+// restore adds the usage previously written by the same instance. The active series observed since are kept.
+func (u dayUsage) restore(previous dayUsage) {
+	for userID, p := range previous {
+		tu := u.tenant(userID)
+		tu.SamplesIngested += p.SamplesIngested
+		tu.QueriesExecuted += p.QueriesExecuted
+		tu.FetchedChunkBytes += p.FetchedChunkBytes
+		tu.FetchedIndexBytes += p.FetchedIndexBytes
+
+		for slot, series := range p.ActiveSeries {
+			if tu.ActiveSeries == nil {
+				tu.ActiveSeries = map[int]uint64{}
+			}
+			if _, ok := tu.ActiveSeries[slot]; !ok {
+				tu.ActiveSeries[slot] = series
+			}
+		}
+
+		if p.StoredBytesTimestamp > tu.StoredBytesTimestamp {
+			tu.StoredBytes = p.StoredBytes
+			tu.StoredBytesTimestamp = p.StoredBytesTimestamp
+		}
+	}
+}
+
+func (u dayUsage) clone() dayUsage {
+	c := make(dayUsage, len(u))
+	for userID, tu := range u {
+		ctu := *tu
+		ctu.ActiveSeries = maps.Clone(tu.ActiveSeries)
+		c[userID] = &ctu
+	}
+	return c
+}
+
+// reports returns the usage of the tenants over the day, sorted by tenant.
+func (u dayUsage) reports(day string, complete bool) []TenantUsage {
+	reports := make([]TenantUsage, 0, len(u))
+	for userID, tu := range u {
+		reports = append(reports, tu.report(day, userID, complete))
+	}
+	slices.SortFunc(reports, func(a, b TenantUsage) int {
+		return strings.Compare(a.Tenant, b.Tenant)
+	})
+	return reports
+}
+
+// report returns the usage of the tenant over the day.
+func (tu *tenantDayUsage) report(day, userID string, complete bool) TenantUsage {
+	r := TenantUsage{
+		Day:               day,
+		Tenant:            userID,
+		Complete:          complete,
+		SamplesIngested:   tu.SamplesIngested,
+		StoredBytes:       tu.StoredBytes,
+		QueriesExecuted:   tu.QueriesExecuted,
+		FetchedChunkBytes: tu.FetchedChunkBytes,
+		FetchedIndexBytes: tu.FetchedIndexBytes,
+	}
+
+	if len(tu.ActiveSeries) > 0 {
+		series := make([]uint64, 0, len(tu.ActiveSeries))
+		for _, s := range tu.ActiveSeries {
+			series = append(series, s)
+		}
+		slices.Sort(series)
+		r.ActiveSeriesP50 = percentile(series, 50)
+		r.ActiveSeriesP90 = percentile(series, 90)
+		r.ActiveSeriesP99 = percentile(series, 99)
+		r.ActiveSeriesMax = series[len(series)-1]
+	}
+	return r
+}
+
+// percentile returns the nearest-rank percentile of the sorted values.
+func percentile(sorted []uint64, p float64) uint64 {
+	idx := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	return sorted[max(0, min(idx, len(sorted)-1))]
+}
+
+func dayOf(t time.Time) string {
+	return t.UTC().Format(dayFormat)
+}
+
+func parseDay(day string) (time.Time, error) {
+	return time.Parse(dayFormat, day)
+}
+
+// activeSeriesSlot returns the index in the day of the 5 minute interval of the time.
+func activeSeriesSlot(t time.Time) int {
+	t = t.UTC()
+	return int(t.Sub(t.Truncate(24*time.Hour)) / activeSeriesSlotDuration)
+}
@@ -27,6 +27,9 @@ const (
 	SeriesLabelValueTooLong               ID = "label-value-too-long"
 	SeriesWithDuplicateLabelNames         ID = "duplicate-label-names"
 	SeriesLabelsNotSorted                 ID = "labels-not-sorted"
+	MetricNotInSchema                     ID = "metric-not-in-schema"
+	LabelNotInSchema                      ID = "label-not-in-schema"
+	MetricSchemaTypeMismatch              ID = "metric-schema-type-mismatch"
 	SampleTooFarInFuture                  ID = "too-far-in-future"
 	SampleTooFarInPast                    ID = "too-far-in-past"
 	MaxSeriesPerMetric                    ID = "max-series-per-metric"
@@ -38,6 +41,9 @@ const (
 	MaxChunkBytesPerQuery                 ID = "max-chunks-bytes-per-query"
 	MaxEstimatedChunksPerQuery            ID = "max-estimated-chunks-per-query"
 	MaxEstimatedMemoryConsumptionPerQuery ID = "max-estimated-memory-consumption-per-query"
+	MaxSeriesPerFederatedQuery            ID = "max-series-per-federated-query"
+	MaxChunkBytesPerFederatedQuery        ID = "max-chunks-bytes-per-federated-query"
+	MaxChunksPerFederatedQuery            ID = "max-chunks-per-federated-query"
 
 	DistributorMaxIngestionRate             ID = "distributor-max-ingestion-rate"
 	DistributorMaxInflightPushRequests      ID = "distributor-max-inflight-push-requests"
@@ -64,6 +70,8 @@ const (
 	MaxQueryExpressionSizeBytes ID = "max-query-expression-size-bytes"
 	RequestRateLimited          ID = "tenant-max-request-rate"
 	IngestionRateLimited        ID = "tenant-max-ingestion-rate"
+	MetricLimitIngestionRate    ID = "metric-limit-ingestion-rate"
+	MetricLimitMaxSeries        ID = "metric-limit-max-series"
 	TooManyHAClusters           ID = "tenant-too-many-ha-clusters"
 	QueryBlocked                ID = "query-blocked"
 	RequestBlocked              ID = "request-blocked"
@@ -129,6 +137,15 @@ func (id ID) MessageWithStrategyAndPerTenantLimitConfig(msg, strategy, flag stri
 		msg, errPrefix, id, strategy, plural, flagsList)
 }
 
+// MessageWithStrategyAndLimitConfig returns the provided msg, appending the error id and a
+// suggestion on which strategy to follow to try not hitting the limit, plus which configuration
+// flag(s) to otherwise change the limit, which is not a per-tenant limit.
+func (id ID) MessageWithStrategyAndLimitConfig(msg, strategy, flag string, addFlags ...string) string {
+	flagsList, plural := buildFlagsList(flag, addFlags...)
+	return fmt.Sprintf("%s (%s%s). %s. Otherwise, to adjust the related limit%s, configure %s, or contact your service administrator.",
+		msg, errPrefix, id, strategy, plural, flagsList)
+}
+
 // LabelValue returns the error ID converted to a form suitable for use as a Prometheus label value.
 func (id ID) LabelValue() string {
 	return strings.ReplaceAll(string(id), "-", "_")
@@ -58,3 +58,21 @@ func TestID_MessageWithPerTenantLimitConfig(t *testing.T) {
 		assert.Equal(t, tc.expected, tc.actual)
 	}
 }
+
+func TestID_MessageWithStrategyAndLimitConfig(t *testing.T) {
+	for _, tc := range []struct {
+		expected string
+		actual   string
+	}{
+		{
+			expected: "an error (err-mimir-missing-metric-name). Try this. Otherwise, to adjust the related limit, configure -my-flag1, or contact your service administrator.",
+			actual:   MissingMetricName.MessageWithStrategyAndLimitConfig("an error", "Try this", "my-flag1"),
+		},
+		{
+			expected: "an error (err-mimir-missing-metric-name). Try this. Otherwise, to adjust the related limits, configure -my-flag1 and -my-flag2, or contact your service administrator.",
+			actual:   MissingMetricName.MessageWithStrategyAndLimitConfig("an error", "Try this", "my-flag1", "my-flag2"),
+		},
+	} {
+		assert.Equal(t, tc.expected, tc.actual)
+	}
+}
@@ -9,6 +9,12 @@ import (
 	"github.com/grafana/mimir/pkg/util/validation"
 )
 
+const (
+	maxFetchedSeriesPerFederatedQueryFlag     = "tenant-federation.max-fetched-series-per-query"
+	maxFetchedChunkBytesPerFederatedQueryFlag = "tenant-federation.max-fetched-chunk-bytes-per-query"
+	maxFetchedChunksPerFederatedQueryFlag     = "tenant-federation.max-fetched-chunks-per-query"
+)
+
 var (
 	maxSeriesHitMsgFormat = globalerror.MaxSeriesPerQuery.MessageWithStrategyAndPerTenantLimitConfig(
 		"the query exceeded the maximum number of series (limit: %d series)",
@@ -35,6 +41,21 @@ var (
 		cardinalityStrategy,
 		validation.MaxEstimatedMemoryConsumptionPerQueryFlag,
 	)
+	maxSeriesPerFederatedQueryMsgFormat = globalerror.MaxSeriesPerFederatedQuery.MessageWithStrategyAndLimitConfig(
+		"the federated query exceeded the maximum number of series fetched across all tenants (limit: %d series)",
+		cardinalityStrategy,
+		maxFetchedSeriesPerFederatedQueryFlag,
+	)
+	maxChunkBytesPerFederatedQueryMsgFormat = globalerror.MaxChunkBytesPerFederatedQuery.MessageWithStrategyAndLimitConfig(
+		"the federated query exceeded the aggregated chunks size limit across all tenants (limit: %d bytes)",
+		cardinalityStrategy,
+		maxFetchedChunkBytesPerFederatedQueryFlag,
+	)
+	maxChunksPerFederatedQueryMsgFormat = globalerror.MaxChunksPerFederatedQuery.MessageWithStrategyAndLimitConfig(
+		"the federated query exceeded the maximum number of chunks fetched across all tenants (limit: %d chunks)",
+		cardinalityStrategy,
+		maxFetchedChunksPerFederatedQueryFlag,
+	)
 )
 
 func limitError(format string, limit uint64) validation.LimitError {
@@ -60,3 +81,15 @@ func NewMaxEstimatedChunksPerQueryLimitError(maxEstimatedChunksPerQuery uint64)
 func NewMaxEstimatedMemoryConsumptionPerQueryLimitError(maxEstimatedMemoryConsumptionPerQuery uint64) validation.LimitError {
 	return limitError(maxEstimatedMemoryConsumptionPerQueryLimitMsgFormat, maxEstimatedMemoryConsumptionPerQuery)
 }
+
+func NewMaxSeriesPerFederatedQueryLimitError(maxSeries uint64) validation.LimitError {
+	return limitError(maxSeriesPerFederatedQueryMsgFormat, maxSeries)
+}
+
+func NewMaxChunkBytesPerFederatedQueryLimitError(maxChunkBytes uint64) validation.LimitError {
+	return limitError(maxChunkBytesPerFederatedQueryMsgFormat, maxChunkBytes)
+}
+
+func NewMaxChunksPerFederatedQueryLimitError(maxChunks uint64) validation.LimitError {
+	return limitError(maxChunksPerFederatedQueryMsgFormat, maxChunks)
+}
@@ -0,0 +1,128 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package limiter
+
+import (
+	"context"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/atomic"
+
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+const (
+	RejectReasonMaxFederatedSeries     = "max-fetched-series-per-federated-query"
+	RejectReasonMaxFederatedChunkBytes = "max-fetched-chunk-bytes-per-federated-query"
+	RejectReasonMaxFederatedChunks     = "max-fetched-chunks-per-federated-query"
+)
+
+type federatedQueryLimiterCtxKey struct{}
+
+var federatedCtxKey = &federatedQueryLimiterCtxKey{}
+
+// FederatedQueryLimiter enforces limits on the data fetched across all the tenants of a federated
+// query, on top of the per-tenant limits enforced by the QueryLimiter of each tenant sub-query.
+type FederatedQueryLimiter struct {
+	uniqueSeriesMx sync.Mutex
+	uniqueSeries   map[tenantSeries]struct{}
+
+	chunkBytesCount atomic.Int64
+	chunkCount      atomic.Int64
+
+	maxSeries     int
+	maxChunkBytes int
+	maxChunks     int
+
+	rejectedQueries *prometheus.CounterVec
+}
+
+// NewFederatedQueryLimiter makes a new per-query limiter for federated queries. A limit set to 0 is disabled.
+// The rejectedQueries metric, if not nil, is incremented with the reject reason the first time a limit is exceeded.
+func NewFederatedQueryLimiter(maxSeries, maxChunkBytes, maxChunks int, rejectedQueries *prometheus.CounterVec) *FederatedQueryLimiter {
+	return &FederatedQueryLimiter{
+		uniqueSeries:    map[tenantSeries]struct{}{},
+		maxSeries:       maxSeries,
+		maxChunkBytes:   maxChunkBytes,
+		maxChunks:       maxChunks,
+		rejectedQueries: rejectedQueries,
+	}
+}
+
+func AddFederatedQueryLimiterToContext(ctx context.Context, limiter *FederatedQueryLimiter) context.Context {
+	return context.WithValue(ctx, federatedCtxKey, limiter)
+}
+
+// FederatedQueryLimiterFromContext returns the FederatedQueryLimiter from the current context, or nil
+// if the query is not federated.
+func FederatedQueryLimiterFromContext(ctx context.Context) *FederatedQueryLimiter {
+	l, _ := ctx.Value(federatedCtxKey).(*FederatedQueryLimiter)
+	return l
+}
+
+// tenantSeries identifies a series fetched for a given tenant. The same series fetched for different
+// tenants is counted multiple times, given it's returned as multiple series by a federated query.
+type tenantSeries struct {
+	tenantID    string
+	fingerprint uint64
+}
+
+// addSeries adds the series with the given fingerprint, fetched for tenantID, and returns an error
+// if the limit is reached.
+func (l *FederatedQueryLimiter) addSeries(tenantID string, fingerprint uint64) validation.LimitError {
+	if l == nil || l.maxSeries == 0 {
+		return nil
+	}
+
+	l.uniqueSeriesMx.Lock()
+	defer l.uniqueSeriesMx.Unlock()
+
+	uniqueSeriesBefore := len(l.uniqueSeries)
+	l.uniqueSeries[tenantSeries{tenantID: tenantID, fingerprint: fingerprint}] = struct{}{}
+	uniqueSeriesAfter := len(l.uniqueSeries)
+
+	if uniqueSeriesAfter > l.maxSeries {
+		if uniqueSeriesBefore <= l.maxSeries {
+			l.reject(RejectReasonMaxFederatedSeries)
+		}
+		return NewMaxSeriesPerFederatedQueryLimitError(uint64(l.maxSeries))
+	}
+	return nil
+}
+
+func (l *FederatedQueryLimiter) addChunkBytes(chunkSizeInBytes int) validation.LimitError {
+	if l == nil || l.maxChunkBytes == 0 {
+		return nil
+	}
+
+	totalBytes := l.chunkBytesCount.Add(int64(chunkSizeInBytes))
+	if totalBytes > int64(l.maxChunkBytes) {
+		if totalBytes-int64(chunkSizeInBytes) <= int64(l.maxChunkBytes) {
+			l.reject(RejectReasonMaxFederatedChunkBytes)
+		}
+		return NewMaxChunkBytesPerFederatedQueryLimitError(uint64(l.maxChunkBytes))
+	}
+	return nil
+}
+
+func (l *FederatedQueryLimiter) addChunks(count int) validation.LimitError {
+	if l == nil || l.maxChunks == 0 {
+		return nil
+	}
+
+	totalChunks := l.chunkCount.Add(int64(count))
+	if totalChunks > int64(l.maxChunks) {
+		if totalChunks-int64(count) <= int64(l.maxChunks) {
+			l.reject(RejectReasonMaxFederatedChunks)
+		}
+		return NewMaxChunksPerFederatedQueryLimitError(uint64(l.maxChunks))
+	}
+	return nil
+}
+
+func (l *FederatedQueryLimiter) reject(reason string) {
+	if l.rejectedQueries != nil {
+		l.rejectedQueries.WithLabelValues(reason).Inc()
+	}
+}
@@ -0,0 +1,106 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package limiter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/querier/stats"
+)
+
+func TestFederatedQueryLimiter_AddSeries(t *testing.T) {
+	var (
+		series1  = labels.FromStrings(labels.MetricName, "test_metric", "series", "1")
+		series2  = labels.FromStrings(labels.MetricName, "test_metric", "series", "2")
+		rejected = newFederatedRejectedQueriesMetric()
+		metrics  = stats.NewQueryMetrics(prometheus.NewPedanticRegistry())
+
+		federated = NewFederatedQueryLimiter(2, 0, 0, rejected)
+		tenantA   = NewQueryLimiter(10, 0, 0, 0, metrics).WithFederatedQueryLimiter(federated, "tenant-a")
+		tenantB   = NewQueryLimiter(10, 0, 0, 0, metrics).WithFederatedQueryLimiter(federated, "tenant-b")
+	)
+
+	require.NoError(t, tenantA.AddSeries(series1))
+
+	// Re-adding the same series for the same tenant is not double counted.
+	require.NoError(t, tenantA.AddSeries(series1))
+
+	// The same series fetched for another tenant is counted.
+	require.NoError(t, tenantB.AddSeries(series1))
+	assert.Equal(t, 0.0, testutil.ToFloat64(rejected.WithLabelValues(RejectReasonMaxFederatedSeries)))
+
+	err := tenantB.AddSeries(series2)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "err-mimir-max-series-per-federated-query")
+	assert.Contains(t, err.Error(), "-tenant-federation.max-fetched-series-per-query")
+	assert.Equal(t, 1.0, testutil.ToFloat64(rejected.WithLabelValues(RejectReasonMaxFederatedSeries)))
+
+	// The rejected query is counted only once.
+	require.Error(t, tenantA.AddSeries(series2))
+	assert.Equal(t, 1.0, testutil.ToFloat64(rejected.WithLabelValues(RejectReasonMaxFederatedSeries)))
+}
+
+func TestFederatedQueryLimiter_AddChunkBytes(t *testing.T) {
+	var (
+		rejected = newFederatedRejectedQueriesMetric()
+		metrics  = stats.NewQueryMetrics(prometheus.NewPedanticRegistry())
+
+		federated = NewFederatedQueryLimiter(0, 100, 0, rejected)
+		tenantA   = NewQueryLimiter(0, 80, 0, 0, metrics).WithFederatedQueryLimiter(federated, "tenant-a")
+		tenantB   = NewQueryLimiter(0, 80, 0, 0, metrics).WithFederatedQueryLimiter(federated, "tenant-b")
+	)
+
+	require.NoError(t, tenantA.AddChunkBytes(60))
+	err := tenantB.AddChunkBytes(60)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "err-mimir-max-chunks-bytes-per-federated-query")
+	assert.Equal(t, 1.0, testutil.ToFloat64(rejected.WithLabelValues(RejectReasonMaxFederatedChunkBytes)))
+}
+
+func TestFederatedQueryLimiter_AddChunks(t *testing.T) {
+	var (
+		rejected = newFederatedRejectedQueriesMetric()
+		metrics  = stats.NewQueryMetrics(prometheus.NewPedanticRegistry())
+
+		federated = NewFederatedQueryLimiter(0, 0, 3, rejected)
+		tenantA   = NewQueryLimiter(0, 0, 10, 0, metrics).WithFederatedQueryLimiter(federated, "tenant-a")
+		tenantB   = NewQueryLimiter(0, 0, 10, 0, metrics).WithFederatedQueryLimiter(federated, "tenant-b")
+	)
+
+	require.NoError(t, tenantA.AddChunks(2))
+	require.NoError(t, tenantB.AddChunks(1))
+	err := tenantB.AddChunks(1)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "err-mimir-max-chunks-per-federated-query")
+	assert.Equal(t, 1.0, testutil.ToFloat64(rejected.WithLabelValues(RejectReasonMaxFederatedChunks)))
+}
+
+func TestFederatedQueryLimiter_PerTenantLimitsStillApply(t *testing.T) {
+	var (
+		metrics   = stats.NewQueryMetrics(prometheus.NewPedanticRegistry())
+		federated = NewFederatedQueryLimiter(0, 1000, 0, nil)
+		tenantA   = NewQueryLimiter(0, 50, 0, 0, metrics).WithFederatedQueryLimiter(federated, "tenant-a")
+	)
+
+	err := tenantA.AddChunkBytes(60)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "err-mimir-max-chunks-bytes-per-query")
+}
+
+func TestFederatedQueryLimiterFromContext(t *testing.T) {
+	assert.Nil(t, FederatedQueryLimiterFromContext(context.Background()))
+
+	l := NewFederatedQueryLimiter(1, 2, 3, nil)
+	assert.Same(t, l, FederatedQueryLimiterFromContext(AddFederatedQueryLimiterToContext(context.Background(), l)))
+}
+
+func newFederatedRejectedQueriesMetric() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_rejected_total"}, []string{"reason"})
+}
@@ -40,6 +40,11 @@ type QueryLimiter struct {
 	maxEstimatedChunksPerQuery int
 
 	queryMetrics *stats.QueryMetrics
+
+	// federated, if set, is the limiter enforcing limits across all the tenants of a federated query,
+	// and tenantID is the tenant this limiter has been created for.
+	federated *FederatedQueryLimiter
+	tenantID  string
 }
 
 // NewQueryLimiter makes a new per-query limiter. Each query limiter is configured using the
@@ -58,6 +63,15 @@ func NewQueryLimiter(maxSeriesPerQuery, maxChunkBytesPerQuery, maxChunksPerQuery
 	}
 }
 
+// WithFederatedQueryLimiter links the QueryLimiter, created for the tenant sub-query tenantID of a
+// federated query, to the FederatedQueryLimiter of the federated query. Series, chunk bytes and chunks
+// added to the QueryLimiter are also accounted against the federated query limits. It returns ql.
+func (ql *QueryLimiter) WithFederatedQueryLimiter(federated *FederatedQueryLimiter, tenantID string) *QueryLimiter {
+	ql.federated = federated
+	ql.tenantID = tenantID
+	return ql
+}
+
 func AddQueryLimiterToContext(ctx context.Context, limiter *QueryLimiter) context.Context {
 	return context.WithValue(ctx, ctxKey, limiter)
 }
@@ -75,6 +89,12 @@ func QueryLimiterFromContextWithFallback(ctx context.Context) *QueryLimiter {
 
 // AddSeries adds the input series and returns an error if the limit is reached.
 func (ql *QueryLimiter) AddSeries(seriesLabels labels.Labels) validation.LimitError {
+	if ql.federated != nil && ql.federated.maxSeries > 0 {
+		if err := ql.federated.addSeries(ql.tenantID, seriesLabels.Hash()); err != nil {
+			return err
+		}
+	}
+
 	// If the max series is unlimited just return without managing map
 	if ql.maxSeriesPerQuery == 0 {
 		return nil
@@ -108,6 +128,10 @@ func (ql *QueryLimiter) uniqueSeriesCount() int {
 
 // AddChunkBytes adds the input chunk size in bytes and returns an error if the limit is reached.
 func (ql *QueryLimiter) AddChunkBytes(chunkSizeInBytes int) validation.LimitError {
+	if err := ql.federated.addChunkBytes(chunkSizeInBytes); err != nil {
+		return err
+	}
+
 	if ql.maxChunkBytesPerQuery == 0 {
 		return nil
 	}
@@ -126,6 +150,10 @@ func (ql *QueryLimiter) AddChunkBytes(chunkSizeInBytes int) validation.LimitErro
 }
 
 func (ql *QueryLimiter) AddChunks(count int) validation.LimitError {
+	if err := ql.federated.addChunks(count); err != nil {
+		return err
+	}
+
 	if ql.maxChunksPerQuery == 0 {
 		return nil
 	}
@@ -3,6 +3,9 @@
 package validation
 
 import (
+	"errors"
+	"sync"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
@@ -55,3 +58,58 @@ func DiscardedMetadataCounter(reg prometheus.Registerer, reason string) *prometh
 		},
 	}, []string{"user"})
 }
+
+// DiscardedSamplesCounters holds the per-user counter vectors for samples discarded for reasons not known
+// in advance. The counter vector of a reason is registered when first used.
+type DiscardedSamplesCounters struct {
+	reg prometheus.Registerer
+
+	mtx      sync.Mutex
+	counters map[string]*prometheus.CounterVec
+}
+
+func NewDiscardedSamplesCounters(reg prometheus.Registerer) *DiscardedSamplesCounters {
+	return &DiscardedSamplesCounters{
+		reg:      reg,
+		counters: map[string]*prometheus.CounterVec{},
+	}
+}
+
+// WithReason returns the counter vector of the samples discarded for the given reason.
+func (c *DiscardedSamplesCounters) WithReason(reason string) *prometheus.CounterVec {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if counter, ok := c.counters[reason]; ok {
+		return counter
+	}
+
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cortex_discarded_samples_total",
+		Help: "The total number of samples that were discarded.",
+		ConstLabels: map[string]string{
+			discardReasonLabel: reason,
+		},
+	}, []string{"user", "group"})
+	if c.reg != nil {
+		if err := c.reg.Register(counter); err != nil {
+			var alreadyRegistered prometheus.AlreadyRegisteredError
+			if !errors.As(err, &alreadyRegistered) {
+				panic(err)
+			}
+			counter = alreadyRegistered.ExistingCollector.(*prometheus.CounterVec)
+		}
+	}
+	c.counters[reason] = counter
+	return counter
+}
+
+// DeletePartialMatch deletes the series matching the filter from the counter vectors of all the reasons.
+func (c *DiscardedSamplesCounters) DeletePartialMatch(filter prometheus.Labels) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for _, counter := range c.counters {
+		counter.DeletePartialMatch(filter)
+	}
+}
@@ -0,0 +1,66 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package validation
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// ExemplarPolicy configures how the exemplars of the series matching a selector are sampled and prioritised at ingestion.
+type ExemplarPolicy struct {
+	Match                 string  `yaml:"match" json:"match" doc:"description=Series selector of the series whose exemplars the policy applies to."`
+	SampleRate            float64 `yaml:"sample_rate,omitempty" json:"sample_rate,omitempty" doc:"description=Fraction of the exemplars of the matching series kept, between 0 and 1. The exemplars are sampled by the hash of their trace_id label, or of all their labels when missing, so that the exemplars of a trace are consistently kept or dropped. The prioritised exemplars aren't sampled. 0 to disable."`
+	KeepMatching          string  `yaml:"keep_matching,omitempty" json:"keep_matching,omitempty" doc:"description=Selector of the labels of the exemplars to prioritise, for example {status=\"error\"}."`
+	KeepValuePercentile   float64 `yaml:"keep_value_percentile,omitempty" json:"keep_value_percentile,omitempty" doc:"description=Percentile, between 0 and 100, of the values of the recent exemplars of the matching series, computed by each distributor, above which the exemplars are prioritised, for example to keep the exemplars of the slowest requests. 0 to disable."`
+	MaxExemplarsPerSecond float64 `yaml:"max_exemplars_per_second,omitempty" json:"max_exemplars_per_second,omitempty" doc:"description=Maximum rate of the exemplars of each metric of the matching series accepted by each distributor, in exemplars per second. The prioritised exemplars aren't limited. 0 to disable."`
+}
+
+// Burst returns the allowed burst of exemplars above the maximum rate.
+func (p ExemplarPolicy) Burst() int {
+	return max(1, int(math.Ceil(p.MaxExemplarsPerSecond)))
+}
+
+func (p ExemplarPolicy) validate() error {
+	if p.Match == "" {
+		return fmt.Errorf("empty match")
+	}
+	if _, err := parser.ParseMetricSelector(p.Match); err != nil {
+		return fmt.Errorf("invalid match %q: %w", p.Match, err)
+	}
+	if p.SampleRate < 0 || p.SampleRate > 1 || math.IsNaN(p.SampleRate) {
+		return fmt.Errorf("invalid sample rate for match %q, the value must be between 0 and 1", p.Match)
+	}
+	if p.KeepMatching != "" {
+		if _, err := parser.ParseMetricSelector(p.KeepMatching); err != nil {
+			return fmt.Errorf("invalid keep_matching %q for match %q: %w", p.KeepMatching, p.Match, err)
+		}
+	}
+	if p.KeepValuePercentile < 0 || p.KeepValuePercentile > 100 || math.IsNaN(p.KeepValuePercentile) {
+		return fmt.Errorf("invalid keep value percentile for match %q, the value must be between 0 and 100", p.Match)
+	}
+	if p.MaxExemplarsPerSecond < 0 || math.IsNaN(p.MaxExemplarsPerSecond) || math.IsInf(p.MaxExemplarsPerSecond, 0) {
+		return fmt.Errorf("invalid max exemplars per second for match %q", p.Match)
+	}
+	return nil
+}
+
+type ExemplarPoliciesConfig []ExemplarPolicy
+
+func (c *ExemplarPoliciesConfig) ExampleDoc() (comment string, yaml interface{}) {
+	return `The following configuration keeps 10% of the exemplars of "http_request_duration_seconds_bucket", except the ones of the failed requests and of the 1% slowest requests, and limits the exemplars of the job "batch" to 10 per second.`,
+		[]ExemplarPolicy{
+			{
+				Match:               `http_request_duration_seconds_bucket`,
+				SampleRate:          0.1,
+				KeepMatching:        `{status="error"}`,
+				KeepValuePercentile: 99,
+			},
+			{
+				Match:                 `{job="batch"}`,
+				MaxExemplarsPerSecond: 10,
+			},
+		}
+}
@@ -0,0 +1,74 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package validation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/grafana/regexp"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	GraphiteMatchTypeGlob  = "glob"
+	GraphiteMatchTypeRegex = "regex"
+)
+
+type GraphiteMappingRule struct {
+	Match     string            `yaml:"match" json:"match" doc:"description=Pattern matched against the Graphite metric path."`
+	MatchType string            `yaml:"match_type,omitempty" json:"match_type,omitempty" doc:"description=How the pattern is matched: glob or regex. In a glob, * matches any part of a single path node. Defaults to glob."`
+	Name      string            `yaml:"name" json:"name" doc:"description=Name of the metric. Can reference the parts matched by the wildcards of a glob, or by the capturing groups of a regex, as $1 or ${1}, $2 or ${2}, and so on. Use the ${1} form when the reference is followed by a letter, a digit, or an underscore."`
+	Labels    map[string]string `yaml:"labels,omitempty" json:"labels,omitempty" doc:"description=Labels added to the metric. The values can reference the matched parts like the name."`
+}
+
+// Regexp returns the anchored regular expression matching the paths of the rule. Each wildcard of a
+// glob pattern is a capturing group.
+func (r GraphiteMappingRule) Regexp() (*regexp.Regexp, error) {
+	switch r.MatchType {
+	case "", GraphiteMatchTypeGlob:
+		parts := strings.Split(r.Match, "*")
+		for i, p := range parts {
+			parts[i] = regexp.QuoteMeta(p)
+		}
+		return regexp.Compile("^" + strings.Join(parts, "([^.]*)") + "$")
+	case GraphiteMatchTypeRegex:
+		return regexp.Compile("^(?:" + r.Match + ")$")
+	default:
+		return nil, fmt.Errorf("unsupported match type %q", r.MatchType)
+	}
+}
+
+func (r GraphiteMappingRule) validate() error {
+	if r.Match == "" {
+		return fmt.Errorf("empty match")
+	}
+	if r.Name == "" {
+		return fmt.Errorf("empty name for match %q", r.Match)
+	}
+	if _, err := r.Regexp(); err != nil {
+		return fmt.Errorf("invalid match %q: %w", r.Match, err)
+	}
+	for name := range r.Labels {
+		if !model.LabelName(name).IsValid() || name == model.MetricNameLabel {
+			return fmt.Errorf("invalid label name %q for match %q", name, r.Match)
+		}
+	}
+	return nil
+}
+
+type GraphiteMappingRulesConfig []GraphiteMappingRule
+
+func (c *GraphiteMappingRulesConfig) ExampleDoc() (comment string, yaml interface{}) {
+	return `The following configuration maps "servers.web-1.cpu.user" to the metric "server_cpu" with the labels host="web-1" and mode="user".`,
+		[]GraphiteMappingRule{
+			{
+				Match: "servers.*.cpu.*",
+				Name:  "server_cpu",
+				Labels: map[string]string{
+					"host": "$1",
+					"mode": "$2",
+				},
+			},
+		}
+}
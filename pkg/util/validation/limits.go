@@ -42,11 +42,15 @@ const (
 	MaxChunkBytesPerQueryFlag                 = "querier.max-fetched-chunk-bytes-per-query"
 	MaxSeriesPerQueryFlag                     = "querier.max-fetched-series-per-query"
 	MaxEstimatedChunksPerQueryMultiplierFlag  = "querier.max-estimated-fetched-chunks-per-query-multiplier"
+	StoreGatewayHedgingPercentileFlag         = "querier.store-gateway-hedging-percentile"
 	MaxEstimatedMemoryConsumptionPerQueryFlag = "querier.max-estimated-memory-consumption-per-query"
 	MaxLabelNamesPerSeriesFlag                = "validation.max-label-names-per-series"
 	MaxLabelNamesPerInfoSeriesFlag            = "validation.max-label-names-per-info-series"
 	MaxLabelNameLengthFlag                    = "validation.max-length-label-name"
 	MaxLabelValueLengthFlag                   = "validation.max-length-label-value"
+	LabelNameTooLongStrategyFlag              = "validation.label-name-too-long-strategy"
+	LabelValueTooLongStrategyFlag             = "validation.label-value-too-long-strategy"
+	MetricSchemaViolationStrategyFlag         = "validation.metric-schema-violation-strategy"
 	MaxMetadataLengthFlag                     = "validation.max-metadata-length"
 	maxNativeHistogramBucketsFlag             = "validation.max-native-histogram-buckets"
 	ReduceNativeHistogramOverMaxBucketsFlag   = "validation.reduce-native-histogram-over-max-buckets"
@@ -62,6 +66,7 @@ const (
 	IngestionBurstSizeFlag                    = "distributor.ingestion-burst-size"
 	IngestionBurstFactorFlag                  = "distributor.ingestion-burst-factor"
 	HATrackerMaxClustersFlag                  = "distributor.ha-tracker.max-clusters"
+	HATrackerClusterLabelsFlag                = "distributor.ha-tracker.cluster-labels"
 	resultsCacheTTLFlag                       = "query-frontend.results-cache-ttl"
 	resultsCacheTTLForOutOfOrderWindowFlag    = "query-frontend.results-cache-ttl-for-out-of-order-time-window"
 	alignQueriesWithStepFlag                  = "query-frontend.align-queries-with-step"
@@ -69,14 +74,28 @@ const (
 	AlertmanagerMaxGrafanaConfigSizeFlag      = "alertmanager.max-grafana-config-size-bytes"
 	AlertmanagerMaxGrafanaStateSizeFlag       = "alertmanager.max-grafana-state-size-bytes"
 
+	// LabelTooLongStrategyError rejects the series with a label name or value longer than the maximum length.
+	LabelTooLongStrategyError = "error"
+	// LabelTooLongStrategyTruncate truncates the label names or values longer than the maximum length.
+	LabelTooLongStrategyTruncate = "truncate"
+
 	// MinCompactorPartialBlockDeletionDelay is the minimum partial blocks deletion delay that can be configured in Mimir.
 	MinCompactorPartialBlockDeletionDelay = 4 * time.Hour
 )
 
+// LabelTooLongStrategies are the supported strategies applied to the series with a label name or value longer than the maximum length.
+var LabelTooLongStrategies = []string{LabelTooLongStrategyError, LabelTooLongStrategyTruncate}
+
 var (
 	errInvalidIngestStorageReadConsistency         = fmt.Errorf("invalid ingest storage read consistency (supported values: %s)", strings.Join(api.ReadConsistencies, ", "))
 	errInvalidMaxEstimatedChunksPerQueryMultiplier = errors.New("invalid value for -" + MaxEstimatedChunksPerQueryMultiplierFlag + ": must be 0 or greater than or equal to 1")
+	errInvalidStoreGatewayHedgingPercentile        = errors.New("invalid value for -" + StoreGatewayHedgingPercentileFlag + ": must be between 0 and 100")
 	errNegativeUpdateTimeoutJitterMax              = errors.New("HA tracker max update timeout jitter shouldn't be negative")
+	errExternalRemoteReadAuthConflict              = errors.New("-querier.external-remote-read-basic-auth-username and -querier.external-remote-read-bearer-token can't be set at the same time")
+	errOTelDeltaIngestionConflict                  = errors.New("-distributor.otel-native-delta-ingestion and -distributor.otel-convert-delta-to-cumulative can't be enabled at the same time")
+	errInvalidLabelNameTooLongStrategy             = fmt.Errorf("invalid value for -%s (supported values: %s)", LabelNameTooLongStrategyFlag, strings.Join(LabelTooLongStrategies, ", "))
+	errInvalidLabelValueTooLongStrategy            = fmt.Errorf("invalid value for -%s (supported values: %s)", LabelValueTooLongStrategyFlag, strings.Join(LabelTooLongStrategies, ", "))
+	errInvalidMetricSchemaViolationStrategy        = fmt.Errorf("invalid value for -%s (supported values: %s)", MetricSchemaViolationStrategyFlag, strings.Join(MetricSchemaViolationStrategies, ", "))
 )
 
 const errInvalidFailoverTimeout = "HA Tracker failover timeout (%v) must be at least 1s greater than update timeout - max jitter (%v)"
@@ -119,6 +138,8 @@ type Limits struct {
 	HAClusterLabel       string  `yaml:"ha_cluster_label" json:"ha_cluster_label"`
 	HAReplicaLabel       string  `yaml:"ha_replica_label" json:"ha_replica_label"`
 	HAMaxClusters        int     `yaml:"ha_max_clusters" json:"ha_max_clusters"`
+
+	HAClusterLabels flagext.StringSliceCSV `yaml:"ha_cluster_labels" json:"ha_cluster_labels" category:"experimental"`
 	// We should only update the timestamp if the difference
 	// between the stored timestamp and the time we received a sample at
 	// is more than this duration.
@@ -132,6 +153,10 @@ type Limits struct {
 	DropLabels                                  flagext.StringSlice `yaml:"drop_labels" json:"drop_labels" category:"advanced"`
 	MaxLabelNameLength                          int                 `yaml:"max_label_name_length" json:"max_label_name_length"`
 	MaxLabelValueLength                         int                 `yaml:"max_label_value_length" json:"max_label_value_length"`
+	LabelNameTooLongStrategy                    string              `yaml:"label_name_too_long_strategy" json:"label_name_too_long_strategy" category:"experimental"`
+	LabelValueTooLongStrategy                   string              `yaml:"label_value_too_long_strategy" json:"label_value_too_long_strategy" category:"experimental"`
+	MetricSchemas                               MetricSchemasConfig `yaml:"metric_schemas,omitempty" json:"metric_schemas,omitempty" doc:"nocli|description=List of the metrics accepted for the tenant, with their allowed label names and optionally their expected type. If not empty, the series not conforming to the metric schemas are handled according to -validation.metric-schema-violation-strategy." category:"experimental"`
+	MetricSchemaViolationStrategy               string              `yaml:"metric_schema_violation_strategy" json:"metric_schema_violation_strategy" category:"experimental"`
 	MaxLabelNamesPerSeries                      int                 `yaml:"max_label_names_per_series" json:"max_label_names_per_series"`
 	MaxLabelNamesPerInfoSeries                  int                 `yaml:"max_label_names_per_info_series" json:"max_label_names_per_info_series"`
 	MaxMetadataLength                           int                 `yaml:"max_metadata_length" json:"max_metadata_length"`
@@ -154,8 +179,9 @@ type Limits struct {
 
 	// Ingester enforced limits.
 	// Series
-	MaxGlobalSeriesPerUser   int `yaml:"max_global_series_per_user" json:"max_global_series_per_user"`
-	MaxGlobalSeriesPerMetric int `yaml:"max_global_series_per_metric" json:"max_global_series_per_metric"`
+	MaxGlobalSeriesPerUser   int                `yaml:"max_global_series_per_user" json:"max_global_series_per_user"`
+	MaxGlobalSeriesPerMetric int                `yaml:"max_global_series_per_metric" json:"max_global_series_per_metric"`
+	MetricLimits             MetricLimitsConfig `yaml:"metric_limits,omitempty" json:"metric_limits,omitempty" doc:"nocli|description=List of limits on the ingestion rate and on the number of series of the series matching a selector, such as a metric name. The first matching limit is applied to a series. The ingestion rate limit is enforced by the distributors, and the series limit by the ingesters." category:"experimental"`
 	// Metadata
 	MaxGlobalMetricsWithMetadataPerUser int `yaml:"max_global_metadata_per_user" json:"max_global_metadata_per_user"`
 	MaxGlobalMetadataPerMetric          int `yaml:"max_global_metadata_per_metric" json:"max_global_metadata_per_metric"`
@@ -195,6 +221,12 @@ type Limits struct {
 	QueryShardingMaxRegexpSizeBytes       int            `yaml:"query_sharding_max_regexp_size_bytes" json:"query_sharding_max_regexp_size_bytes"`
 	SplitInstantQueriesByInterval         model.Duration `yaml:"split_instant_queries_by_interval" json:"split_instant_queries_by_interval" category:"experimental"`
 	QueryIngestersWithin                  model.Duration `yaml:"query_ingesters_within" json:"query_ingesters_within" category:"advanced"`
+	ExternalRemoteReadURL                 string         `yaml:"external_remote_read_url" json:"external_remote_read_url" category:"experimental"`
+	ExternalRemoteReadQueryAfter          model.Duration `yaml:"external_remote_read_query_after" json:"external_remote_read_query_after" category:"experimental"`
+	ExternalRemoteReadBasicAuthUsername   string         `yaml:"external_remote_read_basic_auth_username" json:"external_remote_read_basic_auth_username" category:"experimental"`
+	ExternalRemoteReadBasicAuthPassword   flagext.Secret `yaml:"external_remote_read_basic_auth_password" json:"external_remote_read_basic_auth_password" category:"experimental"`
+	ExternalRemoteReadBearerToken         flagext.Secret `yaml:"external_remote_read_bearer_token" json:"external_remote_read_bearer_token" category:"experimental"`
+	StoreGatewayHedgingPercentile         float64        `yaml:"store_gateway_hedging_percentile" json:"store_gateway_hedging_percentile" category:"experimental"`
 
 	// Query-frontend limits.
 	MaxTotalQueryLength                    model.Duration         `yaml:"max_total_query_length" json:"max_total_query_length"`
@@ -227,6 +259,9 @@ type Limits struct {
 	MaxCostAttributionCardinality   int                          `yaml:"max_cost_attribution_cardinality" json:"max_cost_attribution_cardinality" category:"experimental"`
 	CostAttributionCooldown         model.Duration               `yaml:"cost_attribution_cooldown" json:"cost_attribution_cooldown" category:"experimental"`
 
+	// Query cost attribution.
+	CostAttributionQueryLabels []costattributionmodel.QueryLabel `yaml:"cost_attribution_query_labels,omitempty" json:"cost_attribution_query_labels,omitempty" doc:"nocli|description=Labels the costs of the queries, such as the fetched series and the samples processed, are attributed to by the query-frontend. The value of each output label is taken either from the given request header, or from the equality matchers of the query for the given label name. Requires -query-frontend.query-stats-enabled. The costs reported by the queriers are attributed by the query-frontend, so the queries sent to the queriers directly, bypassing the query-frontend, aren't attributed. The queries of several tenants aren't attributed." category:"experimental"`
+
 	// Ruler defaults and limits.
 	RulerEvaluationDelay                                  model.Duration                    `yaml:"ruler_evaluation_delay_duration" json:"ruler_evaluation_delay_duration"`
 	RulerTenantShardSize                                  int                               `yaml:"ruler_tenant_shard_size" json:"ruler_tenant_shard_size"`
@@ -286,6 +321,9 @@ type Limits struct {
 	AlertmanagerNotifyHookReceivers            flagext.StringSliceCSV `yaml:"alertmanager_notify_hook_receivers" json:"alertmanager_notify_hook_receivers"`
 	AlertmanagerNotifyHookTimeout              model.Duration         `yaml:"alertmanager_notify_hook_timeout" json:"alertmanager_notify_hook_timeout"`
 
+	// Prometheus remote write
+	RemoteWriteConvertClassicHistogramsToNHCB bool `yaml:"remote_write_convert_classic_histograms_to_nhcb" json:"remote_write_convert_classic_histograms_to_nhcb" category:"experimental"`
+
 	// OpenTelemetry
 	OTelMetricSuffixesEnabled                bool                   `yaml:"otel_metric_suffixes_enabled" json:"otel_metric_suffixes_enabled" category:"advanced"`
 	OTelCreatedTimestampZeroIngestionEnabled bool                   `yaml:"otel_created_timestamp_zero_ingestion_enabled" json:"otel_created_timestamp_zero_ingestion_enabled" category:"experimental"`
@@ -294,6 +332,27 @@ type Limits struct {
 	OTelConvertHistogramsToNHCB              bool                   `yaml:"otel_convert_histograms_to_nhcb" json:"otel_convert_histograms_to_nhcb" category:"experimental"`
 	OTelPromoteScopeMetadata                 bool                   `yaml:"otel_promote_scope_metadata" json:"otel_promote_scope_metadata" category:"experimental"`
 	OTelNativeDeltaIngestion                 bool                   `yaml:"otel_native_delta_ingestion" json:"otel_native_delta_ingestion" category:"experimental"`
+	OTelConvertDeltaToCumulative             bool                   `yaml:"otel_convert_delta_to_cumulative" json:"otel_convert_delta_to_cumulative" category:"experimental"`
+
+	// Influx
+	InfluxBucketLabel string `yaml:"influx_bucket_label" json:"influx_bucket_label" category:"experimental"`
+	InfluxOrgLabel    string `yaml:"influx_org_label" json:"influx_org_label" category:"experimental"`
+
+	// Graphite
+	GraphiteMappingRules GraphiteMappingRulesConfig `yaml:"graphite_mapping_rules,omitempty" json:"graphite_mapping_rules,omitempty" doc:"nocli|description=List of rules mapping the dotted paths of the metrics received on the Graphite endpoint to metric names and labels. The first matching rule is applied. Metrics without tags not matching any rule are discarded." category:"experimental"`
+
+	// Streaming aggregation
+	StreamingAggregationRules           StreamingAggregationRulesConfig `yaml:"streaming_aggregation_rules,omitempty" json:"streaming_aggregation_rules,omitempty" doc:"nocli|description=List of rules aggregating the matching series at ingestion into output series, emitted at the interval configured with -distributor.streaming-aggregation.interval. Requires -distributor.streaming-aggregation.enabled." category:"experimental"`
+	StreamingAggregationMaxOutputSeries int                             `yaml:"streaming_aggregation_max_output_series" json:"streaming_aggregation_max_output_series" category:"experimental"`
+
+	// Remote write forwarding
+	RemoteWriteForwardingRules RemoteWriteForwardingRulesConfig `yaml:"remote_write_forwarding_rules,omitempty" json:"remote_write_forwarding_rules,omitempty" doc:"nocli|description=List of rules forwarding the matching series to remote write endpoints, asynchronously, once they have been successfully ingested. A series matching several rules is forwarded to each of their endpoints. Requires -distributor.remote-write-forwarding.enabled." category:"experimental"`
+
+	// Exemplar policies
+	ExemplarPolicies ExemplarPoliciesConfig `yaml:"exemplar_policies,omitempty" json:"exemplar_policies,omitempty" doc:"nocli|description=List of policies sampling and prioritising the exemplars of the series matching a selector, such as a metric name. The first matching policy is applied to a series. The prioritised exemplars are kept first when the exemplars of a series exceed -distributor.max-exemplars-per-series-per-request." category:"experimental"`
+
+	// Disk buffer
+	DiskBufferMaxSizeBytes int64 `yaml:"disk_buffer_max_size_bytes" json:"disk_buffer_max_size_bytes" category:"experimental"`
 
 	// Ingest storage.
 	IngestStorageReadConsistency       string `yaml:"ingest_storage_read_consistency" json:"ingest_storage_read_consistency" category:"experimental"`
@@ -313,6 +372,7 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 	f.BoolVar(&l.AcceptHASamples, "distributor.ha-tracker.enable-for-all-users", false, "Flag to enable, for all tenants, handling of samples with external labels identifying replicas in an HA Prometheus setup.")
 	f.StringVar(&l.HAClusterLabel, "distributor.ha-tracker.cluster", "cluster", "Prometheus label to look for in samples to identify a Prometheus HA cluster.")
 	f.StringVar(&l.HAReplicaLabel, "distributor.ha-tracker.replica", "__replica__", "Prometheus label to look for in samples to identify a Prometheus HA replica.")
+	f.Var(&l.HAClusterLabels, HATrackerClusterLabelsFlag, "Comma-separated list of labels identifying an HA group, used instead of -distributor.ha-tracker.cluster when set. The replicas are deduplicated per set of values of all the labels, for example per cluster and job. The samples missing any of the labels are accepted without deduplication. On the OTLP endpoint, the resource attributes translated to these labels or to the replica label are promoted to labels.")
 	l.HATrackerUpdateTimeout = model.Duration(15 * time.Second)
 	f.Var(&l.HATrackerUpdateTimeout, "distributor.ha-tracker.update-timeout", "Update the timestamp in the KV store for a given cluster/replica only after this amount of time has passed since the current stored timestamp.")
 	l.HATrackerUpdateTimeoutJitterMax = model.Duration(5 * time.Second)
@@ -323,6 +383,9 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 	f.Var(&l.DropLabels, "distributor.drop-label", "This flag can be used to specify label names that to drop during sample ingestion within the distributor and can be repeated in order to drop multiple labels.")
 	f.IntVar(&l.MaxLabelNameLength, MaxLabelNameLengthFlag, 1024, "Maximum length accepted for label names")
 	f.IntVar(&l.MaxLabelValueLength, MaxLabelValueLengthFlag, 2048, "Maximum length accepted for label value. This setting also applies to the metric name")
+	f.StringVar(&l.LabelNameTooLongStrategy, LabelNameTooLongStrategyFlag, LabelTooLongStrategyError, fmt.Sprintf("Strategy applied to the series with a label name longer than -%s. Supported values: %s. %q rejects the series, %q truncates the label name to the maximum length, replacing its end with a hash of the full label name.", MaxLabelNameLengthFlag, strings.Join(LabelTooLongStrategies, ", "), LabelTooLongStrategyError, LabelTooLongStrategyTruncate))
+	f.StringVar(&l.LabelValueTooLongStrategy, LabelValueTooLongStrategyFlag, LabelTooLongStrategyError, fmt.Sprintf("Strategy applied to the series with a label value longer than -%s. Supported values: %s. %q rejects the series, %q truncates the label value to the maximum length, replacing its end with a hash of the full label value. The metric name is never truncated.", MaxLabelValueLengthFlag, strings.Join(LabelTooLongStrategies, ", "), LabelTooLongStrategyError, LabelTooLongStrategyTruncate))
+	f.StringVar(&l.MetricSchemaViolationStrategy, MetricSchemaViolationStrategyFlag, MetricSchemaViolationStrategyReject, fmt.Sprintf("Strategy applied to the series not conforming to the metric schemas of the tenant. Supported values: %s. %q drops the series and fails the request with a partial error, %q silently drops the series. The dropped samples are counted as discarded in both cases.", strings.Join(MetricSchemaViolationStrategies, ", "), MetricSchemaViolationStrategyReject, MetricSchemaViolationStrategyDrop))
 	f.IntVar(&l.MaxLabelNamesPerSeries, MaxLabelNamesPerSeriesFlag, 30, "Maximum number of label names per series.")
 	f.IntVar(&l.MaxLabelNamesPerInfoSeries, MaxLabelNamesPerInfoSeriesFlag, 80, "Maximum number of label names per info series. Has no effect if less than the value of the maximum number of label names per series option (-"+MaxLabelNamesPerSeriesFlag+")")
 	f.IntVar(&l.MaxMetadataLength, MaxMetadataLengthFlag, 1024, "Maximum length accepted for metric metadata. Metadata refers to Metric Name, HELP and UNIT. Longer metadata is dropped except for HELP which is truncated.")
@@ -335,6 +398,7 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 	f.BoolVar(&l.EnforceMetadataMetricName, "validation.enforce-metadata-metric-name", true, "Enforce every metadata has a metric name.")
 	f.BoolVar(&l.MetricRelabelingEnabled, "distributor.metric-relabeling-enabled", true, "Enable metric relabeling for the tenant. This configuration option can be used to forcefully disable metric relabeling on a per-tenant basis.")
 	f.BoolVar(&l.ServiceOverloadStatusCodeOnRateLimitEnabled, "distributor.service-overload-status-code-on-rate-limit-enabled", false, "If enabled, rate limit errors will be reported to the client with HTTP status code 529 (Service is overloaded). If disabled, status code 429 (Too Many Requests) is used. Enabling -distributor.retry-after-header.enabled before utilizing this option is strongly recommended as it helps prevent premature request retries by the client.")
+	f.BoolVar(&l.RemoteWriteConvertClassicHistogramsToNHCB, "distributor.remote-write-convert-classic-histograms-to-nhcb", false, "Whether to convert the classic histograms received through Prometheus remote write into native histograms with custom buckets. The _bucket, _sum and _count series of a histogram are grouped within each request, using the metric metadata when available or the naming otherwise. The classic histograms whose series are incomplete in a request are ingested unchanged.")
 	f.BoolVar(&l.OTelMetricSuffixesEnabled, "distributor.otel-metric-suffixes-enabled", false, "Whether to enable automatic suffixes to names of metrics ingested through OTLP.")
 	f.BoolVar(&l.OTelCreatedTimestampZeroIngestionEnabled, "distributor.otel-created-timestamp-zero-ingestion-enabled", false, "Whether to enable translation of OTel start timestamps to Prometheus zero samples in the OTLP endpoint.")
 	f.Var(&l.PromoteOTelResourceAttributes, "distributor.otel-promote-resource-attributes", "Optionally specify OTel resource attributes to promote to labels.")
@@ -342,6 +406,10 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 	f.BoolVar(&l.OTelConvertHistogramsToNHCB, "distributor.otel-convert-histograms-to-nhcb", false, "Whether to convert OTel explicit histograms into native histograms with custom buckets.")
 	f.BoolVar(&l.OTelPromoteScopeMetadata, "distributor.otel-promote-scope-metadata", false, "Whether to promote OTel scope metadata (scope name, version, schema URL, attributes) to corresponding metric labels, prefixed with otel_scope_.")
 	f.BoolVar(&l.OTelNativeDeltaIngestion, "distributor.otel-native-delta-ingestion", false, "Whether to enable native ingestion of delta OTLP metrics, which will store the raw delta sample values without conversion. If disabled, delta metrics will be rejected. Delta support is in an early stage of development. The ingestion and querying process is likely to change over time.")
+	f.BoolVar(&l.OTelConvertDeltaToCumulative, "distributor.otel-convert-delta-to-cumulative", false, "Whether to convert delta OTLP sums and exponential histograms into cumulative ones, by accumulating the data points of each stream in the distributor. Each stream is owned by one of the healthy distributors in the ring, which keeps its running total in memory, and the data points received by the other distributors are forwarded to it before the request is ingested. A data point starting after the last one of its stream resets the running total. The running totals are only updated once a request has been successfully ingested, so that retried requests are not accumulated twice. This option can't be enabled together with -distributor.otel-native-delta-ingestion.")
+	f.StringVar(&l.InfluxBucketLabel, "distributor.influx-bucket-label", "bucket", "Name of the label set to the bucket of the requests received on the InfluxDB v2 write API. If empty, the bucket isn't added to the series.")
+	f.StringVar(&l.InfluxOrgLabel, "distributor.influx-org-label", "", "Name of the label set to the organization of the requests received on the InfluxDB v2 write API. If empty, the organization isn't added to the series.")
+	f.IntVar(&l.StreamingAggregationMaxOutputSeries, "distributor.streaming-aggregation-max-output-series", 0, "Maximum number of output series of the streaming aggregation whose state is kept by each distributor for the tenant. The samples of the input series which would create a new output series above the limit aren't aggregated. 0 to disable.")
 
 	f.Var(&l.IngestionArtificialDelay, "distributor.ingestion-artificial-delay", "Target ingestion delay to apply to all tenants. If set to a non-zero value, the distributor will artificially delay ingestion time-frame by the specified duration by computing the difference between actual ingestion and the target. There is no delay on actual ingestion of samples, it is only the response back to the client.")
 	f.IntVar(&l.IngestionArtificialDelayConditionForTenantsWithLessThanMaxSeries, "distributor.ingestion-artificial-delay-condition-for-tenants-with-less-than-max-series", 0, "Condition to select tenants for which -distributor.ingestion-artificial-delay-duration-for-tenants-with-less-than-max-series should be applied.")
@@ -369,7 +437,7 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 	f.IntVar(&l.MaxChunksPerQuery, MaxChunksPerQueryFlag, 2e6, "Maximum number of chunks that can be fetched in a single query from ingesters and store-gateways. This limit is enforced in the querier, ruler and store-gateway. 0 to disable.")
 	f.Float64Var(&l.MaxEstimatedChunksPerQueryMultiplier, MaxEstimatedChunksPerQueryMultiplierFlag, 0, "Maximum number of chunks estimated to be fetched in a single query from ingesters and store-gateways, as a multiple of -"+MaxChunksPerQueryFlag+". This limit is enforced in the querier. Must be greater than or equal to 1, or 0 to disable.")
 	f.IntVar(&l.MaxFetchedSeriesPerQuery, MaxSeriesPerQueryFlag, 0, "The maximum number of unique series for which a query can fetch samples from ingesters and store-gateways. This limit is enforced in the querier, ruler and store-gateway. 0 to disable")
-	f.IntVar(&l.MaxFetchedChunkBytesPerQuery, MaxChunkBytesPerQueryFlag, 0, "The maximum size of all chunks in bytes that a query can fetch from ingesters and store-gateways. This limit is enforced in the querier and ruler. 0 to disable.")
+	f.IntVar(&l.MaxFetchedChunkBytesPerQuery, MaxChunkBytesPerQueryFlag, 0, "The maximum size of all chunks in bytes that a query can fetch from ingesters, store-gateways, and the external remote read endpoint. This limit is enforced in the querier and ruler. 0 to disable.")
 	f.Uint64Var(&l.MaxEstimatedMemoryConsumptionPerQuery, MaxEstimatedMemoryConsumptionPerQueryFlag, 0, "The maximum estimated memory a single query can consume at once, in bytes. This limit is only enforced when Mimir's query engine is in use. This limit is enforced in the querier. 0 to disable.")
 	f.Var(&l.MaxPartialQueryLength, MaxPartialQueryLengthFlag, "Limit the time range for partial queries at the querier level.")
 	f.Var(&l.MaxQueryLookback, "querier.max-query-lookback", "Limit how long back data (series and metadata) can be queried, up until <lookback> duration ago. This limit is enforced in the query-frontend, querier and ruler for instant, range and remote read queries. For metadata queries like series, label names, label values queries the limit is enforced in the querier and ruler. If the requested time range is outside the allowed range, the request will not fail but will be manipulated to only query data within the allowed time range. 0 to disable.")
@@ -392,6 +460,12 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 	f.Var(&l.SplitInstantQueriesByInterval, "query-frontend.split-instant-queries-by-interval", "Split instant queries by an interval and execute in parallel. 0 to disable it.")
 	_ = l.QueryIngestersWithin.Set("13h")
 	f.Var(&l.QueryIngestersWithin, QueryIngestersWithinFlag, "Maximum lookback beyond which queries are not sent to ingester. 0 means all queries are sent to ingester.")
+	f.StringVar(&l.ExternalRemoteReadURL, "querier.external-remote-read-url", "", "URL of an external Prometheus-compatible remote read endpoint, queried in addition to Mimir storage. The series returned by the external endpoint are merged and deduplicated with the series stored in Mimir. Empty to disable.")
+	f.Var(&l.ExternalRemoteReadQueryAfter, "querier.external-remote-read-query-after", "The time after which a metric should be queried from the external remote read endpoint. 0 means all queries are sent to the external remote read endpoint.")
+	f.StringVar(&l.ExternalRemoteReadBasicAuthUsername, "querier.external-remote-read-basic-auth-username", "", "Username used for the basic authentication to the external remote read endpoint.")
+	f.Var(&l.ExternalRemoteReadBasicAuthPassword, "querier.external-remote-read-basic-auth-password", "Password used for the basic authentication to the external remote read endpoint.")
+	f.Var(&l.ExternalRemoteReadBearerToken, "querier.external-remote-read-bearer-token", "Bearer token used to authenticate to the external remote read endpoint. Can't be set together with the basic authentication.")
+	f.Float64Var(&l.StoreGatewayHedgingPercentile, StoreGatewayHedgingPercentileFlag, 0, "Percentile of the recently observed store-gateway response latencies after which a hedged series request is sent to another store-gateway holding the same blocks. The first store-gateway to respond is used. Must be between 0 and 100, 0 to disable hedging.")
 
 	_ = l.RulerEvaluationDelay.Set("1m")
 	f.Var(&l.RulerEvaluationDelay, "ruler.evaluation-delay-duration", "Duration to delay the evaluation of rules to ensure the underlying metrics have been pushed.")
@@ -484,6 +558,7 @@ func (l *Limits) RegisterFlags(f *flag.FlagSet) {
 	f.Var(&l.AlertmanagerNotifyHookTimeout, "alertmanager.notify-hook-timeout", "Maximum amount of time to wait for a hook to complete before timing out. 0 = no timeout.")
 
 	// Ingest storage.
+	f.Int64Var(&l.DiskBufferMaxSizeBytes, "distributor.disk-buffer.max-tenant-size-bytes", 0, "Maximum size of the write requests buffered on disk for the tenant while the ingesters are unavailable. The write requests exceeding it fail. 0 means the tenant is only limited by -distributor.disk-buffer.max-size-bytes. Requires -distributor.disk-buffer.enabled.")
 	f.StringVar(&l.IngestStorageReadConsistency, "ingest-storage.read-consistency", api.ReadConsistencyEventual, fmt.Sprintf("The default consistency level to enforce for queries when using the ingest storage. Supports values: %s.", strings.Join(api.ReadConsistencies, ", ")))
 	f.IntVar(&l.IngestionPartitionsTenantShardSize, "ingest-storage.ingestion-partition-tenant-shard-size", 0, "The number of partitions a tenant's data should be sharded to when using the ingest storage. Tenants are sharded across partitions using shuffle-sharding. 0 disables shuffle sharding and tenant is sharded across all partitions.")
 
@@ -512,15 +587,7 @@ func (l *Limits) UnmarshalJSON(data []byte) error {
 func (l *Limits) unmarshal(decode func(any) error) error {
 	// We want to set l to the defaults and then overwrite it with the input.
 	if defaultLimits != nil {
-		*l = *defaultLimits
-
-		// Make copy of default limits, otherwise unmarshalling would modify map in default limits.
-		l.NotificationRateLimitPerIntegration = defaultLimits.NotificationRateLimitPerIntegration.Clone()
-		l.RulerMaxRulesPerRuleGroupByNamespace = defaultLimits.RulerMaxRulesPerRuleGroupByNamespace.Clone()
-		l.RulerMaxRuleGroupsPerTenantByNamespace = defaultLimits.RulerMaxRuleGroupsPerTenantByNamespace.Clone()
-
-		// Reset the merged custom active series trackers config, to not interfere with the default limits.
-		l.activeSeriesMergedCustomTrackersConfig = atomic.NewPointer[asmodel.CustomTrackersConfig](nil)
+		l.copyFrom(defaultLimits)
 	}
 
 	// Decode into a reflection-crafted struct that has fields for the extensions.
@@ -539,6 +606,44 @@ func (l *Limits) unmarshal(decode func(any) error) error {
 	return nil
 }
 
+// ApplyJSON returns a copy of l with the limits of the JSON object data set on top of it. Unlike UnmarshalJSON,
+// the limits which aren't set in data keep their value of l, instead of getting the default one. l isn't modified.
+func (l *Limits) ApplyJSON(data []byte) (*Limits, error) {
+	out := &Limits{}
+	out.copyFrom(l)
+
+	// Decode into a reflection-crafted struct that has fields for the extensions, which keep their value of l.
+	cfg, getExtensions := newLimitsWithExtensions((*plainLimits)(out))
+	for name, val := range l.extensions {
+		reflect.ValueOf(cfg).Elem().Field(registeredExtensions[name].index).Set(reflect.ValueOf(val))
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return nil, err
+	}
+	out.extensions = getExtensions()
+
+	if err := out.validate(); err != nil {
+		return nil, err
+	}
+	out.canonicalizeQueries()
+	return out, nil
+}
+
+// copyFrom sets l to a copy of other, which can be modified without modifying other.
+func (l *Limits) copyFrom(other *Limits) {
+	*l = *other
+
+	// Make copy of the maps, otherwise unmarshalling would modify the maps of other.
+	l.NotificationRateLimitPerIntegration = other.NotificationRateLimitPerIntegration.Clone()
+	l.RulerMaxRulesPerRuleGroupByNamespace = other.RulerMaxRulesPerRuleGroupByNamespace.Clone()
+	l.RulerMaxRuleGroupsPerTenantByNamespace = other.RulerMaxRuleGroupsPerTenantByNamespace.Clone()
+
+	// Reset the merged custom active series trackers config, to not interfere with other.
+	l.activeSeriesMergedCustomTrackersConfig = atomic.NewPointer[asmodel.CustomTrackersConfig](nil)
+}
+
 // RegisterExtensionsDefaults registers the default values for extensions into l.
 // This is especially handy for those downstream projects that wish to have control
 // over the exact moment in which the registration happens (e.g. during service
@@ -567,6 +672,68 @@ func (l *Limits) validate() error {
 		return errInvalidMaxEstimatedChunksPerQueryMultiplier
 	}
 
+	if l.StoreGatewayHedgingPercentile < 0 || l.StoreGatewayHedgingPercentile > 100 {
+		return errInvalidStoreGatewayHedgingPercentile
+	}
+
+	if l.OTelNativeDeltaIngestion && l.OTelConvertDeltaToCumulative {
+		return errOTelDeltaIngestionConflict
+	}
+
+	if l.ExternalRemoteReadBasicAuthUsername != "" && l.ExternalRemoteReadBearerToken.String() != "" {
+		return errExternalRemoteReadAuthConflict
+	}
+
+	if !util.StringsContain(LabelTooLongStrategies, l.LabelNameTooLongStrategy) {
+		return errInvalidLabelNameTooLongStrategy
+	}
+
+	if !util.StringsContain(LabelTooLongStrategies, l.LabelValueTooLongStrategy) {
+		return errInvalidLabelValueTooLongStrategy
+	}
+
+	if err := l.MetricSchemas.validate(); err != nil {
+		return fmt.Errorf("invalid metric_schemas: %w", err)
+	}
+
+	if !util.StringsContain(MetricSchemaViolationStrategies, l.MetricSchemaViolationStrategy) {
+		return errInvalidMetricSchemaViolationStrategy
+	}
+
+	if err := costattributionmodel.ValidateQueryLabels(l.CostAttributionQueryLabels); err != nil {
+		return fmt.Errorf("invalid cost_attribution_query_labels: %w", err)
+	}
+
+	for _, policy := range l.ExemplarPolicies {
+		if err := policy.validate(); err != nil {
+			return fmt.Errorf("invalid exemplar_policies: %w", err)
+		}
+	}
+
+	for _, limit := range l.MetricLimits {
+		if err := limit.validate(); err != nil {
+			return fmt.Errorf("invalid metric_limits: %w", err)
+		}
+	}
+
+	for _, rule := range l.GraphiteMappingRules {
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("invalid graphite_mapping_rules: %w", err)
+		}
+	}
+
+	for _, rule := range l.StreamingAggregationRules {
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("invalid streaming_aggregation_rules: %w", err)
+		}
+	}
+
+	for _, rule := range l.RemoteWriteForwardingRules {
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("invalid remote_write_forwarding_rules: %w", err)
+		}
+	}
+
 	if !util.StringsContain(api.ReadConsistencies, l.IngestStorageReadConsistency) {
 		return errInvalidIngestStorageReadConsistency
 	}
@@ -575,6 +742,10 @@ func (l *Limits) validate() error {
 		return errNegativeUpdateTimeoutJitterMax
 	}
 
+	if err := l.validateHAClusterLabels(); err != nil {
+		return err
+	}
+
 	if l.HATrackerUpdateTimeout > 0 || l.HATrackerFailoverTimeout > 0 {
 		minFailureTimeout := l.HATrackerUpdateTimeout + l.HATrackerUpdateTimeoutJitterMax + model.Duration(time.Second)
 		if l.HATrackerFailoverTimeout < minFailureTimeout {
@@ -585,6 +756,23 @@ func (l *Limits) validate() error {
 	return nil
 }
 
+func (l *Limits) validateHAClusterLabels() error {
+	seen := make(map[string]struct{}, len(l.HAClusterLabels))
+	for _, name := range l.HAClusterLabels {
+		if !model.LabelName(name).IsValid() || name == model.MetricNameLabel {
+			return fmt.Errorf("invalid value for -%s: invalid label name %q", HATrackerClusterLabelsFlag, name)
+		}
+		if name == l.HAReplicaLabel {
+			return fmt.Errorf("invalid value for -%s: the replica label %q can't identify an HA group", HATrackerClusterLabelsFlag, name)
+		}
+		if _, ok := seen[name]; ok {
+			return fmt.Errorf("invalid value for -%s: duplicate label name %q", HATrackerClusterLabelsFlag, name)
+		}
+		seen[name] = struct{}{}
+	}
+	return nil
+}
+
 func (l *Limits) canonicalizeQueries() {
 	for i, q := range l.BlockedQueries {
 		if q.Regex {
@@ -700,6 +888,16 @@ func (o *Overrides) HAClusterLabel(userID string) string {
 	return o.getOverridesForUser(userID).HAClusterLabel
 }
 
+// HAClusterLabels returns the labels identifying an HA group when deciding whether to accept a sample from an HA replica.
+// It defaults to the cluster label when no HA cluster labels are configured.
+func (o *Overrides) HAClusterLabels(userID string) []string {
+	l := o.getOverridesForUser(userID)
+	if len(l.HAClusterLabels) > 0 {
+		return l.HAClusterLabels
+	}
+	return []string{l.HAClusterLabel}
+}
+
 // HAReplicaLabel returns the replica label to look for when deciding whether to accept a sample from a Prometheus HA replica.
 func (o *Overrides) HAReplicaLabel(userID string) string {
 	return o.getOverridesForUser(userID).HAReplicaLabel
@@ -721,6 +919,26 @@ func (o *Overrides) MaxLabelValueLength(userID string) int {
 	return o.getOverridesForUser(userID).MaxLabelValueLength
 }
 
+// LabelNameTooLongStrategy returns the strategy applied to the series with a label name longer than the maximum length.
+func (o *Overrides) LabelNameTooLongStrategy(userID string) string {
+	return o.getOverridesForUser(userID).LabelNameTooLongStrategy
+}
+
+// LabelValueTooLongStrategy returns the strategy applied to the series with a label value longer than the maximum length.
+func (o *Overrides) LabelValueTooLongStrategy(userID string) string {
+	return o.getOverridesForUser(userID).LabelValueTooLongStrategy
+}
+
+// MetricSchemas returns the metrics accepted for the tenant, with their allowed label names and expected type.
+func (o *Overrides) MetricSchemas(userID string) []MetricSchema {
+	return o.getOverridesForUser(userID).MetricSchemas
+}
+
+// MetricSchemaViolationStrategy returns the strategy applied to the series not conforming to the metric schemas.
+func (o *Overrides) MetricSchemaViolationStrategy(userID string) string {
+	return o.getOverridesForUser(userID).MetricSchemaViolationStrategy
+}
+
 // MaxLabelNamesPerSeries returns maximum number of label/value pairs timeseries.
 func (o *Overrides) MaxLabelNamesPerSeries(userID string) int {
 	return o.getOverridesForUser(userID).MaxLabelNamesPerSeries
@@ -771,6 +989,11 @@ func (o *Overrides) MaxGlobalSeriesPerMetric(userID string) int {
 	return o.getOverridesForUser(userID).MaxGlobalSeriesPerMetric
 }
 
+// MetricLimits returns the limits on the ingestion rate and number of series of the matching series for a given user.
+func (o *Overrides) MetricLimits(userID string) []MetricLimit {
+	return o.getOverridesForUser(userID).MetricLimits
+}
+
 func (o *Overrides) MaxChunksPerQuery(userID string) int {
 	return o.getOverridesForUser(userID).MaxChunksPerQuery
 }
@@ -890,6 +1113,37 @@ func (o *Overrides) QueryIngestersWithin(userID string) time.Duration {
 	return time.Duration(o.getOverridesForUser(userID).QueryIngestersWithin)
 }
 
+// ExternalRemoteReadURL returns the URL of the external remote read endpoint queried in addition to Mimir storage.
+func (o *Overrides) ExternalRemoteReadURL(userID string) string {
+	return o.getOverridesForUser(userID).ExternalRemoteReadURL
+}
+
+// ExternalRemoteReadBasicAuthUsername returns the username used for the basic authentication to the external remote read endpoint.
+func (o *Overrides) ExternalRemoteReadBasicAuthUsername(userID string) string {
+	return o.getOverridesForUser(userID).ExternalRemoteReadBasicAuthUsername
+}
+
+// ExternalRemoteReadBasicAuthPassword returns the password used for the basic authentication to the external remote read endpoint.
+func (o *Overrides) ExternalRemoteReadBasicAuthPassword(userID string) string {
+	return o.getOverridesForUser(userID).ExternalRemoteReadBasicAuthPassword.String()
+}
+
+// ExternalRemoteReadBearerToken returns the bearer token used to authenticate to the external remote read endpoint.
+func (o *Overrides) ExternalRemoteReadBearerToken(userID string) string {
+	return o.getOverridesForUser(userID).ExternalRemoteReadBearerToken.String()
+}
+
+// ExternalRemoteReadQueryAfter returns the time after which a metric should be queried from the external remote read endpoint.
+func (o *Overrides) ExternalRemoteReadQueryAfter(userID string) time.Duration {
+	return time.Duration(o.getOverridesForUser(userID).ExternalRemoteReadQueryAfter)
+}
+
+// StoreGatewayHedgingPercentile returns the percentile of the observed store-gateway latencies
+// after which a hedged series request is sent to another store-gateway. 0 means hedging is disabled.
+func (o *Overrides) StoreGatewayHedgingPercentile(userID string) float64 {
+	return o.getOverridesForUser(userID).StoreGatewayHedgingPercentile
+}
+
 // EnforceMetadataMetricName whether to enforce the presence of a metric name on metadata.
 func (o *Overrides) EnforceMetadataMetricName(userID string) bool {
 	return o.getOverridesForUser(userID).EnforceMetadataMetricName
@@ -968,6 +1222,10 @@ func (o *Overrides) CostAttributionLabelsStructured(userID string) []costattribu
 	return o.getOverridesForUser(userID).CostAttributionLabelsStructured
 }
 
+func (o *Overrides) CostAttributionQueryLabels(userID string) []costattributionmodel.QueryLabel {
+	return o.getOverridesForUser(userID).CostAttributionQueryLabels
+}
+
 func (o *Overrides) CostAttributionCooldown(userID string) time.Duration {
 	return time.Duration(o.getOverridesForUser(userID).CostAttributionCooldown)
 }
@@ -1072,6 +1330,11 @@ func (o *Overrides) MaxExemplarsPerSeriesPerRequest(userID string) int {
 	return o.getOverridesForUser(userID).MaxExemplarsPerSeriesPerRequest
 }
 
+// ExemplarPolicies returns the policies sampling and prioritising the exemplars for a given user.
+func (o *Overrides) ExemplarPolicies(userID string) []ExemplarPolicy {
+	return o.getOverridesForUser(userID).ExemplarPolicies
+}
+
 // RulerTenantShardSize returns shard size (number of rulers) used by this tenant when using shuffle-sharding strategy.
 func (o *Overrides) RulerTenantShardSize(userID string) int {
 	return o.getOverridesForUser(userID).RulerTenantShardSize
@@ -1337,6 +1600,10 @@ func (o *Overrides) Prom2RangeCompat(userID string) bool {
 	return o.getOverridesForUser(userID).Prom2RangeCompat
 }
 
+func (o *Overrides) RemoteWriteConvertClassicHistogramsToNHCB(tenantID string) bool {
+	return o.getOverridesForUser(tenantID).RemoteWriteConvertClassicHistogramsToNHCB
+}
+
 func (o *Overrides) OTelMetricSuffixesEnabled(tenantID string) bool {
 	return o.getOverridesForUser(tenantID).OTelMetricSuffixesEnabled
 }
@@ -1365,6 +1632,46 @@ func (o *Overrides) OTelNativeDeltaIngestion(tenantID string) bool {
 	return o.getOverridesForUser(tenantID).OTelNativeDeltaIngestion
 }
 
+func (o *Overrides) OTelConvertDeltaToCumulative(tenantID string) bool {
+	return o.getOverridesForUser(tenantID).OTelConvertDeltaToCumulative
+}
+
+// InfluxBucketLabel returns the name of the label set to the InfluxDB v2 bucket for a given user.
+func (o *Overrides) InfluxBucketLabel(tenantID string) string {
+	return o.getOverridesForUser(tenantID).InfluxBucketLabel
+}
+
+// InfluxOrgLabel returns the name of the label set to the InfluxDB v2 organization for a given user.
+func (o *Overrides) InfluxOrgLabel(tenantID string) string {
+	return o.getOverridesForUser(tenantID).InfluxOrgLabel
+}
+
+// GraphiteMappingRules returns the rules mapping the Graphite metric paths to metric names and labels for a given user.
+func (o *Overrides) GraphiteMappingRules(tenantID string) []GraphiteMappingRule {
+	return o.getOverridesForUser(tenantID).GraphiteMappingRules
+}
+
+// StreamingAggregationRules returns the rules aggregating series at ingestion for a given user.
+func (o *Overrides) StreamingAggregationRules(tenantID string) []StreamingAggregationRule {
+	return o.getOverridesForUser(tenantID).StreamingAggregationRules
+}
+
+// StreamingAggregationMaxOutputSeries returns the maximum number of output series of the streaming aggregation
+// whose state is kept by each distributor for a given user.
+func (o *Overrides) StreamingAggregationMaxOutputSeries(tenantID string) int {
+	return o.getOverridesForUser(tenantID).StreamingAggregationMaxOutputSeries
+}
+
+// RemoteWriteForwardingRules returns the rules forwarding series to remote write endpoints for a given user.
+func (o *Overrides) RemoteWriteForwardingRules(tenantID string) []RemoteWriteForwardingRule {
+	return o.getOverridesForUser(tenantID).RemoteWriteForwardingRules
+}
+
+// DiskBufferMaxSizeBytes returns the maximum size of the write requests buffered on disk by a distributor for a given user.
+func (o *Overrides) DiskBufferMaxSizeBytes(tenantID string) int64 {
+	return o.getOverridesForUser(tenantID).DiskBufferMaxSizeBytes
+}
+
 // DistributorIngestionArtificialDelay returns the artificial ingestion latency for a given user.
 func (o *Overrides) DistributorIngestionArtificialDelay(tenantID string) time.Duration {
 	overrides := o.getOverridesForUser(tenantID)
@@ -1438,6 +1438,320 @@ metric_relabel_configs:
 			cfg:         `ingest_storage_read_consistency: xyz`,
 			expectedErr: errInvalidIngestStorageReadConsistency.Error(),
 		},
+		"should pass on label_name_too_long_strategy and label_value_too_long_strategy set to truncate": {
+			cfg: `
+label_name_too_long_strategy: truncate
+label_value_too_long_strategy: truncate
+`,
+			expectedErr: "",
+		},
+		"should fail on invalid label_name_too_long_strategy": {
+			cfg:         `label_name_too_long_strategy: drop`,
+			expectedErr: errInvalidLabelNameTooLongStrategy.Error(),
+		},
+		"should fail on invalid label_value_too_long_strategy": {
+			cfg:         `label_value_too_long_strategy: drop`,
+			expectedErr: errInvalidLabelValueTooLongStrategy.Error(),
+		},
+		"should pass on valid metric_schemas": {
+			cfg: `
+metric_schemas:
+  - metric_name: http_requests_total
+    label_names: [job, method]
+    type: counter
+  - metric_name: temperature
+metric_schema_violation_strategy: drop
+`,
+			expectedErr: "",
+		},
+		"should fail on metric_schemas with invalid label name": {
+			cfg: `
+metric_schemas:
+  - metric_name: http_requests_total
+    label_names: [__name__]
+`,
+			expectedErr: `invalid metric_schemas: invalid label name "__name__" for metric "http_requests_total"`,
+		},
+		"should fail on metric_schemas with unsupported type": {
+			cfg: `
+metric_schemas:
+  - metric_name: http_requests_total
+    type: info
+`,
+			expectedErr: `invalid metric_schemas: unsupported type "info" for metric "http_requests_total"`,
+		},
+		"should fail on metric_schemas with duplicate metric name": {
+			cfg: `
+metric_schemas:
+  - metric_name: http_requests_total
+  - metric_name: http_requests_total
+`,
+			expectedErr: `invalid metric_schemas: duplicate metric name "http_requests_total"`,
+		},
+		"should fail on invalid metric_schema_violation_strategy": {
+			cfg:         `metric_schema_violation_strategy: ignore`,
+			expectedErr: errInvalidMetricSchemaViolationStrategy.Error(),
+		},
+		"should pass on valid remote_write_forwarding_rules": {
+			cfg: `
+remote_write_forwarding_rules:
+  - match: '{__name__=~"slo:.+"}'
+    url: https://prometheus.example.com/api/v1/write
+    basic_auth_username: partner
+    basic_auth_password: secret
+    headers:
+      X-Scope-OrgID: partner
+`,
+			expectedErr: "",
+		},
+		"should fail on remote_write_forwarding_rules with invalid url": {
+			cfg: `
+remote_write_forwarding_rules:
+  - match: up
+    url: prometheus.example.com/api/v1/write
+`,
+			expectedErr: `invalid remote_write_forwarding_rules: invalid url for match "up"`,
+		},
+		"should fail on remote_write_forwarding_rules with both basic auth and bearer token": {
+			cfg: `
+remote_write_forwarding_rules:
+  - match: up
+    url: https://prometheus.example.com/api/v1/write
+    basic_auth_username: partner
+    bearer_token: token
+`,
+			expectedErr: `invalid remote_write_forwarding_rules: basic auth and bearer token can't be both set for match "up"`,
+		},
+		"should pass on valid ha_cluster_labels": {
+			cfg:         `ha_cluster_labels: cluster,job`,
+			expectedErr: "",
+		},
+		"should fail on ha_cluster_labels with invalid label name": {
+			cfg:         `ha_cluster_labels: cluster,__name__`,
+			expectedErr: `invalid value for -distributor.ha-tracker.cluster-labels: invalid label name "__name__"`,
+		},
+		"should fail on ha_cluster_labels with duplicate label name": {
+			cfg:         `ha_cluster_labels: cluster,job,cluster`,
+			expectedErr: `invalid value for -distributor.ha-tracker.cluster-labels: duplicate label name "cluster"`,
+		},
+		"should fail on ha_cluster_labels including the replica label": {
+			cfg:         `ha_cluster_labels: cluster,__replica__`,
+			expectedErr: `invalid value for -distributor.ha-tracker.cluster-labels: the replica label "__replica__" can't identify an HA group`,
+		},
+		"should fail if both otel_native_delta_ingestion and otel_convert_delta_to_cumulative are enabled": {
+			cfg: `
+otel_native_delta_ingestion: true
+otel_convert_delta_to_cumulative: true
+`,
+			expectedErr: errOTelDeltaIngestionConflict.Error(),
+		},
+		"should pass if only otel_convert_delta_to_cumulative is enabled": {
+			cfg:         `otel_convert_delta_to_cumulative: true`,
+			expectedErr: "",
+		},
+		"should pass on valid graphite_mapping_rules": {
+			cfg: `
+graphite_mapping_rules:
+  - match: servers.*.cpu.*
+    name: server_cpu
+    labels:
+      host: $1
+  - match: 'apps\.(\w+)\.requests'
+    match_type: regex
+    name: app_requests
+`,
+			expectedErr: "",
+		},
+		"should fail on graphite_mapping_rules without name": {
+			cfg: `
+graphite_mapping_rules:
+  - match: servers.*.cpu.*
+`,
+			expectedErr: `invalid graphite_mapping_rules: empty name for match "servers.*.cpu.*"`,
+		},
+		"should fail on graphite_mapping_rules with invalid regex": {
+			cfg: `
+graphite_mapping_rules:
+  - match: 'servers.(.*'
+    match_type: regex
+    name: server_cpu
+`,
+			expectedErr: `invalid graphite_mapping_rules: invalid match "servers.(.*"`,
+		},
+		"should fail on graphite_mapping_rules with unsupported match type": {
+			cfg: `
+graphite_mapping_rules:
+  - match: servers.*
+    match_type: prefix
+    name: server_cpu
+`,
+			expectedErr: `unsupported match type "prefix"`,
+		},
+		"should fail on external remote read basic authentication and bearer token": {
+			cfg: `
+external_remote_read_basic_auth_username: user
+external_remote_read_bearer_token: token
+`,
+			expectedErr: errExternalRemoteReadAuthConflict.Error(),
+		},
+		"should fail on graphite_mapping_rules with invalid label name": {
+			cfg: `
+graphite_mapping_rules:
+  - match: servers.*.cpu
+    name: server_cpu
+    labels:
+      "": $1
+`,
+			expectedErr: `invalid graphite_mapping_rules: invalid label name "" for match "servers.*.cpu"`,
+		},
+		"should fail on graphite_mapping_rules with metric name label": {
+			cfg: `
+graphite_mapping_rules:
+  - match: servers.*.cpu
+    name: server_cpu
+    labels:
+      __name__: $1
+`,
+			expectedErr: `invalid graphite_mapping_rules: invalid label name "__name__" for match "servers.*.cpu"`,
+		},
+		"should pass on valid streaming_aggregation_rules": {
+			cfg: `
+streaming_aggregation_rules:
+  - match: http_requests_total
+    by: [job]
+    output: job:http_requests_total:sum
+    aggregation: sum
+    counter: true
+  - match: '{__name__="http_request_duration_seconds"}'
+    without: [pod]
+    output: http_request_duration_seconds:histogram_merge
+    aggregation: histogram_merge
+    drop_input: true
+`,
+			expectedErr: "",
+		},
+		"should fail on streaming_aggregation_rules with invalid match": {
+			cfg: `
+streaming_aggregation_rules:
+  - match: 'http_requests_total{'
+    output: http_requests_total:sum
+    aggregation: sum
+`,
+			expectedErr: `invalid streaming_aggregation_rules: invalid match "http_requests_total{"`,
+		},
+		"should fail on streaming_aggregation_rules with unsupported aggregation": {
+			cfg: `
+streaming_aggregation_rules:
+  - match: http_requests_total
+    output: http_requests_total:avg
+    aggregation: avg
+`,
+			expectedErr: `invalid streaming_aggregation_rules: unsupported aggregation "avg" for match "http_requests_total"`,
+		},
+		"should fail on streaming_aggregation_rules with invalid output": {
+			cfg: `
+streaming_aggregation_rules:
+  - match: http_requests_total
+    aggregation: sum
+`,
+			expectedErr: `invalid streaming_aggregation_rules: invalid output "" for match "http_requests_total"`,
+		},
+		"should fail on streaming_aggregation_rules with both by and without": {
+			cfg: `
+streaming_aggregation_rules:
+  - match: http_requests_total
+    by: [job]
+    without: [pod]
+    output: http_requests_total:sum
+    aggregation: sum
+`,
+			expectedErr: `invalid streaming_aggregation_rules: by and without can't be both set for match "http_requests_total"`,
+		},
+		"should fail on invalid cost_attribution_query_labels": {
+			cfg: `
+cost_attribution_query_labels:
+  - output: dashboard
+`,
+			expectedErr: `invalid cost_attribution_query_labels: exactly one of header and matcher must be set for output label "dashboard"`,
+		},
+		"should pass on valid exemplar_policies": {
+			cfg: `
+exemplar_policies:
+  - match: http_request_duration_seconds_bucket
+    sample_rate: 0.1
+    keep_matching: '{status="error"}'
+    keep_value_percentile: 99
+  - match: '{job="batch"}'
+    max_exemplars_per_second: 10
+`,
+		},
+		"should fail on exemplar_policies with invalid keep_matching": {
+			cfg: `
+exemplar_policies:
+  - match: http_request_duration_seconds_bucket
+    keep_matching: '{status=}'
+`,
+			expectedErr: `invalid exemplar_policies: invalid keep_matching "{status=}" for match "http_request_duration_seconds_bucket"`,
+		},
+		"should fail on exemplar_policies with sample rate greater than 1": {
+			cfg: `
+exemplar_policies:
+  - match: http_request_duration_seconds_bucket
+    sample_rate: 1.5
+`,
+			expectedErr: `invalid exemplar_policies: invalid sample rate for match "http_request_duration_seconds_bucket", the value must be between 0 and 1`,
+		},
+		"should fail on exemplar_policies with keep value percentile greater than 100": {
+			cfg: `
+exemplar_policies:
+  - match: http_request_duration_seconds_bucket
+    keep_value_percentile: 101
+`,
+			expectedErr: `invalid exemplar_policies: invalid keep value percentile for match "http_request_duration_seconds_bucket", the value must be between 0 and 100`,
+		},
+		"should pass on valid metric_limits": {
+			cfg: `
+metric_limits:
+  - match: http_requests_total
+    ingestion_rate: 1000
+    max_global_series: 100
+  - match: '{job="batch"}'
+    max_global_series: 50
+`,
+		},
+		"should fail on metric_limits with invalid match": {
+			cfg: `
+metric_limits:
+  - match: http_requests_total{
+    ingestion_rate: 1000
+`,
+			expectedErr: `invalid metric_limits: invalid match "http_requests_total{"`,
+		},
+		"should fail on metric_limits with negative ingestion rate": {
+			cfg: `
+metric_limits:
+  - match: http_requests_total
+    ingestion_rate: -1
+`,
+			expectedErr: `invalid metric_limits: invalid ingestion rate for match "http_requests_total"`,
+		},
+		"should fail on metric_limits with ingestion burst size lower than the ingestion rate": {
+			cfg: `
+metric_limits:
+  - match: http_requests_total
+    ingestion_rate: 1000
+    ingestion_burst_size: 10
+`,
+			expectedErr: `invalid metric_limits: ingestion burst size lower than the ingestion rate for match "http_requests_total"`,
+		},
+		"should fail on metric_limits with negative max global series": {
+			cfg: `
+metric_limits:
+  - match: http_requests_total
+    max_global_series: -1
+`,
+			expectedErr: `invalid metric_limits: negative max global series for match "http_requests_total"`,
+		},
 	}
 
 	for testName, testData := range tests {
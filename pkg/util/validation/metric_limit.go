@@ -0,0 +1,133 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package validation
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+type MetricLimit struct {
+	Match              string  `yaml:"match" json:"match" doc:"description=Series selector of the limited series."`
+	IngestionRate      float64 `yaml:"ingestion_rate,omitempty" json:"ingestion_rate,omitempty" doc:"description=Ingestion rate limit of the matching series, in samples per second, across all distributors. 0 to disable."`
+	IngestionBurstSize int     `yaml:"ingestion_burst_size,omitempty" json:"ingestion_burst_size,omitempty" doc:"description=Allowed burst of samples of the matching series above the ingestion rate limit. Defaults to the ingestion rate limit, rounded up."`
+	MaxGlobalSeries    int     `yaml:"max_global_series,omitempty" json:"max_global_series,omitempty" doc:"description=Maximum number of in-memory matching series, across the cluster before replication. 0 to disable."`
+}
+
+// Matchers returns the matchers of the series selector of the limit.
+func (l MetricLimit) Matchers() ([]*labels.Matcher, error) {
+	return parser.ParseMetricSelector(l.Match)
+}
+
+// Burst returns the allowed burst of samples above the ingestion rate limit.
+func (l MetricLimit) Burst() int {
+	if l.IngestionBurstSize > 0 {
+		return l.IngestionBurstSize
+	}
+	return int(math.Ceil(l.IngestionRate))
+}
+
+func (l MetricLimit) validate() error {
+	if l.Match == "" {
+		return fmt.Errorf("empty match")
+	}
+	if _, err := l.Matchers(); err != nil {
+		return fmt.Errorf("invalid match %q: %w", l.Match, err)
+	}
+	if l.IngestionRate < 0 || math.IsNaN(l.IngestionRate) || math.IsInf(l.IngestionRate, 0) {
+		return fmt.Errorf("invalid ingestion rate for match %q", l.Match)
+	}
+	if l.IngestionBurstSize < 0 {
+		return fmt.Errorf("negative ingestion burst size for match %q", l.Match)
+	}
+	if l.IngestionBurstSize > 0 && float64(l.IngestionBurstSize) < l.IngestionRate {
+		return fmt.Errorf("ingestion burst size lower than the ingestion rate for match %q", l.Match)
+	}
+	if l.MaxGlobalSeries < 0 {
+		return fmt.Errorf("negative max global series for match %q", l.Match)
+	}
+	return nil
+}
+
+type MetricLimitsConfig []MetricLimit
+
+func (c *MetricLimitsConfig) ExampleDoc() (comment string, yaml interface{}) {
+	return `The following configuration limits the samples of "http_request_duration_seconds_bucket" to 10000 per second, and the series of the job "batch" to 50000.`,
+		[]MetricLimit{
+			{
+				Match:         `http_request_duration_seconds_bucket`,
+				IngestionRate: 10000,
+			},
+			{
+				Match:           `{job="batch"}`,
+				MaxGlobalSeries: 50000,
+			},
+		}
+}
+
+// MetricLimitMatcher finds the metric limit applied to a series, caching the parsed selectors of the limits.
+type MetricLimitMatcher struct {
+	mtx      sync.RWMutex
+	matchers map[string][]*labels.Matcher
+}
+
+func NewMetricLimitMatcher() *MetricLimitMatcher {
+	return &MetricLimitMatcher{matchers: map[string][]*labels.Matcher{}}
+}
+
+// Match returns the index of the first limit whose selector matches the series, given the function returning
+// the value of a label of the series, or -1 if no limit matches it.
+func (m *MetricLimitMatcher) Match(limits []MetricLimit, labelValue func(name string) string) int {
+	for i, l := range limits {
+		if m.Matches(l, labelValue) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Matches returns whether the selector of the limit matches the series, given the function returning
+// the value of a label of the series.
+func (m *MetricLimitMatcher) Matches(l MetricLimit, labelValue func(name string) string) bool {
+	return m.MatchesSelector(l.Match, labelValue)
+}
+
+// MatchesSelector returns whether the series selector matches the series, given the function returning
+// the value of a label of the series. An invalid selector never matches.
+func (m *MetricLimitMatcher) MatchesSelector(selector string, labelValue func(name string) string) bool {
+	ms := m.selectorMatchers(selector)
+	if len(ms) == 0 {
+		return false
+	}
+	for _, matcher := range ms {
+		if !matcher.Matches(labelValue(matcher.Name)) {
+			return false
+		}
+	}
+	return true
+}
+
+// selectorMatchers returns the matchers of the series selector, or nil if it's invalid.
+func (m *MetricLimitMatcher) selectorMatchers(selector string) []*labels.Matcher {
+	m.mtx.RLock()
+	ms, ok := m.matchers[selector]
+	m.mtx.RUnlock()
+	if ok {
+		return ms
+	}
+
+	ms, err := parser.ParseMetricSelector(selector)
+	if err != nil {
+		// The selectors are validated when loaded, so this shouldn't happen. The selector is skipped.
+		ms = nil
+	}
+
+	m.mtx.Lock()
+	m.matchers[selector] = ms
+	m.mtx.Unlock()
+	return ms
+}
@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package validation
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricLimitMatcher_Match(t *testing.T) {
+	limits := []MetricLimit{
+		{Match: `http_requests_total{job="api"}`, IngestionRate: 10},
+		{Match: `http_requests_total`, IngestionRate: 100},
+		{Match: `{job=~"batch-.*"}`, MaxGlobalSeries: 10},
+	}
+
+	tests := map[string]struct {
+		series   labels.Labels
+		expected int
+	}{
+		"first matching limit": {
+			series:   labels.FromStrings(labels.MetricName, "http_requests_total", "job", "api"),
+			expected: 0,
+		},
+		"next matching limit": {
+			series:   labels.FromStrings(labels.MetricName, "http_requests_total", "job", "web"),
+			expected: 1,
+		},
+		"selector without metric name": {
+			series:   labels.FromStrings(labels.MetricName, "up", "job", "batch-1"),
+			expected: 2,
+		},
+		"no matching limit": {
+			series:   labels.FromStrings(labels.MetricName, "up", "job", "api"),
+			expected: -1,
+		},
+	}
+
+	matcher := NewMetricLimitMatcher()
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Match twice to cover the cached matchers.
+			assert.Equal(t, tc.expected, matcher.Match(limits, tc.series.Get))
+			assert.Equal(t, tc.expected, matcher.Match(limits, tc.series.Get))
+		})
+	}
+}
+
+func TestMetricLimit_Burst(t *testing.T) {
+	assert.Equal(t, 11, MetricLimit{IngestionRate: 10.5}.Burst())
+	assert.Equal(t, 50, MetricLimit{IngestionRate: 10.5, IngestionBurstSize: 50}.Burst())
+}
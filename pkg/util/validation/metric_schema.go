@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package validation
+
+import (
+	"fmt"
+
+	"github.com/prometheus/common/model"
+)
+
+const (
+	// MetricSchemaViolationStrategyReject drops the series not conforming to the metric schemas, and fails the
+	// request with a partial error.
+	MetricSchemaViolationStrategyReject = "reject"
+	// MetricSchemaViolationStrategyDrop silently drops the series not conforming to the metric schemas.
+	MetricSchemaViolationStrategyDrop = "drop"
+)
+
+// MetricSchemaViolationStrategies are the supported strategies applied to the series not conforming to the metric schemas.
+var MetricSchemaViolationStrategies = []string{MetricSchemaViolationStrategyReject, MetricSchemaViolationStrategyDrop}
+
+// metricSchemaTypes are the supported types of the metric schemas.
+var metricSchemaTypes = []model.MetricType{model.MetricTypeCounter, model.MetricTypeGauge, model.MetricTypeHistogram, model.MetricTypeSummary}
+
+type MetricSchema struct {
+	MetricName string   `yaml:"metric_name" json:"metric_name" doc:"description=Name of the metric. For histograms and summaries, the name of the metric family, without the _bucket, _sum and _count suffixes of the classic histograms and summaries."`
+	LabelNames []string `yaml:"label_names,omitempty" json:"label_names,omitempty" doc:"description=Label names allowed on the series of the metric, in addition to the metric name, the le label of the classic histograms buckets and the quantile label of the summaries."`
+	Type       string   `yaml:"type,omitempty" json:"type,omitempty" doc:"description=Expected type of the metric: counter, gauge, histogram or summary. The series with native histogram samples are rejected unless the type is histogram, and the series named after a histogram with float samples are rejected. If empty, the type isn't enforced and the classic histogram and summary series must be listed by their full name."`
+}
+
+func (s MetricSchema) validate() error {
+	if s.MetricName == "" {
+		return fmt.Errorf("empty metric name")
+	}
+	if !model.IsValidMetricName(model.LabelValue(s.MetricName)) {
+		return fmt.Errorf("invalid metric name %q", s.MetricName)
+	}
+	for _, name := range s.LabelNames {
+		if !model.LabelName(name).IsValid() || name == model.MetricNameLabel {
+			return fmt.Errorf("invalid label name %q for metric %q", name, s.MetricName)
+		}
+	}
+	if s.Type != "" && !s.hasSupportedType() {
+		return fmt.Errorf("unsupported type %q for metric %q", s.Type, s.MetricName)
+	}
+	return nil
+}
+
+func (s MetricSchema) hasSupportedType() bool {
+	for _, t := range metricSchemaTypes {
+		if s.Type == string(t) {
+			return true
+		}
+	}
+	return false
+}
+
+type MetricSchemasConfig []MetricSchema
+
+func (c *MetricSchemasConfig) ExampleDoc() (comment string, yaml interface{}) {
+	return `The following configuration only accepts the "http_requests_total" counter with the labels "job", "instance", "method" and "status", and the "http_request_duration_seconds" histogram with the labels "job" and "instance".`,
+		[]MetricSchema{
+			{
+				MetricName: "http_requests_total",
+				LabelNames: []string{"job", "instance", "method", "status"},
+				Type:       string(model.MetricTypeCounter),
+			},
+			{
+				MetricName: "http_request_duration_seconds",
+				LabelNames: []string{"job", "instance"},
+				Type:       string(model.MetricTypeHistogram),
+			},
+		}
+}
+
+func (c MetricSchemasConfig) validate() error {
+	names := make(map[string]struct{}, len(c))
+	for _, s := range c {
+		if err := s.validate(); err != nil {
+			return err
+		}
+		if _, ok := names[s.MetricName]; ok {
+			return fmt.Errorf("duplicate metric name %q", s.MetricName)
+		}
+		names[s.MetricName] = struct{}{}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package validation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/grafana/dskit/flagext"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+type RemoteWriteForwardingRule struct {
+	Match             string            `yaml:"match" json:"match" doc:"description=Series selector of the forwarded series."`
+	URL               string            `yaml:"url" json:"url" doc:"description=URL of the Prometheus remote write endpoint the matching series are forwarded to."`
+	BasicAuthUsername string            `yaml:"basic_auth_username,omitempty" json:"basic_auth_username,omitempty" doc:"description=Username used for the basic authentication to the remote write endpoint."`
+	BasicAuthPassword flagext.Secret    `yaml:"basic_auth_password,omitempty" json:"basic_auth_password,omitempty" doc:"description=Password used for the basic authentication to the remote write endpoint."`
+	BearerToken       flagext.Secret    `yaml:"bearer_token,omitempty" json:"bearer_token,omitempty" doc:"description=Bearer token used to authenticate to the remote write endpoint. Can't be set together with the basic authentication."`
+	Headers           map[string]string `yaml:"headers,omitempty" json:"headers,omitempty" doc:"description=Additional HTTP headers sent to the remote write endpoint, such as X-Scope-OrgID."`
+}
+
+// remoteWriteForwardingRuleJSON is the JSON representation of a RemoteWriteForwardingRule, whose secrets are strings.
+type remoteWriteForwardingRuleJSON struct {
+	Match             string            `json:"match"`
+	URL               string            `json:"url"`
+	BasicAuthUsername string            `json:"basic_auth_username,omitempty"`
+	BasicAuthPassword string            `json:"basic_auth_password,omitempty"`
+	BearerToken       string            `json:"bearer_token,omitempty"`
+	Headers           map[string]string `json:"headers,omitempty"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler. The secrets are strings, like in YAML.
+func (r *RemoteWriteForwardingRule) UnmarshalJSON(data []byte) error {
+	var raw remoteWriteForwardingRuleJSON
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&raw); err != nil {
+		return err
+	}
+	*r = RemoteWriteForwardingRule{
+		Match:             raw.Match,
+		URL:               raw.URL,
+		BasicAuthUsername: raw.BasicAuthUsername,
+		BasicAuthPassword: flagext.SecretWithValue(raw.BasicAuthPassword),
+		BearerToken:       flagext.SecretWithValue(raw.BearerToken),
+		Headers:           raw.Headers,
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler. The secrets are masked, like in YAML.
+func (r RemoteWriteForwardingRule) MarshalJSON() ([]byte, error) {
+	return json.Marshal(remoteWriteForwardingRuleJSON{
+		Match:             r.Match,
+		URL:               r.URL,
+		BasicAuthUsername: r.BasicAuthUsername,
+		BasicAuthPassword: maskSecret(r.BasicAuthPassword),
+		BearerToken:       maskSecret(r.BearerToken),
+		Headers:           r.Headers,
+	})
+}
+
+func maskSecret(s flagext.Secret) string {
+	masked, _ := s.MarshalYAML()
+	return masked.(string)
+}
+
+// Matchers returns the matchers of the series selector of the rule.
+func (r RemoteWriteForwardingRule) Matchers() ([]*labels.Matcher, error) {
+	return parser.ParseMetricSelector(r.Match)
+}
+
+func (r RemoteWriteForwardingRule) validate() error {
+	if r.Match == "" {
+		return fmt.Errorf("empty match")
+	}
+	if _, err := r.Matchers(); err != nil {
+		return fmt.Errorf("invalid match %q: %w", r.Match, err)
+	}
+	u, err := url.Parse(r.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url for match %q", r.Match)
+	}
+	if r.BasicAuthUsername == "" && r.BasicAuthPassword.String() != "" {
+		return fmt.Errorf("basic auth password set without username for match %q", r.Match)
+	}
+	if r.BasicAuthUsername != "" && r.BearerToken.String() != "" {
+		return fmt.Errorf("basic auth and bearer token can't be both set for match %q", r.Match)
+	}
+	return nil
+}
+
+type RemoteWriteForwardingRulesConfig []RemoteWriteForwardingRule
+
+func (c *RemoteWriteForwardingRulesConfig) ExampleDoc() (comment string, yaml interface{}) {
+	return `The following configuration forwards the series of the metrics whose name starts with "slo:" to a partner's remote write endpoint.`,
+		[]map[string]interface{}{
+			{
+				"match":               `{__name__=~"slo:.+"}`,
+				"url":                 "https://prometheus.example.com/api/v1/write",
+				"basic_auth_username": "partner",
+				"basic_auth_password": "secret",
+			},
+		}
+}
@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package validation
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+const (
+	StreamingAggregationSum            = "sum"
+	StreamingAggregationCount          = "count"
+	StreamingAggregationMin            = "min"
+	StreamingAggregationMax            = "max"
+	StreamingAggregationHistogramMerge = "histogram_merge"
+)
+
+var streamingAggregations = []string{
+	StreamingAggregationSum,
+	StreamingAggregationCount,
+	StreamingAggregationMin,
+	StreamingAggregationMax,
+	StreamingAggregationHistogramMerge,
+}
+
+type StreamingAggregationRule struct {
+	Match       string   `yaml:"match" json:"match" doc:"description=Series selector of the input series."`
+	By          []string `yaml:"by,omitempty" json:"by,omitempty" doc:"description=Labels of the input series kept in the output series. All the other labels are aggregated away. When neither by nor without are set, all the labels are aggregated away. Can't be set together with without."`
+	Without     []string `yaml:"without,omitempty" json:"without,omitempty" doc:"description=Labels of the input series aggregated away. All the other labels are kept in the output series. Can't be set together with by."`
+	Output      string   `yaml:"output" json:"output" doc:"description=Metric name of the output series."`
+	Aggregation string   `yaml:"aggregation" json:"aggregation" doc:"description=Aggregation applied to the input series: sum, count, min, max or histogram_merge. count is the number of input series received in the interval. histogram_merge merges native histograms."`
+	Counter     bool     `yaml:"counter,omitempty" json:"counter,omitempty" doc:"description=Set to true when the input series are counters, or native histograms which aren't gauges. Their increases are summed into a running total, detecting counter resets. Applies to sum and histogram_merge."`
+	DropInput   bool     `yaml:"drop_input,omitempty" json:"drop_input,omitempty" doc:"description=Set to true to drop the input series, storing only the output series."`
+}
+
+// Matchers returns the matchers of the series selector of the rule.
+func (r StreamingAggregationRule) Matchers() ([]*labels.Matcher, error) {
+	return parser.ParseMetricSelector(r.Match)
+}
+
+func (r StreamingAggregationRule) validate() error {
+	if r.Match == "" {
+		return fmt.Errorf("empty match")
+	}
+	if _, err := r.Matchers(); err != nil {
+		return fmt.Errorf("invalid match %q: %w", r.Match, err)
+	}
+	if !model.IsValidMetricName(model.LabelValue(r.Output)) {
+		return fmt.Errorf("invalid output %q for match %q", r.Output, r.Match)
+	}
+	if !slices.Contains(streamingAggregations, r.Aggregation) {
+		return fmt.Errorf("unsupported aggregation %q for match %q", r.Aggregation, r.Match)
+	}
+	if len(r.By) > 0 && len(r.Without) > 0 {
+		return fmt.Errorf("by and without can't be both set for match %q", r.Match)
+	}
+	for _, name := range append(slices.Clone(r.By), r.Without...) {
+		if !model.LabelName(name).IsValid() || name == labels.MetricName {
+			return fmt.Errorf("invalid label name %q for match %q", name, r.Match)
+		}
+	}
+	return nil
+}
+
+type StreamingAggregationRulesConfig []StreamingAggregationRule
+
+func (c *StreamingAggregationRulesConfig) ExampleDoc() (comment string, yaml interface{}) {
+	return `The following configuration sums the counter "http_requests_total" by job and status code into "job:http_requests_total:sum", and drops the input series.`,
+		[]StreamingAggregationRule{
+			{
+				Match:       `http_requests_total`,
+				By:          []string{"job", "status_code"},
+				Output:      "job:http_requests_total:sum",
+				Aggregation: StreamingAggregationSum,
+				Counter:     true,
+				DropInput:   true,
+			},
+		}
+}
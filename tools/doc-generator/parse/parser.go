@@ -380,6 +380,8 @@ func getFieldCustomType(t reflect.Type) (string, bool) {
 		return "string", true
 	case reflect.TypeOf(flagext.CIDRSliceCSV{}).String():
 		return "string", true
+	case reflect.TypeOf(flagext.Secret{}).String():
+		return "string", true
 	case reflect.TypeOf([]*relabel.Config{}).String():
 		return "relabel_config...", true
 	case reflect.TypeOf(asmodel.CustomTrackersConfig{}).String():
@@ -466,6 +468,8 @@ func getCustomFieldType(t reflect.Type) (string, bool) {
 		return "string", true
 	case reflect.TypeOf(flagext.CIDRSliceCSV{}).String():
 		return "string", true
+	case reflect.TypeOf(flagext.Secret{}).String():
+		return "string", true
 	case reflect.TypeOf([]*relabel.Config{}).String():
 		return "relabel_config...", true
 	case reflect.TypeOf(asmodel.CustomTrackersConfig{}).String():